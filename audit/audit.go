@@ -0,0 +1,265 @@
+// Package audit 记录写操作和管理操作的审计日志
+// 每条记录都带有上一条记录的摘要，组成一条哈希链，任何一条记录被修改或删除都能被发现
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gocache/logs"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// errTornRecord 表示审计日志的最后一行没有换行符，说明追加这条记录时进程崩溃了，这条记录没有写完
+var errTornRecord = errors.New("audit: torn record at the end of the log")
+
+// Record 是一条审计记录
+type Record struct {
+	// Seq 是记录的序号，从 1 开始
+	Seq uint64 `json:"seq"`
+
+	// Time 是操作的时间
+	Time time.Time `json:"time"`
+
+	// IP 是执行操作的客户端地址
+	IP string `json:"ip"`
+
+	// KeyID 是执行操作使用的 API key 的标识，不会记录 key 本身
+	KeyID string `json:"key_id,omitempty"`
+
+	// Action 是操作的类型，比如 set、delete、restore
+	Action string `json:"action"`
+
+	// Target 是操作的对象，比如 key 或者备份的名字
+	Target string `json:"target,omitempty"`
+
+	// Status 是操作返回的 HTTP 状态码
+	Status int `json:"status"`
+
+	// Prev 是上一条记录的摘要
+	Prev string `json:"prev"`
+
+	// Hash 是这条记录的摘要，计算时 Hash 字段为空
+	Hash string `json:"hash"`
+}
+
+// digest 计算记录的摘要
+func (r Record) digest() string {
+	r.Hash = ""
+	data, _ := json.Marshal(r)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Filter 是查询审计记录的条件，零值的字段表示不限制
+type Filter struct {
+	Since  time.Time
+	Until  time.Time
+	IP     string
+	KeyID  string
+	Action string
+	Target string
+
+	// Limit 是最多返回的记录数，返回的是满足条件的最新的记录
+	Limit int
+}
+
+// match 返回 r 是否满足条件
+func (f Filter) match(r Record) bool {
+	switch {
+	case !f.Since.IsZero() && r.Time.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && r.Time.After(f.Until):
+		return false
+	case f.IP != "" && r.IP != f.IP:
+		return false
+	case f.KeyID != "" && r.KeyID != f.KeyID:
+		return false
+	case f.Action != "" && r.Action != f.Action:
+		return false
+	case f.Target != "" && r.Target != f.Target:
+		return false
+	}
+	return true
+}
+
+// TamperError 表示审计日志的哈希链断了，说明日志被修改过
+type TamperError struct {
+	// Seq 是第一条校验失败的记录的序号
+	Seq uint64
+
+	// Reason 是校验失败的原因
+	Reason string
+}
+
+func (te *TamperError) Error() string {
+	return fmt.Sprintf("audit: log tampered at record %d: %s", te.Seq, te.Reason)
+}
+
+// Log 是只追加的审计日志，每行是一条 JSON 格式的记录
+type Log struct {
+	// path 是日志文件的路径
+	path string
+
+	// file 是打开的日志文件
+	file *os.File
+
+	// seq 是最后一条记录的序号
+	seq uint64
+
+	// last 是最后一条记录的摘要
+	last string
+
+	// lock 用于保证并发安全
+	lock *sync.Mutex
+}
+
+// Open 打开 path 指定的审计日志，文件不存在时会创建
+// 打开时会校验已有的记录，哈希链断了时返回 TamperError
+// 最后一行没有换行符时说明上次追加记录时进程崩溃了，这不是篡改，没有写完的记录会被截掉
+func Open(path string) (*Log, error) {
+	l := &Log{path: path, lock: &sync.Mutex{}}
+	size, err := readLog(path, func(r Record) error {
+		l.seq, l.last = r.Seq, r.Hash
+		return nil
+	})
+
+	if errors.Is(err, errTornRecord) {
+		logs.Warnf("audit: truncating torn record %d at the end of %s", l.seq+1, path)
+		err = os.Truncate(path, size)
+	}
+
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	l.file, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Append 追加一条记录，Seq、Prev 和 Hash 会被自动填写，Time 为零值时使用当前时间
+func (l *Log) Append(r Record) error {
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+	r.Time = r.Time.UTC()
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	r.Seq = l.seq + 1
+	r.Prev = l.last
+	r.Hash = r.digest()
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	// 审计记录需要立即落盘，不能像 AOF 一样缓冲
+	if _, err = l.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+
+	if err = l.file.Sync(); err != nil {
+		return err
+	}
+	l.seq, l.last = r.Seq, r.Hash
+	return nil
+}
+
+// Query 返回满足条件的记录，按时间从早到晚排列
+// 查询时会校验整个哈希链，哈希链断了时返回 TamperError
+func (l *Log) Query(filter Filter) ([]Record, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	records := make([]Record, 0)
+	_, err := readLog(l.path, func(r Record) error {
+		if !filter.match(r) {
+			return nil
+		}
+
+		records = append(records, r)
+		if filter.Limit > 0 && len(records) > filter.Limit {
+			records = records[1:]
+		}
+		return nil
+	})
+
+	// 打开时已经截掉了没有写完的记录，之后的记录都是完整地追加的，这时最后一行没有换行符说明日志被修改过
+	if errors.Is(err, errTornRecord) {
+		return records, &TamperError{Seq: l.seq + 1, Reason: "unterminated record"}
+	}
+	return records, err
+}
+
+// Verify 校验整个哈希链，哈希链断了时返回 TamperError
+func (l *Log) Verify() error {
+	_, err := l.Query(Filter{Limit: 1})
+	return err
+}
+
+// Close 关闭审计日志
+func (l *Log) Close() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.file.Close()
+}
+
+// readLog 读取 path 指定的审计日志并校验哈希链，每条记录都会按顺序传给 fn，返回校验通过的记录的总字节数
+// 最后一行没有换行符时返回 errTornRecord，这时返回的字节数是这一行开始的位置
+func readLog(path string, fn func(r Record) error) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var size int64
+	var seq uint64
+	last := ""
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			return size, nil
+		}
+
+		if err == io.EOF {
+			return size, errTornRecord
+		}
+
+		if err != nil {
+			return size, err
+		}
+
+		var r Record
+		if err = json.Unmarshal(line, &r); err != nil {
+			return size, &TamperError{Seq: seq + 1, Reason: "malformed record"}
+		}
+
+		switch {
+		case r.Seq != seq+1:
+			return size, &TamperError{Seq: seq + 1, Reason: fmt.Sprintf("unexpected sequence %d", r.Seq)}
+		case r.Prev != last:
+			return size, &TamperError{Seq: r.Seq, Reason: "previous hash mismatch"}
+		case r.Hash != r.digest():
+			return size, &TamperError{Seq: r.Seq, Reason: "hash mismatch"}
+		}
+
+		if err = fn(r); err != nil {
+			return size, err
+		}
+		seq, last = r.Seq, r.Hash
+		size += int64(len(line))
+	}
+}
@@ -0,0 +1,75 @@
+package audit
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeLog 在临时目录中创建有 n 条记录的审计日志，返回日志的路径和内容
+func writeLog(t *testing.T, n int) (string, []byte) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < n; i++ {
+		if err = l.Append(Record{IP: "127.0.0.1", Action: "set", Target: "k", Status: 201}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path, data
+}
+
+func TestOpenTruncatesTornRecord(t *testing.T) {
+	path, data := writeLog(t, 3)
+	if err := os.WriteFile(path, append(append([]byte(nil), data...), `{"seq":4,"time":"2026-`...), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open with a torn record = %v", err)
+	}
+	defer l.Close()
+
+	if truncated, _ := os.ReadFile(path); string(truncated) != string(data) {
+		t.Fatalf("log after Open = %q, want the torn record removed", truncated)
+	}
+
+	if err = l.Append(Record{Action: "delete", Target: "k"}); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := l.Query(Filter{})
+	if err != nil || len(records) != 4 || records[3].Seq != 4 {
+		t.Fatalf("Query = %d records, %v, want 4 records", len(records), err)
+	}
+}
+
+func TestOpenMalformedRecordIsTampering(t *testing.T) {
+	path, data := writeLog(t, 3)
+	if err := os.WriteFile(path, append(append([]byte(nil), data...), "{\"seq\":4,\"time\":\"2026-\n"...), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var tampered *TamperError
+	if _, err := Open(path); !errors.As(err, &tampered) || tampered.Seq != 4 {
+		t.Fatalf("Open with a malformed record = %v, want TamperError at record 4", err)
+	}
+
+	if after, _ := os.ReadFile(path); len(after) <= len(data) {
+		t.Fatal("Open removed a malformed record")
+	}
+}
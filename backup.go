@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// backupCommand 通过管理接口查看、创建和恢复服务器的备份，用法为 backup [flags] <list|create|restore> [name]
+// 服务器需要开启定时备份才会提供这些接口
+func backupCommand(args []string) error {
+	flags := flag.NewFlagSet("backup", flag.ExitOnError)
+	client := bindClientFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: backup [flags] <list|create|restore> [name]\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	args = flags.Args()
+	if len(args) == 0 {
+		flags.Usage()
+		return errors.New("missing operation")
+	}
+
+	var response *http.Response
+	var err error
+	switch args[0] {
+	case "list":
+		response, err = client.do(http.MethodGet, "/admin/backups", "", nil)
+	case "create":
+		response, err = client.do(http.MethodPost, "/admin/backups", "", nil)
+	case "restore":
+		if len(args) < 2 {
+			return errors.New("restore requires a backup name")
+		}
+		response, err = client.do(http.MethodPost, "/admin/backups/"+url.PathEscape(args[1])+"/restore", "", nil)
+	default:
+		return fmt.Errorf("unknown operation %q", args[0])
+	}
+
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+
+	if response.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%s failed: backup not found or backups are not enabled on the server", args[0])
+	}
+
+	if response.StatusCode/100 != 2 {
+		return fmt.Errorf("%s failed: %s %s", args[0], response.Status, strings.TrimSpace(string(body)))
+	}
+
+	switch args[0] {
+	case "list":
+		var result struct {
+			Backups []string `json:"backups"`
+		}
+		if err = json.Unmarshal(body, &result); err != nil {
+			return err
+		}
+
+		for _, name := range result.Backups {
+			fmt.Println(name)
+		}
+	case "create":
+		var result struct {
+			Name string `json:"name"`
+		}
+		if err = json.Unmarshal(body, &result); err != nil {
+			return err
+		}
+		fmt.Printf("created backup %s\n", result.Name)
+	case "restore":
+		fmt.Printf("restored backup %s\n", args[1])
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package backups
+
+import (
+	"context"
+	"gocache/caches"
+	"io"
+)
+
+// Backup 将缓存的数据备份到 target 中，备份的名字为 name
+// 数据会一边序列化一边上传，不会先写到本地磁盘
+func Backup(ctx context.Context, cache *caches.Cache, target BackupTarget, name string) error {
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(cache.Save(writer))
+	}()
+
+	err := target.Put(ctx, name, reader)
+	reader.CloseWithError(err)
+	return err
+}
+
+// Restore 使用 target 中名字为 name 的备份恢复缓存的数据
+func Restore(ctx context.Context, cache *caches.Cache, target BackupTarget, name string) error {
+	reader, err := target.Get(ctx, name)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	return cache.Load(reader)
+}
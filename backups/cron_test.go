@@ -0,0 +1,142 @@
+package backups
+
+import (
+	"testing"
+	"time"
+)
+
+// bitsOf 返回 values 组成的位图
+func bitsOf(values ...int) uint64 {
+	var bits uint64
+	for _, v := range values {
+		bits |= 1 << uint(v)
+	}
+	return bits
+}
+
+// rangeBits 返回从 start 到 end 每隔 step 个取值组成的位图
+func rangeBits(start int, end int, step int) uint64 {
+	var bits uint64
+	for i := start; i <= end; i += step {
+		bits |= 1 << uint(i)
+	}
+	return bits
+}
+
+func TestParseCronField(t *testing.T) {
+	tests := []struct {
+		field string
+		want  uint64
+	}{
+		{"*", rangeBits(0, 59, 1)},
+		{"5", bitsOf(5)},
+		{"0", bitsOf(0)},
+		{"59", bitsOf(59)},
+		{"1-5", rangeBits(1, 5, 1)},
+		{"*/15", bitsOf(0, 15, 30, 45)},
+		{"10-30/10", bitsOf(10, 20, 30)},
+		{"5/20", bitsOf(5, 25, 45)},
+		{"1,3,5", bitsOf(1, 3, 5)},
+		{"1-3,10-20/5,59", bitsOf(1, 2, 3, 10, 15, 20, 59)},
+		{"7-7", bitsOf(7)},
+		{"0-59/60", bitsOf(0)},
+	}
+
+	for _, test := range tests {
+		got, err := parseCronField(test.field, 0, 59)
+		if err != nil || got != test.want {
+			t.Errorf("parseCronField(%q) = %b, %v, want %b", test.field, got, err, test.want)
+		}
+	}
+}
+
+func TestParseCronFieldInvalid(t *testing.T) {
+	for _, field := range []string{
+		"", "60", "-1", "5-", "-5", "5-1", "a", "1,,2", "1,", "*/0", "*/-1", "*/", "*/a",
+		"1-2-3", "**", "*-5", "1.5", " 1", "99999999999999999999",
+	} {
+		if bits, err := parseCronField(field, 0, 59); err == nil {
+			t.Errorf("parseCronField(%q) = %b, want an error", field, bits)
+		}
+	}
+}
+
+func TestParseSchedule(t *testing.T) {
+	s, err := ParseSchedule("30 2 1,15 */3 1-5")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.minute != bitsOf(30) || s.hour != bitsOf(2) || s.day != bitsOf(1, 15) ||
+		s.month != bitsOf(1, 4, 7, 10) || s.weekday != rangeBits(1, 5, 1) || s.dayStar || s.weekdayStar {
+		t.Errorf("ParseSchedule = %+v", s)
+	}
+
+	// 星期中的 7 也表示星期天
+	if s, err := ParseSchedule("0 0 * * 7"); err != nil || s.weekday&1 == 0 {
+		t.Errorf("weekday 7 = %+v, %v, want sunday", s, err)
+	}
+
+	daily, err := ParseSchedule(" @daily ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expanded, _ := ParseSchedule("0 0 * * *"); *daily != *expanded {
+		t.Errorf("@daily = %+v, want %+v", daily, expanded)
+	}
+
+	for _, expr := range []string{
+		"", "* * * *", "* * * * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * 32 * *",
+		"* * * 0 *", "* * * 13 *", "* * * * 8", "@every 5m", "@unknown",
+	} {
+		if _, err := ParseSchedule(expr); err == nil {
+			t.Errorf("ParseSchedule(%q) succeeded", expr)
+		}
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	shanghai := time.FixedZone("CST", 8*3600)
+	date := func(year int, month time.Month, day int, hour int, minute int) time.Time {
+		return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"* * * * *", date(2024, 1, 1, 0, 0).Add(30 * time.Second), date(2024, 1, 1, 0, 1)},
+		{"* * * * *", date(2024, 1, 1, 0, 0), date(2024, 1, 1, 0, 1)},
+		{"*/15 * * * *", date(2024, 1, 1, 10, 50), date(2024, 1, 1, 11, 0)},
+		{"30 2 * * *", date(2024, 1, 1, 2, 30), date(2024, 1, 2, 2, 30)},
+		{"0 0 1 * *", date(2024, 1, 31, 12, 0), date(2024, 2, 1, 0, 0)},
+		{"@yearly", date(2024, 6, 1, 0, 0), date(2025, 1, 1, 0, 0)},
+		{"@hourly", date(2024, 12, 31, 23, 59), date(2025, 1, 1, 0, 0)},
+		// 2024-01-01 是星期一
+		{"0 9 * * 1-5", date(2024, 1, 5, 10, 0), date(2024, 1, 8, 9, 0)},
+		{"@weekly", date(2024, 1, 1, 0, 0), date(2024, 1, 7, 0, 0)},
+		{"0 0 * * 7", date(2024, 1, 1, 0, 0), date(2024, 1, 7, 0, 0)},
+		// 日期和星期都不是 * 时满足其中一个就可以
+		{"0 0 13 * 5", date(2024, 1, 1, 0, 0), date(2024, 1, 5, 0, 0)},
+		{"0 0 13 * 5", date(2024, 1, 12, 1, 0), date(2024, 1, 13, 0, 0)},
+		// 日期是 * 时只看星期
+		{"0 0 * * 5", date(2024, 1, 1, 0, 0), date(2024, 1, 5, 0, 0)},
+		{"0 0 29 2 *", date(2024, 3, 1, 0, 0), date(2028, 2, 29, 0, 0)},
+		{"0 0 31 * *", date(2024, 4, 1, 0, 0), date(2024, 5, 31, 0, 0)},
+		{"0 0 30 2 *", date(2024, 1, 1, 0, 0), time.Time{}},
+		{"0 8 * * *", time.Date(2024, 1, 1, 9, 0, 0, 0, shanghai), time.Date(2024, 1, 2, 8, 0, 0, 0, shanghai)},
+	}
+
+	for _, test := range tests {
+		s, err := ParseSchedule(test.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := s.Next(test.from); !got.Equal(test.want) {
+			t.Errorf("%q.Next(%s) = %s, want %s", test.expr, test.from, got, test.want)
+		}
+	}
+}
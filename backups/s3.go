@@ -0,0 +1,355 @@
+package backups
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// s3PartSize 是分片上传时每个分片的大小，S3 要求除了最后一个分片外每个分片至少 5MB
+	s3PartSize = 8 << 20
+
+	// s3UnsignedPayload 表示请求体不参与签名，用于流式上传
+	s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+// S3Config 是 S3 兼容的对象存储的配置
+// 兼容 AWS S3、MinIO，以及使用 HMAC 密钥访问的 GCS（Endpoint 为 https://storage.googleapis.com）
+type S3Config struct {
+	// Endpoint 是对象存储的地址，比如 https://s3.us-east-1.amazonaws.com
+	Endpoint string
+
+	// Region 是签名时使用的区域，GCS 可以使用 auto
+	Region string
+
+	// Bucket 是保存备份的桶
+	Bucket string
+
+	// Prefix 是备份对象名的前缀，比如 "gocache/"
+	Prefix string
+
+	// AccessKey 和 SecretKey 是访问对象存储的密钥
+	AccessKey string
+	SecretKey string
+
+	// Client 是发送请求使用的客户端，为 nil 时使用 http.DefaultClient
+	Client *http.Client
+}
+
+// S3Target 将备份保存到 S3 兼容的对象存储中，使用 path-style 的地址访问
+type S3Target struct {
+	config S3Config
+}
+
+// NewS3Target 返回一个将备份保存到对象存储的 S3Target
+func NewS3Target(config S3Config) *S3Target {
+	if config.Client == nil {
+		config.Client = http.DefaultClient
+	}
+	config.Endpoint = strings.TrimSuffix(config.Endpoint, "/")
+	return &S3Target{config: config}
+}
+
+// Put 将 r 中的内容保存为名字为 name 的备份
+// 内容不超过一个分片时直接上传，否则使用分片上传，不需要把整个备份先写到本地磁盘
+func (st *S3Target) Put(ctx context.Context, name string, r io.Reader) error {
+	part := make([]byte, s3PartSize)
+	n, err := io.ReadFull(r, part)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		_, err = st.do(ctx, http.MethodPut, st.objectPath(name), nil, part[:n], http.StatusOK)
+		return err
+	}
+
+	if err != nil {
+		return err
+	}
+	return st.putMultipart(ctx, name, part, r)
+}
+
+// putMultipart 使用分片上传保存备份，first 是已经读取的第一个分片
+func (st *S3Target) putMultipart(ctx context.Context, name string, first []byte, r io.Reader) error {
+	path := st.objectPath(name)
+	body, err := st.do(ctx, http.MethodPost, path, url.Values{"uploads": {""}}, nil, http.StatusOK)
+	if err != nil {
+		return err
+	}
+
+	var initiate struct {
+		UploadID string `xml:"UploadId"`
+	}
+
+	if err = xml.Unmarshal(body, &initiate); err != nil {
+		return err
+	}
+
+	abort := func(err error) error {
+		st.do(context.Background(), http.MethodDelete, path, url.Values{"uploadId": {initiate.UploadID}}, nil, http.StatusNoContent)
+		return err
+	}
+
+	type completedPart struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	}
+
+	var parts []completedPart
+	part := first
+	for number := 1; len(part) > 0; number++ {
+		query := url.Values{"partNumber": {fmt.Sprint(number)}, "uploadId": {initiate.UploadID}}
+		etag, err := st.uploadPart(ctx, path, query, part)
+		if err != nil {
+			return abort(err)
+		}
+		parts = append(parts, completedPart{PartNumber: number, ETag: etag})
+
+		part = make([]byte, s3PartSize)
+		n, err := io.ReadFull(r, part)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return abort(err)
+		}
+		part = part[:n]
+	}
+
+	complete, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+
+	if err != nil {
+		return abort(err)
+	}
+
+	_, err = st.do(ctx, http.MethodPost, path, url.Values{"uploadId": {initiate.UploadID}}, complete, http.StatusOK)
+	if err != nil {
+		return abort(err)
+	}
+	return nil
+}
+
+// uploadPart 上传一个分片并返回分片的 ETag
+func (st *S3Target) uploadPart(ctx context.Context, path string, query url.Values, part []byte) (string, error) {
+	request, err := st.newRequest(ctx, http.MethodPut, path, query, part)
+	if err != nil {
+		return "", err
+	}
+
+	response, err := st.config.Client.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", st.responseError(response)
+	}
+	return response.Header.Get("ETag"), nil
+}
+
+// Get 返回名字为 name 的备份的内容
+func (st *S3Target) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	request, err := st.newRequest(ctx, http.MethodGet, st.objectPath(name), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := st.config.Client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode == http.StatusNotFound {
+		response.Body.Close()
+		return nil, ErrNotFound
+	}
+
+	if response.StatusCode != http.StatusOK {
+		defer response.Body.Close()
+		return nil, st.responseError(response)
+	}
+	return response.Body, nil
+}
+
+// List 返回所有备份的名字
+func (st *S3Target) List(ctx context.Context) ([]string, error) {
+	var names []string
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {st.config.Prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		body, err := st.do(ctx, http.MethodGet, "/"+st.config.Bucket, query, nil, http.StatusOK)
+		if err != nil {
+			return nil, err
+		}
+
+		var result struct {
+			Contents []struct {
+				Key string `xml:"Key"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+
+		if err = xml.Unmarshal(body, &result); err != nil {
+			return nil, err
+		}
+
+		for _, content := range result.Contents {
+			names = append(names, strings.TrimPrefix(content.Key, st.config.Prefix))
+		}
+
+		if !result.IsTruncated {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
+
+// Delete 删除名字为 name 的备份
+func (st *S3Target) Delete(ctx context.Context, name string) error {
+	_, err := st.do(ctx, http.MethodDelete, st.objectPath(name), nil, nil, http.StatusNoContent)
+	return err
+}
+
+// objectPath 返回备份对象的路径
+func (st *S3Target) objectPath(name string) string {
+	return "/" + st.config.Bucket + "/" + st.config.Prefix + name
+}
+
+// do 发送请求并返回响应体，响应状态码不是 expected 时返回错误
+func (st *S3Target) do(ctx context.Context, method string, path string, query url.Values, body []byte, expected int) ([]byte, error) {
+	request, err := st.newRequest(ctx, method, path, query, body)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := st.config.Client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotFound && method != http.MethodPost {
+		return nil, ErrNotFound
+	}
+
+	// 删除对象时有的实现会返回 200
+	if response.StatusCode != expected && !(expected == http.StatusNoContent && response.StatusCode == http.StatusOK) {
+		return nil, st.responseError(response)
+	}
+	return ioutil.ReadAll(response.Body)
+}
+
+// responseError 返回对象存储响应的错误信息
+func (st *S3Target) responseError(response *http.Response) error {
+	body, _ := ioutil.ReadAll(io.LimitReader(response.Body, 4096))
+	return fmt.Errorf("backups: s3 %s %s failed: %s %s", response.Request.Method, response.Request.URL.Path, response.Status, bytes.TrimSpace(body))
+}
+
+// newRequest 创建一个使用 AWS Signature Version 4 签名的请求
+func (st *S3Target) newRequest(ctx context.Context, method string, path string, query url.Values, body []byte) (*http.Request, error) {
+	target := st.config.Endpoint + s3EscapePath(path)
+	if len(query) > 0 {
+		target += "?" + s3CanonicalQuery(query)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	request.Header.Set("x-amz-date", amzDate)
+	request.Header.Set("x-amz-content-sha256", s3UnsignedPayload)
+	request.ContentLength = int64(len(body))
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		method,
+		s3EscapePath(path),
+		s3CanonicalQuery(query),
+		"host:" + request.URL.Host,
+		"x-amz-content-sha256:" + s3UnsignedPayload,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		s3UnsignedPayload,
+	}, "\n")
+
+	scope := date + "/" + st.config.Region + "/s3/aws4_request"
+	hashed := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hashed[:])
+
+	key := s3HMAC([]byte("AWS4"+st.config.SecretKey), date)
+	key = s3HMAC(key, st.config.Region)
+	key = s3HMAC(key, "s3")
+	key = s3HMAC(key, "aws4_request")
+	signature := hex.EncodeToString(s3HMAC(key, stringToSign))
+
+	request.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		st.config.AccessKey, scope, signedHeaders, signature))
+	return request, nil
+}
+
+// s3HMAC 返回 HMAC-SHA256 的结果
+func s3HMAC(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3Escape 按照签名的要求编码字符串，只有 A-Z、a-z、0-9、'-'、'_'、'.'、'~' 不需要编码
+func s3Escape(s string, keepSlash bool) string {
+	var builder strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (keepSlash && c == '/') {
+			builder.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&builder, "%%%02X", c)
+	}
+	return builder.String()
+}
+
+// s3EscapePath 编码路径
+func s3EscapePath(path string) string {
+	return s3Escape(path, true)
+}
+
+// s3CanonicalQuery 返回按照 key 排序并编码后的查询参数
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		for _, value := range query[key] {
+			pairs = append(pairs, s3Escape(key, false)+"="+s3Escape(value, false))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
@@ -0,0 +1,192 @@
+package backups
+
+import (
+	"context"
+	"fmt"
+	"gocache/caches"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// backupPrefix 和 backupSuffix 是定时备份的名字的前缀和后缀
+	backupPrefix = "gocache-"
+	backupSuffix = ".snapshot"
+
+	// backupTimeLayout 是备份名字中时间的格式
+	backupTimeLayout = "20060102T150405Z"
+)
+
+// Retention 是备份的保留策略
+// 每天最新的备份保留最近 Daily 天，每周最新的备份保留最近 Weekly 周，满足任意一条就会被保留
+// 最新的备份总是会被保留，两者都为 0 时不删除任何备份
+type Retention struct {
+	Daily  int
+	Weekly int
+}
+
+// Scheduler 按照 cron 表达式定时备份缓存，并根据保留策略删除旧的备份
+type Scheduler struct {
+	// cache 是需要备份的缓存
+	cache *caches.Cache
+
+	// target 是保存备份的地方
+	target BackupTarget
+
+	// schedule 是备份的时间表
+	schedule *Schedule
+
+	// retention 是备份的保留策略
+	retention Retention
+
+	// lock 保证同一时间只有一个备份或者恢复在进行
+	lock *sync.Mutex
+
+	// stop 用于通知后台协程退出
+	stop chan struct{}
+
+	// wg 用于等待后台协程退出
+	wg sync.WaitGroup
+
+	// OnError 在定时备份失败时被调用，为 nil 时忽略错误
+	OnError func(err error)
+}
+
+// NewScheduler 返回一个定时备份器，需要调用 Start 才会开始工作
+func NewScheduler(cache *caches.Cache, target BackupTarget, schedule *Schedule, retention Retention) *Scheduler {
+	return &Scheduler{
+		cache:     cache,
+		target:    target,
+		schedule:  schedule,
+		retention: retention,
+		lock:      &sync.Mutex{},
+		stop:      make(chan struct{}),
+	}
+}
+
+// Start 开启后台协程，在时间表指定的时间进行备份
+func (s *Scheduler) Start() {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			next := s.schedule.Next(time.Now())
+			if next.IsZero() {
+				return
+			}
+
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-timer.C:
+				if _, err := s.BackupNow(context.Background()); err != nil && s.OnError != nil {
+					s.OnError(err)
+				}
+			case <-s.stop:
+				timer.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止定时备份，并等待正在进行的备份结束
+func (s *Scheduler) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+}
+
+// BackupNow 立即进行一次备份并应用保留策略，返回备份的名字
+func (s *Scheduler) BackupNow(ctx context.Context) (string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	name := backupPrefix + time.Now().UTC().Format(backupTimeLayout) + backupSuffix
+	if err := Backup(ctx, s.cache, s.target, name); err != nil {
+		return "", err
+	}
+	return name, s.prune(ctx)
+}
+
+// Restore 使用名字为 name 的备份恢复缓存的数据
+func (s *Scheduler) Restore(ctx context.Context, name string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return Restore(ctx, s.cache, s.target, name)
+}
+
+// List 返回定时备份产生的所有备份的名字，按时间从旧到新排序
+func (s *Scheduler) List(ctx context.Context) ([]string, error) {
+	names, err := s.target.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	backups := make([]string, 0, len(names))
+	for _, name := range names {
+		if _, ok := parseBackupTime(name); ok {
+			backups = append(backups, name)
+		}
+	}
+	sort.Strings(backups)
+	return backups, nil
+}
+
+// prune 根据保留策略删除旧的备份
+func (s *Scheduler) prune(ctx context.Context) error {
+	if s.retention.Daily <= 0 && s.retention.Weekly <= 0 {
+		return nil
+	}
+
+	names, err := s.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	keep := make(map[string]bool)
+	days := make(map[string]bool)
+	weeks := make(map[string]bool)
+
+	// 从新到旧遍历，每天和每周遇到的第一个备份就是最新的
+	for i := len(names) - 1; i >= 0; i-- {
+		t, _ := parseBackupTime(names[i])
+		if i == len(names)-1 {
+			keep[names[i]] = true
+		}
+
+		day := t.Format("2006-01-02")
+		if !days[day] && len(days) < s.retention.Daily {
+			days[day] = true
+			keep[names[i]] = true
+		}
+
+		year, week := t.ISOWeek()
+		weekKey := fmt.Sprintf("%d-%d", year, week)
+		if !weeks[weekKey] && len(weeks) < s.retention.Weekly {
+			weeks[weekKey] = true
+			keep[names[i]] = true
+		}
+	}
+
+	for _, name := range names {
+		if keep[name] {
+			continue
+		}
+
+		if err := s.target.Delete(ctx, name); err != nil && err != ErrNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseBackupTime 从定时备份的名字中解析出备份的时间
+func parseBackupTime(name string) (time.Time, bool) {
+	if !strings.HasPrefix(name, backupPrefix) || !strings.HasSuffix(name, backupSuffix) {
+		return time.Time{}, false
+	}
+
+	t, err := time.Parse(backupTimeLayout, strings.TrimSuffix(strings.TrimPrefix(name, backupPrefix), backupSuffix))
+	return t, err == nil
+}
@@ -0,0 +1,132 @@
+package backups
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// memoryTarget 把备份保存在内存中
+type memoryTarget struct {
+	backups map[string][]byte
+}
+
+func newMemoryTarget(names ...string) *memoryTarget {
+	mt := &memoryTarget{backups: make(map[string][]byte)}
+	for _, name := range names {
+		mt.backups[name] = nil
+	}
+	return mt
+}
+
+func (mt *memoryTarget) Put(ctx context.Context, name string, r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
+	mt.backups[name] = data
+	return err
+}
+
+func (mt *memoryTarget) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	data, ok := mt.backups[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (mt *memoryTarget) List(ctx context.Context) ([]string, error) {
+	names := make([]string, 0, len(mt.backups))
+	for name := range mt.backups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (mt *memoryTarget) Delete(ctx context.Context, name string) error {
+	if _, ok := mt.backups[name]; !ok {
+		return ErrNotFound
+	}
+	delete(mt.backups, name)
+	return nil
+}
+
+// backupName 返回 layout 格式的时间 value 对应的定时备份的名字
+func backupName(value string) string {
+	t, err := time.Parse("2006-01-02 15:04", value)
+	if err != nil {
+		panic(err)
+	}
+	return backupPrefix + t.Format(backupTimeLayout) + backupSuffix
+}
+
+// backupNames 返回多个时间对应的定时备份的名字
+func backupNames(values ...string) []string {
+	names := make([]string, len(values))
+	for i, value := range values {
+		names[i] = backupName(value)
+	}
+	return names
+}
+
+func TestPrune(t *testing.T) {
+	// 2024-01-01 是星期一，这些备份分布在 3 个 ISO 周中
+	all := backupNames(
+		"2023-12-31 12:00",
+		"2024-01-01 00:00", "2024-01-01 12:00",
+		"2024-01-03 06:00",
+		"2024-01-07 23:00",
+		"2024-01-08 01:00", "2024-01-08 02:00",
+		"2024-01-09 00:00",
+	)
+
+	tests := []struct {
+		name      string
+		retention Retention
+		want      []string
+	}{
+		{"no retention", Retention{}, all},
+		{"daily", Retention{Daily: 3}, backupNames("2024-01-07 23:00", "2024-01-08 02:00", "2024-01-09 00:00")},
+		{"one day keeps newest", Retention{Daily: 1}, backupNames("2024-01-09 00:00")},
+		{"weekly", Retention{Weekly: 2}, backupNames("2024-01-07 23:00", "2024-01-09 00:00")},
+		{"weekly across years", Retention{Weekly: 3}, backupNames("2023-12-31 12:00", "2024-01-07 23:00", "2024-01-09 00:00")},
+		{"daily and weekly", Retention{Daily: 2, Weekly: 3}, backupNames("2023-12-31 12:00", "2024-01-07 23:00", "2024-01-08 02:00", "2024-01-09 00:00")},
+		{"more than available", Retention{Daily: 100, Weekly: 100}, backupNames("2023-12-31 12:00", "2024-01-01 12:00", "2024-01-03 06:00", "2024-01-07 23:00", "2024-01-08 02:00", "2024-01-09 00:00")},
+	}
+
+	for _, test := range tests {
+		target := newMemoryTarget(all...)
+		target.backups["manual.snapshot"] = nil
+		s := NewScheduler(nil, target, nil, test.retention)
+		if err := s.prune(context.Background()); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		got, _ := s.List(context.Background())
+		if strings.Join(got, ",") != strings.Join(test.want, ",") {
+			t.Errorf("%s: kept\n%q\nwant\n%q", test.name, got, test.want)
+		}
+
+		// 不是定时备份产生的备份不受保留策略影响
+		if _, ok := target.backups["manual.snapshot"]; !ok {
+			t.Errorf("%s: deleted a backup not created by the scheduler", test.name)
+		}
+	}
+}
+
+func TestParseBackupTime(t *testing.T) {
+	name := backupName("2024-01-08 02:00")
+	if got, ok := parseBackupTime(name); !ok || !got.Equal(time.Date(2024, 1, 8, 2, 0, 0, 0, time.UTC)) {
+		t.Errorf("parseBackupTime(%q) = %s, %v", name, got, ok)
+	}
+
+	for _, name := range []string{"manual.snapshot", "gocache-.snapshot", "gocache-20240108T020000Z.rdb", "gocache-2024-01-08.snapshot"} {
+		if _, ok := parseBackupTime(name); ok {
+			t.Errorf("parseBackupTime(%q) succeeded", name)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// 用于存放备份相关的代码
+package backups
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ErrNotFound 表示备份不存在
+var ErrNotFound = errors.New("backups: backup not found")
+
+// BackupTarget 是保存备份的地方，比如本地目录或者对象存储
+type BackupTarget interface {
+	// Put 将 r 中的内容保存为名字为 name 的备份
+	Put(ctx context.Context, name string, r io.Reader) error
+
+	// Get 返回名字为 name 的备份的内容，备份不存在时返回 ErrNotFound
+	Get(ctx context.Context, name string) (io.ReadCloser, error)
+
+	// List 返回所有备份的名字，按名字排序
+	List(ctx context.Context) ([]string, error)
+
+	// Delete 删除名字为 name 的备份
+	Delete(ctx context.Context, name string) error
+}
+
+// LocalTarget 将备份保存到本地目录中
+type LocalTarget struct {
+	// dir 是保存备份的目录
+	dir string
+}
+
+// NewLocalTarget 返回一个将备份保存到 dir 目录的 LocalTarget
+func NewLocalTarget(dir string) *LocalTarget {
+	return &LocalTarget{dir: dir}
+}
+
+// Put 将 r 中的内容保存为名字为 name 的备份
+func (lt *LocalTarget) Put(ctx context.Context, name string, r io.Reader) error {
+	if err := os.MkdirAll(lt.dir, 0755); err != nil {
+		return err
+	}
+
+	// 先写到临时文件再重命名，避免留下不完整的备份
+	name = filepath.Base(name)
+	tmp, err := os.CreateTemp(lt.dir, name+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(lt.dir, name))
+}
+
+// Get 返回名字为 name 的备份的内容
+func (lt *LocalTarget) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	file, err := os.Open(filepath.Join(lt.dir, filepath.Base(name)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return file, err
+}
+
+// List 返回所有备份的名字
+func (lt *LocalTarget) List(ctx context.Context) ([]string, error) {
+	entries, err := os.ReadDir(lt.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && !strings.Contains(entry.Name(), ".tmp-") {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Delete 删除名字为 name 的备份
+func (lt *LocalTarget) Delete(ctx context.Context, name string) error {
+	err := os.Remove(filepath.Join(lt.dir, filepath.Base(name)))
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNotFound
+	}
+	return err
+}
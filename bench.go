@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"gocache/caches"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// benchCommand 对服务器进行压力测试，随机地读写 keys 个 key，最后打印吞吐量和每种操作的耗时分布
+// 指定 -local 时不访问服务器，直接读写进程内的缓存，可以比较不同 -segments 下存储引擎本身的吞吐量
+func benchCommand(args []string) error {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	client := bindClientFlags(flags)
+	requests := flags.Int("n", 100000, "总的请求数")
+	concurrency := flags.Int("c", 50, "并发的客户端数")
+	size := flags.Int("size", 128, "写入的 value 的字节数")
+	keys := flags.Int("keys", 10000, "读写的 key 的个数")
+	readRatio := flags.Float64("read-ratio", 0.8, "读请求所占的比例，范围是 [0, 1]")
+	local := flags.Bool("local", false, "不访问服务器，直接读写进程内的缓存")
+	segments := flags.Int("segments", 256, "指定 -local 时缓存数据的分片数")
+	flags.Parse(args)
+
+	if *requests <= 0 || *concurrency <= 0 || *keys <= 0 || *readRatio < 0 || *readRatio > 1 || *segments <= 0 {
+		return fmt.Errorf("invalid bench parameters")
+	}
+
+	value := bytes.Repeat([]byte("x"), *size)
+
+	// do 执行一次读或者写，返回读取是否没有命中
+	var do func(read bool, key string) (bool, error)
+	if *local {
+		options := caches.DefaultOptions()
+		options.Segments = *segments
+		cache := caches.NewCacheWithOptions(options)
+		do = func(read bool, key string) (bool, error) {
+			if read {
+				_, ok := cache.Get(key)
+				return !ok, nil
+			}
+			cache.Set(key, value)
+			return false, nil
+		}
+	} else {
+		// 压力测试需要很多并发连接，默认的客户端只会保留 2 个空闲连接
+		http.DefaultTransport.(*http.Transport).MaxIdleConnsPerHost = *concurrency
+		do = func(read bool, key string) (bool, error) {
+			path := "/cache/" + key
+			var response *http.Response
+			var err error
+			if read {
+				response, err = client.do(http.MethodGet, path, "", nil)
+			} else {
+				response, err = client.do(http.MethodPut, path, "", bytes.NewReader(value))
+			}
+
+			if err != nil {
+				return false, err
+			}
+
+			// 读完响应体才能复用连接
+			io.Copy(ioutil.Discard, response.Body)
+			response.Body.Close()
+			switch {
+			case read && response.StatusCode == http.StatusNotFound:
+				return true, nil
+			case response.StatusCode/100 != 2:
+				return false, fmt.Errorf("unexpected status %s", response.Status)
+			}
+			return false, nil
+		}
+	}
+
+	var getLatency, setLatency caches.Histogram
+	var remaining, errors, misses int64 = int64(*requests), 0, 0
+	var firstErr atomic.Value
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < *concurrency; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			random := rand.New(rand.NewSource(seed))
+			for atomic.AddInt64(&remaining, -1) >= 0 {
+				key := "bench:" + strconv.Itoa(random.Intn(*keys))
+				read := random.Float64() < *readRatio
+
+				begin := time.Now()
+				miss, err := do(read, key)
+				if miss {
+					atomic.AddInt64(&misses, 1)
+				}
+
+				if err != nil {
+					atomic.AddInt64(&errors, 1)
+					firstErr.Store(err)
+					continue
+				}
+
+				if read {
+					getLatency.Since(begin)
+				} else {
+					setLatency.Since(begin)
+				}
+			}
+		}(time.Now().UnixNano() + int64(i))
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	fmt.Printf("%d requests in %s, %.0f requests/s, %d errors, %d misses\n",
+		*requests, elapsed.Round(time.Millisecond), float64(*requests)/elapsed.Seconds(), errors, misses)
+	for _, op := range []struct {
+		name  string
+		stats caches.LatencyStats
+	}{{"get", getLatency.Stats()}, {"set", setLatency.Stats()}} {
+		fmt.Printf("%-4s count=%d p50=%s p95=%s p99=%s\n", op.name, op.stats.Count, op.stats.P50, op.stats.P95, op.stats.P99)
+	}
+
+	if err, ok := firstErr.Load().(error); ok {
+		return fmt.Errorf("%d requests failed, first error: %w", errors, err)
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package caches
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+)
+
+// defaultSketchSize 是没有限制 MaxEntries 时 TinyLFU 估计访问频率的计数器个数
+const defaultSketchSize = 65536
+
+// AdmissionPolicy 决定缓存已满时是否接受新的 key，拒绝的写入会被直接丢弃，不会为了它淘汰已有的 key
+// 这样大量只写一次的 key 涌入时不会把经常访问的 key 挤出去，缓存会并发地调用这些方法，实现需要考虑并发
+type AdmissionPolicy interface {
+	// Record 记录 key 被读取或者写入了，没有命中的读取也会记录
+	Record(key string)
+
+	// Admit 返回是否接受新的 key，victim 是接受之后下一个会被淘汰的 key
+	Admit(key string, victim string) bool
+}
+
+// AdmissionPolicyByName 返回名为 name 的准入策略，可选值为 tinylfu 和 probabilistic，为空时返回 nil 表示接受所有写入
+// size 是 TinyLFU 估计访问频率的 key 的个数，一般是 MaxEntries，probability 是 probabilistic 接受新的 key 的概率
+func AdmissionPolicyByName(name string, size int64, probability float64) (AdmissionPolicy, error) {
+	switch name {
+	case "":
+		return nil, nil
+	case "tinylfu":
+		return NewTinyLFU(size), nil
+	case "probabilistic":
+		return NewProbabilisticAdmission(probability), nil
+	}
+	return nil, fmt.Errorf("caches: unknown admission policy %q", name)
+}
+
+// admit 返回是否接受写入 key 和 e，只有缓存已满并且 key 不存在时才会询问准入策略，拒绝时记录次数
+// PriorityHigh 的 key 总是被接受，更新已经存在的 key 不会淘汰其他 key，也总是被接受
+func (c *Cache) admit(key string, e *entry) bool {
+	admission := c.options.Admission
+	if admission == nil {
+		return true
+	}
+
+	admission.Record(key)
+	if c.eviction == nil || e.priority >= PriorityHigh || !c.eviction.full(c, int64(len(key)+e.size())) {
+		return true
+	}
+
+	unlock := c.rlockKey(key)
+	_, exists := c.lookup(key)
+	unlock()
+	if exists {
+		return true
+	}
+
+	victim, ok := c.eviction.victim()
+	if !ok || admission.Admit(key, victim) {
+		return true
+	}
+
+	atomic.AddInt64(&c.counters.rejected, 1)
+	return false
+}
+
+// tinyLFU 用 Count-Min Sketch 估计 key 最近的访问频率，只接受比被淘汰的 key 访问得更频繁的 key
+type tinyLFU struct {
+	// rows 是 sketch 的计数器，每个 key 在每一行中对应一个计数器，估计值是其中最小的一个，计数器最大为 15
+	rows [4][]uint8
+	mask uint64
+
+	// additions 是上次衰减之后记录的次数，达到 resetAt 时所有计数器减半，让估计值反映最近的访问频率
+	additions int
+	resetAt   int
+
+	lock sync.Mutex
+}
+
+// NewTinyLFU 返回估计 size 个 key 访问频率的 TinyLFU 准入策略，size 不大于 0 时使用 65536
+func NewTinyLFU(size int64) AdmissionPolicy {
+	if size <= 0 {
+		size = defaultSketchSize
+	}
+
+	width := uint64(16)
+	for width < uint64(size) {
+		width <<= 1
+	}
+
+	t := &tinyLFU{mask: width - 1, resetAt: int(size) * 10}
+	for i := range t.rows {
+		t.rows[i] = make([]uint8, width)
+	}
+	return t
+}
+
+// indexes 返回 key 在每一行中的计数器的下标
+func (t *tinyLFU) indexes(key string) [4]uint64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(key))
+	sum := hash.Sum64()
+
+	// 用两个哈希值组合出每一行的哈希值
+	low, high := sum&0xffffffff, sum>>32
+	var indexes [4]uint64
+	for i := range indexes {
+		indexes[i] = (low + uint64(i)*high) & t.mask
+	}
+	return indexes
+}
+
+func (t *tinyLFU) Record(key string) {
+	indexes := t.indexes(key)
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for i, index := range indexes {
+		if t.rows[i][index] < 15 {
+			t.rows[i][index]++
+		}
+	}
+
+	t.additions++
+	if t.additions >= t.resetAt {
+		for _, row := range t.rows {
+			for i := range row {
+				row[i] >>= 1
+			}
+		}
+		t.additions /= 2
+	}
+}
+
+func (t *tinyLFU) Admit(key string, victim string) bool {
+	keyIndexes, victimIndexes := t.indexes(key), t.indexes(victim)
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.estimate(keyIndexes) > t.estimate(victimIndexes)
+}
+
+// estimate 返回 indexes 对应的 key 的访问频率的估计值，调用者需要持有 t.lock
+func (t *tinyLFU) estimate(indexes [4]uint64) uint8 {
+	min := uint8(15)
+	for i, index := range indexes {
+		if count := t.rows[i][index]; count < min {
+			min = count
+		}
+	}
+	return min
+}
+
+// probabilisticAdmission 以固定的概率接受新的 key，不需要记录访问频率
+type probabilisticAdmission struct {
+	probability float64
+
+	// random 是指定了种子时使用的随机数，由 lock 保护，为 nil 时使用全局的随机数
+	random *rand.Rand
+	lock   sync.Mutex
+}
+
+// NewProbabilisticAdmission 返回以 probability 的概率接受新的 key 的准入策略，probability 的范围是 0 到 1
+// 只被写入一次的 key 大多会被拒绝，反复写入的 key 最终会被接受
+func NewProbabilisticAdmission(probability float64) AdmissionPolicy {
+	return &probabilisticAdmission{probability: probability}
+}
+
+// NewSeededProbabilisticAdmission 和 NewProbabilisticAdmission 一样，但是使用 seed 生成的随机数，用于确定性模式
+func NewSeededProbabilisticAdmission(probability float64, seed int64) AdmissionPolicy {
+	return &probabilisticAdmission{probability: probability, random: rand.New(rand.NewSource(seed))}
+}
+
+func (p *probabilisticAdmission) Record(key string) {}
+
+func (p *probabilisticAdmission) Admit(key string, victim string) bool {
+	if p.random == nil {
+		return rand.Float64() < p.probability
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.random.Float64() < p.probability
+}
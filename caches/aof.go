@@ -0,0 +1,441 @@
+package caches
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"gocache/utils"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// aofMagic 是 AOF 文件开头的标识
+	aofMagic = "GOAOF"
+
+	// aofVersion 是当前写入的 AOF 格式版本
+	aofVersion byte = 1
+
+	// aofHeaderSize 是 AOF 文件头的字节数：标识 + 版本 + 标记
+	aofHeaderSize = len(aofMagic) + 2
+
+	// aofMaxRecordSize 是单条记录允许的最大字节数，超过这个值说明长度字段已经损坏
+	aofMaxRecordSize = 1 << 30
+)
+
+const (
+	// OpSet 表示保存数据的操作
+	OpSet byte = iota + 1
+
+	// OpDelete 表示删除数据的操作
+	OpDelete
+
+	// OpClear 表示清空所有数据的操作，重写后的 AOF 以它开头
+	OpClear
+)
+
+// AOFSync 是 AOF 调用 fsync 将数据真正写入磁盘的策略
+type AOFSync int
+
+const (
+	// AOFSyncEverySec 表示每秒写入文件并 fsync 一次，崩溃时最多丢失一秒内的修改
+	AOFSyncEverySec AOFSync = iota
+
+	// AOFSyncAlways 表示每次追加之后立即写入文件并 fsync，最安全也最慢
+	AOFSyncAlways
+
+	// AOFSyncNo 表示每秒写入文件，但是不调用 fsync，由操作系统决定什么时候写入磁盘
+	AOFSyncNo
+)
+
+// ParseAOFSync 解析 fsync 策略，可选值为 always、everysec 和 no
+func ParseAOFSync(s string) (AOFSync, error) {
+	switch s {
+	case "always":
+		return AOFSyncAlways, nil
+	case "everysec":
+		return AOFSyncEverySec, nil
+	case "no":
+		return AOFSyncNo, nil
+	}
+	return 0, fmt.Errorf("caches: invalid aof sync policy %q", s)
+}
+
+// Op 是 AOF 中记录的一个修改操作
+type Op struct {
+	// Type 是操作的类型，OpSet 或者 OpDelete
+	Type byte
+
+	// Time 是操作的时间，单位是纳秒
+	Time int64
+
+	// Key 是操作的 key
+	Key string
+
+	// Value 和 ExpireAt 是 OpSet 操作保存的值和过期时间
+	Value    []byte
+	ExpireAt int64
+}
+
+// AOF 是只追加的操作日志，记录了所有修改缓存的操作及其时间
+// 配合持久化文件可以把缓存恢复到任意时间点的状态
+type AOF struct {
+	// path 是 AOF 文件的路径
+	path string
+
+	// file 是 AOF 文件
+	file *os.File
+
+	// writer 缓冲了还没写入文件的操作
+	writer *bufio.Writer
+
+	// limiter 限制写入文件的速度，为 nil 表示不限速
+	limiter *RateLimiter
+
+	// aead 不为 nil 时会加密每一条记录
+	aead cipher.AEAD
+
+	// policy 是 fsync 策略
+	policy AOFSync
+
+	// size 是文件的字节数，包括还在缓冲区中的记录，需要原子地读取
+	size int64
+
+	// rewriteSize 是上次重写之后文件的字节数，需要原子地读取
+	rewriteSize int64
+
+	// rewrites 是重写的次数，需要原子地读取
+	rewrites int64
+
+	// rewriting 在重写期间同时记录新追加的记录，重写结束时追加到新的文件中，不在重写时为 nil
+	rewriting *bytes.Buffer
+
+	// rewriteLock 保证同一时间只有一个重写在进行
+	rewriteLock sync.Mutex
+
+	// lock 用于保证并发安全
+	lock *sync.Mutex
+
+	// stop 用于通知后台刷盘的协程退出
+	stop chan struct{}
+
+	// wg 用于等待后台刷盘的协程退出
+	wg sync.WaitGroup
+
+	// worker 是后台刷盘的协程的存活状态，使用这个 AOF 的缓存会记录它
+	worker *Worker
+}
+
+// OpenAOF 打开 path 指定的 AOF 文件，文件不存在时会创建，新的操作会追加到文件末尾
+// provider 不为 nil 时会使用它提供的密钥加密记录，打开已有的文件时加密方式必须和文件一致
+// limiter 不为 nil 时会限制写入文件的速度，缓冲区写满时追加操作会因为限速而变慢
+// policy 是 fsync 策略，决定了崩溃时最多会丢失多少修改
+func OpenAOF(path string, provider KeyProvider, limiter *RateLimiter, policy AOFSync) (*AOF, error) {
+	aead, err := newAEAD(provider)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	flags := byte(0)
+	if aead != nil {
+		flags |= snapshotEncrypted
+	}
+
+	size := info.Size()
+	if size == 0 {
+		header := aofHeader(flags)
+		if _, err = file.Write(header); err != nil {
+			file.Close()
+			return nil, err
+		}
+		size = int64(len(header))
+	} else {
+		header := make([]byte, aofHeaderSize)
+		if _, err = file.ReadAt(header, 0); err != nil || string(header[:len(aofMagic)]) != aofMagic {
+			file.Close()
+			return nil, fmt.Errorf("caches: %s is not an aof file", path)
+		}
+
+		if header[len(aofMagic)+1] != flags {
+			file.Close()
+			return nil, fmt.Errorf("caches: encryption setting does not match aof file %s", path)
+		}
+	}
+
+	aof := &AOF{
+		path:        path,
+		file:        file,
+		writer:      bufio.NewWriter(limiter.Writer(file)),
+		limiter:     limiter,
+		aead:        aead,
+		policy:      policy,
+		size:        size,
+		rewriteSize: size,
+		lock:        &sync.Mutex{},
+		stop:        make(chan struct{}),
+		worker:      newWorker("aof", time.Second),
+	}
+
+	aof.wg.Add(1)
+	go aof.flushLoop()
+	return aof, nil
+}
+
+// aofHeader 返回使用 flags 作为标记的文件头
+func aofHeader(flags byte) []byte {
+	return append([]byte(aofMagic), aofVersion, flags)
+}
+
+// flushLoop 每秒将缓冲的操作写入文件，策略是 AOFSyncEverySec 时还会调用 fsync
+func (aof *AOF) flushLoop() {
+	defer aof.wg.Done()
+	defer aof.worker.Recover()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			aof.lock.Lock()
+			if aof.writer.Flush() == nil && aof.policy == AOFSyncEverySec {
+				aof.file.Sync()
+			}
+			aof.lock.Unlock()
+			aof.worker.Beat()
+		case <-aof.stop:
+			return
+		}
+	}
+}
+
+// encode 将操作编码成一条记录的内容，需要时会加密
+func (aof *AOF) encode(op Op) ([]byte, error) {
+	payload := encodeOp(op)
+	if aof.aead != nil {
+		return seal(aof.aead, payload)
+	}
+	return payload, nil
+}
+
+// Append 追加一个操作，策略是 AOFSyncAlways 时会立即写入文件并 fsync，否则先写入缓冲区，每秒写入一次文件
+func (aof *AOF) Append(op Op) error {
+	payload, err := aof.encode(op)
+	if err != nil {
+		return err
+	}
+
+	aof.lock.Lock()
+	defer aof.lock.Unlock()
+	if aof.rewriting != nil {
+		writeSnapshotPayload(aof.rewriting, payload)
+	}
+
+	if err = writeSnapshotPayload(aof.writer, payload); err != nil {
+		return err
+	}
+	atomic.AddInt64(&aof.size, int64(len(payload))+8)
+
+	if aof.policy == AOFSyncAlways {
+		if err = aof.writer.Flush(); err != nil {
+			return err
+		}
+		return aof.file.Sync()
+	}
+	return nil
+}
+
+// Size 返回 AOF 文件的字节数，包括还没有写入文件的记录
+func (aof *AOF) Size() int64 {
+	return atomic.LoadInt64(&aof.size)
+}
+
+// Flush 将缓冲的操作写入文件
+func (aof *AOF) Flush() error {
+	aof.lock.Lock()
+	defer aof.lock.Unlock()
+	return aof.writer.Flush()
+}
+
+// Close 将缓冲的操作写入文件并关闭文件
+func (aof *AOF) Close() error {
+	close(aof.stop)
+	aof.wg.Wait()
+	aof.worker.Stop()
+
+	aof.lock.Lock()
+	defer aof.lock.Unlock()
+	if err := aof.writer.Flush(); err != nil {
+		aof.file.Close()
+		return err
+	}
+
+	if err := aof.file.Sync(); err != nil {
+		aof.file.Close()
+		return err
+	}
+	return aof.file.Close()
+}
+
+// encodeOp 将操作编码成字节数组
+// 格式为：1 字节类型 + 8 字节时间 + 8 字节过期时间 + varint 编码的 key 长度 + key + varint 编码的 value 长度 + value
+func encodeOp(op Op) []byte {
+	data := make([]byte, 17, 17+2*binary.MaxVarintLen64+len(op.Key)+len(op.Value))
+	data[0] = op.Type
+	binary.BigEndian.PutUint64(data[1:], uint64(op.Time))
+	binary.BigEndian.PutUint64(data[9:], uint64(op.ExpireAt))
+	data = appendUvarint(data, uint64(len(op.Key)))
+	data = append(data, op.Key...)
+	data = appendUvarint(data, uint64(len(op.Value)))
+	return append(data, op.Value...)
+}
+
+// appendUvarint 追加一个 varint 编码的整数
+func appendUvarint(data []byte, x uint64) []byte {
+	var buffer [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buffer[:], x)
+	return append(data, buffer[:n]...)
+}
+
+// decodeOp 将字节数组解码成操作
+func decodeOp(data []byte) (Op, error) {
+	if len(data) < 17 {
+		return Op{}, errors.New("caches: aof record too short")
+	}
+
+	op := Op{
+		Type:     data[0],
+		Time:     int64(binary.BigEndian.Uint64(data[1:])),
+		ExpireAt: int64(binary.BigEndian.Uint64(data[9:])),
+	}
+
+	data = data[17:]
+	size, n := binary.Uvarint(data)
+	if n <= 0 || uint64(len(data)-n) < size {
+		return Op{}, errors.New("caches: aof record key truncated")
+	}
+	op.Key = string(data[n : n+int(size)])
+	data = data[n+int(size):]
+
+	size, n = binary.Uvarint(data)
+	if n <= 0 || uint64(len(data)-n) < size {
+		return Op{}, errors.New("caches: aof record value truncated")
+	}
+	op.Value = data[n : n+int(size)]
+	return op, nil
+}
+
+// ReadAOF 读取 path 指定的 AOF 文件，每个操作都会按顺序传给 fn，fn 返回 false 时停止读取
+// 文件末尾不完整的记录会被忽略，这通常是写入时程序崩溃导致的；其他位置的损坏会返回 CorruptionError
+func ReadAOF(path string, provider KeyProvider, fn func(op Op) bool) error {
+	aead, err := newAEAD(provider)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	header := make([]byte, aofHeaderSize)
+	if _, err = io.ReadFull(reader, header); err != nil || string(header[:len(aofMagic)]) != aofMagic {
+		return fmt.Errorf("caches: %s is not an aof file", path)
+	}
+
+	if header[len(aofMagic)+1]&snapshotEncrypted != 0 && aead == nil {
+		return errors.New("caches: aof is encrypted but no encryption key is configured")
+	}
+
+	if header[len(aofMagic)+1]&snapshotEncrypted == 0 {
+		aead = nil
+	}
+
+	offset := int64(aofHeaderSize)
+	for record := 0; ; record++ {
+		payload, err := readAOFRecord(reader)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+
+		if err != nil {
+			return &CorruptionError{Block: record, Offset: offset, Reason: err.Error()}
+		}
+
+		size := int64(len(payload)) + 8
+		if aead != nil {
+			if payload, err = open(aead, payload); err != nil {
+				return &CorruptionError{Block: record, Offset: offset, Reason: "decryption failed"}
+			}
+		}
+
+		op, err := decodeOp(payload)
+		if err != nil {
+			return &CorruptionError{Block: record, Offset: offset, Reason: err.Error()}
+		}
+
+		if !fn(op) {
+			return nil
+		}
+		offset += size
+	}
+}
+
+// readAOFRecord 读取一条记录并检查校验和
+func readAOFRecord(r io.Reader) ([]byte, error) {
+	var size uint32
+	if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+		return nil, err
+	}
+
+	if size > aofMaxRecordSize {
+		return nil, fmt.Errorf("invalid record length %d", size)
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	var checksum uint32
+	if err := binary.Read(r, binary.BigEndian, &checksum); err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	if checksum != crc32.ChecksumIEEE(payload) {
+		return nil, errors.New("checksum mismatch")
+	}
+	return payload, nil
+}
+
+// applyOp 将操作应用到 data 上
+func applyOp(data map[string]*entry, op Op) {
+	switch op.Type {
+	case OpSet:
+		data[op.Key] = markLarge(&entry{value: utils.Copy(op.Value), expireAt: op.ExpireAt})
+	case OpDelete:
+		delete(data, op.Key)
+	case OpClear:
+		for key := range data {
+			delete(data, key)
+		}
+	}
+}
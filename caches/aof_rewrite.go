@@ -0,0 +1,186 @@
+package caches
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// ErrNoAOF 表示缓存没有开启 AOF
+var ErrNoAOF = errors.New("caches: aof is not enabled")
+
+// RewriteAOF 使用缓存当前的数据重写 AOF，重写后的文件只有一个清空操作和每个没有过期的 key 的 OpSet，之后的修改继续追加在后面
+// 收集数据时会短暂地持有写锁，写入新文件期间的修改会同时记录下来，替换文件之前追加到新文件中，所以不会丢失
+// 重写之后 AOF 中没有重写之前的操作了，不能再恢复到重写之前的时间点
+func (c *Cache) RewriteAOF() error {
+	aof := c.options.AOF
+	if aof == nil {
+		return ErrNoAOF
+	}
+
+	aof.rewriteLock.Lock()
+	defer aof.rewriteLock.Unlock()
+
+	c.lock.Lock()
+	now := c.now().UnixNano()
+	keys := make([]string, 0, atomic.LoadInt64(&c.count))
+	items := make([]*entry, 0, atomic.LoadInt64(&c.count))
+	c.forEach(func(key string, e *entry) bool {
+		if e.alive(now) {
+			keys = append(keys, key)
+			items = append(items, e)
+		}
+		return true
+	})
+
+	// 从这里开始的修改都在收集的数据之后，需要追加到新文件中
+	aof.lock.Lock()
+	aof.rewriting = new(bytes.Buffer)
+	aof.lock.Unlock()
+	c.lock.Unlock()
+
+	err := aof.rewrite(now, keys, items)
+	if err != nil {
+		aof.lock.Lock()
+		aof.rewriting = nil
+		aof.lock.Unlock()
+	}
+	return err
+}
+
+// rewrite 将 now 时的数据写入新的文件，追加重写期间记录的操作之后替换掉原来的文件
+func (aof *AOF) rewrite(now int64, keys []string, items []*entry) error {
+	temp := aof.path + ".rewrite"
+	file, err := os.OpenFile(temp, os.O_CREATE|os.O_TRUNC|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	replaced := false
+	defer func() {
+		if !replaced {
+			file.Close()
+			os.Remove(temp)
+		}
+	}()
+
+	flags := byte(0)
+	if aof.aead != nil {
+		flags |= snapshotEncrypted
+	}
+
+	writer := bufio.NewWriter(aof.limiter.Writer(file))
+	writer.Write(aofHeader(flags))
+	size := int64(aofHeaderSize)
+	write := func(op Op) error {
+		payload, err := aof.encode(op)
+		if err != nil {
+			return err
+		}
+		size += int64(len(payload)) + 8
+		return writeSnapshotPayload(writer, payload)
+	}
+
+	if err = write(Op{Type: OpClear, Time: now}); err != nil {
+		return err
+	}
+
+	for i, key := range keys {
+		item, ok := entryOf(key, items[i])
+		if !ok {
+			continue
+		}
+
+		if err = write(Op{Type: OpSet, Time: now, Key: key, Value: item.Value, ExpireAt: item.ExpireAt}); err != nil {
+			return err
+		}
+	}
+
+	// 先在不持有锁的时候写完大部分数据，再持有锁追加重写期间的操作并替换文件
+	if err = writer.Flush(); err != nil {
+		return err
+	}
+
+	aof.lock.Lock()
+	defer aof.lock.Unlock()
+	size += int64(aof.rewriting.Len())
+	if _, err = aof.rewriting.WriteTo(file); err != nil {
+		return err
+	}
+
+	if err = file.Sync(); err != nil {
+		return err
+	}
+
+	// Windows 上不能替换打开着的文件，先关闭旧的文件，替换之后再重新打开
+	if err = aof.writer.Flush(); err != nil {
+		return err
+	}
+
+	if err = file.Close(); err != nil {
+		return err
+	}
+	replaced = true
+
+	aof.file.Close()
+	if err = os.Rename(temp, aof.path); err != nil {
+		// 替换失败时继续使用旧的文件，重写期间的操作已经写入旧的文件了
+		os.Remove(temp)
+		return aof.reopen(atomic.LoadInt64(&aof.size))
+	}
+
+	atomic.StoreInt64(&aof.rewriteSize, size)
+	atomic.AddInt64(&aof.rewrites, 1)
+	return aof.reopen(size)
+}
+
+// reopen 重新打开 AOF 文件用于追加，size 是文件当前的字节数，调用者需要持有锁
+func (aof *AOF) reopen(size int64) error {
+	aof.rewriting = nil
+	file, err := os.OpenFile(aof.path, os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	aof.file = file
+	aof.writer = bufio.NewWriter(aof.limiter.Writer(file))
+	atomic.StoreInt64(&aof.size, size)
+	return nil
+}
+
+// AutoRewriteAOF 开启一个后台协程，每秒检查一次 AOF 的大小，超过 minSize 并且是上次重写之后的两倍时重写 AOF
+// onError 不为 nil 时会在重写失败时调用，调用返回的函数可以停止检查，没有开启 AOF 或者在确定性模式下什么都不做
+func (c *Cache) AutoRewriteAOF(minSize int64, onError func(err error)) (stop func()) {
+	aof := c.options.AOF
+	if aof == nil || minSize <= 0 || c.options.Deterministic {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				size := aof.Size()
+				if size < minSize || size < 2*atomic.LoadInt64(&aof.rewriteSize) {
+					continue
+				}
+
+				if err := c.RewriteAOF(); err != nil && onError != nil {
+					onError(err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+	}
+}
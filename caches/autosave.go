@@ -0,0 +1,198 @@
+package caches
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SaveRule 是自动保存的规则
+// 表示距离上次保存已经过去 Seconds 秒，并且至少发生了 Changes 次修改时，就触发一次保存
+type SaveRule struct {
+	Seconds int64
+	Changes int64
+}
+
+// String 返回规则的字符串形式，比如 "60 1000"
+func (sr SaveRule) String() string {
+	return fmt.Sprintf("%d %d", sr.Seconds, sr.Changes)
+}
+
+// ParseSaveRules 解析保存规则，格式和 Redis 的 save 配置一样，两个数字一组
+// 比如 "900 1 300 10 60 10000" 表示 900 秒内至少 1 次修改、300 秒内至少 10 次修改或 60 秒内至少 10000 次修改
+func ParseSaveRules(s string) ([]SaveRule, error) {
+	fields := strings.Fields(s)
+	if len(fields)%2 != 0 {
+		return nil, fmt.Errorf("caches: invalid save rules %q", s)
+	}
+
+	rules := make([]SaveRule, 0, len(fields)/2)
+	for i := 0; i < len(fields); i += 2 {
+		seconds, err := strconv.ParseInt(fields[i], 10, 64)
+		if err != nil || seconds <= 0 {
+			return nil, fmt.Errorf("caches: invalid save seconds %q", fields[i])
+		}
+
+		changes, err := strconv.ParseInt(fields[i+1], 10, 64)
+		if err != nil || changes <= 0 {
+			return nil, fmt.Errorf("caches: invalid save changes %q", fields[i+1])
+		}
+		rules = append(rules, SaveRule{Seconds: seconds, Changes: changes})
+	}
+	return rules, nil
+}
+
+// AutoSaver 会根据保存规则在后台自动持久化缓存
+type AutoSaver struct {
+	// cache 是需要持久化的缓存
+	cache *Cache
+
+	// save 执行一次持久化
+	save func() error
+
+	// rules 是保存规则，满足任意一条就会触发保存
+	rules []SaveRule
+
+	// saving 标记是否有后台保存正在进行，避免同时进行多次保存
+	saving int32
+
+	// lastErr 是上次保存的错误，上次保存成功时为 nil
+	lastErr error
+
+	// lock 用于保护 lastErr
+	lock sync.Mutex
+
+	// stop 用于通知后台协程退出
+	stop chan struct{}
+
+	// wg 用于等待后台协程和正在进行的保存结束
+	wg sync.WaitGroup
+
+	// worker 是检查保存规则的后台协程的存活状态，调用 Start 之前为 nil
+	worker *Worker
+
+	// OnError 在自动保存失败时被调用，为 nil 时忽略错误
+	OnError func(err error)
+
+	// Interval 不为 0 时，距离上次保存超过 Interval 并且有修改就会触发保存，和保存规则同时生效
+	// 需要在调用 Start 之前设置
+	Interval time.Duration
+}
+
+// NewAutoSaver 返回一个将缓存持久化到 path 文件的自动保存器，需要调用 Start 才会开始工作
+func NewAutoSaver(cache *Cache, path string, rules []SaveRule) *AutoSaver {
+	return &AutoSaver{
+		cache: cache,
+		save: func() error {
+			return cache.SaveToFile(path)
+		},
+		rules: rules,
+		stop:  make(chan struct{}),
+	}
+}
+
+// NewIncrementalAutoSaver 返回一个将缓存增量持久化到 dir 目录的自动保存器，需要调用 Start 才会开始工作
+// 增量持久化文件超过 maxIncrementals 个时会进行一次全量持久化
+func NewIncrementalAutoSaver(cache *Cache, dir string, maxIncrementals int, rules []SaveRule) *AutoSaver {
+	return &AutoSaver{
+		cache: cache,
+		save: func() error {
+			return cache.SaveToDir(dir, maxIncrementals)
+		},
+		rules: rules,
+		stop:  make(chan struct{}),
+	}
+}
+
+// Save 立即执行一次持久化，并等待持久化结束
+func (as *AutoSaver) Save() error {
+	err := as.save()
+	as.lock.Lock()
+	as.lastErr = err
+	as.lock.Unlock()
+	return err
+}
+
+// Saving 返回是否有后台保存正在进行
+func (as *AutoSaver) Saving() bool {
+	return atomic.LoadInt32(&as.saving) == 1
+}
+
+// LastError 返回上次保存的错误，上次保存成功或者还没有保存过时返回 nil
+func (as *AutoSaver) LastError() error {
+	as.lock.Lock()
+	defer as.lock.Unlock()
+	return as.lastErr
+}
+
+// Start 开启后台协程，每秒检查一次是否满足保存规则，缓存在确定性模式下时什么都不做
+func (as *AutoSaver) Start() {
+	if as.cache.options.Deterministic {
+		return
+	}
+
+	as.worker = as.cache.RegisterWorker("autosave", time.Second)
+	as.wg.Add(1)
+	go func() {
+		defer as.wg.Done()
+		defer as.worker.Recover()
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if as.shouldSave() {
+					as.BackgroundSave()
+				}
+				as.worker.Beat()
+			case <-as.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止自动保存，并等待正在进行的保存结束
+func (as *AutoSaver) Stop() {
+	close(as.stop)
+	as.wg.Wait()
+	if as.worker != nil {
+		as.worker.Stop()
+	}
+}
+
+// shouldSave 判断当前是否满足任意一条保存规则
+func (as *AutoSaver) shouldSave() bool {
+	dirty := as.cache.Dirty()
+	elapsed := time.Since(as.cache.LastSave())
+	if as.Interval > 0 && dirty > 0 && elapsed >= as.Interval {
+		return true
+	}
+
+	for _, rule := range as.rules {
+		if dirty >= rule.Changes && elapsed >= time.Duration(rule.Seconds)*time.Second {
+			return true
+		}
+	}
+	return false
+}
+
+// BackgroundSave 在后台协程中保存缓存，如果已经有后台保存在进行就直接返回 false
+func (as *AutoSaver) BackgroundSave() bool {
+	if !atomic.CompareAndSwapInt32(&as.saving, 0, 1) {
+		return false
+	}
+
+	as.wg.Add(1)
+	go func() {
+		defer as.wg.Done()
+		defer atomic.StoreInt32(&as.saving, 0)
+		if err := as.Save(); err != nil && as.OnError != nil {
+			as.OnError(err)
+		}
+	}()
+	return true
+}
@@ -0,0 +1,84 @@
+package caches
+
+import (
+	"gocache/utils"
+	"time"
+)
+
+// MGet 返回 keys 中每个 key 的 value，找不到或者已经过期的 key 不在返回的 map 中
+// 每个 key 分别读取，和逐个调用 Get 一样记录命中率，不保证读到的是同一时刻的数据
+func (c *Cache) MGet(keys []string) map[string][]byte {
+	values := make(map[string][]byte, len(keys))
+	for _, key := range keys {
+		if value, ok := c.Get(key); ok {
+			values[key] = value
+		}
+	}
+	return values
+}
+
+// MSet 保存 values 中所有的 key 和 value，ttl 之后过期，ttl 为 NeverExpire 表示永不过期
+// 所有的 key 都在一次加锁中写入，其他人不会看到只写入了一部分的数据
+func (c *Cache) MSet(values map[string][]byte, ttl time.Duration) {
+	c.mset(values, ttl, false)
+}
+
+// MSetWithQuota 和 MSet 一样保存 values，但是写入之后会超出 key 所在命名空间的配额时返回 *QuotaError
+// 开启了 RejectWhenFull 时缓存已满返回 ErrCacheFull，出错时停止写入，之前已经写入的 key 不会撤销
+// 有内部 key 时返回 ErrInternalKey，有 value 不能保存时返回 ErrReservedValue，这时不会写入任何 key
+func (c *Cache) MSetWithQuota(values map[string][]byte, ttl time.Duration) error {
+	return c.mset(values, ttl, true)
+}
+
+// mset 在写锁下逐个保存 values 中的 key，checkQuota 为 true 时检查命名空间的配额
+func (c *Cache) mset(values map[string][]byte, ttl time.Duration, checkQuota bool) error {
+	defer c.counters.setLatency.Since(time.Now())
+
+	// 准入策略需要读取缓存，在加写锁之前先过滤掉被拒绝的 key
+	entries := make(map[string]*entry, len(values))
+	for key, value := range values {
+		if err := CheckKey(key); err != nil {
+			return err
+		}
+
+		e := c.newEntry(utils.Copy(value), ttl)
+		if err := checkValue(e); err != nil {
+			return err
+		}
+
+		c.compress(e)
+		if c.admit(key, e) {
+			entries[key] = e
+		}
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for key, e := range entries {
+		if err := c.checkFull(key, e); err != nil {
+			return err
+		}
+
+		if err := c.putLocked(key, e, checkQuota); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MDelete 删除 keys 中所有的 key，返回删除了的没有过期的 key 的个数，所有的 key 都在一次加锁中删除
+func (c *Cache) MDelete(keys []string) int {
+	defer c.counters.deleteLatency.Since(time.Now())
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := c.now().UnixNano()
+	deleted := 0
+	for _, key := range keys {
+		if e, ok := c.lookup(key); ok && e.alive(now) {
+			deleted++
+		}
+		c.deleteLocked(key)
+	}
+	return deleted
+}
@@ -2,75 +2,640 @@
 package caches
 
 import (
+	"bytes"
 	"gocache/utils"
+	"math/rand"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// defaultSegments 是默认的数据分片数
+const defaultSegments = 256
+
+// segment 是数据的一个分片，key 按照哈希值分到不同的分片中
+type segment struct {
+	// data 存储了分片中所有的数据
+	// value 类型使用*entry，entry 中的值使用[]byte，以便网络传输
+	data map[string]*entry
+
+	// overlay 在持久化期间记录新的修改，此时 data 被冻结，可以不加锁地进行序列化
+	// 值为 nil 表示该 key 在持久化期间被删除了
+	// 不在持久化时 overlay 为 nil
+	overlay map[string]*entry
+
+	// shared 表示 data 和 overlay 被快照引用着，修改之前需要先复制一份，见 unshare
+	shared bool
+
+	// lock 保护 data、overlay 和 shared，只在读写单个 key 时持有，不会同时持有多个分片的锁
+	lock sync.RWMutex
+}
+
 // Cache 是一个结构体，用于封装缓存底层结构
 type Cache struct {
-	// data 是一个map，存储了所有的数据
-	// value 类型使用[]byte，以便网络传输
-	data map[string][]byte
+	// segments 是数据的分片，分片数是 2 的幂
+	segments []*segment
 
-	// count 记录data中键值对的个数
-	// 这是一个冗余设计，直接使用len(data)就行
+	// count 记录所有分片中键值对的个数，需要原子地读写
+	// 这是一个冗余设计，直接累加每个分片的 len(data) 就行
 	// 使用count记录是为了更快得到结果
 	count int64
 
+	// internal 是其中内部 key 的个数，需要原子地读写，见 IsInternalKey
+	internal int64
+
+	// bytes 是所有 key 和 value 占用的总字节数，需要原子地读写
+	bytes int64
+
 	// lock 用于保证并发安全
+	// 读写单个 key 时只持有读锁，再持有 key 所在分片的锁，这样不同分片上的读写可以并行
+	// 涉及多个 key 或者整体替换数据时持有写锁，这时不需要再获取分片的锁
 	lock *sync.RWMutex
+
+	// dirty 记录自上次持久化以来数据被修改的次数，需要原子地读写
+	// 自动保存会根据这个值判断是否需要触发持久化
+	dirty int64
+
+	// lastSave 记录上次成功持久化的时间
+	lastSave time.Time
+
+	// changed 记录自上次增量持久化以来被修改过的 key
+	// 为 nil 表示还没有进行过全量持久化，不需要记录
+	changed map[string]struct{}
+
+	// changedLock 在只持有读锁写入时保护 changed 中的内容，替换 changed 需要持有写锁
+	changedLock sync.Mutex
+
+	// saveLock 保证同一时间只有一个持久化在进行
+	saveLock *sync.Mutex
+
+	// options 是创建缓存时的选项
+	options Options
+
+	// counters 是缓存的统计计数器
+	counters counters
+
+	// prefixes 按照 key 的前缀分组统计使用情况，为 nil 表示不分组统计
+	prefixes *prefixGroups
+
+	// namespaces 记录每个命名空间的用量，为 nil 表示没有命名空间
+	namespaces *namespaces
+
+	// eviction 在超出 MaxEntries 或者 MaxBytes 时淘汰 key，为 nil 表示不限制
+	eviction *evictor
+
+	// view 是无锁读取使用的只读视图，为 nil 表示没有开启无锁读取
+	view *readView
+
+	// fence 是上一次发出的锁的 fencing token，使用原子操作修改
+	fence uint64
+
+	// usageSince 是当前计费周期开始的时间，单位是纳秒
+	usageSince int64
+
+	// version 是上一次写入分配的版本号，从启动时间开始递增，这样重启之后也不会分配到重启之前用过的版本号
+	version uint64
+
+	// subscribers 是订阅了修改操作的副本
+	subscribers subscribers
+
+	// largeWrites 是正在写入的大对象的分片的版本，key 是 largeWrite，清理孤立的分片时跳过它们
+	largeWrites sync.Map
+
+	// events 是键空间事件的订阅者和淘汰、过期清理的回调
+	events events
+
+	// keyLocks 是 WithKeyLock 使用的锁
+	keyLocks keyLocks
+
+	// workers 是缓存的后台协程，用于发现卡住或者崩溃的协程
+	workers workers
+
+	// random 是确定性模式下使用的随机数，由 randomLock 保护，不是确定性模式时为 nil
+	random     *rand.Rand
+	randomLock sync.Mutex
 }
 
-// NewCache 返回一个缓存对象
+// NewCache 返回一个使用默认选项的缓存对象
 func NewCache() *Cache {
-	return &Cache{
-		// 预先分配256个槽位，避免后续因容量不足导致map扩容
-		// 扩容会分配内存，影响性能；而且槽位少了，哈希冲突几率就大，map查找性能下降
-		// 256 并非最佳值，需根据实际情况而定
-		data:  make(map[string][]byte, 256),
-		count: 0,
-		lock:  &sync.RWMutex{},
+	return NewCacheWithOptions(DefaultOptions())
+}
+
+// NewCacheWithOptions 返回一个使用 options 作为选项的缓存对象
+func NewCacheWithOptions(options Options) *Cache {
+	if options.Codec == nil {
+		options.Codec = GobCodec{}
+	}
+
+	if options.Deterministic {
+		// 确定性模式下不能有后台协程，无锁读取需要在后台发布修改
+		options.LockFreeReads = false
+		if options.Clock == nil {
+			options.Clock = NewManualClock(deterministicEpoch)
+		}
+	}
+
+	if options.Clock == nil {
+		options.Clock = SystemClock()
+	}
+
+	if options.Segments <= 0 {
+		options.Segments = defaultSegments
+	}
+	options.Segments = roundShards(options.Segments)
+
+	c := &Cache{
+		segments:   newSegments(options.Segments),
+		count:      0,
+		lock:       &sync.RWMutex{},
+		lastSave:   time.Now(),
+		saveLock:   &sync.Mutex{},
+		options:    options,
+		prefixes:   newPrefixGroups(options.PrefixGroups),
+		namespaces: newNamespaces(options.Namespaces),
+		eviction:   newEvictor(options.EvictionPolicy, options.MaxEntries, options.MaxBytes),
+		view:       newReadView(options.LockFreeReads, options.ReadShards, options.AutoReshard, options.PublishDelay, options.PublishBatch),
+		usageSince: time.Now().UnixNano(),
+		version:    uint64(time.Now().UnixNano()),
+	}
+
+	if options.AOF != nil {
+		c.workers.add(options.AOF.worker)
+	}
+
+	if options.Deterministic {
+		// 版本号和计费周期不依赖启动的时间
+		c.version = 0
+		c.lastSave = options.Clock.Now()
+		c.usageSince = c.lastSave.UnixNano()
+		c.random = rand.New(rand.NewSource(options.Seed))
 	}
+	return c
 }
 
-// Set 保存 key 和 value 到缓存中
+// newSegments 返回 n 个空的分片
+func newSegments(n int) []*segment {
+	segments := make([]*segment, n)
+	for i := range segments {
+		segments[i] = &segment{data: make(map[string]*entry)}
+	}
+	return segments
+}
+
+// segmentOf 返回 key 所在的分片
+func (c *Cache) segmentOf(key string) *segment {
+	return c.segments[shardOf(key, len(c.segments))]
+}
+
+// rlockKey 获取读取 key 需要的读锁，返回释放锁的函数
+func (c *Cache) rlockKey(key string) (unlock func()) {
+	c.lock.RLock()
+	seg := c.segmentOf(key)
+	seg.lock.RLock()
+	return func() {
+		seg.lock.RUnlock()
+		c.lock.RUnlock()
+	}
+}
+
+// replaceData 使用 data 替换掉所有分片中的数据，调用者需要持有写锁
+func (c *Cache) replaceData(data map[string]*entry) {
+	segments := newSegments(len(c.segments))
+	var bytes, internal int64
+	for key, e := range data {
+		if IsInternalKey(key) {
+			internal++
+		}
+
+		c.compress(e)
+		if c.options.Checksums {
+			e.checksum = checksumOf(e)
+		}
+
+		segments[shardOf(key, len(segments))].data[key] = e
+		bytes += int64(len(key) + e.size())
+	}
+	c.segments = segments
+	atomic.StoreInt64(&c.count, int64(len(data)))
+	atomic.StoreInt64(&c.internal, internal)
+	atomic.StoreInt64(&c.bytes, bytes)
+
+	// 订阅者收不到替换的数据，需要重新全量同步
+	c.subscribers.closeAll()
+}
+
+// Set 保存 key 和 value 到缓存中，永不过期
 func (c *Cache) Set(key string, value []byte) {
-	// Set 操作会改变数据的状态，需要保证串行执行，故使用写锁
-	c.lock.Lock()
-	defer c.lock.Unlock()
+	c.SetWithTTL(key, value, NeverExpire)
+}
+
+// SetWithTTL 保存 key 和 value 到缓存中，ttl 之后过期，ttl 为 NeverExpire 表示永不过期
+func (c *Cache) SetWithTTL(key string, value []byte, ttl time.Duration) {
+	c.set(key, c.newEntry(utils.Copy(value), ttl), false)
+}
+
+// set 和 put 一样保存 key 和 e，但是缓存已满时先询问准入策略，被拒绝时丢弃这次写入并返回 nil
+// 开启了 RejectWhenFull 时写入之后会超出限制则放弃写入并返回 ErrCacheFull
+// 用于 Set 这样保存数据的写入，复制和恢复这些需要和来源保持一致的写入使用 setEntry 或者 put
+// key 是内部 key 时返回 ErrInternalKey，value 以大对象的清单的开头开头时返回 ErrReservedValue，这时都放弃写入，见 CheckKey 和 checkValue
+func (c *Cache) set(key string, e *entry, checkQuota bool) error {
+	if err := CheckKey(key); err != nil {
+		return err
+	}
+
+	if err := checkValue(e); err != nil {
+		return err
+	}
+
+	c.compress(e)
+	if !c.admit(key, e) {
+		return nil
+	}
+
+	if err := c.reserve(key, e); err != nil {
+		return err
+	}
+	return c.put(key, e, checkQuota)
+}
+
+// lockKeys 获取修改 keys 需要的锁，返回释放锁的函数，释放锁之后会淘汰超出限制的 key
+// exclusive 为 true 或者开启了只读视图时使用写锁，比如检查配额和写入需要原子地进行
+// 否则和 put 一样持有读锁和 keys 所在分片的锁，不同分片上的读取、修改并写回可以并行，多个分片按照下标从小到大加锁，避免死锁
+// 持有锁时使用 putKey 和 deleteLocked 修改 keys，不能访问其他分片中的 key
+func (c *Cache) lockKeys(exclusive bool, keys ...string) (unlock func()) {
+	if exclusive || c.view != nil {
+		c.lock.Lock()
+		return func() {
+			c.eviction.evict(c)
+			c.lock.Unlock()
+		}
+	}
+
+	c.lock.RLock()
+	indexes := make([]int, 0, len(keys))
+	for _, key := range keys {
+		indexes = append(indexes, shardOf(key, len(c.segments)))
+	}
+	sort.Ints(indexes)
+
+	locked := indexes[:0]
+	for _, i := range indexes {
+		if len(locked) == 0 || locked[len(locked)-1] != i {
+			c.segments[i].lock.Lock()
+			locked = append(locked, i)
+		}
+	}
+
+	return func() {
+		for j := len(locked) - 1; j >= 0; j-- {
+			c.segments[locked[j]].lock.Unlock()
+		}
+
+		// 淘汰的 key 可能在其他分片中，需要先释放分片的锁
+		c.eviction.evict(c)
+		c.lock.RUnlock()
+	}
+}
+
+// setEntry 保存 key 和 e 到缓存中
+func (c *Cache) setEntry(key string, e *entry) {
+	c.compress(e)
+	c.put(key, e, false)
+}
+
+// put 保存 key 和 e 到缓存中，checkQuota 为 true 时超出命名空间的配额会返回 *QuotaError 并放弃写入
+func (c *Cache) put(key string, e *entry, checkQuota bool) error {
+	defer c.counters.setLatency.Since(time.Now())
+	if checkQuota || c.view != nil {
+		// 检查配额和写入需要原子地进行，只读视图记录修改也需要串行执行，这时使用写锁
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		return c.putLocked(key, e, checkQuota)
+	}
+
+	// 只修改 key 所在的分片，持有读锁和分片的锁就可以了，不同分片上的写入可以并行
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	seg := c.segmentOf(key)
+	seg.lock.Lock()
+	c.putKey(key, e, false)
+	seg.lock.Unlock()
+
+	// 淘汰的 key 可能在其他分片中，需要先释放这个分片的锁
+	c.eviction.evict(c)
+	return nil
+}
+
+// putLocked 和 put 一样保存 key 和 e，调用者需要持有写锁
+func (c *Cache) putLocked(key string, e *entry, checkQuota bool) error {
+	if err := c.putKey(key, e, checkQuota); err != nil {
+		return err
+	}
+	c.eviction.evict(c)
+	return nil
+}
+
+// putKey 保存 key 和 e，不会淘汰 key，调用者需要持有写锁，或者持有读锁和 key 所在分片的锁
+func (c *Cache) putKey(key string, e *entry, checkQuota bool) error {
 	// 查询是否已经存在该元素, 不存在则计数++
-	if _, ok := c.data[key]; !ok {
-		c.count++
+	// 已经过期但还没被清理的元素已经计数过了，不需要再++
+	old, ok := c.lookup(key)
+	if checkQuota {
+		if err := c.namespaces.check(key, old, e); err != nil {
+			return err
+		}
 	}
-	// 该 Copy 方法会将 value 拷贝一份
+
+	if !ok {
+		c.countKey(key, 1)
+	}
+	e.version = atomic.AddUint64(&c.version, 1)
+	e.accessedAt = c.now().UnixNano()
+	// 调用者需要将 value 拷贝一份
 	// 这样即使传进来的 value 被修改或者清空了也不会影响缓存里面的数据
-	c.data[key] = utils.Copy(value)
+	c.store(key, e)
+	c.account(key, old, e)
+	c.namespaces.account(key, old, e)
+	c.eviction.account(key, old, e)
+	c.touch(key)
+	c.notify(EventSet, key, nil)
+	c.recordWrite(key, e)
+	atomic.AddInt64(&c.counters.sets, 1)
+	return nil
 }
 
-// Get 返回指定的 key 的 value， 如果找不到则返回 false
+// Get 返回指定的 key 的 value， 如果找不到或者已经过期则返回 false
 func (c *Cache) Get(key string) ([]byte, bool) {
-	// 查询数据不会改变数据的状态，故可并发执行。
-	// 使用读锁，加快读取速度
-	c.lock.RLock()
-	defer c.lock.RUnlock()
-	value, ok := c.data[key]
+	value, _, ok := c.GetWithVersion(key)
 	return value, ok
 }
 
+// GetWithVersion 和 Get 一样返回 key 的 value，同时返回 value 的版本号，可以用于 DeleteIfVersion
+func (c *Cache) GetWithVersion(key string) ([]byte, uint64, bool) {
+	start := time.Now()
+	defer c.counters.getLatency.Since(start)
+	e, now, ok := c.get(key)
+	var value []byte
+	if ok {
+		// 解压失败说明 value 在内存中损坏了，当作没有命中，可以使用 Verify 找出并修复，大对象缺少分片时也当作没有命中
+		var err error
+		value, err = c.valueOf(key, e)
+		ok = err == nil
+	}
+
+	if !ok {
+		c.recordGet(key, nil, now, 0)
+		return nil, 0, false
+	}
+	c.recordGet(key, e, now, len(value))
+	return value, e.version, true
+}
+
+// get 返回 key 对应的没有过期的 entry 和读取的时间，不会记录命中和访问，调用者读取之后需要调用 recordGet
+func (c *Cache) get(key string) (*entry, int64, bool) {
+	if c.options.Admission != nil {
+		c.options.Admission.Record(key)
+	}
+
+	var e *entry
+	var ok bool
+	if c.view != nil {
+		// 开启了无锁读取时从只读视图中读取，不需要加锁
+		e, ok = c.view.load(key)
+	} else {
+		// 查询数据不会改变数据的状态，故可并发执行。
+		// 使用读锁，加快读取速度
+		unlock := c.rlockKey(key)
+		e, ok = c.lookup(key)
+		unlock()
+	}
+
+	now := c.now().UnixNano()
+	return e, now, ok && e.alive(now)
+}
+
+// recordGet 记录 key 在 now 时的一次读取，e 为 nil 表示没有命中，size 是读到的 value 的字节数
+func (c *Cache) recordGet(key string, e *entry, now int64, size int) {
+	if e == nil {
+		// 过期的数据在读锁下不能删除，留给 Gc 清理
+		atomic.AddInt64(&c.counters.misses, 1)
+		if c.prefixes != nil {
+			c.prefixes.record(key, false)
+		}
+		c.namespaces.record(key, false)
+		c.recordRead(key, 0)
+		return
+	}
+
+	atomic.AddInt64(&c.counters.hits, 1)
+	if c.prefixes != nil {
+		c.prefixes.record(key, true)
+	}
+	c.namespaces.record(key, true)
+	c.recordRead(key, len(key)+size)
+	c.eviction.access(key)
+	e.access(now)
+}
+
+// TTL 返回指定的 key 剩余的存活时间，永不过期时返回 NeverExpire，如果找不到或者已经过期则返回 false
+func (c *Cache) TTL(key string) (time.Duration, bool) {
+	defer c.rlockKey(key)()
+	now := c.now().UnixNano()
+	e, ok := c.lookup(key)
+	if !ok || !e.alive(now) {
+		return 0, false
+	}
+	return e.ttl(now), true
+}
+
 // Delete 删除指定 key 的键值对数据
 func (c *Cache) Delete(key string) {
-	// Delete 操作会改变数据状态，需要保证串行执行，使用写锁
-	c.lock.Lock()
-	defer c.lock.Unlock()
-	if _, ok := c.data[key]; ok {
-		c.count--
-		delete(c.data, key)
+	parts := c.largeParts(key)
+	c.deleteIf(key, nil)
+	c.deleteParts(parts)
+}
+
+// DeleteIfVersion 只在 key 没有过期并且版本号是 version 时删除 key，返回是否删除了
+// 用于删除自己读取过的 key，key 在读取之后被其他人重新写入过时不会被删除
+func (c *Cache) DeleteIfVersion(key string, version uint64) bool {
+	return c.deleteIf(key, func(e *entry) bool {
+		return e.version == version
+	})
+}
+
+// DeleteIfValue 只在 key 没有过期并且 value 和 value 相同时删除 key，返回是否删除了
+func (c *Cache) DeleteIfValue(key string, value []byte) bool {
+	return c.deleteIf(key, func(e *entry) bool {
+		current, err := e.data()
+		return err == nil && bytes.Equal(current, value)
+	})
+}
+
+// deleteIf 在 match 返回 true 时删除 key，match 为 nil 时无条件删除，返回是否删除了
+func (c *Cache) deleteIf(key string, match func(e *entry) bool) bool {
+	defer c.counters.deleteLatency.Since(time.Now())
+	if c.view != nil {
+		// 只读视图记录修改需要串行执行，使用写锁
+		c.lock.Lock()
+		defer c.lock.Unlock()
+	} else {
+		// 和 Set 一样只修改 key 所在的分片
+		c.lock.RLock()
+		defer c.lock.RUnlock()
+		seg := c.segmentOf(key)
+		seg.lock.Lock()
+		defer seg.lock.Unlock()
+	}
+
+	if match != nil {
+		e, ok := c.lookup(key)
+		if !ok || !e.alive(c.now().UnixNano()) || !match(e) {
+			return false
+		}
+	}
+
+	c.deleteLocked(key)
+	return true
+}
+
+// deleteLocked 和 Delete 一样删除 key，调用者需要持有写锁，或者持有读锁和 key 所在分片的锁
+func (c *Cache) deleteLocked(key string) {
+	if old, ok := c.lookup(key); ok {
+		c.countKey(key, -1)
+		c.remove(key)
+		c.account(key, old, nil)
+		c.namespaces.account(key, old, nil)
+		c.eviction.account(key, old, nil)
+		c.touch(key)
+		c.notify(EventDelete, key, nil)
+		c.recordDelete(key)
+		atomic.AddInt64(&c.counters.deletes, 1)
 	}
 }
 
-// Count 返回键值对数据的个数
+// Count 返回键值对数据的个数，不包括大对象的分片这样的内部 key
 func (c *Cache) Count() int64 {
-	c.lock.RLock()
-	defer c.lock.RUnlock()
-	return c.count
+	return atomic.LoadInt64(&c.count) - atomic.LoadInt64(&c.internal)
+}
+
+// Bytes 返回所有 key 和 value 占用的总字节数，不包括数据结构本身的开销，已经过期但还没有被清理的数据也计算在内
+func (c *Cache) Bytes() int64 {
+	return atomic.LoadInt64(&c.bytes)
+}
+
+// account 记录 key 从 old 修改为 new 之后占用的字节数的变化，old 为 nil 表示新增，new 为 nil 表示删除
+func (c *Cache) account(key string, old *entry, new *entry) {
+	_, bytes := usageDelta(key, old, new)
+	atomic.AddInt64(&c.bytes, bytes)
+}
+
+// lookup 查找 key 对应的 entry，持久化期间会优先查找 overlay，调用者需要持有写锁，或者持有读锁和 key 所在分片的锁
+// 返回的 entry 可能已经过期了
+func (c *Cache) lookup(key string) (*entry, bool) {
+	seg := c.segmentOf(key)
+	if seg.overlay != nil {
+		if e, ok := seg.overlay[key]; ok {
+			return e, e != nil
+		}
+	}
+	e, ok := seg.data[key]
+	return e, ok
+}
+
+// store 保存 key 和 e，持久化期间只写入 overlay，调用者需要持有写锁，或者持有读锁和 key 所在分片的锁
+func (c *Cache) store(key string, e *entry) {
+	if c.options.Checksums {
+		e.checksum = checksumOf(e)
+	}
+
+	c.view.record(c, key, e)
+	seg := c.segmentOf(key)
+	seg.unshare()
+	if seg.overlay != nil {
+		seg.overlay[key] = e
+		return
+	}
+	seg.data[key] = e
+}
+
+// remove 删除 key，持久化期间只在 overlay 中记录删除标记，调用者需要持有写锁，或者持有读锁和 key 所在分片的锁
+func (c *Cache) remove(key string) {
+	c.view.record(c, key, nil)
+	seg := c.segmentOf(key)
+	seg.unshare()
+	if seg.overlay != nil {
+		seg.overlay[key] = nil
+		return
+	}
+	delete(seg.data, key)
+}
+
+// forEach 遍历所有的 entry，包括已经过期但还没被清理的，fn 返回 false 时停止遍历，调用者需要持有锁
+// 遍历每个分片时会持有分片的读锁，这样只持有读锁时也不会和单个 key 的写入冲突，fn 中不能再获取分片的锁
+func (c *Cache) forEach(fn func(key string, e *entry) bool) {
+	if c.options.Deterministic {
+		c.forEachSorted(fn)
+		return
+	}
+
+	for _, seg := range c.segments {
+		seg.lock.RLock()
+		ok := seg.forEach(fn)
+		seg.lock.RUnlock()
+		if !ok {
+			return
+		}
+	}
+}
+
+// forEach 遍历分片中所有的 entry，fn 返回 false 时停止遍历并返回 false
+func (seg *segment) forEach(fn func(key string, e *entry) bool) bool {
+	for key, e := range seg.overlay {
+		if e != nil && !fn(key, e) {
+			return false
+		}
+	}
+
+	for key, e := range seg.data {
+		if _, ok := seg.overlay[key]; ok {
+			continue
+		}
+
+		if !fn(key, e) {
+			return false
+		}
+	}
+	return true
+}
+
+// touch 记录 key 被修改了，调用者需要持有写锁，或者持有读锁和 key 所在分片的锁
+// 开启了 AOF 时还会把 key 修改后的状态追加到 AOF 中，有订阅者时还会发送给订阅者
+func (c *Cache) touch(key string) {
+	atomic.AddInt64(&c.dirty, 1)
+	if c.changed != nil {
+		c.changedLock.Lock()
+		c.changed[key] = struct{}{}
+		c.changedLock.Unlock()
+	}
+
+	if c.options.AOF == nil && !c.subscribers.active() {
+		return
+	}
+
+	op := Op{Type: OpDelete, Time: c.now().UnixNano(), Key: key}
+	if e, ok := c.lookup(key); ok {
+		// 持久化和复制使用解压之后的 value，解压失败时当作删除
+		if value, err := e.data(); err == nil {
+			op.Type = OpSet
+			op.Value = value
+			op.ExpireAt = e.expireAt
+		}
+	}
+
+	if c.options.AOF != nil {
+		// 写入失败时 bufio.Writer 会记住错误，在 Flush 或 Close 时返回
+		c.options.AOF.Append(op)
+	}
+	c.subscribers.publish(op)
 }
@@ -0,0 +1,88 @@
+package caches
+
+import (
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// BenchmarkMixed 测量多个协程同时读写时每个操作的耗时，每 10 个操作中有 2 个写入，比较只有一个分片和默认的分片数，以及混入 Increment 的情况
+// 只有一个分片时所有的读写都竞争同一个锁，结果和 -cpu 参数有关，比如 go test -bench Mixed -cpu 1,4,8
+func BenchmarkMixed(b *testing.B) {
+	const keys = 100000
+
+	// incr 是每 10 次操作中 Increment 的次数，Increment 使用单独的一组 key，它们的 value 都是整数
+	for _, incr := range []int{0, 2} {
+		for _, segments := range []int{1, defaultSegments} {
+			b.Run("incr="+strconv.Itoa(incr)+"/segments="+strconv.Itoa(segments), func(b *testing.B) {
+				options := DefaultOptions()
+				options.Segments = segments
+				c := NewCacheWithOptions(options)
+				for i := 0; i < keys; i++ {
+					c.Set(strconv.Itoa(i), []byte("value"))
+					c.Set("counter:"+strconv.Itoa(i), []byte("0"))
+				}
+
+				var seed int64
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					random := rand.New(rand.NewSource(atomic.AddInt64(&seed, 1)))
+					value := []byte("value")
+					for pb.Next() {
+						key := strconv.Itoa(random.Intn(keys))
+						switch n := random.Intn(10); {
+						case n < incr:
+							c.Increment("counter:"+key, 1, NeverExpire)
+						case n < incr+2:
+							c.Set(key, value)
+						default:
+							c.Get(key)
+						}
+					}
+				})
+			})
+		}
+	}
+}
+
+// TestConcurrentReadModifyWrite 检查在不同分片上同时进行的读取、修改并写回不会丢失修改，发出的 fencing token 不会重复
+func TestConcurrentReadModifyWrite(t *testing.T) {
+	c := NewCache()
+	const workers, rounds = 8, 200
+
+	var wg sync.WaitGroup
+	tokens := make(chan uint64, workers*rounds)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				c.Increment("counter:"+strconv.Itoa(i%4), 1, NeverExpire)
+				token, ok := c.Lock("lock:"+strconv.Itoa(w)+":"+strconv.Itoa(i), time.Minute)
+				if !ok {
+					t.Error("Lock failed")
+				}
+				tokens <- token
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(tokens)
+
+	for i := 0; i < 4; i++ {
+		if value, _ := c.Get("counter:" + strconv.Itoa(i)); string(value) != strconv.Itoa(workers*rounds/4) {
+			t.Errorf("counter:%d = %s, want %d", i, value, workers*rounds/4)
+		}
+	}
+
+	seen := map[uint64]bool{}
+	for token := range tokens {
+		if seen[token] {
+			t.Fatalf("token %d was issued twice", token)
+		}
+		seen[token] = true
+	}
+}
@@ -0,0 +1,59 @@
+package caches
+
+import (
+	"errors"
+	"gocache/utils"
+	"time"
+)
+
+// ErrConditionFailed 表示条件写入的条件不满足，key 没有被修改
+var ErrConditionFailed = errors.New("caches: condition failed")
+
+// SetIfVersion 只在 key 没有过期并且版本号是 version 时保存 value，永不过期，返回新的版本号
+// 用于乐观并发控制：先使用 GetWithVersion 读取 value 和版本号，修改之后再写回，期间 key 被其他人修改过时写入失败并返回 false
+func (c *Cache) SetIfVersion(key string, value []byte, version uint64) (uint64, bool) {
+	newVersion, err := c.SetIfMatch(key, value, NeverExpire, func(current uint64, exists bool) bool {
+		return exists && current == version
+	})
+	return newVersion, err == nil
+}
+
+// SetIfMatch 在 match 返回 true 时保存 key 和 value，ttl 之后过期，返回新的版本号，match 返回 false 时返回 ErrConditionFailed
+// match 的参数是 key 当前的版本号和是否存在，key 不存在或者已经过期时 exists 为 false，检查和写入在 key 的锁下原子地进行
+func (c *Cache) SetIfMatch(key string, value []byte, ttl time.Duration, match func(version uint64, exists bool) bool) (uint64, error) {
+	return c.setIf(key, c.newEntry(utils.Copy(value), ttl), match, false)
+}
+
+// SetIfMatchWithQuota 和 SetIfMatch 一样进行条件写入，但是写入之后会超出 key 所在命名空间的配额时返回 *QuotaError
+func (c *Cache) SetIfMatchWithQuota(key string, value []byte, ttl time.Duration, match func(version uint64, exists bool) bool) (uint64, error) {
+	return c.setIf(key, c.newEntry(utils.Copy(value), ttl), match, true)
+}
+
+// setIf 在 match 返回 true 时保存 key 和 e，checkQuota 为 true 时检查命名空间的配额
+func (c *Cache) setIf(key string, e *entry, match func(version uint64, exists bool) bool, checkQuota bool) (uint64, error) {
+	if err := CheckKey(key); err != nil {
+		return 0, err
+	}
+
+	if err := checkValue(e); err != nil {
+		return 0, err
+	}
+
+	defer c.counters.setLatency.Since(time.Now())
+	defer c.lockKeys(checkQuota, key)()
+
+	var version uint64
+	old, exists := c.lookup(key)
+	if exists = exists && old.alive(c.now().UnixNano()); exists {
+		version = old.version
+	}
+
+	if !match(version, exists) {
+		return 0, ErrConditionFailed
+	}
+
+	if err := c.putKey(key, e, checkQuota); err != nil {
+		return 0, err
+	}
+	return e.version, nil
+}
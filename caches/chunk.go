@@ -0,0 +1,323 @@
+package caches
+
+import (
+	"bytes"
+	"errors"
+	"gocache/utils"
+	"io"
+	"time"
+)
+
+// chunk 是分块保存的 value 中的一块，value 保存之后块不会再被修改，可以不加锁地读取
+type chunk struct {
+	data []byte
+	next *chunk
+}
+
+// join 返回从 ch 开始的所有块拼接起来的数据
+func (ch *chunk) join() []byte {
+	size := 0
+	for c := ch; c != nil; c = c.next {
+		size += len(c.data)
+	}
+
+	data := make([]byte, 0, size)
+	for c := ch; c != nil; c = c.next {
+		data = append(data, c.data...)
+	}
+	return data
+}
+
+// size 返回 e 的 value 在内存中占用的字节数，压缩过的 value 是压缩之后的字节数
+func (e *entry) size() int {
+	if e.chunks == nil {
+		return len(e.value)
+	}
+
+	size := 0
+	for ch := e.chunks; ch != nil; ch = ch.next {
+		size += len(ch.data)
+	}
+	return size
+}
+
+// readChunks 从 r 中读取数据直到 EOF，每块 size 字节，返回第一块和总字节数，没有数据时返回 nil
+// 最后一块不满时拷贝一份只占用需要的内存
+func readChunks(r io.Reader, size int) (*chunk, int64, error) {
+	var head, tail *chunk
+	var total int64
+	for {
+		buf := make([]byte, size)
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			if n < size {
+				buf = utils.Copy(buf[:n])
+			}
+
+			ch := &chunk{data: buf}
+			if tail == nil {
+				head = ch
+			} else {
+				tail.next = ch
+			}
+			tail, total = ch, total+int64(n)
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return head, total, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+}
+
+// ChunkSize 返回分块保存 value 时每块的字节数，为 0 表示不分块
+func (c *Cache) ChunkSize() int {
+	return c.options.ChunkSize
+}
+
+// SetFrom 和 TrySet 一样保存 key，value 从 r 中读取直到 EOF，返回 value 的字节数，读取失败时放弃写入并返回读取的错误
+// 设置了 ChunkSize 时逐块读取，超过 ChunkSize 的 value 分块保存，不需要一块和 value 一样大的连续内存，也不会反复扩容拷贝
+// 分块保存的 value 不会压缩，Get 这样返回整个 value 的读取需要拼接所有的块，大 value 使用 GetReader 读取
+func (c *Cache) SetFrom(key string, r io.Reader, ttl time.Duration, priority Priority) (int64, error) {
+	return c.setFrom(key, r, ttl, priority, false)
+}
+
+// SetFromWithQuota 和 SetFrom 一样保存 key，超出命名空间的配额时返回 *QuotaError 并放弃写入，见 SetWithPriorityAndQuota
+func (c *Cache) SetFromWithQuota(key string, r io.Reader, ttl time.Duration, priority Priority) (int64, error) {
+	return c.setFrom(key, r, ttl, priority, true)
+}
+
+// setFrom 从 r 中读取 value 并保存 key，checkQuota 为 true 时检查命名空间的配额
+// 设置了 LargeObjectThreshold 时先读取不超过它的一部分，后面还有数据时作为大对象分成多个 key 保存，见 setLarge
+func (c *Cache) setFrom(key string, r io.Reader, ttl time.Duration, priority Priority, checkQuota bool) (int64, error) {
+	if err := CheckKey(key); err != nil {
+		return 0, err
+	}
+
+	// 块和分片都可能比 largeMagic 短，先读取 value 的开头检查，见 checkValue
+	head := make([]byte, len(largeMagic))
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return 0, err
+	}
+
+	if n == len(head) && string(head) == largeMagic {
+		return 0, ErrReservedValue
+	}
+	r = io.MultiReader(bytes.NewReader(head[:n]), r)
+
+	limit := c.options.LargeObjectThreshold
+	if limit <= 0 {
+		e, size, err := c.readEntry(r, ttl, priority)
+		if err != nil {
+			return 0, err
+		}
+		return size, c.set(key, e, checkQuota)
+	}
+
+	e, size, err := c.readEntry(io.LimitReader(r, int64(limit)), ttl, priority)
+	if err != nil {
+		return 0, err
+	}
+
+	if size == int64(limit) {
+		next := make([]byte, 1)
+		n, err := io.ReadFull(r, next)
+		if n == 1 {
+			return c.setLarge(key, e, io.MultiReader(bytes.NewReader(next), r), ttl, priority, checkQuota)
+		}
+
+		if err != io.EOF {
+			return 0, err
+		}
+	}
+	return size, c.set(key, e, checkQuota)
+}
+
+// readEntry 从 r 中读取 value 直到 EOF，返回保存它的 entry 和 value 的字节数，设置了 ChunkSize 时超过一块的 value 分块保存
+func (c *Cache) readEntry(r io.Reader, ttl time.Duration, priority Priority) (*entry, int64, error) {
+	e := c.newEntry(nil, ttl)
+	e.priority = priority
+	if c.options.ChunkSize <= 0 {
+		var buf bytes.Buffer
+		if _, err := buf.ReadFrom(r); err != nil {
+			return nil, 0, err
+		}
+		e.value = utils.Copy(buf.Bytes())
+		return e, int64(buf.Len()), nil
+	}
+
+	head, total, err := readChunks(r, c.options.ChunkSize)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// 只有一块时和其他 value 一样保存，可以被压缩
+	switch {
+	case head == nil:
+		e.value = []byte{}
+	case head.next == nil:
+		e.value = head.data
+	default:
+		e.chunks = head
+	}
+	return e, total, nil
+}
+
+// GetReader 和 GetWithVersion 一样读取 key，返回可以逐块读取 value 的 ValueReader，分块保存的 value 和大对象不需要拼接
+// 压缩过的 value 会先解压，如果找不到、已经过期、解压失败或者大对象缺少分片则返回 false
+func (c *Cache) GetReader(key string) (*ValueReader, uint64, bool) {
+	start := time.Now()
+	defer c.counters.getLatency.Since(start)
+	e, now, ok := c.get(key)
+	var reader *ValueReader
+	if ok {
+		var err error
+		reader, err = c.openValue(key, e)
+		ok = err == nil
+	}
+
+	if !ok {
+		c.recordGet(key, nil, now, 0)
+		return nil, 0, false
+	}
+	c.recordGet(key, e, now, int(reader.size))
+	return reader, e.version, true
+}
+
+// ValueReader 读取一个 value，实现了 io.ReadSeeker 和 io.WriterTo，可以用于 http.ServeContent
+// 读取的是打开时的 value，之后 key 被覆盖或者删除不影响已经打开的 ValueReader，不能被多个协程同时使用
+type ValueReader struct {
+	head *chunk
+	size int64
+
+	// off 是下一次读取的位置，cur 是上一次读取到的块，start 是 cur 在 value 中的位置，顺序读取时不需要从头查找
+	off   int64
+	cur   *chunk
+	start int64
+}
+
+// openValue 返回读取 key 的 e 的 value 的 ValueReader，压缩过的 value 会先解压，大对象依次读取每个分片
+func (c *Cache) openValue(key string, e *entry) (*ValueReader, error) {
+	if e.chunks != nil {
+		return newValueReader(e.chunks), nil
+	}
+
+	if e.large {
+		return c.openManifest(key, e)
+	}
+
+	value, err := e.data()
+	if err != nil {
+		return nil, err
+	}
+	return newValueReader(&chunk{data: value}), nil
+}
+
+// openManifest 返回依次读取 key 的清单 e 中所有分片的 ValueReader，清单无效或者没有设置 LargeObjectThreshold 时返回 errLargeIncomplete
+func (c *Cache) openManifest(key string, e *entry) (*ValueReader, error) {
+	m, ok := c.manifestIn(e)
+	if !ok {
+		return nil, errLargeIncomplete
+	}
+	return c.openLarge(key, m)
+}
+
+// valueOf 和 e.data() 一样返回 key 的 e 的 value，大对象返回拼接所有分片之后的 value
+func (c *Cache) valueOf(key string, e *entry) ([]byte, error) {
+	if !e.large {
+		return e.data()
+	}
+
+	reader, err := c.openManifest(key, e)
+	if err != nil {
+		return nil, err
+	}
+	return reader.head.join(), nil
+}
+
+// newValueReader 返回读取从 head 开始的所有块的 ValueReader
+func newValueReader(head *chunk) *ValueReader {
+	reader := &ValueReader{head: head, cur: head}
+	for ch := head; ch != nil; ch = ch.next {
+		reader.size += int64(len(ch.data))
+	}
+	return reader
+}
+
+// Size 返回 value 的字节数
+func (vr *ValueReader) Size() int64 {
+	return vr.size
+}
+
+// locate 返回 off 所在的块和块中剩余的数据，off 已经到达末尾时返回 nil
+func (vr *ValueReader) locate() []byte {
+	if vr.off < vr.start {
+		vr.cur, vr.start = vr.head, 0
+	}
+
+	for vr.cur != nil && vr.off >= vr.start+int64(len(vr.cur.data)) {
+		vr.start += int64(len(vr.cur.data))
+		vr.cur = vr.cur.next
+	}
+
+	if vr.cur == nil {
+		return nil
+	}
+	return vr.cur.data[vr.off-vr.start:]
+}
+
+// Read 实现了 io.Reader
+func (vr *ValueReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		data := vr.locate()
+		if data == nil {
+			break
+		}
+
+		copied := copy(p[n:], data)
+		n += copied
+		vr.off += int64(copied)
+	}
+
+	if n == 0 && len(p) > 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+// WriteTo 实现了 io.WriterTo，io.Copy 会使用它直接写出每一块，不需要中间的缓冲区
+func (vr *ValueReader) WriteTo(w io.Writer) (int64, error) {
+	var total int64
+	for data := vr.locate(); data != nil; data = vr.locate() {
+		n, err := w.Write(data)
+		total += int64(n)
+		vr.off += int64(n)
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// Seek 实现了 io.Seeker，可以移动到末尾之后，之后的读取返回 io.EOF
+func (vr *ValueReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += vr.off
+	case io.SeekEnd:
+		offset += vr.size
+	default:
+		return 0, errors.New("caches: invalid whence")
+	}
+
+	if offset < 0 {
+		return 0, errors.New("caches: negative offset")
+	}
+	vr.off = offset
+	return offset, nil
+}
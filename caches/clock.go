@@ -0,0 +1,91 @@
+package caches
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Clock 是缓存计算过期时间使用的时钟，可以替换成测试用的 ManualClock，不需要真的等待数据过期
+// 持久化文件和 AOF 中的过期时间是 Now 返回的 Unix 时间，不同的时钟之间需要大致一致
+type Clock interface {
+	// Now 返回当前的时间
+	Now() time.Time
+}
+
+// ClockByName 返回名为 name 的时钟，可选值为 system 和 monotonic
+func ClockByName(name string) (Clock, error) {
+	switch name {
+	case "system":
+		return SystemClock(), nil
+	case "monotonic":
+		return NewMonotonicClock(), nil
+	}
+	return nil, fmt.Errorf("caches: unknown clock %q", name)
+}
+
+// systemClock 直接使用系统时间
+type systemClock struct{}
+
+// SystemClock 返回直接使用系统时间的时钟，这是默认的时钟
+// 系统时间被向前或者向后调整时，数据会提前或者推迟过期
+func SystemClock() Clock {
+	return systemClock{}
+}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// monotonicClock 从创建时的系统时间开始，按照单调时钟流逝
+type monotonicClock struct {
+	start time.Time
+}
+
+// NewMonotonicClock 返回从当前系统时间开始按照单调时钟流逝的时钟，之后系统时间被调整也不会影响它
+// 这样 NTP 校时或者手动修改系统时间不会让数据集中提前过期，但是运行很久之后可能和系统时间有一些偏差
+func NewMonotonicClock() Clock {
+	return &monotonicClock{start: time.Now()}
+}
+
+func (mc *monotonicClock) Now() time.Time {
+	// time.Since 使用 start 中的单调时钟读数计算，Round(0) 去掉单调时钟读数，避免和其他时间比较时不一致
+	return mc.start.Round(0).Add(time.Since(mc.start))
+}
+
+// ManualClock 是只在调用 Set 或者 Advance 时才会变化的时钟，用于测试过期相关的逻辑，可以被多个协程同时使用
+type ManualClock struct {
+	now  time.Time
+	lock sync.Mutex
+}
+
+// NewManualClock 返回从 now 开始的 ManualClock
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{now: now}
+}
+
+// Now 返回当前的时间
+func (mc *ManualClock) Now() time.Time {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+	return mc.now
+}
+
+// Set 把时钟设置为 now
+func (mc *ManualClock) Set(now time.Time) {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+	mc.now = now
+}
+
+// Advance 让时钟向前走 d
+func (mc *ManualClock) Advance(d time.Duration) {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+	mc.now = mc.now.Add(d)
+}
+
+// now 返回缓存的时钟的当前时间
+func (c *Cache) now() time.Time {
+	return c.options.Clock.Now()
+}
@@ -0,0 +1,119 @@
+package caches
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Entry 是持久化时的一个键值对
+type Entry struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+
+	// ExpireAt 是过期时间，单位是纳秒，为 0 表示永不过期
+	ExpireAt int64 `json:"expire_at,omitempty"`
+}
+
+// Codec 是持久化时对键值对进行编码的方式
+// 持久化文件中会记录编码方式的名字，读取时根据名字找到对应的 Codec 进行解码
+type Codec interface {
+	// Name 返回编码方式的名字，不能超过 255 个字节
+	Name() string
+
+	// Marshal 将 entries 编码成字节数组
+	Marshal(entries []Entry) ([]byte, error)
+
+	// Unmarshal 将字节数组解码成 entries
+	Unmarshal(data []byte) ([]Entry, error)
+}
+
+var (
+	// codecs 记录了所有注册过的编码方式
+	codecs = map[string]Codec{}
+
+	// codecsLock 用于保证并发安全
+	codecsLock = &sync.RWMutex{}
+)
+
+func init() {
+	RegisterCodec(GobCodec{})
+	RegisterCodec(JSONCodec{})
+	RegisterCodec(MsgpackCodec{})
+	RegisterCodec(ProtobufCodec{})
+}
+
+// RegisterCodec 注册一个编码方式，相同名字的编码方式会被覆盖
+func RegisterCodec(codec Codec) {
+	codecsLock.Lock()
+	defer codecsLock.Unlock()
+	codecs[codec.Name()] = codec
+}
+
+// CodecByName 返回名字为 name 的编码方式
+func CodecByName(name string) (Codec, error) {
+	codecsLock.RLock()
+	defer codecsLock.RUnlock()
+	codec, ok := codecs[name]
+	if !ok {
+		return nil, fmt.Errorf("caches: unknown codec %q", name)
+	}
+	return codec, nil
+}
+
+// CodecNames 返回所有注册过的编码方式的名字
+func CodecNames() []string {
+	codecsLock.RLock()
+	defer codecsLock.RUnlock()
+	names := make([]string, 0, len(codecs))
+	for name := range codecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GobCodec 使用 encoding/gob 进行编码，只有 Go 程序可以读取
+type GobCodec struct{}
+
+// Name 返回编码方式的名字
+func (GobCodec) Name() string {
+	return "gob"
+}
+
+// Marshal 将 entries 编码成字节数组
+func (GobCodec) Marshal(entries []Entry) ([]byte, error) {
+	buffer := bytes.NewBuffer(nil)
+	err := gob.NewEncoder(buffer).Encode(entries)
+	return buffer.Bytes(), err
+}
+
+// Unmarshal 将字节数组解码成 entries
+func (GobCodec) Unmarshal(data []byte) ([]Entry, error) {
+	var entries []Entry
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&entries)
+	return entries, err
+}
+
+// JSONCodec 使用 JSON 进行编码，value 会被编码成 base64 字符串
+type JSONCodec struct{}
+
+// Name 返回编码方式的名字
+func (JSONCodec) Name() string {
+	return "json"
+}
+
+// Marshal 将 entries 编码成字节数组
+func (JSONCodec) Marshal(entries []Entry) ([]byte, error) {
+	return json.Marshal(entries)
+}
+
+// Unmarshal 将字节数组解码成 entries
+func (JSONCodec) Unmarshal(data []byte) ([]Entry, error) {
+	var entries []Entry
+	err := json.Unmarshal(data, &entries)
+	return entries, err
+}
@@ -0,0 +1,249 @@
+package caches
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// errMsgpackShort 表示 msgpack 数据不完整
+var errMsgpackShort = errors.New("caches: msgpack data too short")
+
+// MsgpackCodec 使用 MessagePack 进行编码
+// 编码结果是一个数组，数组中的每个元素都是 [key, value, expireAt] 形式的数组
+// key 为 str 类型，value 为 bin 类型，expireAt 为 int 类型，旧版本写入的元素没有 expireAt
+type MsgpackCodec struct{}
+
+// Name 返回编码方式的名字
+func (MsgpackCodec) Name() string {
+	return "msgpack"
+}
+
+// Marshal 将 entries 编码成字节数组
+func (MsgpackCodec) Marshal(entries []Entry) ([]byte, error) {
+	size := 5
+	for _, entry := range entries {
+		size += 1 + 5 + len(entry.Key) + 5 + len(entry.Value) + 9
+	}
+
+	data := make([]byte, 0, size)
+	data = appendMsgpackHeader(data, 0x90, 0xdc, 0xdd, 15, len(entries))
+	for _, entry := range entries {
+		data = append(data, 0x93)
+		data = appendMsgpackHeader(data, 0xa0, 0xda, 0xdb, 31, len(entry.Key))
+		data = append(data, entry.Key...)
+		data = appendMsgpackBin(data, len(entry.Value))
+		data = append(data, entry.Value...)
+		data = appendMsgpackInt(data, entry.ExpireAt)
+	}
+	return data, nil
+}
+
+// Unmarshal 将字节数组解码成 entries
+func (MsgpackCodec) Unmarshal(data []byte) ([]Entry, error) {
+	reader := &msgpackReader{data: data}
+	n, err := reader.readArray()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]Entry, 0, n)
+	for i := 0; i < n; i++ {
+		fields, err := reader.readArray()
+		if err != nil {
+			return nil, err
+		}
+
+		if fields != 2 && fields != 3 {
+			return nil, fmt.Errorf("caches: msgpack entry has %d fields, want 2 or 3", fields)
+		}
+
+		key, err := reader.readBytes()
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := reader.readBytes()
+		if err != nil {
+			return nil, err
+		}
+		var expireAt int64
+		if fields == 3 {
+			if expireAt, err = reader.readInt(); err != nil {
+				return nil, err
+			}
+		}
+		entries = append(entries, Entry{Key: string(key), Value: value, ExpireAt: expireAt})
+	}
+	return entries, nil
+}
+
+// appendMsgpackHeader 追加 array 或 str 类型的头部
+// fix 是长度不超过 fixMax 时使用的前缀，m16 和 m32 分别是长度为 16 位和 32 位时使用的前缀
+func appendMsgpackHeader(data []byte, fix byte, m16 byte, m32 byte, fixMax int, n int) []byte {
+	switch {
+	case n <= fixMax:
+		return append(data, fix|byte(n))
+	case n <= 0xffff:
+		data = append(data, m16, 0, 0)
+		binary.BigEndian.PutUint16(data[len(data)-2:], uint16(n))
+		return data
+	default:
+		data = append(data, m32, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(data[len(data)-4:], uint32(n))
+		return data
+	}
+}
+
+// appendMsgpackBin 追加 bin 类型的头部
+func appendMsgpackBin(data []byte, n int) []byte {
+	switch {
+	case n <= 0xff:
+		return append(data, 0xc4, byte(n))
+	case n <= 0xffff:
+		data = append(data, 0xc5, 0, 0)
+		binary.BigEndian.PutUint16(data[len(data)-2:], uint16(n))
+		return data
+	default:
+		data = append(data, 0xc6, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(data[len(data)-4:], uint32(n))
+		return data
+	}
+}
+
+// appendMsgpackInt 追加 int 类型的数据，0 使用 positive fixint 编码，其他值使用 int 64 编码
+func appendMsgpackInt(data []byte, n int64) []byte {
+	if n == 0 {
+		return append(data, 0)
+	}
+
+	data = append(data, 0xd3, 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.BigEndian.PutUint64(data[len(data)-8:], uint64(n))
+	return data
+}
+
+// msgpackReader 用于读取 msgpack 数据
+type msgpackReader struct {
+	data []byte
+	pos  int
+}
+
+// next 读取 n 个字节
+func (mr *msgpackReader) next(n int) ([]byte, error) {
+	if n < 0 || mr.pos+n > len(mr.data) {
+		return nil, errMsgpackShort
+	}
+	b := mr.data[mr.pos : mr.pos+n]
+	mr.pos += n
+	return b, nil
+}
+
+// readLength 根据前缀后面的 size 个字节读取长度
+func (mr *msgpackReader) readLength(size int) (int, error) {
+	b, err := mr.next(size)
+	if err != nil {
+		return 0, err
+	}
+
+	switch size {
+	case 1:
+		return int(b[0]), nil
+	case 2:
+		return int(binary.BigEndian.Uint16(b)), nil
+	default:
+		return int(binary.BigEndian.Uint32(b)), nil
+	}
+}
+
+// readArray 读取 array 类型的头部，返回元素个数
+func (mr *msgpackReader) readArray() (int, error) {
+	b, err := mr.next(1)
+	if err != nil {
+		return 0, err
+	}
+
+	switch {
+	case b[0]&0xf0 == 0x90:
+		return int(b[0] & 0x0f), nil
+	case b[0] == 0xdc:
+		return mr.readLength(2)
+	case b[0] == 0xdd:
+		return mr.readLength(4)
+	default:
+		return 0, fmt.Errorf("caches: msgpack type 0x%x is not an array", b[0])
+	}
+}
+
+// readBytes 读取 str 或 bin 类型的数据
+func (mr *msgpackReader) readBytes() ([]byte, error) {
+	b, err := mr.next(1)
+	if err != nil {
+		return nil, err
+	}
+
+	var n int
+	switch {
+	case b[0]&0xe0 == 0xa0:
+		n = int(b[0] & 0x1f)
+	case b[0] == 0xd9 || b[0] == 0xc4:
+		n, err = mr.readLength(1)
+	case b[0] == 0xda || b[0] == 0xc5:
+		n, err = mr.readLength(2)
+	case b[0] == 0xdb || b[0] == 0xc6:
+		n, err = mr.readLength(4)
+	default:
+		return nil, fmt.Errorf("caches: msgpack type 0x%x is not a str or bin", b[0])
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := mr.next(n)
+	if err != nil {
+		return nil, err
+	}
+
+	// 拷贝一份，避免引用整个数据块
+	result := make([]byte, n)
+	copy(result, value)
+	return result, nil
+}
+
+// readInt 读取 int 或 uint 类型的数据
+func (mr *msgpackReader) readInt() (int64, error) {
+	b, err := mr.next(1)
+	if err != nil {
+		return 0, err
+	}
+
+	switch {
+	case b[0] <= 0x7f:
+		return int64(b[0]), nil
+	case b[0] >= 0xe0:
+		return int64(int8(b[0])), nil
+	}
+
+	sizes := map[byte]int{0xcc: 1, 0xcd: 2, 0xce: 4, 0xcf: 8, 0xd0: 1, 0xd1: 2, 0xd2: 4, 0xd3: 8}
+	size, ok := sizes[b[0]]
+	if !ok {
+		return 0, fmt.Errorf("caches: msgpack type 0x%x is not an int", b[0])
+	}
+
+	value, err := mr.next(size)
+	if err != nil {
+		return 0, err
+	}
+
+	var n uint64
+	for _, v := range value {
+		n = n<<8 | uint64(v)
+	}
+
+	// 有符号整数需要进行符号扩展
+	if b[0] >= 0xd0 && size < 8 {
+		shift := uint(64 - size*8)
+		return int64(n<<shift) >> shift, nil
+	}
+	return int64(n), nil
+}
@@ -0,0 +1,123 @@
+package caches
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// ProtobufCodec 使用 Protocol Buffers 的二进制格式进行编码，对应的消息定义为：
+//
+//	message Entry {
+//	  string key = 1;
+//	  bytes value = 2;
+//	  int64 expire_at = 3;
+//	}
+//
+//	message Block {
+//	  repeated Entry entries = 1;
+//	}
+type ProtobufCodec struct{}
+
+// Name 返回编码方式的名字
+func (ProtobufCodec) Name() string {
+	return "protobuf"
+}
+
+// Marshal 将 entries 编码成字节数组
+func (ProtobufCodec) Marshal(entries []Entry) ([]byte, error) {
+	var data []byte
+	for _, entry := range entries {
+		var message []byte
+		if entry.Key != "" {
+			message = protowire.AppendTag(message, 1, protowire.BytesType)
+			message = protowire.AppendString(message, entry.Key)
+		}
+
+		if len(entry.Value) > 0 {
+			message = protowire.AppendTag(message, 2, protowire.BytesType)
+			message = protowire.AppendBytes(message, entry.Value)
+		}
+
+		if entry.ExpireAt != 0 {
+			message = protowire.AppendTag(message, 3, protowire.VarintType)
+			message = protowire.AppendVarint(message, uint64(entry.ExpireAt))
+		}
+
+		data = protowire.AppendTag(data, 1, protowire.BytesType)
+		data = protowire.AppendBytes(data, message)
+	}
+	return data, nil
+}
+
+// Unmarshal 将字节数组解码成 entries，未知的字段会被跳过
+func (ProtobufCodec) Unmarshal(data []byte) ([]Entry, error) {
+	var entries []Entry
+	for len(data) > 0 {
+		number, wireType, n := protowire.ConsumeField(data)
+		if n < 0 {
+			return entries, protobufError(n)
+		}
+
+		if number == 1 && wireType == protowire.BytesType {
+			entry, err := unmarshalProtobufEntry(data[:n])
+			entries = append(entries, entry)
+			if err != nil {
+				return entries, err
+			}
+		}
+		data = data[n:]
+	}
+	return entries, nil
+}
+
+// unmarshalProtobufEntry 解码 Block 中的一个 entries 字段，field 包括字段的 tag
+func unmarshalProtobufEntry(field []byte) (Entry, error) {
+	entry := Entry{Value: []byte{}}
+	_, _, n := protowire.ConsumeTag(field)
+	message, m := protowire.ConsumeBytes(field[n:])
+	if m < 0 {
+		return entry, protobufError(m)
+	}
+
+	for len(message) > 0 {
+		number, wireType, n := protowire.ConsumeTag(message)
+		if n < 0 {
+			return entry, protobufError(n)
+		}
+		message = message[n:]
+
+		switch {
+		case number == 1 && wireType == protowire.BytesType:
+			key, n := protowire.ConsumeString(message)
+			if n < 0 {
+				return entry, protobufError(n)
+			}
+			entry.Key, message = key, message[n:]
+		case number == 2 && wireType == protowire.BytesType:
+			value, n := protowire.ConsumeBytes(message)
+			if n < 0 {
+				return entry, protobufError(n)
+			}
+			entry.Value, message = append([]byte{}, value...), message[n:]
+		case number == 3 && wireType == protowire.VarintType:
+			expireAt, n := protowire.ConsumeVarint(message)
+			if n < 0 {
+				return entry, protobufError(n)
+			}
+			entry.ExpireAt, message = int64(expireAt), message[n:]
+		default:
+			n := protowire.ConsumeFieldValue(number, wireType, message)
+			if n < 0 {
+				return entry, protobufError(n)
+			}
+			message = message[n:]
+		}
+	}
+	return entry, nil
+}
+
+// protobufError 返回 protowire 中 Consume 系列函数返回的负数 n 对应的错误
+func protobufError(n int) error {
+	return fmt.Errorf("caches: malformed protobuf data: %w", protowire.ParseError(n))
+}
@@ -0,0 +1,175 @@
+package caches
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// binaryValue 返回包含所有字节取值的 value
+func binaryValue() []byte {
+	value := make([]byte, 512)
+	for i := range value {
+		value[i] = byte(i)
+	}
+	return value
+}
+
+// codecEntries 返回编码测试使用的键值对，长度覆盖了 msgpack 和 protobuf 中不同长度的头部
+func codecEntries() map[string][]Entry {
+	many := make([]Entry, 70000)
+	for i := range many {
+		many[i] = Entry{Key: fmt.Sprintf("key%d", i), Value: []byte{byte(i)}, ExpireAt: int64(i)}
+	}
+
+	return map[string][]Entry{
+		"none":  {},
+		"empty": {{Key: "", Value: []byte{}}},
+		"ttl": {
+			{Key: "never", Value: []byte("v")},
+			{Key: "soon", Value: []byte("v"), ExpireAt: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC).UnixNano()},
+			{Key: "max", Value: []byte("v"), ExpireAt: math.MaxInt64},
+			{Key: "negative", Value: []byte("v"), ExpireAt: -1},
+			{Key: "min", Value: []byte("v"), ExpireAt: math.MinInt64},
+		},
+		"binary": {
+			{Key: "all bytes", Value: binaryValue()},
+			{Key: "zeros", Value: make([]byte, 100)},
+			{Key: "not utf-8", Value: []byte{0xff, 0xfe, 0xc0, 0x80}},
+		},
+		"keys": {
+			{Key: "中文的 key", Value: []byte("unicode")},
+			{Key: strings.Repeat("k", 31), Value: []byte("fixstr")},
+			{Key: strings.Repeat("k", 32), Value: []byte("str 16")},
+			{Key: strings.Repeat("k", 70000), Value: []byte("str 32")},
+		},
+		"values": {
+			{Key: "255", Value: bytes.Repeat([]byte{1}, 255)},
+			{Key: "256", Value: bytes.Repeat([]byte{2}, 256)},
+			{Key: "65536", Value: bytes.Repeat([]byte{3}, 65536), ExpireAt: 1},
+		},
+		"many": many,
+	}
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	for _, name := range []string{"gob", "json", "msgpack", "protobuf"} {
+		codec, err := CodecByName(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for set, entries := range codecEntries() {
+			data, err := codec.Marshal(entries)
+			if err != nil {
+				t.Fatalf("%s %s: Marshal: %v", name, set, err)
+			}
+
+			decoded, err := codec.Unmarshal(data)
+			if err != nil {
+				t.Fatalf("%s %s: Unmarshal: %v", name, set, err)
+			}
+
+			if len(decoded) != len(entries) {
+				t.Fatalf("%s %s: decoded %d entries, want %d", name, set, len(decoded), len(entries))
+			}
+
+			for i, entry := range entries {
+				got := decoded[i]
+				if got.Key != entry.Key || !bytes.Equal(got.Value, entry.Value) || got.ExpireAt != entry.ExpireAt {
+					t.Fatalf("%s %s: entry %d = %q, %d bytes, %d, want %q, %d bytes, %d",
+						name, set, i, truncate(got.Key), len(got.Value), got.ExpireAt, truncate(entry.Key), len(entry.Value), entry.ExpireAt)
+				}
+			}
+		}
+	}
+}
+
+// TestProtobufUnknownFields 检查 ProtobufCodec 跳过未知的字段，数据不完整时返回错误
+func TestProtobufUnknownFields(t *testing.T) {
+	var message []byte
+	message = protowire.AppendTag(message, 9, protowire.Fixed32Type)
+	message = protowire.AppendFixed32(message, 7)
+	message = protowire.AppendTag(message, 1, protowire.BytesType)
+	message = protowire.AppendString(message, "k")
+	message = protowire.AppendTag(message, 3, protowire.VarintType)
+	message = protowire.AppendVarint(message, 42)
+
+	var data []byte
+	data = protowire.AppendTag(data, 2, protowire.VarintType)
+	data = protowire.AppendVarint(data, 1)
+	data = protowire.AppendTag(data, 1, protowire.BytesType)
+	data = protowire.AppendBytes(data, message)
+
+	entries, err := ProtobufCodec{}.Unmarshal(data)
+	if err != nil || len(entries) != 1 || entries[0].Key != "k" || entries[0].ExpireAt != 42 || len(entries[0].Value) != 0 {
+		t.Fatalf("Unmarshal = %+v, %v", entries, err)
+	}
+
+	// 前两个字节是完整的未知字段，之后截断的数据都不完整
+	for i := 3; i < len(data); i++ {
+		if _, err = (ProtobufCodec{}).Unmarshal(data[:i]); err == nil {
+			t.Errorf("Unmarshal of %d of %d bytes succeeded", i, len(data))
+		}
+	}
+}
+
+// truncate 返回 key 的前 40 个字节，避免很长的 key 占满错误信息
+func truncate(key string) string {
+	if len(key) > 40 {
+		return key[:40] + "..."
+	}
+	return key
+}
+
+func TestSnapshotCodecs(t *testing.T) {
+	clock := NewManualClock(time.Unix(1700000000, 0))
+	for _, name := range CodecNames() {
+		codec, _ := CodecByName(name)
+		options := DefaultOptions()
+		options.Clock = clock
+		options.Codec = codec
+		c := NewCacheWithOptions(options)
+
+		c.Set("forever", []byte("value"))
+		c.SetWithTTL("ttl", []byte("expires"), time.Hour)
+		c.SetWithTTL("binary", binaryValue(), 90*time.Second)
+		c.SetWithTTL("expired", []byte("gone"), time.Second)
+		c.Set("empty", []byte{})
+		clock.Advance(2 * time.Second)
+
+		var buf bytes.Buffer
+		if err := c.Save(&buf); err != nil {
+			t.Fatalf("%s: Save: %v", name, err)
+		}
+
+		// 读取时按照文件中记录的编码方式解码，和读取的缓存使用的编码方式无关
+		loaded := NewCacheWithOptions(Options{Clock: clock})
+		if err := loaded.Load(&buf); err != nil {
+			t.Fatalf("%s: Load: %v", name, err)
+		}
+
+		if count := loaded.Count(); count != 4 {
+			t.Errorf("%s: Count = %d, want 4", name, count)
+		}
+
+		for _, key := range []string{"forever", "ttl", "binary", "empty"} {
+			want, _ := c.Get(key)
+			wantTTL, _ := c.TTL(key)
+			got, ok := loaded.Get(key)
+			gotTTL, _ := loaded.TTL(key)
+			if !ok || !bytes.Equal(got, want) || gotTTL != wantTTL {
+				t.Errorf("%s: %s = %d bytes, ttl %s, %v, want %d bytes, ttl %s", name, key, len(got), gotTTL, ok, len(want), wantTTL)
+			}
+		}
+
+		if _, ok := loaded.Get("expired"); ok {
+			t.Errorf("%s: expired key was loaded", name)
+		}
+	}
+}
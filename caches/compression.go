@@ -0,0 +1,177 @@
+package caches
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"gocache/utils"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression 是 value 在内存中的压缩算法，每个 entry 记录了自己的压缩算法，同一个缓存中可以同时有压缩和没有压缩的 value
+type Compression uint8
+
+const (
+	// CompressionNone 表示不压缩
+	CompressionNone Compression = iota
+
+	// CompressionGzip 使用 gzip 压缩，压缩率更高但是更慢
+	CompressionGzip
+
+	// CompressionSnappy 使用 Snappy 的块格式压缩，压缩率比 gzip 低，但是快得多，适合频繁读取的数据
+	CompressionSnappy
+
+	// CompressionZstd 使用 zstd 压缩，压缩率接近 gzip，解压的速度接近 snappy
+	CompressionZstd
+)
+
+// MaxDecompressedSize 是解压出的数据的最大字节数，和 TCP 以及 gRPC 请求中 value 的最大长度一样
+// 超过它的 value 不会被压缩，解压出的数据更长时返回 ErrDecompressedTooLarge，避免损坏或者伪造的数据按照声明的长度分配内存
+const MaxDecompressedSize = 64 << 20
+
+// ErrDecompressedTooLarge 表示解压出的数据超过了 MaxDecompressedSize
+var ErrDecompressedTooLarge = errors.New("caches: decompressed data is too large")
+
+// CompressionByName 返回名为 name 的压缩算法，可选值为 gzip、snappy 和 zstd，为空或者 none 时返回 CompressionNone
+func CompressionByName(name string) (Compression, error) {
+	switch name {
+	case "", "none":
+		return CompressionNone, nil
+	case "gzip":
+		return CompressionGzip, nil
+	case "snappy":
+		return CompressionSnappy, nil
+	case "zstd":
+		return CompressionZstd, nil
+	}
+	return CompressionNone, fmt.Errorf("caches: unknown compression %q", name)
+}
+
+// String 返回压缩算法的名字
+func (c Compression) String() string {
+	switch c {
+	case CompressionGzip:
+		return "gzip"
+	case CompressionSnappy:
+		return "snappy"
+	case CompressionZstd:
+		return "zstd"
+	}
+	return "none"
+}
+
+// Compress 压缩 data，CompressionNone 时原样返回
+func (c Compression) Compress(data []byte) ([]byte, error) {
+	switch c {
+	case CompressionNone:
+		return data, nil
+	case CompressionGzip:
+		var buf bytes.Buffer
+		writer := gzipWriters.Get().(*gzip.Writer)
+		defer gzipWriters.Put(writer)
+		writer.Reset(&buf)
+		if _, err := writer.Write(data); err != nil {
+			return nil, err
+		}
+
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case CompressionSnappy:
+		return snappy.Encode(nil, data), nil
+	case CompressionZstd:
+		return zstdEncoder.EncodeAll(data, nil), nil
+	}
+	return nil, fmt.Errorf("caches: unknown compression %d", c)
+}
+
+// Decompress 解压 Compress 压缩的 data，CompressionNone 时原样返回
+func (c Compression) Decompress(data []byte) ([]byte, error) {
+	switch c {
+	case CompressionNone:
+		return data, nil
+	case CompressionGzip:
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+
+		value, err := ioutil.ReadAll(io.LimitReader(reader, MaxDecompressedSize+1))
+		if err == nil && len(value) > MaxDecompressedSize {
+			return nil, ErrDecompressedTooLarge
+		}
+		return value, err
+	case CompressionSnappy:
+		// 解压时按照数据开头声明的长度分配内存，先检查长度
+		size, err := snappy.DecodedLen(data)
+		if err != nil {
+			return nil, err
+		}
+
+		if size > MaxDecompressedSize {
+			return nil, ErrDecompressedTooLarge
+		}
+		return snappy.Decode(nil, data)
+	case CompressionZstd:
+		value, err := zstdDecoder.DecodeAll(data, nil)
+		if errors.Is(err, zstd.ErrDecoderSizeExceeded) {
+			return nil, ErrDecompressedTooLarge
+		}
+		return value, err
+	}
+	return nil, fmt.Errorf("caches: unknown compression %d", c)
+}
+
+// gzipWriters 缓存 gzip.Writer，每次创建都需要分配几百 KB 的内存
+var gzipWriters = sync.Pool{
+	New: func() interface{} {
+		return gzip.NewWriter(nil)
+	},
+}
+
+// zstdEncoder 和 zstdDecoder 的 EncodeAll 和 DecodeAll 可以被并发调用，所有的缓存共用一个
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0), zstd.WithDecoderMaxMemory(MaxDecompressedSize))
+)
+
+// compress 在开启了压缩并且 value 超过 CompressionThreshold 字节时压缩 e 的 value，压缩之后没有变小或者已经压缩过时保持原样
+// 分块保存的 value 和超过 MaxDecompressedSize 的 value 不压缩，需要在保存 e 之前调用
+func (c *Cache) compress(e *entry) {
+	compression := c.options.Compression
+	if compression == CompressionNone || e.compression != CompressionNone || e.chunks != nil ||
+		len(e.value) <= c.options.CompressionThreshold || len(e.value) > MaxDecompressedSize {
+		return
+	}
+
+	data, err := compression.Compress(e.value)
+	if err != nil || len(data) >= len(e.value) {
+		return
+	}
+
+	// 压缩的结果可能有多余的容量，拷贝一份只占用需要的内存
+	e.value, e.compression = utils.Copy(data), compression
+}
+
+// data 返回 e 解压之后的 value，没有压缩时直接返回 value，不能修改返回的数据
+// 分块保存的 value 需要拼接成一个切片，只需要顺序读取时使用 newValueReader 避免拷贝
+func (e *entry) data() ([]byte, error) {
+	if e.chunks != nil {
+		return e.chunks.join(), nil
+	}
+	return e.compression.Decompress(e.value)
+}
+
+// entryOf 返回 key 和 e 解压之后的 Entry，解压失败说明 value 在内存中损坏了，这时返回 false，调用者跳过这个 key
+func entryOf(key string, e *entry) (Entry, bool) {
+	value, err := e.data()
+	return Entry{Key: key, Value: value, ExpireAt: e.expireAt}, err == nil
+}
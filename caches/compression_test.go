@@ -0,0 +1,162 @@
+package caches
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+var compressions = []Compression{CompressionNone, CompressionGzip, CompressionSnappy, CompressionZstd}
+
+// compressionInputs 返回压缩测试使用的数据，包括空数据、不可压缩的随机数据和跨越 64KB 的数据
+func compressionInputs() map[string][]byte {
+	random := rand.New(rand.NewSource(1))
+	noise := make([]byte, 200000)
+	random.Read(noise)
+
+	text := []byte(strings.Repeat("The quick brown fox jumps over the lazy dog. ", 3000))
+	mixed := make([]byte, 0, 3<<16)
+	for len(mixed) < 3<<16 {
+		mixed = append(mixed, noise[:random.Intn(100)]...)
+		mixed = append(mixed, text[:random.Intn(500)]...)
+	}
+
+	return map[string][]byte{
+		"empty":            {},
+		"one byte":         {'x'},
+		"short":            []byte("hello"),
+		"repeated byte":    bytes.Repeat([]byte{'a'}, 1000),
+		"overlapping copy": bytes.Repeat([]byte("ab"), 100),
+		"text":             text,
+		"noise":            noise,
+		"block plus one":   text[:1<<16+1],
+		"mixed":            mixed,
+		"binary":           bytes.Repeat([]byte{0, 1, 2, 3, 0xff, 0xfe}, 20000),
+	}
+}
+
+func TestCompressionRoundTrip(t *testing.T) {
+	for _, compression := range compressions {
+		if byName, err := CompressionByName(compression.String()); err != nil || byName != compression {
+			t.Errorf("CompressionByName(%q) = %v, %v", compression, byName, err)
+		}
+
+		for name, input := range compressionInputs() {
+			compressed, err := compression.Compress(input)
+			if err != nil {
+				t.Fatalf("%s: Compress(%s) = %v", compression, name, err)
+			}
+
+			decompressed, err := compression.Decompress(compressed)
+			if err != nil || !bytes.Equal(decompressed, input) {
+				t.Errorf("%s: round trip of %s = %d bytes, %v, want %d bytes", compression, name, len(decompressed), err, len(input))
+			}
+		}
+	}
+
+	if _, err := CompressionByName("lz4"); err == nil {
+		t.Error("CompressionByName(\"lz4\") succeeded")
+	}
+}
+
+func TestZstdDecompressMalformed(t *testing.T) {
+	compressed, err := CompressionZstd.Compress([]byte(strings.Repeat("gocache ", 1000)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, data := range map[string][]byte{
+		"truncated": compressed[:len(compressed)/2],
+		"garbage":   []byte("not a zstd frame"),
+	} {
+		if _, err := CompressionZstd.Decompress(data); err == nil {
+			t.Errorf("%s: Decompress succeeded", name)
+		}
+	}
+}
+
+// TestDecompressTooLarge 检查声明的原始长度超过 MaxDecompressedSize 的数据在分配内存之前就被拒绝
+func TestDecompressTooLarge(t *testing.T) {
+	// zstd 的帧头声明了 1GB 的原始长度，后面是一个空的原始块
+	zstdFrame := []byte{0x28, 0xb5, 0x2f, 0xfd, 0xe0, 0, 0, 0, 0x40, 0, 0, 0, 0, 0x01, 0, 0}
+	tests := []struct {
+		compression Compression
+		data        []byte
+	}{
+		{CompressionSnappy, []byte("\x80\x80\x80\x80\x08" + strings.Repeat("\xfe\x01\x00", 10))},
+		{CompressionZstd, zstdFrame},
+	}
+
+	for _, test := range tests {
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		_, err := test.compression.Decompress(test.data)
+		runtime.ReadMemStats(&after)
+
+		if !errors.Is(err, ErrDecompressedTooLarge) {
+			t.Errorf("%s: Decompress = %v, want ErrDecompressedTooLarge", test.compression, err)
+		}
+
+		if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+			t.Errorf("%s: allocated %d bytes", test.compression, allocated)
+		}
+	}
+
+	bomb, err := CompressionGzip.Compress(make([]byte, MaxDecompressedSize+1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = CompressionGzip.Decompress(bomb); !errors.Is(err, ErrDecompressedTooLarge) {
+		t.Errorf("gzip: Decompress = %v, want ErrDecompressedTooLarge", err)
+	}
+}
+
+// TestMixedCompression 检查同一个缓存中使用不同算法压缩的和没有压缩的 value 可以同时存在，都能被正确读取
+func TestMixedCompression(t *testing.T) {
+	options := DefaultOptions()
+	options.CompressionThreshold = 64
+	c := NewCacheWithOptions(options)
+
+	large := []byte(strings.Repeat("The quick brown fox jumps over the lazy dog. ", 100))
+	small := []byte("small")
+	values := map[string][]byte{}
+	for _, compression := range compressions {
+		c.options.Compression = compression
+		values[compression.String()+":large"] = large
+		values[compression.String()+":small"] = small
+		c.Set(compression.String()+":large", large)
+		c.Set(compression.String()+":small", small)
+	}
+
+	for _, compression := range compressions {
+		for key, want := range map[string]Compression{compression.String() + ":large": compression, compression.String() + ":small": CompressionNone} {
+			e, ok := c.lookup(key)
+			if !ok || e.compression != want {
+				t.Errorf("%s: compression = %v, want %v", key, e.compression, want)
+			}
+		}
+	}
+
+	c.options.Compression = CompressionNone
+	for key, want := range values {
+		if value, ok := c.Get(key); !ok || !bytes.Equal(value, want) {
+			t.Errorf("Get(%q) = %d bytes, %v, want %d bytes", key, len(value), ok, len(want))
+		}
+	}
+
+	entries := 0
+	for _, e := range c.Entries() {
+		if !bytes.Equal(e.Value, values[e.Key]) {
+			t.Errorf("Entries: %s = %d bytes, want %d bytes", e.Key, len(e.Value), len(values[e.Key]))
+		}
+		entries++
+	}
+
+	if entries != len(values) {
+		t.Errorf("Entries returned %d entries, want %d", entries, len(values))
+	}
+}
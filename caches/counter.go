@@ -0,0 +1,72 @@
+package caches
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrNotInteger 表示 key 的 value 不是十进制的 64 位整数，不能自增
+	ErrNotInteger = errors.New("caches: value is not an integer")
+
+	// ErrOverflow 表示自增之后会超出 64 位整数的范围
+	ErrOverflow = errors.New("caches: increment or decrement would overflow")
+)
+
+// Increment 原子地把 key 的 value 加上 delta，返回加上之后的值
+// key 不存在或者已经过期时从 0 开始加，并且 ttl 之后过期，ttl 为 NeverExpire 表示永不过期；key 存在时过期时间保持不变
+// value 不是十进制的 64 位整数时返回 ErrNotInteger，结果超出范围时返回 ErrOverflow，这两种情况都不会修改 key
+func (c *Cache) Increment(key string, delta int64, ttl time.Duration) (int64, error) {
+	return c.increment(key, delta, ttl, false)
+}
+
+// IncrementWithQuota 和 Increment 一样修改 key 的 value，但是修改之后会超出 key 所在命名空间的配额时返回 *QuotaError
+func (c *Cache) IncrementWithQuota(key string, delta int64, ttl time.Duration) (int64, error) {
+	return c.increment(key, delta, ttl, true)
+}
+
+// Decrement 原子地把 key 的 value 减去 delta，返回减去之后的值，其他和 Increment 一样
+func (c *Cache) Decrement(key string, delta int64, ttl time.Duration) (int64, error) {
+	if delta == math.MinInt64 {
+		return 0, ErrOverflow
+	}
+	return c.Increment(key, -delta, ttl)
+}
+
+// increment 在 key 的锁下读取、加上 delta 并保存 key，key 不存在时 ttl 之后过期，checkQuota 为 true 时检查命名空间的配额
+func (c *Cache) increment(key string, delta int64, ttl time.Duration, checkQuota bool) (int64, error) {
+	if err := CheckKey(key); err != nil {
+		return 0, err
+	}
+
+	defer c.counters.setLatency.Since(time.Now())
+	defer c.lockKeys(checkQuota, key)()
+
+	var current int64
+	var priority Priority
+	expireAt := c.newEntry(nil, ttl).expireAt
+	if old, ok := c.lookup(key); ok && old.alive(c.now().UnixNano()) {
+		value, err := old.data()
+		if err != nil {
+			return 0, ErrNotInteger
+		}
+
+		if current, err = strconv.ParseInt(string(value), 10, 64); err != nil {
+			return 0, ErrNotInteger
+		}
+		expireAt, priority = old.expireAt, old.priority
+	}
+
+	if delta > 0 && current > math.MaxInt64-delta || delta < 0 && current < math.MinInt64-delta {
+		return 0, ErrOverflow
+	}
+
+	current += delta
+	e := &entry{value: strconv.AppendInt(nil, current, 10), expireAt: expireAt, priority: priority}
+	if err := c.putKey(key, e, checkQuota); err != nil {
+		return 0, err
+	}
+	return current, nil
+}
@@ -0,0 +1,56 @@
+package caches
+
+import (
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// deterministicEpoch 是确定性模式下没有设置 Clock 时 ManualClock 开始的时间
+var deterministicEpoch = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// NewDeterministicCache 返回在确定性模式下运行的缓存和它使用的 ManualClock，用于基于模型的测试和模糊测试
+// 确定性模式下时间只在调用 ManualClock 的方法时流逝，随机数由 seed 生成，遍历按照 key 的顺序进行，也不会开启后台协程
+// 这样相同的 seed 和相同的操作序列总是得到相同的结果，AutoGc 这样的方法什么都不做，需要自己调用 Gc
+// 缓存只能在一个协程中使用，也不能使用 AOF，延迟这样的统计数据仍然使用系统时间
+func NewDeterministicCache(seed int64) (*Cache, *ManualClock) {
+	clock := NewManualClock(deterministicEpoch)
+	options := DefaultOptions()
+	options.Deterministic = true
+	options.Seed = seed
+	options.Clock = clock
+	return NewCacheWithOptions(options), clock
+}
+
+// forEachSorted 按照 key 的顺序遍历所有的 entry，用于确定性模式，调用者需要持有锁
+func (c *Cache) forEachSorted(fn func(key string, e *entry) bool) {
+	keys := make([]string, 0, c.Count())
+	entries := make(map[string]*entry, c.Count())
+	for _, seg := range c.segments {
+		seg.lock.RLock()
+		seg.forEach(func(key string, e *entry) bool {
+			keys = append(keys, key)
+			entries[key] = e
+			return true
+		})
+		seg.lock.RUnlock()
+	}
+
+	sort.Strings(keys)
+	for _, key := range keys {
+		if !fn(key, entries[key]) {
+			return
+		}
+	}
+}
+
+// newRandom 返回一个新的随机数生成器，确定性模式下种子来自 Options.Seed 生成的随机数，否则来自当前时间
+func (c *Cache) newRandom() *rand.Rand {
+	if c.random == nil {
+		return rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+
+	c.randomLock.Lock()
+	defer c.randomLock.Unlock()
+	return rand.New(rand.NewSource(c.random.Int63()))
+}
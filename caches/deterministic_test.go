@@ -0,0 +1,186 @@
+package caches
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// modelEntry 是模型中的一个键值对，expireAt 为 0 表示永不过期
+type modelEntry struct {
+	value    string
+	expireAt int64
+}
+
+// model 是缓存的参考实现，只有一个 map，用来和确定性模式下的缓存比较
+type model struct {
+	entries map[string]modelEntry
+	now     int64
+}
+
+func (m *model) alive(key string) (modelEntry, bool) {
+	e, ok := m.entries[key]
+	return e, ok && (e.expireAt == 0 || m.now < e.expireAt)
+}
+
+func (m *model) expireAt(ttl time.Duration) int64 {
+	if ttl > NeverExpire {
+		return m.now + int64(ttl)
+	}
+	return 0
+}
+
+func (m *model) aliveKeys() []string {
+	keys := []string{}
+	for key := range m.entries {
+		if _, ok := m.alive(key); ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// modelKeys 是操作使用的 key，个数很少，这样操作经常落在同一个 key 上
+var modelKeys = []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+
+// runModel 把 ops 解释成一串操作，同时在确定性模式的缓存和模型上执行并比较结果，返回随机操作的结果用于比较两次执行是否一样
+// 每个操作使用 ops 中的 3 个字节：操作、key 和参数
+func runModel(t *testing.T, seed int64, ops []byte) []string {
+	c, clock := NewDeterministicCache(seed)
+	m := &model{entries: make(map[string]modelEntry), now: clock.Now().UnixNano()}
+	var trace []string
+	for i := 0; i+2 < len(ops); i += 3 {
+		key := modelKeys[int(ops[i+1])%len(modelKeys)]
+		arg := int(ops[i+2])
+		ttl := time.Duration(arg%4) * time.Second
+		value := fmt.Sprintf("v%d", i)
+
+		switch ops[i] % 9 {
+		case 0:
+			c.SetWithTTL(key, []byte(value), ttl)
+			m.entries[key] = modelEntry{value: value, expireAt: m.expireAt(ttl)}
+		case 1:
+			got, ok := c.Get(key)
+			want, wantOK := m.alive(key)
+			if ok != wantOK || ok && string(got) != want.value {
+				t.Fatalf("op %d: Get(%q) = %q, %v, want %q, %v", i/3, key, got, ok, want.value, wantOK)
+			}
+		case 2:
+			c.Delete(key)
+			delete(m.entries, key)
+		case 3:
+			ok := c.SetNX(key, []byte(value), ttl)
+			_, exists := m.alive(key)
+			if ok == exists {
+				t.Fatalf("op %d: SetNX(%q) = %v with key existing %v", i/3, key, ok, exists)
+			}
+			if ok {
+				m.entries[key] = modelEntry{value: value, expireAt: m.expireAt(ttl)}
+			}
+		case 4:
+			ok := c.Expire(key, ttl)
+			e, exists := m.alive(key)
+			if ok != exists {
+				t.Fatalf("op %d: Expire(%q) = %v, want %v", i/3, key, ok, exists)
+			}
+			if ok {
+				e.expireAt = m.expireAt(ttl)
+				m.entries[key] = e
+			}
+		case 5:
+			d := time.Duration(arg%3) * 700 * time.Millisecond
+			clock.Advance(d)
+			m.now += int64(d)
+		case 6:
+			expired := 0
+			for key := range m.entries {
+				if _, ok := m.alive(key); !ok {
+					delete(m.entries, key)
+					expired++
+				}
+			}
+			if n := c.Gc(); n != expired {
+				t.Fatalf("op %d: Gc = %d, want %d", i/3, n, expired)
+			}
+		case 7:
+			got, ok := c.TTL(key)
+			e, exists := m.alive(key)
+			want := NeverExpire
+			if e.expireAt != 0 {
+				want = time.Duration(e.expireAt - m.now)
+			}
+			if ok != exists || ok && got != want {
+				t.Fatalf("op %d: TTL(%q) = %v, %v, want %v, %v", i/3, key, got, ok, want, exists)
+			}
+		case 8:
+			key, ok := c.RandomKey()
+			if _, alive := m.alive(key); ok && !alive {
+				t.Fatalf("op %d: RandomKey = %q which is not alive", i/3, key)
+			}
+			trace = append(trace, key)
+		}
+
+		// 过期但还没有被 Gc 清理的 key 也计算在 Count 中
+		if count := c.Count(); count != int64(len(m.entries)) {
+			t.Fatalf("op %d: Count = %d, want %d", i/3, count, len(m.entries))
+		}
+
+		// Scan 按照 key 所在的位置返回，排序之后再和模型比较
+		keys, _ := c.Scan(0, "", len(modelKeys))
+		keys = append([]string{}, keys...)
+		sort.Strings(keys)
+		if want := m.aliveKeys(); !reflect.DeepEqual(keys, want) {
+			t.Fatalf("op %d: Scan = %q, want %q", i/3, keys, want)
+		}
+	}
+	return trace
+}
+
+// randomOps 返回 n 个随机的操作
+func randomOps(random *rand.Rand, n int) []byte {
+	ops := make([]byte, 3*n)
+	random.Read(ops)
+	return ops
+}
+
+func TestDeterministicModel(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		ops := randomOps(random, 300)
+		runModel(t, int64(i), ops)
+	}
+}
+
+func TestDeterministicReproducible(t *testing.T) {
+	random := rand.New(rand.NewSource(2))
+	for i := 0; i < 20; i++ {
+		ops := randomOps(random, 300)
+		first := runModel(t, int64(i), ops)
+		second := runModel(t, int64(i), ops)
+		if !reflect.DeepEqual(first, second) {
+			t.Fatalf("seed %d: random results differ between runs:\n%q\n%q", i, first, second)
+		}
+	}
+}
+
+func FuzzDeterministicModel(f *testing.F) {
+	random := rand.New(rand.NewSource(3))
+	for i := 0; i < 8; i++ {
+		f.Add(int64(i), randomOps(random, 50))
+	}
+
+	f.Fuzz(func(t *testing.T, seed int64, ops []byte) {
+		if len(ops) > 3*1000 {
+			ops = ops[:3*1000]
+		}
+
+		first := runModel(t, seed, ops)
+		if second := runModel(t, seed, ops); !reflect.DeepEqual(first, second) {
+			t.Fatalf("random results differ between runs:\n%q\n%q", first, second)
+		}
+	})
+}
@@ -0,0 +1,278 @@
+package caches
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// saveMode 是持久化的方式
+type saveMode int
+
+const (
+	// saveFull 表示全量持久化，不影响增量持久化的记录
+	saveFull saveMode = iota
+
+	// saveBase 表示作为增量持久化基础的全量持久化，会重新开始记录被修改的 key
+	saveBase
+
+	// saveIncremental 表示增量持久化，只持久化上次增量持久化以来被修改过的 key
+	saveIncremental
+)
+
+var (
+	// ErrNoBaseSnapshot 表示还没有可以作为增量持久化基础的全量持久化
+	ErrNoBaseSnapshot = errors.New("caches: incremental snapshot requires a base snapshot")
+
+	// ErrIncrementalSnapshot 表示增量持久化文件不能单独加载，需要使用 LoadFromDir
+	ErrIncrementalSnapshot = errors.New("caches: incremental snapshot can not be loaded alone")
+)
+
+// Save 将缓存中的数据序列化后写入 w
+// 序列化期间 data 被冻结，新的修改写入 overlay，所以持久化不会阻塞读写
+func (c *Cache) Save(w io.Writer) error {
+	return c.save(w, saveFull)
+}
+
+// SaveIncremental 将上次增量持久化以来被修改过的数据写入 w
+// 需要先使用 SaveToDir 进行过一次全量持久化，或者使用 LoadFromDir 恢复过数据
+func (c *Cache) SaveIncremental(w io.Writer) error {
+	return c.save(w, saveIncremental)
+}
+
+// save 使用 mode 指定的方式将缓存中的数据序列化后写入 w
+func (c *Cache) save(w io.Writer, mode saveMode) error {
+	c.saveLock.Lock()
+	defer c.saveLock.Unlock()
+
+	aead, err := newAEAD(c.options.KeyProvider)
+	if err != nil {
+		return err
+	}
+
+	data, changed, createdAt, err := c.freeze(mode)
+	if err != nil {
+		return err
+	}
+	defer c.unfreeze()
+
+	w = c.options.RateLimiter.Writer(w)
+	if mode != saveIncremental {
+		err = writeSnapshot(w, data, nil, createdAt, c.options.Codec, aead)
+	} else {
+		// 修改过的 key 如果还存在就持久化它的值，否则记录为被删除
+		modified := make(map[string]*entry, len(changed))
+		deleted := make([]string, 0)
+		for key := range changed {
+			if value, ok := data[shardOf(key, len(data))][key]; ok {
+				modified[key] = value
+			} else {
+				deleted = append(deleted, key)
+			}
+		}
+		err = writeSnapshot(w, []map[string]*entry{modified}, deleted, createdAt, c.options.Codec, aead)
+	}
+
+	if err != nil && mode != saveFull {
+		c.restoreChanged(changed)
+	}
+	return err
+}
+
+// freeze 冻结每个分片当前的 data 并按照分片的顺序返回，之后的修改都会写入分片的 overlay
+// mode 不是 saveFull 时会重新开始记录被修改的 key，并返回之前记录的 key
+// 同时返回冻结的时间，单位是纳秒，冻结之后的修改都不在返回的 data 中
+func (c *Cache) freeze(mode saveMode) ([]map[string]*entry, map[string]struct{}, int64, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if mode == saveIncremental && c.changed == nil {
+		return nil, nil, 0, ErrNoBaseSnapshot
+	}
+
+	changed := c.changed
+	if mode != saveFull {
+		c.changed = make(map[string]struct{})
+	}
+
+	data := make([]map[string]*entry, len(c.segments))
+	for i, seg := range c.segments {
+		seg.overlay = make(map[string]*entry)
+		data[i] = seg.data
+	}
+	return data, changed, c.now().UnixNano(), nil
+}
+
+// restoreChanged 在持久化失败时恢复之前记录的被修改的 key
+func (c *Cache) restoreChanged(changed map[string]struct{}) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if changed == nil {
+		c.changed = nil
+		return
+	}
+
+	for key := range c.changed {
+		changed[key] = struct{}{}
+	}
+	c.changed = changed
+}
+
+// unfreeze 将持久化期间的修改合并回 data 并解除冻结
+func (c *Cache) unfreeze() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, seg := range c.segments {
+		if len(seg.overlay) > 0 {
+			seg.unshare()
+		}
+		for key, value := range seg.overlay {
+			if value == nil {
+				delete(seg.data, key)
+				continue
+			}
+			seg.data[key] = value
+		}
+		seg.overlay = nil
+	}
+}
+
+// Load 从 r 中读取序列化的数据并替换掉缓存中现有的数据
+// 旧版本写入的持久化文件也可以被读取
+func (c *Cache) Load(r io.Reader) error {
+	aead, err := newAEAD(c.options.KeyProvider)
+	if err != nil {
+		return err
+	}
+
+	snap, err := readSnapshot(r, aead)
+	if err != nil {
+		return err
+	}
+
+	if snap.incremental {
+		return ErrIncrementalSnapshot
+	}
+	c.rebaseExpirations(snap, c.now().UnixNano())
+
+	// 等待正在进行的持久化结束，避免替换掉正在被序列化的数据
+	c.saveLock.Lock()
+	defer c.saveLock.Unlock()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.replaceData(snap.data)
+	c.namespaces.recount(c)
+	c.eviction.recount(c)
+	c.view.rebuild(c)
+	c.changed = nil
+	atomic.StoreInt64(&c.dirty, 0)
+	c.lastSave = time.Now()
+	return nil
+}
+
+// rebaseExpirations 按照 LoadTTLMode 调整 snap 中数据的过期时间，并丢弃在 now 时已经过期的数据
+// 如果 now 早于持久化的时间，说明重启期间时钟被往回调了，这时会把过期时间往前移动同样的时间
+// 这样数据剩余的存活时间不会超过持久化时剩余的存活时间，避免过期的数据在时钟调整之后复活
+func (c *Cache) rebaseExpirations(snap *snapshot, now int64) {
+	// 版本 0 的文件没有记录持久化的时间，只能按照绝对过期时间处理
+	createdAt := snap.header.CreatedAt
+	var shift int64
+	if createdAt > 0 && (c.options.LoadTTLMode == LoadTTLRelative || now < createdAt) {
+		shift = now - createdAt
+	}
+
+	for key, e := range snap.data {
+		if e.expireAt == 0 {
+			continue
+		}
+
+		expireAt := e.expireAt + shift
+		if expireAt <= now {
+			// 增量持久化文件中过期的数据要当作被删除，覆盖掉之前文件中的旧值
+			delete(snap.data, key)
+			if snap.incremental {
+				snap.deleted = append(snap.deleted, key)
+			}
+			continue
+		}
+
+		if shift != 0 {
+			snap.data[key] = &entry{value: e.value, chunks: e.chunks, compression: e.compression, large: e.large, expireAt: expireAt}
+		}
+	}
+}
+
+// SaveToFile 将缓存数据持久化到 path 指定的文件中
+func (c *Cache) SaveToFile(path string) error {
+	return c.saveToFile(path, saveFull)
+}
+
+// saveToFile 使用 mode 指定的方式将缓存数据持久化到 path 指定的文件中
+func (c *Cache) saveToFile(path string, mode saveMode) error {
+	// 记录开始保存时的修改次数，保存期间发生的修改要留给下一次持久化
+	dirty := atomic.LoadInt64(&c.dirty)
+
+	err := writeFileAtomic(path, func(w io.Writer) error {
+		return c.save(w, mode)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	atomic.AddInt64(&c.dirty, -dirty)
+	c.lastSave = time.Now()
+	return nil
+}
+
+// LoadFromFile 从 path 指定的文件中恢复缓存数据
+func (c *Cache) LoadFromFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return c.Load(file)
+}
+
+// Dirty 返回自上次持久化以来数据被修改的次数
+func (c *Cache) Dirty() int64 {
+	return atomic.LoadInt64(&c.dirty)
+}
+
+// LastSave 返回上次成功持久化的时间
+func (c *Cache) LastSave() time.Time {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.lastSave
+}
+
+// writeFileAtomic 将 write 写入的内容保存到 path 指定的文件中
+// 先写到临时文件再重命名，避免写到一半时程序崩溃导致原来的文件也损坏
+func writeFileAtomic(path string, write func(w io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err = write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,143 @@
+package caches
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ErrWrongKey 表示解密持久化文件时使用的密钥不正确
+var ErrWrongKey = errors.New("caches: wrong encryption key")
+
+// keyCheck 是加密后写到持久化文件中的固定内容，用来在读取数据之前检查密钥是否正确
+var keyCheck = []byte("gocache key check")
+
+// KeyProvider 提供加密持久化文件使用的 AES 密钥
+// 密钥长度必须是 16、24 或 32 个字节，分别对应 AES-128、AES-192 和 AES-256
+type KeyProvider interface {
+	// Key 返回密钥
+	Key() ([]byte, error)
+}
+
+// StaticKey 是直接写在配置中的密钥
+type StaticKey []byte
+
+// Key 返回密钥
+func (sk StaticKey) Key() ([]byte, error) {
+	return sk, nil
+}
+
+// EnvKey 从名字为 EnvKey 的环境变量中读取密钥，环境变量的值可以是 hex 或者 base64 编码
+type EnvKey string
+
+// Key 返回密钥
+func (ek EnvKey) Key() ([]byte, error) {
+	value, ok := os.LookupEnv(string(ek))
+	if !ok {
+		return nil, fmt.Errorf("caches: environment variable %s is not set", string(ek))
+	}
+	return decodeKey(value)
+}
+
+// FileKey 从路径为 FileKey 的文件中读取密钥，文件内容可以是 hex 或者 base64 编码
+type FileKey string
+
+// Key 返回密钥
+func (fk FileKey) Key() ([]byte, error) {
+	content, err := os.ReadFile(string(fk))
+	if err != nil {
+		return nil, err
+	}
+	return decodeKey(string(content))
+}
+
+// SecretKey 从密钥管理系统中读取密钥，比如 Vault，读取到的内容可以是 hex 或者 base64 编码
+type SecretKey func() ([]byte, error)
+
+// Key 返回密钥
+func (sk SecretKey) Key() ([]byte, error) {
+	secret, err := sk()
+	if err != nil {
+		return nil, err
+	}
+	return decodeKey(string(secret))
+}
+
+// KMS 是密钥管理服务的接口，比如云厂商提供的 KMS
+// 密钥管理服务负责解密被它加密过的数据密钥
+type KMS interface {
+	// Decrypt 解密 ciphertext 并返回明文
+	Decrypt(ctx context.Context, ciphertext []byte) ([]byte, error)
+}
+
+// KMSKey 使用信封加密的方式提供密钥，EncryptedKey 是被 KMS 加密过的数据密钥
+type KMSKey struct {
+	KMS          KMS
+	EncryptedKey []byte
+}
+
+// Key 返回密钥
+func (kk KMSKey) Key() ([]byte, error) {
+	return kk.KMS.Decrypt(context.Background(), kk.EncryptedKey)
+}
+
+// decodeKey 解码 hex 或者 base64 编码的密钥
+func decodeKey(value string) ([]byte, error) {
+	value = strings.TrimSpace(value)
+	if key, err := hex.DecodeString(value); err == nil {
+		return key, nil
+	}
+
+	if key, err := base64.StdEncoding.DecodeString(value); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("caches: encryption key must be hex or base64 encoded")
+}
+
+// newAEAD 根据 provider 提供的密钥创建 AES-GCM 加密器，provider 为 nil 时返回 nil
+func newAEAD(provider KeyProvider) (cipher.AEAD, error) {
+	if provider == nil {
+		return nil, nil
+	}
+
+	key, err := provider.Key()
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal 加密 plaintext，返回的结果为随机生成的 nonce + 密文
+func seal(aead cipher.AEAD, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// open 解密 seal 返回的结果
+func open(aead cipher.AEAD, ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, ErrWrongKey
+	}
+
+	plaintext, err := aead.Open(nil, ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrWrongKey
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,74 @@
+package caches
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// NeverExpire 表示永不过期
+const NeverExpire time.Duration = 0
+
+// accessResolution 是记录读取时间的精度
+const accessResolution = time.Second
+
+// entry 是缓存中的一个数据
+// entry 保存到缓存之后就不能再修改了，需要修改时创建一个新的 entry 替换掉旧的
+// 这样持久化时可以不加锁地读取被冻结的 entry
+type entry struct {
+	// value 是数据的值，分块保存时为 nil
+	value []byte
+
+	// chunks 是分块保存的 value 的第一块，只有通过 SetFrom 写入的超过 ChunkSize 的 value 才分块保存
+	chunks *chunk
+
+	// expireAt 是过期时间，单位是纳秒，为 0 表示永不过期
+	expireAt int64
+
+	// version 是写入时分配的版本号，同一个 key 每次写入都会变大，从持久化文件中加载的 entry 为 0
+	version uint64
+
+	// priority 是淘汰时的优先级，超出限制时先淘汰优先级低的 key，持久化不会保存它
+	priority Priority
+
+	// compression 是 value 的压缩算法，压缩过的 value 在返回给调用者和持久化之前需要先解压
+	compression Compression
+
+	// large 表示 value 是 setLarge 写入的大对象的清单，从持久化文件中恢复时根据 value 标记，见 markLarge
+	large bool
+
+	// checksum 是开启 Checksums 时 value 的 CRC32，保存时计算，Verify 用它检查 value 在内存中是否损坏
+	checksum uint32
+
+	// accessedAt 是最后一次写入或者读取的时间，单位是纳秒，为 0 表示加载之后还没有被访问过
+	// 这是唯一可以在保存之后修改的字段，需要原子地读写，持久化不会用到它
+	accessedAt int64
+}
+
+// newEntry 返回一个按照缓存的时钟 ttl 之后过期的 entry，ttl 为 NeverExpire 表示永不过期
+func (c *Cache) newEntry(value []byte, ttl time.Duration) *entry {
+	e := &entry{value: value}
+	if ttl > NeverExpire {
+		e.expireAt = c.now().Add(ttl).UnixNano()
+	}
+	return e
+}
+
+// alive 返回 entry 在 now 时是否还没有过期
+func (e *entry) alive(now int64) bool {
+	return e.expireAt == 0 || now < e.expireAt
+}
+
+// access 记录 entry 在 now 时被读取了，精度是 accessResolution，避免每次读取都写入同一个缓存行
+func (e *entry) access(now int64) {
+	if now-atomic.LoadInt64(&e.accessedAt) >= int64(accessResolution) {
+		atomic.StoreInt64(&e.accessedAt, now)
+	}
+}
+
+// ttl 返回 entry 在 now 时剩余的存活时间，永不过期时返回 NeverExpire
+func (e *entry) ttl(now int64) time.Duration {
+	if e.expireAt == 0 {
+		return NeverExpire
+	}
+	return time.Duration(e.expireAt - now)
+}
@@ -0,0 +1,192 @@
+package caches
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// 键空间事件的类型
+const (
+	// EventSet 表示 key 被写入了
+	EventSet = "set"
+
+	// EventDelete 表示 key 被删除了
+	EventDelete = "delete"
+
+	// EventExpire 表示过期的 key 被清理了，过期之后直到被 Gc 清理才会发出
+	EventExpire = "expire"
+
+	// EventEvict 表示 key 因为超出 MaxEntries 或者 MaxBytes 被淘汰了
+	EventEvict = "evict"
+)
+
+// Event 是一个键空间事件，用于让下游在 key 变化或者消失时失效自己的缓存
+type Event struct {
+	Type string `json:"type"`
+	Key  string `json:"key"`
+
+	// Time 是事件发生的时间，单位是纳秒
+	Time int64 `json:"time"`
+}
+
+// EventSubscription 是对键空间事件的订阅
+type EventSubscription struct {
+	// events 是订阅之后的事件，订阅者跟不上事件的速度时会被关闭
+	events chan Event
+}
+
+// Events 返回订阅之后的事件，通道被关闭说明订阅已经失效，中间可能丢失了事件
+func (s *EventSubscription) Events() <-chan Event {
+	return s.events
+}
+
+// EventCallback 是 key 被淘汰或者过期清理时调用的函数，value 是 key 被移除之前的值，不能修改
+type EventCallback func(key string, value []byte)
+
+// callback 是等待调用的回调
+type callback struct {
+	fn  EventCallback
+	key string
+
+	// e 是 key 被移除之前的 entry，value 可能是压缩过的，调用回调之前再解压，不占用修改缓存的协程
+	e *entry
+}
+
+// events 是缓存的键空间事件的订阅者和回调
+type events struct {
+	// count 是订阅者和回调的个数，需要原子地读取，没有订阅者和回调时修改操作不需要加锁
+	count int32
+
+	lock      sync.Mutex
+	subs      map[*EventSubscription]struct{}
+	onEvicted []EventCallback
+	onExpired []EventCallback
+
+	// pending 是还没有调用的回调，wake 用于唤醒调用回调的协程，第一次注册回调时才会创建
+	pending []callback
+	wake    chan struct{}
+}
+
+// active 返回是否有订阅者或者回调
+func (es *events) active() bool {
+	return atomic.LoadInt32(&es.count) > 0
+}
+
+// recountLocked 重新计算订阅者和回调的个数，调用者需要持有 es.lock
+func (es *events) recountLocked() {
+	atomic.StoreInt32(&es.count, int32(len(es.subs)+len(es.onEvicted)+len(es.onExpired)))
+}
+
+// removeLocked 移除订阅者并关闭它的通道，已经被移除时什么都不做，调用者需要持有 es.lock
+func (es *events) removeLocked(sub *EventSubscription) {
+	if _, ok := es.subs[sub]; ok {
+		delete(es.subs, sub)
+		close(sub.events)
+		es.recountLocked()
+	}
+}
+
+// register 添加 key 被淘汰或者过期清理时调用的回调，第一次注册时启动调用回调的协程
+func (es *events) register(eventType string, fn EventCallback) {
+	es.lock.Lock()
+	defer es.lock.Unlock()
+	if eventType == EventEvict {
+		es.onEvicted = append(es.onEvicted, fn)
+	} else {
+		es.onExpired = append(es.onExpired, fn)
+	}
+	es.recountLocked()
+
+	if es.wake == nil {
+		es.wake = make(chan struct{}, 1)
+		go es.dispatch()
+	}
+}
+
+// publish 把事件发送给所有订阅者，并让淘汰和过期清理的回调在另一个协程中调用
+// 缓冲区已经满了的订阅者会被移除，不会阻塞修改缓存的协程
+func (es *events) publish(event Event, e *entry) {
+	es.lock.Lock()
+	defer es.lock.Unlock()
+	for sub := range es.subs {
+		select {
+		case sub.events <- event:
+		default:
+			es.removeLocked(sub)
+		}
+	}
+
+	fns := es.onExpired
+	if event.Type == EventEvict {
+		fns = es.onEvicted
+	} else if event.Type != EventExpire {
+		return
+	}
+
+	for _, fn := range fns {
+		es.pending = append(es.pending, callback{fn: fn, key: event.Key, e: e})
+	}
+
+	if len(fns) > 0 {
+		select {
+		case es.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// dispatch 按照事件发生的顺序调用回调，回调中可以读写缓存，调用期间不会持有缓存的锁
+func (es *events) dispatch() {
+	for range es.wake {
+		es.lock.Lock()
+		pending := es.pending
+		es.pending = nil
+		es.lock.Unlock()
+
+		for _, cb := range pending {
+			value, _ := cb.e.data()
+			cb.fn(cb.key, value)
+		}
+	}
+}
+
+// notify 发出 key 的事件，e 是回调需要的 key 被移除之前的 entry，内部 key 不发出事件
+func (c *Cache) notify(eventType string, key string, e *entry) {
+	if c.events.active() && !IsInternalKey(key) {
+		c.events.publish(Event{Type: eventType, Key: key, Time: c.now().UnixNano()}, e)
+	}
+}
+
+// OnEvicted 注册 key 因为超出 MaxEntries 或者 MaxBytes 被淘汰时调用的函数
+// 回调在单独的协程中按照淘汰的顺序调用，不会阻塞写入，回调中也可以读写缓存
+func (c *Cache) OnEvicted(fn EventCallback) {
+	c.events.register(EventEvict, fn)
+}
+
+// OnExpired 注册过期的 key 被 Gc 清理时调用的函数，只是过期但还没有被清理的 key 不会调用
+// 回调在单独的协程中按照清理的顺序调用，不会阻塞清理，回调中也可以读写缓存
+func (c *Cache) OnExpired(fn EventCallback) {
+	c.events.register(EventExpire, fn)
+}
+
+// SubscribeEvents 订阅键空间事件，之后的写入、删除、过期清理和淘汰都会发送到订阅的通道中
+// buffer 是通道的缓冲区大小，订阅者跟不上事件的速度导致缓冲区写满时订阅会被关闭，数据被整体替换时不会发出事件
+func (c *Cache) SubscribeEvents(buffer int) *EventSubscription {
+	sub := &EventSubscription{events: make(chan Event, buffer)}
+
+	c.events.lock.Lock()
+	defer c.events.lock.Unlock()
+	if c.events.subs == nil {
+		c.events.subs = make(map[*EventSubscription]struct{})
+	}
+	c.events.subs[sub] = struct{}{}
+	c.events.recountLocked()
+	return sub
+}
+
+// UnsubscribeEvents 取消对键空间事件的订阅，订阅的通道会被关闭
+func (c *Cache) UnsubscribeEvents(sub *EventSubscription) {
+	c.events.lock.Lock()
+	defer c.events.lock.Unlock()
+	c.events.removeLocked(sub)
+}
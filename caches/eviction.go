@@ -0,0 +1,412 @@
+package caches
+
+import (
+	"container/heap"
+	"container/list"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// EvictionPolicy 决定缓存超出 MaxEntries 或者 MaxBytes 时先淘汰哪些 key
+// 缓存会串行地调用这些方法，实现不需要考虑并发
+type EvictionPolicy interface {
+	// Add 记录 key 被写入了，key 可能已经存在
+	Add(key string)
+
+	// Access 记录 key 被读取了
+	Access(key string)
+
+	// Remove 记录 key 被删除了
+	Remove(key string)
+
+	// Victim 返回下一个应该被淘汰的 key，不会移除它，没有 key 时返回 false
+	// 返回的 key 可能已经不在缓存中了，这时缓存会调用 Remove 之后再次调用 Victim
+	Victim() (string, bool)
+}
+
+// EvictionPolicyByName 返回名为 name 的淘汰策略，可选值为 lru、lfu 和 fifo
+func EvictionPolicyByName(name string) (EvictionPolicy, error) {
+	switch name {
+	case "lru":
+		return NewLRU(), nil
+	case "lfu":
+		return NewLFU(), nil
+	case "fifo":
+		return NewFIFO(), nil
+	}
+	return nil, fmt.Errorf("caches: unknown eviction policy %q", name)
+}
+
+// evictor 在缓存超出限制时按照淘汰策略删除 key，为 nil 表示不限制
+type evictor struct {
+	// policies 是每个优先级的淘汰策略，下标是 Priority.index()
+	// PriorityNormal 使用配置的淘汰策略，其他优先级在第一次用到时创建同一种策略，自定义的策略使用 LRU
+	policies   [priorityLevels]EvictionPolicy
+	maxEntries int64
+	maxBytes   int64
+
+	// priorities 记录了不是 PriorityNormal 的 key 的优先级，用来找到 key 所在的淘汰策略
+	priorities map[string]Priority
+
+	// bytes 是所有 key 和 value 占用的总字节数，需要原子地读写
+	bytes int64
+
+	// lock 保护 policies 和 priorities，Get 只持有缓存的读锁或者不加锁，需要另外加锁
+	lock sync.Mutex
+}
+
+// newEvictor 返回使用 policy 的 evictor，maxEntries 和 maxBytes 都为 0 时返回 nil，policy 为 nil 时使用 LRU
+func newEvictor(policy EvictionPolicy, maxEntries int64, maxBytes int64) *evictor {
+	if maxEntries <= 0 && maxBytes <= 0 {
+		return nil
+	}
+
+	if policy == nil {
+		policy = NewLRU()
+	}
+
+	ev := &evictor{maxEntries: maxEntries, maxBytes: maxBytes, priorities: make(map[string]Priority)}
+	ev.policies[PriorityNormal.index()] = policy
+	return ev
+}
+
+// policyOf 返回 key 所在的淘汰策略，调用者需要持有 ev.lock
+func (ev *evictor) policyOf(key string) EvictionPolicy {
+	return ev.policies[ev.priorities[key].index()]
+}
+
+// add 记录 key 以 priority 写入了，优先级变化时把 key 移到新的淘汰策略中，调用者需要持有 ev.lock
+func (ev *evictor) add(key string, priority Priority) {
+	if old := ev.priorities[key]; old.index() != priority.index() {
+		ev.remove(key)
+	}
+
+	i := priority.index()
+	if ev.policies[i] == nil {
+		ev.policies[i] = newPolicyLike(ev.policies[PriorityNormal.index()])
+	}
+
+	if i != PriorityNormal.index() {
+		ev.priorities[key] = priority
+	}
+	ev.policies[i].Add(key)
+}
+
+// remove 让 key 所在的淘汰策略忘记它，调用者需要持有 ev.lock
+func (ev *evictor) remove(key string) {
+	ev.policyOf(key).Remove(key)
+	delete(ev.priorities, key)
+}
+
+// account 记录 key 从 old 修改为 new，old 为 nil 表示新增，new 为 nil 表示删除，调用者需要持有 key 所在分片的写锁
+// 内部 key 只计入占用的字节数，不会加到淘汰策略中，大对象的分片和清单一起淘汰，预留在过期之后由 Gc 清理
+func (ev *evictor) account(key string, old *entry, new *entry) {
+	if ev == nil {
+		return
+	}
+
+	_, bytes := usageDelta(key, old, new)
+	atomic.AddInt64(&ev.bytes, bytes)
+	if IsInternalKey(key) {
+		return
+	}
+
+	ev.lock.Lock()
+	defer ev.lock.Unlock()
+	if new == nil {
+		ev.remove(key)
+	} else {
+		ev.add(key, new.priority)
+	}
+}
+
+// access 记录 key 被读取了
+func (ev *evictor) access(key string) {
+	if ev == nil {
+		return
+	}
+
+	ev.lock.Lock()
+	defer ev.lock.Unlock()
+	ev.policyOf(key).Access(key)
+}
+
+// victim 返回下一个应该被淘汰的 key，优先从优先级低的淘汰策略中选择
+func (ev *evictor) victim() (string, bool) {
+	ev.lock.Lock()
+	defer ev.lock.Unlock()
+	for _, policy := range ev.policies {
+		if policy == nil {
+			continue
+		}
+
+		if key, ok := policy.Victim(); ok {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// forget 让淘汰策略忘记已经不在缓存中的 key
+func (ev *evictor) forget(key string) {
+	ev.lock.Lock()
+	defer ev.lock.Unlock()
+	ev.remove(key)
+}
+
+// full 返回再增加一个占用 size 字节的 key 之后缓存是否会超出限制
+func (ev *evictor) full(c *Cache, size int64) bool {
+	return ev.maxEntries > 0 && c.Count() >= ev.maxEntries || ev.maxBytes > 0 && atomic.LoadInt64(&ev.bytes)+size > ev.maxBytes
+}
+
+// over 返回缓存是否超出了限制
+func (ev *evictor) over(c *Cache) bool {
+	return ev.maxEntries > 0 && c.Count() > ev.maxEntries || ev.maxBytes > 0 && atomic.LoadInt64(&ev.bytes) > ev.maxBytes
+}
+
+// evict 淘汰 key 直到缓存不再超出限制，调用者需要持有写锁或者读锁，但是不能持有分片的锁
+// 淘汰每个 key 时会获取它所在分片的锁，这样只持有读锁的多个写入同时淘汰也是安全的
+func (ev *evictor) evict(c *Cache) {
+	if ev == nil {
+		return
+	}
+
+	for ev.over(c) {
+		key, ok := ev.victim()
+		if !ok {
+			return
+		}
+
+		seg := c.segmentOf(key)
+		seg.lock.Lock()
+		parts := ev.evictKey(c, key)
+		seg.lock.Unlock()
+
+		// 分片可能在其他分片中，释放清单所在分片的锁之后再淘汰
+		for _, part := range parts {
+			seg := c.segmentOf(part)
+			seg.lock.Lock()
+			ev.evictKey(c, part)
+			seg.lock.Unlock()
+		}
+	}
+}
+
+// evictKey 淘汰 key，key 已经不在缓存中时让淘汰策略忘记它，调用者需要持有 key 所在分片的写锁
+// key 是大对象的清单时返回它的分片，调用者需要接着淘汰它们，否则它们会一直占用空间直到 Gc 清理孤立的分片
+func (ev *evictor) evictKey(c *Cache, key string) []string {
+	old, ok := c.lookup(key)
+	if !ok {
+		ev.forget(key)
+		return nil
+	}
+
+	c.countKey(key, -1)
+	c.remove(key)
+	c.account(key, old, nil)
+	c.namespaces.account(key, old, nil)
+	ev.account(key, old, nil)
+	c.touch(key)
+	c.notify(EventEvict, key, old)
+	if IsInternalKey(key) {
+		return nil
+	}
+
+	atomic.AddInt64(&c.counters.evictions, 1)
+	if c.options.LargeObjectThreshold > 0 {
+		return c.partsOf(key, old)
+	}
+	return nil
+}
+
+// recount 遍历缓存重新计算占用的字节数，并把所有的 key 加到淘汰策略中，用于整体替换数据之后，调用者需要持有写锁
+// 淘汰策略中已经不在缓存中的 key 会在被选中淘汰时忘记
+func (ev *evictor) recount(c *Cache) {
+	if ev == nil {
+		return
+	}
+
+	var bytes int64
+	ev.lock.Lock()
+	c.forEach(func(key string, e *entry) bool {
+		bytes += int64(len(key) + e.size())
+		if !IsInternalKey(key) {
+			ev.add(key, e.priority)
+		}
+		return true
+	})
+	ev.lock.Unlock()
+	atomic.StoreInt64(&ev.bytes, bytes)
+	ev.evict(c)
+}
+
+// newPolicyLike 返回和 policy 同一种的空的淘汰策略，用于其他优先级，自定义的策略返回 LRU
+func newPolicyLike(policy EvictionPolicy) EvictionPolicy {
+	switch policy.(type) {
+	case *lfu:
+		return NewLFU()
+	case *fifo:
+		return NewFIFO()
+	}
+	return NewLRU()
+}
+
+// lru 淘汰最久没有被读写的 key
+type lru struct {
+	order *list.List
+	items map[string]*list.Element
+}
+
+// NewLRU 返回淘汰最久没有被读写的 key 的策略
+func NewLRU() EvictionPolicy {
+	return &lru{order: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (l *lru) Add(key string) {
+	if element, ok := l.items[key]; ok {
+		l.order.MoveToFront(element)
+		return
+	}
+	l.items[key] = l.order.PushFront(key)
+}
+
+func (l *lru) Access(key string) {
+	if element, ok := l.items[key]; ok {
+		l.order.MoveToFront(element)
+	}
+}
+
+func (l *lru) Remove(key string) {
+	if element, ok := l.items[key]; ok {
+		l.order.Remove(element)
+		delete(l.items, key)
+	}
+}
+
+func (l *lru) Victim() (string, bool) {
+	if element := l.order.Back(); element != nil {
+		return element.Value.(string), true
+	}
+	return "", false
+}
+
+// fifo 淘汰最早写入的 key，更新已经存在的 key 不会改变它的顺序
+type fifo struct {
+	order *list.List
+	items map[string]*list.Element
+}
+
+// NewFIFO 返回淘汰最早写入的 key 的策略
+func NewFIFO() EvictionPolicy {
+	return &fifo{order: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (f *fifo) Add(key string) {
+	if _, ok := f.items[key]; !ok {
+		f.items[key] = f.order.PushBack(key)
+	}
+}
+
+func (f *fifo) Access(key string) {}
+
+func (f *fifo) Remove(key string) {
+	if element, ok := f.items[key]; ok {
+		f.order.Remove(element)
+		delete(f.items, key)
+	}
+}
+
+func (f *fifo) Victim() (string, bool) {
+	if element := f.order.Front(); element != nil {
+		return element.Value.(string), true
+	}
+	return "", false
+}
+
+// lfuItem 是 lfu 中的一个 key
+type lfuItem struct {
+	key   string
+	count int64
+
+	// seq 是最后一次读写的序号，次数相同时先淘汰更久没有读写的 key
+	seq   uint64
+	index int
+}
+
+// lfuHeap 是按照读写次数排列的最小堆
+type lfuHeap []*lfuItem
+
+func (h lfuHeap) Len() int { return len(h) }
+
+func (h lfuHeap) Less(i, j int) bool {
+	if h[i].count != h[j].count {
+		return h[i].count < h[j].count
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h lfuHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+
+func (h *lfuHeap) Push(x interface{}) {
+	item := x.(*lfuItem)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *lfuHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// lfu 淘汰读写次数最少的 key
+type lfu struct {
+	heap  lfuHeap
+	items map[string]*lfuItem
+	seq   uint64
+}
+
+// NewLFU 返回淘汰读写次数最少的 key 的策略，次数相同时淘汰更久没有读写的 key
+func NewLFU() EvictionPolicy {
+	return &lfu{items: make(map[string]*lfuItem)}
+}
+
+func (l *lfu) Add(key string) {
+	if _, ok := l.items[key]; ok {
+		l.Access(key)
+		return
+	}
+
+	l.seq++
+	item := &lfuItem{key: key, count: 1, seq: l.seq}
+	l.items[key] = item
+	heap.Push(&l.heap, item)
+}
+
+func (l *lfu) Access(key string) {
+	if item, ok := l.items[key]; ok {
+		l.seq++
+		item.count++
+		item.seq = l.seq
+		heap.Fix(&l.heap, item.index)
+	}
+}
+
+func (l *lfu) Remove(key string) {
+	if item, ok := l.items[key]; ok {
+		heap.Remove(&l.heap, item.index)
+		delete(l.items, key)
+	}
+}
+
+func (l *lfu) Victim() (string, bool) {
+	if len(l.heap) == 0 {
+		return "", false
+	}
+	return l.heap[0].key, true
+}
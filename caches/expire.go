@@ -0,0 +1,84 @@
+package caches
+
+import (
+	"gocache/utils"
+	"sync/atomic"
+	"time"
+)
+
+// Expire 将 key 的存活时间修改为 ttl，ttl 为 NeverExpire 表示永不过期，key 不存在或者已经过期时返回 false
+// 只修改过期时间，value 和版本号都不变
+func (c *Cache) Expire(key string, ttl time.Duration) bool {
+	return c.ExpireMulti(map[string]time.Duration{key: ttl}) == 1
+}
+
+// ExpireMulti 和 Expire 一样修改 ttls 中每个 key 的存活时间，返回修改了的 key 的个数
+// 所有的 key 都在一次加锁中修改，预热和迁移时批量设置过期时间比逐个调用 Expire 快得多
+func (c *Cache) ExpireMulti(ttls map[string]time.Duration) int {
+	now := c.now()
+	expireAts := make(map[string]int64, len(ttls))
+	for key, ttl := range ttls {
+		expireAts[key] = 0
+		if ttl > NeverExpire {
+			expireAts[key] = now.Add(ttl).UnixNano()
+		}
+	}
+	return c.expireAt(expireAts)
+}
+
+// ExpireAt 将 key 的过期时间修改为 at，用于让过期时间对齐到每天结束这样的外部时间点
+// at 为零值表示永不过期，at 已经过去时 key 会立即过期，key 不存在或者已经过期时返回 false
+func (c *Cache) ExpireAt(key string, at time.Time) bool {
+	return c.ExpireAtMulti(map[string]time.Time{key: at}) == 1
+}
+
+// ExpireAtMulti 和 ExpireAt 一样修改 times 中每个 key 的过期时间，返回修改了的 key 的个数，所有的 key 都在一次加锁中修改
+func (c *Cache) ExpireAtMulti(times map[string]time.Time) int {
+	expireAts := make(map[string]int64, len(times))
+	for key, at := range times {
+		expireAts[key] = expireAtOf(at)
+	}
+	return c.expireAt(expireAts)
+}
+
+// SetWithExpireAt 保存 key 和 value 到缓存中，在 at 时过期，at 为零值表示永不过期
+func (c *Cache) SetWithExpireAt(key string, value []byte, at time.Time) {
+	c.set(key, &entry{value: utils.Copy(value), expireAt: expireAtOf(at)}, false)
+}
+
+// expireAtOf 返回 at 对应的 entry 过期时间，零值表示永不过期
+func expireAtOf(at time.Time) int64 {
+	if at.IsZero() {
+		return 0
+	}
+
+	// 0 表示永不过期，正好是 1970 年的时间点已经过去了，往后挪一纳秒也是过期的
+	if expireAt := at.UnixNano(); expireAt != 0 {
+		return expireAt
+	}
+	return 1
+}
+
+// expireAt 将 expireAts 中每个 key 的过期时间修改为对应的值，单位是纳秒，为 0 表示永不过期，返回修改了的 key 的个数
+// 只修改过期时间，value 和版本号都不变
+func (c *Cache) expireAt(expireAts map[string]int64) int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := c.now().UnixNano()
+	updated := 0
+	for key, expireAt := range expireAts {
+		old, ok := c.lookup(key)
+		if !ok || !old.alive(now) {
+			continue
+		}
+
+		e := &entry{value: old.value, chunks: old.chunks, compression: old.compression, large: old.large, expireAt: expireAt, version: old.version, priority: old.priority, accessedAt: atomic.LoadInt64(&old.accessedAt)}
+
+		// 字节数没有变化，不需要重新计算用量，也不算作一次写入
+		c.store(key, e)
+		c.touch(key)
+		updated++
+	}
+	return updated
+}
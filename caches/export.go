@@ -0,0 +1,137 @@
+package caches
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// 下面是导出时 value 的编码方式
+	encodingUTF8   = "utf8"
+	encodingBase64 = "base64"
+)
+
+// Record 是导出为 NDJSON 时每一行的内容
+type Record struct {
+	// Key 是键
+	Key string `json:"key"`
+
+	// Value 是值，Encoding 为 base64 时需要先解码
+	Value string `json:"value"`
+
+	// Encoding 是 Value 的编码方式，值是合法的 UTF-8 字符串时为 utf8，否则为 base64
+	Encoding string `json:"encoding"`
+
+	// ExpireAt 是过期时间，为空表示永不过期
+	ExpireAt *time.Time `json:"expire_at,omitempty"`
+
+	// TTL 是导出时剩余的存活时间，单位是毫秒，只用于查看，导入时使用 ExpireAt
+	TTL int64 `json:"ttl_ms,omitempty"`
+}
+
+// Entries 返回缓存中所有没有过期的数据，不包括内部 key，大对象返回拼接所有分片之后的 value
+// 只在收集 entry 时持有读锁，返回的数据是调用时的状态，之后的修改不会影响返回的数据
+func (c *Cache) Entries() []Entry {
+	c.lock.RLock()
+	now := c.now().UnixNano()
+	count := atomic.LoadInt64(&c.count)
+	keys := make([]string, 0, count)
+	items := make([]*entry, 0, count)
+	c.forEach(func(key string, e *entry) bool {
+		if e.alive(now) && !IsInternalKey(key) {
+			keys = append(keys, key)
+			items = append(items, e)
+		}
+		return true
+	})
+	c.lock.RUnlock()
+
+	entries := make([]Entry, 0, len(keys))
+	for i, key := range keys {
+		// 收集之后大对象可能被覆盖或者删除了，缺少分片时跳过
+		if value, err := c.valueOf(key, items[i]); err == nil {
+			entries = append(entries, Entry{Key: key, Value: value, ExpireAt: items[i].expireAt})
+		}
+	}
+	return entries
+}
+
+// ExportNDJSON 将缓存中的数据以 NDJSON 格式写入 w，每一行是一个 Record
+// 导出的是调用时的快照，见 Snapshot，内部 key 不会被导出，大对象导出为拼接所有分片之后的 value
+func (c *Cache) ExportNDJSON(w io.Writer) (int, error) {
+	writer := bufio.NewWriter(w)
+	encoder := json.NewEncoder(writer)
+	now := c.now()
+	entries := c.Snapshot().Entries()
+	for _, entry := range entries {
+		record := Record{Key: entry.Key, Value: string(entry.Value), Encoding: encodingUTF8}
+		if !utf8.Valid(entry.Value) {
+			record.Value = base64.StdEncoding.EncodeToString(entry.Value)
+			record.Encoding = encodingBase64
+		}
+
+		if entry.ExpireAt != 0 {
+			expireAt := time.Unix(0, entry.ExpireAt).UTC()
+			record.ExpireAt = &expireAt
+			record.TTL = expireAt.Sub(now).Milliseconds()
+		}
+
+		if err := encoder.Encode(&record); err != nil {
+			return 0, err
+		}
+	}
+	return len(entries), writer.Flush()
+}
+
+// ImportNDJSON 从 r 中读取 NDJSON 格式的数据并保存到缓存中，返回导入的个数
+// 已经过期的数据不会被导入，遇到错误时停止导入，已经导入的数据不会回滚，记录的 key 是内部 key 时返回 ErrInternalKey
+func (c *Cache) ImportNDJSON(r io.Reader) (int, error) {
+	decoder := json.NewDecoder(r)
+	imported := 0
+	for line := 1; ; line++ {
+		var record Record
+		err := decoder.Decode(&record)
+		if err == io.EOF {
+			return imported, nil
+		}
+
+		if err != nil {
+			return imported, fmt.Errorf("caches: record %d: %w", line, err)
+		}
+
+		value := []byte(record.Value)
+		switch record.Encoding {
+		case encodingUTF8, "":
+		case encodingBase64:
+			if value, err = base64.StdEncoding.DecodeString(record.Value); err != nil {
+				return imported, fmt.Errorf("caches: record %d: %w", line, err)
+			}
+		default:
+			return imported, fmt.Errorf("caches: record %d: unknown encoding %q", line, record.Encoding)
+		}
+
+		ttl := NeverExpire
+		if record.ExpireAt != nil {
+			if ttl = record.ExpireAt.Sub(c.now()); ttl <= 0 {
+				continue
+			}
+		}
+
+		if err = CheckKey(record.Key); err == nil {
+			err = checkValue(&entry{value: value})
+		}
+
+		if err != nil {
+			return imported, fmt.Errorf("caches: record %d: %w", line, err)
+		}
+
+		c.SetWithTTL(record.Key, value, ttl)
+		imported++
+	}
+}
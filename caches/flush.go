@@ -0,0 +1,155 @@
+package caches
+
+import (
+	"runtime"
+	"strings"
+	"sync/atomic"
+)
+
+// defaultFlushBatch 是 FlushPrefixAsync 的 batch 不大于 0 时每批删除的 key 的个数
+const defaultFlushBatch = 1000
+
+// FlushProgress 是异步删除的进度
+type FlushProgress struct {
+	// Prefix 是删除的 key 的前缀
+	Prefix string `json:"prefix"`
+
+	// Deleted 是已经删除的 key 的个数，包括已经过期但还没有被清理的
+	Deleted int64 `json:"deleted"`
+
+	// Segments 是需要遍历的分片数，SegmentsDone 是已经遍历完的分片数
+	Segments     int64 `json:"segments"`
+	SegmentsDone int64 `json:"segments_done"`
+
+	// Done 表示删除已经结束，Canceled 表示删除是被 Cancel 中止的
+	Done     bool `json:"done"`
+	Canceled bool `json:"canceled"`
+}
+
+// FlushTask 是 FlushPrefixAsync 开始的在后台进行的删除，可以被多个协程同时使用
+type FlushTask struct {
+	prefix   string
+	segments int64
+
+	// deleted 和 segmentsDone 是删除的进度，需要原子地读写
+	deleted      int64
+	segmentsDone int64
+
+	// canceled 为 1 表示需要中止删除，需要原子地读写
+	canceled int32
+
+	// done 在删除结束之后关闭
+	done chan struct{}
+}
+
+// Progress 返回删除的进度
+func (t *FlushTask) Progress() FlushProgress {
+	progress := FlushProgress{
+		Prefix:       t.prefix,
+		Deleted:      atomic.LoadInt64(&t.deleted),
+		Segments:     t.segments,
+		SegmentsDone: atomic.LoadInt64(&t.segmentsDone),
+		Canceled:     atomic.LoadInt32(&t.canceled) == 1,
+	}
+
+	select {
+	case <-t.done:
+		progress.Done = true
+	default:
+	}
+	return progress
+}
+
+// Done 返回删除结束之后会被关闭的通道
+func (t *FlushTask) Done() <-chan struct{} {
+	return t.done
+}
+
+// Wait 等待删除结束并返回最终的进度
+func (t *FlushTask) Wait() FlushProgress {
+	<-t.done
+	return t.Progress()
+}
+
+// Cancel 中止删除，正在删除的一批 key 删除完之后停止，已经删除的 key 不会恢复
+func (t *FlushTask) Cancel() {
+	atomic.StoreInt32(&t.canceled, 1)
+}
+
+// FlushPrefixAsync 在后台删除所有以 prefix 开头的 key，返回可以查看进度的 FlushTask，prefix 为空时删除所有的 key
+// 逐个分片遍历，每批最多删除 batch 个 key，只持有 key 所在分片的锁，批次之间让出 CPU，删除大量的 key 时不会长时间阻塞读写
+// 删除和 Delete 一样计入命名空间的用量，也会写入 AOF 和复制给副本，开始之后写入的以 prefix 开头的 key 可能被删除也可能不被删除
+// batch 不大于 0 时使用 1000
+func (c *Cache) FlushPrefixAsync(prefix string, batch int) *FlushTask {
+	if batch <= 0 {
+		batch = defaultFlushBatch
+	}
+
+	c.lock.RLock()
+	t := &FlushTask{prefix: prefix, segments: int64(len(c.segments)), done: make(chan struct{})}
+	c.lock.RUnlock()
+
+	go c.flushPrefix(t, batch)
+	return t
+}
+
+// flushPrefix 执行 t 的删除，结束之后关闭 t.done
+func (c *Cache) flushPrefix(t *FlushTask, batch int) {
+	defer close(t.done)
+	for i := 0; atomic.LoadInt32(&t.canceled) == 0; i++ {
+		c.lock.RLock()
+		if i >= len(c.segments) {
+			c.lock.RUnlock()
+			return
+		}
+
+		var keys []string
+		seg := c.segments[i]
+		seg.lock.RLock()
+		seg.forEach(func(key string, e *entry) bool {
+			if strings.HasPrefix(key, t.prefix) {
+				keys = append(keys, key)
+			}
+			return true
+		})
+		seg.lock.RUnlock()
+		c.lock.RUnlock()
+
+		for start := 0; start < len(keys) && atomic.LoadInt32(&t.canceled) == 0; start += batch {
+			end := start + batch
+			if end > len(keys) {
+				end = len(keys)
+			}
+
+			atomic.AddInt64(&t.deleted, int64(c.deleteKeys(keys[start:end])))
+			runtime.Gosched()
+		}
+		atomic.AddInt64(&t.segmentsDone, 1)
+	}
+}
+
+// deleteKeys 删除同一个分片中的 keys，返回删除了的 key 的个数，不包括内部 key
+func (c *Cache) deleteKeys(keys []string) int {
+	if c.view != nil {
+		// 只读视图记录修改需要串行执行，使用写锁
+		c.lock.Lock()
+		defer c.lock.Unlock()
+	} else {
+		c.lock.RLock()
+		defer c.lock.RUnlock()
+		seg := c.segmentOf(keys[0])
+		seg.lock.Lock()
+		defer seg.lock.Unlock()
+	}
+
+	deleted := 0
+	for _, key := range keys {
+		if _, ok := c.lookup(key); ok {
+			c.deleteLocked(key)
+			if !IsInternalKey(key) {
+				deleted++
+			}
+		}
+	}
+	return deleted
+}
@@ -0,0 +1,205 @@
+package caches
+
+import (
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Gc 清理所有过期的数据，返回清理的个数，设置了 Options.StaleGrace 时只清理过期超过 StaleGrace 的数据
+// 每次只持有一个分片的锁清理这个分片，清理期间其他分片上的读写不会被阻塞
+func (c *Cache) Gc() int {
+	// 确定性模式下需要按照 key 的顺序清理，只读视图记录修改也需要串行执行，这时持有写锁清理
+	if c.options.Deterministic || c.view != nil {
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		return c.gcLocked()
+	}
+
+	now := c.now().Add(-c.options.StaleGrace).UnixNano()
+	expired := 0
+	var parts, candidates []string
+	for i := range c.segments {
+		n, segmentParts, segmentCandidates := c.gcSegment(i, now)
+		expired += n
+		parts = append(parts, segmentParts...)
+		candidates = append(candidates, segmentCandidates...)
+	}
+
+	// 过期的大对象的分片可能在其他分片中，释放清单所在分片的锁之后再清理
+	c.deleteParts(parts)
+
+	// 判断分片是否孤立需要查看其他分片中的清单，这时才持有写锁，只检查清理时遇到的分片
+	if len(candidates) > 0 {
+		c.lock.Lock()
+		now := c.now().UnixNano()
+		for _, key := range candidates {
+			if e, ok := c.lookup(key); ok && c.isOrphanPart(key, e, now) {
+				c.deleteLocked(key)
+			}
+		}
+		c.lock.Unlock()
+	}
+	return expired
+}
+
+// gcSegment 清理第 i 个分片中在 now 时已经过期的数据，返回清理的个数、过期的大对象的分片，以及没有过期的分片
+func (c *Cache) gcSegment(i int, now int64) (int, []string, []string) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	seg := c.segments[i]
+	seg.lock.Lock()
+	defer seg.lock.Unlock()
+
+	large := c.options.LargeObjectThreshold > 0
+	var expired, candidates []string
+	seg.forEach(func(key string, e *entry) bool {
+		if !e.alive(now) {
+			expired = append(expired, key)
+		} else if large && strings.Contains(key, largePartMarker) {
+			candidates = append(candidates, key)
+		}
+		return true
+	})
+
+	var parts []string
+	for _, key := range expired {
+		e, _ := c.lookup(key)
+		if large {
+			parts = append(parts, c.partsOf(key, e)...)
+		}
+		c.expireKey(key, e)
+	}
+
+	atomic.AddInt64(&c.counters.expired, int64(len(expired)))
+	return len(expired), parts, candidates
+}
+
+// gcLocked 和 Gc 一样清理所有过期的数据，调用者需要持有写锁
+func (c *Cache) gcLocked() int {
+	now := c.now().Add(-c.options.StaleGrace).UnixNano()
+	// 按照遍历的顺序清理，确定性模式下过期事件的顺序也是确定的
+	var expired []string
+	c.forEach(func(key string, e *entry) bool {
+		if !e.alive(now) {
+			expired = append(expired, key)
+		}
+		return true
+	})
+
+	var parts []string
+	for _, key := range expired {
+		e, _ := c.lookup(key)
+		if c.options.LargeObjectThreshold > 0 {
+			parts = append(parts, c.partsOf(key, e)...)
+		}
+		c.expireKey(key, e)
+	}
+
+	atomic.AddInt64(&c.counters.expired, int64(len(expired)))
+
+	// 过期的大对象的分片和清单一起清理，被覆盖或者淘汰的大对象的分片由 orphanParts 找出来
+	if c.options.LargeObjectThreshold > 0 {
+		for _, key := range append(parts, c.orphanParts()...) {
+			c.deleteLocked(key)
+		}
+	}
+	return len(expired)
+}
+
+// expireKey 删除已经过期的 key 并发出过期事件，e 是 key 的 entry，调用者需要持有写锁，或者持有读锁和 key 所在分片的锁
+func (c *Cache) expireKey(key string, e *entry) {
+	c.countKey(key, -1)
+	c.remove(key)
+	c.account(key, e, nil)
+	c.namespaces.account(key, e, nil)
+	c.eviction.account(key, e, nil)
+	c.touch(key)
+	c.notify(EventExpire, key, e)
+}
+
+// AutoGc 开启一个后台协程，每隔 interval 清理一次过期的数据，调用返回的函数可以停止清理，确定性模式下什么都不做
+func (c *Cache) AutoGc(interval time.Duration) (stop func()) {
+	if c.options.Deterministic {
+		return func() {}
+	}
+
+	atomic.StoreInt64(&c.counters.gcInterval, int64(interval))
+	worker := c.RegisterWorker("gc", interval)
+	done := make(chan struct{})
+	go func() {
+		defer worker.Recover()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.Gc()
+				worker.Beat()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		worker.Stop()
+		atomic.StoreInt64(&c.counters.gcInterval, 0)
+	}
+}
+
+// AutoGcAdaptive 和 AutoGc 一样在后台清理过期的数据，但是会根据每次清理掉的比例调整间隔
+// 间隔从 interval 开始，没有数据过期时翻倍，直到 max；超过 1/4 的数据过期时减半，直到 min
+// 这样没有数据过期时不会白白遍历，大量数据集中过期时可以更快地释放内存
+func (c *Cache) AutoGcAdaptive(interval time.Duration, min time.Duration, max time.Duration) (stop func()) {
+	if c.options.Deterministic {
+		return func() {}
+	}
+
+	atomic.StoreInt64(&c.counters.gcInterval, int64(interval))
+	worker := c.RegisterWorker("gc", interval)
+	done := make(chan struct{})
+	go func() {
+		defer worker.Recover()
+		timer := time.NewTimer(interval)
+		defer timer.Stop()
+		for {
+			select {
+			case <-timer.C:
+				interval = nextGcInterval(interval, min, max, c.Count(), c.Gc())
+				atomic.StoreInt64(&c.counters.gcInterval, int64(interval))
+				worker.SetInterval(interval)
+				worker.Beat()
+				timer.Reset(interval)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		worker.Stop()
+		atomic.StoreInt64(&c.counters.gcInterval, 0)
+	}
+}
+
+// nextGcInterval 根据清理前键值对的个数 total 和清理掉的个数 expired 返回下一次清理的间隔
+func nextGcInterval(interval time.Duration, min time.Duration, max time.Duration, total int64, expired int) time.Duration {
+	switch {
+	case expired == 0:
+		interval *= 2
+	case int64(expired)*4 >= total:
+		interval /= 2
+	}
+
+	if interval < min {
+		return min
+	}
+
+	if interval > max {
+		return max
+	}
+	return interval
+}
@@ -0,0 +1,95 @@
+package caches
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newGcCache 返回有 n 个 key 的缓存，其中一半在 clock 前进一秒之后过期
+func newGcCache(n int) (*Cache, *ManualClock) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	options := DefaultOptions()
+	options.Clock = clock
+	c := NewCacheWithOptions(options)
+	for i := 0; i < n; i++ {
+		ttl := NeverExpire
+		if i%2 == 0 {
+			ttl = time.Second
+		}
+		c.SetWithTTL(strconv.Itoa(i), []byte("value"), ttl)
+	}
+	return c, clock
+}
+
+func TestGcConcurrentWrites(t *testing.T) {
+	c, clock := newGcCache(10000)
+	clock.Advance(2 * time.Second)
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 2000; i++ {
+				key := "w" + strconv.Itoa(w) + "-" + strconv.Itoa(i)
+				c.Set(key, []byte("value"))
+				if _, ok := c.Get(key); !ok {
+					t.Errorf("Get(%q) failed during Gc", key)
+					return
+				}
+			}
+		}(w)
+	}
+
+	if n := c.Gc(); n != 5000 {
+		t.Errorf("Gc = %d, want 5000", n)
+	}
+	wg.Wait()
+
+	if count := c.Count(); count != 5000+4*2000 {
+		t.Errorf("Count = %d, want %d", count, 5000+4*2000)
+	}
+}
+
+// BenchmarkGc 测量清理 10 万个 key 中一半过期的 key 的耗时
+func BenchmarkGc(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		c, clock := newGcCache(100000)
+		clock.Advance(2 * time.Second)
+		b.StartTimer()
+		c.Gc()
+	}
+}
+
+// BenchmarkGetDuringGc 测量后台不停清理时读取的耗时，Gc 持有全局写锁时读取会被阻塞
+func BenchmarkGetDuringGc(b *testing.B) {
+	c, _ := newGcCache(100000)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				c.Gc()
+			}
+		}
+	}()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			c.Get(strconv.Itoa(i % 100000))
+			i++
+		}
+	})
+	b.StopTimer()
+	close(done)
+	<-stopped
+}
@@ -0,0 +1,101 @@
+package caches
+
+import (
+	"math/bits"
+	"sync/atomic"
+	"time"
+)
+
+// histogramBuckets 是直方图的桶数，每个 2 的幂次区间被分成 4 个桶，覆盖了所有 int64 的纳秒数
+const histogramBuckets = 64 * 4
+
+// Histogram 是记录耗时分布的直方图，使用原子操作更新，可以并发使用
+// 桶的边界按照 2 的幂次分成 4 份，估计的分位数误差不超过 25%
+type Histogram struct {
+	// buckets 记录落在每个桶里的次数
+	buckets [histogramBuckets]int64
+
+	// count 是记录的总次数
+	count int64
+}
+
+// LatencyStats 是耗时分布的统计数据，从开始记录起累计
+type LatencyStats struct {
+	Count int64         `json:"count"`
+	P50   time.Duration `json:"p50"`
+	P95   time.Duration `json:"p95"`
+	P99   time.Duration `json:"p99"`
+}
+
+// Observe 记录一次耗时
+func (h *Histogram) Observe(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	atomic.AddInt64(&h.buckets[histogramBucket(uint64(d))], 1)
+	atomic.AddInt64(&h.count, 1)
+}
+
+// Since 记录从 start 到现在的耗时，方便使用 defer h.Since(time.Now())
+func (h *Histogram) Since(start time.Time) {
+	h.Observe(time.Since(start))
+}
+
+// Quantile 返回 q 分位的耗时，q 的范围是 [0, 1]，返回的是对应的桶的上界
+func (h *Histogram) Quantile(q float64) time.Duration {
+	count := atomic.LoadInt64(&h.count)
+	if count == 0 {
+		return 0
+	}
+
+	rank := int64(q * float64(count))
+	if rank >= count {
+		rank = count - 1
+	}
+
+	var seen int64
+	for i := range h.buckets {
+		seen += atomic.LoadInt64(&h.buckets[i])
+		if seen > rank {
+			return time.Duration(histogramUpperBound(i))
+		}
+	}
+	return time.Duration(histogramUpperBound(histogramBuckets - 1))
+}
+
+// Stats 返回耗时分布的统计数据
+func (h *Histogram) Stats() LatencyStats {
+	return LatencyStats{
+		Count: atomic.LoadInt64(&h.count),
+		P50:   h.Quantile(0.50),
+		P95:   h.Quantile(0.95),
+		P99:   h.Quantile(0.99),
+	}
+}
+
+// histogramBucket 返回 n 所在的桶
+// 小于 4 的值各占一个桶，其他值按照最高位的位置和接下来的 2 位分桶
+func histogramBucket(n uint64) int {
+	if n < 4 {
+		return int(n)
+	}
+
+	exp := bits.Len64(n) - 1
+	sub := int(n>>(exp-2)) & 3
+	return exp*4 + sub
+}
+
+// histogramUpperBound 返回第 i 个桶的上界
+func histogramUpperBound(i int) uint64 {
+	if i < 8 {
+		return uint64(i)
+	}
+
+	exp, sub := i/4, i%4
+	upper := uint64(4+sub+1) << (exp - 2)
+	if upper == 0 || upper > 1<<63 {
+		// 最后几个桶的上界超出了 time.Duration 的范围
+		return 1<<63 - 1
+	}
+	return upper - 1
+}
@@ -0,0 +1,160 @@
+package caches
+
+import (
+	"crypto/cipher"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// manifestFile 是增量持久化目录中记录持久化文件链的文件名
+const manifestFile = "MANIFEST.json"
+
+// Manifest 记录了增量持久化目录中的持久化文件链
+// 恢复数据时先加载 Base，再按顺序应用 Incrementals 中的增量持久化文件
+type Manifest struct {
+	// Base 是作为基础的全量持久化文件名
+	Base string `json:"base"`
+
+	// Incrementals 是基于 Base 的增量持久化文件名，按持久化的先后顺序排列
+	Incrementals []string `json:"incrementals"`
+}
+
+// ReadManifest 读取 dir 目录下的持久化文件链
+func ReadManifest(dir string) (*Manifest, error) {
+	content, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &Manifest{}
+	if err = json.Unmarshal(content, manifest); err != nil {
+		return nil, fmt.Errorf("caches: read manifest: %w", err)
+	}
+	return manifest, nil
+}
+
+// writeManifest 将持久化文件链写入 dir 目录
+func writeManifest(dir string, manifest *Manifest) error {
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(filepath.Join(dir, manifestFile), func(w io.Writer) error {
+		_, err := w.Write(content)
+		return err
+	})
+}
+
+// SaveToDir 将缓存数据持久化到 dir 目录中
+// 如果已经有可以作为基础的全量持久化文件，并且增量持久化文件不超过 maxIncrementals 个，就只持久化修改过的数据
+// 否则进行一次全量持久化，并删除旧的持久化文件链
+func (c *Cache) SaveToDir(dir string, maxIncrementals int) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	manifest, err := ReadManifest(dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	c.lock.RLock()
+	tracking := c.changed != nil
+	c.lock.RUnlock()
+
+	name := fmt.Sprintf("%d.snapshot", time.Now().UnixNano())
+	if manifest != nil && tracking && len(manifest.Incrementals) < maxIncrementals {
+		err = c.saveToFile(filepath.Join(dir, "incr-"+name), saveIncremental)
+		if err != nil {
+			return err
+		}
+
+		manifest.Incrementals = append(manifest.Incrementals, "incr-"+name)
+		return writeManifest(dir, manifest)
+	}
+
+	if err = c.saveToFile(filepath.Join(dir, "full-"+name), saveBase); err != nil {
+		return err
+	}
+
+	if err = writeManifest(dir, &Manifest{Base: "full-" + name}); err != nil {
+		return err
+	}
+
+	// 新的持久化文件链已经生效，旧的文件可以删除了
+	if manifest != nil {
+		os.Remove(filepath.Join(dir, manifest.Base))
+		for _, incremental := range manifest.Incrementals {
+			os.Remove(filepath.Join(dir, incremental))
+		}
+	}
+	return nil
+}
+
+// LoadFromDir 从 dir 目录中的持久化文件链恢复缓存数据
+// 所有的文件都读取成功后才会替换缓存中的数据
+func (c *Cache) LoadFromDir(dir string) error {
+	manifest, err := ReadManifest(dir)
+	if err != nil {
+		return err
+	}
+
+	aead, err := newAEAD(c.options.KeyProvider)
+	if err != nil {
+		return err
+	}
+
+	now := c.now().UnixNano()
+	data := make(map[string]*entry, 256)
+	files := append([]string{manifest.Base}, manifest.Incrementals...)
+	for i, name := range files {
+		snap, err := readSnapshotFile(filepath.Join(dir, name), aead)
+		if err != nil {
+			return err
+		}
+
+		if i == 0 && snap.incremental {
+			return fmt.Errorf("caches: base snapshot %s is incremental", name)
+		}
+		c.rebaseExpirations(snap, now)
+
+		for key, value := range snap.data {
+			data[key] = value
+		}
+
+		for _, key := range snap.deleted {
+			delete(data, key)
+		}
+	}
+
+	c.saveLock.Lock()
+	defer c.saveLock.Unlock()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.replaceData(data)
+	c.namespaces.recount(c)
+	c.eviction.recount(c)
+	c.view.rebuild(c)
+	c.changed = make(map[string]struct{})
+	atomic.StoreInt64(&c.dirty, 0)
+	c.lastSave = time.Now()
+	return nil
+}
+
+// readSnapshotFile 读取 path 指定的持久化文件
+func readSnapshotFile(path string, aead cipher.AEAD) (*snapshot, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return readSnapshot(file, aead)
+}
@@ -0,0 +1,37 @@
+package caches
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+)
+
+// internalMarker 是内部 key 中用户的 key 后面的分隔符，大对象的分片和预留这样的内部数据保存在以用户的 key 开头的内部 key 中
+// 内部 key 和用户的 key 属于同一个命名空间，集群中也由同一个节点负责，和普通的 key 一样占用内存、被持久化和复制
+// 但是不属于用户的键空间，不会出现在遍历、计数、抽样、导出和键空间事件中，也不会被单独淘汰
+const internalMarker = "\x00gocache:"
+
+// ErrInternalKey 表示 key 中包含 "\x00gocache:"，这样的 key 是缓存内部使用的，不能作为用户的 key 写入
+var ErrInternalKey = errors.New("caches: key must not contain \"\\x00gocache:\"")
+
+// IsInternalKey 返回 key 是否是缓存内部使用的 key，用户的 key 中不能包含 "\x00gocache:"，见 CheckKey
+func IsInternalKey(key string) bool {
+	return strings.Contains(key, internalMarker)
+}
+
+// CheckKey 检查 key 是否可以作为用户的 key 写入，内部 key 不计入键的个数，也不会被淘汰，用户写入它们可以绕过 MaxEntries 和 MaxBytes
+// key 是内部 key 时返回 ErrInternalKey，服务器收到这样的 key 时应该拒绝请求
+func CheckKey(key string) error {
+	if IsInternalKey(key) {
+		return ErrInternalKey
+	}
+	return nil
+}
+
+// countKey 记录新增或者删除了 key，delta 为 1 或者 -1，内部 key 另外计数，调用者需要持有 key 所在分片的写锁
+func (c *Cache) countKey(key string, delta int64) {
+	atomic.AddInt64(&c.count, delta)
+	if IsInternalKey(key) {
+		atomic.AddInt64(&c.internal, delta)
+	}
+}
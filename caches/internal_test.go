@@ -0,0 +1,48 @@
+package caches
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteInternalKey(t *testing.T) {
+	key := "x" + internalMarker + "y"
+	c := NewCache()
+	writes := map[string]func() error{
+		"TrySet": func() error { return c.TrySet(key, []byte("v"), NeverExpire, PriorityNormal) },
+		"SetFrom": func() error {
+			_, err := c.SetFrom(key, bytes.NewReader([]byte("v")), NeverExpire, PriorityNormal)
+			return err
+		},
+		"MSetWithQuota": func() error {
+			return c.MSetWithQuota(map[string][]byte{"a": []byte("v"), key: []byte("v")}, NeverExpire)
+		},
+		"SetIfMatch": func() error {
+			_, err := c.SetIfMatch(key, []byte("v"), NeverExpire, func(uint64, bool) bool { return true })
+			return err
+		},
+		"Increment": func() error {
+			_, err := c.Increment(key, 1, NeverExpire)
+			return err
+		},
+		"ImportNDJSON": func() error {
+			_, err := c.ImportNDJSON(strings.NewReader(`{"key":"x\u0000gocache:y","value":"v"}`))
+			return err
+		},
+	}
+
+	for name, write := range writes {
+		if err := write(); !errors.Is(err, ErrInternalKey) {
+			t.Errorf("%s = %v, want ErrInternalKey", name, err)
+		}
+	}
+
+	c.Set(key, []byte("v"))
+	c.SetWithTTL(key, []byte("v"), time.Minute)
+	if count, bytes := c.Count(), c.Bytes(); count != 0 || bytes != 0 {
+		t.Fatalf("Count = %d, Bytes = %d after writing internal keys", count, bytes)
+	}
+}
@@ -0,0 +1,26 @@
+package caches
+
+import "sync"
+
+// keyLockStripes 是 WithKeyLock 使用的锁的个数，必须是 2 的幂
+// 不同的 key 可能使用同一把锁，个数越多互相阻塞的概率越小
+const keyLockStripes = 256
+
+// keyLocks 是按照 key 的哈希分组的互斥锁，不需要为每个 key 创建和回收锁
+type keyLocks [keyLockStripes]sync.Mutex
+
+// of 返回 key 使用的锁
+func (l *keyLocks) of(key string) *sync.Mutex {
+	return &l[shardOf(key, keyLockStripes)]
+}
+
+// WithKeyLock 持有 key 的互斥锁执行 fn，返回 fn 返回的错误
+// 插件和脚本中先读取再写入的复合操作放在 fn 中执行，同一个 key 上的这些操作会依次执行，不会交错
+// 这把锁只在 WithKeyLock 之间互斥，直接调用 Set 这样的方法不会等待它，只需要修改 value 时使用 Update 就可以了
+// 锁是按照哈希分组的，fn 中不能再对其他 key 调用 WithKeyLock，否则两个 key 分到同一把锁时会死锁
+func (c *Cache) WithKeyLock(key string, fn func() error) error {
+	lock := c.keyLocks.of(key)
+	lock.Lock()
+	defer lock.Unlock()
+	return fn()
+}
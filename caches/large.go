@@ -0,0 +1,287 @@
+package caches
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// largeMagic 是大对象的清单的开头，后面是 JSON 编码的 largeManifest，用户的 value 不能以它开头，见 checkValue
+	largeMagic = "\x00gocache:large\x00"
+
+	// largePartMarker 是大对象的分片的 key 中对象的 key 和分片的版本之间的分隔符，分片的 key 是以对象的 key 开头的内部 key
+	largePartMarker = internalMarker + "part:"
+
+	// largeOrphanGrace 是没有清单的分片被当作孤立的分片清理之前的空闲时间
+	// 副本上的分片先于清单复制过来，这时还没有清单，需要等待一段时间
+	largeOrphanGrace = time.Hour
+)
+
+// errLargeIncomplete 表示大对象的分片被删除或者淘汰了，或者清单已经不能使用了
+var errLargeIncomplete = errors.New("caches: large object is missing parts")
+
+// ErrReservedValue 表示 value 以大对象的清单的开头 "\x00gocache:large\x00" 开头，不能作为用户的 value 保存
+var ErrReservedValue = errors.New("caches: value must not start with the large object marker")
+
+// largeManifest 是大对象的清单，保存在对象的 key 中
+type largeManifest struct {
+	// Generation 是分片的版本，每次写入大对象都使用新的版本，覆盖写入时旧的分片不会和新的分片混在一起
+	Generation uint64 `json:"generation"`
+
+	// Parts 是分片的个数，Size 是对象的字节数
+	Parts int   `json:"parts"`
+	Size  int64 `json:"size"`
+}
+
+// largeWrite 是正在写入的大对象的 key 和分片的版本
+type largeWrite struct {
+	key        string
+	generation uint64
+}
+
+// manifestOf 返回 e 中保存的大对象清单，threshold 是分片大小，e 不是 setLarge 写入的清单、没有设置分片大小或者清单无效时返回 false
+// 分片的个数不能超过按照分片大小计算出的个数，损坏的清单不会导致分配过多的内存
+func manifestOf(e *entry, threshold int) (largeManifest, bool) {
+	var m largeManifest
+	if threshold <= 0 || !e.large || e.chunks != nil {
+		return m, false
+	}
+
+	value, err := e.data()
+	if err != nil || !bytes.HasPrefix(value, []byte(largeMagic)) || json.Unmarshal(value[len(largeMagic):], &m) != nil {
+		return m, false
+	}
+	return m, m.Size >= 0 && m.Parts > 0 && int64(m.Parts) <= m.Size/int64(threshold)+1
+}
+
+// manifestIn 返回 e 中保存的大对象清单，e 不是清单时返回 false，见 manifestOf
+func (c *Cache) manifestIn(e *entry) (largeManifest, bool) {
+	return manifestOf(e, c.options.LargeObjectThreshold)
+}
+
+// markLarge 根据 value 标记从持久化文件、AOF 或者主节点恢复的 e 是否是大对象的清单，返回 e
+// 用户的 value 不能以 largeMagic 开头，以它开头的 value 只能是 setLarge 写入的清单
+func markLarge(e *entry) *entry {
+	e.large = bytes.HasPrefix(e.value, []byte(largeMagic))
+	return e
+}
+
+// checkValue 检查 e 是否可以作为用户的 value 保存，以 largeMagic 开头时返回 ErrReservedValue，setLarge 写入的清单除外
+// 分块保存的 value 在读取之前已经检查过了，见 setFrom
+func checkValue(e *entry) error {
+	if !e.large && bytes.HasPrefix(e.value, []byte(largeMagic)) {
+		return ErrReservedValue
+	}
+	return nil
+}
+
+// encode 返回保存在对象的 key 中的清单
+func (m largeManifest) encode() []byte {
+	data, _ := json.Marshal(m)
+	return append([]byte(largeMagic), data...)
+}
+
+// partKeys 返回 key 的所有分片的 key
+func (m largeManifest) partKeys(key string) []string {
+	keys := make([]string, m.Parts)
+	for i := range keys {
+		keys[i] = largePartKey(key, m.Generation, i)
+	}
+	return keys
+}
+
+// largePartKey 返回 key 的版本为 generation 的第 i 个分片的 key
+func largePartKey(key string, generation uint64, i int) string {
+	return key + largePartMarker + strconv.FormatUint(generation, 10) + ":" + strconv.Itoa(i)
+}
+
+// parsePartKey 解析分片的 key，返回对象的 key、分片的版本和编号，不是分片的 key 时返回 false
+func parsePartKey(partKey string) (key string, generation uint64, index int, ok bool) {
+	i := strings.LastIndex(partKey, largePartMarker)
+	if i < 0 {
+		return "", 0, 0, false
+	}
+
+	rest := partKey[i+len(largePartMarker):]
+	j := strings.IndexByte(rest, ':')
+	if j < 0 {
+		return "", 0, 0, false
+	}
+
+	generation, err := strconv.ParseUint(rest[:j], 10, 64)
+	if err != nil {
+		return "", 0, 0, false
+	}
+
+	index, err = strconv.Atoi(rest[j+1:])
+	return partKey[:i], generation, index, err == nil
+}
+
+// LargeObjectThreshold 返回大对象的分片大小，为 0 表示不分片
+func (c *Cache) LargeObjectThreshold() int {
+	return c.options.LargeObjectThreshold
+}
+
+// setLarge 把 first 和 rest 中剩下的数据作为大对象保存到 key 中，每个分片不超过 LargeObjectThreshold 字节
+// 先写入所有的分片，最后写入清单，读取到的总是完整的旧对象或者新对象，写入失败时删除已经写入的分片
+// 分片永不过期，也不会被单独淘汰，清单被淘汰时一起淘汰，清单过期、被删除或者覆盖之后由 Gc 清理
+func (c *Cache) setLarge(key string, first *entry, rest io.Reader, ttl time.Duration, priority Priority, checkQuota bool) (int64, error) {
+	write := largeWrite{key: key, generation: atomic.AddUint64(&c.version, 1)}
+	c.largeWrites.Store(write, struct{}{})
+	defer c.largeWrites.Delete(write)
+
+	var parts []string
+	put := func(e *entry) error {
+		partKey := largePartKey(key, write.generation, len(parts))
+		c.compress(e)
+		if err := c.reserve(partKey, e); err != nil {
+			return err
+		}
+
+		if err := c.put(partKey, e, checkQuota); err != nil {
+			return err
+		}
+		parts = append(parts, partKey)
+		return nil
+	}
+
+	first.expireAt = 0
+	total := int64(first.size())
+	err := put(first)
+	for err == nil {
+		var e *entry
+		var size int64
+		e, size, err = c.readEntry(io.LimitReader(rest, int64(c.options.LargeObjectThreshold)), NeverExpire, priority)
+		if err != nil || size == 0 {
+			break
+		}
+
+		total += size
+		err = put(e)
+	}
+
+	if err == nil {
+		old := c.largeParts(key)
+		manifest := c.newEntry(largeManifest{Generation: write.generation, Parts: len(parts), Size: total}.encode(), ttl)
+		manifest.priority, manifest.large = priority, true
+		if err = c.set(key, manifest, checkQuota); err == nil {
+			c.deleteParts(old)
+			return total, nil
+		}
+	}
+
+	c.deleteParts(parts)
+	return 0, err
+}
+
+// openLarge 返回依次读取 key 的所有分片的 ValueReader，分片只是被引用，不会被拷贝，缺少分片时返回 errLargeIncomplete
+func (c *Cache) openLarge(key string, m largeManifest) (*ValueReader, error) {
+	var head, tail *chunk
+	now := c.now().UnixNano()
+	for _, partKey := range m.partKeys(key) {
+		var e *entry
+		var ok bool
+		if c.view != nil {
+			e, ok = c.view.load(partKey)
+		} else {
+			unlock := c.rlockKey(partKey)
+			e, ok = c.lookup(partKey)
+			unlock()
+		}
+
+		if !ok || !e.alive(now) {
+			return nil, errLargeIncomplete
+		}
+
+		part, err := c.openValue(partKey, e)
+		if err != nil {
+			return nil, err
+		}
+
+		// 分片中的块属于分片的 entry，不能修改它们的 next，拷贝一份块的头部连接起来
+		for ch := part.head; ch != nil; ch = ch.next {
+			next := &chunk{data: ch.data}
+			if tail == nil {
+				head = next
+			} else {
+				tail.next = next
+			}
+			tail = next
+		}
+	}
+
+	if head == nil {
+		head = &chunk{}
+	}
+	return newValueReader(head), nil
+}
+
+// largeParts 返回 key 中保存的大对象的所有分片的 key，不是大对象或者没有设置 LargeObjectThreshold 时返回 nil
+func (c *Cache) largeParts(key string) []string {
+	if c.options.LargeObjectThreshold <= 0 {
+		return nil
+	}
+
+	unlock := c.rlockKey(key)
+	e, ok := c.lookup(key)
+	unlock()
+	if !ok {
+		return nil
+	}
+	return c.partsOf(key, e)
+}
+
+// partsOf 返回 key 的 e 中保存的大对象的所有分片的 key，e 不是大对象的清单时返回 nil
+func (c *Cache) partsOf(key string, e *entry) []string {
+	if m, ok := c.manifestIn(e); ok {
+		return m.partKeys(key)
+	}
+	return nil
+}
+
+// deleteParts 删除大对象的分片
+func (c *Cache) deleteParts(keys []string) {
+	for _, key := range keys {
+		c.deleteIf(key, nil)
+	}
+}
+
+// orphanParts 返回不再属于任何大对象的分片的 key，调用者需要持有写锁
+func (c *Cache) orphanParts() []string {
+	now := c.now().UnixNano()
+	var orphans []string
+	c.forEach(func(partKey string, e *entry) bool {
+		if c.isOrphanPart(partKey, e, now) {
+			orphans = append(orphans, partKey)
+		}
+		return true
+	})
+	return orphans
+}
+
+// isOrphanPart 返回 partKey 是否是不再属于任何大对象的分片，e 是它的 entry，调用者需要持有写锁
+// 分片的版本比清单中的旧，或者没有清单并且空闲超过 largeOrphanGrace 时是孤立的，正在写入的分片不是
+func (c *Cache) isOrphanPart(partKey string, e *entry, now int64) bool {
+	key, generation, index, ok := parsePartKey(partKey)
+	if !ok {
+		return false
+	}
+
+	if _, writing := c.largeWrites.Load(largeWrite{key: key, generation: generation}); writing {
+		return false
+	}
+
+	if owner, found := c.lookup(key); found {
+		if m, ok := c.manifestIn(owner); ok {
+			// 版本比清单新的分片可能是副本上还没有复制完的新对象
+			return generation < m.Generation || (generation == m.Generation && index >= m.Parts)
+		}
+	}
+	return now-atomic.LoadInt64(&e.accessedAt) > int64(largeOrphanGrace)
+}
@@ -0,0 +1,323 @@
+package caches
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newLargeCache 返回大对象的分片大小为 threshold 的缓存
+func newLargeCache(threshold int, configure func(options *Options)) *Cache {
+	options := DefaultOptions()
+	options.LargeObjectThreshold = threshold
+	if configure != nil {
+		configure(&options)
+	}
+	return NewCacheWithOptions(options)
+}
+
+// largeValue 返回 size 字节的 value，每个字节都和位置有关，拼接顺序出错时可以发现
+func largeValue(size int) []byte {
+	value := make([]byte, size)
+	for i := range value {
+		value[i] = byte('a' + i%26)
+	}
+	return value
+}
+
+// rawKeys 返回缓存中包括内部 key 在内的所有 key
+func rawKeys(c *Cache) []string {
+	var keys []string
+	c.lock.RLock()
+	c.forEach(func(key string, e *entry) bool {
+		keys = append(keys, key)
+		return true
+	})
+	c.lock.RUnlock()
+	sort.Strings(keys)
+	return keys
+}
+
+func TestLargeObjectRoundTrip(t *testing.T) {
+	c := newLargeCache(100, nil)
+	value := largeValue(350)
+	n, err := c.SetFrom("k", bytes.NewReader(value), NeverExpire, PriorityNormal)
+	if err != nil || n != int64(len(value)) {
+		t.Fatalf("SetFrom = %d, %v", n, err)
+	}
+
+	if got, ok := c.Get("k"); !ok || !bytes.Equal(got, value) {
+		t.Fatalf("Get = %d bytes, %v", len(got), ok)
+	}
+
+	reader, _, ok := c.GetReader("k")
+	if !ok || reader.Size() != int64(len(value)) {
+		t.Fatalf("GetReader = %v", ok)
+	}
+
+	if _, err := reader.Seek(95, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 10)
+	if _, err := reader.Read(buf); err != nil || !bytes.Equal(buf, value[95:105]) {
+		t.Fatalf("Read across parts = %q, %v", buf, err)
+	}
+
+	if raw := rawKeys(c); len(raw) != 5 {
+		t.Fatalf("stored keys = %q, want manifest and 4 parts", raw)
+	}
+
+	c.Delete("k")
+	if raw := rawKeys(c); len(raw) != 0 {
+		t.Fatalf("keys after Delete = %q", raw)
+	}
+}
+
+func TestLargeObjectKeyspace(t *testing.T) {
+	c := newLargeCache(100, nil)
+	value := largeValue(350)
+	if _, err := c.SetFrom("k", bytes.NewReader(value), NeverExpire, PriorityNormal); err != nil {
+		t.Fatal(err)
+	}
+	c.Set("a", []byte("small"))
+
+	if count := c.Count(); count != 2 {
+		t.Errorf("Count = %d, want 2", count)
+	}
+
+	if keys, _ := c.Scan(0, "", 100); strings.Join(keys, ",") != "a,k" {
+		t.Errorf("Scan = %q, want [a k]", keys)
+	}
+
+	if keys, _ := c.Scan(0, "k*", 100); strings.Join(keys, ",") != "k" {
+		t.Errorf("Scan k* = %q, want [k]", keys)
+	}
+
+	sample := c.SampleKeys(10)
+	sort.Strings(sample)
+	if strings.Join(sample, ",") != "a,k" {
+		t.Errorf("SampleKeys = %q, want [a k]", sample)
+	}
+
+	for i := 0; i < 20; i++ {
+		if key, _ := c.RandomKey(); IsInternalKey(key) {
+			t.Fatalf("RandomKey returned internal key %q", key)
+		}
+	}
+
+	for _, key := range rawKeys(c) {
+		if IsInternalKey(key) && c.Type(key) != TypeNone {
+			t.Errorf("Type(%q) = %s, want none", key, c.Type(key))
+		}
+	}
+
+	if info, ok := c.Object("k"); !ok || info.Size != len("k")+len(value) {
+		t.Errorf("Object(k) = %+v, %v", info, ok)
+	}
+
+	if report := c.SizeReport(10); report.Keys != 2 || len(report.Largest) != 2 {
+		t.Errorf("SizeReport = %+v, want 2 keys", report)
+	}
+
+	entries := c.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("Entries = %d, want 2", len(entries))
+	}
+
+	view := c.Snapshot()
+	if got, ok := view.Get("k"); !ok || !bytes.Equal(got, value) || view.Count() != 2 {
+		t.Errorf("Snapshot Get = %d bytes, %v, count %d", len(got), ok, view.Count())
+	}
+
+	var out bytes.Buffer
+	n, err := c.ExportNDJSON(&out)
+	if err != nil || n != 2 {
+		t.Fatalf("ExportNDJSON = %d, %v", n, err)
+	}
+
+	records := make(map[string]string)
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatal(err)
+		}
+		records[record.Key] = record.Value
+	}
+
+	if len(records) != 2 || records["k"] != string(value) || records["a"] != "small" {
+		t.Errorf("exported records = %d, k has %d bytes", len(records), len(records["k"]))
+	}
+}
+
+func TestLargeObjectEvictedWithParts(t *testing.T) {
+	c := newLargeCache(100, func(options *Options) {
+		options.MaxEntries = 3
+	})
+
+	value := largeValue(350)
+	if _, err := c.SetFrom("k", bytes.NewReader(value), NeverExpire, PriorityNormal); err != nil {
+		t.Fatal(err)
+	}
+
+	// 分片不占用 MaxEntries，也不会被单独淘汰
+	c.Set("a", []byte("1"))
+	c.Set("b", []byte("2"))
+	if got, ok := c.Get("k"); !ok || !bytes.Equal(got, value) {
+		t.Fatalf("large object is incomplete before reaching the limit")
+	}
+
+	// k 最近被读取过，淘汰 a 和 b 之后才会淘汰 k
+	for i := 0; i < 4; i++ {
+		c.Set(fmt.Sprintf("x%d", i), []byte("x"))
+	}
+
+	if _, ok := c.Get("k"); ok {
+		t.Fatalf("large object was not evicted")
+	}
+
+	for _, key := range rawKeys(c) {
+		if IsInternalKey(key) {
+			t.Errorf("part %q survived eviction of its manifest", key)
+		}
+	}
+
+	if count := c.Count(); count != 3 {
+		t.Errorf("Count = %d, want 3", count)
+	}
+}
+
+func TestLargeObjectNoZombieUnderMaxBytes(t *testing.T) {
+	c := newLargeCache(100, func(options *Options) {
+		options.MaxBytes = 2000
+	})
+
+	for i := 0; i < 50; i++ {
+		value := largeValue(350 + i)
+		key := fmt.Sprintf("large%d", i)
+		if _, err := c.SetFrom(key, bytes.NewReader(value), NeverExpire, PriorityNormal); err != nil {
+			t.Fatal(err)
+		}
+		c.Set(fmt.Sprintf("small%d", i), []byte("value"))
+
+		// 每个还能看到的 key 都必须可以完整地读取
+		keys, _ := c.Scan(0, "", 1000)
+		for _, key := range keys {
+			if _, ok := c.Get(key); !ok {
+				t.Fatalf("after write %d: %q is listed but cannot be read", i, key)
+			}
+		}
+	}
+
+	if bytes := c.Bytes(); bytes > 2000 {
+		t.Errorf("Bytes = %d, want at most 2000", bytes)
+	}
+}
+
+func TestLargeObjectGcRemovesParts(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	c := newLargeCache(100, func(options *Options) {
+		options.Clock = clock
+	})
+
+	if _, err := c.SetFrom("k", bytes.NewReader(largeValue(350)), time.Second, PriorityNormal); err != nil {
+		t.Fatal(err)
+	}
+
+	clock.Advance(2 * time.Second)
+	c.Gc()
+	if raw := rawKeys(c); len(raw) != 0 {
+		t.Fatalf("keys after Gc = %q", raw)
+	}
+}
+
+func TestLargeObjectForgedManifest(t *testing.T) {
+	forged := []byte(largeMagic + `{"generation":1,"parts":-1,"size":1}`)
+	for _, threshold := range []int{0, 100} {
+		c := newLargeCache(threshold, func(options *Options) { options.ChunkSize = 4 })
+		if err := c.TrySet("a", forged, NeverExpire, PriorityNormal); err != ErrReservedValue {
+			t.Fatalf("threshold %d: TrySet = %v, want ErrReservedValue", threshold, err)
+		}
+
+		if _, err := c.SetFrom("a", bytes.NewReader(forged), NeverExpire, PriorityNormal); err != ErrReservedValue {
+			t.Fatalf("threshold %d: SetFrom = %v, want ErrReservedValue", threshold, err)
+		}
+
+		if err := c.MSetWithQuota(map[string][]byte{"a": forged}, NeverExpire); err != ErrReservedValue {
+			t.Fatalf("threshold %d: MSetWithQuota = %v, want ErrReservedValue", threshold, err)
+		}
+
+		if _, ok := c.Get("a"); ok || c.Count() != 0 {
+			t.Fatalf("threshold %d: forged manifest was stored", threshold)
+		}
+	}
+}
+
+func TestLargeObjectInvalidManifest(t *testing.T) {
+	manifests := []string{
+		`{"generation":1,"parts":-1,"size":1}`,
+		`{"generation":1,"parts":0,"size":0}`,
+		`{"generation":1,"parts":1,"size":-1}`,
+		`{"generation":1,"parts":1000000000000,"size":1}`,
+		`not json`,
+	}
+
+	for _, manifest := range manifests {
+		// 从持久化文件中恢复的清单只根据开头标记，内容可能是损坏的
+		c := newLargeCache(100, nil)
+		c.setEntry("a", markLarge(&entry{value: []byte(largeMagic + manifest)}))
+		if _, ok := c.Get("a"); ok {
+			t.Fatalf("%s: Get = true", manifest)
+		}
+
+		if _, _, ok := c.GetReader("a"); ok {
+			t.Fatalf("%s: GetReader = true", manifest)
+		}
+
+		c.Expire("a", time.Nanosecond)
+		time.Sleep(time.Millisecond)
+		c.Gc()
+		if c.Count() != 0 {
+			t.Fatalf("%s: Count after Gc = %d", manifest, c.Count())
+		}
+	}
+
+	c := newLargeCache(100, nil)
+	c.setEntry("a", &entry{value: []byte(largeMagic + `{"generation":1,"parts":1,"size":1}`)})
+	if parts := c.largeParts("a"); parts != nil {
+		t.Fatalf("value not written by setLarge is a manifest with parts %q", parts)
+	}
+}
+
+func TestLargeObjectSaveAndLoad(t *testing.T) {
+	c := newLargeCache(100, nil)
+	value := largeValue(250)
+	if _, err := c.SetFrom("k", bytes.NewReader(value), NeverExpire, PriorityNormal); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := c.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := newLargeCache(100, nil)
+	if err := loaded.Load(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, ok := loaded.Get("k"); !ok || !bytes.Equal(got, value) {
+		t.Fatalf("Get after Load = %d bytes, %v", len(got), ok)
+	}
+
+	loaded.Delete("k")
+	if raw := rawKeys(loaded); len(raw) != 0 {
+		t.Fatalf("keys after Delete = %q", raw)
+	}
+}
@@ -0,0 +1,98 @@
+package caches
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Lease 是 key 上的租约，租约的持有者需要在过期之前续约，否则其他客户端就可以获取它
+type Lease struct {
+	// Holder 是持有者的标识，比如主机名加进程号
+	Holder string
+
+	// Token 是获取租约时发出的 fencing token，续约不会改变，重新获取时会变大，可以作为选主的任期
+	Token uint64
+
+	// TTL 是租约剩余的存活时间
+	TTL time.Duration
+}
+
+// AcquireLease 尝试为 holder 获取 key 上的租约，租约在 ttl 之后过期
+// 租约已经被 holder 持有时相当于续约，被其他持有者持有时返回 false 和当前的租约
+// key 上已经有没有过期的其他数据时也返回 false，这时返回的租约的 Holder 为空
+// 租约保存为 key 上值为 "token:holder" 的数据，和 Lock 共用 fencing token，holder 不能为空
+func (c *Cache) AcquireLease(key string, holder string, ttl time.Duration) (Lease, bool) {
+	defer c.lockKeys(false, key)()
+	now := c.now().UnixNano()
+	if current, ok := c.leaseLocked(key, now); ok {
+		if current.Holder != holder {
+			return current, false
+		}
+
+		c.putKey(key, c.newEntry(encodeLease(current.Token, holder), ttl), false)
+		current.TTL = ttl
+		return current, true
+	}
+
+	token := c.nextFence(now)
+	c.putKey(key, c.newEntry(encodeLease(token, holder), ttl), false)
+	return Lease{Holder: holder, Token: token, TTL: ttl}, true
+}
+
+// RenewLease 将 holder 持有的 key 上的租约延长到 ttl 之后过期，租约已经过期或者被其他持有者获取时返回 false
+func (c *Cache) RenewLease(key string, holder string, ttl time.Duration) (Lease, bool) {
+	defer c.lockKeys(false, key)()
+	current, ok := c.leaseLocked(key, c.now().UnixNano())
+	if !ok || current.Holder != holder {
+		return current, false
+	}
+
+	c.putKey(key, c.newEntry(encodeLease(current.Token, holder), ttl), false)
+	current.TTL = ttl
+	return current, true
+}
+
+// ReleaseLease 释放 holder 持有的 key 上的租约，租约已经过期或者被其他持有者获取时返回 false
+func (c *Cache) ReleaseLease(key string, holder string) bool {
+	defer c.lockKeys(false, key)()
+	current, ok := c.leaseLocked(key, c.now().UnixNano())
+	if !ok || current.Holder != holder {
+		return false
+	}
+
+	c.deleteLocked(key)
+	return true
+}
+
+// GetLease 返回 key 上当前的租约，没有租约或者已经过期时返回 false
+func (c *Cache) GetLease(key string) (Lease, bool) {
+	defer c.rlockKey(key)()
+	lease, ok := c.leaseLocked(key, c.now().UnixNano())
+	return lease, ok && lease.Holder != ""
+}
+
+// leaseLocked 返回 key 上在 now 时还有效的租约，key 不存在或者已经过期时返回 false，调用者需要持有锁
+// key 上的数据不是租约时返回 Holder 为空的租约，这样任何持有者都不能获取、续约或者释放它
+func (c *Cache) leaseLocked(key string, now int64) (Lease, bool) {
+	e, ok := c.lookup(key)
+	if !ok || !e.alive(now) {
+		return Lease{}, false
+	}
+
+	// 从快照或者主节点加载的数据可能被压缩过，解压失败时当作不是租约
+	value, _ := e.data()
+	tokenText, holder, ok := strings.Cut(string(value), ":")
+	token, err := strconv.ParseUint(tokenText, 10, 64)
+	if !ok || err != nil {
+		return Lease{TTL: e.ttl(now)}, true
+	}
+	return Lease{Holder: holder, Token: token, TTL: e.ttl(now)}, true
+}
+
+// encodeLease 返回租约保存在缓存中的值
+func encodeLease(token uint64, holder string) []byte {
+	value := strconv.AppendUint(nil, token, 10)
+	value = append(value, ':')
+	return append(value, holder...)
+}
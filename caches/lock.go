@@ -0,0 +1,122 @@
+package caches
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"gocache/utils"
+)
+
+// SetNX 只在 key 不存在或者已经过期时保存 key 和 value，ttl 之后过期，返回是否保存了
+// key 不合法、准入策略拒绝了写入或者开启了 RejectWhenFull 时缓存已满也返回 false，需要区分这些情况时使用 TrySetNX
+func (c *Cache) SetNX(key string, value []byte, ttl time.Duration) bool {
+	ok, _ := c.TrySetNX(key, value, ttl)
+	return ok
+}
+
+// TrySetNX 和 SetNX 一样只在 key 不存在或者已经过期时保存 key 和 value，没有保存的原因是写入被拒绝时返回错误
+// 和 Set 一样检查 key 和 value，缓存已满并且准入策略拒绝了写入，或者开启了 RejectWhenFull 时缓存已满都返回 ErrCacheFull
+func (c *Cache) TrySetNX(key string, value []byte, ttl time.Duration) (bool, error) {
+	e := c.newEntry(utils.Copy(value), ttl)
+	return c.setNX(key, e, false, nil)
+}
+
+// Lock 尝试获取 key 上的锁，锁在 ttl 之后自动释放，成功时返回 fencing token
+// 锁就是 key 上一个值为 token 的数据，key 已经存在并且没有过期时获取失败
+// token 在整个缓存中单调递增，持有者访问受保护的资源时带上 token，资源拒绝比已经见过的更小的 token
+// 这样即使锁过期之后旧的持有者还在运行，它的写入也会被拒绝
+// key 不合法或者缓存已满时也返回 false，需要区分这些情况时使用 TryLock
+func (c *Cache) Lock(key string, ttl time.Duration) (token uint64, ok bool) {
+	token, ok, _ = c.TryLock(key, ttl)
+	return token, ok
+}
+
+// TryLock 和 Lock 一样尝试获取 key 上的锁，锁的写入被拒绝时返回和 TrySetNX 一样的错误
+func (c *Cache) TryLock(key string, ttl time.Duration) (uint64, bool, error) {
+	return c.acquireLock(key, ttl, false)
+}
+
+// LockWithQuota 和 TryLock 一样尝试获取 key 上的锁，但是获取之后会超出 key 所在命名空间的配额时返回 *QuotaError
+func (c *Cache) LockWithQuota(key string, ttl time.Duration) (uint64, bool, error) {
+	return c.acquireLock(key, ttl, true)
+}
+
+// acquireLock 获取 key 上的锁，checkQuota 为 true 时检查命名空间的配额
+func (c *Cache) acquireLock(key string, ttl time.Duration, checkQuota bool) (uint64, bool, error) {
+	var token uint64
+
+	// token 占用的长度不会超过 20 个字节，检查准入和容量时使用最大长度的 value
+	e := c.newEntry(make([]byte, 20), ttl)
+	ok, err := c.setNX(key, e, checkQuota, func(now int64) {
+		token = c.nextFence(now)
+		e.value = strconv.AppendUint(nil, token, 10)
+	})
+
+	if !ok {
+		return 0, false, err
+	}
+	return token, true, nil
+}
+
+// setNX 在 key 不存在或者已经过期时保存 key 和 e，和 set 一样检查 key 和 value、询问准入策略以及检查容量
+// 准入策略拒绝时返回 ErrCacheFull，checkQuota 为 true 时检查命名空间的配额
+// fill 不为 nil 时在确认 key 不存在之后、保存 e 之前调用，参数是当前的时间，用于设置只有在写入时才能确定的 value
+func (c *Cache) setNX(key string, e *entry, checkQuota bool, fill func(now int64)) (bool, error) {
+	if err := CheckKey(key); err != nil {
+		return false, err
+	}
+
+	if err := checkValue(e); err != nil {
+		return false, err
+	}
+
+	if fill == nil {
+		c.compress(e)
+	}
+
+	if !c.admit(key, e) {
+		return false, ErrCacheFull
+	}
+
+	defer c.counters.setLatency.Since(time.Now())
+	defer c.lockKeys(checkQuota, key)()
+	now := c.now().UnixNano()
+	if old, ok := c.lookup(key); ok && old.alive(now) {
+		return false, nil
+	}
+
+	if fill != nil {
+		fill(now)
+	}
+
+	if err := c.reserveLocked(key, e); err != nil {
+		return false, err
+	}
+
+	if err := c.putKey(key, e, checkQuota); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// nextFence 返回下一个 fencing token，不同分片上的锁可能同时获取，使用 CAS 保证 token 不会重复
+// 使用当前时间作为 token 的下限，重启之后 token 也不会比之前发出的小
+func (c *Cache) nextFence(now int64) uint64 {
+	for {
+		fence := atomic.LoadUint64(&c.fence)
+		token := fence + 1
+		if uint64(now) > token {
+			token = uint64(now)
+		}
+
+		if atomic.CompareAndSwapUint64(&c.fence, fence, token) {
+			return token
+		}
+	}
+}
+
+// Unlock 释放 token 对应的 key 上的锁，锁已经过期或者被其他持有者获取时返回 false
+func (c *Cache) Unlock(key string, token uint64) bool {
+	return c.DeleteIfValue(key, strconv.AppendUint(nil, token, 10))
+}
@@ -0,0 +1,63 @@
+package caches
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestLockChecksWrite 检查 SetNX 和 Lock 和 Set 一样检查 key、容量和命名空间的配额
+func TestLockChecksWrite(t *testing.T) {
+	options := DefaultOptions()
+	options.MaxEntries = 1
+	options.RejectWhenFull = true
+	c := NewCacheWithOptions(options)
+
+	if _, ok, err := c.TryLock("a"+internalMarker+"b", time.Minute); ok || !errors.Is(err, ErrInternalKey) {
+		t.Fatalf("TryLock of an internal key = %v, %v, want ErrInternalKey", ok, err)
+	}
+
+	token, ok, err := c.TryLock("a", time.Minute)
+	if !ok || err != nil {
+		t.Fatalf("TryLock = %v, %v", ok, err)
+	}
+
+	if value, _ := c.Get("a"); string(value) != strconv.FormatUint(token, 10) {
+		t.Fatalf("lock value = %q, want the token %d", value, token)
+	}
+
+	// 锁已经被持有时不是错误
+	if _, ok, err = c.TryLock("a", time.Minute); ok || err != nil {
+		t.Fatalf("TryLock of a held lock = %v, %v", ok, err)
+	}
+
+	if _, ok, err = c.TryLock("b", time.Minute); ok || !errors.Is(err, ErrCacheFull) {
+		t.Fatalf("TryLock on a full cache = %v, %v, want ErrCacheFull", ok, err)
+	}
+
+	if ok, err = c.TrySetNX("b", []byte("v"), time.Minute); ok || !errors.Is(err, ErrCacheFull) {
+		t.Fatalf("TrySetNX on a full cache = %v, %v, want ErrCacheFull", ok, err)
+	}
+
+	if c.SetNX("b", []byte("v"), time.Minute) || c.Count() != 1 {
+		t.Fatalf("SetNX on a full cache saved the key, %d keys", c.Count())
+	}
+
+	options = DefaultOptions()
+	options.Namespaces = []Namespace{{Name: "ns", MaxKeys: 1}}
+	c = NewCacheWithOptions(options)
+	ns := c.Namespace("ns")
+	if _, ok, err = c.LockWithQuota(ns.Key("a"), time.Minute); !ok || err != nil {
+		t.Fatalf("LockWithQuota = %v, %v", ok, err)
+	}
+
+	var quotaErr *QuotaError
+	if _, ok, err = c.LockWithQuota(ns.Key("b"), time.Minute); ok || !errors.As(err, &quotaErr) {
+		t.Fatalf("LockWithQuota over the quota = %v, %v, want *QuotaError", ok, err)
+	}
+
+	if _, ok := c.Get(ns.Key("b")); ok {
+		t.Fatal("lock over the quota was saved")
+	}
+}
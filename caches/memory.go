@@ -0,0 +1,64 @@
+package caches
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// ErrCacheFull 表示开启了 RejectWhenFull，写入之后会超出 MaxEntries 或者 MaxBytes
+var ErrCacheFull = errors.New("caches: cache is full")
+
+// entryOverhead 是每个键值对除了 key 和 value 之外大约占用的字节数
+// 包括 entry 本身，以及 map 中保存的 key 的字符串头、entry 的指针和按照装载因子预留的空位
+const entryOverhead = int64(unsafe.Sizeof(entry{})) + 48
+
+// UsedBytes 返回缓存的数据大约占用的内存字节数，在 Bytes 的基础上加上了每个键值对的额外开销
+// 不包括淘汰策略、只读视图和持久化这些结构占用的内存，只用于观察，MaxBytes 限制的仍然是 Bytes
+func (c *Cache) UsedBytes() int64 {
+	return c.Bytes() + c.Count()*entryOverhead
+}
+
+// checkFull 在开启了 RejectWhenFull 时检查写入 key 和 e 之后是否会超出限制，会超出时记录次数并返回 ErrCacheFull
+// 更新已经存在的 key 只在占用的字节数变大时检查，PriorityHigh 的 key 总是被接受，调用者需要持有写锁，或者持有读锁和 key 所在分片的锁
+func (c *Cache) checkFull(key string, e *entry) error {
+	ev := c.eviction
+	if !c.options.RejectWhenFull || ev == nil || e.priority >= PriorityHigh {
+		return nil
+	}
+
+	old, _ := c.lookup(key)
+	keys, bytes := usageDelta(key, old, e)
+	if keys > 0 && ev.maxEntries > 0 && c.Count()+keys > ev.maxEntries ||
+		bytes > 0 && ev.maxBytes > 0 && atomic.LoadInt64(&ev.bytes)+bytes > ev.maxBytes {
+		atomic.AddInt64(&c.counters.rejected, 1)
+		return ErrCacheFull
+	}
+	return nil
+}
+
+// reserve 和 checkFull 一样检查写入之后是否会超出限制，调用者不需要持有锁
+// 检查和写入不是原子的，并发写入时仍然可能略微超出限制，超出的部分会按照淘汰策略淘汰
+func (c *Cache) reserve(key string, e *entry) error {
+	if !c.options.RejectWhenFull || c.eviction == nil {
+		return nil
+	}
+
+	unlock := c.rlockKey(key)
+	defer unlock()
+	return c.checkFull(key, e)
+}
+
+// reserveLocked 和 reserve 一样检查写入之后是否会超出限制，调用者需要持有 key 的锁，检查和写入可以原子地进行
+func (c *Cache) reserveLocked(key string, e *entry) error {
+	if !c.options.RejectWhenFull || c.eviction == nil {
+		return nil
+	}
+	return c.checkFull(key, e)
+}
+
+// TrySet 和 SetWithPriority 一样保存 key 和 value，但是开启了 RejectWhenFull 时缓存已满返回 ErrCacheFull
+func (c *Cache) TrySet(key string, value []byte, ttl time.Duration, priority Priority) error {
+	return c.set(key, c.newPriorityEntry(value, ttl, priority), false)
+}
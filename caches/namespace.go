@@ -0,0 +1,314 @@
+package caches
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gocache/utils"
+)
+
+// Namespace 是以 Prefix 开头的一组 key，可以限制它们的个数和占用的字节数，用于多租户隔离
+type Namespace struct {
+	// Name 是命名空间的名字，不为空时可以使用 Cache.Namespace 访问，这时 Prefix 为空表示使用 NamespacePrefix(Name)
+	Name string
+
+	// Prefix 是命名空间的前缀，key 属于最长的匹配前缀所在的命名空间
+	Prefix string
+
+	// DefaultTTL 是通过 NamespaceCache.Set 写入时使用的过期时间，为 0 表示永不过期
+	DefaultTTL time.Duration
+
+	// MaxKeys 是最多的键值对个数，为 0 表示不限制
+	MaxKeys int64
+
+	// MaxBytes 是 key 和 value 最多占用的总字节数，为 0 表示不限制
+	MaxBytes int64
+
+	// MaxWriteBytes 是每个计费周期最多写入的 key 和 value 的总字节数，为 0 表示不限制
+	MaxWriteBytes int64
+}
+
+// NamespaceUsage 是一个命名空间的使用情况
+type NamespaceUsage struct {
+	Prefix        string `json:"prefix"`
+	Keys          int64  `json:"keys"`
+	Bytes         int64  `json:"bytes"`
+	MaxKeys       int64  `json:"max_keys"`
+	MaxBytes      int64  `json:"max_bytes"`
+	MaxWriteBytes int64  `json:"max_write_bytes"`
+
+	// ByteSeconds 是当前计费周期内占用的字节数对时间的积分，比如 1KB 保存一小时是 3686400
+	ByteSeconds float64 `json:"byte_seconds"`
+
+	OpsUsage
+}
+
+// QuotaError 表示写入之后会超出命名空间的配额
+type QuotaError struct {
+	// Prefix 是命名空间的前缀
+	Prefix string
+
+	// Resource 是超出配额的资源，keys、bytes 或者 write_bytes
+	Resource string
+
+	// Limit 是配额，Used 是写入之后的用量
+	Limit int64
+	Used  int64
+}
+
+func (qe *QuotaError) Error() string {
+	return fmt.Sprintf("caches: namespace %q exceeds %s quota, limit %d, would use %d", qe.Prefix, qe.Resource, qe.Limit, qe.Used)
+}
+
+// namespaces 记录每个命名空间的使用情况，用量在修改数据时使用原子操作增量更新
+// 修改数据的调用者持有写锁，或者持有读锁和 key 所在分片的锁，不同分片上的修改可以同时更新用量；检查配额和写入需要原子地进行，这时持有写锁
+type namespaces struct {
+	// list 是所有的命名空间，按照前缀长度从长到短排列
+	list []Namespace
+
+	// keys 和 bytes 是每个命名空间的键值对个数和占用的字节数，读取时不需要持有锁
+	keys  []int64
+	bytes []int64
+
+	// hits 和 misses 是每个命名空间中的 key 被 Get 命中和没有命中的次数
+	hits   []int64
+	misses []int64
+
+	// ops 是每个命名空间在当前计费周期内的操作用量
+	ops []opsCounters
+
+	// byteSeconds 是每个命名空间在 settled 之前累计的存储量，settled 是每个命名空间上次结算的时间，由 storageLock 保护
+	byteSeconds []float64
+	settled     []int64
+	storageLock sync.Mutex
+}
+
+// newNamespaces 返回记录 list 中命名空间使用情况的 namespaces，没有命名空间时返回 nil
+func newNamespaces(list []Namespace) *namespaces {
+	if len(list) == 0 {
+		return nil
+	}
+
+	sorted := append([]Namespace(nil), list...)
+	for i := range sorted {
+		if sorted[i].Prefix == "" {
+			sorted[i].Prefix = NamespacePrefix(sorted[i].Name)
+		}
+	}
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return len(sorted[i].Prefix) > len(sorted[j].Prefix)
+	})
+
+	now := time.Now().UnixNano()
+	settled := make([]int64, len(sorted))
+	for i := range settled {
+		settled[i] = now
+	}
+
+	return &namespaces{
+		list:        sorted,
+		keys:        make([]int64, len(sorted)),
+		bytes:       make([]int64, len(sorted)),
+		hits:        make([]int64, len(sorted)),
+		misses:      make([]int64, len(sorted)),
+		ops:         make([]opsCounters, len(sorted)),
+		byteSeconds: make([]float64, len(sorted)),
+		settled:     settled,
+	}
+}
+
+// settle 将第 i 个命名空间到 now 为止的存储量累计到 byteSeconds 中，调用者需要持有 storageLock
+func (ns *namespaces) settle(i int, now int64) {
+	if elapsed := now - ns.settled[i]; elapsed > 0 {
+		ns.byteSeconds[i] += float64(atomic.LoadInt64(&ns.bytes[i])) * float64(elapsed) / float64(time.Second)
+		ns.settled[i] = now
+	}
+}
+
+// find 返回 key 所在命名空间的下标，不属于任何命名空间时返回 -1
+func (ns *namespaces) find(key string) int {
+	for i, namespace := range ns.list {
+		if strings.HasPrefix(key, namespace.Prefix) {
+			return i
+		}
+	}
+	return -1
+}
+
+// named 返回名为 name 的命名空间的下标，没有时返回 -1
+func (ns *namespaces) named(name string) int {
+	if ns == nil {
+		return -1
+	}
+
+	for i, namespace := range ns.list {
+		if namespace.Name != "" && namespace.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// record 记录 key 的一次 Get 的结果
+func (ns *namespaces) record(key string, hit bool) {
+	if ns == nil {
+		return
+	}
+
+	i := ns.find(key)
+	if i < 0 {
+		return
+	}
+
+	if hit {
+		atomic.AddInt64(&ns.hits[i], 1)
+		return
+	}
+	atomic.AddInt64(&ns.misses[i], 1)
+}
+
+// account 记录 key 从 old 修改为 new，old 为 nil 表示新增，new 为 nil 表示删除
+func (ns *namespaces) account(key string, old *entry, new *entry) {
+	if ns == nil {
+		return
+	}
+
+	i := ns.find(key)
+	if i < 0 {
+		return
+	}
+
+	keys, bytes := usageDelta(key, old, new)
+	atomic.AddInt64(&ns.keys[i], keys)
+	if bytes != 0 {
+		ns.storageLock.Lock()
+		ns.settle(i, time.Now().UnixNano())
+		atomic.AddInt64(&ns.bytes[i], bytes)
+		ns.storageLock.Unlock()
+	}
+}
+
+// check 检查 key 从 old 修改为 new 之后是否会超出配额
+// 只在用量增加时检查，这样超出配额之后仍然可以删除和缩小数据
+func (ns *namespaces) check(key string, old *entry, new *entry) error {
+	if ns == nil {
+		return nil
+	}
+
+	i := ns.find(key)
+	if i < 0 {
+		return nil
+	}
+
+	namespace := ns.list[i]
+	keys, bytes := usageDelta(key, old, new)
+	if used := atomic.LoadInt64(&ns.keys[i]) + keys; keys > 0 && namespace.MaxKeys > 0 && used > namespace.MaxKeys {
+		return &QuotaError{Prefix: namespace.Prefix, Resource: "keys", Limit: namespace.MaxKeys, Used: used}
+	}
+
+	if used := atomic.LoadInt64(&ns.bytes[i]) + bytes; bytes > 0 && namespace.MaxBytes > 0 && used > namespace.MaxBytes {
+		return &QuotaError{Prefix: namespace.Prefix, Resource: "bytes", Limit: namespace.MaxBytes, Used: used}
+	}
+
+	if new != nil && namespace.MaxWriteBytes > 0 {
+		used := atomic.LoadInt64(&ns.ops[i].writeBytes) + int64(len(key)+new.size())
+		if used > namespace.MaxWriteBytes {
+			return &QuotaError{Prefix: namespace.Prefix, Resource: "write_bytes", Limit: namespace.MaxWriteBytes, Used: used}
+		}
+	}
+	return nil
+}
+
+// usageDelta 返回 key 从 old 修改为 new 时键值对个数和字节数的变化，内部 key 只占用字节数，不算作键值对
+func usageDelta(key string, old *entry, new *entry) (int64, int64) {
+	var keys, bytes int64
+	if old != nil {
+		keys--
+		bytes -= int64(len(key) + old.size())
+	}
+
+	if new != nil {
+		keys++
+		bytes += int64(len(key) + new.size())
+	}
+
+	if IsInternalKey(key) {
+		keys = 0
+	}
+	return keys, bytes
+}
+
+// recount 遍历缓存重新计算所有命名空间的用量，用于整体替换数据之后，调用者需要持有写锁
+func (ns *namespaces) recount(c *Cache) {
+	if ns == nil {
+		return
+	}
+
+	keys := make([]int64, len(ns.list))
+	bytes := make([]int64, len(ns.list))
+	c.forEach(func(key string, e *entry) bool {
+		if i := ns.find(key); i >= 0 {
+			if !IsInternalKey(key) {
+				keys[i]++
+			}
+			bytes[i] += int64(len(key) + e.size())
+		}
+		return true
+	})
+
+	ns.storageLock.Lock()
+	defer ns.storageLock.Unlock()
+	now := time.Now().UnixNano()
+	for i := range ns.list {
+		ns.settle(i, now)
+		atomic.StoreInt64(&ns.keys[i], keys[i])
+		atomic.StoreInt64(&ns.bytes[i], bytes[i])
+	}
+}
+
+// SetWithQuota 和 SetWithTTL 一样保存 key 和 value，但是写入之后会超出 key 所在命名空间的配额时返回 *QuotaError
+// 不属于任何命名空间的 key 不受限制
+func (c *Cache) SetWithQuota(key string, value []byte, ttl time.Duration) error {
+	return c.set(key, c.newEntry(utils.Copy(value), ttl), true)
+}
+
+// NamespaceUsage 返回每个命名空间的使用情况和当前计费周期内的用量，没有配置命名空间时返回 nil
+// 已经过期但还没有被清理的数据也计算在内
+func (c *Cache) NamespaceUsage() []NamespaceUsage {
+	return c.namespaceUsage(time.Now(), false)
+}
+
+// namespaceUsage 返回每个命名空间到 now 为止的使用情况，reset 为 true 时将计费周期内的用量清零
+func (c *Cache) namespaceUsage(now time.Time, reset bool) []NamespaceUsage {
+	ns := c.namespaces
+	if ns == nil {
+		return nil
+	}
+
+	ns.storageLock.Lock()
+	defer ns.storageLock.Unlock()
+	usage := make([]NamespaceUsage, len(ns.list))
+	for i, namespace := range ns.list {
+		ns.settle(i, now.UnixNano())
+		usage[i] = NamespaceUsage{
+			Prefix:        namespace.Prefix,
+			Keys:          atomic.LoadInt64(&ns.keys[i]),
+			Bytes:         atomic.LoadInt64(&ns.bytes[i]),
+			MaxKeys:       namespace.MaxKeys,
+			MaxBytes:      namespace.MaxBytes,
+			MaxWriteBytes: namespace.MaxWriteBytes,
+			ByteSeconds:   ns.byteSeconds[i],
+			OpsUsage:      ns.ops[i].load(reset),
+		}
+
+		if reset {
+			ns.byteSeconds[i] = 0
+		}
+	}
+	return usage
+}
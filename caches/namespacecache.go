@@ -0,0 +1,181 @@
+package caches
+
+import (
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// NamespacePrefix 返回名为 name 的命名空间的前缀，命名空间中的 key 在缓存中都带有这个前缀
+func NamespacePrefix(name string) string {
+	return name + ":"
+}
+
+// NamespaceStats 是一个命名空间的使用情况
+type NamespaceStats struct {
+	Name string `json:"name"`
+
+	// Keys 和 Bytes 是命名空间中键值对的个数和 key、value 的总字节数
+	Keys  int64 `json:"keys"`
+	Bytes int64 `json:"bytes"`
+
+	// Hits 和 Misses 是命名空间中的 key 被 Get 命中和没有命中的次数，没有在 Options.Namespaces 中配置的命名空间不记录
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+
+	// MaxKeys 和 MaxBytes 是命名空间的配额，为 0 表示不限制
+	MaxKeys  int64 `json:"max_keys"`
+	MaxBytes int64 `json:"max_bytes"`
+}
+
+// NamespaceCache 是缓存中一个命名空间的视图，读写的 key 会加上命名空间的前缀，不同命名空间中的同名 key 互不影响
+type NamespaceCache struct {
+	cache  *Cache
+	name   string
+	prefix string
+
+	// index 是命名空间在 Options.Namespaces 中的下标，没有配置时为 -1，这时没有默认的过期时间和配额
+	index int
+}
+
+// Namespace 返回名为 name 的命名空间，默认的过期时间、配额和命中次数来自 Options.Namespaces 中同名的命名空间
+// 没有配置的命名空间也可以使用，只是没有默认的过期时间和配额
+func (c *Cache) Namespace(name string) *NamespaceCache {
+	nc := &NamespaceCache{cache: c, name: name, prefix: NamespacePrefix(name), index: c.namespaces.named(name)}
+	if nc.index >= 0 {
+		nc.prefix = c.namespaces.list[nc.index].Prefix
+	}
+	return nc
+}
+
+// HasNamespace 返回 Options.Namespaces 中是否有名为 name 的命名空间
+func (c *Cache) HasNamespace(name string) bool {
+	return c.namespaces.named(name) >= 0
+}
+
+// NamespaceDefaultTTL 返回 key 所在的有名字的命名空间默认的过期时间，key 不在 Options.Namespaces 中有名字的命名空间中时返回 false
+func (c *Cache) NamespaceDefaultTTL(key string) (time.Duration, bool) {
+	if c.namespaces == nil {
+		return NeverExpire, false
+	}
+
+	i := c.namespaces.find(key)
+	if i < 0 || c.namespaces.list[i].Name == "" {
+		return NeverExpire, false
+	}
+	return c.namespaces.list[i].DefaultTTL, true
+}
+
+// NamespaceStats 返回 Options.Namespaces 中所有有名字的命名空间的使用情况，按照名字排列
+func (c *Cache) NamespaceStats() []NamespaceStats {
+	ns := c.namespaces
+	if ns == nil {
+		return nil
+	}
+
+	var stats []NamespaceStats
+	for _, namespace := range ns.list {
+		if namespace.Name != "" {
+			stats = append(stats, c.Namespace(namespace.Name).Stats())
+		}
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Name < stats[j].Name
+	})
+	return stats
+}
+
+// Name 返回命名空间的名字
+func (nc *NamespaceCache) Name() string {
+	return nc.name
+}
+
+// Key 返回命名空间中的 key 在缓存中的 key
+func (nc *NamespaceCache) Key(key string) string {
+	return nc.prefix + key
+}
+
+// DefaultTTL 返回 Set 使用的过期时间，为 0 表示永不过期
+func (nc *NamespaceCache) DefaultTTL() time.Duration {
+	if nc.index < 0 {
+		return NeverExpire
+	}
+	return nc.cache.namespaces.list[nc.index].DefaultTTL
+}
+
+// Get 返回命名空间中 key 对应的 value
+func (nc *NamespaceCache) Get(key string) ([]byte, bool) {
+	return nc.cache.Get(nc.Key(key))
+}
+
+// Set 使用命名空间默认的过期时间保存 key 和 value，写入之后会超出命名空间的配额时返回 *QuotaError
+func (nc *NamespaceCache) Set(key string, value []byte) error {
+	return nc.SetWithTTL(key, value, nc.DefaultTTL())
+}
+
+// SetWithTTL 保存 key 和 value，ttl 之后过期，写入之后会超出命名空间的配额时返回 *QuotaError
+func (nc *NamespaceCache) SetWithTTL(key string, value []byte, ttl time.Duration) error {
+	return nc.cache.SetWithQuota(nc.Key(key), value, ttl)
+}
+
+// Delete 删除命名空间中的 key
+func (nc *NamespaceCache) Delete(key string) {
+	nc.cache.Delete(nc.Key(key))
+}
+
+// Flush 删除命名空间中所有的 key，返回删除的没有过期的 key 的个数，其他命名空间中的 key 不受影响
+func (nc *NamespaceCache) Flush() int {
+	c := nc.cache
+	defer c.counters.deleteLatency.Since(time.Now())
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := c.now().UnixNano()
+	var keys []string
+	deleted := 0
+	c.forEach(func(key string, e *entry) bool {
+		if strings.HasPrefix(key, nc.prefix) {
+			keys = append(keys, key)
+			if e.alive(now) && !IsInternalKey(key) {
+				deleted++
+			}
+		}
+		return true
+	})
+
+	for _, key := range keys {
+		c.deleteLocked(key)
+	}
+	return deleted
+}
+
+// Stats 返回命名空间的使用情况，没有在 Options.Namespaces 中配置的命名空间需要遍历整个缓存计算，期间会持有读锁
+func (nc *NamespaceCache) Stats() NamespaceStats {
+	stats := NamespaceStats{Name: nc.name}
+	if nc.index >= 0 {
+		ns := nc.cache.namespaces
+		namespace := ns.list[nc.index]
+		stats.Keys = atomic.LoadInt64(&ns.keys[nc.index])
+		stats.Bytes = atomic.LoadInt64(&ns.bytes[nc.index])
+		stats.Hits = atomic.LoadInt64(&ns.hits[nc.index])
+		stats.Misses = atomic.LoadInt64(&ns.misses[nc.index])
+		stats.MaxKeys, stats.MaxBytes = namespace.MaxKeys, namespace.MaxBytes
+		return stats
+	}
+
+	c := nc.cache
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	c.forEach(func(key string, e *entry) bool {
+		if strings.HasPrefix(key, nc.prefix) {
+			if !IsInternalKey(key) {
+				stats.Keys++
+			}
+			stats.Bytes += int64(len(key) + e.size())
+		}
+		return true
+	})
+	return stats
+}
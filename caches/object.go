@@ -0,0 +1,129 @@
+package caches
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// TypeString 是字符串类型，目前所有的 value 都是这个类型
+	TypeString = "string"
+
+	// TypeNone 表示 key 不存在
+	TypeNone = "none"
+)
+
+// 下面是 value 的编码，Object 按顺序返回第一个符合的编码
+const (
+	// EncodingInt 表示 value 是十进制的 64 位整数
+	EncodingInt = "int"
+
+	// EncodingJSON 表示 value 是 JSON 对象或者数组
+	EncodingJSON = "json"
+
+	// EncodingUTF8 表示 value 是合法的 UTF-8 字符串
+	EncodingUTF8 = "utf8"
+
+	// EncodingBinary 表示 value 是其他的二进制数据
+	EncodingBinary = "binary"
+)
+
+// ObjectInfo 是一个 key 的内部信息，用于调试
+type ObjectInfo struct {
+	// Type 是 value 的类型
+	Type string `json:"type"`
+
+	// Encoding 是 value 的编码，见 EncodingInt 等常量
+	Encoding string `json:"encoding"`
+
+	// Size 是 key 和 value 占用的字节数，和 Stats.Bytes 的计算方式一样，不包括数据结构本身的开销，value 压缩过时是压缩之后的大小
+	Size int `json:"size"`
+
+	// Compression 是 value 在内存中的压缩算法，没有压缩时为 none
+	Compression string `json:"compression"`
+
+	// IdleSeconds 是距离最后一次读取或者写入的秒数，加载之后还没有被访问过时为 -1
+	IdleSeconds int64 `json:"idle_seconds"`
+
+	// TTLMillis 是剩余的存活时间，单位是毫秒，永不过期时为 -1
+	TTLMillis int64 `json:"ttl_ms"`
+
+	// ExpireAtMillis 是过期的时间点，单位是 Unix 毫秒，永不过期时为 0
+	ExpireAtMillis int64 `json:"expire_at_ms"`
+
+	// Version 是 value 的版本号
+	Version uint64 `json:"version"`
+
+	// Priority 是淘汰时的优先级，见 Priority
+	Priority string `json:"priority"`
+}
+
+// Type 返回 key 的类型，key 不存在或者已经过期时返回 TypeNone，不算作一次读取
+func (c *Cache) Type(key string) string {
+	if _, ok := c.Object(key); !ok {
+		return TypeNone
+	}
+	return TypeString
+}
+
+// Object 返回 key 的内部信息，key 不存在、已经过期或者是内部 key 时返回 false，大对象的 Size 包括所有的分片
+// 和 Redis 的 OBJECT 命令一样，查看内部信息不算作一次读取，不会影响空闲时间和淘汰顺序
+func (c *Cache) Object(key string) (ObjectInfo, bool) {
+	unlock := c.rlockKey(key)
+	e, ok := c.lookup(key)
+	unlock()
+
+	now := c.now().UnixNano()
+	if !ok || !e.alive(now) || IsInternalKey(key) {
+		return ObjectInfo{}, false
+	}
+
+	// 大对象不拼接分片，编码总是 binary
+	size := e.size()
+	encoding := EncodingBinary
+	if m, ok := c.manifestIn(e); ok {
+		size = int(m.Size)
+	} else if value, err := e.data(); err == nil {
+		encoding = valueEncoding(value)
+	}
+
+	info := ObjectInfo{
+		Type:        TypeString,
+		Encoding:    encoding,
+		Size:        len(key) + size,
+		Compression: e.compression.String(),
+		IdleSeconds: -1,
+		TTLMillis:   -1,
+		Version:     e.version,
+		Priority:    e.priority.String(),
+	}
+
+	if accessedAt := atomic.LoadInt64(&e.accessedAt); accessedAt > 0 {
+		info.IdleSeconds = int64(time.Duration(now-accessedAt) / time.Second)
+	}
+
+	if e.expireAt != 0 {
+		info.TTLMillis = e.ttl(now).Milliseconds()
+		info.ExpireAtMillis = time.Duration(e.expireAt).Milliseconds()
+	}
+	return info, true
+}
+
+// valueEncoding 返回 value 的编码
+func valueEncoding(value []byte) string {
+	if _, err := strconv.ParseInt(string(value), 10, 64); err == nil {
+		return EncodingInt
+	}
+
+	if len(value) > 0 && (value[0] == '{' || value[0] == '[') && json.Valid(value) {
+		return EncodingJSON
+	}
+
+	if utf8.Valid(value) {
+		return EncodingUTF8
+	}
+	return EncodingBinary
+}
@@ -0,0 +1,126 @@
+package caches
+
+import (
+	"fmt"
+	"time"
+)
+
+// LoadTTLMode 是加载持久化文件时处理过期时间的方式
+type LoadTTLMode int
+
+const (
+	// LoadTTLAbsolute 表示保持持久化时的绝对过期时间，停机期间也算在存活时间里
+	LoadTTLAbsolute LoadTTLMode = iota
+
+	// LoadTTLRelative 表示保持持久化时剩余的存活时间，停机期间不算在存活时间里
+	LoadTTLRelative
+)
+
+// ParseLoadTTLMode 解析加载时处理过期时间的方式，可选值为 absolute 和 relative
+func ParseLoadTTLMode(s string) (LoadTTLMode, error) {
+	switch s {
+	case "absolute":
+		return LoadTTLAbsolute, nil
+	case "relative":
+		return LoadTTLRelative, nil
+	}
+	return 0, fmt.Errorf("caches: invalid load ttl mode %q", s)
+}
+
+// Options 是创建缓存时的选项
+type Options struct {
+	// Codec 是持久化时使用的编码方式
+	Codec Codec
+
+	// KeyProvider 提供加密持久化文件使用的密钥，为 nil 表示不加密
+	KeyProvider KeyProvider
+
+	// AOF 记录所有修改缓存的操作，用于恢复到任意时间点的状态，为 nil 表示不记录
+	AOF *AOF
+
+	// RateLimiter 限制持久化写入的速度，为 nil 表示不限速
+	RateLimiter *RateLimiter
+
+	// LoadTTLMode 是加载持久化文件时处理过期时间的方式
+	LoadTTLMode LoadTTLMode
+
+	// PrefixGroups 是统计使用情况的 key 前缀分组，比如 "session:*"，为空表示不分组统计
+	PrefixGroups []string
+
+	// Namespaces 是需要记录用量和限制配额的命名空间，为空表示没有命名空间
+	Namespaces []Namespace
+
+	// LockFreeReads 表示 Get 是否从原子替换的只读视图中读取，读取时完全不加锁，适合读远多于写的场景
+	// 写入在锁内生效之后再批量发布到只读视图，Get 读到写入的结果最多延迟 PublishDelay
+	LockFreeReads bool
+
+	// PublishDelay 是开启 LockFreeReads 时写入发布到只读视图的最长延迟，为 0 表示使用默认的 1ms
+	PublishDelay time.Duration
+
+	// PublishBatch 是开启 LockFreeReads 时累计多少个写入后立即发布，为 0 表示使用默认的 1024
+	PublishBatch int
+
+	// ReadShards 是开启 LockFreeReads 时只读视图的分片数，会向上取整到 2 的幂，为 0 表示使用 AutoShards 的结果
+	ReadShards int
+
+	// AutoReshard 表示开启 LockFreeReads 时，每次发布复制的分片太大时是否自动将分片数翻倍
+	AutoReshard bool
+
+	// MaxEntries 是最多的键值对个数，写入之后超出时按照 EvictionPolicy 淘汰 key，为 0 表示不限制
+	MaxEntries int64
+
+	// MaxBytes 是 key 和 value 最多占用的总字节数，写入之后超出时按照 EvictionPolicy 淘汰 key，为 0 表示不限制
+	MaxBytes int64
+
+	// EvictionPolicy 是超出 MaxEntries 或者 MaxBytes 时的淘汰策略，为 nil 时使用 LRU，每个缓存需要使用单独的实例
+	EvictionPolicy EvictionPolicy
+
+	// RejectWhenFull 为 true 时写入之后会超出 MaxEntries 或者 MaxBytes 的写入会被拒绝，而不是淘汰已有的 key
+	// 和 Admission 一样只影响 Set 这样保存数据的写入，返回错误的方法返回 ErrCacheFull，其他写入仍然会在超出时淘汰 key
+	RejectWhenFull bool
+
+	// StaleGrace 是过期的数据继续保留的时间，Gc 在过期超过 StaleGrace 之后才会清理，这期间可以通过 GetStale 读取
+	// 用于后端不可用时返回过期的数据，为 0 表示过期之后就可以清理
+	StaleGrace time.Duration
+
+	// Admission 是缓存已满时是否接受新的 key 的准入策略，只在设置了 MaxEntries 或者 MaxBytes 时生效，为 nil 表示接受所有写入
+	// 只有 Set 这样保存数据的写入会被拒绝，锁、会话和计数器这些有自己语义的写入不受影响
+	Admission AdmissionPolicy
+
+	// Compression 是超过 CompressionThreshold 字节的 value 在内存中的压缩算法，为 CompressionNone 表示不压缩
+	// 保存数据、复制和加载的 value 会压缩，锁和会话这些内部的数据不压缩，压缩之后没有变小的 value 保持原样，持久化和复制时使用解压之后的 value
+	Compression Compression
+
+	// CompressionThreshold 是需要压缩的 value 的最小字节数，不超过它的 value 不压缩
+	CompressionThreshold int
+
+	// ChunkSize 是分块保存 value 时每块的字节数，通过 SetFrom 写入的超过 ChunkSize 的 value 保存成一串 ChunkSize 大小的块
+	// 写入时不需要把整个 value 读到一块连续的内存中，读取时可以使用 GetReader 逐块输出，为 0 表示不分块
+	ChunkSize int
+
+	// LargeObjectThreshold 是大对象的分片大小，通过 SetFrom 写入的超过它的 value 分成多个不超过它的分片，每个分片保存成一个内部的 key
+	// key 本身保存记录了分片的清单，读取时透明地拼接，单个 key 的 value 不会超过它，持久化和复制也是逐个分片进行，为 0 表示不分片
+	LargeObjectThreshold int
+
+	// Checksums 表示是否在保存 value 时计算 CRC32 校验和，开启之后可以使用 Verify 找出在内存中损坏的 value，每次写入会多一些开销
+	Checksums bool
+
+	// Clock 是计算过期时间使用的时钟，为 nil 时使用 SystemClock
+	Clock Clock
+
+	// Segments 是数据的分片数，每个分片有自己的锁，不同分片上的读写可以并行，会向上取整到 2 的幂，为 0 表示使用默认的 256
+	Segments int
+
+	// Deterministic 表示缓存是否在确定性模式下运行，用于基于模型的测试和模糊测试，见 NewDeterministicCache
+	Deterministic bool
+
+	// Seed 是确定性模式下随机数的种子
+	Seed int64
+}
+
+// DefaultOptions 返回默认的选项
+func DefaultOptions() Options {
+	return Options{
+		Codec: GobCodec{},
+	}
+}
@@ -0,0 +1,125 @@
+package caches
+
+import (
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// OtherPrefix 是不属于任何前缀分组的 key 所在的分组
+const OtherPrefix = "*"
+
+// PrefixStats 是一个 key 前缀分组的使用情况
+type PrefixStats struct {
+	// Prefix 是分组的前缀，不属于任何分组的 key 统计在 OtherPrefix 中
+	Prefix string `json:"prefix"`
+
+	// Keys 和 Bytes 是分组中键值对的个数和 key、value 的总字节数
+	Keys  int64 `json:"keys"`
+	Bytes int64 `json:"bytes"`
+
+	// Hits 和 Misses 是分组中的 key 被 Get 命中和没有命中的次数
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+
+	// OpsUsage 是分组在当前计费周期内的操作用量
+	OpsUsage
+}
+
+// prefixGroups 按照 key 的前缀分组统计命中次数
+type prefixGroups struct {
+	// prefixes 是所有分组的前缀，按照长度从长到短排列，保证 key 被分到最长的匹配前缀中
+	prefixes []string
+
+	// hits 和 misses 是每个分组的命中次数，最后一个元素是 OtherPrefix 分组
+	hits   []int64
+	misses []int64
+
+	// ops 是每个分组在当前计费周期内的操作用量，最后一个元素是 OtherPrefix 分组
+	ops []opsCounters
+}
+
+// newPrefixGroups 返回使用 patterns 分组的 prefixGroups，pattern 末尾的 * 会被忽略，比如 "session:*" 和 "session:" 是一样的
+// 没有分组时返回 nil
+func newPrefixGroups(patterns []string) *prefixGroups {
+	seen := make(map[string]bool)
+	prefixes := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		prefix := strings.TrimSuffix(pattern, "*")
+		if prefix != "" && !seen[prefix] {
+			seen[prefix] = true
+			prefixes = append(prefixes, prefix)
+		}
+	}
+
+	if len(prefixes) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(prefixes, func(i, j int) bool {
+		return len(prefixes[i]) > len(prefixes[j])
+	})
+
+	return &prefixGroups{
+		prefixes: prefixes,
+		hits:     make([]int64, len(prefixes)+1),
+		misses:   make([]int64, len(prefixes)+1),
+		ops:      make([]opsCounters, len(prefixes)+1),
+	}
+}
+
+// group 返回 key 所在分组的下标，不属于任何分组时返回 OtherPrefix 分组的下标
+func (pg *prefixGroups) group(key string) int {
+	for i, prefix := range pg.prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return i
+		}
+	}
+	return len(pg.prefixes)
+}
+
+// record 记录一次 Get 的结果
+func (pg *prefixGroups) record(key string, hit bool) {
+	if hit {
+		atomic.AddInt64(&pg.hits[pg.group(key)], 1)
+		return
+	}
+	atomic.AddInt64(&pg.misses[pg.group(key)], 1)
+}
+
+// PrefixStats 返回每个前缀分组的使用情况，没有配置前缀分组时返回 nil
+// 键值对个数和字节数需要遍历整个缓存计算，期间会持有读锁
+func (c *Cache) PrefixStats() []PrefixStats {
+	return c.prefixStats(false)
+}
+
+// prefixStats 返回每个前缀分组的使用情况，reset 为 true 时将计费周期内的操作用量清零
+func (c *Cache) prefixStats(reset bool) []PrefixStats {
+	pg := c.prefixes
+	if pg == nil {
+		return nil
+	}
+
+	stats := make([]PrefixStats, len(pg.prefixes)+1)
+	for i := range stats {
+		stats[i].Prefix = OtherPrefix
+		if i < len(pg.prefixes) {
+			stats[i].Prefix = pg.prefixes[i]
+		}
+		stats[i].Hits = atomic.LoadInt64(&pg.hits[i])
+		stats[i].Misses = atomic.LoadInt64(&pg.misses[i])
+		stats[i].OpsUsage = pg.ops[i].load(reset)
+	}
+
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	c.forEach(func(key string, e *entry) bool {
+		group := &stats[pg.group(key)]
+		if !IsInternalKey(key) {
+			group.Keys++
+		}
+		group.Bytes += int64(len(key) + e.size())
+		return true
+	})
+	return stats
+}
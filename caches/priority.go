@@ -0,0 +1,76 @@
+package caches
+
+import (
+	"fmt"
+	"time"
+
+	"gocache/utils"
+)
+
+// Priority 是 key 的淘汰优先级，缓存超出 MaxEntries 或者 MaxBytes 时先淘汰优先级低的 key
+// 同一个优先级中的 key 按照淘汰策略的顺序淘汰
+type Priority int8
+
+const (
+	// PriorityLow 适合可以很容易重新计算出来的数据，会被最先淘汰
+	PriorityLow Priority = -1
+
+	// PriorityNormal 是默认的优先级
+	PriorityNormal Priority = 0
+
+	// PriorityHigh 适合重建代价很高的数据，只有没有其他优先级的 key 时才会被淘汰
+	PriorityHigh Priority = 1
+)
+
+// priorityLevels 是优先级的个数
+const priorityLevels = 3
+
+// ParsePriority 解析优先级的名字，可选值为 low、normal 和 high，空字符串表示 normal
+func ParsePriority(name string) (Priority, error) {
+	switch name {
+	case "low":
+		return PriorityLow, nil
+	case "", "normal":
+		return PriorityNormal, nil
+	case "high":
+		return PriorityHigh, nil
+	}
+	return PriorityNormal, fmt.Errorf("caches: unknown priority %q", name)
+}
+
+// priorityNames 是按照 index 排列的优先级的名字
+var priorityNames = [priorityLevels]string{"low", "normal", "high"}
+
+// String 返回优先级的名字
+func (p Priority) String() string {
+	return priorityNames[p.index()]
+}
+
+// index 返回优先级在 evictor.policies 中的下标，越界的值按照最接近的优先级处理
+func (p Priority) index() int {
+	if p < PriorityLow {
+		p = PriorityLow
+	} else if p > PriorityHigh {
+		p = PriorityHigh
+	}
+	return int(p - PriorityLow)
+}
+
+// SetWithPriority 和 SetWithTTL 一样保存 key 和 value，并指定淘汰时的优先级
+// 优先级只影响淘汰的顺序，不会持久化，从持久化文件中加载的 key 都是 PriorityNormal
+// 修改过期时间、Incr 和 Update 会保留原来的优先级，其他写入会重置为写入时指定的优先级
+func (c *Cache) SetWithPriority(key string, value []byte, ttl time.Duration, priority Priority) {
+	c.set(key, c.newPriorityEntry(value, ttl, priority), false)
+}
+
+// SetWithPriorityAndQuota 和 SetWithPriority 一样保存 key 和 value，但是和 SetWithQuota 一样检查命名空间的配额
+func (c *Cache) SetWithPriorityAndQuota(key string, value []byte, ttl time.Duration, priority Priority) error {
+	return c.set(key, c.newPriorityEntry(value, ttl, priority), true)
+}
+
+// newPriorityEntry 返回保存 value 的拷贝、优先级为 priority 的 entry
+func (c *Cache) newPriorityEntry(value []byte, ttl time.Duration, priority Priority) *entry {
+	e := c.newEntry(utils.Copy(value), ttl)
+	e.priority = priority
+	return e
+}
@@ -0,0 +1,231 @@
+package caches
+
+import (
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// defaultPublishDelay 是默认的写入发布到只读视图的最长延迟
+	defaultPublishDelay = time.Millisecond
+
+	// defaultPublishBatch 是默认的立即发布需要累计的写入个数
+	defaultPublishBatch = 1024
+)
+
+const (
+	// maxCopyRatio 是开启自动重新分片时平均每个写入导致复制的数据个数的上限，超过时重新分片
+	maxCopyRatio = 64
+
+	// targetShardSize 是重新分片时每个分片平均的数据个数
+	targetShardSize = 16
+)
+
+// maxReadShards 是只读视图最多的分片数
+const maxReadShards = 65536
+
+// readView 是无锁读取使用的只读视图，由多个分片组成，每个分片都是发布之后不会再修改的 map
+// 写入不会直接修改视图，而是先记录到 pending 中，批量发布时复制被修改过的分片并应用修改，再原子地替换掉整个分片表
+// 这样读取只需要一次原子加载，不需要加锁，代价是写入最多延迟 delay 才能被读到
+type readView struct {
+	// table 是分片表，类型是 []map[string]*entry，分片数是 2 的幂，发布之后不会再修改
+	table atomic.Value
+
+	// pending 是还没有发布的修改，值为 nil 表示 key 被删除了，由缓存的写锁保护
+	pending map[string]*entry
+
+	// timer 在第一个没有发布的修改出现后 delay 触发发布，为 nil 表示没有等待中的发布
+	timer *time.Timer
+
+	// delay 和 batch 是发布的最长延迟和立即发布需要累计的修改个数
+	delay time.Duration
+	batch int
+
+	// autoReshard 表示发布时复制的分片太大时是否自动将分片数翻倍
+	autoReshard bool
+
+	// shards 是当前的分片数，reshards 是自动重新分片的次数
+	shards   int64
+	reshards int64
+}
+
+// newReadView 返回空的只读视图，enabled 为 false 时返回 nil，表示不使用无锁读取
+// shards 是分片数，会向上取整到 2 的幂，为 0 时根据 CPU 个数自动选择
+func newReadView(enabled bool, shards int, autoReshard bool, delay time.Duration, batch int) *readView {
+	if !enabled {
+		return nil
+	}
+
+	if shards <= 0 {
+		shards = AutoShards()
+	}
+
+	if delay <= 0 {
+		delay = defaultPublishDelay
+	}
+
+	if batch <= 0 {
+		batch = defaultPublishBatch
+	}
+
+	v := &readView{pending: make(map[string]*entry), delay: delay, batch: batch, autoReshard: autoReshard}
+	v.store(newShardTable(roundShards(shards)))
+	return v
+}
+
+// AutoShards 返回根据 CPU 个数选择的分片数，每个 CPU 16 个分片，最少 64 个，最多 4096 个
+// 同时写入的协程越多，每次发布涉及的分片越多，分片更小可以减少每次发布复制的数据量
+func AutoShards() int {
+	shards := runtime.NumCPU() * 16
+	if shards < 64 {
+		return 64
+	}
+
+	if shards > 4096 {
+		return 4096
+	}
+	return roundShards(shards)
+}
+
+// roundShards 将 n 向上取整到 2 的幂，这样可以使用位运算代替取模
+func roundShards(n int) int {
+	shards := 1
+	for shards < n {
+		shards <<= 1
+	}
+	return shards
+}
+
+// newShardTable 返回有 n 个空分片的分片表
+func newShardTable(n int) []map[string]*entry {
+	table := make([]map[string]*entry, n)
+	for i := range table {
+		table[i] = make(map[string]*entry)
+	}
+	return table
+}
+
+// shardOf 返回 key 在有 n 个分片的分片表中的位置，使用 FNV-1a 哈希，不需要分配内存
+func shardOf(key string, n int) int {
+	hash := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint32(key[i])
+		hash *= 16777619
+	}
+	return int(hash & uint32(n-1))
+}
+
+// load 不加锁地查找 key 对应的 entry，返回的 entry 可能已经过期了
+func (v *readView) load(key string) (*entry, bool) {
+	table := v.table.Load().([]map[string]*entry)
+	e, ok := table[shardOf(key, len(table))][key]
+	return e, ok
+}
+
+// store 发布新的分片表
+func (v *readView) store(table []map[string]*entry) {
+	v.table.Store(table)
+	atomic.StoreInt64(&v.shards, int64(len(table)))
+}
+
+// record 记录 key 被修改成了 e，e 为 nil 表示被删除，累计的修改足够多时立即发布，调用者需要持有写锁
+func (v *readView) record(c *Cache, key string, e *entry) {
+	if v == nil {
+		return
+	}
+
+	v.pending[key] = e
+	if len(v.pending) >= v.batch {
+		v.publish(c)
+		return
+	}
+
+	if v.timer == nil {
+		v.timer = time.AfterFunc(v.delay, func() {
+			c.lock.Lock()
+			defer c.lock.Unlock()
+			v.publish(c)
+		})
+	}
+}
+
+// publish 将没有发布的修改应用到只读视图中，调用者需要持有写锁
+// 开启了自动重新分片时，如果平均每个写入复制了超过 maxCopyRatio 个数据，说明分片太少，写入集中在少数大分片上
+// 这时按照每个分片 targetShardSize 个数据重新生成分片表，分片数至少翻倍，之后的发布只需要复制更小的分片
+func (v *readView) publish(c *Cache) {
+	v.stopTimer()
+	if len(v.pending) == 0 {
+		return
+	}
+
+	old := v.table.Load().([]map[string]*entry)
+	table := make([]map[string]*entry, len(old))
+	copy(table, old)
+
+	writes, copied := len(v.pending), 0
+	changed := make(map[int]bool)
+	for key, e := range v.pending {
+		index := shardOf(key, len(table))
+		if !changed[index] {
+			shard := make(map[string]*entry, len(old[index])+1)
+			for k, oe := range old[index] {
+				shard[k] = oe
+			}
+			table[index] = shard
+			changed[index] = true
+			copied += len(shard)
+		}
+
+		if e == nil {
+			delete(table[index], key)
+		} else {
+			table[index][key] = e
+		}
+	}
+
+	v.store(table)
+	v.pending = make(map[string]*entry)
+
+	if v.autoReshard && copied > maxCopyRatio*writes && len(table) < maxReadShards {
+		shards := roundShards(int(atomic.LoadInt64(&c.count)) / targetShardSize)
+		if shards < len(table)*2 {
+			shards = len(table) * 2
+		}
+
+		if shards > maxReadShards {
+			shards = maxReadShards
+		}
+		v.resize(c, shards)
+		atomic.AddInt64(&v.reshards, 1)
+	}
+}
+
+// rebuild 丢弃没有发布的修改，使用缓存中的数据重新生成所有分片，用于整体替换数据之后，调用者需要持有写锁
+func (v *readView) rebuild(c *Cache) {
+	if v == nil {
+		return
+	}
+
+	v.stopTimer()
+	v.pending = make(map[string]*entry)
+	v.resize(c, len(v.table.Load().([]map[string]*entry)))
+}
+
+// resize 使用缓存中的数据生成有 n 个分片的分片表，调用者需要持有写锁，并且没有未发布的修改
+func (v *readView) resize(c *Cache, n int) {
+	table := newShardTable(n)
+	c.forEach(func(key string, e *entry) bool {
+		table[shardOf(key, n)][key] = e
+		return true
+	})
+	v.store(table)
+}
+
+// stopTimer 取消等待中的发布
+func (v *readView) stopTimer() {
+	if v.timer != nil {
+		v.timer.Stop()
+		v.timer = nil
+	}
+}
@@ -0,0 +1,145 @@
+package caches
+
+import (
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// RestoreToTime 将缓存恢复到 t 时刻的状态，用于误删或者误清空数据之后的恢复
+// snapshots 是可以作为起点的持久化文件或者增量持久化目录，会选择其中 t 之前最新的状态，再重放 AOF 中从那之后到 t 为止的操作
+// 没有可用的持久化文件时会从空的缓存开始重放整个 AOF，所以这时 AOF 需要是从空的缓存开始记录的，或者是重写过的
+// 恢复的操作不会写入 AOF，所以恢复之后应该立即进行一次持久化，作为之后恢复的起点
+func (c *Cache) RestoreToTime(aofPath string, t time.Time, snapshots ...string) error {
+	return c.replay(aofPath, t.UnixNano(), snapshots, false)
+}
+
+// LoadWithAOF 从 snapshots 中最新的持久化文件或者增量持久化目录恢复数据，再重放 AOF 中从那之后的所有操作，用于启动时恢复到停止前的状态
+// 不存在的持久化文件会被忽略，AOF 不存在时只恢复持久化文件，都不存在时返回 os.ErrNotExist
+// 和 RestoreToTime 一样，恢复之后应该尽快进行一次持久化
+func (c *Cache) LoadWithAOF(aofPath string, snapshots ...string) error {
+	return c.replay(aofPath, math.MaxInt64, snapshots, true)
+}
+
+// replay 使用 snapshots 中 until 之前最新的状态和 AOF 中从那之后到 until 为止的操作替换掉缓存中的数据
+// missingOK 为 true 时忽略不存在的文件，但是所有文件都不存在时返回 os.ErrNotExist
+func (c *Cache) replay(aofPath string, until int64, snapshots []string, missingOK bool) error {
+	aead, err := newAEAD(c.options.KeyProvider)
+	if err != nil {
+		return err
+	}
+
+	data := make(map[string]*entry, 256)
+	var since int64
+	found := false
+	for _, path := range snapshots {
+		candidate, createdAt, err := restoreCandidate(path, until, aead)
+		if missingOK && errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		found = true
+		if candidate != nil && createdAt > since {
+			data, since = candidate, createdAt
+		}
+	}
+
+	err = ReadAOF(aofPath, c.options.KeyProvider, func(op Op) bool {
+		// 不同分片上的操作记录到 AOF 的顺序和操作的时间不一定一致，所以不能在超过 until 时停止读取
+		if op.Time >= since && op.Time <= until {
+			applyOp(data, op)
+		}
+		return true
+	})
+
+	switch {
+	case missingOK && errors.Is(err, os.ErrNotExist):
+		if !found {
+			return err
+		}
+	case err != nil:
+		return err
+	}
+
+	c.saveLock.Lock()
+	defer c.saveLock.Unlock()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.replaceData(data)
+	c.namespaces.recount(c)
+	c.eviction.recount(c)
+	c.view.rebuild(c)
+	c.changed = nil
+	// 恢复后的数据还没有被持久化，需要让自动保存尽快保存一次
+	atomic.StoreInt64(&c.dirty, int64(len(data))+1)
+	return nil
+}
+
+// restoreCandidate 读取 path 指定的持久化文件或者增量持久化目录中在 until 之前最新的状态
+// 没有 until 之前的状态时返回 nil
+func restoreCandidate(path string, until int64, aead cipher.AEAD) (map[string]*entry, int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if !info.IsDir() {
+		snap, err := readSnapshotFile(path, aead)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if snap.incremental || snap.header.CreatedAt > until {
+			return nil, 0, nil
+		}
+		return snap.data, snap.header.CreatedAt, nil
+	}
+
+	manifest, err := ReadManifest(path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// 按顺序应用持久化文件链，直到遇到 until 之后的文件
+	var data map[string]*entry
+	var createdAt int64
+	files := append([]string{manifest.Base}, manifest.Incrementals...)
+	for i, name := range files {
+		snap, err := readSnapshotFile(filepath.Join(path, name), aead)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if i == 0 && snap.incremental {
+			return nil, 0, fmt.Errorf("caches: base snapshot %s is incremental", name)
+		}
+
+		if snap.header.CreatedAt > until {
+			break
+		}
+
+		if data == nil {
+			data = make(map[string]*entry, len(snap.data))
+		}
+
+		for key, value := range snap.data {
+			data[key] = value
+		}
+
+		for _, key := range snap.deleted {
+			delete(data, key)
+		}
+		createdAt = snap.header.CreatedAt
+	}
+	return data, createdAt, nil
+}
@@ -0,0 +1,173 @@
+package caches
+
+import (
+	"errors"
+	"gocache/utils"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// Subscription 是对缓存修改操作的订阅，用于把修改复制到其他节点
+type Subscription struct {
+	// ops 是订阅之后的修改操作，订阅者跟不上修改的速度或者缓存的数据被整体替换时会被关闭
+	ops chan Op
+}
+
+// Ops 返回订阅之后的修改操作，通道被关闭说明订阅已经失效，需要重新订阅并全量同步
+func (s *Subscription) Ops() <-chan Op {
+	return s.ops
+}
+
+// subscribers 是缓存所有的订阅者
+type subscribers struct {
+	// count 是订阅者的个数，需要原子地读取，没有订阅者时修改操作不需要加锁
+	count int32
+
+	lock sync.Mutex
+	subs map[*Subscription]struct{}
+}
+
+// active 返回是否有订阅者
+func (s *subscribers) active() bool {
+	return atomic.LoadInt32(&s.count) > 0
+}
+
+// add 添加订阅者
+func (s *subscribers) add(sub *Subscription) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.subs == nil {
+		s.subs = make(map[*Subscription]struct{})
+	}
+	s.subs[sub] = struct{}{}
+	atomic.StoreInt32(&s.count, int32(len(s.subs)))
+}
+
+// remove 移除订阅者并关闭它的通道，已经被移除时什么都不做
+func (s *subscribers) remove(sub *Subscription) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.removeLocked(sub)
+}
+
+// removeLocked 移除订阅者并关闭它的通道，调用者需要持有 s.lock
+func (s *subscribers) removeLocked(sub *Subscription) {
+	if _, ok := s.subs[sub]; ok {
+		delete(s.subs, sub)
+		close(sub.ops)
+		atomic.StoreInt32(&s.count, int32(len(s.subs)))
+	}
+}
+
+// publish 把操作发送给所有订阅者，缓冲区已经满了的订阅者会被移除，不会阻塞修改缓存的协程
+func (s *subscribers) publish(op Op) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for sub := range s.subs {
+		select {
+		case sub.ops <- op:
+		default:
+			s.removeLocked(sub)
+		}
+	}
+}
+
+// closeAll 移除所有订阅者，缓存的数据被整体替换时调用，订阅者需要重新全量同步
+func (s *subscribers) closeAll() {
+	if !s.active() {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for sub := range s.subs {
+		s.removeLocked(sub)
+	}
+}
+
+// Subscribe 订阅缓存的修改操作，返回订阅时缓存中所有没有过期的数据，之后的修改都会发送到订阅的通道中
+// buffer 是通道的缓冲区大小，订阅者跟不上修改的速度导致缓冲区写满时订阅会被关闭
+// 返回的数据和之后的修改操作之间没有遗漏和重复，收集数据期间会持有写锁
+func (c *Cache) Subscribe(buffer int) (*Subscription, []Entry) {
+	sub := &Subscription{ops: make(chan Op, buffer)}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	now := c.now().UnixNano()
+	entries := make([]Entry, 0, atomic.LoadInt64(&c.count))
+	c.forEach(func(key string, e *entry) bool {
+		if item, ok := entryOf(key, e); ok && e.alive(now) {
+			entries = append(entries, item)
+		}
+		return true
+	})
+	c.subscribers.add(sub)
+	return sub, entries
+}
+
+// Unsubscribe 取消订阅，订阅的通道会被关闭
+func (c *Cache) Unsubscribe(sub *Subscription) {
+	c.subscribers.remove(sub)
+}
+
+// Subscribers 返回订阅者的个数
+func (c *Cache) Subscribers() int {
+	return int(atomic.LoadInt32(&c.subscribers.count))
+}
+
+// ReplaceEntries 使用 entries 替换掉缓存中所有的数据，已经过期的数据会被忽略，用于副本的全量同步
+// 开启了 AOF 时会重写 AOF，让它和新的数据一致
+func (c *Cache) ReplaceEntries(entries []Entry) error {
+	now := c.now().UnixNano()
+	data := make(map[string]*entry, len(entries))
+	for _, item := range entries {
+		e := markLarge(&entry{value: item.Value, expireAt: item.ExpireAt})
+		if e.alive(now) {
+			data[item.Key] = e
+		}
+	}
+
+	c.saveLock.Lock()
+	c.lock.Lock()
+	c.replaceData(data)
+	c.namespaces.recount(c)
+	c.eviction.recount(c)
+	c.view.rebuild(c)
+	c.changed = nil
+	// 同步过来的数据还没有被持久化，需要让自动保存尽快保存一次
+	atomic.StoreInt64(&c.dirty, int64(len(data))+1)
+	c.lock.Unlock()
+	c.saveLock.Unlock()
+
+	if err := c.RewriteAOF(); err != nil && !errors.Is(err, ErrNoAOF) {
+		return err
+	}
+	return nil
+}
+
+// ApplyOp 把其他节点的修改操作应用到缓存上，用于副本接收主节点的修改
+func (c *Cache) ApplyOp(op Op) {
+	switch op.Type {
+	case OpSet:
+		c.setEntry(op.Key, markLarge(&entry{value: utils.Copy(op.Value), expireAt: op.ExpireAt}))
+	case OpDelete:
+		c.Delete(op.Key)
+	case OpClear:
+		c.ReplaceEntries(nil)
+	}
+}
+
+// WriteOp 把操作编码成一条带有长度和校验和的记录写入 w，用于在节点之间传输操作
+func WriteOp(w io.Writer, op Op) error {
+	return writeSnapshotPayload(w, encodeOp(op))
+}
+
+// ReadOp 从 r 中读取一条 WriteOp 写入的记录，r 中没有更多记录时返回 io.EOF
+func ReadOp(r io.Reader) (Op, error) {
+	payload, err := readAOFRecord(r)
+	if err != nil {
+		return Op{}, err
+	}
+	return decodeOp(payload)
+}
@@ -0,0 +1,149 @@
+package caches
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// KeySize 是一个键值对占用的字节数
+type KeySize struct {
+	Key  string `json:"key"`
+	Size int    `json:"size"`
+}
+
+// SizeReport 是缓存占用空间的报告，只统计 key 和 value 本身的字节数，不包括 map 和 entry 的额外开销
+type SizeReport struct {
+	// Keys 是键值对的个数，包括已经过期但还没被清理的
+	Keys int64 `json:"keys"`
+
+	// KeyBytes 和 ValueBytes 是所有 key 和 value 的字节数
+	KeyBytes   int64 `json:"key_bytes"`
+	ValueBytes int64 `json:"value_bytes"`
+
+	// Largest 是占用空间最大的键值对，从大到小排列
+	Largest []KeySize `json:"largest"`
+}
+
+// keySizeHeap 是按照大小排列的小顶堆，用于找出最大的 n 个键值对
+type keySizeHeap []KeySize
+
+func (h keySizeHeap) Len() int            { return len(h) }
+func (h keySizeHeap) Less(i, j int) bool  { return h[i].Size < h[j].Size }
+func (h keySizeHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *keySizeHeap) Push(x interface{}) { *h = append(*h, x.(KeySize)) }
+func (h *keySizeHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// add 记录一个键值对，只保留最大的 top 个
+func (h *keySizeHeap) add(top int, item KeySize) {
+	if len(*h) < top {
+		heap.Push(h, item)
+	} else if top > 0 && item.Size > (*h)[0].Size {
+		(*h)[0] = item
+		heap.Fix(h, 0)
+	}
+}
+
+// sorted 返回从大到小排列的键值对
+func (h keySizeHeap) sorted() []KeySize {
+	sort.Slice(h, func(i, j int) bool {
+		return h[i].Size > h[j].Size
+	})
+	return h
+}
+
+// SizeReport 返回缓存占用空间的报告，Largest 中最多有 top 个键值对
+// 生成报告期间会持有读锁，数据很多时会阻塞写操作
+func (c *Cache) SizeReport(top int) SizeReport {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	report := SizeReport{}
+	largest := make(keySizeHeap, 0, top)
+	c.forEach(func(key string, e *entry) bool {
+		// 内部 key 只计入占用的字节数
+		report.KeyBytes += int64(len(key))
+		report.ValueBytes += int64(e.size())
+		if !IsInternalKey(key) {
+			report.Keys++
+			largest.add(top, KeySize{Key: key, Size: len(key) + e.size()})
+		}
+		return true
+	})
+
+	report.Largest = largest.sorted()
+	return report
+}
+
+// SizeDistribution 是抽样得到的 value 大小分布，大小的单位是字节
+type SizeDistribution struct {
+	// Keys 是键值对的总个数
+	Keys int64 `json:"keys"`
+
+	// Sampled 是抽样的键值对个数
+	Sampled int `json:"sampled"`
+
+	// Mean 是样本中 value 的平均大小
+	Mean float64 `json:"mean"`
+
+	// P50、P90、P95、P99 和 Max 是样本中 value 大小的分位数
+	P50 int `json:"p50"`
+	P90 int `json:"p90"`
+	P95 int `json:"p95"`
+	P99 int `json:"p99"`
+	Max int `json:"max"`
+
+	// Largest 是样本中占用空间最大的键值对，从大到小排列
+	Largest []KeySize `json:"largest"`
+}
+
+// SampleSizes 抽样最多 samples 个键值对，返回 value 大小的分布和样本中最大的 top 个键值对
+// map 的遍历从随机的位置开始，所以只遍历前 samples 个就相当于随机抽样，不需要遍历整个缓存
+func (c *Cache) SampleSizes(samples int, top int) SizeDistribution {
+	sizes := make([]int, 0, samples)
+	largest := make(keySizeHeap, 0, top)
+
+	c.lock.RLock()
+	keys := c.Count()
+	c.forEach(func(key string, e *entry) bool {
+		if len(sizes) >= samples {
+			return false
+		}
+
+		if IsInternalKey(key) {
+			return true
+		}
+
+		sizes = append(sizes, e.size())
+		largest.add(top, KeySize{Key: key, Size: len(key) + e.size()})
+		return true
+	})
+	c.lock.RUnlock()
+
+	dist := SizeDistribution{Keys: keys, Sampled: len(sizes), Largest: largest.sorted()}
+	if len(sizes) == 0 {
+		return dist
+	}
+
+	sort.Ints(sizes)
+	total := 0
+	for _, size := range sizes {
+		total += size
+	}
+
+	quantile := func(q float64) int {
+		return sizes[int(q*float64(len(sizes)-1))]
+	}
+
+	dist.Mean = float64(total) / float64(len(sizes))
+	dist.P50 = quantile(0.50)
+	dist.P90 = quantile(0.90)
+	dist.P95 = quantile(0.95)
+	dist.P99 = quantile(0.99)
+	dist.Max = sizes[len(sizes)-1]
+	return dist
+}
@@ -0,0 +1,114 @@
+package caches
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"gocache/utils"
+)
+
+// reservationSuffix 是保存 key 上的预留的内部 key 的后缀，预留不会被淘汰，过期之后由 Gc 清理
+const reservationSuffix = internalMarker + "reservation"
+
+// ErrNotReserved 表示预留已经过期、被取消，或者被其他生产者重新预留了，key 没有被修改
+var ErrNotReserved = errors.New("caches: not reserved")
+
+// Reservation 是 key 上的预留，表示有生产者正在计算 key 的 value
+type Reservation struct {
+	// Token 是预留时发出的 fencing token，完成和取消预留时需要带上
+	Token uint64
+
+	// TTL 是预留剩余的存活时间，生产者需要在这之前完成，否则其他生产者可以重新预留
+	TTL time.Duration
+}
+
+// reservationKey 返回保存 key 上的预留的内部 key
+func reservationKey(key string) string {
+	return key + reservationSuffix
+}
+
+// Reserve 尝试预留还没有 value 的 key，预留在 ttl 之后过期，成功时返回预留，之后使用 Complete 保存计算出的 value
+// key 已经被其他生产者预留时返回 false 和当前的预留，其他生产者可以等待预留完成之后读取 key，避免重复计算代价高的 value
+// key 已经有没有过期的 value 或者是内部 key 时也返回 false，这时返回的预留的 Token 为 0，和 Lock 共用 fencing token
+func (c *Cache) Reserve(key string, ttl time.Duration) (Reservation, bool) {
+	if IsInternalKey(key) {
+		return Reservation{}, false
+	}
+
+	defer c.lockKeys(false, key, reservationKey(key))()
+	now := c.now().UnixNano()
+	if e, ok := c.lookup(key); ok && e.alive(now) {
+		return Reservation{}, false
+	}
+
+	if current, ok := c.reservationLocked(key, now); ok {
+		return current, false
+	}
+
+	token := c.nextFence(now)
+	c.putKey(reservationKey(key), c.newEntry(strconv.AppendUint(nil, token, 10), ttl), false)
+	return Reservation{Token: token, TTL: ttl}, true
+}
+
+// Complete 在 key 上的预留还是 token 时保存 key 和 value 并删除预留，value 在 ttl 之后过期，返回新的版本号
+// 预留已经过期、被取消或者被其他生产者重新预留时返回 ErrNotReserved，这时计算出的 value 可能已经过时了，不会被保存
+func (c *Cache) Complete(key string, token uint64, value []byte, ttl time.Duration) (uint64, error) {
+	return c.complete(key, token, c.newEntry(utils.Copy(value), ttl), false)
+}
+
+// CompleteWithQuota 和 Complete 一样完成预留，但是写入之后会超出 key 所在命名空间的配额时返回 *QuotaError，预留保持不变
+func (c *Cache) CompleteWithQuota(key string, token uint64, value []byte, ttl time.Duration) (uint64, error) {
+	return c.complete(key, token, c.newEntry(utils.Copy(value), ttl), true)
+}
+
+// complete 在 key 上的预留还是 token 时保存 key 和 e 并删除预留，checkQuota 为 true 时检查命名空间的配额
+func (c *Cache) complete(key string, token uint64, e *entry, checkQuota bool) (uint64, error) {
+	if err := CheckKey(key); err != nil {
+		return 0, err
+	}
+
+	if err := checkValue(e); err != nil {
+		return 0, err
+	}
+
+	defer c.counters.setLatency.Since(time.Now())
+	defer c.lockKeys(checkQuota, key, reservationKey(key))()
+	if current, ok := c.reservationLocked(key, c.now().UnixNano()); !ok || current.Token != token {
+		return 0, ErrNotReserved
+	}
+
+	if err := c.putKey(key, e, checkQuota); err != nil {
+		return 0, err
+	}
+	c.deleteLocked(reservationKey(key))
+	return e.version, nil
+}
+
+// CancelReservation 取消 token 对应的 key 上的预留，比如计算失败时让其他生产者可以马上重新预留
+// 预留已经过期或者被其他生产者重新预留时返回 false
+func (c *Cache) CancelReservation(key string, token uint64) bool {
+	return c.DeleteIfValue(reservationKey(key), strconv.AppendUint(nil, token, 10))
+}
+
+// GetReservation 返回 key 上当前的预留，没有预留或者已经过期时返回 false
+func (c *Cache) GetReservation(key string) (Reservation, bool) {
+	defer c.rlockKey(reservationKey(key))()
+	return c.reservationLocked(key, c.now().UnixNano())
+}
+
+// reservationLocked 返回 key 上在 now 时还有效的预留，没有预留或者已经过期时返回 false，调用者需要持有锁
+func (c *Cache) reservationLocked(key string, now int64) (Reservation, bool) {
+	e, ok := c.lookup(reservationKey(key))
+	if !ok || !e.alive(now) {
+		return Reservation{}, false
+	}
+
+	// 从快照或者主节点加载的数据可能被压缩过，解压失败时当作没有预留
+	value, _ := e.data()
+	token, err := strconv.ParseUint(string(value), 10, 64)
+	if err != nil {
+		return Reservation{}, false
+	}
+	return Reservation{Token: token, TTL: e.ttl(now)}, true
+}
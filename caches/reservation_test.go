@@ -0,0 +1,176 @@
+package caches
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReserveComplete(t *testing.T) {
+	c, _ := NewDeterministicCache(1)
+	reservation, ok := c.Reserve("k", time.Minute)
+	if !ok || reservation.Token == 0 || reservation.TTL != time.Minute {
+		t.Fatalf("Reserve = %+v, %v", reservation, ok)
+	}
+
+	if _, ok := c.Get("k"); ok {
+		t.Fatal("reserved key is readable before Complete")
+	}
+
+	version, err := c.Complete("k", reservation.Token, []byte("value"), NeverExpire)
+	if err != nil || version == 0 {
+		t.Fatalf("Complete = %d, %v", version, err)
+	}
+
+	if value, ok := c.Get("k"); !ok || string(value) != "value" {
+		t.Fatalf("Get = %q, %v", value, ok)
+	}
+
+	if _, ok := c.GetReservation("k"); ok {
+		t.Error("reservation still exists after Complete")
+	}
+
+	// 已经有 value 的 key 不能再预留
+	if current, ok := c.Reserve("k", time.Minute); ok || current.Token != 0 {
+		t.Errorf("Reserve existing key = %+v, %v", current, ok)
+	}
+
+	if _, err := c.Complete("k", reservation.Token, []byte("again"), NeverExpire); !errors.Is(err, ErrNotReserved) {
+		t.Errorf("second Complete = %v, want ErrNotReserved", err)
+	}
+}
+
+func TestReserveTwice(t *testing.T) {
+	c, clock := NewDeterministicCache(1)
+	first, ok := c.Reserve("k", time.Minute)
+	if !ok {
+		t.Fatal("first Reserve failed")
+	}
+
+	clock.Advance(10 * time.Second)
+	current, ok := c.Reserve("k", time.Minute)
+	if ok || current.Token != first.Token || current.TTL != 50*time.Second {
+		t.Fatalf("second Reserve = %+v, %v, want the first reservation", current, ok)
+	}
+
+	if _, err := c.Complete("k", first.Token+1, []byte("value"), NeverExpire); !errors.Is(err, ErrNotReserved) {
+		t.Errorf("Complete with wrong token = %v", err)
+	}
+
+	if !c.CancelReservation("k", first.Token) {
+		t.Fatal("CancelReservation failed")
+	}
+
+	second, ok := c.Reserve("k", time.Minute)
+	if !ok || second.Token <= first.Token {
+		t.Fatalf("Reserve after cancel = %+v, %v", second, ok)
+	}
+
+	if _, err := c.Complete("k", first.Token, []byte("stale"), NeverExpire); !errors.Is(err, ErrNotReserved) {
+		t.Errorf("Complete with canceled token = %v", err)
+	}
+}
+
+func TestReserveExpire(t *testing.T) {
+	c, clock := NewDeterministicCache(1)
+	first, _ := c.Reserve("k", time.Second)
+	clock.Advance(2 * time.Second)
+
+	if _, ok := c.GetReservation("k"); ok {
+		t.Fatal("reservation is still visible after it expired")
+	}
+
+	if _, err := c.Complete("k", first.Token, []byte("late"), NeverExpire); !errors.Is(err, ErrNotReserved) {
+		t.Fatalf("Complete after expiry = %v, want ErrNotReserved", err)
+	}
+
+	if _, ok := c.Get("k"); ok {
+		t.Fatal("late Complete saved the value")
+	}
+
+	second, ok := c.Reserve("k", time.Second)
+	if !ok || second.Token == first.Token {
+		t.Fatalf("Reserve after expiry = %+v, %v", second, ok)
+	}
+
+	clock.Advance(2 * time.Second)
+	c.Gc()
+	if raw := rawKeys(c); len(raw) != 0 {
+		t.Errorf("keys after Gc = %q", raw)
+	}
+}
+
+func TestReservationKeyspace(t *testing.T) {
+	c, _ := NewDeterministicCache(1)
+	c.Set("a", []byte("1"))
+	if _, ok := c.Reserve("k", time.Minute); !ok {
+		t.Fatal("Reserve failed")
+	}
+
+	if count := c.Count(); count != 1 {
+		t.Errorf("Count = %d, want 1", count)
+	}
+
+	if keys, _ := c.Scan(0, "", 100); len(keys) != 1 || keys[0] != "a" {
+		t.Errorf("Scan = %q, want [a]", keys)
+	}
+
+	if keys := c.SampleKeys(10); len(keys) != 1 || keys[0] != "a" {
+		t.Errorf("SampleKeys = %q, want [a]", keys)
+	}
+
+	var out bytes.Buffer
+	if n, err := c.ExportNDJSON(&out); err != nil || n != 1 {
+		t.Errorf("ExportNDJSON = %d, %v", n, err)
+	}
+
+	if c.Type(reservationKey("k")) != TypeNone {
+		t.Error("reservation is visible through Type")
+	}
+}
+
+func TestReservationUserWrite(t *testing.T) {
+	c, clock := NewDeterministicCache(1)
+	reservation, ok := c.Reserve("job", time.Minute)
+	if !ok {
+		t.Fatal("Reserve failed")
+	}
+
+	// 用户不能通过内部 key 覆盖、修改或者删除预留
+	key := reservationKey("job")
+	if err := c.TrySet(key, []byte("0"), NeverExpire, PriorityNormal); !errors.Is(err, ErrInternalKey) {
+		t.Errorf("TrySet reservation key = %v, want ErrInternalKey", err)
+	}
+
+	if err := c.MSetWithQuota(map[string][]byte{key: []byte("0")}, NeverExpire); !errors.Is(err, ErrInternalKey) {
+		t.Errorf("MSetWithQuota reservation key = %v, want ErrInternalKey", err)
+	}
+
+	if _, err := c.Increment(key, 1, NeverExpire); !errors.Is(err, ErrInternalKey) {
+		t.Errorf("Increment reservation key = %v, want ErrInternalKey", err)
+	}
+
+	if _, _, err := c.Update(key, func([]byte) ([]byte, error) { return []byte("0"), nil }); !errors.Is(err, ErrInternalKey) {
+		t.Errorf("Update reservation key = %v, want ErrInternalKey", err)
+	}
+
+	if _, ok := c.Reserve(key, time.Minute); ok {
+		t.Error("reserved an internal key")
+	}
+
+	if _, err := c.Complete(key, reservation.Token, []byte("v"), NeverExpire); !errors.Is(err, ErrInternalKey) {
+		t.Errorf("Complete internal key = %v, want ErrInternalKey", err)
+	}
+
+	current, ok := c.GetReservation("job")
+	if !ok || current.Token != reservation.Token || current.TTL != time.Minute {
+		t.Fatalf("GetReservation = %+v, %v, want %+v", current, ok, reservation)
+	}
+
+	// 预留仍然会过期，其他生产者可以接手
+	clock.Advance(time.Minute)
+	if next, ok := c.Reserve("job", time.Minute); !ok || next.Token == reservation.Token {
+		t.Errorf("Reserve after expiry = %+v, %v", next, ok)
+	}
+}
@@ -0,0 +1,41 @@
+package caches
+
+// RandomKey 等概率地返回一个没有过期的 key，缓存为空时返回 false
+func (c *Cache) RandomKey() (string, bool) {
+	keys := c.SampleKeys(1)
+	if len(keys) == 0 {
+		return "", false
+	}
+	return keys[0], true
+}
+
+// SampleKeys 使用蓄水池抽样等概率地返回 n 个不重复的没有过期的 key，key 的个数不足 n 时返回所有的 key，返回的 key 没有固定的顺序
+// 需要遍历整个缓存，期间会持有读锁
+func (c *Cache) SampleKeys(n int) []string {
+	if n <= 0 {
+		return nil
+	}
+
+	random := c.newRandom()
+	now := c.now().UnixNano()
+	sample := make([]string, 0, n)
+	seen := 0
+
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	c.forEach(func(key string, e *entry) bool {
+		if !e.alive(now) || IsInternalKey(key) {
+			return true
+		}
+
+		// 第 seen 个 key 以 n/seen 的概率替换蓄水池中的一个 key
+		seen++
+		if len(sample) < n {
+			sample = append(sample, key)
+		} else if i := random.Intn(seen); i < n {
+			sample[i] = key
+		}
+		return true
+	})
+	return sample
+}
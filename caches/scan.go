@@ -0,0 +1,146 @@
+package caches
+
+import (
+	"context"
+	"sort"
+)
+
+// defaultScanCount 是 Scan 的 count 不大于 0 时使用的值
+const defaultScanCount = 10
+
+// Scan 从 cursor 开始遍历匹配 pattern 的没有过期的 key，返回这次找到的 key 和下一次遍历使用的 cursor
+// 第一次遍历时 cursor 为 0，返回的 cursor 为 0 表示遍历结束，pattern 为空时匹配所有的 key，语法见 MatchGlob，内部 key 不会被返回
+// count 是每次返回的 key 的个数的提示，不大于 0 时使用 10，每次至少遍历一个分片，所以可能返回更多或者更少的 key
+// 遍历每个分片时才持有锁，不会一直持有整个缓存的锁，遍历期间一直存在的 key 会被返回恰好一次，期间写入或者删除的 key 可能返回也可能不返回
+func (c *Cache) Scan(cursor uint64, pattern string, count int) ([]string, uint64) {
+	keys, next, _ := c.ScanContext(context.Background(), cursor, pattern, count)
+	return keys, next
+}
+
+// ScanContext 和 Scan 一样遍历 key，但是每遍历一个分片之前都会检查 ctx，ctx 结束时返回已经找到的 key、下一次遍历使用的 cursor 和 ctx 的错误
+// 用于中止 count 很大的遍历，调用者可以之后再从返回的 cursor 继续
+func (c *Cache) ScanContext(ctx context.Context, cursor uint64, pattern string, count int) ([]string, uint64, error) {
+	if count <= 0 {
+		count = defaultScanCount
+	}
+
+	var keys []string
+	now := c.now().UnixNano()
+	for {
+		if err := ctx.Err(); err != nil {
+			return keys, cursor, err
+		}
+
+		c.lock.RLock()
+		segments := len(c.segments)
+		if cursor >= uint64(segments) {
+			c.lock.RUnlock()
+			return keys, 0, nil
+		}
+
+		seg := c.segments[cursor]
+		seg.lock.RLock()
+		start := len(keys)
+		seg.forEach(func(key string, e *entry) bool {
+			if e.alive(now) && !IsInternalKey(key) && (pattern == "" || MatchGlob(pattern, key)) {
+				keys = append(keys, key)
+			}
+			return true
+		})
+		seg.lock.RUnlock()
+		c.lock.RUnlock()
+
+		// 分片中的 key 没有固定的顺序，排序之后相同的数据总是得到相同的结果
+		sort.Strings(keys[start:])
+		cursor++
+		if cursor == uint64(segments) {
+			return keys, 0, nil
+		}
+
+		if len(keys) >= count {
+			return keys, cursor, nil
+		}
+	}
+}
+
+// MatchGlob 返回 key 是否匹配 glob 模式 pattern，语法和 Redis 的 KEYS 一样
+// * 匹配任意个字符，? 匹配一个字符，[abc] 匹配其中的一个字符，[^abc] 匹配不在其中的字符，[a-z] 匹配范围内的字符，\ 转义下一个字符
+func MatchGlob(pattern string, key string) bool {
+	// 每个 * 之外的记号都恰好匹配一个字符，匹配失败时只需要回到最后一个 * 让它多匹配一个字符，不会指数级地回溯
+	p, k := 0, 0
+	starP, starK := -1, 0
+	for k < len(key) {
+		if p < len(pattern) {
+			switch pattern[p] {
+			case '*':
+				starP, starK = p, k
+				p++
+				continue
+			case '?':
+				p, k = p+1, k+1
+				continue
+			case '[':
+				matched, rest, ok := matchClass(pattern[p+1:], key[k])
+				if ok && matched {
+					p, k = len(pattern)-len(rest), k+1
+					continue
+				}
+
+				// 没有结束的 [ 当作普通字符
+				if !ok && key[k] == '[' {
+					p, k = p+1, k+1
+					continue
+				}
+			default:
+				char, width := pattern[p], 1
+				if char == '\\' && p+1 < len(pattern) {
+					char, width = pattern[p+1], 2
+				}
+
+				if char == key[k] {
+					p, k = p+width, k+1
+					continue
+				}
+			}
+		}
+
+		if starP < 0 {
+			return false
+		}
+		starK++
+		p, k = starP+1, starK
+	}
+
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// matchClass 返回 b 是否在 [ 之后的字符集 pattern 中，以及 ] 之后剩下的模式，没有 ] 时 ok 为 false
+func matchClass(pattern string, b byte) (matched bool, rest string, ok bool) {
+	negated := len(pattern) > 0 && (pattern[0] == '^' || pattern[0] == '!')
+	if negated {
+		pattern = pattern[1:]
+	}
+
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case pattern[i] == ']' && i > 0:
+			return matched != negated, pattern[i+1:], true
+		case pattern[i] == '\\' && i+1 < len(pattern):
+			i++
+			matched = matched || pattern[i] == b
+		case i+2 < len(pattern) && pattern[i+1] == '-' && pattern[i+2] != ']':
+			low, high := pattern[i], pattern[i+2]
+			if low > high {
+				low, high = high, low
+			}
+			matched = matched || (low <= b && b <= high)
+			i += 2
+		default:
+			matched = matched || pattern[i] == b
+		}
+	}
+	return false, "", false
+}
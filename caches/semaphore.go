@@ -0,0 +1,134 @@
+package caches
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"time"
+)
+
+// permit 是计数信号量中的一个许可
+type permit struct {
+	token    uint64
+	expireAt int64
+}
+
+// AcquireSemaphore 尝试获取 key 上计数信号量的一个许可，最多同时有 limit 个许可，许可在 ttl 之后自动释放
+// 成功时返回许可的 token 和包括这个许可在内已经发出的许可数，许可已经发完时返回 false 和已经发出的许可数
+// 信号量保存为 key 上的数据，每行是一个许可的 token 和过期时间，所有许可都过期之后数据也会过期
+func (c *Cache) AcquireSemaphore(key string, limit int, ttl time.Duration) (token uint64, used int, ok bool) {
+	defer c.lockKeys(false, key)()
+	now := c.now().UnixNano()
+	permits, ok := c.permitsLocked(key, now)
+	if !ok || len(permits) >= limit {
+		return 0, len(permits), false
+	}
+
+	token = c.nextFence(now)
+	permits = append(permits, permit{token: token, expireAt: now + int64(ttl)})
+	c.storePermitsLocked(key, permits)
+	return token, len(permits), true
+}
+
+// ReleaseSemaphore 释放 key 上 token 对应的许可，许可已经过期或者不存在时返回 false
+func (c *Cache) ReleaseSemaphore(key string, token uint64) bool {
+	defer c.lockKeys(false, key)()
+	permits, ok := c.permitsLocked(key, c.now().UnixNano())
+	if !ok {
+		return false
+	}
+
+	for i, p := range permits {
+		if p.token == token {
+			c.storePermitsLocked(key, append(permits[:i], permits[i+1:]...))
+			return true
+		}
+	}
+	return false
+}
+
+// permitsLocked 返回 key 上在 now 时还没有过期的许可，key 上的数据不是信号量时返回 false，调用者需要持有锁
+func (c *Cache) permitsLocked(key string, now int64) ([]permit, bool) {
+	e, ok := c.lookup(key)
+	if !ok || !e.alive(now) {
+		return nil, true
+	}
+
+	value, _ := e.data()
+	var permits []permit
+	for _, line := range bytes.Split(value, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+
+		fields := bytes.Fields(line)
+		if len(fields) != 2 {
+			return nil, false
+		}
+
+		token, err1 := strconv.ParseUint(string(fields[0]), 10, 64)
+		expireAt, err2 := strconv.ParseInt(string(fields[1]), 10, 64)
+		if err1 != nil || err2 != nil {
+			return nil, false
+		}
+
+		if expireAt > now {
+			permits = append(permits, permit{token: token, expireAt: expireAt})
+		}
+	}
+	return permits, true
+}
+
+// storePermitsLocked 保存 key 上的许可，数据在最后一个许可过期时过期，没有许可时删除 key，调用者需要持有 key 的锁
+func (c *Cache) storePermitsLocked(key string, permits []permit) {
+	if len(permits) == 0 {
+		c.deleteLocked(key)
+		return
+	}
+
+	var value []byte
+	var expireAt int64
+	for _, p := range permits {
+		value = strconv.AppendUint(value, p.token, 10)
+		value = append(value, ' ')
+		value = strconv.AppendInt(value, p.expireAt, 10)
+		value = append(value, '\n')
+		if p.expireAt > expireAt {
+			expireAt = p.expireAt
+		}
+	}
+	c.putKey(key, &entry{value: value, expireAt: expireAt}, false)
+}
+
+// TakeTokens 从 key 上的令牌桶中取出 n 个令牌，桶的容量是 burst，每秒补充 rate 个令牌
+// 令牌足够时返回 true 和剩下的令牌数，否则不取出令牌，返回 false 和需要等待多久才有足够的令牌
+// 令牌桶保存为 key 上的数据，内容是令牌数和上次补充的时间，桶补满之后数据就会过期
+func (c *Cache) TakeTokens(key string, rate float64, burst int, n int) (ok bool, remaining float64, retryAfter time.Duration) {
+	defer c.lockKeys(false, key)()
+	now := c.now().UnixNano()
+	tokens := float64(burst)
+	if e, ok := c.lookup(key); ok && e.alive(now) {
+		value, _ := e.data()
+		fields := bytes.Fields(value)
+		if len(fields) == 2 {
+			saved, err1 := strconv.ParseFloat(string(fields[0]), 64)
+			last, err2 := strconv.ParseInt(string(fields[1]), 10, 64)
+			if err1 == nil && err2 == nil {
+				tokens = math.Min(float64(burst), saved+rate*float64(now-last)/float64(time.Second))
+			}
+		}
+	}
+
+	if tokens < float64(n) {
+		wait := time.Duration((float64(n) - tokens) / rate * float64(time.Second))
+		return false, tokens, wait
+	}
+
+	tokens -= float64(n)
+	value := strconv.AppendFloat(nil, tokens, 'f', -1, 64)
+	value = append(value, ' ')
+	value = strconv.AppendInt(value, now, 10)
+	full := time.Duration((float64(burst) - tokens) / rate * float64(time.Second))
+	c.putKey(key, &entry{value: value, expireAt: now + int64(full) + 1}, false)
+	return true, tokens, 0
+}
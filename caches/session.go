@@ -0,0 +1,292 @@
+package caches
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+const (
+	// SessionPrefix 是会话在缓存中的 key 的前缀，后面是会话 ID
+	SessionPrefix = "session:"
+
+	// sessionUserPrefix 是用户会话索引的 key 的前缀，后面是用户名，值是这个用户的会话 ID，每行一个
+	sessionUserPrefix = "session-user:"
+)
+
+// Session 是一个用户会话，在 TTL 时间内没有续约就会过期
+type Session struct {
+	// ID 是会话 ID，创建时随机生成
+	ID string `json:"id"`
+
+	// User 是会话所属的用户，可以为空
+	User string `json:"user,omitempty"`
+
+	// Attributes 是会话的属性
+	Attributes map[string]string `json:"attributes"`
+
+	// TTL 是会话的存活时间，每次续约都会将过期时间延长到 TTL 之后
+	TTL time.Duration `json:"-"`
+
+	// ExpiresIn 是会话剩余的存活时间
+	ExpiresIn time.Duration `json:"-"`
+}
+
+// sessionValue 是会话保存在缓存中的值
+type sessionValue struct {
+	User       string            `json:"user,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	TTL        int64             `json:"ttl"`
+}
+
+// CreateSession 为 user 创建一个在 ttl 之后过期的会话，attributes 是会话的初始属性
+// 会话保存为 SessionPrefix 加会话 ID 的 key，同时记录到用户的会话索引中，用于 DeleteUserSessions
+func (c *Cache) CreateSession(user string, attributes map[string]string, ttl time.Duration) (Session, error) {
+	id, err := c.newSessionID()
+	if err != nil {
+		return Session{}, err
+	}
+
+	if attributes == nil {
+		attributes = make(map[string]string)
+	}
+
+	// 清理索引中已经过期的会话需要读取这个用户的所有会话，它们可能在不同的分片中，使用写锁
+	defer c.lockKeys(true)()
+	session := Session{ID: id, User: user, Attributes: attributes, TTL: ttl, ExpiresIn: ttl}
+	c.storeSessionLocked(session)
+	if user != "" {
+		now := c.now().UnixNano()
+		ids := c.userSessionsLocked(user, now)
+		c.storeUserSessionsLocked(user, append(ids, id), now)
+	}
+	return session, nil
+}
+
+// GetSession 返回 id 对应的会话，会话不存在或者已经过期时返回 false，renew 为 true 时同时续约
+func (c *Cache) GetSession(id string, renew bool) (Session, bool) {
+	if !renew {
+		defer c.rlockKey(SessionPrefix + id)()
+		return c.sessionLocked(id, c.now().UnixNano())
+	}
+	return c.updateSession(id, nil)
+}
+
+// RenewSession 将 id 对应的会话的过期时间延长到会话的 TTL 之后，会话不存在或者已经过期时返回 false
+func (c *Cache) RenewSession(id string) (Session, bool) {
+	return c.updateSession(id, nil)
+}
+
+// SetSessionAttributes 修改 id 对应的会话的属性并续约，值为空字符串的属性会被删除，会话不存在或者已经过期时返回 false
+func (c *Cache) SetSessionAttributes(id string, attributes map[string]string) (Session, bool) {
+	return c.updateSession(id, func(session *Session) {
+		for name, value := range attributes {
+			if value == "" {
+				delete(session.Attributes, name)
+			} else {
+				session.Attributes[name] = value
+			}
+		}
+	})
+}
+
+// DeleteSession 删除 id 对应的会话，会话不存在或者已经过期时返回 false
+func (c *Cache) DeleteSession(id string) bool {
+	// 会话所属的用户要读取会话之后才知道，先锁住会话，再同时锁住会话和用户的会话索引
+	unlock := c.lockKeys(false, SessionPrefix+id)
+	session, ok := c.sessionLocked(id, c.now().UnixNano())
+	unlock()
+	if !ok {
+		return false
+	}
+
+	defer c.lockKeys(false, SessionPrefix+id, sessionUserPrefix+session.User)()
+	current, ok := c.sessionLocked(id, c.now().UnixNano())
+	if !ok || current.User != session.User {
+		return false
+	}
+
+	c.deleteLocked(SessionPrefix + id)
+	if session.User != "" {
+		c.removeUserSessionLocked(session.User, id)
+	}
+	return true
+}
+
+// DeleteUserSessions 删除 user 的所有会话，比如用户修改了密码之后在所有设备上登出，返回删除的会话个数
+func (c *Cache) DeleteUserSessions(user string) int {
+	// 用户的会话可能在不同的分片中，使用写锁
+	defer c.lockKeys(true)()
+	ids := c.userSessionsLocked(user, c.now().UnixNano())
+	for _, id := range ids {
+		c.deleteLocked(SessionPrefix + id)
+	}
+	c.deleteLocked(sessionUserPrefix + user)
+	return len(ids)
+}
+
+// updateSession 使用 fn 修改 id 对应的会话并续约，fn 为 nil 表示只续约
+func (c *Cache) updateSession(id string, fn func(session *Session)) (Session, bool) {
+	unlock := c.lockKeys(false, SessionPrefix+id)
+	session, ok := c.sessionLocked(id, c.now().UnixNano())
+	unlock()
+	if !ok {
+		return Session{}, false
+	}
+
+	// 会话的用户不会改变，同时锁住会话和用户的会话索引之后重新读取会话，期间会话可能被修改或者删除了
+	defer c.lockKeys(false, SessionPrefix+id, sessionUserPrefix+session.User)()
+	session, ok = c.sessionLocked(id, c.now().UnixNano())
+	if !ok {
+		return Session{}, false
+	}
+
+	if fn != nil {
+		fn(&session)
+	}
+
+	session.ExpiresIn = session.TTL
+	c.storeSessionLocked(session)
+	if session.User != "" {
+		// 用户的会话索引不能比会话先过期
+		c.extendUserSessionsLocked(session.User, id)
+	}
+	return session, true
+}
+
+// sessionLocked 返回 id 对应的在 now 时还没有过期的会话，调用者需要持有锁
+func (c *Cache) sessionLocked(id string, now int64) (Session, bool) {
+	e, ok := c.lookup(SessionPrefix + id)
+	if !ok || !e.alive(now) {
+		return Session{}, false
+	}
+
+	data, err := e.data()
+	if err != nil {
+		return Session{}, false
+	}
+
+	var value sessionValue
+	if err = json.Unmarshal(data, &value); err != nil {
+		return Session{}, false
+	}
+
+	if value.Attributes == nil {
+		value.Attributes = make(map[string]string)
+	}
+	return Session{ID: id, User: value.User, Attributes: value.Attributes, TTL: time.Duration(value.TTL), ExpiresIn: e.ttl(now)}, true
+}
+
+// storeSessionLocked 保存会话，会话在 ExpiresIn 之后过期，调用者需要持有会话的锁
+func (c *Cache) storeSessionLocked(session Session) {
+	value, _ := json.Marshal(sessionValue{User: session.User, Attributes: session.Attributes, TTL: int64(session.TTL)})
+	c.putKey(SessionPrefix+session.ID, c.newEntry(value, session.ExpiresIn), false)
+}
+
+// userSessionsLocked 返回 user 在 now 时还没有过期的会话 ID，调用者需要持有锁
+func (c *Cache) userSessionsLocked(user string, now int64) []string {
+	e, ok := c.lookup(sessionUserPrefix + user)
+	if !ok || !e.alive(now) {
+		return nil
+	}
+
+	value, _ := e.data()
+	var ids []string
+	for _, id := range bytes.Split(value, []byte("\n")) {
+		if len(id) == 0 {
+			continue
+		}
+
+		if session, ok := c.lookup(SessionPrefix + string(id)); ok && session.alive(now) {
+			ids = append(ids, string(id))
+		}
+	}
+	return ids
+}
+
+// storeUserSessionsLocked 保存 user 的会话索引，索引在最后一个会话过期时过期，没有会话时删除索引，调用者需要持有写锁，会话可能在不同的分片中
+func (c *Cache) storeUserSessionsLocked(user string, ids []string, now int64) {
+	if len(ids) == 0 {
+		c.deleteLocked(sessionUserPrefix + user)
+		return
+	}
+
+	var value []byte
+	var expireAt int64
+	for _, id := range ids {
+		value = append(value, id...)
+		value = append(value, '\n')
+		if session, ok := c.lookup(SessionPrefix + id); ok {
+			if session.expireAt == 0 {
+				expireAt = -1
+			} else if expireAt >= 0 && session.expireAt > expireAt {
+				expireAt = session.expireAt
+			}
+		}
+	}
+
+	if expireAt < 0 {
+		expireAt = 0
+	}
+	c.putKey(sessionUserPrefix+user, &entry{value: value, expireAt: expireAt}, false)
+}
+
+// extendUserSessionsLocked 在会话 id 续约之后延长 user 的会话索引的过期时间，索引不能比会话先过期
+// 只读取会话 id 和索引，不清理索引中其他已经过期的会话，调用者需要持有会话和索引的锁
+func (c *Cache) extendUserSessionsLocked(user string, id string) {
+	session, ok := c.lookup(SessionPrefix + id)
+	if !ok {
+		return
+	}
+
+	index, ok := c.lookup(sessionUserPrefix + user)
+	if !ok || !index.alive(c.now().UnixNano()) {
+		c.putKey(sessionUserPrefix+user, &entry{value: []byte(id + "\n"), expireAt: session.expireAt}, false)
+		return
+	}
+
+	if index.expireAt == 0 || session.expireAt != 0 && session.expireAt <= index.expireAt {
+		return
+	}
+
+	value, _ := index.data()
+	c.putKey(sessionUserPrefix+user, &entry{value: value, expireAt: session.expireAt}, false)
+}
+
+// removeUserSessionLocked 从 user 的会话索引中删除会话 id，没有其他会话时删除索引，调用者需要持有索引的锁
+func (c *Cache) removeUserSessionLocked(user string, id string) {
+	index, ok := c.lookup(sessionUserPrefix + user)
+	if !ok {
+		return
+	}
+
+	value, _ := index.data()
+	var rest []byte
+	for _, other := range bytes.Split(value, []byte("\n")) {
+		if len(other) > 0 && string(other) != id {
+			rest = append(append(rest, other...), '\n')
+		}
+	}
+
+	if len(rest) == 0 {
+		c.deleteLocked(sessionUserPrefix + user)
+		return
+	}
+	c.putKey(sessionUserPrefix+user, &entry{value: rest, expireAt: index.expireAt}, false)
+}
+
+// newSessionID 返回随机生成的会话 ID，有 128 位随机数，不能被猜出来，确定性模式下使用 Options.Seed 生成的随机数
+func (c *Cache) newSessionID() (string, error) {
+	id := make([]byte, 16)
+	read := rand.Read
+	if c.options.Deterministic {
+		read = c.newRandom().Read
+	}
+
+	if _, err := read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
@@ -0,0 +1,522 @@
+package caches
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+const (
+	// snapshotMagic 是持久化文件开头的标识，用来区分旧版本没有文件头的持久化文件
+	snapshotMagic = "GOCACHE"
+
+	// snapshotVersion 是当前写入的持久化格式版本
+	// 修改持久化的内部结构时需要增加版本号，并在 snapshotReaders 中保留旧版本的读取方法
+	snapshotVersion uint16 = 5
+
+	// snapshotHeaderSize 是文件标识加上文件头的字节数
+	snapshotHeaderSize = len(snapshotMagic) + 2 + 8
+
+	// snapshotBlockEntries 是每个数据块最多包含的键值对个数
+	snapshotBlockEntries = 1024
+
+	// snapshotMaxBlockSize 是单个数据块允许的最大字节数，超过这个值说明长度字段已经损坏
+	snapshotMaxBlockSize = 1 << 30
+)
+
+const (
+	// snapshotEncrypted 标记持久化文件的数据块是加密过的
+	snapshotEncrypted byte = 1 << iota
+
+	// snapshotIncremental 标记持久化文件是增量持久化文件，只包含上次持久化之后修改过的数据
+	snapshotIncremental
+)
+
+// snapshotHeader 是持久化文件的文件头，紧跟在 snapshotMagic 之后
+type snapshotHeader struct {
+	// Version 是持久化格式版本
+	Version uint16
+
+	// CreatedAt 是持久化的时间，单位是纳秒
+	CreatedAt int64
+}
+
+// snapshot 是持久化数据在内存中的结构，所有版本的文件都会被读取为这个结构
+type snapshot struct {
+	header snapshotHeader
+
+	// incremental 表示这是一个增量持久化文件，需要在之前的数据上应用
+	incremental bool
+
+	// data 是持久化的键值对
+	data map[string]*entry
+
+	// deleted 是增量持久化期间被删除的 key
+	deleted []string
+}
+
+// CorruptionError 表示持久化文件已经损坏，记录了损坏的位置
+type CorruptionError struct {
+	// Block 是损坏的数据块序号，从 0 开始，为 -1 表示文件摘要不匹配
+	Block int
+
+	// Offset 是损坏的数据块在文件中的偏移量
+	Offset int64
+
+	// Reason 是损坏的原因
+	Reason string
+}
+
+// Error 返回错误信息
+func (ce *CorruptionError) Error() string {
+	if ce.Block < 0 {
+		return fmt.Sprintf("caches: snapshot corrupted at offset %d: %s", ce.Offset, ce.Reason)
+	}
+	return fmt.Sprintf("caches: snapshot block %d corrupted at offset %d: %s", ce.Block, ce.Offset, ce.Reason)
+}
+
+// snapshotReaders 记录了每个版本的持久化文件的读取方法
+// 旧版本的读取方法负责把数据迁移成当前的结构
+// 文件加密时 aead 为解密使用的加密器，否则为 nil
+var snapshotReaders = map[uint16]func(r io.Reader, header snapshotHeader, aead cipher.AEAD) (*snapshot, error){
+	0: readSnapshotV0,
+	1: readSnapshotV1,
+	2: readSnapshotV2,
+	3: readSnapshotV3,
+	4: readSnapshotV4,
+	5: readSnapshotV5,
+}
+
+// writeSnapshot 使用当前的持久化格式将 data 中所有分片的数据写入 w
+// 格式为：文件头 + 编码方式的名字 + 标记 + 数据区 + 删除区 + 整个文件的 SHA-256 摘要
+// 编码方式的名字为：1 字节长度 + 名字
+// 标记为 1 个字节，如果设置了 snapshotEncrypted，标记后面还有一个加密过的 keyCheck 数据块，用来检查密钥是否正确
+// 数据区和删除区都是若干数据块 + 长度为 0 的结束块，删除区的数据块只使用 Entry 的 Key
+// 每个数据块为：4 字节长度 + 使用 codec 编码的数据 + 4 字节 CRC32 校验和，加密时数据为 nonce + 密文
+// aead 为 nil 时不加密，deleted 不为 nil 时写入的是增量持久化文件
+// createdAt 是 data 被冻结的时间，AOF 中这个时间之后的操作都不在持久化文件里
+func writeSnapshot(w io.Writer, data []map[string]*entry, deleted []string, createdAt int64, codec Codec, aead cipher.AEAD) error {
+	digest := sha256.New()
+	writer := io.MultiWriter(w, digest)
+	if _, err := io.WriteString(writer, snapshotMagic); err != nil {
+		return err
+	}
+
+	header := snapshotHeader{Version: snapshotVersion, CreatedAt: createdAt}
+	if err := binary.Write(writer, binary.BigEndian, &header); err != nil {
+		return err
+	}
+
+	name := codec.Name()
+	if len(name) > 255 {
+		return fmt.Errorf("caches: codec name %q is too long", name)
+	}
+
+	if _, err := writer.Write(append([]byte{byte(len(name))}, name...)); err != nil {
+		return err
+	}
+
+	flags := byte(0)
+	if aead != nil {
+		flags |= snapshotEncrypted
+	}
+
+	if deleted != nil {
+		flags |= snapshotIncremental
+	}
+
+	if _, err := writer.Write([]byte{flags}); err != nil {
+		return err
+	}
+
+	if aead != nil {
+		check, err := seal(aead, keyCheck)
+		if err != nil {
+			return err
+		}
+
+		if err = writeSnapshotPayload(writer, check); err != nil {
+			return err
+		}
+	}
+
+	entries := make([]Entry, 0, snapshotBlockEntries)
+	for _, segment := range data {
+		for key, e := range segment {
+			item, ok := entryOf(key, e)
+			if !ok {
+				continue
+			}
+
+			entries = append(entries, item)
+			if len(entries) >= snapshotBlockEntries {
+				if err := writeSnapshotBlock(writer, entries, codec, aead); err != nil {
+					return err
+				}
+				entries = entries[:0]
+			}
+		}
+	}
+
+	if err := writeSnapshotSectionEnd(writer, entries, codec, aead); err != nil {
+		return err
+	}
+
+	entries = entries[:0]
+	for _, key := range deleted {
+		entries = append(entries, Entry{Key: key, Value: []byte{}})
+		if len(entries) >= snapshotBlockEntries {
+			if err := writeSnapshotBlock(writer, entries, codec, aead); err != nil {
+				return err
+			}
+			entries = entries[:0]
+		}
+	}
+
+	if err := writeSnapshotSectionEnd(writer, entries, codec, aead); err != nil {
+		return err
+	}
+
+	_, err := w.Write(digest.Sum(nil))
+	return err
+}
+
+// writeSnapshotSectionEnd 写入剩下的 entries，并写入长度为 0 的结束块
+func writeSnapshotSectionEnd(w io.Writer, entries []Entry, codec Codec, aead cipher.AEAD) error {
+	if len(entries) > 0 {
+		if err := writeSnapshotBlock(w, entries, codec, aead); err != nil {
+			return err
+		}
+	}
+	return binary.Write(w, binary.BigEndian, uint32(0))
+}
+
+// writeSnapshotBlock 将 entries 编码成一个数据块写入 w，aead 不为 nil 时会先加密
+func writeSnapshotBlock(w io.Writer, entries []Entry, codec Codec, aead cipher.AEAD) error {
+	payload, err := codec.Marshal(entries)
+	if err != nil {
+		return err
+	}
+
+	if aead != nil {
+		if payload, err = seal(aead, payload); err != nil {
+			return err
+		}
+	}
+	return writeSnapshotPayload(w, payload)
+}
+
+// writeSnapshotPayload 将 payload 加上长度和校验和写入 w
+func writeSnapshotPayload(w io.Writer, payload []byte) error {
+	if err := binary.Write(w, binary.BigEndian, uint32(len(payload))); err != nil {
+		return err
+	}
+
+	if _, err := w.Write(payload); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.BigEndian, crc32.ChecksumIEEE(payload))
+}
+
+// readSnapshot 从 r 中读取任意版本的持久化数据，文件加密时使用 aead 进行解密
+func readSnapshot(r io.Reader, aead cipher.AEAD) (*snapshot, error) {
+	reader := bufio.NewReader(r)
+	magic, err := reader.Peek(len(snapshotMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	// 没有文件头说明是加入版本号之前写入的文件，当作版本 0 处理
+	header := snapshotHeader{Version: 0}
+	if bytes.Equal(magic, []byte(snapshotMagic)) {
+		reader.Discard(len(snapshotMagic))
+		if err = binary.Read(reader, binary.BigEndian, &header); err != nil {
+			return nil, fmt.Errorf("caches: read snapshot header: %w", err)
+		}
+	}
+
+	readFn, ok := snapshotReaders[header.Version]
+	if !ok {
+		return nil, fmt.Errorf("caches: unsupported snapshot version %d (current version is %d)", header.Version, snapshotVersion)
+	}
+
+	snap, err := readFn(reader, header, aead)
+	if err != nil {
+		return nil, fmt.Errorf("caches: read snapshot version %d: %w", header.Version, err)
+	}
+
+	snap.header = header
+	return snap, nil
+}
+
+// readSnapshotV0 读取没有文件头的持久化文件，内容是直接使用 gob 编码的 map
+func readSnapshotV0(r io.Reader, header snapshotHeader, aead cipher.AEAD) (*snapshot, error) {
+	values := make(map[string][]byte, 256)
+	if err := gob.NewDecoder(r).Decode(&values); err != nil {
+		return nil, err
+	}
+
+	data := make(map[string]*entry, len(values))
+	for key, value := range values {
+		data[key] = markLarge(&entry{value: value})
+	}
+	return &snapshot{data: data}, nil
+}
+
+// readSnapshotV1 读取版本 1 的持久化文件，文件头之后是使用 gob 编码的 map
+func readSnapshotV1(r io.Reader, header snapshotHeader, aead cipher.AEAD) (*snapshot, error) {
+	return readSnapshotV0(r, header, aead)
+}
+
+// readSnapshotV2 读取版本 2 的持久化文件，数据块固定使用 gob 编码
+func readSnapshotV2(r io.Reader, header snapshotHeader, aead cipher.AEAD) (*snapshot, error) {
+	sr := newSnapshotReader(r, header, GobCodec{})
+	return sr.readData()
+}
+
+// readSnapshotV3 读取版本 3 的持久化文件，文件头之后记录了数据块使用的编码方式
+func readSnapshotV3(r io.Reader, header snapshotHeader, aead cipher.AEAD) (*snapshot, error) {
+	sr := newSnapshotReader(r, header, nil)
+	if err := sr.readCodec(); err != nil {
+		return nil, err
+	}
+	return sr.readData()
+}
+
+// readSnapshotV4 读取版本 4 的持久化文件，编码方式之后记录了文件是否加密
+func readSnapshotV4(r io.Reader, header snapshotHeader, aead cipher.AEAD) (*snapshot, error) {
+	sr := newSnapshotReader(r, header, nil)
+	if err := sr.readCodec(); err != nil {
+		return nil, err
+	}
+
+	if _, err := sr.readFlags(aead); err != nil {
+		return nil, err
+	}
+	return sr.readData()
+}
+
+// readSnapshotV5 读取版本 5 的持久化文件，数据区之后是记录了被删除的 key 的删除区
+func readSnapshotV5(r io.Reader, header snapshotHeader, aead cipher.AEAD) (*snapshot, error) {
+	sr := newSnapshotReader(r, header, nil)
+	if err := sr.readCodec(); err != nil {
+		return nil, err
+	}
+
+	flags, err := sr.readFlags(aead)
+	if err != nil {
+		return nil, err
+	}
+
+	snap := &snapshot{incremental: flags&snapshotIncremental != 0, data: make(map[string]*entry, 256)}
+	err = sr.readSection(func(item Entry) {
+		snap.data[item.Key] = markLarge(&entry{value: item.Value, expireAt: item.ExpireAt})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = sr.readSection(func(item Entry) {
+		snap.deleted = append(snap.deleted, item.Key)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return snap, sr.verifyDigest()
+}
+
+// snapshotReader 用于读取带有数据块的持久化文件，会校验每个数据块的校验和以及整个文件的摘要
+// 只要有任何一处损坏就返回 CorruptionError，不会返回部分数据
+type snapshotReader struct {
+	// r 是原始的文件内容
+	r io.Reader
+
+	// reader 会在读取时将内容写入 digest
+	reader io.Reader
+
+	// digest 是已经读取的内容的摘要
+	digest hash.Hash
+
+	// offset 是当前读取的位置在文件中的偏移量
+	offset int64
+
+	// block 是下一个数据块的序号
+	block int
+
+	// codec 是数据块使用的编码方式
+	codec Codec
+
+	// aead 不为 nil 时会先解密数据块
+	aead cipher.AEAD
+}
+
+// newSnapshotReader 返回一个从文件头之后开始读取的 snapshotReader
+func newSnapshotReader(r io.Reader, header snapshotHeader, codec Codec) *snapshotReader {
+	digest := sha256.New()
+	io.WriteString(digest, snapshotMagic)
+	binary.Write(digest, binary.BigEndian, &header)
+	return &snapshotReader{
+		r:      r,
+		reader: io.TeeReader(r, digest),
+		digest: digest,
+		offset: int64(snapshotHeaderSize),
+		codec:  codec,
+	}
+}
+
+// corrupted 返回当前位置的 CorruptionError
+func (sr *snapshotReader) corrupted(block int, reason string) error {
+	return &CorruptionError{Block: block, Offset: sr.offset, Reason: reason}
+}
+
+// readCodec 读取编码方式
+func (sr *snapshotReader) readCodec() error {
+	size := make([]byte, 1)
+	if _, err := io.ReadFull(sr.reader, size); err != nil {
+		return sr.corrupted(-1, "truncated codec name")
+	}
+
+	name := make([]byte, size[0])
+	if _, err := io.ReadFull(sr.reader, name); err != nil {
+		return sr.corrupted(-1, "truncated codec name")
+	}
+
+	codec, err := CodecByName(string(name))
+	if err != nil {
+		return err
+	}
+
+	sr.codec = codec
+	sr.offset += 1 + int64(size[0])
+	return nil
+}
+
+// readFlags 读取标记，如果文件是加密的，会使用 aead 检查密钥是否正确
+func (sr *snapshotReader) readFlags(aead cipher.AEAD) (byte, error) {
+	flags := make([]byte, 1)
+	if _, err := io.ReadFull(sr.reader, flags); err != nil {
+		return 0, sr.corrupted(-1, "truncated flags")
+	}
+	sr.offset++
+
+	if flags[0]&snapshotEncrypted == 0 {
+		return flags[0], nil
+	}
+
+	if aead == nil {
+		return 0, errors.New("caches: snapshot is encrypted but no encryption key is configured")
+	}
+
+	check, err := sr.readPayload(-1)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err = open(aead, check); err != nil {
+		return 0, err
+	}
+
+	sr.aead = aead
+	sr.offset += int64(len(check)) + 8
+	return flags[0], nil
+}
+
+// readData 读取数据区并校验文件摘要，用于没有删除区的旧版本文件
+func (sr *snapshotReader) readData() (*snapshot, error) {
+	data := make(map[string]*entry, 256)
+	err := sr.readSection(func(item Entry) {
+		data[item.Key] = markLarge(&entry{value: item.Value, expireAt: item.ExpireAt})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot{data: data}, sr.verifyDigest()
+}
+
+// readSection 读取数据块直到遇到结束块，每个键值对都会传给 fn
+func (sr *snapshotReader) readSection(fn func(item Entry)) error {
+	for ; ; sr.block++ {
+		raw, err := sr.readPayload(sr.block)
+		if err != nil {
+			return err
+		}
+
+		if raw == nil {
+			sr.offset += 4
+			return nil
+		}
+
+		payload := raw
+		if sr.aead != nil {
+			if payload, err = open(sr.aead, raw); err != nil {
+				return sr.corrupted(sr.block, "decryption failed")
+			}
+		}
+
+		entries, err := sr.codec.Unmarshal(payload)
+		if err != nil {
+			return sr.corrupted(sr.block, err.Error())
+		}
+
+		for _, item := range entries {
+			fn(item)
+		}
+		sr.offset += int64(len(raw)) + 8
+	}
+}
+
+// readPayload 读取一个数据块并检查校验和，读到结束块时返回 nil
+func (sr *snapshotReader) readPayload(block int) ([]byte, error) {
+	var size uint32
+	if err := binary.Read(sr.reader, binary.BigEndian, &size); err != nil {
+		return nil, sr.corrupted(block, "truncated block length")
+	}
+
+	if size == 0 {
+		return nil, nil
+	}
+
+	if size > snapshotMaxBlockSize {
+		return nil, sr.corrupted(block, fmt.Sprintf("invalid block length %d", size))
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(sr.reader, payload); err != nil {
+		return nil, sr.corrupted(block, "truncated block data")
+	}
+
+	var checksum uint32
+	if err := binary.Read(sr.reader, binary.BigEndian, &checksum); err != nil {
+		return nil, sr.corrupted(block, "truncated block checksum")
+	}
+
+	if checksum != crc32.ChecksumIEEE(payload) {
+		return nil, sr.corrupted(block, "checksum mismatch")
+	}
+	return payload, nil
+}
+
+// verifyDigest 读取文件末尾的摘要并和已经读取的内容的摘要进行比较
+func (sr *snapshotReader) verifyDigest() error {
+	expected := sr.digest.Sum(nil)
+	actual := make([]byte, len(expected))
+	if _, err := io.ReadFull(sr.r, actual); err != nil {
+		return sr.corrupted(-1, "truncated file digest")
+	}
+
+	if !bytes.Equal(expected, actual) {
+		return sr.corrupted(-1, "file digest mismatch")
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package caches
+
+import "time"
+
+// SnapshotView 是缓存在某一时刻的只读视图，用于统计分析和导出这样需要遍历所有数据的任务
+// 视图和缓存共享数据，创建视图只需要标记每个分片，之后缓存第一次修改某个分片时才会复制这个分片，视图中的数据不会再变化
+// 读取视图不需要加锁，不会阻塞缓存的读写，可以被多个协程同时使用，不再使用时直接丢弃就可以了
+type SnapshotView struct {
+	// segments 是创建视图时每个分片的 data 和 overlay，不会再被修改，不需要加锁
+	segments []*segment
+
+	// count 是创建视图时键值对的个数，包括已经过期但还没有被清理的，不包括内部 key
+	count int64
+
+	// createdAt 是创建视图的时间，单位是纳秒，判断是否过期都使用这个时间
+	createdAt int64
+
+	// largeThreshold 是缓存的 LargeObjectThreshold，用于读取大对象的清单
+	largeThreshold int
+}
+
+// Snapshot 返回缓存当前的只读视图，只在标记分片时短暂地持有写锁
+// 持有视图期间每个分片第一次被修改时需要复制一份，会占用额外的内存
+func (c *Cache) Snapshot() *SnapshotView {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	view := &SnapshotView{
+		segments:       make([]*segment, len(c.segments)),
+		count:          c.Count(),
+		createdAt:      c.now().UnixNano(),
+		largeThreshold: c.options.LargeObjectThreshold,
+	}
+	for i, seg := range c.segments {
+		seg.shared = true
+		view.segments[i] = &segment{data: seg.data, overlay: seg.overlay}
+	}
+	return view
+}
+
+// unshare 在分片被快照引用着时复制一份 data 和 overlay，之后的修改不会影响快照，调用者需要持有写锁，或者持有读锁和分片的锁
+func (seg *segment) unshare() {
+	if !seg.shared {
+		return
+	}
+
+	seg.data = copyEntries(seg.data)
+	if seg.overlay != nil {
+		seg.overlay = copyEntries(seg.overlay)
+	}
+	seg.shared = false
+}
+
+// copyEntries 返回 entries 的浅拷贝，entry 创建之后不会被修改，可以共享
+func copyEntries(entries map[string]*entry) map[string]*entry {
+	copied := make(map[string]*entry, len(entries))
+	for key, e := range entries {
+		copied[key] = e
+	}
+	return copied
+}
+
+// CreatedAt 返回创建视图的时间
+func (v *SnapshotView) CreatedAt() time.Time {
+	return time.Unix(0, v.createdAt)
+}
+
+// Count 返回创建视图时键值对的个数，和 Cache.Count 一样包括已经过期但还没有被清理的，不包括内部 key
+func (v *SnapshotView) Count() int64 {
+	return v.count
+}
+
+// Get 返回创建视图时 key 的 value，如果找不到、那时已经过期或者是内部 key 则返回 false，返回的 value 不能被修改
+func (v *SnapshotView) Get(key string) ([]byte, bool) {
+	e, ok := v.lookup(key)
+	if !ok || !e.alive(v.createdAt) || IsInternalKey(key) {
+		return nil, false
+	}
+
+	value, err := v.valueOf(key, e)
+	return value, err == nil
+}
+
+// lookup 返回创建视图时 key 的 entry
+func (v *SnapshotView) lookup(key string) (*entry, bool) {
+	seg := v.segments[shardOf(key, len(v.segments))]
+	e, ok := seg.overlay[key]
+	if !ok {
+		e, ok = seg.data[key]
+	}
+	return e, ok && e != nil
+}
+
+// valueOf 返回视图中 key 的 e 的 value，大对象返回拼接视图中所有分片之后的 value，缺少分片时返回 errLargeIncomplete
+func (v *SnapshotView) valueOf(key string, e *entry) ([]byte, error) {
+	if !e.large {
+		return e.data()
+	}
+
+	m, ok := manifestOf(e, v.largeThreshold)
+	if !ok {
+		return nil, errLargeIncomplete
+	}
+
+	value := make([]byte, 0, m.Size)
+	for _, partKey := range m.partKeys(key) {
+		part, ok := v.lookup(partKey)
+		if !ok {
+			return nil, errLargeIncomplete
+		}
+
+		data, err := part.data()
+		if err != nil {
+			return nil, err
+		}
+		value = append(value, data...)
+	}
+	return value, nil
+}
+
+// Range 遍历创建视图时所有没有过期的数据，fn 返回 false 时停止遍历，顺序是不确定的，不包括内部 key，大对象是拼接所有分片之后的 value
+// expireAt 是过期时间，零值表示永不过期，value 不能被修改
+func (v *SnapshotView) Range(fn func(key string, value []byte, expireAt time.Time) bool) {
+	for _, seg := range v.segments {
+		ok := seg.forEach(func(key string, e *entry) bool {
+			if IsInternalKey(key) || !e.alive(v.createdAt) {
+				return true
+			}
+
+			value, err := v.valueOf(key, e)
+			if err != nil {
+				return true
+			}
+
+			var expireAt time.Time
+			if e.expireAt != 0 {
+				expireAt = time.Unix(0, e.expireAt)
+			}
+			return fn(key, value, expireAt)
+		})
+
+		if !ok {
+			return
+		}
+	}
+}
+
+// Entries 返回创建视图时所有没有过期的数据，和 Cache.Entries 一样，但是不需要加锁
+func (v *SnapshotView) Entries() []Entry {
+	entries := make([]Entry, 0, v.count)
+	v.Range(func(key string, value []byte, expireAt time.Time) bool {
+		entry := Entry{Key: key, Value: value}
+		if !expireAt.IsZero() {
+			entry.ExpireAt = expireAt.UnixNano()
+		}
+		entries = append(entries, entry)
+		return true
+	})
+	return entries
+}
@@ -0,0 +1,40 @@
+package caches
+
+import (
+	"time"
+)
+
+// GetStale 返回已经过期但是过期不超过 Options.StaleGrace 的 key 的 value，以及已经过期了多久
+// 用于后端不可用时代替错误返回过期的数据，key 没有过期时也返回 false，这时应该使用 Get
+// 读取过期的数据不算作命中或者没有命中，也不会影响淘汰顺序
+func (c *Cache) GetStale(key string) ([]byte, time.Duration, bool) {
+	if c.options.StaleGrace <= 0 {
+		return nil, 0, false
+	}
+
+	var e *entry
+	var ok bool
+	if c.view != nil {
+		e, ok = c.view.load(key)
+	} else {
+		unlock := c.rlockKey(key)
+		e, ok = c.lookup(key)
+		unlock()
+	}
+
+	now := c.now().UnixNano()
+	if !ok || e.alive(now) {
+		return nil, 0, false
+	}
+
+	age := time.Duration(now - e.expireAt)
+	if age > c.options.StaleGrace {
+		return nil, 0, false
+	}
+
+	value, err := c.valueOf(key, e)
+	if err != nil {
+		return nil, 0, false
+	}
+	return value, age, true
+}
@@ -0,0 +1,114 @@
+package caches
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats 是缓存的统计数据，除了 Keys 之外都是从创建缓存开始累计的次数
+type Stats struct {
+	// Keys 是当前键值对的个数
+	Keys int64 `json:"keys"`
+
+	// Bytes 是当前所有 key 和 value 占用的总字节数，可以近似地看作数据占用的内存
+	Bytes int64 `json:"bytes"`
+
+	// UsedBytes 是加上每个键值对的额外开销之后数据大约占用的内存
+	UsedBytes int64 `json:"used_bytes"`
+
+	// Hits 和 Misses 是 Get 命中和没有命中的次数
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+
+	// Sets 和 Deletes 是保存和删除数据的次数
+	Sets    int64 `json:"sets"`
+	Deletes int64 `json:"deletes"`
+
+	// Expired 是被清理的过期数据的个数
+	Expired int64 `json:"expired"`
+
+	// Evictions 是超出 MaxEntries 或者 MaxBytes 时被淘汰的数据的个数
+	Evictions int64 `json:"evictions"`
+
+	// Rejected 是缓存已满时被准入策略拒绝而丢弃，或者开启了 RejectWhenFull 时被拒绝的写入的个数
+	Rejected int64 `json:"rejected"`
+
+	// GcIntervalMs 是当前自动清理的间隔毫秒数，开启自适应清理时会随着过期数据的多少变化，为 0 表示没有自动清理
+	GcIntervalMs int64 `json:"gc_interval_ms"`
+
+	// ReadShards 是无锁读取的只读视图当前的分片数，Reshards 是自动重新分片的次数，没有开启无锁读取时都为 0
+	ReadShards int64 `json:"read_shards"`
+	Reshards   int64 `json:"reshards"`
+
+	// Segments 是数据的分片数
+	Segments int `json:"segments"`
+
+	// AOFSize 是 AOF 当前的字节数，AOFRewrites 是重写 AOF 的次数，没有开启 AOF 时都为 0
+	AOFSize     int64 `json:"aof_size"`
+	AOFRewrites int64 `json:"aof_rewrites"`
+
+	// Latency 是 get、set 和 delete 操作在缓存层的耗时分布
+	Latency map[string]LatencyStats `json:"latency"`
+}
+
+// counters 是缓存的统计计数器，使用原子操作更新，不需要持有锁
+type counters struct {
+	hits    int64
+	misses  int64
+	sets    int64
+	deletes int64
+	expired int64
+
+	// evictions 是被淘汰的数据的个数
+	evictions int64
+
+	// rejected 是被准入策略或者 RejectWhenFull 拒绝的写入的个数
+	rejected int64
+
+	// gcInterval 是当前自动清理的间隔
+	gcInterval int64
+
+	// getLatency、setLatency 和 deleteLatency 记录各个操作的耗时
+	getLatency    Histogram
+	setLatency    Histogram
+	deleteLatency Histogram
+}
+
+// Stats 返回缓存的统计数据
+func (c *Cache) Stats() Stats {
+	var readShards, reshards int64
+	if c.view != nil {
+		readShards = atomic.LoadInt64(&c.view.shards)
+		reshards = atomic.LoadInt64(&c.view.reshards)
+	}
+
+	var aofSize, aofRewrites int64
+	if aof := c.options.AOF; aof != nil {
+		aofSize = aof.Size()
+		aofRewrites = atomic.LoadInt64(&aof.rewrites)
+	}
+
+	return Stats{
+		Keys:         c.Count(),
+		Bytes:        c.Bytes(),
+		UsedBytes:    c.UsedBytes(),
+		Hits:         atomic.LoadInt64(&c.counters.hits),
+		Misses:       atomic.LoadInt64(&c.counters.misses),
+		Sets:         atomic.LoadInt64(&c.counters.sets),
+		Deletes:      atomic.LoadInt64(&c.counters.deletes),
+		Expired:      atomic.LoadInt64(&c.counters.expired),
+		Evictions:    atomic.LoadInt64(&c.counters.evictions),
+		Rejected:     atomic.LoadInt64(&c.counters.rejected),
+		GcIntervalMs: time.Duration(atomic.LoadInt64(&c.counters.gcInterval)).Milliseconds(),
+		ReadShards:   readShards,
+		Reshards:     reshards,
+		Segments:     c.options.Segments,
+		AOFSize:      aofSize,
+		AOFRewrites:  aofRewrites,
+		Latency: map[string]LatencyStats{
+			"get":    c.counters.getLatency.Stats(),
+			"set":    c.counters.setLatency.Stats(),
+			"delete": c.counters.deleteLatency.Stats(),
+		},
+	}
+}
@@ -0,0 +1,92 @@
+package caches
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// throttleChunkSize 是限速写入时每次写入的最大字节数
+// 大的数据块会被拆开写入，避免一次写入占满磁盘带宽
+const throttleChunkSize = 64 * 1024
+
+// RateLimiter 限制持久化写入磁盘的速度，持久化文件和 AOF 可以共用一个限速器
+// 在机械硬盘或者和其他服务共用的磁盘上，持久化占满磁盘带宽会导致请求的延迟变高
+type RateLimiter struct {
+	// rate 是每秒最多写入的字节数，不大于 0 时不限速
+	rate int64
+
+	// next 是下一次写入可以开始的时间
+	next time.Time
+
+	// lock 用于保证并发安全
+	lock *sync.Mutex
+}
+
+// NewRateLimiter 返回一个每秒最多写入 bytesPerSecond 字节的限速器，bytesPerSecond 不大于 0 时不限速
+func NewRateLimiter(bytesPerSecond int64) *RateLimiter {
+	return &RateLimiter{rate: bytesPerSecond, lock: &sync.Mutex{}}
+}
+
+// SetRate 修改每秒最多写入的字节数，bytesPerSecond 不大于 0 时不限速，正在进行的写入也会使用新的速度
+func (rl *RateLimiter) SetRate(bytesPerSecond int64) {
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+	rl.rate = bytesPerSecond
+	rl.next = time.Time{}
+}
+
+// wait 预留 n 个字节的写入额度，额度不够时会一直等待
+func (rl *RateLimiter) wait(n int) {
+	rl.lock.Lock()
+	if rl.rate <= 0 {
+		rl.lock.Unlock()
+		return
+	}
+
+	now := time.Now()
+	if rl.next.Before(now) {
+		rl.next = now
+	}
+	start := rl.next
+	rl.next = rl.next.Add(time.Duration(int64(n) * int64(time.Second) / rl.rate))
+	rl.lock.Unlock()
+
+	if delay := start.Sub(now); delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+// Writer 返回一个写入 w 时会被限速的 io.Writer，rl 为 nil 时直接返回 w
+func (rl *RateLimiter) Writer(w io.Writer) io.Writer {
+	if rl == nil {
+		return w
+	}
+	return &throttledWriter{writer: w, limiter: rl}
+}
+
+// throttledWriter 是限速写入的 io.Writer
+type throttledWriter struct {
+	writer  io.Writer
+	limiter *RateLimiter
+}
+
+// Write 将 p 拆分成小块，每块都等待限速器的额度之后再写入
+func (tw *throttledWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > throttleChunkSize {
+			chunk = chunk[:throttleChunkSize]
+		}
+
+		tw.limiter.wait(len(chunk))
+		n, err := tw.writer.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[len(chunk):]
+	}
+	return written, nil
+}
@@ -0,0 +1,52 @@
+package caches
+
+import (
+	"time"
+)
+
+// Update 原子地使用 fn 的返回值替换 key 的 value，过期时间保持不变，返回修改后的 value
+// fn 的参数是缓存中的 value，不能修改；返回的 value 由缓存持有，调用者之后不能再修改
+// key 不存在或者已经过期时不调用 fn 并返回 false，fn 返回错误时放弃修改并返回这个错误
+func (c *Cache) Update(key string, fn func(value []byte) ([]byte, error)) ([]byte, bool, error) {
+	return c.update(key, fn, false)
+}
+
+// UpdateWithQuota 和 Update 一样修改 key 的 value，但是修改之后会超出 key 所在命名空间的配额时返回 *QuotaError
+func (c *Cache) UpdateWithQuota(key string, fn func(value []byte) ([]byte, error)) ([]byte, bool, error) {
+	return c.update(key, fn, true)
+}
+
+// update 在 key 的锁下读取、修改并保存 key，checkQuota 为 true 时检查命名空间的配额
+func (c *Cache) update(key string, fn func(value []byte) ([]byte, error), checkQuota bool) ([]byte, bool, error) {
+	if err := CheckKey(key); err != nil {
+		return nil, false, err
+	}
+
+	defer c.counters.setLatency.Since(time.Now())
+	defer c.lockKeys(checkQuota, key)()
+	old, ok := c.lookup(key)
+	if !ok || !old.alive(c.now().UnixNano()) {
+		return nil, false, nil
+	}
+
+	current, err := old.data()
+	if err != nil {
+		return nil, true, err
+	}
+
+	value, err := fn(current)
+	if err != nil {
+		return nil, true, err
+	}
+
+	e := &entry{value: value, expireAt: old.expireAt, priority: old.priority}
+	if err = checkValue(e); err != nil {
+		return nil, true, err
+	}
+
+	c.compress(e)
+	if err = c.putKey(key, e, checkQuota); err != nil {
+		return nil, true, err
+	}
+	return value, true, nil
+}
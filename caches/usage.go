@@ -0,0 +1,132 @@
+package caches
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// OpsUsage 是一组 key 在当前计费周期内的操作用量
+type OpsUsage struct {
+	// Reads 是 Get 的次数，包括没有命中的
+	Reads int64 `json:"reads"`
+
+	// Writes 和 Deletes 是写入和删除的次数，淘汰和过期清理不计算在内
+	Writes  int64 `json:"writes"`
+	Deletes int64 `json:"deletes"`
+
+	// ReadBytes 和 WriteBytes 是读取和写入的 key 和 value 的总字节数
+	ReadBytes  int64 `json:"read_bytes"`
+	WriteBytes int64 `json:"write_bytes"`
+}
+
+// opsCounters 是 OpsUsage 的计数器，读写时不需要持有锁
+type opsCounters struct {
+	reads      int64
+	writes     int64
+	deletes    int64
+	readBytes  int64
+	writeBytes int64
+}
+
+// read 记录一次 Get，没有命中时 size 为 0
+func (oc *opsCounters) read(size int) {
+	atomic.AddInt64(&oc.reads, 1)
+	atomic.AddInt64(&oc.readBytes, int64(size))
+}
+
+// write 记录一次写入
+func (oc *opsCounters) write(size int) {
+	atomic.AddInt64(&oc.writes, 1)
+	atomic.AddInt64(&oc.writeBytes, int64(size))
+}
+
+// delete 记录一次删除
+func (oc *opsCounters) delete() {
+	atomic.AddInt64(&oc.deletes, 1)
+}
+
+// load 返回当前的用量，reset 为 true 时同时清零
+func (oc *opsCounters) load(reset bool) OpsUsage {
+	get := atomic.LoadInt64
+	if reset {
+		get = func(counter *int64) int64 {
+			return atomic.SwapInt64(counter, 0)
+		}
+	}
+
+	return OpsUsage{
+		Reads:      get(&oc.reads),
+		Writes:     get(&oc.writes),
+		Deletes:    get(&oc.deletes),
+		ReadBytes:  get(&oc.readBytes),
+		WriteBytes: get(&oc.writeBytes),
+	}
+}
+
+// UsageReport 是一个计费周期内每个命名空间和前缀分组的用量
+type UsageReport struct {
+	// Start 和 End 是计费周期的开始和结束时间
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+
+	// Namespaces 是每个命名空间的用量，没有配置命名空间时为空
+	Namespaces []NamespaceUsage `json:"namespaces"`
+
+	// Prefixes 是每个前缀分组的用量，没有配置前缀分组时为空
+	Prefixes []PrefixStats `json:"prefixes"`
+}
+
+// recordRead 记录 key 的一次 Get，size 是读取的 key 和 value 的字节数，没有命中时为 0
+func (c *Cache) recordRead(key string, size int) {
+	if c.prefixes != nil {
+		c.prefixes.ops[c.prefixes.group(key)].read(size)
+	}
+	if ns := c.namespaces; ns != nil {
+		if i := ns.find(key); i >= 0 {
+			ns.ops[i].read(size)
+		}
+	}
+}
+
+// recordWrite 记录 key 的一次写入
+func (c *Cache) recordWrite(key string, e *entry) {
+	size := len(key) + e.size()
+	if c.prefixes != nil {
+		c.prefixes.ops[c.prefixes.group(key)].write(size)
+	}
+	if ns := c.namespaces; ns != nil {
+		if i := ns.find(key); i >= 0 {
+			ns.ops[i].write(size)
+		}
+	}
+}
+
+// recordDelete 记录 key 的一次删除
+func (c *Cache) recordDelete(key string) {
+	if c.prefixes != nil {
+		c.prefixes.ops[c.prefixes.group(key)].delete()
+	}
+	if ns := c.namespaces; ns != nil {
+		if i := ns.find(key); i >= 0 {
+			ns.ops[i].delete()
+		}
+	}
+}
+
+// UsageReport 返回当前计费周期内每个命名空间和前缀分组的用量，用于按用量计费
+// reset 为 true 时结束当前的计费周期，操作用量和存储量清零，之后的用量计入新的周期，命名空间的 MaxWriteBytes 也重新计算
+// 前缀分组的键值对个数和字节数需要遍历整个缓存计算，期间会持有读锁
+func (c *Cache) UsageReport(reset bool) UsageReport {
+	now := time.Now()
+	report := UsageReport{
+		Start:      time.Unix(0, atomic.LoadInt64(&c.usageSince)),
+		End:        now,
+		Namespaces: c.namespaceUsage(now, reset),
+		Prefixes:   c.prefixStats(reset),
+	}
+
+	if reset {
+		atomic.StoreInt64(&c.usageSince, now.UnixNano())
+	}
+	return report
+}
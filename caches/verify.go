@@ -0,0 +1,135 @@
+package caches
+
+import (
+	"context"
+	"errors"
+	"hash/crc32"
+)
+
+// maxVerifyKeys 是 VerifyReport 中最多记录的损坏的 key 的个数
+const maxVerifyKeys = 100
+
+// ErrNoChecksums 表示没有开启 Checksums，value 没有可以校验的校验和
+var ErrNoChecksums = errors.New("caches: checksums are not enabled")
+
+// RepairFunc 返回损坏的 key 正确的 value，数据源中也没有这个 key 时返回 false
+type RepairFunc func(ctx context.Context, key string) (value []byte, found bool, err error)
+
+// VerifyReport 是一次数据校验的结果
+type VerifyReport struct {
+	// Checked 是校验过的键值对的个数，Corrupted 是其中 value 和校验和不一致的个数
+	Checked   int64 `json:"checked"`
+	Corrupted int64 `json:"corrupted"`
+
+	// Repaired 是重新获取到 value 并替换掉的个数，Deleted 是没有获取到而被删除的个数
+	// 校验期间被修改或者删除了的 key 不需要修复，两者都不计入
+	Repaired int64 `json:"repaired"`
+	Deleted  int64 `json:"deleted"`
+
+	// RepairErrors 是重新获取 value 失败的次数，这些 key 也会被删除
+	RepairErrors int64 `json:"repair_errors"`
+
+	// Keys 是损坏的 key，最多记录 100 个
+	Keys []string `json:"keys"`
+}
+
+// checksumOf 返回 e 在内存中的 value 的校验和，压缩过的 value 计算压缩之后的数据，分块保存的 value 依次计算每一块
+func checksumOf(e *entry) uint32 {
+	if e.chunks == nil {
+		return crc32.ChecksumIEEE(e.value)
+	}
+
+	var sum uint32
+	for ch := e.chunks; ch != nil; ch = ch.next {
+		sum = crc32.Update(sum, crc32.IEEETable, ch.data)
+	}
+	return sum
+}
+
+// Checksums 返回是否开启了 Checksums
+func (c *Cache) Checksums() bool {
+	return c.options.Checksums
+}
+
+// Verify 遍历所有的键值对，重新计算 value 的校验和并和写入时保存的比较，找出在内存中损坏的 value，fix 为 false 时只报告不修改
+// repair 不为 nil 时使用它重新获取损坏的 key 的 value 并替换掉损坏的 value，过期时间和优先级保持不变
+// repair 为 nil、没有获取到或者获取失败时删除损坏的 key，避免继续读到错误的数据
+// 每次只持有一个分片的读锁，不会长时间阻塞读写，ctx 结束时中止，返回已经校验的结果和 ctx 的错误
+func (c *Cache) Verify(ctx context.Context, fix bool, repair RepairFunc) (VerifyReport, error) {
+	report := VerifyReport{Keys: make([]string, 0)}
+	if !c.options.Checksums {
+		return report, ErrNoChecksums
+	}
+
+	for i := 0; ; i++ {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		c.lock.RLock()
+		if i >= len(c.segments) {
+			c.lock.RUnlock()
+			return report, nil
+		}
+
+		corrupted := make(map[string]*entry)
+		seg := c.segments[i]
+		seg.lock.RLock()
+		seg.forEach(func(key string, e *entry) bool {
+			report.Checked++
+			if checksumOf(e) != e.checksum {
+				corrupted[key] = e
+			}
+			return true
+		})
+		seg.lock.RUnlock()
+		c.lock.RUnlock()
+
+		// 重新获取 value 可能很慢，不能持有锁
+		for key, e := range corrupted {
+			report.Corrupted++
+			if len(report.Keys) < maxVerifyKeys {
+				report.Keys = append(report.Keys, key)
+			}
+
+			if !fix {
+				continue
+			}
+
+			var value []byte
+			if repair != nil {
+				v, found, err := repair(ctx, key)
+				if err != nil {
+					report.RepairErrors++
+				} else if found {
+					value = v
+				}
+			}
+
+			switch {
+			case !c.repairEntry(key, e, value):
+			case value != nil:
+				report.Repaired++
+			default:
+				report.Deleted++
+			}
+		}
+	}
+}
+
+// repairEntry 在 key 仍然是损坏的 e 时使用 value 替换它，value 为 nil 时删除 key，返回是否修改了
+func (c *Cache) repairEntry(key string, e *entry, value []byte) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if current, ok := c.lookup(key); !ok || current != e {
+		return false
+	}
+
+	if value == nil {
+		c.deleteLocked(key)
+		return true
+	}
+
+	c.putLocked(key, &entry{value: value, large: e.large, expireAt: e.expireAt, priority: e.priority}, false)
+	return true
+}
@@ -0,0 +1,172 @@
+package caches
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// stallIntervals 是判断后台协程卡住时允许错过的心跳次数
+	stallIntervals = 3
+
+	// minStallTimeout 是判断后台协程卡住的最短时间，避免间隔很短的协程偶尔慢一点就被当成卡住
+	minStallTimeout = 10 * time.Second
+)
+
+// 后台协程的状态
+const (
+	// WorkerRunning 表示协程在按时工作
+	WorkerRunning = "running"
+
+	// WorkerStalled 表示协程还没有退出，但是超过 3 个间隔没有完成一轮工作，比如一直等待某个锁
+	WorkerStalled = "stalled"
+
+	// WorkerCrashed 表示协程因为 panic 退出了，它负责的工作不会再进行
+	WorkerCrashed = "crashed"
+
+	// WorkerStopped 表示协程被正常停止了
+	WorkerStopped = "stopped"
+)
+
+const (
+	workerRunning int32 = iota
+	workerStopped
+	workerCrashed
+)
+
+// WorkerStatus 是后台协程的存活状态
+type WorkerStatus struct {
+	Name  string `json:"name"`
+	State string `json:"state"`
+
+	// LastBeat 是协程最后一次完成一轮工作的时间
+	LastBeat time.Time `json:"last_beat"`
+
+	// Error 和 Stack 是协程 panic 时的值和调用栈，只有 State 是 WorkerCrashed 时才有
+	Error string `json:"error,omitempty"`
+	Stack string `json:"stack,omitempty"`
+}
+
+// Healthy 返回协程是否正常，卡住和崩溃的协程不正常，被正常停止的协程也算正常
+func (ws WorkerStatus) Healthy() bool {
+	return ws.State != WorkerStalled && ws.State != WorkerCrashed
+}
+
+// Worker 记录一个后台协程的存活状态，协程每完成一轮工作调用一次 Beat，退出时调用 Stop
+// 协程中需要 defer 调用 Recover，这样 panic 时协程会被标记为崩溃，而不是让整个进程退出
+type Worker struct {
+	name string
+
+	// interval 是两次 Beat 之间预期的最长间隔，lastBeat 是最后一次 Beat 的时间，单位都是纳秒，需要原子地读写
+	interval int64
+	lastBeat int64
+
+	// state 是 workerRunning、workerStopped 或 workerCrashed，需要原子地读写
+	state int32
+
+	// lock 保护 err 和 stack
+	lock  sync.Mutex
+	err   string
+	stack string
+}
+
+// newWorker 返回名为 name、预期每隔 interval 调用一次 Beat 的正在运行的协程
+func newWorker(name string, interval time.Duration) *Worker {
+	return &Worker{name: name, interval: int64(interval), lastBeat: time.Now().UnixNano()}
+}
+
+// Beat 记录协程完成了一轮工作
+func (w *Worker) Beat() {
+	atomic.StoreInt64(&w.lastBeat, time.Now().UnixNano())
+}
+
+// SetInterval 修改两次 Beat 之间预期的最长间隔，用于间隔会变化的协程
+func (w *Worker) SetInterval(interval time.Duration) {
+	atomic.StoreInt64(&w.interval, int64(interval))
+}
+
+// Stop 标记协程被正常停止了
+func (w *Worker) Stop() {
+	atomic.CompareAndSwapInt32(&w.state, workerRunning, workerStopped)
+}
+
+// Recover 恢复协程中的 panic，并标记协程崩溃了，需要在协程中直接 defer 调用
+func (w *Worker) Recover() {
+	if v := recover(); v != nil {
+		w.lock.Lock()
+		w.err = fmt.Sprint("panic: ", v)
+		w.stack = string(debug.Stack())
+		w.lock.Unlock()
+		atomic.StoreInt32(&w.state, workerCrashed)
+	}
+}
+
+// status 返回协程在 now 时的状态
+func (w *Worker) status(now time.Time) WorkerStatus {
+	lastBeat := time.Unix(0, atomic.LoadInt64(&w.lastBeat))
+	status := WorkerStatus{Name: w.name, State: WorkerRunning, LastBeat: lastBeat}
+	switch atomic.LoadInt32(&w.state) {
+	case workerStopped:
+		status.State = WorkerStopped
+	case workerCrashed:
+		status.State = WorkerCrashed
+		w.lock.Lock()
+		status.Error, status.Stack = w.err, w.stack
+		w.lock.Unlock()
+	default:
+		timeout := stallIntervals * time.Duration(atomic.LoadInt64(&w.interval))
+		if timeout < minStallTimeout {
+			timeout = minStallTimeout
+		}
+
+		if now.Sub(lastBeat) > timeout {
+			status.State = WorkerStalled
+		}
+	}
+	return status
+}
+
+// workers 是缓存的所有后台协程，按照名字索引
+type workers struct {
+	lock sync.Mutex
+	m    map[string]*Worker
+}
+
+// add 添加协程，已经有同名的协程时替换掉它，比如重新加载配置之后重新开启的自动清理
+func (ws *workers) add(w *Worker) {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+	if ws.m == nil {
+		ws.m = make(map[string]*Worker)
+	}
+	ws.m[w.name] = w
+}
+
+// RegisterWorker 记录一个名为 name、预期每隔 interval 完成一轮工作的后台协程，返回的 Worker 用于报告它的存活状态
+// 缓存自己的自动清理、自动保存和 AOF 已经记录了，这个方法用于复制这样在缓存之外运行的协程
+func (c *Cache) RegisterWorker(name string, interval time.Duration) *Worker {
+	w := newWorker(name, interval)
+	c.workers.add(w)
+	return w
+}
+
+// Workers 返回所有后台协程的存活状态，按照名字排序
+func (c *Cache) Workers() []WorkerStatus {
+	c.workers.lock.Lock()
+	defer c.workers.lock.Unlock()
+
+	now := time.Now()
+	statuses := make([]WorkerStatus, 0, len(c.workers.m))
+	for _, w := range c.workers.m {
+		statuses = append(statuses, w.status(now))
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
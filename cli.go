@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// cliCommand 作为客户端读写服务器中的数据，用法为 cli [flags] <get|set|del|incr|decr|lock|unlock|type|object|randomkey|mget|status|stats> [key] [value] [ttl]
+// set 没有给出 value 或者 value 为 - 时从标准输入读取，ttl 是数据的存活时间，lock 的 value 是锁的存活时间，unlock 的 value 是 fencing token
+// incr 和 decr 的 value 是加上或者减去的整数，默认为 1，randomkey 的 key 位置是随机返回的 key 的个数，默认为 1
+// mget 后面可以有多个 key，在一个请求中读取
+func cliCommand(args []string) error {
+	flags := flag.NewFlagSet("cli", flag.ExitOnError)
+	client := bindClientFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: cli [flags] <get|set|del|incr|decr|lock|unlock|type|object|randomkey|mget|status|stats> [key] [value] [ttl]\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	args = flags.Args()
+	if len(args) == 0 {
+		flags.Usage()
+		return errors.New("missing operation")
+	}
+
+	operation, args := args[0], args[1:]
+	switch operation {
+	case "get", "set", "del", "incr", "decr", "lock", "type", "object", "mget":
+		if len(args) == 0 {
+			return fmt.Errorf("%s requires a key", operation)
+		}
+	case "unlock":
+		if len(args) < 2 {
+			return errors.New("unlock requires a key and a token")
+		}
+	}
+
+	var response *http.Response
+	var err error
+	switch operation {
+	case "get":
+		response, err = client.do(http.MethodGet, "/cache/"+url.PathEscape(args[0]), "", nil)
+	case "set":
+		var value io.Reader = os.Stdin
+		if len(args) > 1 && args[1] != "-" {
+			value = strings.NewReader(args[1])
+		}
+		path := "/cache/" + url.PathEscape(args[0])
+		if len(args) > 2 {
+			path += "?ttl=" + url.QueryEscape(args[2])
+		}
+		response, err = client.do(http.MethodPut, path, "", value)
+	case "del":
+		response, err = client.do(http.MethodDelete, "/cache/"+url.PathEscape(args[0]), "", nil)
+	case "incr", "decr":
+		var delta io.Reader
+		if len(args) > 1 {
+			delta = strings.NewReader(args[1])
+		}
+		response, err = client.do(http.MethodPost, "/cache/"+url.PathEscape(args[0])+"/"+operation, "", delta)
+	case "lock":
+		path := "/locks/" + url.PathEscape(args[0])
+		if len(args) > 1 {
+			path += "?ttl=" + url.QueryEscape(args[1])
+		}
+		response, err = client.do(http.MethodPost, path, "", nil)
+	case "unlock":
+		response, err = client.do(http.MethodDelete, "/locks/"+url.PathEscape(args[0])+"?token="+url.QueryEscape(args[1]), "", nil)
+	case "type":
+		response, err = client.do(http.MethodGet, "/type/"+url.PathEscape(args[0]), "", nil)
+	case "object":
+		response, err = client.do(http.MethodGet, "/object/"+url.PathEscape(args[0]), "", nil)
+	case "randomkey":
+		path := "/randomkey"
+		if len(args) > 0 {
+			path += "?count=" + url.QueryEscape(args[0])
+		}
+		response, err = client.do(http.MethodGet, path, "", nil)
+	case "mget":
+		ops := make([]map[string]string, len(args))
+		for i, key := range args {
+			ops[i] = map[string]string{"op": "get", "key": key}
+		}
+		body, _ := json.Marshal(ops)
+		response, err = client.do(http.MethodPost, "/batch", "application/json", bytes.NewReader(body))
+	case "status":
+		response, err = client.do(http.MethodGet, "/status", "", nil)
+	case "stats":
+		response, err = client.do(http.MethodGet, "/stats", "", nil)
+	default:
+		return fmt.Errorf("unknown operation %q", operation)
+	}
+
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotFound && (operation == "get" || operation == "object") {
+		return fmt.Errorf("key %q not found", args[0])
+	}
+
+	if response.StatusCode/100 != 2 {
+		message, _ := ioutil.ReadAll(response.Body)
+		return fmt.Errorf("%s failed: %s %s", operation, response.Status, strings.TrimSpace(string(message)))
+	}
+
+	_, err = io.Copy(os.Stdout, response.Body)
+	if err == nil && operation != "get" && operation != "set" && operation != "del" && operation != "unlock" {
+		fmt.Println()
+	}
+	return err
+}
@@ -0,0 +1,157 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	// BatchGet、BatchSet 和 BatchDelete 是批量操作中操作的类型
+	BatchGet    = "get"
+	BatchSet    = "set"
+	BatchDelete = "delete"
+)
+
+// BatchOp 是批量操作中的一个操作
+type BatchOp struct {
+	// Op 是操作的类型，可以是 BatchGet、BatchSet 或者 BatchDelete
+	Op  string
+	Key string
+
+	// Value 和 TTL 是 BatchSet 的 value 和存活时间，TTL 为 0 表示永不过期
+	Value []byte
+	TTL   time.Duration
+}
+
+// BatchResult 是批量操作中一个操作的结果
+type BatchResult struct {
+	Key string
+
+	// Status 和单独执行这个操作时的状态码一样，比如 BatchGet 找不到 key 时为 404
+	Status int
+
+	// Value 和 Version 是 BatchGet 读到的 value 和版本号
+	Value   []byte
+	Version uint64
+
+	// Error 是操作失败的原因
+	Error string
+}
+
+// Batch 在一个请求中按顺序执行 ops 中的所有操作，返回和 ops 一一对应的结果，某个操作失败不影响其他操作
+// 集群模式下服务器会把其他节点负责的 key 转发给负责的节点，用 ClusterClient.PickNode 把 key 分组之后直接发送可以少一次转发
+func (c *Client) Batch(ctx context.Context, ops []BatchOp) ([]BatchResult, error) {
+	type op struct {
+		Op       string `json:"op"`
+		Key      string `json:"key"`
+		Value    string `json:"value,omitempty"`
+		Encoding string `json:"encoding,omitempty"`
+		TTL      string `json:"ttl,omitempty"`
+	}
+
+	body := make([]op, len(ops))
+	for i, o := range ops {
+		body[i] = op{Op: o.Op, Key: o.Key}
+		if o.Op == BatchSet {
+			body[i].Value, body[i].Encoding = base64.StdEncoding.EncodeToString(o.Value), "base64"
+			if o.TTL > 0 {
+				body[i].TTL = o.TTL.String()
+			}
+		}
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Results []struct {
+			Key      string `json:"key"`
+			Status   int    `json:"status"`
+			Value    string `json:"value"`
+			Encoding string `json:"encoding"`
+			Version  uint64 `json:"version"`
+			Error    string `json:"error"`
+		} `json:"results"`
+	}
+	if err = c.call(ctx, http.MethodPost, "/batch", nil, bytes.NewReader(data), &response); err != nil {
+		return nil, err
+	}
+
+	results := make([]BatchResult, len(response.Results))
+	for i, r := range response.Results {
+		results[i] = BatchResult{Key: r.Key, Status: r.Status, Value: []byte(r.Value), Version: r.Version, Error: r.Error}
+		if r.Encoding == "base64" {
+			if results[i].Value, err = base64.StdEncoding.DecodeString(r.Value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return results, nil
+}
+
+// MGet 在一个请求中读取 keys 中所有的 key，找不到或者已经过期的 key 不在返回的 map 中
+func (c *Client) MGet(ctx context.Context, keys []string) (map[string][]byte, error) {
+	ops := make([]BatchOp, len(keys))
+	for i, key := range keys {
+		ops[i] = BatchOp{Op: BatchGet, Key: key}
+	}
+
+	results, err := c.Batch(ctx, ops)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string][]byte, len(results))
+	for _, result := range results {
+		if result.Status == http.StatusOK {
+			values[result.Key] = result.Value
+		}
+	}
+	return values, nil
+}
+
+// MSet 在一个请求中保存 values 中所有的 key 和 value，ttl 之后过期，ttl 为 0 表示永不过期
+// 有 key 写入失败时返回第一个失败的原因，其他 key 仍然会写入
+func (c *Client) MSet(ctx context.Context, values map[string][]byte, ttl time.Duration) error {
+	ops := make([]BatchOp, 0, len(values))
+	for key, value := range values {
+		ops = append(ops, BatchOp{Op: BatchSet, Key: key, Value: value, TTL: ttl})
+	}
+
+	results, err := c.Batch(ctx, ops)
+	if err != nil {
+		return err
+	}
+	return firstBatchError(results)
+}
+
+// MDelete 在一个请求中删除 keys 中所有的 key
+func (c *Client) MDelete(ctx context.Context, keys []string) error {
+	ops := make([]BatchOp, len(keys))
+	for i, key := range keys {
+		ops[i] = BatchOp{Op: BatchDelete, Key: key}
+	}
+
+	results, err := c.Batch(ctx, ops)
+	if err != nil {
+		return err
+	}
+	return firstBatchError(results)
+}
+
+// firstBatchError 返回第一个失败的操作的错误，全部成功时返回 nil
+func firstBatchError(results []BatchResult) error {
+	for _, result := range results {
+		if result.Status/100 != 2 {
+			return fmt.Errorf("client: batch op on %q failed: %d %s", result.Key, result.Status, result.Error)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,486 @@
+// Package client 是访问 gocache 服务器的 Go 客户端
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNotHeld 表示锁、租约或者预留已经过期，或者被其他客户端获取了
+var ErrNotHeld = errors.New("client: not held")
+
+// Client 通过 HTTP 接口访问 gocache 服务器，可以被多个协程同时使用
+type Client struct {
+	// Server 是服务器的地址，比如 "http://127.0.0.1:8888"
+	Server string
+
+	// APIKey 是访问服务器使用的 API key，为空表示不认证
+	APIKey string
+
+	// Username 和 Password 是通过 HTTP Basic 认证访问服务器使用的用户名和密码，Username 为空表示不使用
+	Username string
+	Password string
+
+	// HTTPClient 是发送请求使用的客户端，为 nil 时使用 http.DefaultClient
+	HTTPClient *http.Client
+}
+
+// New 返回访问 server 的客户端
+func New(server string) *Client {
+	return &Client{Server: server}
+}
+
+// Get 返回 key 对应的 value，key 不存在时返回 false
+func (c *Client) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, _, ok, err := c.GetWithVersion(ctx, key)
+	return value, ok, err
+}
+
+// GetWithVersion 和 Get 一样返回 key 对应的 value，同时返回 value 的版本号，可以用于 DeleteIfVersion
+func (c *Client) GetWithVersion(ctx context.Context, key string) ([]byte, uint64, bool, error) {
+	response, err := c.do(ctx, http.MethodGet, "/cache/"+url.PathEscape(key), nil, nil)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotFound {
+		return nil, 0, false, nil
+	}
+
+	if err = checkStatus(response); err != nil {
+		return nil, 0, false, err
+	}
+
+	version, _ := strconv.ParseUint(response.Header.Get("X-Version"), 10, 64)
+	value, err := ioutil.ReadAll(response.Body)
+	return value, version, err == nil, err
+}
+
+// Set 保存 key 和 value
+func (c *Client) Set(ctx context.Context, key string, value []byte) error {
+	return c.call(ctx, http.MethodPut, "/cache/"+url.PathEscape(key), nil, bytes.NewReader(value), nil)
+}
+
+// SetWithTTL 保存 key 和 value，ttl 之后过期，ttl 为 0 表示永不过期
+func (c *Client) SetWithTTL(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	query := url.Values{"ttl": {ttl.String()}}
+	return c.call(ctx, http.MethodPut, "/cache/"+url.PathEscape(key), query, bytes.NewReader(value), nil)
+}
+
+// SetWithExpireAt 保存 key 和 value，在 at 时过期，at 必须在将来
+func (c *Client) SetWithExpireAt(ctx context.Context, key string, value []byte, at time.Time) error {
+	query := url.Values{"expire_at": {at.Format(time.RFC3339Nano)}}
+	return c.call(ctx, http.MethodPut, "/cache/"+url.PathEscape(key), query, bytes.NewReader(value), nil)
+}
+
+// SetWithPriority 保存 key 和 value，ttl 之后过期，ttl 为 0 表示永不过期
+// priority 是淘汰时的优先级，可以是 low、normal 或者 high，服务器超出限制时先淘汰优先级低的 key
+func (c *Client) SetWithPriority(ctx context.Context, key string, value []byte, ttl time.Duration, priority string) error {
+	query := url.Values{"ttl": {ttl.String()}, "priority": {priority}}
+	return c.call(ctx, http.MethodPut, "/cache/"+url.PathEscape(key), query, bytes.NewReader(value), nil)
+}
+
+// SetIfVersion 只在 key 的版本号是 version 时保存 key 和 value，返回新的版本号，key 被其他人修改过或者不存在时返回 false
+// version 一般来自 GetWithVersion，用于乐观并发控制
+func (c *Client) SetIfVersion(ctx context.Context, key string, value []byte, version uint64) (uint64, bool, error) {
+	request, err := c.newRequest(ctx, http.MethodPut, "/cache/"+url.PathEscape(key), nil, bytes.NewReader(value))
+	if err != nil {
+		return 0, false, err
+	}
+	request.Header.Set("If-Match", `"`+strconv.FormatUint(version, 10)+`"`)
+
+	response, err := c.send(request)
+	if err != nil {
+		return 0, false, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusPreconditionFailed {
+		return 0, false, nil
+	}
+
+	if err = checkStatus(response); err != nil {
+		return 0, false, err
+	}
+
+	newVersion, _ := strconv.ParseUint(response.Header.Get("X-Version"), 10, 64)
+	return newVersion, true, nil
+}
+
+// Delete 删除 key
+func (c *Client) Delete(ctx context.Context, key string) error {
+	return c.call(ctx, http.MethodDelete, "/cache/"+url.PathEscape(key), nil, nil, nil)
+}
+
+// DeleteIfVersion 只在 key 的版本号是 version 时删除 key，key 已经被重新写入、删除或者过期时返回 false
+func (c *Client) DeleteIfVersion(ctx context.Context, key string, version uint64) (bool, error) {
+	return c.deleteIf(ctx, key, url.Values{"if_version": {strconv.FormatUint(version, 10)}})
+}
+
+// DeleteIfValue 只在 key 的 value 是 value 时删除 key，key 已经被修改、删除或者过期时返回 false
+func (c *Client) DeleteIfValue(ctx context.Context, key string, value []byte) (bool, error) {
+	return c.deleteIf(ctx, key, url.Values{"if_value": {string(value)}})
+}
+
+// deleteIf 发送条件删除的请求，服务器返回 412 时返回 false
+func (c *Client) deleteIf(ctx context.Context, key string, query url.Values) (bool, error) {
+	response, err := c.do(ctx, http.MethodDelete, "/cache/"+url.PathEscape(key), query, nil)
+	if err != nil {
+		return false, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusPreconditionFailed {
+		return false, nil
+	}
+	if err = checkStatus(response); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Increment 原子地把 key 的 value 加上 delta，返回加上之后的值，key 不存在时从 0 开始加
+// value 不是整数或者结果溢出时返回的错误中是服务器给出的原因
+func (c *Client) Increment(ctx context.Context, key string, delta int64) (int64, error) {
+	return c.counter(ctx, key, "/incr", delta)
+}
+
+// Decrement 原子地把 key 的 value 减去 delta，返回减去之后的值，其他和 Increment 一样
+func (c *Client) Decrement(ctx context.Context, key string, delta int64) (int64, error) {
+	return c.counter(ctx, key, "/decr", delta)
+}
+
+// counter 调用 key 的自增或者自减接口
+func (c *Client) counter(ctx context.Context, key string, suffix string, delta int64) (int64, error) {
+	response, err := c.do(ctx, http.MethodPost, "/cache/"+url.PathEscape(key)+suffix, nil, strings.NewReader(strconv.FormatInt(delta, 10)))
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	// 这里的 409 不是锁被其他客户端持有，不能使用 checkStatus 返回的 ErrNotHeld
+	if response.StatusCode == http.StatusConflict {
+		message, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+		return 0, fmt.Errorf("client: %s", strings.TrimSpace(string(message)))
+	}
+
+	if err = checkStatus(response); err != nil {
+		return 0, err
+	}
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(string(body), 10, 64)
+}
+
+// ExpireMulti 批量修改 key 的存活时间，ttl 为 0 表示永不过期，返回修改了的 key 的个数，不存在的 key 会被忽略
+func (c *Client) ExpireMulti(ctx context.Context, ttls map[string]time.Duration) (int, error) {
+	body := make(map[string]string, len(ttls))
+	for key, ttl := range ttls {
+		body[key] = ttl.String()
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return 0, err
+	}
+
+	var result struct {
+		Updated int `json:"updated"`
+	}
+	err = c.call(ctx, http.MethodPost, "/expire", nil, bytes.NewReader(data), &result)
+	return result.Updated, err
+}
+
+// ExpireAtMulti 批量修改 key 的过期时间点，零值表示永不过期，已经过去的时间点会让 key 立即过期，返回修改了的 key 的个数
+func (c *Client) ExpireAtMulti(ctx context.Context, times map[string]time.Time) (int, error) {
+	body := make(map[string]string, len(times))
+	for key, at := range times {
+		body[key] = at.Format(time.RFC3339Nano)
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return 0, err
+	}
+
+	var result struct {
+		Updated int `json:"updated"`
+	}
+	err = c.call(ctx, http.MethodPost, "/expireat", nil, bytes.NewReader(data), &result)
+	return result.Updated, err
+}
+
+// Expire 修改 key 的存活时间，ttl 为 0 表示永不过期，value 和版本号都不变，key 不存在时返回 false
+func (c *Client) Expire(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	query := url.Values{"ttl": {ttl.String()}}
+	response, err := c.do(ctx, http.MethodPost, "/cache/"+url.PathEscape(key)+"/expire", query, nil)
+	if err != nil {
+		return false, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	return true, checkStatus(response)
+}
+
+// TTL 返回 key 剩余的存活时间，永不过期时返回 0，key 不存在时返回 false
+func (c *Client) TTL(ctx context.Context, key string) (time.Duration, bool, error) {
+	response, err := c.do(ctx, http.MethodGet, "/cache/"+url.PathEscape(key)+"/ttl", nil, nil)
+	if err != nil {
+		return 0, false, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotFound {
+		return 0, false, nil
+	}
+
+	if err = checkStatus(response); err != nil {
+		return 0, false, err
+	}
+
+	var result struct {
+		TTLMillis int64 `json:"ttl_ms"`
+	}
+	if err = decodeJSON(response, &result); err != nil {
+		return 0, false, err
+	}
+
+	if result.TTLMillis < 0 {
+		return 0, true, nil
+	}
+	return time.Duration(result.TTLMillis) * time.Millisecond, true, nil
+}
+
+// FlushAll 删除服务器上所有的 key，返回删除的 key 的个数，需要管理员的 API key，集群模式下只删除这个节点上的 key
+func (c *Client) FlushAll(ctx context.Context) (int64, error) {
+	var result struct {
+		Deleted int64 `json:"deleted"`
+	}
+	err := c.call(ctx, http.MethodDelete, "/cache", url.Values{"confirm": {"true"}}, nil, &result)
+	return result.Deleted, err
+}
+
+// ObjectInfo 是 key 的内部信息，用于调试
+type ObjectInfo struct {
+	// Type 是 value 的类型，Encoding 是 value 的编码，可能是 int、json、utf8 或者 binary
+	Type     string `json:"type"`
+	Encoding string `json:"encoding"`
+
+	// Size 是 key 和 value 占用的字节数
+	Size int `json:"size"`
+
+	// IdleSeconds 是距离最后一次读取或者写入的秒数，服务器启动之后还没有被访问过时为 -1
+	IdleSeconds int64 `json:"idle_seconds"`
+
+	// TTLMillis 是剩余的存活时间，单位是毫秒，永不过期时为 -1
+	TTLMillis int64 `json:"ttl_ms"`
+
+	// ExpireAtMillis 是过期的时间点，单位是 Unix 毫秒，永不过期时为 0
+	ExpireAtMillis int64 `json:"expire_at_ms"`
+
+	// Version 是 value 的版本号
+	Version uint64 `json:"version"`
+
+	// Priority 是淘汰时的优先级，可能是 low、normal 或者 high
+	Priority string `json:"priority"`
+}
+
+// Type 返回 key 的类型，key 不存在时返回 "none"
+func (c *Client) Type(ctx context.Context, key string) (string, error) {
+	var result struct {
+		Type string `json:"type"`
+	}
+
+	if err := c.call(ctx, http.MethodGet, "/type/"+url.PathEscape(key), nil, nil, &result); err != nil {
+		return "", err
+	}
+	return result.Type, nil
+}
+
+// Object 返回 key 的内部信息，查看内部信息不会影响 key 的空闲时间，key 不存在时返回 false
+func (c *Client) Object(ctx context.Context, key string) (*ObjectInfo, bool, error) {
+	response, err := c.do(ctx, http.MethodGet, "/object/"+url.PathEscape(key), nil, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotFound {
+		return nil, false, nil
+	}
+
+	if err = checkStatus(response); err != nil {
+		return nil, false, err
+	}
+
+	info := &ObjectInfo{}
+	if err = decodeJSON(response, info); err != nil {
+		return nil, false, err
+	}
+	return info, true, nil
+}
+
+// RandomKey 等概率地返回一个没有过期的 key，缓存为空时返回 false
+func (c *Client) RandomKey(ctx context.Context) (string, bool, error) {
+	keys, err := c.SampleKeys(ctx, 1)
+	if err != nil || len(keys) == 0 {
+		return "", false, err
+	}
+	return keys[0], true, nil
+}
+
+// SampleKeys 等概率地返回 n 个不重复的没有过期的 key，key 的个数不足 n 时返回所有的 key
+func (c *Client) SampleKeys(ctx context.Context, n int) ([]string, error) {
+	var result struct {
+		Keys []string `json:"keys"`
+	}
+
+	query := url.Values{"count": {strconv.Itoa(n)}}
+	if err := c.call(ctx, http.MethodGet, "/randomkey", query, nil, &result); err != nil {
+		return nil, err
+	}
+	return result.Keys, nil
+}
+
+// Scan 从 cursor 开始遍历匹配 pattern 的 key，返回这次找到的 key 和下一次遍历使用的 cursor，返回的 cursor 为 0 表示遍历结束
+// 第一次遍历时 cursor 为 0，pattern 为空时匹配所有的 key，count 是每次返回的 key 的个数的提示，不大于 0 时使用服务器的默认值
+func (c *Client) Scan(ctx context.Context, cursor uint64, pattern string, count int) ([]string, uint64, error) {
+	var result struct {
+		Keys   []string `json:"keys"`
+		Cursor uint64   `json:"cursor"`
+	}
+
+	query := url.Values{"cursor": {strconv.FormatUint(cursor, 10)}}
+	if pattern != "" {
+		query.Set("pattern", pattern)
+	}
+
+	if count > 0 {
+		query.Set("count", strconv.Itoa(count))
+	}
+
+	if err := c.call(ctx, http.MethodGet, "/cache", query, nil, &result); err != nil {
+		return nil, 0, err
+	}
+	return result.Keys, result.Cursor, nil
+}
+
+// Lock 尝试获取 key 上的锁，锁在 ttl 之后自动释放，成功时返回 fencing token，锁已经被持有时返回 false
+func (c *Client) Lock(ctx context.Context, key string, ttl time.Duration) (uint64, bool, error) {
+	var result struct {
+		Token string `json:"token"`
+	}
+
+	query := url.Values{"ttl": {ttl.String()}}
+	err := c.call(ctx, http.MethodPost, "/locks/"+url.PathEscape(key), query, nil, &result)
+	if errors.Is(err, ErrNotHeld) {
+		return 0, false, nil
+	}
+
+	if err != nil {
+		return 0, false, err
+	}
+
+	token, err := strconv.ParseUint(result.Token, 10, 64)
+	return token, err == nil, err
+}
+
+// Unlock 释放 key 上的锁，锁已经过期或者被其他客户端获取时返回 ErrNotHeld
+func (c *Client) Unlock(ctx context.Context, key string, token uint64) error {
+	query := url.Values{"token": {strconv.FormatUint(token, 10)}}
+	return c.call(ctx, http.MethodDelete, "/locks/"+url.PathEscape(key), query, nil, nil)
+}
+
+// call 发送请求并将 JSON 响应解码到 result 中，result 为 nil 表示不需要响应，服务器返回 409 时返回 ErrNotHeld
+func (c *Client) call(ctx context.Context, method string, path string, query url.Values, body io.Reader, result interface{}) error {
+	response, err := c.do(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if err = checkStatus(response); err != nil {
+		return err
+	}
+
+	if result == nil {
+		return nil
+	}
+	return decodeJSON(response, result)
+}
+
+// decodeJSON 将 JSON 响应解码到 result 中
+func decodeJSON(response *http.Response, result interface{}) error {
+	return json.NewDecoder(response.Body).Decode(result)
+}
+
+// do 向服务器发送请求，path 是以 / 开头的路径
+func (c *Client) do(ctx context.Context, method string, path string, query url.Values, body io.Reader) (*http.Response, error) {
+	request, err := c.newRequest(ctx, method, path, query, body)
+	if err != nil {
+		return nil, err
+	}
+	return c.send(request)
+}
+
+// newRequest 返回发送到服务器的请求，path 是以 / 开头的路径，需要额外的请求头时使用它和 send 代替 do
+func (c *Client) newRequest(ctx context.Context, method string, path string, query url.Values, body io.Reader) (*http.Request, error) {
+	address := strings.TrimSuffix(c.Server, "/") + path
+	if len(query) > 0 {
+		address += "?" + query.Encode()
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, address, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.APIKey != "" {
+		request.Header.Set("X-API-Key", c.APIKey)
+	}
+
+	if c.Username != "" {
+		request.SetBasicAuth(c.Username, c.Password)
+	}
+	return request, nil
+}
+
+// send 使用 HTTPClient 发送请求
+func (c *Client) send(request *http.Request) (*http.Response, error) {
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(request)
+}
+
+// checkStatus 在响应不是 2xx 时返回错误，409 返回 ErrNotHeld
+func checkStatus(response *http.Response) error {
+	if response.StatusCode/100 == 2 {
+		return nil
+	}
+
+	if response.StatusCode == http.StatusConflict {
+		return ErrNotHeld
+	}
+
+	message, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+	return fmt.Errorf("client: %s %s", response.Status, strings.TrimSpace(string(message)))
+}
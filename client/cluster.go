@@ -0,0 +1,71 @@
+package client
+
+import (
+	"context"
+	"gocache/cluster"
+	"net/http"
+	"sync"
+)
+
+// GetPeers 返回服务器所在集群的所有节点的地址和每个节点的虚拟节点个数，服务器没有开启集群模式时返回错误
+func (c *Client) GetPeers(ctx context.Context) ([]string, int, error) {
+	var result struct {
+		Nodes    []string `json:"nodes"`
+		Replicas int      `json:"replicas"`
+	}
+
+	if err := c.call(ctx, http.MethodGet, "/cluster/nodes", nil, nil, &result); err != nil {
+		return nil, 0, err
+	}
+	return result.Nodes, result.Replicas, nil
+}
+
+// ClusterClient 使用和服务器相同的一致性哈希，把每个 key 的请求直接发送到负责它的节点，省去节点之间的一次转发
+// 节点列表变化之后需要调用 Refresh，在那之前发送到旧节点的请求仍然会被服务器转发到新的节点
+type ClusterClient struct {
+	// seed 是获取节点列表的客户端，每个节点的客户端使用和它相同的 API key 和 HTTP 客户端
+	seed *Client
+
+	lock    sync.RWMutex
+	ring    *cluster.Ring
+	clients map[string]*Client
+}
+
+// NewClusterClient 通过 seed 获取集群的节点列表，返回直接访问负责 key 的节点的客户端
+func NewClusterClient(ctx context.Context, seed *Client) (*ClusterClient, error) {
+	cc := &ClusterClient{seed: seed}
+	if err := cc.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	return cc, nil
+}
+
+// Refresh 重新获取集群的节点列表
+func (cc *ClusterClient) Refresh(ctx context.Context) error {
+	nodes, replicas, err := cc.seed.GetPeers(ctx)
+	if err != nil {
+		return err
+	}
+
+	ring := cluster.NewRing(replicas)
+	ring.Add(nodes...)
+	clients := make(map[string]*Client, len(nodes))
+	for _, node := range nodes {
+		clients[node] = &Client{Server: node, APIKey: cc.seed.APIKey, Username: cc.seed.Username, Password: cc.seed.Password, HTTPClient: cc.seed.HTTPClient}
+	}
+
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+	cc.ring, cc.clients = ring, clients
+	return nil
+}
+
+// PickNode 返回访问负责 key 的节点的客户端，比如 cc.PickNode(key).Get(ctx, key)
+func (cc *ClusterClient) PickNode(key string) *Client {
+	cc.lock.RLock()
+	defer cc.lock.RUnlock()
+	if client, ok := cc.clients[cc.ring.Get(key)]; ok {
+		return client
+	}
+	return cc.seed
+}
@@ -0,0 +1,134 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Lease 是 key 上的租约
+type Lease struct {
+	// Key 是租约所在的 key
+	Key string `json:"key"`
+
+	// Holder 是持有者的标识
+	Holder string `json:"holder"`
+
+	// Token 是获取租约时发出的 fencing token，续约不会改变，重新获取时会变大，可以作为选主的任期
+	Token uint64 `json:"-"`
+
+	// TTL 是租约剩余的存活时间
+	TTL time.Duration `json:"-"`
+}
+
+// LeaseCallbacks 是 KeepLease 在租约状态变化时调用的函数，都可以为 nil
+type LeaseCallbacks struct {
+	// OnAcquired 在获取到租约时调用，比如成为 leader
+	OnAcquired func(lease Lease)
+
+	// OnLost 在租约过期或者被其他持有者获取时调用，调用之后不能再认为自己持有租约
+	OnLost func(lease Lease)
+}
+
+// AcquireLease 尝试为 holder 获取 key 上的租约，租约在 ttl 之后过期，已经持有时相当于续约
+// 被其他持有者持有时返回 ErrNotHeld 和当前的租约
+func (c *Client) AcquireLease(ctx context.Context, key string, holder string, ttl time.Duration) (Lease, error) {
+	return c.leaseCall(ctx, http.MethodPost, key, url.Values{"holder": {holder}, "ttl": {ttl.String()}})
+}
+
+// RenewLease 将 holder 持有的租约延长到 ttl 之后过期，租约已经过期或者被其他持有者获取时返回 ErrNotHeld
+func (c *Client) RenewLease(ctx context.Context, key string, holder string, ttl time.Duration) (Lease, error) {
+	return c.leaseCall(ctx, http.MethodPut, key, url.Values{"holder": {holder}, "ttl": {ttl.String()}})
+}
+
+// ReleaseLease 释放 holder 持有的租约，租约已经过期或者被其他持有者获取时返回 ErrNotHeld
+func (c *Client) ReleaseLease(ctx context.Context, key string, holder string) error {
+	return c.call(ctx, http.MethodDelete, "/leases/"+url.PathEscape(key), url.Values{"holder": {holder}}, nil, nil)
+}
+
+// KeepLease 不断尝试为 holder 获取 key 上的租约，获取到之后每隔 ttl/3 续约一次，直到 ctx 结束
+// 续约失败或者超过 ttl 没有续约成功时认为租约已经丢失，调用 OnLost 之后重新尝试获取，可以用于选主
+// ctx 结束时释放持有的租约并返回 ctx 的错误
+func (c *Client) KeepLease(ctx context.Context, key string, holder string, ttl time.Duration, callbacks LeaseCallbacks) error {
+	interval := ttl / 3
+	var held *Lease
+	var renewed time.Time
+	lost := func() {
+		if callbacks.OnLost != nil {
+			callbacks.OnLost(*held)
+		}
+		held = nil
+	}
+
+	for {
+		if held == nil {
+			lease, err := c.AcquireLease(ctx, key, holder, ttl)
+			if err == nil {
+				held, renewed = &lease, time.Now()
+				if callbacks.OnAcquired != nil {
+					callbacks.OnAcquired(lease)
+				}
+			}
+		} else {
+			_, err := c.RenewLease(ctx, key, holder, ttl)
+			switch {
+			case err == nil:
+				renewed = time.Now()
+			case errors.Is(err, ErrNotHeld):
+				lost()
+			case time.Since(renewed) >= ttl:
+				// 服务器一直没有响应，租约在服务器上已经过期了
+				lost()
+			}
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			if held != nil {
+				// ctx 已经结束了，使用新的 context 释放租约
+				release, cancel := context.WithTimeout(context.Background(), interval)
+				c.ReleaseLease(release, key, holder)
+				cancel()
+				lost()
+			}
+			return ctx.Err()
+		}
+	}
+}
+
+// leaseCall 发送获取或者续约的请求，并返回响应中的租约
+func (c *Client) leaseCall(ctx context.Context, method string, key string, query url.Values) (Lease, error) {
+	var result struct {
+		Lease
+		Token string `json:"token"`
+		TTL   int64  `json:"ttl_ms"`
+	}
+
+	response, err := c.do(ctx, method, "/leases/"+url.PathEscape(key), query, nil)
+	if err != nil {
+		return Lease{}, err
+	}
+	defer response.Body.Close()
+
+	statusErr := checkStatus(response)
+	if statusErr != nil && !errors.Is(statusErr, ErrNotHeld) {
+		return Lease{}, statusErr
+	}
+
+	if err = decodeJSON(response, &result); err != nil {
+		return Lease{}, err
+	}
+
+	lease := result.Lease
+	lease.TTL = time.Duration(result.TTL) * time.Millisecond
+	if result.Token != "" {
+		if lease.Token, err = strconv.ParseUint(result.Token, 10, 64); err != nil {
+			return Lease{}, err
+		}
+	}
+	return lease, statusErr
+}
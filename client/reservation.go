@@ -0,0 +1,86 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// reservationPollInterval 是 GetOrCompute 等待其他生产者完成预留时读取 key 的间隔
+const reservationPollInterval = 100 * time.Millisecond
+
+// Reserve 尝试预留还没有 value 的 key，预留在 ttl 之后过期，成功时返回 fencing token，之后使用 Complete 保存计算出的 value
+// key 已经被其他生产者预留或者已经有 value 时返回 false，这时可以等待一段时间之后读取 key
+func (c *Client) Reserve(ctx context.Context, key string, ttl time.Duration) (uint64, bool, error) {
+	var result struct {
+		Token string `json:"token"`
+	}
+
+	query := url.Values{"ttl": {ttl.String()}}
+	err := c.call(ctx, http.MethodPost, "/reservations/"+url.PathEscape(key), query, nil, &result)
+	if errors.Is(err, ErrNotHeld) {
+		return 0, false, nil
+	}
+
+	if err != nil {
+		return 0, false, err
+	}
+
+	token, err := strconv.ParseUint(result.Token, 10, 64)
+	return token, err == nil, err
+}
+
+// Complete 完成 token 对应的预留，保存 key 和 value，value 在 ttl 之后过期，ttl 为 0 表示永不过期
+// 预留已经过期、被取消或者被其他生产者重新预留时返回 ErrNotHeld，value 不会被保存
+func (c *Client) Complete(ctx context.Context, key string, token uint64, value []byte, ttl time.Duration) error {
+	query := url.Values{"token": {strconv.FormatUint(token, 10)}, "ttl": {ttl.String()}}
+	return c.call(ctx, http.MethodPut, "/reservations/"+url.PathEscape(key), query, bytes.NewReader(value), nil)
+}
+
+// CancelReservation 取消 token 对应的预留，比如计算失败时让其他生产者可以马上重新预留
+// 预留已经过期或者被其他生产者重新预留时返回 ErrNotHeld
+func (c *Client) CancelReservation(ctx context.Context, key string, token uint64) error {
+	query := url.Values{"token": {strconv.FormatUint(token, 10)}}
+	return c.call(ctx, http.MethodDelete, "/reservations/"+url.PathEscape(key), query, nil, nil)
+}
+
+// GetOrCompute 读取 key，不存在时预留 key 并调用 compute 计算 value，保存之后返回，value 在 ttl 之后过期
+// key 已经被其他生产者预留时等待它完成之后读取，预留过期或者被取消之后重新尝试预留，整个集群中同时只有一个生产者在计算
+// reserveTTL 是预留的存活时间，需要比 compute 的耗时长，compute 返回错误时取消预留并返回这个错误
+func (c *Client) GetOrCompute(ctx context.Context, key string, ttl time.Duration, reserveTTL time.Duration, compute func(ctx context.Context) ([]byte, error)) ([]byte, error) {
+	for {
+		value, ok, err := c.Get(ctx, key)
+		if err != nil || ok {
+			return value, err
+		}
+
+		token, reserved, err := c.Reserve(ctx, key, reserveTTL)
+		if err != nil {
+			return nil, err
+		}
+
+		if reserved {
+			value, err = compute(ctx)
+			if err != nil {
+				c.CancelReservation(ctx, key, token)
+				return nil, err
+			}
+
+			// 预留已经过期时其他生产者可能已经重新计算了，仍然返回这次计算出的 value
+			if err = c.Complete(ctx, key, token, value, ttl); err != nil && !errors.Is(err, ErrNotHeld) {
+				return nil, err
+			}
+			return value, nil
+		}
+
+		select {
+		case <-time.After(reservationPollInterval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
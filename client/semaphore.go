@@ -0,0 +1,70 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// AcquireSemaphore 尝试获取 key 上计数信号量的一个许可，最多同时发出 limit 个许可，许可在 ttl 之后自动释放
+// 成功时返回许可的 token，许可已经发完时返回 false
+func (c *Client) AcquireSemaphore(ctx context.Context, key string, limit int, ttl time.Duration) (uint64, bool, error) {
+	var result struct {
+		Token string `json:"token"`
+	}
+
+	query := url.Values{"limit": {strconv.Itoa(limit)}, "ttl": {ttl.String()}}
+	err := c.call(ctx, http.MethodPost, "/semaphores/"+url.PathEscape(key), query, nil, &result)
+	if errors.Is(err, ErrNotHeld) {
+		return 0, false, nil
+	}
+
+	if err != nil {
+		return 0, false, err
+	}
+
+	token, err := strconv.ParseUint(result.Token, 10, 64)
+	return token, err == nil, err
+}
+
+// ReleaseSemaphore 释放 key 上 token 对应的许可，许可已经过期时返回 ErrNotHeld
+func (c *Client) ReleaseSemaphore(ctx context.Context, key string, token uint64) error {
+	query := url.Values{"token": {strconv.FormatUint(token, 10)}}
+	return c.call(ctx, http.MethodDelete, "/semaphores/"+url.PathEscape(key), query, nil, nil)
+}
+
+// Allow 从 key 上的令牌桶中取出 n 个令牌，桶的容量是 burst，每秒补充 rate 个令牌
+// 令牌足够时返回 true，否则返回 false 和需要等待多久才有足够的令牌
+func (c *Client) Allow(ctx context.Context, key string, rate float64, burst int, n int) (bool, time.Duration, error) {
+	query := url.Values{
+		"rate":  {strconv.FormatFloat(rate, 'f', -1, 64)},
+		"burst": {strconv.Itoa(burst)},
+		"n":     {strconv.Itoa(n)},
+	}
+
+	response, err := c.do(ctx, http.MethodPost, "/ratelimits/"+url.PathEscape(key), query, nil)
+	if err != nil {
+		return false, 0, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusOK {
+		return true, 0, nil
+	}
+
+	if response.StatusCode != http.StatusTooManyRequests {
+		return false, 0, checkStatus(response)
+	}
+
+	var result struct {
+		RetryAfterMs int64 `json:"retry_after_ms"`
+	}
+
+	if err = decodeJSON(response, &result); err != nil {
+		return false, 0, err
+	}
+	return false, time.Duration(result.RetryAfterMs) * time.Millisecond, nil
+}
@@ -0,0 +1,117 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ErrNoSession 表示会话不存在或者已经过期
+var ErrNoSession = errors.New("client: session not found")
+
+// Session 是服务器上的一个用户会话
+type Session struct {
+	// ID 是会话 ID
+	ID string `json:"id"`
+
+	// User 是会话所属的用户
+	User string `json:"user"`
+
+	// Attributes 是会话的属性
+	Attributes map[string]string `json:"attributes"`
+
+	// TTL 是会话的存活时间，ExpiresIn 是剩余的存活时间
+	TTL       time.Duration `json:"-"`
+	ExpiresIn time.Duration `json:"-"`
+}
+
+// CreateSession 为 user 创建一个在 ttl 之后过期的会话，attributes 是会话的初始属性
+func (c *Client) CreateSession(ctx context.Context, user string, attributes map[string]string, ttl time.Duration) (Session, error) {
+	query := url.Values{"user": {user}, "ttl": {ttl.String()}}
+	return c.sessionCall(ctx, http.MethodPost, "/sessions", query, attributes)
+}
+
+// GetSession 返回 id 对应的会话并续约，会话不存在或者已经过期时返回 ErrNoSession
+func (c *Client) GetSession(ctx context.Context, id string) (Session, error) {
+	return c.sessionCall(ctx, http.MethodGet, "/sessions/"+url.PathEscape(id), nil, nil)
+}
+
+// RenewSession 将会话的过期时间延长到会话的 TTL 之后
+func (c *Client) RenewSession(ctx context.Context, id string) (Session, error) {
+	return c.sessionCall(ctx, http.MethodPut, "/sessions/"+url.PathEscape(id), nil, nil)
+}
+
+// SetSessionAttributes 修改会话的属性并续约，值为空字符串的属性会被删除
+func (c *Client) SetSessionAttributes(ctx context.Context, id string, attributes map[string]string) (Session, error) {
+	return c.sessionCall(ctx, http.MethodPatch, "/sessions/"+url.PathEscape(id), nil, attributes)
+}
+
+// DeleteSession 删除会话，会话不存在或者已经过期时返回 ErrNoSession
+func (c *Client) DeleteSession(ctx context.Context, id string) error {
+	response, err := c.do(ctx, http.MethodDelete, "/sessions/"+url.PathEscape(id), nil, nil)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotFound {
+		return ErrNoSession
+	}
+	return checkStatus(response)
+}
+
+// DeleteUserSessions 删除 user 的所有会话，返回删除的会话个数
+func (c *Client) DeleteUserSessions(ctx context.Context, user string) (int, error) {
+	var result struct {
+		Deleted int `json:"deleted"`
+	}
+
+	err := c.call(ctx, http.MethodDelete, "/users/"+url.PathEscape(user)+"/sessions", nil, nil, &result)
+	return result.Deleted, err
+}
+
+// sessionCall 发送会话请求并解析返回的会话，attributes 不为 nil 时作为请求体
+func (c *Client) sessionCall(ctx context.Context, method string, path string, query url.Values, attributes map[string]string) (Session, error) {
+	var body io.Reader
+	if attributes != nil {
+		data, err := json.Marshal(attributes)
+		if err != nil {
+			return Session{}, err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	response, err := c.do(ctx, method, path, query, body)
+	if err != nil {
+		return Session{}, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotFound {
+		return Session{}, ErrNoSession
+	}
+
+	if err = checkStatus(response); err != nil {
+		return Session{}, err
+	}
+
+	var result struct {
+		Session
+		TTLMs     int64 `json:"ttl_ms"`
+		ExpiresMs int64 `json:"expires_ms"`
+	}
+
+	if err = decodeJSON(response, &result); err != nil {
+		return Session{}, err
+	}
+
+	session := result.Session
+	session.TTL = time.Duration(result.TTLMs) * time.Millisecond
+	session.ExpiresIn = time.Duration(result.ExpiresMs) * time.Millisecond
+	return session, nil
+}
@@ -0,0 +1,97 @@
+// Package cluster 实现了集群模式，key 按照一致性哈希分布到多个节点上，每个 key 只保存在负责它的节点中
+// 所有节点需要使用相同的节点列表和虚拟节点个数，这样每个节点和客户端对 key 由谁负责的判断是一致的
+package cluster
+
+import (
+	"sort"
+	"sync"
+)
+
+// Cluster 是集群中所有节点的注册表，可以被多个协程同时使用
+// 节点列表只在本节点生效，增减节点时需要修改每个节点的节点列表
+type Cluster struct {
+	// self 是本节点的地址，比如 "http://10.0.0.1:8888"，和节点列表中的写法一致
+	self     string
+	replicas int
+
+	lock  sync.RWMutex
+	nodes []string
+	ring  *Ring
+}
+
+// New 返回本节点地址为 self 的集群，nodes 是所有节点的地址，不包括 self 时会自动加上
+// replicas 是每个节点在哈希环上的虚拟节点个数，不大于 0 时使用 50
+func New(self string, replicas int, nodes ...string) *Cluster {
+	if replicas <= 0 {
+		replicas = defaultReplicas
+	}
+
+	c := &Cluster{self: self, replicas: replicas}
+	c.SetNodes(nodes...)
+	return c
+}
+
+// Self 返回本节点的地址
+func (c *Cluster) Self() string {
+	return c.self
+}
+
+// Replicas 返回每个节点的虚拟节点个数
+func (c *Cluster) Replicas() int {
+	return c.replicas
+}
+
+// Nodes 返回所有节点的地址，按照字典序排列，包括本节点
+func (c *Cluster) Nodes() []string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return append([]string(nil), c.nodes...)
+}
+
+// SetNodes 替换所有节点的地址，不包括本节点时会自动加上，重复的地址只保留一个
+func (c *Cluster) SetNodes(nodes ...string) {
+	unique := map[string]struct{}{c.self: {}}
+	for _, node := range nodes {
+		if node != "" {
+			unique[node] = struct{}{}
+		}
+	}
+
+	list := make([]string, 0, len(unique))
+	for node := range unique {
+		list = append(list, node)
+	}
+	sort.Strings(list)
+
+	ring := NewRing(c.replicas)
+	ring.Add(list...)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.nodes, c.ring = list, ring
+}
+
+// AddNode 将 node 加入集群，已经在集群中时什么都不做
+func (c *Cluster) AddNode(node string) {
+	c.SetNodes(append(c.Nodes(), node)...)
+}
+
+// RemoveNode 将 node 移出集群，不能移除本节点，返回 node 是否在集群中
+func (c *Cluster) RemoveNode(node string) bool {
+	nodes := c.Nodes()
+	for i, n := range nodes {
+		if n == node && n != c.self {
+			c.SetNodes(append(nodes[:i], nodes[i+1:]...)...)
+			return true
+		}
+	}
+	return false
+}
+
+// PickNode 返回负责 key 的节点，local 表示是否由本节点负责
+func (c *Cluster) PickNode(key string) (node string, local bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	node = c.ring.Get(key)
+	return node, node == c.self
+}
@@ -0,0 +1,52 @@
+package cluster
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+)
+
+// defaultReplicas 是每个节点在哈希环上默认的虚拟节点个数
+const defaultReplicas = 50
+
+// Ring 是一致性哈希环，用于决定每个 key 由哪个节点负责，节点增减时只有少部分 key 会换节点
+// Ring 不是并发安全的，修改之后不能再修改，需要替换时创建新的 Ring
+type Ring struct {
+	replicas int
+	hashes   []uint32
+	nodes    map[uint32]string
+}
+
+// NewRing 返回每个节点有 replicas 个虚拟节点的哈希环，replicas 不大于 0 时使用 50
+func NewRing(replicas int) *Ring {
+	if replicas <= 0 {
+		replicas = defaultReplicas
+	}
+	return &Ring{replicas: replicas, nodes: make(map[uint32]string)}
+}
+
+// Add 将节点加到哈希环上
+func (r *Ring) Add(nodes ...string) {
+	for _, node := range nodes {
+		for i := 0; i < r.replicas; i++ {
+			hash := crc32.ChecksumIEEE([]byte(strconv.Itoa(i) + node))
+			r.hashes = append(r.hashes, hash)
+			r.nodes[hash] = node
+		}
+	}
+	sort.Slice(r.hashes, func(i, j int) bool { return r.hashes[i] < r.hashes[j] })
+}
+
+// Get 返回负责 key 的节点，哈希环上没有节点时返回空字符串
+func (r *Ring) Get(key string) string {
+	if len(r.hashes) == 0 {
+		return ""
+	}
+
+	hash := crc32.ChecksumIEEE([]byte(key))
+	index := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= hash })
+	if index == len(r.hashes) {
+		index = 0
+	}
+	return r.nodes[r.hashes[index]]
+}
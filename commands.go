@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// command 是一个子命令
+type command struct {
+	// run 执行子命令，参数是子命令之后的命令行参数
+	run func(args []string) error
+
+	// summary 是子命令的简短说明
+	summary string
+}
+
+// commands 记录了所有的子命令
+var commands = map[string]command{
+	"server":  {run: serverCommand, summary: "启动缓存服务器，没有指定子命令时默认执行"},
+	"cli":     {run: cliCommand, summary: "作为客户端读写服务器中的数据"},
+	"bench":   {run: benchCommand, summary: "对服务器进行压力测试"},
+	"backup":  {run: backupCommand, summary: "查看、创建和恢复服务器的备份"},
+	"export":  {run: exportCommand, summary: "将服务器中的所有数据以 NDJSON 格式导出"},
+	"import":  {run: importCommand, summary: "将 NDJSON 格式的数据导入到服务器中"},
+	"migrate": {run: migrateCommand, summary: "将一个服务器中的 key 连同存活时间复制到另一个服务器"},
+}
+
+func init() {
+	// help 需要遍历 commands，不能直接写在 commands 的初始化中
+	commands["help"] = command{run: helpCommand, summary: "显示所有子命令"}
+}
+
+// helpCommand 显示所有子命令的说明
+func helpCommand(args []string) error {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Printf("Usage: %s <command> [flags]\n\nCommands:\n", filepath.Base(os.Args[0]))
+	for _, name := range names {
+		fmt.Printf("  %-8s %s\n", name, commands[name].summary)
+	}
+	fmt.Printf("\n使用 %s <command> -h 查看子命令的参数\n", filepath.Base(os.Args[0]))
+	return nil
+}
+
+// client 是访问服务器的客户端，子命令都通过它访问服务器
+type client struct {
+	// server 是服务器的地址
+	server string
+
+	// apiKey 是访问服务器使用的 API key，为空表示不认证
+	apiKey string
+}
+
+// bindClientFlags 在 flags 中注册访问服务器需要的参数
+func bindClientFlags(flags *flag.FlagSet) *client {
+	c := &client{}
+	flags.StringVar(&c.server, "server", "http://127.0.0.1:8888", "服务器的地址")
+	flags.StringVar(&c.apiKey, "api-key", os.Getenv("GOCACHE_API_KEY"), "访问服务器使用的 API key，默认从 GOCACHE_API_KEY 环境变量中读取")
+	return c
+}
+
+// do 向服务器发送请求，path 是以 / 开头的路径
+func (c *client) do(method string, path string, contentType string, body io.Reader) (*http.Response, error) {
+	request, err := http.NewRequest(method, strings.TrimSuffix(c.server, "/")+path, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+
+	if c.apiKey != "" {
+		request.Header.Set("X-API-Key", c.apiKey)
+	}
+	return http.DefaultClient.Do(request)
+}
+
+// exportCommand 将服务器中的所有数据以 NDJSON 格式导出到文件或者标准输出
+func exportCommand(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	client := bindClientFlags(flags)
+	output := flags.String("o", "-", "导出的文件路径，- 表示标准输出")
+	flags.Parse(args)
+
+	response, err := client.do(http.MethodGet, "/admin/export", "", nil)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("export failed: %s", response.Status)
+	}
+
+	var writer io.Writer = os.Stdout
+	if *output != "-" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		writer = file
+	}
+
+	_, err = io.Copy(writer, response.Body)
+	return err
+}
+
+// importCommand 将文件或者标准输入中 NDJSON 格式的数据导入到服务器中
+func importCommand(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	client := bindClientFlags(flags)
+	input := flags.String("i", "-", "导入的文件路径，- 表示标准输入")
+	flags.Parse(args)
+
+	var reader io.Reader = os.Stdin
+	if *input != "-" {
+		file, err := os.Open(*input)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		reader = file
+	}
+
+	response, err := client.do(http.MethodPost, "/admin/import", "application/x-ndjson", reader)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	var result struct {
+		Imported int    `json:"imported"`
+		Error    string `json:"error"`
+	}
+
+	if err = json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return fmt.Errorf("import failed: %s", response.Status)
+	}
+
+	if result.Error != "" {
+		return fmt.Errorf("import failed after %d records: %s", result.Imported, result.Error)
+	}
+
+	fmt.Printf("imported %d records\n", result.Imported)
+	return nil
+}
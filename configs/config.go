@@ -0,0 +1,839 @@
+// Package configs 定义了服务器的配置，支持从 YAML 或者 TOML 格式的配置文件中读取
+package configs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"gocache/backups"
+	"gocache/caches"
+	"gocache/logs"
+	"gocache/servers"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// tenantNamePattern 是合法的租户名字
+var tenantNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Duration 是可以从 "10s"、"1m30s" 这样的字符串中解析的时间间隔
+type Duration time.Duration
+
+// UnmarshalText 解析时间间隔字符串
+func (d *Duration) UnmarshalText(text []byte) error {
+	value, err := time.ParseDuration(string(text))
+	if err != nil {
+		return fmt.Errorf("invalid duration %q, expected a value like \"10s\" or \"1m30s\"", text)
+	}
+	*d = Duration(value)
+	return nil
+}
+
+// MarshalText 返回时间间隔字符串
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// Config 是服务器的配置
+type Config struct {
+	Listen      ListenConfig      `yaml:"listen" toml:"listen"`
+	Timeouts    TimeoutsConfig    `yaml:"timeouts" toml:"timeouts"`
+	TLS         TLSConfig         `yaml:"tls" toml:"tls"`
+	Memory      MemoryConfig      `yaml:"memory" toml:"memory"`
+	Engine      EngineConfig      `yaml:"engine" toml:"engine"`
+	GC          GCConfig          `yaml:"gc" toml:"gc"`
+	Persistence PersistenceConfig `yaml:"persistence" toml:"persistence"`
+	Backup      BackupConfig      `yaml:"backup" toml:"backup"`
+	Logging     LoggingConfig     `yaml:"logging" toml:"logging"`
+	Auth        AuthConfig        `yaml:"auth" toml:"auth"`
+	Tenants     []TenantConfig    `yaml:"tenants" toml:"tenants"`
+	Namespaces  []NamespaceConfig `yaml:"namespaces" toml:"namespaces"`
+	Metrics     MetricsConfig     `yaml:"metrics" toml:"metrics"`
+	Process     ProcessConfig     `yaml:"process" toml:"process"`
+	Warmup      WarmupConfig      `yaml:"warmup" toml:"warmup"`
+	Upgrade     UpgradeConfig     `yaml:"upgrade" toml:"upgrade"`
+	Secrets     SecretsConfig     `yaml:"secrets" toml:"secrets"`
+	Backend     BackendConfig     `yaml:"backend" toml:"backend"`
+	Cluster     ClusterConfig     `yaml:"cluster" toml:"cluster"`
+	Replication ReplicationConfig `yaml:"replication" toml:"replication"`
+	Shadow      ShadowConfig      `yaml:"shadow" toml:"shadow"`
+}
+
+// ListenConfig 是监听地址的配置
+type ListenConfig struct {
+	// HTTP 是 HTTP 服务器监听的地址，为空表示不监听 TCP 地址
+	HTTP string `yaml:"http" toml:"http"`
+
+	// Unix 是 HTTP 服务器监听的 Unix socket 路径，为空表示不监听
+	Unix string `yaml:"unix" toml:"unix"`
+
+	// TCP 是二进制协议的 TCP 服务器监听的地址，为空表示不监听，端口不能和 HTTP 相同
+	TCP string `yaml:"tcp" toml:"tcp"`
+
+	// GRPC 是 gRPC 服务器监听的地址，为空表示不监听，端口不能和 HTTP 以及 TCP 相同
+	GRPC string `yaml:"grpc" toml:"grpc"`
+
+	// LegacyStatusCodes 为 true 时 HTTP 的写入和删除成功都返回 200 和空的响应体，兼容依赖旧行为的客户端
+	LegacyStatusCodes bool `yaml:"legacy_status_codes" toml:"legacy_status_codes"`
+}
+
+// TimeoutsConfig 是 HTTP 请求按照操作区分的超时时间，超时的请求返回 504，为 0 表示不限制
+// 操作的含义和 auth.policies 中的 actions 一样，事件流、复制和导出这样流式返回的请求不受限制
+type TimeoutsConfig struct {
+	Read   Duration `yaml:"read" toml:"read"`
+	Write  Duration `yaml:"write" toml:"write"`
+	Delete Duration `yaml:"delete" toml:"delete"`
+	Stats  Duration `yaml:"stats" toml:"stats"`
+	Admin  Duration `yaml:"admin" toml:"admin"`
+}
+
+// TLSConfig 是 TLS 的配置，证书和私钥都设置了才会启用 TLS
+type TLSConfig struct {
+	CertFile string `yaml:"cert_file" toml:"cert_file"`
+
+	// KeyFile 是私钥文件的路径，也可以是 "vault:secret/data/gocache#tls_key" 这样的密钥引用
+	KeyFile string `yaml:"key_file" toml:"key_file"`
+}
+
+// EngineConfig 是缓存存储引擎的配置
+type EngineConfig struct {
+	// LockFreeReads 表示读取是否使用原子替换的只读视图，完全不加锁，适合读远多于写的场景
+	// 写入最多延迟 PublishDelay 才能被读到
+	LockFreeReads bool `yaml:"lock_free_reads" toml:"lock_free_reads"`
+
+	// PublishDelay 是写入发布到只读视图的最长延迟
+	PublishDelay Duration `yaml:"publish_delay" toml:"publish_delay"`
+
+	// PublishBatch 是累计多少个写入后立即发布到只读视图
+	PublishBatch int `yaml:"publish_batch" toml:"publish_batch"`
+
+	// Shards 是只读视图的分片数，发布时只复制被修改过的分片，为 0 表示根据 CPU 个数自动选择
+	Shards int `yaml:"shards" toml:"shards"`
+
+	// AutoReshard 表示发布时复制的分片太大时是否在运行期间自动将分片数翻倍
+	AutoReshard bool `yaml:"auto_reshard" toml:"auto_reshard"`
+
+	// Segments 是数据的分片数，每个分片有自己的锁，不同分片上的读写可以并行，会向上取整到 2 的幂
+	Segments int `yaml:"segments" toml:"segments"`
+
+	// Clock 是计算过期时间使用的时钟，可选值为 system 和 monotonic
+	// monotonic 从启动时的系统时间开始按照单调时钟流逝，系统时间被调整时数据不会提前或者推迟过期
+	Clock string `yaml:"clock" toml:"clock"`
+
+	// Checksums 表示是否在保存 value 时计算校验和，开启之后可以通过 POST /admin/verify 找出并修复在内存中损坏的 value
+	Checksums bool `yaml:"checksums" toml:"checksums"`
+}
+
+// MemoryConfig 是内存监控和淘汰的配置
+type MemoryConfig struct {
+	// DumpThreshold 是写入堆内存分析文件和 key 占用报告的物理内存字节数，为 0 表示不监控
+	DumpThreshold uint64 `yaml:"dump_threshold" toml:"dump_threshold"`
+
+	// DumpDir 是保存堆内存分析文件和 key 占用报告的目录
+	DumpDir string `yaml:"dump_dir" toml:"dump_dir"`
+
+	// MaxEntries 是最多的键值对个数，超出时按照 Eviction 淘汰 key，为 0 表示不限制
+	MaxEntries int64 `yaml:"max_entries" toml:"max_entries"`
+
+	// MaxMemory 是 key 和 value 最多占用的总字节数，超出时按照 Eviction 淘汰 key，为 0 表示不限制
+	MaxMemory int64 `yaml:"max_memory" toml:"max_memory"`
+
+	// DefaultTTL 是写入时没有指定过期时间使用的过期时间，为 0 表示永不过期，命名空间中的写入使用命名空间的 default_ttl
+	DefaultTTL Duration `yaml:"default_ttl" toml:"default_ttl"`
+
+	// Eviction 是淘汰策略，可选值为 lru、lfu、fifo 和 noeviction，noeviction 表示超出限制时拒绝新的写入而不是淘汰 key
+	Eviction string `yaml:"eviction" toml:"eviction"`
+
+	// Admission 是缓存已满时是否接受新的 key 的准入策略，可选值为 tinylfu 和 probabilistic，为空表示接受所有写入
+	// 被拒绝的写入会被丢弃，不会淘汰已有的 key，适合大量只写一次的 key 涌入时保护经常访问的 key
+	Admission string `yaml:"admission" toml:"admission"`
+
+	// AdmissionProbability 是 probabilistic 接受新的 key 的概率
+	AdmissionProbability float64 `yaml:"admission_probability" toml:"admission_probability"`
+
+	// Compression 是大的 value 在内存中的压缩算法，可选值为 gzip、snappy 和 zstd，为空表示不压缩
+	Compression string `yaml:"compression" toml:"compression"`
+
+	// CompressionThreshold 是需要压缩的 value 的最小字节数，不超过它的 value 不压缩
+	CompressionThreshold int `yaml:"compression_threshold" toml:"compression_threshold"`
+
+	// ChunkSize 是分块保存大的 value 时每块的字节数，通过 HTTP 上传的超过它的 value 边读取边分块保存，为 0 表示不分块
+	ChunkSize int `yaml:"chunk_size" toml:"chunk_size"`
+
+	// LargeObjectThreshold 是大对象的分片大小，通过 HTTP 上传的超过它的 value 分成多个内部的 key 保存，为 0 表示不分片
+	LargeObjectThreshold int `yaml:"large_object_threshold" toml:"large_object_threshold"`
+}
+
+// GCConfig 是清理过期数据的配置
+type GCConfig struct {
+	// Interval 是清理过期数据的时间间隔，开启 Adaptive 时是初始的间隔
+	Interval Duration `yaml:"interval" toml:"interval"`
+
+	// Adaptive 表示是否根据过期数据的多少调整间隔，没有数据过期时放慢，大量数据过期时加快
+	Adaptive bool `yaml:"adaptive" toml:"adaptive"`
+
+	// MinInterval 和 MaxInterval 是开启 Adaptive 时间隔的范围
+	MinInterval Duration `yaml:"min_interval" toml:"min_interval"`
+	MaxInterval Duration `yaml:"max_interval" toml:"max_interval"`
+}
+
+// PersistenceConfig 是持久化的配置
+type PersistenceConfig struct {
+	// Dump 是持久化文件的路径，为空表示不进行持久化
+	Dump string `yaml:"dump" toml:"dump"`
+
+	// DumpDir 是增量持久化的目录，设置后会代替 Dump 进行增量持久化
+	DumpDir string `yaml:"dump_dir" toml:"dump_dir"`
+
+	// MaxIncrementals 是两次全量持久化之间最多进行的增量持久化次数
+	MaxIncrementals int `yaml:"max_incrementals" toml:"max_incrementals"`
+
+	// Save 是自动保存规则，格式和 Redis 的 save 配置一样
+	Save string `yaml:"save" toml:"save"`
+
+	// SaveInterval 不为 0 时，距离上次保存超过这个时间并且有修改就进行一次持久化，和 Save 同时生效
+	SaveInterval Duration `yaml:"save_interval" toml:"save_interval"`
+
+	// Codec 是持久化时使用的编码方式
+	Codec string `yaml:"codec" toml:"codec"`
+
+	// LoadTTL 是加载持久化文件时处理过期时间的方式，absolute 或者 relative
+	LoadTTL string `yaml:"load_ttl" toml:"load_ttl"`
+
+	// WriteRate 是持久化文件和 AOF 每秒最多写入磁盘的字节数，为 0 表示不限速
+	WriteRate int64 `yaml:"write_rate" toml:"write_rate"`
+
+	// AOF 是记录所有修改操作的 AOF 文件路径，为空表示不记录
+	AOF string `yaml:"aof" toml:"aof"`
+
+	// AOFSync 是 AOF 的 fsync 策略，always、everysec 或者 no
+	AOFSync string `yaml:"aof_sync" toml:"aof_sync"`
+
+	// AOFRewriteSize 是自动重写 AOF 的最小字节数，AOF 超过这个大小并且是上次重写之后的两倍时重写，为 0 表示不自动重写
+	AOFRewriteSize int64 `yaml:"aof_rewrite_size" toml:"aof_rewrite_size"`
+
+	// EncryptionKeyEnv 和 EncryptionKeyFile 是保存加密密钥的环境变量名和文件路径
+	EncryptionKeyEnv  string `yaml:"encryption_key_env" toml:"encryption_key_env"`
+	EncryptionKeyFile string `yaml:"encryption_key_file" toml:"encryption_key_file"`
+
+	// EncryptionKey 是加密密钥的引用，比如 "vault:secret/data/gocache#encryption_key"，和上面两个最多只能设置一个
+	EncryptionKey string `yaml:"encryption_key" toml:"encryption_key"`
+}
+
+// BackupConfig 是定时备份的配置
+type BackupConfig struct {
+	// Schedule 是定时备份的 cron 表达式，为空表示不进行定时备份
+	Schedule string `yaml:"schedule" toml:"schedule"`
+
+	// Dir 是保存备份的本地目录，设置了 S3.Bucket 时不使用
+	Dir string `yaml:"dir" toml:"dir"`
+
+	// S3 是保存备份的对象存储，访问密钥从 AWS_ACCESS_KEY_ID 和 AWS_SECRET_ACCESS_KEY 环境变量中读取
+	S3 S3Config `yaml:"s3" toml:"s3"`
+
+	// KeepDaily 和 KeepWeekly 是保留的每日备份和每周备份的个数
+	KeepDaily  int `yaml:"keep_daily" toml:"keep_daily"`
+	KeepWeekly int `yaml:"keep_weekly" toml:"keep_weekly"`
+}
+
+// S3Config 是保存备份的对象存储的配置
+type S3Config struct {
+	Endpoint string `yaml:"endpoint" toml:"endpoint"`
+	Region   string `yaml:"region" toml:"region"`
+	Bucket   string `yaml:"bucket" toml:"bucket"`
+	Prefix   string `yaml:"prefix" toml:"prefix"`
+}
+
+// LoggingConfig 是日志的配置
+type LoggingConfig struct {
+	// File 是服务器日志的路径，为空表示输出到标准错误
+	File string `yaml:"file" toml:"file"`
+
+	// Level 是服务器日志的级别，可选值为 debug、info、warn 和 error
+	Level string `yaml:"level" toml:"level"`
+
+	// MaxSize 是服务器日志文件的最大字节数，超过后会进行轮转，为 0 表示不轮转
+	MaxSize int64 `yaml:"max_size" toml:"max_size"`
+
+	// MaxBackups 是轮转时最多保留的旧日志文件个数
+	MaxBackups int `yaml:"max_backups" toml:"max_backups"`
+
+	// Audit 是审计日志的路径，为空表示不记录审计日志
+	Audit string `yaml:"audit" toml:"audit"`
+
+	// SlowLogThreshold 是慢请求的耗时阈值，为 0 表示不记录慢请求
+	SlowLogThreshold Duration `yaml:"slowlog_threshold" toml:"slowlog_threshold"`
+
+	// SlowLogSize 是最多保留的慢请求记录数
+	SlowLogSize int `yaml:"slowlog_size" toml:"slowlog_size"`
+}
+
+// AuthConfig 是认证的配置
+type AuthConfig struct {
+	// APIKeys 是允许访问的 API key，请求需要在 X-API-Key 请求头或者 Authorization: Bearer 中带上其中一个，为空表示不认证
+	// 可以写成 "env:NAME"、"file:/path" 和 "vault:path#field" 这样的引用，启动和重新加载配置时读取
+	APIKeys []string `yaml:"api_keys" toml:"api_keys"`
+
+	// ReadOnlyAPIKeys 是只读的 API key，只能读取缓存和查看统计数据，和 APIKeys 一样可以写成密钥引用
+	ReadOnlyAPIKeys []string `yaml:"read_only_api_keys" toml:"read_only_api_keys"`
+
+	// Users 是使用用户名和密码通过 HTTP Basic 认证访问的用户
+	Users []UserConfig `yaml:"users" toml:"users"`
+
+	// Subjects 是使用自己的 API key 访问的主体，只能执行 Policies 允许的操作
+	Subjects []SubjectConfig `yaml:"subjects" toml:"subjects"`
+
+	// Policies 是主体的授权策略，请求被任意一条策略允许时才会处理
+	Policies []PolicyConfig `yaml:"policies" toml:"policies"`
+}
+
+// UserConfig 是一个用户的配置
+type UserConfig struct {
+	// Name 是用户名，不能包含 :
+	Name string `yaml:"name" toml:"name"`
+
+	// Password 是密码，和 Auth.APIKeys 一样可以写成密钥引用
+	Password string `yaml:"password" toml:"password"`
+
+	// ReadOnly 为 true 时只能读取缓存和查看统计数据，否则不受限制
+	ReadOnly bool `yaml:"read_only" toml:"read_only"`
+}
+
+// SubjectConfig 是一个主体的配置
+type SubjectConfig struct {
+	// Name 是主体的名字，只能包含字母、数字、- 和 _
+	Name string `yaml:"name" toml:"name"`
+
+	// APIKeys 是主体使用的 API key，不能和其他的 API key 重复，和 Auth.APIKeys 一样可以写成密钥引用
+	APIKeys []string `yaml:"api_keys" toml:"api_keys"`
+}
+
+// PolicyConfig 是一条授权策略，允许 Subject 对匹配 Keys 的 key 执行 Actions 中的操作
+type PolicyConfig struct {
+	// Subject 是主体的名字，* 表示所有主体
+	Subject string `yaml:"subject" toml:"subject"`
+
+	// Actions 是允许的操作，可选值为 read、write、delete、stats、admin 和 *
+	Actions []string `yaml:"actions" toml:"actions"`
+
+	// Keys 是 key 的模式，* 匹配任意个字符，比如 "a:*"，为空表示所有的 key
+	Keys []string `yaml:"keys" toml:"keys"`
+}
+
+// TenantConfig 是一个租户的配置，租户使用自己的 API key 访问，只能读写自己命名空间中的 key
+type TenantConfig struct {
+	// Name 是租户的名字，只能包含字母、数字、- 和 _
+	Name string `yaml:"name" toml:"name"`
+
+	// APIKeys 是租户使用的 API key，不能和 Auth.APIKeys 以及其他租户的重复，和 Auth.APIKeys 一样可以写成密钥引用
+	APIKeys []string `yaml:"api_keys" toml:"api_keys"`
+
+	// MaxKeys 是最多的键值对个数，为 0 表示不限制
+	MaxKeys int64 `yaml:"max_keys" toml:"max_keys"`
+
+	// MaxMemory 是 key 和 value 最多占用的总字节数，为 0 表示不限制
+	MaxMemory int64 `yaml:"max_memory" toml:"max_memory"`
+
+	// MaxOps 是每秒最多的请求数，为 0 表示不限制
+	MaxOps int64 `yaml:"max_ops" toml:"max_ops"`
+
+	// MaxWriteBytes 是每个计费周期最多写入的字节数，通过 POST /admin/usage/reset 开始新的周期，为 0 表示不限制
+	MaxWriteBytes int64 `yaml:"max_write_bytes" toml:"max_write_bytes"`
+}
+
+// NamespaceConfig 是一个命名空间的配置，命名空间中的 key 通过 /cache/:namespace/:key 访问，可以单独清空和统计
+type NamespaceConfig struct {
+	// Name 是命名空间的名字，和租户的名字一样只能包含字母、数字、- 和 _，不能和租户重名
+	Name string `yaml:"name" toml:"name"`
+
+	// DefaultTTL 是写入时没有指定过期时间使用的过期时间，为 0 表示永不过期
+	DefaultTTL Duration `yaml:"default_ttl" toml:"default_ttl"`
+
+	// MaxKeys 是最多的键值对个数，为 0 表示不限制
+	MaxKeys int64 `yaml:"max_keys" toml:"max_keys"`
+
+	// MaxMemory 是 key 和 value 最多占用的总字节数，为 0 表示不限制
+	MaxMemory int64 `yaml:"max_memory" toml:"max_memory"`
+}
+
+// MetricsConfig 是统计数据的配置
+type MetricsConfig struct {
+	// PrefixGroups 是分组统计使用情况的 key 前缀，比如 "session:*"
+	PrefixGroups []string `yaml:"prefix_groups" toml:"prefix_groups"`
+
+	StatsD StatsDConfig `yaml:"statsd" toml:"statsd"`
+	OTLP   OTLPConfig   `yaml:"otlp" toml:"otlp"`
+}
+
+// StatsDConfig 是推送到 StatsD 的配置，Address 为空表示不推送
+type StatsDConfig struct {
+	Address  string   `yaml:"address" toml:"address"`
+	Prefix   string   `yaml:"prefix" toml:"prefix"`
+	Tags     []string `yaml:"tags" toml:"tags"`
+	Interval Duration `yaml:"interval" toml:"interval"`
+}
+
+// OTLPConfig 是推送到 OpenTelemetry Collector 的配置，Endpoint 为空表示不推送
+type OTLPConfig struct {
+	Endpoint string   `yaml:"endpoint" toml:"endpoint"`
+	Interval Duration `yaml:"interval" toml:"interval"`
+}
+
+// BackendConfig 是缓存没有命中时加载数据的后端，URL 为空表示不使用后端
+// 没有命中的 key 会通过 GET URL+key 加载，同一个 key 同时没有命中的请求只会访问一次后端
+type BackendConfig struct {
+	URL string `yaml:"url" toml:"url"`
+
+	// TTL 是从后端加载的数据的存活时间，为 0 表示永不过期
+	TTL Duration `yaml:"ttl" toml:"ttl"`
+
+	// Timeout 是访问后端的超时时间
+	Timeout Duration `yaml:"timeout" toml:"timeout"`
+
+	// StaleGrace 是数据过期之后继续保留的时间，这期间从后端加载失败时返回过期的数据，为 0 表示直接返回错误
+	StaleGrace Duration `yaml:"stale_grace" toml:"stale_grace"`
+}
+
+// ClusterConfig 是集群模式的配置，Self 为空表示不开启集群模式
+// key 按照一致性哈希分布到所有节点上，key 不由本节点负责的请求会被转发给负责的节点
+type ClusterConfig struct {
+	// Self 是本节点在集群中的地址，比如 "http://10.0.0.1:8888"，需要和其他节点的 Nodes 中的写法一致
+	Self string `yaml:"self" toml:"self"`
+
+	// Nodes 是集群中所有节点的地址，所有节点需要使用相同的列表
+	Nodes []string `yaml:"nodes" toml:"nodes"`
+
+	// Replicas 是每个节点在哈希环上的虚拟节点个数，所有节点需要使用相同的值
+	Replicas int `yaml:"replicas" toml:"replicas"`
+}
+
+// ReplicationConfig 是主从复制的配置，ReplicaOf 为空表示本节点是主节点
+type ReplicationConfig struct {
+	// ReplicaOf 是主节点的地址，比如 "http://10.0.0.1:8888"，设置后本节点作为只读的副本复制主节点的数据
+	// 访问主节点时使用 Auth.APIKeys 中的第一个 key
+	ReplicaOf string `yaml:"replica_of" toml:"replica_of"`
+}
+
+// ShadowConfig 是影子流量的配置，URL 为空表示不开启
+// 开启后按照 Percent 抽样，把读写缓存数据的请求异步复制到 URL 上的 gocache，用于验证新版本或者预热替换的集群
+type ShadowConfig struct {
+	// URL 是影子集群的地址，比如 "http://10.0.0.2:8888"，复制的请求带有原来的请求头，影子集群需要使用相同的认证配置
+	URL string `yaml:"url" toml:"url"`
+
+	// Percent 是复制的请求的百分比，取值范围是 0 到 100
+	Percent float64 `yaml:"percent" toml:"percent"`
+
+	// Timeout 是发送一个影子请求的超时时间
+	Timeout Duration `yaml:"timeout" toml:"timeout"`
+}
+
+// SecretsConfig 是密钥管理的配置，配置中的 API key、TLS 私钥和加密密钥可以引用其中的密钥
+type SecretsConfig struct {
+	Vault VaultConfig `yaml:"vault" toml:"vault"`
+}
+
+// VaultConfig 是 HashiCorp Vault 的配置，Address 为空表示不使用 Vault
+// 设置后可以使用 "vault:secret/data/gocache#field" 引用 KV 引擎中的密钥
+// 以及使用 "transit:key:vault:v1:..." 引用通过 transit 引擎加密的密钥
+type VaultConfig struct {
+	Address string `yaml:"address" toml:"address"`
+
+	// Token 是访问 Vault 使用的 token，一般写成 "env:VAULT_TOKEN" 或者 "file:/path" 这样的引用
+	Token string `yaml:"token" toml:"token"`
+}
+
+// ProcessConfig 是进程管理的配置，用于没有 systemd 这样的进程管理器的环境
+type ProcessConfig struct {
+	// Daemon 表示是否脱离终端在后台运行，需要设置 Logging.File
+	Daemon bool `yaml:"daemon" toml:"daemon"`
+
+	// PIDFile 是保存进程号的文件路径，为空表示不保存
+	PIDFile string `yaml:"pid_file" toml:"pid_file"`
+}
+
+// WarmupConfig 是启动预热的配置，预热包括恢复持久化文件、导入 RDB 文件和从 Source 导入数据，完成之前 /readyz 返回 503
+type WarmupConfig struct {
+	// Source 是恢复持久化文件之后再导入的 NDJSON 数据，可以是文件路径或者另一个节点导出接口的地址
+	// 比如 "http://10.0.0.1:8888/admin/export"，访问时使用 Auth.APIKeys 中的第一个 key，为空表示不导入
+	Source string `yaml:"source" toml:"source"`
+
+	// RefuseTraffic 表示预热完成之前读写缓存的请求是否返回 503
+	// 不拒绝时预热期间写入的数据可能会被恢复的数据覆盖
+	RefuseTraffic bool `yaml:"refuse_traffic" toml:"refuse_traffic"`
+}
+
+// UpgradeConfig 是不停机升级的配置，收到 SIGUSR2 时会启动新的进程并将监听交给它
+type UpgradeConfig struct {
+	// Snapshot 表示是否通过管道将缓存数据直接交给新的进程，否则新的进程从持久化文件中恢复数据
+	Snapshot bool `yaml:"snapshot" toml:"snapshot"`
+
+	// Timeout 是等待新的进程准备好的最长时间，超时后旧的进程继续提供服务
+	Timeout Duration `yaml:"timeout" toml:"timeout"`
+}
+
+// Default 返回默认的配置
+func Default() *Config {
+	return &Config{
+		Listen: ListenConfig{HTTP: ":8888"},
+		Memory: MemoryConfig{DumpDir: "memory-dumps", Eviction: "lru", AdmissionProbability: 0.1, CompressionThreshold: 1024},
+		Engine: EngineConfig{PublishDelay: Duration(time.Millisecond), PublishBatch: 1024, AutoReshard: true, Segments: 256, Clock: "system"},
+		GC:     GCConfig{Interval: Duration(time.Minute), MinInterval: Duration(time.Second), MaxInterval: Duration(10 * time.Minute)},
+		Persistence: PersistenceConfig{
+			Dump:            "gocache.dump",
+			MaxIncrementals: 10,
+			Save:            "900 1 300 10 60 10000",
+			Codec:           "gob",
+			LoadTTL:         "absolute",
+			AOFSync:         "everysec",
+			AOFRewriteSize:  64 << 20,
+		},
+		Backup: BackupConfig{
+			Dir:        "backups",
+			S3:         S3Config{Endpoint: "https://s3.amazonaws.com", Region: "us-east-1"},
+			KeepDaily:  7,
+			KeepWeekly: 4,
+		},
+		Logging: LoggingConfig{
+			Level:            "info",
+			MaxBackups:       5,
+			SlowLogThreshold: Duration(10 * time.Millisecond),
+			SlowLogSize:      128,
+		},
+		Metrics: MetricsConfig{
+			StatsD: StatsDConfig{Prefix: "gocache.", Interval: Duration(10 * time.Second)},
+			OTLP:   OTLPConfig{Interval: Duration(time.Minute)},
+		},
+		Upgrade: UpgradeConfig{Snapshot: true, Timeout: Duration(30 * time.Second)},
+		Secrets: SecretsConfig{Vault: VaultConfig{Token: "env:VAULT_TOKEN"}},
+		Backend: BackendConfig{TTL: Duration(5 * time.Minute), Timeout: Duration(10 * time.Second)},
+		Cluster: ClusterConfig{Replicas: 50},
+		Shadow:  ShadowConfig{Timeout: Duration(5 * time.Second)},
+	}
+}
+
+// Load 将 path 指定的配置文件读取到 config 中，文件中没有出现的配置保持不变
+// 根据扩展名选择格式，.yaml 和 .yml 是 YAML，.toml 是 TOML，出现未知的配置项时返回错误
+func Load(path string, config *Config) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err = decoder.Decode(config); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("config %s: %w", path, err)
+		}
+	case ".toml":
+		meta, err := toml.Decode(string(data), config)
+		if err != nil {
+			return fmt.Errorf("config %s: %w", path, err)
+		}
+
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			keys := make([]string, len(undecoded))
+			for i, key := range undecoded {
+				keys[i] = key.String()
+			}
+			return fmt.Errorf("config %s: unknown field %s", path, strings.Join(keys, ", "))
+		}
+	default:
+		return fmt.Errorf("config %s: unsupported format %q, use .yaml, .yml or .toml", path, filepath.Ext(path))
+	}
+	return nil
+}
+
+// ValidationError 是配置校验的错误，包含了所有不合法的配置项
+type ValidationError struct {
+	// Problems 是每个不合法的配置项的说明，key 是配置项的路径
+	Problems map[string]string
+}
+
+func (ve *ValidationError) Error() string {
+	fields := make([]string, 0, len(ve.Problems))
+	for field := range ve.Problems {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	lines := make([]string, len(fields))
+	for i, field := range fields {
+		lines[i] = "  " + field + ": " + ve.Problems[field]
+	}
+	return "invalid config:\n" + strings.Join(lines, "\n")
+}
+
+// Validate 校验配置，有不合法的配置项时返回 ValidationError
+func (c *Config) Validate() error {
+	problems := make(map[string]string)
+	check := func(ok bool, field string, format string, args ...interface{}) {
+		if !ok {
+			problems[field] = fmt.Sprintf(format, args...)
+		}
+	}
+
+	check(c.Listen.HTTP != "" || c.Listen.Unix != "", "listen", "at least one of http and unix must be set")
+	check(c.Listen.TCP == "" || c.Listen.TCP != c.Listen.HTTP, "listen.tcp", "must be different from listen.http")
+	// TCP 服务器只支持 auth.api_keys 认证，否则租户、主体和只读凭据以外的连接都会被当作管理员
+	restricted := len(c.Tenants) > 0 || len(c.Auth.Subjects) > 0 || len(c.Auth.ReadOnlyAPIKeys) > 0 || len(c.Auth.Users) > 0
+	check(c.Listen.TCP == "" || len(c.Auth.APIKeys) > 0 || !restricted, "listen.tcp",
+		"requires auth.api_keys when tenants, subjects, read_only_api_keys or users are configured")
+	check(c.Listen.GRPC == "" || c.Listen.GRPC != c.Listen.HTTP && c.Listen.GRPC != c.Listen.TCP, "listen.grpc", "must be different from listen.http and listen.tcp")
+	// gRPC 服务器和 TCP 服务器一样只支持 auth.api_keys 认证
+	check(c.Listen.GRPC == "" || len(c.Auth.APIKeys) > 0 || !restricted, "listen.grpc",
+		"requires auth.api_keys when tenants, subjects, read_only_api_keys or users are configured")
+	check((c.TLS.CertFile == "") == (c.TLS.KeyFile == ""), "tls", "cert_file and key_file must be set together")
+	check(c.GC.Interval > 0, "gc.interval", "must be positive, got %s", time.Duration(c.GC.Interval))
+	if c.GC.Adaptive {
+		check(c.GC.MinInterval > 0, "gc.min_interval", "must be positive, got %s", time.Duration(c.GC.MinInterval))
+		check(c.GC.MinInterval <= c.GC.Interval && c.GC.Interval <= c.GC.MaxInterval, "gc.interval",
+			"must be between min_interval %s and max_interval %s, got %s", time.Duration(c.GC.MinInterval), time.Duration(c.GC.MaxInterval), time.Duration(c.GC.Interval))
+	}
+	check(c.Engine.PublishDelay > 0, "engine.publish_delay", "must be positive, got %s", time.Duration(c.Engine.PublishDelay))
+	check(c.Engine.PublishBatch > 0, "engine.publish_batch", "must be positive, got %d", c.Engine.PublishBatch)
+	check(c.Engine.Shards >= 0 && c.Engine.Shards <= 65536, "engine.shards", "must be between 0 and 65536, got %d", c.Engine.Shards)
+	check(c.Engine.Segments > 0 && c.Engine.Segments <= 65536, "engine.segments", "must be between 1 and 65536, got %d", c.Engine.Segments)
+	check(containsString([]string{"system", "monotonic"}, c.Engine.Clock), "engine.clock", "must be one of system and monotonic, got %q", c.Engine.Clock)
+	check(c.Memory.MaxEntries >= 0, "memory.max_entries", "must not be negative, got %d", c.Memory.MaxEntries)
+	check(c.Memory.MaxMemory >= 0, "memory.max_memory", "must not be negative, got %d", c.Memory.MaxMemory)
+	check(c.Memory.DefaultTTL >= 0, "memory.default_ttl", "must not be negative, got %s", time.Duration(c.Memory.DefaultTTL))
+	check(containsString([]string{"lru", "lfu", "fifo", "noeviction"}, c.Memory.Eviction), "memory.eviction", "must be one of lru, lfu, fifo and noeviction, got %q", c.Memory.Eviction)
+	check(containsString([]string{"", "tinylfu", "probabilistic"}, c.Memory.Admission), "memory.admission", "must be empty or one of tinylfu and probabilistic, got %q", c.Memory.Admission)
+	check(containsString([]string{"", "gzip", "snappy", "zstd"}, c.Memory.Compression), "memory.compression", "must be empty or one of gzip, snappy and zstd, got %q", c.Memory.Compression)
+	check(c.Memory.CompressionThreshold >= 0, "memory.compression_threshold", "must not be negative, got %d", c.Memory.CompressionThreshold)
+	check(c.Memory.ChunkSize >= 0, "memory.chunk_size", "must not be negative, got %d", c.Memory.ChunkSize)
+	check(c.Memory.LargeObjectThreshold >= 0, "memory.large_object_threshold", "must not be negative, got %d", c.Memory.LargeObjectThreshold)
+	check(c.Memory.AdmissionProbability > 0 && c.Memory.AdmissionProbability <= 1, "memory.admission_probability", "must be in (0, 1], got %v", c.Memory.AdmissionProbability)
+	check(c.Timeouts.Read >= 0, "timeouts.read", "must not be negative, got %s", time.Duration(c.Timeouts.Read))
+	check(c.Timeouts.Write >= 0, "timeouts.write", "must not be negative, got %s", time.Duration(c.Timeouts.Write))
+	check(c.Timeouts.Delete >= 0, "timeouts.delete", "must not be negative, got %s", time.Duration(c.Timeouts.Delete))
+	check(c.Timeouts.Stats >= 0, "timeouts.stats", "must not be negative, got %s", time.Duration(c.Timeouts.Stats))
+	check(c.Timeouts.Admin >= 0, "timeouts.admin", "must not be negative, got %s", time.Duration(c.Timeouts.Admin))
+	check(c.Backend.TTL >= 0, "backend.ttl", "must not be negative, got %s", time.Duration(c.Backend.TTL))
+	check(c.Backend.Timeout > 0, "backend.timeout", "must be positive, got %s", time.Duration(c.Backend.Timeout))
+	check(c.Backend.StaleGrace >= 0, "backend.stale_grace", "must not be negative, got %s", time.Duration(c.Backend.StaleGrace))
+	check(c.Cluster.Replicas > 0, "cluster.replicas", "must be positive, got %d", c.Cluster.Replicas)
+	for i, node := range append([]string{c.Cluster.Self}, c.Cluster.Nodes...) {
+		field := "cluster.self"
+		if i > 0 {
+			field = fmt.Sprintf("cluster.nodes[%d]", i-1)
+		}
+		check(node == "" && i == 0 || strings.HasPrefix(node, "http://") || strings.HasPrefix(node, "https://"), field, "must start with http:// or https://, got %q", node)
+	}
+	check(c.Replication.ReplicaOf == "" || strings.HasPrefix(c.Replication.ReplicaOf, "http://") || strings.HasPrefix(c.Replication.ReplicaOf, "https://"),
+		"replication.replica_of", "must start with http:// or https://, got %q", c.Replication.ReplicaOf)
+	check(c.Shadow.URL == "" || strings.HasPrefix(c.Shadow.URL, "http://") || strings.HasPrefix(c.Shadow.URL, "https://"),
+		"shadow.url", "must start with http:// or https://, got %q", c.Shadow.URL)
+	check(c.Shadow.Percent >= 0 && c.Shadow.Percent <= 100, "shadow.percent", "must be between 0 and 100, got %g", c.Shadow.Percent)
+	check(c.Shadow.Timeout > 0, "shadow.timeout", "must be positive, got %s", time.Duration(c.Shadow.Timeout))
+	check(c.Persistence.MaxIncrementals >= 0, "persistence.max_incrementals", "must not be negative, got %d", c.Persistence.MaxIncrementals)
+	check(c.Persistence.SaveInterval >= 0, "persistence.save_interval", "must not be negative, got %s", time.Duration(c.Persistence.SaveInterval))
+	check(c.Persistence.WriteRate >= 0, "persistence.write_rate", "must not be negative, got %d", c.Persistence.WriteRate)
+	check(containsString([]string{"always", "everysec", "no"}, c.Persistence.AOFSync), "persistence.aof_sync", "must be one of always, everysec and no, got %q", c.Persistence.AOFSync)
+	check(c.Persistence.AOFRewriteSize >= 0, "persistence.aof_rewrite_size", "must not be negative, got %d", c.Persistence.AOFRewriteSize)
+	encryptionKeys := 0
+	for _, key := range []string{c.Persistence.EncryptionKeyEnv, c.Persistence.EncryptionKeyFile, c.Persistence.EncryptionKey} {
+		if key != "" {
+			encryptionKeys++
+		}
+	}
+	check(encryptionKeys <= 1, "persistence", "only one of encryption_key_env, encryption_key_file and encryption_key can be set")
+
+	if _, err := caches.ParseSaveRules(c.Persistence.Save); err != nil {
+		check(false, "persistence.save", "expected pairs of seconds and changes like \"900 1 300 10\", got %q", c.Persistence.Save)
+	}
+
+	if _, err := caches.CodecByName(c.Persistence.Codec); err != nil {
+		check(false, "persistence.codec", "unknown codec %q, available: %s", c.Persistence.Codec, strings.Join(caches.CodecNames(), ", "))
+	}
+
+	if _, err := caches.ParseLoadTTLMode(c.Persistence.LoadTTL); err != nil {
+		check(false, "persistence.load_ttl", "must be absolute or relative, got %q", c.Persistence.LoadTTL)
+	}
+
+	if c.Backup.Schedule != "" {
+		if _, err := backups.ParseSchedule(c.Backup.Schedule); err != nil {
+			check(false, "backup.schedule", "%v", err)
+		}
+	}
+	check(c.Backup.KeepDaily >= 0, "backup.keep_daily", "must not be negative, got %d", c.Backup.KeepDaily)
+	check(c.Backup.KeepWeekly >= 0, "backup.keep_weekly", "must not be negative, got %d", c.Backup.KeepWeekly)
+	check(c.Backup.S3.Bucket == "" || c.Backup.S3.Endpoint != "", "backup.s3.endpoint", "must be set when backup.s3.bucket is set")
+
+	if _, err := logs.ParseLevel(c.Logging.Level); err != nil {
+		check(false, "logging.level", "must be one of debug, info, warn and error, got %q", c.Logging.Level)
+	}
+	check(c.Logging.MaxSize >= 0, "logging.max_size", "must not be negative, got %d", c.Logging.MaxSize)
+	check(c.Logging.MaxBackups >= 0, "logging.max_backups", "must not be negative, got %d", c.Logging.MaxBackups)
+	check(c.Logging.SlowLogThreshold >= 0, "logging.slowlog_threshold", "must not be negative, got %s", time.Duration(c.Logging.SlowLogThreshold))
+	check(c.Logging.SlowLogSize > 0, "logging.slowlog_size", "must be positive, got %d", c.Logging.SlowLogSize)
+
+	for i, key := range c.Auth.APIKeys {
+		check(key != "", fmt.Sprintf("auth.api_keys[%d]", i), "must not be empty")
+	}
+
+	usedKeys := make(map[string]string)
+	for _, key := range c.Auth.APIKeys {
+		usedKeys[key] = "auth.api_keys"
+	}
+
+	for i, key := range c.Auth.ReadOnlyAPIKeys {
+		field := fmt.Sprintf("auth.read_only_api_keys[%d]", i)
+		check(key != "", field, "must not be empty")
+		if owner, ok := usedKeys[key]; ok && key != "" {
+			check(false, field, "already used by %s", owner)
+		}
+		usedKeys[key] = "auth.read_only_api_keys"
+	}
+
+	userNames := make(map[string]bool)
+	for i, user := range c.Auth.Users {
+		field := fmt.Sprintf("auth.users[%d]", i)
+		check(user.Name != "" && !strings.Contains(user.Name, ":"), field+".name", "must not be empty or contain ':', got %q", user.Name)
+		check(!userNames[user.Name], field+".name", "duplicate user %q", user.Name)
+		userNames[user.Name] = true
+		check(user.Password != "", field+".password", "must not be empty")
+	}
+
+	subjectNames := make(map[string]bool)
+	for i, subject := range c.Auth.Subjects {
+		field := fmt.Sprintf("auth.subjects[%d]", i)
+		check(tenantNamePattern.MatchString(subject.Name), field+".name", "must only contain letters, digits, - and _, got %q", subject.Name)
+		check(!subjectNames[subject.Name], field+".name", "duplicate subject %q", subject.Name)
+		subjectNames[subject.Name] = true
+
+		check(len(subject.APIKeys) > 0, field+".api_keys", "must not be empty")
+		for j, key := range subject.APIKeys {
+			check(key != "", fmt.Sprintf("%s.api_keys[%d]", field, j), "must not be empty")
+			if owner, ok := usedKeys[key]; ok && key != "" {
+				check(false, fmt.Sprintf("%s.api_keys[%d]", field, j), "already used by %s", owner)
+			}
+			usedKeys[key] = field
+		}
+	}
+
+	for i, policy := range c.Auth.Policies {
+		field := fmt.Sprintf("auth.policies[%d]", i)
+		check(policy.Subject == servers.ActionAll || subjectNames[policy.Subject], field+".subject", "unknown subject %q", policy.Subject)
+		check(len(policy.Actions) > 0, field+".actions", "must not be empty")
+		for j, action := range policy.Actions {
+			check(containsString(servers.Actions, action), fmt.Sprintf("%s.actions[%d]", field, j), "must be one of %s, got %q", strings.Join(servers.Actions, ", "), action)
+		}
+
+		for j, key := range policy.Keys {
+			check(key != "", fmt.Sprintf("%s.keys[%d]", field, j), "must not be empty")
+		}
+	}
+
+	tenantNames := make(map[string]bool)
+	for i, tenant := range c.Tenants {
+		field := fmt.Sprintf("tenants[%d]", i)
+		check(tenantNamePattern.MatchString(tenant.Name), field+".name", "must only contain letters, digits, - and _, got %q", tenant.Name)
+		check(!tenantNames[tenant.Name], field+".name", "duplicate tenant %q", tenant.Name)
+		tenantNames[tenant.Name] = true
+
+		check(len(tenant.APIKeys) > 0, field+".api_keys", "must not be empty")
+		for j, key := range tenant.APIKeys {
+			check(key != "", fmt.Sprintf("%s.api_keys[%d]", field, j), "must not be empty")
+			if owner, ok := usedKeys[key]; ok && key != "" {
+				check(false, fmt.Sprintf("%s.api_keys[%d]", field, j), "already used by %s", owner)
+			}
+			usedKeys[key] = field
+		}
+
+		check(tenant.MaxKeys >= 0, field+".max_keys", "must not be negative, got %d", tenant.MaxKeys)
+		check(tenant.MaxMemory >= 0, field+".max_memory", "must not be negative, got %d", tenant.MaxMemory)
+		check(tenant.MaxOps >= 0, field+".max_ops", "must not be negative, got %d", tenant.MaxOps)
+		check(tenant.MaxWriteBytes >= 0, field+".max_write_bytes", "must not be negative, got %d", tenant.MaxWriteBytes)
+	}
+
+	// 命名空间和租户使用同样的 key 前缀，不能重名
+	namespaceNames := make(map[string]bool)
+	for i, namespace := range c.Namespaces {
+		field := fmt.Sprintf("namespaces[%d]", i)
+		check(tenantNamePattern.MatchString(namespace.Name), field+".name", "must only contain letters, digits, - and _, got %q", namespace.Name)
+		check(!namespaceNames[namespace.Name], field+".name", "duplicate namespace %q", namespace.Name)
+		check(!tenantNames[namespace.Name], field+".name", "already used by tenant %q", namespace.Name)
+		namespaceNames[namespace.Name] = true
+
+		check(namespace.DefaultTTL >= 0, field+".default_ttl", "must not be negative, got %s", time.Duration(namespace.DefaultTTL))
+		check(namespace.MaxKeys >= 0, field+".max_keys", "must not be negative, got %d", namespace.MaxKeys)
+		check(namespace.MaxMemory >= 0, field+".max_memory", "must not be negative, got %d", namespace.MaxMemory)
+	}
+
+	check(c.Metrics.StatsD.Interval > 0, "metrics.statsd.interval", "must be positive, got %s", time.Duration(c.Metrics.StatsD.Interval))
+	check(c.Metrics.OTLP.Interval > 0, "metrics.otlp.interval", "must be positive, got %s", time.Duration(c.Metrics.OTLP.Interval))
+	if c.Metrics.OTLP.Endpoint != "" {
+		check(strings.HasPrefix(c.Metrics.OTLP.Endpoint, "http://") || strings.HasPrefix(c.Metrics.OTLP.Endpoint, "https://"),
+			"metrics.otlp.endpoint", "must start with http:// or https://, got %q", c.Metrics.OTLP.Endpoint)
+	}
+
+	check(!c.Process.Daemon || c.Logging.File != "", "process.daemon", "requires logging.file")
+	check(c.Upgrade.Timeout > 0, "upgrade.timeout", "must be positive, got %s", time.Duration(c.Upgrade.Timeout))
+	if c.Secrets.Vault.Address != "" {
+		check(strings.HasPrefix(c.Secrets.Vault.Address, "http://") || strings.HasPrefix(c.Secrets.Vault.Address, "https://"),
+			"secrets.vault.address", "must start with http:// or https://, got %q", c.Secrets.Vault.Address)
+		check(c.Secrets.Vault.Token != "", "secrets.vault.token", "must not be empty")
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// RestartRequired 返回从 old 修改为 c 时需要重启才能生效的配置项
+// 可以在运行期间重新加载的配置有 TLS 证书、请求超时、GC 间隔、持久化写入速度、服务器日志、慢请求日志和 API key
+func (c *Config) RestartRequired(old *Config) []string {
+	changed := make([]string, 0)
+	check := func(same bool, field string) {
+		if !same {
+			changed = append(changed, field)
+		}
+	}
+
+	oldPersistence, newPersistence := old.Persistence, c.Persistence
+	oldPersistence.WriteRate, newPersistence.WriteRate = 0, 0
+
+	check(c.Listen == old.Listen, "listen")
+	check((c.TLS.CertFile == "") == (old.TLS.CertFile == ""), "tls")
+	check(c.Memory == old.Memory, "memory")
+	check(c.Engine == old.Engine, "engine")
+	check(newPersistence == oldPersistence, "persistence")
+	check(reflect.DeepEqual(c.Backup, old.Backup), "backup")
+	check(c.Logging.Audit == old.Logging.Audit, "logging.audit")
+	check((c.Logging.SlowLogThreshold > 0) == (old.Logging.SlowLogThreshold > 0), "logging.slowlog_threshold")
+	check(reflect.DeepEqual(c.Metrics, old.Metrics), "metrics")
+	check(reflect.DeepEqual(c.Tenants, old.Tenants), "tenants")
+	check(reflect.DeepEqual(c.Namespaces, old.Namespaces), "namespaces")
+	check(c.Process == old.Process, "process")
+	check(c.Warmup == old.Warmup, "warmup")
+	check(c.Upgrade == old.Upgrade, "upgrade")
+	check(c.Secrets == old.Secrets, "secrets")
+	check(c.Backend == old.Backend, "backend")
+	check(reflect.DeepEqual(c.Cluster, old.Cluster), "cluster")
+	check(c.Replication == old.Replication, "replication")
+	check(c.Shadow == old.Shadow, "shadow")
+	return changed
+}
+
+// containsString 返回 values 中是否包含 value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,229 @@
+package configs
+
+import (
+	"flag"
+	"fmt"
+	"gocache/caches"
+	"os"
+	"strings"
+	"time"
+)
+
+// listValue 是使用逗号分隔的字符串列表参数
+type listValue []string
+
+func (lv *listValue) String() string {
+	return strings.Join(*lv, ",")
+}
+
+func (lv *listValue) Set(s string) error {
+	*lv = nil
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*lv = append(*lv, item)
+		}
+	}
+	return nil
+}
+
+// EnvPrefix 是覆盖命令行参数的环境变量名的前缀
+const EnvPrefix = "GOCACHE_"
+
+// EnvName 返回覆盖命令行参数 name 的环境变量名，比如 gc-interval 对应 GOCACHE_GC_INTERVAL
+func EnvName(name string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// BindFlags 在 fs 中注册命令行参数，参数的值会直接写入 c，参数的默认值是 c 中当前的值
+// 还会注册指定配置文件路径的 config 参数
+func BindFlags(fs *flag.FlagSet, c *Config) {
+	fs.String("config", "", "配置文件的路径，支持 YAML 和 TOML 格式，命令行参数和环境变量会覆盖配置文件中的配置")
+	fs.StringVar(&c.Listen.HTTP, "address", c.Listen.HTTP, "服务器监听的地址，为空表示不监听 TCP 地址")
+	fs.StringVar(&c.Listen.Unix, "unix-socket", c.Listen.Unix, "服务器监听的 Unix socket 路径，为空表示不监听")
+	fs.StringVar(&c.Listen.TCP, "tcp-address", c.Listen.TCP, "二进制协议的 TCP 服务器监听的地址，为空表示不监听")
+	fs.StringVar(&c.Listen.GRPC, "grpc-address", c.Listen.GRPC, "gRPC 服务器监听的地址，为空表示不监听")
+	fs.BoolVar(&c.Listen.LegacyStatusCodes, "legacy-status-codes", c.Listen.LegacyStatusCodes, "HTTP 的写入和删除成功时是否像旧版本一样返回 200 和空的响应体")
+	fs.DurationVar((*time.Duration)(&c.Timeouts.Read), "timeout-read", time.Duration(c.Timeouts.Read), "读取请求的超时时间，超时返回 504，为 0 表示不限制")
+	fs.DurationVar((*time.Duration)(&c.Timeouts.Write), "timeout-write", time.Duration(c.Timeouts.Write), "写入请求的超时时间，超时返回 504，为 0 表示不限制")
+	fs.DurationVar((*time.Duration)(&c.Timeouts.Delete), "timeout-delete", time.Duration(c.Timeouts.Delete), "删除请求的超时时间，超时返回 504，为 0 表示不限制")
+	fs.DurationVar((*time.Duration)(&c.Timeouts.Stats), "timeout-stats", time.Duration(c.Timeouts.Stats), "统计请求的超时时间，超时返回 504，为 0 表示不限制")
+	fs.DurationVar((*time.Duration)(&c.Timeouts.Admin), "timeout-admin", time.Duration(c.Timeouts.Admin), "管理请求的超时时间，超时返回 504，为 0 表示不限制")
+	fs.StringVar(&c.TLS.CertFile, "tls-cert", c.TLS.CertFile, "TLS 证书文件的路径，和 tls-key 都设置了才会启用 TLS")
+	fs.StringVar(&c.TLS.KeyFile, "tls-key", c.TLS.KeyFile, "TLS 私钥文件的路径，也可以是 vault:path#field 这样的密钥引用")
+	fs.Uint64Var(&c.Memory.DumpThreshold, "memory-dump-threshold", c.Memory.DumpThreshold, "物理内存超过多少字节时写入堆内存分析文件和 key 占用报告，为 0 表示不监控")
+	fs.StringVar(&c.Memory.DumpDir, "memory-dump-dir", c.Memory.DumpDir, "保存堆内存分析文件和 key 占用报告的目录")
+	fs.Int64Var(&c.Memory.MaxEntries, "max-entries", c.Memory.MaxEntries, "最多的键值对个数，超出时按照 eviction 淘汰 key，为 0 表示不限制")
+	fs.Int64Var(&c.Memory.MaxMemory, "max-memory", c.Memory.MaxMemory, "key 和 value 最多占用的总字节数，超出时按照 eviction 淘汰 key，为 0 表示不限制")
+	fs.DurationVar((*time.Duration)(&c.Memory.DefaultTTL), "default-ttl", time.Duration(c.Memory.DefaultTTL), "写入时没有指定过期时间使用的过期时间，为 0 表示永不过期")
+	fs.StringVar(&c.Memory.Eviction, "eviction", c.Memory.Eviction, "超出 max-entries 或者 max-memory 时的淘汰策略，可选值为 lru、lfu、fifo 和 noeviction，noeviction 表示拒绝新的写入")
+	fs.StringVar(&c.Memory.Admission, "admission", c.Memory.Admission, "缓存已满时是否接受新的 key 的准入策略，可选值为 tinylfu 和 probabilistic，为空表示接受所有写入")
+	fs.Float64Var(&c.Memory.AdmissionProbability, "admission-probability", c.Memory.AdmissionProbability, "准入策略为 probabilistic 时接受新的 key 的概率")
+	fs.StringVar(&c.Memory.Compression, "compression", c.Memory.Compression, "大的 value 在内存中的压缩算法，可选值为 gzip、snappy 和 zstd，为空表示不压缩")
+	fs.IntVar(&c.Memory.CompressionThreshold, "compression-threshold", c.Memory.CompressionThreshold, "开启 compression 时需要压缩的 value 的最小字节数")
+	fs.IntVar(&c.Memory.ChunkSize, "chunk-size", c.Memory.ChunkSize, "分块保存大的 value 时每块的字节数，为 0 表示不分块")
+	fs.IntVar(&c.Memory.LargeObjectThreshold, "large-object-threshold", c.Memory.LargeObjectThreshold, "大对象的分片大小，超过它的 value 分成多个 key 保存，为 0 表示不分片")
+
+	fs.BoolVar(&c.Engine.LockFreeReads, "lock-free-reads", c.Engine.LockFreeReads, "读取是否使用原子替换的只读视图，完全不加锁，适合读远多于写的场景，写入最多延迟 publish-delay 才能被读到")
+	fs.DurationVar((*time.Duration)(&c.Engine.PublishDelay), "publish-delay", time.Duration(c.Engine.PublishDelay), "开启 lock-free-reads 时写入发布到只读视图的最长延迟")
+	fs.IntVar(&c.Engine.PublishBatch, "publish-batch", c.Engine.PublishBatch, "开启 lock-free-reads 时累计多少个写入后立即发布到只读视图")
+	fs.IntVar(&c.Engine.Shards, "engine-shards", c.Engine.Shards, "开启 lock-free-reads 时只读视图的分片数，为 0 表示根据 CPU 个数自动选择")
+	fs.IntVar(&c.Engine.Segments, "engine-segments", c.Engine.Segments, "数据的分片数，每个分片有自己的锁，不同分片上的读写可以并行")
+	fs.BoolVar(&c.Engine.AutoReshard, "engine-auto-reshard", c.Engine.AutoReshard, "开启 lock-free-reads 时，发布写入需要复制的分片太大时是否自动将分片数翻倍")
+	fs.BoolVar(&c.Engine.Checksums, "checksums", c.Engine.Checksums, "是否在保存 value 时计算校验和，开启之后可以通过 POST /admin/verify 校验数据")
+	fs.StringVar(&c.Engine.Clock, "clock", c.Engine.Clock, "计算过期时间使用的时钟，可选值为 system 和 monotonic，monotonic 不受系统时间调整的影响")
+	fs.DurationVar((*time.Duration)(&c.GC.Interval), "gc-interval", time.Duration(c.GC.Interval), "清理过期数据的时间间隔，开启 gc-adaptive 时是初始的间隔")
+	fs.BoolVar(&c.GC.Adaptive, "gc-adaptive", c.GC.Adaptive, "是否根据过期数据的多少调整清理间隔，没有数据过期时放慢，大量数据过期时加快")
+	fs.DurationVar((*time.Duration)(&c.GC.MinInterval), "gc-min-interval", time.Duration(c.GC.MinInterval), "开启 gc-adaptive 时最短的清理间隔")
+	fs.DurationVar((*time.Duration)(&c.GC.MaxInterval), "gc-max-interval", time.Duration(c.GC.MaxInterval), "开启 gc-adaptive 时最长的清理间隔")
+
+	fs.StringVar(&c.Persistence.Dump, "dump", c.Persistence.Dump, "持久化文件的路径，为空表示不进行持久化")
+	fs.StringVar(&c.Persistence.DumpDir, "dump-dir", c.Persistence.DumpDir, "增量持久化的目录，设置后会代替 dump 进行增量持久化")
+	fs.IntVar(&c.Persistence.MaxIncrementals, "max-incrementals", c.Persistence.MaxIncrementals, "两次全量持久化之间最多进行的增量持久化次数")
+	fs.StringVar(&c.Persistence.Save, "save", c.Persistence.Save, "自动保存规则，两个数字一组，表示多少秒内至少发生多少次修改")
+	fs.DurationVar((*time.Duration)(&c.Persistence.SaveInterval), "save-interval", time.Duration(c.Persistence.SaveInterval), "距离上次保存超过这个时间并且有修改时自动保存，和 save 同时生效，为 0 表示只使用 save 规则")
+	fs.StringVar(&c.Persistence.Codec, "codec", c.Persistence.Codec, "持久化时使用的编码方式，可选值为 "+strings.Join(caches.CodecNames(), "、"))
+	fs.StringVar(&c.Persistence.LoadTTL, "load-ttl", c.Persistence.LoadTTL, "加载持久化文件时处理过期时间的方式，absolute 表示停机期间也计入存活时间，relative 表示不计入")
+	fs.Int64Var(&c.Persistence.WriteRate, "persistence-write-rate", c.Persistence.WriteRate, "持久化文件和 AOF 每秒最多写入磁盘的字节数，为 0 表示不限速")
+	fs.StringVar(&c.Persistence.AOF, "aof", c.Persistence.AOF, "记录所有修改操作的 AOF 文件路径，为空表示不记录")
+	fs.StringVar(&c.Persistence.AOFSync, "aof-sync", c.Persistence.AOFSync, "AOF 的 fsync 策略，always 表示每次修改都落盘，everysec 表示每秒落盘一次，no 表示交给操作系统")
+	fs.Int64Var(&c.Persistence.AOFRewriteSize, "aof-rewrite-size", c.Persistence.AOFRewriteSize, "AOF 超过这个字节数并且是上次重写之后的两倍时自动重写，为 0 表示不自动重写")
+	fs.StringVar(&c.Persistence.EncryptionKeyEnv, "encryption-key-env", c.Persistence.EncryptionKeyEnv, "保存持久化文件加密密钥的环境变量名，为空表示不加密")
+	fs.StringVar(&c.Persistence.EncryptionKeyFile, "encryption-key-file", c.Persistence.EncryptionKeyFile, "保存持久化文件加密密钥的文件路径，为空表示不加密")
+	fs.StringVar(&c.Persistence.EncryptionKey, "encryption-key", c.Persistence.EncryptionKey, "持久化文件加密密钥的引用，比如 vault:secret/data/gocache#encryption_key，为空表示不加密")
+
+	fs.StringVar(&c.Backup.Schedule, "backup-schedule", c.Backup.Schedule, "定时备份的 cron 表达式，比如 \"0 3 * * *\"，为空表示不进行定时备份")
+	fs.StringVar(&c.Backup.Dir, "backup-dir", c.Backup.Dir, "保存备份的本地目录，设置了 backup-s3-bucket 时不使用")
+	fs.StringVar(&c.Backup.S3.Endpoint, "backup-s3-endpoint", c.Backup.S3.Endpoint, "保存备份的对象存储地址")
+	fs.StringVar(&c.Backup.S3.Region, "backup-s3-region", c.Backup.S3.Region, "保存备份的对象存储区域")
+	fs.StringVar(&c.Backup.S3.Bucket, "backup-s3-bucket", c.Backup.S3.Bucket, "保存备份的对象存储桶，访问密钥从 AWS_ACCESS_KEY_ID 和 AWS_SECRET_ACCESS_KEY 环境变量中读取")
+	fs.StringVar(&c.Backup.S3.Prefix, "backup-s3-prefix", c.Backup.S3.Prefix, "备份对象名的前缀")
+	fs.IntVar(&c.Backup.KeepDaily, "backup-keep-daily", c.Backup.KeepDaily, "保留最近多少天的每日备份")
+	fs.IntVar(&c.Backup.KeepWeekly, "backup-keep-weekly", c.Backup.KeepWeekly, "保留最近多少周的每周备份")
+
+	fs.StringVar(&c.Logging.File, "log-file", c.Logging.File, "服务器日志的路径，为空表示输出到标准错误")
+	fs.StringVar(&c.Logging.Level, "log-level", c.Logging.Level, "服务器日志的级别，可选值为 debug、info、warn 和 error")
+	fs.Int64Var(&c.Logging.MaxSize, "log-max-size", c.Logging.MaxSize, "服务器日志文件的最大字节数，超过后会进行轮转，为 0 表示不轮转")
+	fs.IntVar(&c.Logging.MaxBackups, "log-max-backups", c.Logging.MaxBackups, "轮转时最多保留的旧日志文件个数")
+	fs.StringVar(&c.Logging.Audit, "audit-log", c.Logging.Audit, "审计日志的路径，记录所有写操作和管理操作，为空表示不记录")
+	fs.DurationVar((*time.Duration)(&c.Logging.SlowLogThreshold), "slowlog-threshold", time.Duration(c.Logging.SlowLogThreshold), "慢请求的耗时阈值，为 0 表示不记录慢请求")
+	fs.IntVar(&c.Logging.SlowLogSize, "slowlog-size", c.Logging.SlowLogSize, "最多保留的慢请求记录数")
+
+	fs.Var((*listValue)(&c.Auth.APIKeys), "api-keys", "允许访问的 API key，多个 key 使用逗号分隔，请求需要在 X-API-Key 请求头或者 Authorization: Bearer 中带上其中一个，为空表示不认证")
+	fs.Var((*listValue)(&c.Auth.ReadOnlyAPIKeys), "read-only-api-keys", "只读的 API key，多个 key 使用逗号分隔，只能读取缓存和查看统计数据")
+
+	fs.Var((*listValue)(&c.Metrics.PrefixGroups), "prefix-groups", "分组统计使用情况的 key 前缀，多个前缀使用逗号分隔，比如 \"session:*,product:*\"")
+	fs.StringVar(&c.Metrics.StatsD.Address, "statsd-address", c.Metrics.StatsD.Address, "StatsD 或者 Datadog Agent 的地址，设置后会定时推送统计数据，比如 \"127.0.0.1:8125\"")
+	fs.StringVar(&c.Metrics.StatsD.Prefix, "statsd-prefix", c.Metrics.StatsD.Prefix, "推送到 StatsD 的指标名前缀")
+	fs.Var((*listValue)(&c.Metrics.StatsD.Tags), "statsd-tags", "推送到 StatsD 的 Datadog 标签，多个标签使用逗号分隔，比如 \"env:prod,service:cache\"")
+	fs.DurationVar((*time.Duration)(&c.Metrics.StatsD.Interval), "statsd-interval", time.Duration(c.Metrics.StatsD.Interval), "推送统计数据的时间间隔")
+	fs.StringVar(&c.Metrics.OTLP.Endpoint, "otlp-endpoint", c.Metrics.OTLP.Endpoint, "OpenTelemetry Collector 的 OTLP/HTTP 地址，设置后会定时推送统计数据，比如 \"http://127.0.0.1:4318\"")
+	fs.DurationVar((*time.Duration)(&c.Metrics.OTLP.Interval), "otlp-interval", time.Duration(c.Metrics.OTLP.Interval), "推送 OTLP 统计数据的时间间隔")
+
+	fs.BoolVar(&c.Process.Daemon, "daemon", c.Process.Daemon, "是否脱离终端在后台运行，需要设置 log-file")
+	fs.StringVar(&c.Process.PIDFile, "pid-file", c.Process.PIDFile, "保存进程号的文件路径，为空表示不保存")
+
+	fs.StringVar(&c.Warmup.Source, "warmup-source", c.Warmup.Source, "启动时恢复持久化文件之后再导入的 NDJSON 数据，可以是文件路径或者另一个节点导出接口的地址，为空表示不导入")
+	fs.BoolVar(&c.Warmup.RefuseTraffic, "warmup-refuse-traffic", c.Warmup.RefuseTraffic, "预热完成之前读写缓存的请求是否返回 503")
+
+	fs.BoolVar(&c.Upgrade.Snapshot, "upgrade-snapshot", c.Upgrade.Snapshot, "收到 SIGUSR2 进行不停机升级时，是否通过管道将缓存数据直接交给新的进程，否则新的进程从持久化文件中恢复数据")
+	fs.DurationVar((*time.Duration)(&c.Upgrade.Timeout), "upgrade-timeout", time.Duration(c.Upgrade.Timeout), "不停机升级时等待新的进程准备好的最长时间，超时后旧的进程继续提供服务")
+
+	fs.StringVar(&c.Backend.URL, "backend-url", c.Backend.URL, "缓存没有命中时加载数据的后端地址，通过 GET 地址加上 key 加载，为空表示不使用后端")
+	fs.DurationVar((*time.Duration)(&c.Backend.TTL), "backend-ttl", time.Duration(c.Backend.TTL), "从后端加载的数据的存活时间，为 0 表示永不过期")
+	fs.DurationVar((*time.Duration)(&c.Backend.Timeout), "backend-timeout", time.Duration(c.Backend.Timeout), "访问后端的超时时间")
+	fs.DurationVar((*time.Duration)(&c.Backend.StaleGrace), "backend-stale-grace", time.Duration(c.Backend.StaleGrace), "数据过期之后继续保留的时间，这期间从后端加载失败时返回过期的数据，为 0 表示直接返回错误")
+	fs.StringVar(&c.Cluster.Self, "cluster-self", c.Cluster.Self, "本节点在集群中的地址，比如 \"http://10.0.0.1:8888\"，为空表示不开启集群模式")
+	fs.Var((*listValue)(&c.Cluster.Nodes), "cluster-nodes", "集群中所有节点的地址，多个地址使用逗号分隔，所有节点需要使用相同的列表")
+	fs.IntVar(&c.Cluster.Replicas, "cluster-replicas", c.Cluster.Replicas, "每个节点在哈希环上的虚拟节点个数，所有节点需要使用相同的值")
+	fs.StringVar(&c.Replication.ReplicaOf, "replica-of", c.Replication.ReplicaOf, "主节点的地址，比如 \"http://10.0.0.1:8888\"，设置后作为只读的副本复制主节点的数据")
+	fs.StringVar(&c.Shadow.URL, "shadow-url", c.Shadow.URL, "影子集群的地址，比如 \"http://10.0.0.2:8888\"，设置后把一部分读写缓存数据的请求异步复制过去，为空表示不开启")
+	fs.Float64Var(&c.Shadow.Percent, "shadow-percent", c.Shadow.Percent, "复制到影子集群的请求的百分比，取值范围是 0 到 100")
+	fs.DurationVar((*time.Duration)(&c.Shadow.Timeout), "shadow-timeout", time.Duration(c.Shadow.Timeout), "发送一个影子请求的超时时间")
+	fs.StringVar(&c.Secrets.Vault.Address, "vault-address", c.Secrets.Vault.Address, "Vault 的地址，设置后配置中可以使用 vault: 和 transit: 引用密钥")
+	fs.StringVar(&c.Secrets.Vault.Token, "vault-token", c.Secrets.Vault.Token, "访问 Vault 使用的 token，可以是 env: 或者 file: 引用")
+}
+
+// Resolve 得到最终的配置并校验，fs 需要已经解析过命令行参数
+// 优先级从低到高依次是 c 中的默认值、配置文件、GOCACHE_ 开头的环境变量和命令行中设置了的参数
+// fs 中的每个参数都可以使用 EnvName 返回的环境变量设置，配置文件的路径也可以使用 GOCACHE_CONFIG 设置
+func Resolve(fs *flag.FlagSet, c *Config) error {
+	// 参数的值直接写在 c 中，读取配置文件和环境变量会覆盖掉它们，所以先记下命令行中设置了的参数，最后再设置回去
+	return resolve(fs, explicitFlags(fs), c)
+}
+
+// Reload 使用和 Resolve 一样的规则重新得到一份配置，fs 是启动时使用 Resolve 处理过的参数
+// 重新读取配置文件和环境变量，命令行中设置了的参数保持不变，不会修改正在使用的配置
+func Reload(fs *flag.FlagSet) (*Config, error) {
+	c := Default()
+	reloaded := flag.NewFlagSet(fs.Name(), flag.ContinueOnError)
+	BindFlags(reloaded, c)
+
+	explicit := make(map[string]string)
+	for name, value := range explicitFlags(fs) {
+		if reloaded.Lookup(name) != nil {
+			explicit[name] = value
+		}
+	}
+
+	if err := resolve(reloaded, explicit, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// explicitFlags 返回命令行中设置了的参数和它们的值
+func explicitFlags(fs *flag.FlagSet) map[string]string {
+	explicit := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = f.Value.String()
+	})
+	return explicit
+}
+
+// resolve 依次使用配置文件、环境变量和 explicit 中的参数设置 c，并校验最终的配置
+func resolve(fs *flag.FlagSet, explicit map[string]string, c *Config) error {
+	path, ok := explicit["config"]
+	if !ok {
+		path = os.Getenv(EnvName("config"))
+	}
+
+	if path != "" {
+		if err := Load(path, c); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if _, ok := explicit[f.Name]; ok || err != nil {
+			return
+		}
+
+		if value, ok := os.LookupEnv(EnvName(f.Name)); ok {
+			if setErr := fs.Set(f.Name, value); setErr != nil {
+				err = fmt.Errorf("environment variable %s=%q: %w", EnvName(f.Name), value, setErr)
+			}
+		}
+	})
+
+	if err != nil {
+		return err
+	}
+
+	for name, value := range explicit {
+		if err = fs.Set(name, value); err != nil {
+			return err
+		}
+	}
+	return c.Validate()
+}
+
+// Usage 返回打印 fs 用法的函数，会在参数列表之后说明如何使用环境变量设置参数
+func Usage(fs *flag.FlagSet) func() {
+	return func() {
+		output := fs.Output()
+		fmt.Fprintf(output, "Usage of %s:\n", fs.Name())
+		fs.PrintDefaults()
+		fmt.Fprintf(output, "\n每个参数都可以使用 %s 开头的环境变量设置，比如 -gc-interval 对应 %s，命令行参数的优先级更高\n", EnvPrefix, EnvName("gc-interval"))
+	}
+}
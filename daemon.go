@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// daemonEnv 不为空表示进程已经在后台运行
+const daemonEnv = "GOCACHE_DAEMONIZED"
+
+// daemonize 在后台启动一个使用同样参数的新进程，返回 true 表示当前进程是前台进程，应该直接退出
+// Go 不能安全地 fork，所以通过重新执行自己来脱离终端
+func daemonize() (bool, error) {
+	if os.Getenv(daemonEnv) != "" {
+		os.Unsetenv(daemonEnv)
+		return false, nil
+	}
+
+	// 不停机升级时旧的进程已经在后台运行了，新的进程需要保留继承的监听
+	if _, ok := os.LookupEnv(inheritedListenersEnv); ok {
+		return false, nil
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return false, err
+	}
+
+	null, err := os.OpenFile(os.DevNull, os.O_RDWR, 0)
+	if err != nil {
+		return false, err
+	}
+	defer null.Close()
+
+	command := exec.Command(executable, os.Args[1:]...)
+	command.Env = append(os.Environ(), daemonEnv+"=1")
+	command.Stdin = null
+	command.Stdout = null
+	command.Stderr = null
+	if command.SysProcAttr, err = daemonAttr(); err != nil {
+		return false, err
+	}
+
+	if err = command.Start(); err != nil {
+		return false, err
+	}
+
+	fmt.Printf("gocache is running in background, pid %d\n", command.Process.Pid)
+	return true, nil
+}
+
+// writePIDFile 将当前进程的进程号写入 path，文件中的进程还在运行时返回错误
+// force 为 true 时直接覆盖，用于不停机升级时新的进程接替旧的进程
+func writePIDFile(path string, force bool) error {
+	if !force {
+		if pid, err := readPIDFile(path); err == nil && pid != os.Getpid() && processAlive(pid) {
+			return fmt.Errorf("another process %d is running with pid file %s", pid, path)
+		}
+	}
+	return ioutil.WriteFile(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644)
+}
+
+// removePIDFile 删除 path 指定的进程号文件，文件中的进程号已经不是当前进程时不删除
+func removePIDFile(path string) {
+	if pid, err := readPIDFile(path); err == nil && pid == os.Getpid() {
+		os.Remove(path)
+	}
+}
+
+// readPIDFile 读取 path 中保存的进程号
+func readPIDFile(path string) (int, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(string(bytes.TrimSpace(data)))
+}
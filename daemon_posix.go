@@ -0,0 +1,17 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import "syscall"
+
+// daemonAttr 返回后台进程的属性，新的进程会创建新的会话，从而脱离终端
+func daemonAttr() (*syscall.SysProcAttr, error) {
+	return &syscall.SysProcAttr{Setsid: true}, nil
+}
+
+// processAlive 返回进程号为 pid 的进程是否还在运行
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// daemonAttr 在 Windows 上返回错误，Windows 上应该使用服务管理器运行
+func daemonAttr() (*syscall.SysProcAttr, error) {
+	return nil, errors.New("daemon is not supported on windows")
+}
+
+// processAlive 返回进程号为 pid 的进程是否还在运行
+func processAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	process.Release()
+	return true
+}
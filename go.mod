@@ -2,4 +2,19 @@ module gocache
 
 go 1.18
 
-require github.com/julienschmidt/httprouter v1.3.0
+require (
+	github.com/BurntSushi/toml v1.3.2
+	github.com/julienschmidt/httprouter v1.3.0
+	github.com/klauspost/compress v1.16.7
+	google.golang.org/grpc v1.57.2
+	google.golang.org/protobuf v1.30.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/golang/protobuf v1.5.3 // indirect
+	golang.org/x/net v0.9.0 // indirect
+	golang.org/x/sys v0.7.0 // indirect
+	golang.org/x/text v0.9.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20230525234030-28d5490b6b19 // indirect
+)
@@ -0,0 +1,292 @@
+// Package httpcache 是缓存 HTTP 响应的中间件，可以把 gocache 作为反向代理前面的缓存层
+// 响应按照请求的方法、URL 和 Vary 指定的请求头缓存，存活时间来自响应的 Cache-Control 或者 Expires
+package httpcache
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Store 是保存响应的缓存，*caches.Cache 实现了这个接口
+type Store interface {
+	// Get 返回 key 对应的数据，找不到或者已经过期时返回 false
+	Get(key string) ([]byte, bool)
+
+	// SetWithTTL 保存 key 和 value，ttl 之后过期
+	SetWithTTL(key string, value []byte, ttl time.Duration)
+}
+
+const (
+	// defaultPrefix 是默认的 key 前缀
+	defaultPrefix = "httpcache:"
+
+	// defaultMaxBodySize 是默认可以缓存的最大响应体
+	defaultMaxBodySize = 1 << 20
+)
+
+// cacheableStatus 是可以缓存的响应状态码
+var cacheableStatus = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusNotFound:             true,
+	http.StatusGone:                 true,
+}
+
+// Middleware 缓存 GET 和 HEAD 请求的响应，作为共享缓存遵守 Cache-Control 的 no-store、private、no-cache 和 s-maxage
+// 带有 Authorization 请求头或者 Set-Cookie 响应头的响应不会被缓存
+type Middleware struct {
+	// Store 是保存响应的缓存
+	Store Store
+
+	// Prefix 是缓存中 key 的前缀，默认为 "httpcache:"
+	Prefix string
+
+	// DefaultTTL 是响应没有指定存活时间时使用的存活时间，为 0 表示不缓存这样的响应
+	DefaultTTL time.Duration
+
+	// MaxBodySize 是可以缓存的最大响应体，超过时不缓存，默认为 1MB
+	MaxBodySize int
+}
+
+// response 是缓存中保存的响应
+type response struct {
+	Status   int         `json:"status"`
+	Header   http.Header `json:"header"`
+	Body     []byte      `json:"body"`
+	StoredAt int64       `json:"stored_at"`
+}
+
+// New 返回使用 store 保存响应的中间件
+func New(store Store) *Middleware {
+	return &Middleware{Store: store, Prefix: defaultPrefix, MaxBodySize: defaultMaxBodySize}
+}
+
+// Handler 返回缓存 next 的响应的处理器，命中时响应头 X-Cache 为 HIT，否则为 MISS
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !m.cacheableRequest(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		base := m.baseKey(r)
+		if cached, ok := m.lookup(base, r); ok {
+			m.serve(w, r, cached)
+			return
+		}
+
+		w.Header().Set("X-Cache", "MISS")
+		recorder := &recorder{ResponseWriter: w, status: http.StatusOK, limit: m.maxBodySize()}
+		next.ServeHTTP(recorder, r)
+		m.store(base, r, recorder)
+	})
+}
+
+// cacheableRequest 返回请求的响应是否可以从缓存中读取和保存到缓存中
+func (m *Middleware) cacheableRequest(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if r.Header.Get("Authorization") != "" {
+		return false
+	}
+
+	directives := parseCacheControl(r.Header.Get("Cache-Control"))
+	_, noStore := directives["no-store"]
+	_, noCache := directives["no-cache"]
+	return !noStore && !noCache
+}
+
+// baseKey 返回请求的方法和 URL 对应的 key，这个 key 保存响应的 Vary 请求头，用于计算每个变体的 key
+func (m *Middleware) baseKey(r *http.Request) string {
+	return m.Prefix + r.Method + " " + r.Host + r.URL.RequestURI()
+}
+
+// variantKey 返回请求在 vary 指定的请求头下对应的变体的 key
+func variantKey(base string, vary []string, r *http.Request) string {
+	var key strings.Builder
+	key.WriteString(base)
+	for _, name := range vary {
+		key.WriteString("\n")
+		key.WriteString(name)
+		key.WriteString(":")
+		key.WriteString(strings.Join(r.Header.Values(name), ","))
+	}
+	return key.String()
+}
+
+// lookup 查找请求对应的缓存的响应
+func (m *Middleware) lookup(base string, r *http.Request) (*response, bool) {
+	varyValue, ok := m.Store.Get(base)
+	if !ok {
+		return nil, false
+	}
+
+	data, ok := m.Store.Get(variantKey(base, splitVary(string(varyValue)), r))
+	if !ok {
+		return nil, false
+	}
+
+	cached := new(response)
+	if err := json.Unmarshal(data, cached); err != nil {
+		return nil, false
+	}
+	return cached, true
+}
+
+// serve 使用缓存的响应回复请求，Age 是响应被缓存的秒数
+func (m *Middleware) serve(w http.ResponseWriter, r *http.Request, cached *response) {
+	header := w.Header()
+	for name, values := range cached.Header {
+		header[name] = values
+	}
+
+	age := time.Since(time.Unix(0, cached.StoredAt))
+	header.Set("Age", strconv.FormatInt(int64(age/time.Second), 10))
+	header.Set("X-Cache", "HIT")
+	w.WriteHeader(cached.Status)
+	if r.Method != http.MethodHead {
+		w.Write(cached.Body)
+	}
+}
+
+// store 在响应可以缓存时保存响应
+func (m *Middleware) store(base string, r *http.Request, recorded *recorder) {
+	if recorded.tooLarge || !cacheableStatus[recorded.status] {
+		return
+	}
+
+	header := recorded.Header()
+	if header.Get("Set-Cookie") != "" {
+		return
+	}
+
+	vary := splitVary(header.Get("Vary"))
+	for _, name := range vary {
+		if name == "*" {
+			return
+		}
+	}
+
+	ttl := m.responseTTL(header)
+	if ttl <= 0 {
+		return
+	}
+
+	stored := response{Status: recorded.status, Header: make(http.Header), Body: recorded.body.Bytes(), StoredAt: time.Now().UnixNano()}
+	for name, values := range header {
+		if name != "X-Cache" {
+			stored.Header[name] = values
+		}
+	}
+
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return
+	}
+
+	m.Store.SetWithTTL(base, []byte(strings.Join(vary, ",")), ttl)
+	m.Store.SetWithTTL(variantKey(base, vary, r), data, ttl)
+}
+
+// responseTTL 返回响应的存活时间，依次使用 Cache-Control 的 s-maxage、max-age 和 Expires，都没有时使用 DefaultTTL
+// 不允许共享缓存保存的响应返回 0
+func (m *Middleware) responseTTL(header http.Header) time.Duration {
+	directives := parseCacheControl(header.Get("Cache-Control"))
+	for _, name := range []string{"no-store", "no-cache", "private"} {
+		if _, ok := directives[name]; ok {
+			return 0
+		}
+	}
+
+	for _, name := range []string{"s-maxage", "max-age"} {
+		if value, ok := directives[name]; ok {
+			seconds, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return 0
+			}
+			return time.Duration(seconds) * time.Second
+		}
+	}
+
+	if expires := header.Get("Expires"); expires != "" {
+		t, err := http.ParseTime(expires)
+		if err != nil {
+			return 0
+		}
+
+		now := time.Now()
+		if date, err := http.ParseTime(header.Get("Date")); err == nil {
+			now = date
+		}
+		return t.Sub(now)
+	}
+	return m.DefaultTTL
+}
+
+// maxBodySize 返回可以缓存的最大响应体
+func (m *Middleware) maxBodySize() int {
+	if m.MaxBodySize <= 0 {
+		return defaultMaxBodySize
+	}
+	return m.MaxBodySize
+}
+
+// parseCacheControl 解析 Cache-Control 头，返回指令和指令的值，没有值的指令对应空字符串
+func parseCacheControl(value string) map[string]string {
+	directives := make(map[string]string)
+	for _, part := range strings.Split(value, ",") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(part), "=")
+		if name != "" {
+			directives[strings.ToLower(name)] = strings.Trim(arg, `"`)
+		}
+	}
+	return directives
+}
+
+// splitVary 解析 Vary 头，返回规范化之后的请求头名字
+func splitVary(value string) []string {
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, http.CanonicalHeaderKey(name))
+		}
+	}
+	return names
+}
+
+// recorder 在写出响应的同时记录状态码和响应体，响应体超过 limit 之后不再记录
+type recorder struct {
+	http.ResponseWriter
+	status   int
+	body     bytes.Buffer
+	limit    int
+	tooLarge bool
+}
+
+// WriteHeader 记录状态码
+func (r *recorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Write 记录响应体
+func (r *recorder) Write(data []byte) (int, error) {
+	if !r.tooLarge {
+		if r.body.Len()+len(data) > r.limit {
+			r.tooLarge = true
+			r.body = bytes.Buffer{}
+		} else {
+			r.body.Write(data)
+		}
+	}
+	return r.ResponseWriter.Write(data)
+}
@@ -0,0 +1,157 @@
+// Package logs 在标准库 log 的基础上提供日志级别，并支持在运行期间针对某些 key 打开调试日志
+package logs
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Level 是日志级别，低于当前级别的日志不会输出
+type Level int32
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// levelNames 是日志级别的名字
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+// String 返回日志级别的名字
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelError {
+		return fmt.Sprintf("level(%d)", int32(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel 解析日志级别的名字，不区分大小写
+func ParseLevel(s string) (Level, error) {
+	for i, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return Level(i), nil
+		}
+	}
+	return 0, fmt.Errorf("logs: unknown level %q, available: %s", s, strings.Join(levelNames, ", "))
+}
+
+// level 是当前的日志级别
+var level = int32(LevelInfo)
+
+// SetLevel 设置日志级别，运行期间可以随时调用
+func SetLevel(l Level) {
+	atomic.StoreInt32(&level, int32(l))
+}
+
+// GetLevel 返回当前的日志级别
+func GetLevel() Level {
+	return Level(atomic.LoadInt32(&level))
+}
+
+// Enabled 返回级别为 l 的日志是否会输出，用于避免准备日志内容的开销
+func Enabled(l Level) bool {
+	return l >= GetLevel()
+}
+
+// Debugf 输出调试日志
+func Debugf(format string, args ...interface{}) {
+	output(LevelDebug, format, args...)
+}
+
+// Infof 输出普通日志
+func Infof(format string, args ...interface{}) {
+	output(LevelInfo, format, args...)
+}
+
+// Warnf 输出警告日志
+func Warnf(format string, args ...interface{}) {
+	output(LevelWarn, format, args...)
+}
+
+// Errorf 输出错误日志
+func Errorf(format string, args ...interface{}) {
+	output(LevelError, format, args...)
+}
+
+// output 在 l 不低于当前级别时输出日志，日志前面带有级别的名字
+func output(l Level, format string, args ...interface{}) {
+	if !Enabled(l) {
+		return
+	}
+	log.Output(3, "["+l.String()+"] "+fmt.Sprintf(format, args...))
+}
+
+var (
+	// traced 记录了打开调试日志的 key 和调试日志的关闭时间，零值表示不会自动关闭
+	traced = make(map[string]time.Time)
+
+	// tracedCount 是打开调试日志的 key 的个数，为 0 时可以不加锁直接跳过
+	tracedCount int32
+
+	// tracedLock 保护 traced
+	tracedLock sync.RWMutex
+)
+
+// TraceKey 打开 key 的调试日志，之后涉及这个 key 的操作不论日志级别都会输出
+// ttl 大于 0 时调试日志会在 ttl 之后自动关闭
+func TraceKey(key string, ttl time.Duration) {
+	var until time.Time
+	if ttl > 0 {
+		until = time.Now().Add(ttl)
+	}
+
+	tracedLock.Lock()
+	defer tracedLock.Unlock()
+	traced[key] = until
+	atomic.StoreInt32(&tracedCount, int32(len(traced)))
+}
+
+// UntraceKey 关闭 key 的调试日志
+func UntraceKey(key string) {
+	tracedLock.Lock()
+	defer tracedLock.Unlock()
+	delete(traced, key)
+	atomic.StoreInt32(&tracedCount, int32(len(traced)))
+}
+
+// TracedKeys 返回所有打开调试日志的 key 和调试日志的关闭时间，零值表示不会自动关闭
+func TracedKeys() map[string]time.Time {
+	tracedLock.RLock()
+	defer tracedLock.RUnlock()
+	keys := make(map[string]time.Time, len(traced))
+	for key, until := range traced {
+		if until.IsZero() || time.Now().Before(until) {
+			keys[key] = until
+		}
+	}
+	return keys
+}
+
+// Traced 返回 key 是否打开了调试日志，没有 key 打开调试日志时几乎没有开销
+func Traced(key string) bool {
+	if atomic.LoadInt32(&tracedCount) == 0 {
+		return false
+	}
+
+	tracedLock.RLock()
+	until, ok := traced[key]
+	tracedLock.RUnlock()
+	if ok && !until.IsZero() && time.Now().After(until) {
+		UntraceKey(key)
+		return false
+	}
+	return ok
+}
+
+// Tracef 在 key 打开了调试日志时输出日志，不受日志级别的影响
+func Tracef(key string, format string, args ...interface{}) {
+	if Traced(key) {
+		log.Output(2, "[trace] "+fmt.Sprintf(format, args...))
+	}
+}
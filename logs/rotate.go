@@ -0,0 +1,106 @@
+package logs
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// RotatingFile 是按大小轮转的日志文件，大小超过 maxSize 时会将 path 重命名为 path.1，原来的 path.1 重命名为 path.2，以此类推
+// 最多保留 maxBackups 个旧的文件
+type RotatingFile struct {
+	// path 是日志文件的路径
+	path string
+
+	// maxSize 是日志文件的最大字节数，为 0 表示不轮转
+	maxSize int64
+
+	// maxBackups 是最多保留的旧文件个数
+	maxBackups int
+
+	// file 是正在写入的文件
+	file *os.File
+
+	// size 是正在写入的文件的大小
+	size int64
+
+	// lock 保证同一时间只有一个写入或者轮转在进行
+	lock sync.Mutex
+}
+
+// OpenRotatingFile 打开 path 指定的日志文件，写入的内容会追加到文件的末尾
+func OpenRotatingFile(path string, maxSize int64, maxBackups int) (*RotatingFile, error) {
+	rf := &RotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+// open 打开日志文件并记录它的大小
+func (rf *RotatingFile) open() error {
+	file, err := os.OpenFile(rf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	rf.file = file
+	rf.size = info.Size()
+	return nil
+}
+
+// Write 将 p 写入日志文件，写入之后超过最大字节数时先进行轮转
+// 一次写入的内容总是在同一个文件中，不会被拆开
+func (rf *RotatingFile) Write(p []byte) (int, error) {
+	rf.lock.Lock()
+	defer rf.lock.Unlock()
+	if rf.maxSize > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// rotate 关闭当前的文件，将旧的文件依次重命名，然后打开新的文件
+func (rf *RotatingFile) rotate() error {
+	if err := rf.file.Close(); err != nil {
+		return err
+	}
+
+	if rf.maxBackups <= 0 {
+		os.Remove(rf.path)
+		return rf.open()
+	}
+
+	os.Remove(backupName(rf.path, rf.maxBackups))
+	for i := rf.maxBackups - 1; i >= 1; i-- {
+		os.Rename(backupName(rf.path, i), backupName(rf.path, i+1))
+	}
+
+	if err := os.Rename(rf.path, backupName(rf.path, 1)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return rf.open()
+}
+
+// backupName 返回第 i 个旧文件的路径
+func backupName(path string, i int) string {
+	return fmt.Sprintf("%s.%d", path, i)
+}
+
+// Close 关闭日志文件
+func (rf *RotatingFile) Close() error {
+	rf.lock.Lock()
+	defer rf.lock.Unlock()
+	return rf.file.Close()
+}
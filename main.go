@@ -1,14 +1,20 @@
 package main
 
 import (
-	"gocache/caches"
-	"gocache/servers"
+	"log"
+	"os"
 )
 
 func main() {
-	cache := caches.NewCache()
-	err := servers.NewHTTPServer(cache).Run(":8888")
-	if err != nil {
-		panic(err)
+	// 第一个参数是子命令时执行子命令，否则启动服务器，这样旧的启动方式仍然可以使用
+	name, args := "server", os.Args[1:]
+	if len(args) > 0 {
+		if _, ok := commands[args[0]]; ok {
+			name, args = args[0], args[1:]
+		}
+	}
+
+	if err := commands[name].run(args); err != nil {
+		log.Fatal(err)
 	}
 }
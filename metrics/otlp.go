@@ -0,0 +1,238 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"gocache/caches"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// otlpCumulative 是 OTLP 中累计值的聚合方式
+const otlpCumulative = 2
+
+// OTLPConfig 是 OTLP 导出器的配置
+type OTLPConfig struct {
+	// Endpoint 是 OpenTelemetry Collector 的 OTLP/HTTP 地址，比如 "http://127.0.0.1:4318"
+	Endpoint string
+
+	// Headers 是每个请求附加的请求头，通常用于认证
+	Headers map[string]string
+
+	// Attributes 是附加到资源上的属性，service.name 默认为 gocache
+	Attributes map[string]string
+
+	// Interval 是推送的时间间隔
+	Interval time.Duration
+
+	// Client 是发送请求使用的 HTTP 客户端，为 nil 时使用 http.DefaultClient
+	Client *http.Client
+}
+
+// OTLP 定时将缓存的统计数据以 OTLP/HTTP 协议推送到 OpenTelemetry Collector
+// 使用 JSON 编码直接实现协议，不依赖 OpenTelemetry SDK
+// 累计的次数以单调递增的 sum 发送累计值，当前的值以 gauge 发送
+type OTLP struct {
+	// cache 是需要导出统计数据的缓存
+	cache *caches.Cache
+
+	// config 是导出器的配置
+	config OTLPConfig
+
+	// start 是开始累计的时间
+	start time.Time
+
+	// stop 用于通知后台协程退出
+	stop chan struct{}
+
+	// wg 用于等待后台协程退出
+	wg sync.WaitGroup
+
+	// OnError 在推送失败时被调用，为 nil 时忽略错误
+	OnError func(err error)
+}
+
+// NewOTLP 返回一个将 cache 的统计数据推送到 config.Endpoint 的导出器，需要调用 Start 才会开始推送
+func NewOTLP(cache *caches.Cache, config OTLPConfig) *OTLP {
+	if config.Interval <= 0 {
+		config.Interval = time.Minute
+	}
+
+	if config.Client == nil {
+		config.Client = http.DefaultClient
+	}
+
+	return &OTLP{
+		cache:  cache,
+		config: config,
+		start:  time.Now(),
+		stop:   make(chan struct{}),
+	}
+}
+
+// Start 开启后台协程，每隔 Interval 推送一次统计数据
+func (o *OTLP) Start() {
+	o.wg.Add(1)
+	go func() {
+		defer o.wg.Done()
+		ticker := time.NewTicker(o.config.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := o.Flush(context.Background()); err != nil && o.OnError != nil {
+					o.OnError(err)
+				}
+			case <-o.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止推送，并推送最后一次统计数据
+func (o *OTLP) Stop() error {
+	close(o.stop)
+	o.wg.Wait()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return o.Flush(ctx)
+}
+
+// Flush 立即推送一次统计数据
+func (o *OTLP) Flush(ctx context.Context) error {
+	body, err := json.Marshal(o.export(o.cache.Stats(), time.Now()))
+	if err != nil {
+		return err
+	}
+
+	url := strings.TrimSuffix(o.config.Endpoint, "/") + "/v1/metrics"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range o.config.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := o.config.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("metrics: otlp export failed: %s: %s", resp.Status, bytes.TrimSpace(message))
+	}
+	return nil
+}
+
+// otlpAttribute 是 OTLP 中的一个属性，只使用字符串类型的值
+type otlpAttribute struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+// otlpDataPoint 是 OTLP 中的一个整数数据点，64 位整数在 JSON 编码中使用字符串
+type otlpDataPoint struct {
+	AsInt             string `json:"asInt"`
+	StartTimeUnixNano string `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string `json:"timeUnixNano"`
+}
+
+// otlpSum 是 OTLP 中累计的指标
+type otlpSum struct {
+	DataPoints             []otlpDataPoint `json:"dataPoints"`
+	AggregationTemporality int             `json:"aggregationTemporality"`
+	IsMonotonic            bool            `json:"isMonotonic"`
+}
+
+// otlpGauge 是 OTLP 中表示当前值的指标
+type otlpGauge struct {
+	DataPoints []otlpDataPoint `json:"dataPoints"`
+}
+
+// otlpMetric 是 OTLP 中的一个指标，Sum 和 Gauge 只有一个不为 nil
+type otlpMetric struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Unit        string     `json:"unit,omitempty"`
+	Sum         *otlpSum   `json:"sum,omitempty"`
+	Gauge       *otlpGauge `json:"gauge,omitempty"`
+}
+
+// export 返回 ExportMetricsServiceRequest 的 JSON 结构
+func (o *OTLP) export(stats caches.Stats, now time.Time) map[string]interface{} {
+	attributes := map[string]string{"service.name": "gocache"}
+	for key, value := range o.config.Attributes {
+		attributes[key] = value
+	}
+
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	resource := make([]otlpAttribute, len(keys))
+	for i, key := range keys {
+		resource[i].Key = key
+		resource[i].Value.StringValue = attributes[key]
+	}
+
+	start := strconv.FormatInt(o.start.UnixNano(), 10)
+	timestamp := strconv.FormatInt(now.UnixNano(), 10)
+	sum := func(name string, description string, value int64) otlpMetric {
+		return otlpMetric{Name: name, Description: description, Unit: "1", Sum: &otlpSum{
+			DataPoints:             []otlpDataPoint{{AsInt: strconv.FormatInt(value, 10), StartTimeUnixNano: start, TimeUnixNano: timestamp}},
+			AggregationTemporality: otlpCumulative,
+			IsMonotonic:            true,
+		}}
+	}
+
+	metrics := []otlpMetric{
+		{Name: "gocache.keys", Description: "Number of keys in the cache", Unit: "1", Gauge: &otlpGauge{
+			DataPoints: []otlpDataPoint{{AsInt: strconv.FormatInt(stats.Keys, 10), TimeUnixNano: timestamp}},
+		}},
+		{Name: "gocache.bytes", Description: "Total bytes of keys and values in the cache", Unit: "By", Gauge: &otlpGauge{
+			DataPoints: []otlpDataPoint{{AsInt: strconv.FormatInt(stats.Bytes, 10), TimeUnixNano: timestamp}},
+		}},
+		{Name: "gocache.used_bytes", Description: "Approximate memory used by the cache data including per-key overhead", Unit: "By", Gauge: &otlpGauge{
+			DataPoints: []otlpDataPoint{{AsInt: strconv.FormatInt(stats.UsedBytes, 10), TimeUnixNano: timestamp}},
+		}},
+		sum("gocache.hits", "Number of Get calls that found the key", stats.Hits),
+		sum("gocache.misses", "Number of Get calls that did not find the key", stats.Misses),
+		sum("gocache.sets", "Number of Set calls", stats.Sets),
+		sum("gocache.deletes", "Number of keys deleted", stats.Deletes),
+		sum("gocache.expired", "Number of expired keys removed by Gc", stats.Expired),
+		sum("gocache.evictions", "Number of keys evicted by the eviction policy", stats.Evictions),
+		sum("gocache.admission.rejected", "Number of writes dropped by the admission policy or rejected because the cache is full", stats.Rejected),
+	}
+
+	return map[string]interface{}{
+		"resourceMetrics": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{"attributes": resource},
+				"scopeMetrics": []interface{}{
+					map[string]interface{}{
+						"scope":   map[string]interface{}{"name": "gocache"},
+						"metrics": metrics,
+					},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"gocache/caches"
+	"io"
+	"sort"
+)
+
+// PrometheusContentType 是 Prometheus 文本格式的 Content-Type
+const PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// WritePrometheus 将缓存的统计数据以 Prometheus 文本格式写入 w，用于 Prometheus 拉取指标
+// 累计的次数以 counter 的形式输出，当前的值以 gauge 的形式输出，耗时以秒为单位的 summary 输出
+func WritePrometheus(w io.Writer, stats caches.Stats) error {
+	writer := bufio.NewWriter(w)
+	metric := func(name string, kind string, help string, value int64) {
+		fmt.Fprintf(writer, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", name, help, name, kind, name, value)
+	}
+
+	metric("gocache_keys", "gauge", "Number of keys in the cache.", stats.Keys)
+	metric("gocache_bytes", "gauge", "Total bytes of keys and values in the cache.", stats.Bytes)
+	metric("gocache_used_bytes", "gauge", "Approximate memory used by the cache data including per-key overhead.", stats.UsedBytes)
+	metric("gocache_hits_total", "counter", "Number of Get calls that found the key.", stats.Hits)
+	metric("gocache_misses_total", "counter", "Number of Get calls that did not find the key.", stats.Misses)
+	metric("gocache_sets_total", "counter", "Number of Set calls.", stats.Sets)
+	metric("gocache_deletes_total", "counter", "Number of keys deleted.", stats.Deletes)
+	metric("gocache_expired_total", "counter", "Number of expired keys removed by Gc.", stats.Expired)
+	metric("gocache_evictions_total", "counter", "Number of keys evicted by the eviction policy.", stats.Evictions)
+	metric("gocache_admission_rejected_total", "counter", "Number of writes dropped by the admission policy or rejected because the cache is full.", stats.Rejected)
+	metric("gocache_aof_bytes", "gauge", "Size of the append-only file.", stats.AOFSize)
+
+	operations := make([]string, 0, len(stats.Latency))
+	for operation := range stats.Latency {
+		operations = append(operations, operation)
+	}
+	sort.Strings(operations)
+
+	const latency = "gocache_operation_duration_seconds"
+	fmt.Fprintf(writer, "# HELP %s Latency of cache operations.\n# TYPE %s summary\n", latency, latency)
+	for _, operation := range operations {
+		ls := stats.Latency[operation]
+		fmt.Fprintf(writer, "%s{operation=%q,quantile=\"0.5\"} %g\n", latency, operation, ls.P50.Seconds())
+		fmt.Fprintf(writer, "%s{operation=%q,quantile=\"0.95\"} %g\n", latency, operation, ls.P95.Seconds())
+		fmt.Fprintf(writer, "%s{operation=%q,quantile=\"0.99\"} %g\n", latency, operation, ls.P99.Seconds())
+		fmt.Fprintf(writer, "%s_count{operation=%q} %d\n", latency, operation, ls.Count)
+	}
+	return writer.Flush()
+}
@@ -0,0 +1,161 @@
+// Package metrics 将缓存的统计数据推送到外部的监控系统
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"gocache/caches"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// statsdMaxPacketSize 是一个 UDP 包的最大字节数，超过之后拆分成多个包发送
+// 1432 字节可以避免在常见的网络环境中被分片
+const statsdMaxPacketSize = 1432
+
+// StatsDConfig 是 StatsD 导出器的配置
+type StatsDConfig struct {
+	// Address 是 StatsD 或者 Datadog Agent 的地址，比如 "127.0.0.1:8125"
+	Address string
+
+	// Prefix 是指标名的前缀，比如 "gocache."
+	Prefix string
+
+	// Tags 是附加到每个指标上的 Datadog 标签，比如 "env:prod"，为空时发送标准的 StatsD 格式
+	Tags []string
+
+	// Interval 是推送的时间间隔
+	Interval time.Duration
+}
+
+// StatsD 定时将缓存的统计数据以 StatsD 协议推送出去，适用于不使用 Prometheus 拉取指标的环境
+// 累计的次数以 counter 的形式发送两次推送之间的增量，当前的值以 gauge 的形式发送
+type StatsD struct {
+	// cache 是需要导出统计数据的缓存
+	cache *caches.Cache
+
+	// config 是导出器的配置
+	config StatsDConfig
+
+	// conn 是发送指标使用的 UDP 连接
+	conn net.Conn
+
+	// last 是上次推送时的统计数据，用于计算增量
+	last caches.Stats
+
+	// stop 用于通知后台协程退出
+	stop chan struct{}
+
+	// wg 用于等待后台协程退出
+	wg sync.WaitGroup
+
+	// OnError 在推送失败时被调用，为 nil 时忽略错误
+	OnError func(err error)
+}
+
+// NewStatsD 返回一个将 cache 的统计数据推送到 config.Address 的导出器，需要调用 Start 才会开始推送
+func NewStatsD(cache *caches.Cache, config StatsDConfig) (*StatsD, error) {
+	if config.Interval <= 0 {
+		config.Interval = 10 * time.Second
+	}
+
+	conn, err := net.Dial("udp", config.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	return &StatsD{
+		cache:  cache,
+		config: config,
+		conn:   conn,
+		stop:   make(chan struct{}),
+	}, nil
+}
+
+// Start 开启后台协程，每隔 Interval 推送一次统计数据
+func (sd *StatsD) Start() {
+	sd.wg.Add(1)
+	go func() {
+		defer sd.wg.Done()
+		ticker := time.NewTicker(sd.config.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := sd.Flush(); err != nil && sd.OnError != nil {
+					sd.OnError(err)
+				}
+			case <-sd.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止推送，推送最后一次统计数据后关闭连接
+func (sd *StatsD) Stop() error {
+	close(sd.stop)
+	sd.wg.Wait()
+	err := sd.Flush()
+	if closeErr := sd.conn.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Flush 立即推送一次统计数据，不能和后台协程并发调用
+func (sd *StatsD) Flush() error {
+	stats := sd.cache.Stats()
+	last := sd.last
+	sd.last = stats
+
+	lines := []string{
+		sd.line("keys", stats.Keys, "g"),
+		sd.line("bytes", stats.Bytes, "g"),
+		sd.line("used_bytes", stats.UsedBytes, "g"),
+		sd.line("hits", stats.Hits-last.Hits, "c"),
+		sd.line("misses", stats.Misses-last.Misses, "c"),
+		sd.line("sets", stats.Sets-last.Sets, "c"),
+		sd.line("deletes", stats.Deletes-last.Deletes, "c"),
+		sd.line("expired", stats.Expired-last.Expired, "c"),
+		sd.line("evictions", stats.Evictions-last.Evictions, "c"),
+		sd.line("rejected", stats.Rejected-last.Rejected, "c"),
+	}
+	return sd.send(lines)
+}
+
+// line 返回一行 StatsD 格式的指标，比如 "gocache.hits:10|c|#env:prod"
+func (sd *StatsD) line(name string, value int64, kind string) string {
+	line := fmt.Sprintf("%s%s:%d|%s", sd.config.Prefix, name, value, kind)
+	if len(sd.config.Tags) > 0 {
+		line += "|#" + strings.Join(sd.config.Tags, ",")
+	}
+	return line
+}
+
+// send 将多行指标合并成尽量少的 UDP 包发送
+func (sd *StatsD) send(lines []string) error {
+	var packet bytes.Buffer
+	for _, line := range lines {
+		if packet.Len() > 0 && packet.Len()+1+len(line) > statsdMaxPacketSize {
+			if _, err := sd.conn.Write(packet.Bytes()); err != nil {
+				return err
+			}
+			packet.Reset()
+		}
+
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+
+	if packet.Len() == 0 {
+		return nil
+	}
+
+	_, err := sd.conn.Write(packet.Bytes())
+	return err
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrateProgressInterval 是打印迁移进度的间隔
+const migrateProgressInterval = time.Second
+
+// migrateCommand 遍历源服务器中以 prefix 开头的 key，连同剩余的存活时间一起复制到目标服务器
+// rate 限制每秒复制的 key 的个数，迁移期间定期在标准错误中打印进度，迁移期间源服务器上新写入的 key 可能复制也可能不复制
+func migrateCommand(args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	from := &client{}
+	to := &client{}
+	flags.StringVar(&from.server, "from", "", "源服务器的地址，比如 http://10.0.0.1:8888")
+	flags.StringVar(&to.server, "to", "", "目标服务器的地址，比如 http://10.0.0.2:8888")
+	flags.StringVar(&from.apiKey, "from-api-key", os.Getenv("GOCACHE_API_KEY"), "访问源服务器使用的 API key，默认从 GOCACHE_API_KEY 环境变量中读取")
+	flags.StringVar(&to.apiKey, "to-api-key", os.Getenv("GOCACHE_API_KEY"), "访问目标服务器使用的 API key，默认从 GOCACHE_API_KEY 环境变量中读取")
+	prefix := flags.String("prefix", "", "只复制以这个前缀开头的 key，为空表示复制所有的 key")
+	rate := flags.Int("rate", 0, "每秒最多复制的 key 的个数，为 0 表示不限制")
+	count := flags.Int("count", 100, "每次遍历源服务器时返回的 key 的个数")
+	flags.Parse(args)
+
+	if from.server == "" || to.server == "" {
+		return fmt.Errorf("migrate requires -from and -to")
+	}
+
+	if *rate < 0 || *count <= 0 {
+		return fmt.Errorf("invalid migrate parameters")
+	}
+
+	var interval time.Duration
+	if *rate > 0 {
+		interval = time.Second / time.Duration(*rate)
+	}
+
+	// 前缀中的 glob 特殊字符需要转义，只匹配字面上的前缀
+	pattern := globEscaper.Replace(*prefix) + "*"
+	var copied, skipped, failed int
+	start := time.Now()
+	next, lastReport := start, start
+	cursor := "0"
+	for {
+		keys, nextCursor, err := scanKeys(from, cursor, pattern, *count)
+		if err != nil {
+			return fmt.Errorf("scan %s failed after copying %d keys: %v", from.server, copied, err)
+		}
+
+		for _, key := range keys {
+			if interval > 0 {
+				if delay := time.Until(next); delay > 0 {
+					time.Sleep(delay)
+				}
+				next = next.Add(interval)
+				if now := time.Now(); next.Before(now) {
+					next = now
+				}
+			}
+
+			ok, err := migrateKey(from, to, key)
+			switch {
+			case err != nil:
+				failed++
+				fmt.Fprintf(os.Stderr, "copy %q failed: %v\n", key, err)
+			case ok:
+				copied++
+			default:
+				skipped++
+			}
+
+			if time.Since(lastReport) >= migrateProgressInterval {
+				lastReport = time.Now()
+				fmt.Fprintf(os.Stderr, "copied %d keys, skipped %d, failed %d, %.0f keys/s\n",
+					copied, skipped, failed, float64(copied)/time.Since(start).Seconds())
+			}
+		}
+
+		if nextCursor == "0" {
+			break
+		}
+		cursor = nextCursor
+	}
+
+	fmt.Printf("copied %d keys in %s, skipped %d expired or deleted keys, failed %d\n", copied, time.Since(start).Round(time.Millisecond), skipped, failed)
+	if failed > 0 {
+		return fmt.Errorf("failed to copy %d keys", failed)
+	}
+	return nil
+}
+
+// globEscaper 转义 glob 模式中的特殊字符
+var globEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+
+// scanKeys 从 cursor 开始遍历 c 中匹配 pattern 的 key，返回找到的 key 和下一次遍历使用的 cursor，cursor 为 "0" 表示遍历结束
+func scanKeys(c *client, cursor string, pattern string, count int) ([]string, string, error) {
+	query := url.Values{"cursor": {cursor}, "pattern": {pattern}, "count": {strconv.Itoa(count)}}
+	response, err := c.do(http.MethodGet, "/cache?"+query.Encode(), "", nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+		return nil, "", fmt.Errorf("%s %s", response.Status, strings.TrimSpace(string(message)))
+	}
+
+	var result struct {
+		Keys   []string    `json:"keys"`
+		Cursor json.Number `json:"cursor"`
+	}
+
+	if err = json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return nil, "", err
+	}
+	return result.Keys, result.Cursor.String(), nil
+}
+
+// migrateKey 把 key 的 value 和剩余的存活时间从 from 复制到 to，key 已经过期或者被删除时返回 false
+func migrateKey(from *client, to *client, key string) (bool, error) {
+	path := url.PathEscape(key)
+	response, err := from.do(http.MethodGet, "/object/"+path, "", nil)
+	if err != nil {
+		return false, err
+	}
+
+	var object struct {
+		TTLMillis int64 `json:"ttl_ms"`
+	}
+	err = decodeResponse(response, &object)
+	if err != nil || response.StatusCode == http.StatusNotFound {
+		return false, err
+	}
+
+	// 剩余的存活时间不到 1 毫秒时马上就会过期，不需要复制
+	if object.TTLMillis == 0 {
+		return false, nil
+	}
+
+	response, err = from.do(http.MethodGet, "/cache/"+path, "", nil)
+	if err != nil {
+		return false, err
+	}
+
+	value, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	switch {
+	case err != nil:
+		return false, err
+	case response.StatusCode == http.StatusNotFound:
+		return false, nil
+	case response.StatusCode != http.StatusOK:
+		return false, fmt.Errorf("get from source: %s", response.Status)
+	}
+
+	target := "/cache/" + path
+	if object.TTLMillis > 0 {
+		target += "?ttl=" + strconv.FormatInt(object.TTLMillis, 10) + "ms"
+	}
+
+	response, err = to.do(http.MethodPut, target, "", bytes.NewReader(value))
+	if err != nil {
+		return false, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode/100 != 2 {
+		message, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+		return false, fmt.Errorf("set on destination: %s %s", response.Status, strings.TrimSpace(string(message)))
+	}
+	return true, nil
+}
+
+// decodeResponse 把 200 的响应体解码到 v 中，404 时不解码，其他状态码返回错误，之后会关闭响应体
+func decodeResponse(response *http.Response, v interface{}) error {
+	defer response.Body.Close()
+	switch response.StatusCode {
+	case http.StatusOK:
+		return json.NewDecoder(response.Body).Decode(v)
+	case http.StatusNotFound:
+		return nil
+	}
+
+	message, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+	return fmt.Errorf("%s %s", response.Status, strings.TrimSpace(string(message)))
+}
@@ -0,0 +1,136 @@
+// Package peers 实现了类似 groupcache 的节点间填充缓存
+// 每个 key 由一致性哈希选出的一个节点负责，缓存没有命中时由负责的节点加载数据，其他节点向它获取
+// 每个节点内部合并同一个 key 同时进行的加载，所以整个集群中同一个 key 的缓存没有命中时只会访问一次数据源
+package peers
+
+import (
+	"context"
+	"gocache/caches"
+	"sync/atomic"
+	"time"
+)
+
+// Loader 从数据源加载 key 对应的数据，只会在负责 key 的节点上调用
+type Loader func(ctx context.Context, key string) ([]byte, error)
+
+// Group 是一组使用相同加载方式的数据，比如 "users"，数据在缓存中的 key 是组名加上冒号和 key
+type Group struct {
+	name    string
+	cache   *caches.Cache
+	ttl     time.Duration
+	loader  Loader
+	pool    *HTTPPool
+	flights flightGroup
+	stats   GroupStats
+}
+
+// GroupStats 是组的统计数据，都是从创建组开始累计的次数
+type GroupStats struct {
+	// Gets 是 Get 的次数，Hits 是其中缓存命中的次数
+	Gets int64 `json:"gets"`
+	Hits int64 `json:"hits"`
+
+	// Loads 是调用 Loader 的次数，PeerLoads 是向其他节点获取的次数，PeerErrors 是其中失败的次数
+	Loads      int64 `json:"loads"`
+	PeerLoads  int64 `json:"peer_loads"`
+	PeerErrors int64 `json:"peer_errors"`
+
+	// Shared 是等待同一个 key 正在进行的加载而没有自己加载的次数
+	Shared int64 `json:"shared"`
+
+	// ServerRequests 是处理其他节点请求的次数
+	ServerRequests int64 `json:"server_requests"`
+}
+
+// Name 返回组名
+func (g *Group) Name() string {
+	return g.name
+}
+
+// Get 返回 key 对应的数据，缓存没有命中时由负责 key 的节点加载
+// 向负责的节点获取失败时在本节点加载，避免一个节点不可用时它负责的 key 都无法读取
+func (g *Group) Get(ctx context.Context, key string) ([]byte, error) {
+	atomic.AddInt64(&g.stats.Gets, 1)
+	if value, ok := g.cache.Get(g.cacheKey(key)); ok {
+		atomic.AddInt64(&g.stats.Hits, 1)
+		return value, nil
+	}
+
+	value, err, shared := g.flights.Do(key, func() ([]byte, error) {
+		// 等待锁的时候其他调用者可能已经加载好了
+		if value, ok := g.cache.Get(g.cacheKey(key)); ok {
+			return value, nil
+		}
+
+		if peer, ok := g.pool.pick(key); ok {
+			atomic.AddInt64(&g.stats.PeerLoads, 1)
+			value, err := g.pool.fetch(ctx, peer, g.name, key)
+			if err == nil {
+				g.cache.SetWithTTL(g.cacheKey(key), value, g.ttl)
+				return value, nil
+			}
+			atomic.AddInt64(&g.stats.PeerErrors, 1)
+		}
+		return g.load(ctx, key)
+	})
+
+	if shared {
+		atomic.AddInt64(&g.stats.Shared, 1)
+	}
+	return value, err
+}
+
+// Remove 删除本节点缓存的 key，其他节点上的副本会在存活时间之后过期
+func (g *Group) Remove(key string) {
+	g.cache.Delete(g.cacheKey(key))
+}
+
+// Stats 返回组的统计数据
+func (g *Group) Stats() GroupStats {
+	return GroupStats{
+		Gets:           atomic.LoadInt64(&g.stats.Gets),
+		Hits:           atomic.LoadInt64(&g.stats.Hits),
+		Loads:          atomic.LoadInt64(&g.stats.Loads),
+		PeerLoads:      atomic.LoadInt64(&g.stats.PeerLoads),
+		PeerErrors:     atomic.LoadInt64(&g.stats.PeerErrors),
+		Shared:         atomic.LoadInt64(&g.stats.Shared),
+		ServerRequests: atomic.LoadInt64(&g.stats.ServerRequests),
+	}
+}
+
+// getLocal 处理其他节点的请求，本节点负责 key，缓存没有命中时直接加载，不会再转发给其他节点
+func (g *Group) getLocal(ctx context.Context, key string) ([]byte, error) {
+	atomic.AddInt64(&g.stats.ServerRequests, 1)
+	if value, ok := g.cache.Get(g.cacheKey(key)); ok {
+		return value, nil
+	}
+
+	value, err, shared := g.flights.Do(key, func() ([]byte, error) {
+		if value, ok := g.cache.Get(g.cacheKey(key)); ok {
+			return value, nil
+		}
+		return g.load(ctx, key)
+	})
+
+	if shared {
+		atomic.AddInt64(&g.stats.Shared, 1)
+	}
+	return value, err
+}
+
+// load 调用 Loader 加载数据并保存到缓存中
+func (g *Group) load(ctx context.Context, key string) ([]byte, error) {
+	atomic.AddInt64(&g.stats.Loads, 1)
+	value, err := g.loader(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	g.cache.SetWithTTL(g.cacheKey(key), value, g.ttl)
+	return value, nil
+}
+
+// cacheKey 返回 key 在缓存中的 key
+func (g *Group) cacheKey(key string) string {
+	return g.name + ":" + key
+}
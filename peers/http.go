@@ -0,0 +1,135 @@
+package peers
+
+import (
+	"context"
+	"fmt"
+	"gocache/caches"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultBasePath 是节点之间请求的默认路径前缀
+const defaultBasePath = "/_peers/"
+
+// HTTPPool 是通过 HTTP 互相获取数据的一组节点，同时也是处理其他节点请求的 http.Handler
+// 每个节点使用相同的节点列表，这样所有节点对每个 key 由谁负责的判断是一致的
+type HTTPPool struct {
+	// Client 是向其他节点发送请求使用的客户端，为 nil 时使用 http.DefaultClient
+	Client *http.Client
+
+	// self 是本节点的地址，比如 "http://10.0.0.1:8000"，和其他节点的地址格式相同
+	self     string
+	basePath string
+
+	lock   sync.RWMutex
+	ring   *Ring
+	groups map[string]*Group
+}
+
+// NewHTTPPool 返回本节点地址为 self 的节点池，basePath 是节点之间请求的路径前缀，为空时使用 "/_peers/"
+// 返回的节点池需要挂载到 self 对应的 HTTP 服务器的 basePath 上
+func NewHTTPPool(self string, basePath string) *HTTPPool {
+	if basePath == "" {
+		basePath = defaultBasePath
+	}
+	return &HTTPPool{self: self, basePath: basePath, ring: NewRing(0), groups: make(map[string]*Group)}
+}
+
+// Set 设置所有节点的地址，应该包括本节点，可以随时调用来增减节点
+func (p *HTTPPool) Set(peers ...string) {
+	ring := NewRing(0)
+	ring.Add(peers...)
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.ring = ring
+}
+
+// NewGroup 创建名为 name 的组，数据保存在 cache 中，ttl 之后过期，缓存没有命中时由负责的节点使用 loader 加载
+// 所有节点需要创建相同名字的组
+func (p *HTTPPool) NewGroup(name string, cache *caches.Cache, ttl time.Duration, loader Loader) *Group {
+	g := &Group{name: name, cache: cache, ttl: ttl, loader: loader, pool: p}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.groups[name] = g
+	return g
+}
+
+// Group 返回名为 name 的组，没有时返回 nil
+func (p *HTTPPool) Group(name string) *Group {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.groups[name]
+}
+
+// pick 返回负责 key 的其他节点，由本节点负责或者没有节点时返回 false
+func (p *HTTPPool) pick(key string) (string, bool) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	peer := p.ring.Get(key)
+	return peer, peer != "" && peer != p.self
+}
+
+// fetch 向 peer 获取 group 中 key 对应的数据
+func (p *HTTPPool) fetch(ctx context.Context, peer string, group string, key string) ([]byte, error) {
+	address := strings.TrimSuffix(peer, "/") + p.basePath + url.PathEscape(group) + "/" + url.PathEscape(key)
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, address, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+		return nil, fmt.Errorf("peers: %s returned %s: %s", peer, response.Status, strings.TrimSpace(string(message)))
+	}
+	return ioutil.ReadAll(response.Body)
+}
+
+// ServeHTTP 处理其他节点的请求，路径是 basePath 加上 "组名/key"
+func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.EscapedPath(), p.basePath)
+	groupName, key, ok := strings.Cut(path, "/")
+	if !ok || r.Method != http.MethodGet {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	groupName, err1 := url.PathUnescape(groupName)
+	key, err2 := url.PathUnescape(key)
+	if err1 != nil || err2 != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	g := p.Group(groupName)
+	if g == nil {
+		http.Error(w, "no such group: "+groupName, http.StatusNotFound)
+		return
+	}
+
+	value, err := g.getLocal(r.Context(), key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(value)
+}
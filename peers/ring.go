@@ -0,0 +1,11 @@
+package peers
+
+import "gocache/cluster"
+
+// Ring 是一致性哈希环，实现在 cluster 包中，集群模式和节点间填充缓存使用相同的哈希方式
+type Ring = cluster.Ring
+
+// NewRing 返回每个节点有 replicas 个虚拟节点的哈希环，replicas 不大于 0 时使用 50
+func NewRing(replicas int) *Ring {
+	return cluster.NewRing(replicas)
+}
@@ -0,0 +1,42 @@
+package peers
+
+import "sync"
+
+// call 是一次正在进行或者已经完成的加载
+type call struct {
+	done  chan struct{}
+	value []byte
+	err   error
+}
+
+// flightGroup 合并同一个 key 同时进行的加载，同一时间每个 key 只有一个加载在进行，其他调用者等待它的结果
+type flightGroup struct {
+	lock  sync.Mutex
+	calls map[string]*call
+}
+
+// Do 执行 key 的加载 fn，已经有加载在进行时等待它完成并返回它的结果，shared 表示结果是否来自其他调用者的加载
+func (g *flightGroup) Do(key string, fn func() ([]byte, error)) (value []byte, err error, shared bool) {
+	g.lock.Lock()
+	if c, ok := g.calls[key]; ok {
+		g.lock.Unlock()
+		<-c.done
+		return c.value, c.err, true
+	}
+
+	if g.calls == nil {
+		g.calls = make(map[string]*call)
+	}
+
+	c := &call{done: make(chan struct{})}
+	g.calls[key] = c
+	g.lock.Unlock()
+
+	c.value, c.err = fn()
+	close(c.done)
+
+	g.lock.Lock()
+	delete(g.calls, key)
+	g.lock.Unlock()
+	return c.value, c.err, false
+}
@@ -0,0 +1,40 @@
+package rdb
+
+import (
+	"gocache/caches"
+	"io"
+	"time"
+)
+
+// ImportStats 记录了导入 RDB 文件的结果
+type ImportStats struct {
+	Stats
+
+	// Imported 是成功导入的键值对个数
+	Imported int `json:"imported"`
+
+	// Expired 是已经过期而没有导入的键值对个数
+	Expired int `json:"expired"`
+}
+
+// Import 将 r 中的 RDB 文件里的字符串键值对导入到 cache 中，过期时间会被保留
+// 所有数据库中的键值对都会被导入到同一个缓存中，其他类型的键值对会被跳过
+func Import(cache *caches.Cache, r io.Reader) (ImportStats, error) {
+	stats := ImportStats{}
+	var err error
+	stats.Stats, err = Parse(r, func(item Item) error {
+		ttl := caches.NeverExpire
+		if !item.ExpireAt.IsZero() {
+			ttl = time.Until(item.ExpireAt)
+			if ttl <= 0 {
+				stats.Expired++
+				return nil
+			}
+		}
+
+		cache.SetWithTTL(item.Key, item.Value, ttl)
+		stats.Imported++
+		return nil
+	})
+	return stats, err
+}
@@ -0,0 +1,64 @@
+package rdb
+
+import "errors"
+
+// errLZF 表示 LZF 压缩的数据已经损坏
+var errLZF = errors.New("rdb: invalid lzf compressed data")
+
+// lzfMaxRatio 是 LZF 解压后和解压前的长度的最大比例，最长的引用使用 3 个字节表示 264 个字节
+const lzfMaxRatio = 88
+
+// lzfDecompress 解压使用 LZF 算法压缩的数据，length 是解压后的长度
+// 损坏的数据返回 errLZF，length 不可能是 in 解压后的长度时不会分配内存
+func lzfDecompress(in []byte, length int) ([]byte, error) {
+	if length < 0 || length > len(in)*lzfMaxRatio {
+		return nil, errLZF
+	}
+
+	out := make([]byte, 0, length)
+	for i := 0; i < len(in); {
+		ctrl := int(in[i])
+		i++
+
+		// ctrl 小于 32 表示后面 ctrl+1 个字节是原样保存的
+		if ctrl < 32 {
+			n := ctrl + 1
+			if i+n > len(in) || len(out)+n > length {
+				return nil, errLZF
+			}
+			out = append(out, in[i:i+n]...)
+			i += n
+			continue
+		}
+
+		// 否则是对前面数据的引用，高 3 位是长度，剩下的是距离
+		n := ctrl >> 5
+		if n == 7 {
+			if i >= len(in) {
+				return nil, errLZF
+			}
+			n += int(in[i])
+			i++
+		}
+
+		if i >= len(in) {
+			return nil, errLZF
+		}
+
+		ref := len(out) - ((ctrl & 0x1f) << 8) - int(in[i]) - 1
+		i++
+		if ref < 0 || len(out)+n+2 > length {
+			return nil, errLZF
+		}
+
+		// 引用的数据可能和要写入的数据重叠，所以需要一个字节一个字节地复制
+		for j := 0; j < n+2; j++ {
+			out = append(out, out[ref+j])
+		}
+	}
+
+	if len(out) != length {
+		return nil, errLZF
+	}
+	return out, nil
+}
@@ -0,0 +1,365 @@
+// 用于解析 Redis 的 RDB 持久化文件
+package rdb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+const (
+	// 下面是 RDB 文件中的操作码
+	opFunction2    = 0xf5
+	opFunction     = 0xf6
+	opModuleAux    = 0xf7
+	opIdle         = 0xf8
+	opFreq         = 0xf9
+	opAux          = 0xfa
+	opResizeDB     = 0xfb
+	opExpireTimeMs = 0xfc
+	opExpireTime   = 0xfd
+	opSelectDB     = 0xfe
+	opEOF          = 0xff
+)
+
+const (
+	// 下面是 RDB 文件中的数据类型
+	typeString          = 0
+	typeList            = 1
+	typeSet             = 2
+	typeZSet            = 3
+	typeHash            = 4
+	typeZSet2           = 5
+	typeHashZipmap      = 9
+	typeListZiplist     = 10
+	typeSetIntset       = 11
+	typeZSetZiplist     = 12
+	typeHashZiplist     = 13
+	typeListQuicklist   = 14
+	typeHashListpack    = 16
+	typeZSetListpack    = 17
+	typeListQuicklist2  = 18
+	typeSetListpack     = 20
+	quicklistNodePacked = 2
+)
+
+// maxStringLength 是字符串的最大长度，和 Redis 的 proto-max-bulk-len 的默认值一样，超过时当作文件已经损坏
+const maxStringLength = 512 << 20
+
+// ErrUnsupported 表示 RDB 文件中包含无法跳过的数据类型，比如 stream 和 module
+var ErrUnsupported = errors.New("rdb: unsupported data type")
+
+// Item 是 RDB 文件中的一个字符串键值对
+type Item struct {
+	// DB 是键值对所在的数据库编号
+	DB int
+
+	// Key 和 Value 是键值对的内容
+	Key   string
+	Value []byte
+
+	// ExpireAt 是过期时间，零值表示永不过期
+	ExpireAt time.Time
+}
+
+// Stats 记录了解析 RDB 文件的结果
+type Stats struct {
+	// Strings 是字符串类型的键值对个数
+	Strings int `json:"strings"`
+
+	// Skipped 是被跳过的其他类型的键值对个数
+	Skipped int `json:"skipped"`
+}
+
+// Parse 解析 r 中的 RDB 文件，每个字符串类型的键值对都会传给 fn，其他类型的键值对会被跳过
+// fn 返回错误时会停止解析并返回这个错误，文件被截断时返回 io.ErrUnexpectedEOF
+func Parse(r io.Reader, fn func(item Item) error) (Stats, error) {
+	stats, err := parse(r, fn)
+	if err == io.EOF {
+		// 完整的文件以 opEOF 结束，在这之前读到末尾说明文件被截断了
+		err = io.ErrUnexpectedEOF
+	}
+	return stats, err
+}
+
+// parse 和 Parse 一样解析 RDB 文件，文件被截断时可能返回 io.EOF
+func parse(r io.Reader, fn func(item Item) error) (Stats, error) {
+	reader := &reader{r: bufio.NewReader(r)}
+	stats := Stats{}
+
+	header := make([]byte, 9)
+	if _, err := io.ReadFull(reader.r, header); err != nil {
+		return stats, err
+	}
+
+	if string(header[:5]) != "REDIS" {
+		return stats, errors.New("rdb: invalid file header")
+	}
+
+	version, err := strconv.Atoi(string(header[5:]))
+	if err != nil {
+		return stats, errors.New("rdb: invalid file version")
+	}
+
+	db := 0
+	var expireAt time.Time
+	for {
+		op, err := reader.readByte()
+		if err != nil {
+			return stats, err
+		}
+
+		switch op {
+		case opEOF:
+			// 版本 5 开始文件末尾有 8 字节的 CRC64 校验和
+			if version >= 5 {
+				return stats, reader.skip(8)
+			}
+			return stats, nil
+		case opSelectDB:
+			n, _, err := reader.readLength()
+			if err != nil {
+				return stats, err
+			}
+			db = int(n)
+		case opResizeDB:
+			if _, _, err = reader.readLength(); err == nil {
+				_, _, err = reader.readLength()
+			}
+		case opAux:
+			if _, err = reader.readString(); err == nil {
+				_, err = reader.readString()
+			}
+		case opExpireTime:
+			var seconds uint32
+			err = binary.Read(reader.r, binary.LittleEndian, &seconds)
+			expireAt = time.Unix(int64(seconds), 0)
+		case opExpireTimeMs:
+			var ms uint64
+			err = binary.Read(reader.r, binary.LittleEndian, &ms)
+			expireAt = time.Unix(int64(ms/1000), int64(ms%1000)*int64(time.Millisecond))
+		case opIdle:
+			_, _, err = reader.readLength()
+		case opFreq:
+			_, err = reader.readByte()
+		case opFunction, opFunction2:
+			_, err = reader.readString()
+		case opModuleAux:
+			return stats, fmt.Errorf("%w: module aux data", ErrUnsupported)
+		default:
+			key, err := reader.readString()
+			if err != nil {
+				return stats, err
+			}
+
+			if op != typeString {
+				if err = reader.skipValue(op); err != nil {
+					return stats, fmt.Errorf("rdb: key %q: %w", key, err)
+				}
+				stats.Skipped++
+				expireAt = time.Time{}
+				continue
+			}
+
+			value, err := reader.readString()
+			if err != nil {
+				return stats, err
+			}
+
+			if err = fn(Item{DB: db, Key: string(key), Value: value, ExpireAt: expireAt}); err != nil {
+				return stats, err
+			}
+			stats.Strings++
+			expireAt = time.Time{}
+		}
+
+		if err != nil {
+			return stats, err
+		}
+	}
+}
+
+// reader 用于读取 RDB 文件中的基本数据
+type reader struct {
+	r *bufio.Reader
+}
+
+// readByte 读取一个字节
+func (r *reader) readByte() (byte, error) {
+	return r.r.ReadByte()
+}
+
+// skip 跳过 n 个字节
+func (r *reader) skip(n int) error {
+	_, err := r.r.Discard(n)
+	return err
+}
+
+// readLength 读取长度编码的数据
+// 如果第二个返回值为 true，说明这是一个特殊编码的字符串，第一个返回值是编码方式
+func (r *reader) readLength() (uint64, bool, error) {
+	b, err := r.readByte()
+	if err != nil {
+		return 0, false, err
+	}
+
+	switch b >> 6 {
+	case 0:
+		return uint64(b & 0x3f), false, nil
+	case 1:
+		next, err := r.readByte()
+		return uint64(b&0x3f)<<8 | uint64(next), false, err
+	case 2:
+		if b == 0x80 {
+			var n uint32
+			err = binary.Read(r.r, binary.BigEndian, &n)
+			return uint64(n), false, err
+		}
+
+		if b == 0x81 {
+			var n uint64
+			err = binary.Read(r.r, binary.BigEndian, &n)
+			return n, false, err
+		}
+		return 0, false, fmt.Errorf("rdb: invalid length encoding 0x%x", b)
+	default:
+		return uint64(b & 0x3f), true, nil
+	}
+}
+
+// readString 读取字符串，整数编码和 LZF 压缩的字符串会被还原
+func (r *reader) readString() ([]byte, error) {
+	n, encoded, err := r.readLength()
+	if err != nil {
+		return nil, err
+	}
+
+	if !encoded {
+		return r.readBytes(n)
+	}
+
+	switch n {
+	case 0:
+		b, err := r.readByte()
+		return []byte(strconv.Itoa(int(int8(b)))), err
+	case 1:
+		var v int16
+		err = binary.Read(r.r, binary.LittleEndian, &v)
+		return []byte(strconv.Itoa(int(v))), err
+	case 2:
+		var v int32
+		err = binary.Read(r.r, binary.LittleEndian, &v)
+		return []byte(strconv.Itoa(int(v))), err
+	case 3:
+		compressed, _, err := r.readLength()
+		if err != nil {
+			return nil, err
+		}
+
+		length, _, err := r.readLength()
+		if err != nil {
+			return nil, err
+		}
+
+		if length > maxStringLength {
+			return nil, errLZF
+		}
+
+		data, err := r.readBytes(compressed)
+		if err != nil {
+			return nil, err
+		}
+		return lzfDecompress(data, int(length))
+	default:
+		return nil, fmt.Errorf("rdb: invalid string encoding %d", n)
+	}
+}
+
+// readBytes 读取 n 个字节，随着读到的数据逐步分配内存，损坏的文件中很大的长度不会导致一次分配很多内存
+func (r *reader) readBytes(n uint64) ([]byte, error) {
+	if n > maxStringLength {
+		return nil, fmt.Errorf("rdb: string length %d exceeds %d", n, maxStringLength)
+	}
+
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, r.r, int64(n)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// skipStrings 跳过 n 个字符串
+func (r *reader) skipStrings(n uint64) error {
+	for i := uint64(0); i < n; i++ {
+		if _, err := r.readString(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// skipValue 跳过类型为 valueType 的值
+func (r *reader) skipValue(valueType byte) error {
+	switch valueType {
+	case typeList, typeSet, typeListQuicklist:
+		n, _, err := r.readLength()
+		if err != nil {
+			return err
+		}
+		return r.skipStrings(n)
+	case typeZSet, typeHash:
+		n, _, err := r.readLength()
+		if err != nil {
+			return err
+		}
+		return r.skipStrings(n * 2)
+	case typeZSet2:
+		n, _, err := r.readLength()
+		if err != nil {
+			return err
+		}
+
+		// 每个元素是一个字符串加上一个 8 字节的浮点数
+		for i := uint64(0); i < n; i++ {
+			if _, err = r.readString(); err != nil {
+				return err
+			}
+
+			if err = r.skip(8); err != nil {
+				return err
+			}
+		}
+		return nil
+	case typeHashZipmap, typeListZiplist, typeSetIntset, typeZSetZiplist, typeHashZiplist,
+		typeHashListpack, typeZSetListpack, typeSetListpack:
+		_, err := r.readString()
+		return err
+	case typeListQuicklist2:
+		n, _, err := r.readLength()
+		if err != nil {
+			return err
+		}
+
+		// 每个节点是一个容器类型加上一个字符串
+		for i := uint64(0); i < n; i++ {
+			if _, _, err = r.readLength(); err != nil {
+				return err
+			}
+
+			if _, err = r.readString(); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w %d", ErrUnsupported, valueType)
+	}
+}
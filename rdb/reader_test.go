@@ -0,0 +1,200 @@
+package rdb
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// update 为 true 时使用解析的结果重新生成 testdata 中的 .golden 文件
+var update = flag.Bool("update", false, "update golden files")
+
+// golden 是 .golden 文件中保存的解析结果
+type golden struct {
+	Items []goldenItem `json:"items"`
+	Stats Stats        `json:"stats"`
+	Error string       `json:"error,omitempty"`
+}
+
+// goldenItem 是 .golden 文件中的一个键值对，不是 UTF-8 的 value 使用十六进制保存在 Hex 中
+type goldenItem struct {
+	DB       int    `json:"db"`
+	Key      string `json:"key"`
+	Value    string `json:"value,omitempty"`
+	Hex      string `json:"hex,omitempty"`
+	ExpireAt string `json:"expire_at,omitempty"`
+}
+
+// parseGolden 解析 data 并返回 .golden 文件的内容
+func parseGolden(data []byte) golden {
+	result := golden{Items: []goldenItem{}}
+	var err error
+	result.Stats, err = Parse(bytes.NewReader(data), func(item Item) error {
+		g := goldenItem{DB: item.DB, Key: item.Key}
+		if utf8.Valid(item.Value) {
+			g.Value = string(item.Value)
+		} else {
+			g.Hex = hex.EncodeToString(item.Value)
+		}
+
+		if !item.ExpireAt.IsZero() {
+			g.ExpireAt = item.ExpireAt.UTC().Format(time.RFC3339Nano)
+		}
+		result.Items = append(result.Items, g)
+		return nil
+	})
+
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// fixtures 返回 testdata 中所有的 RDB 文件
+func fixtures(t testing.TB) map[string][]byte {
+	paths, err := filepath.Glob(filepath.Join("testdata", "*.rdb"))
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no fixtures: %v", err)
+	}
+
+	files := make(map[string][]byte)
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[strings.TrimSuffix(path, ".rdb")] = data
+	}
+	return files
+}
+
+func TestParseGolden(t *testing.T) {
+	for name, data := range fixtures(t) {
+		got, err := json.MarshalIndent(parseGolden(data), "", "  ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, '\n')
+
+		if *update {
+			if err := ioutil.WriteFile(name+".golden", got, 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+
+		want, err := ioutil.ReadFile(name + ".golden")
+		if err != nil {
+			t.Fatalf("%s: %v, run with -update to create it", name, err)
+		}
+
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: got\n%s\nwant\n%s", name, got, want)
+		}
+	}
+}
+
+func TestParseTruncated(t *testing.T) {
+	for name, data := range fixtures(t) {
+		for n := 0; n < len(data); n++ {
+			if _, err := Parse(bytes.NewReader(data[:n]), func(Item) error { return nil }); err == nil {
+				t.Fatalf("%s truncated to %d bytes: no error", name, n)
+			}
+		}
+	}
+}
+
+func TestParseCorrupt(t *testing.T) {
+	header := "REDIS0009\xfe\x00\x00\x01k"
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"invalid header", "RADIS0009\xff"},
+		{"invalid version", "REDIS00x9\xff"},
+		{"64-bit length", header + "\x81\x40\x00\x00\x00\x00\x00\x00\x00value"},
+		{"32-bit length", header + "\x80\xff\xff\xff\xffvalue"},
+		{"length over limit", header + "\x80\x20\x00\x00\x01value"},
+		{"invalid length encoding", header + "\x82value"},
+		{"invalid string encoding", header + "\xc4value"},
+		{"lzf huge length", header + "\xc3\x02\x80\x1f\xff\xff\xff\x00a"},
+		{"lzf huge compressed length", header + "\xc3\x80\xff\xff\xff\xff\x01a"},
+		{"lzf length too small", header + "\xc3\x02\x00\x00a"},
+		{"lzf length too large", header + "\xc3\x02\x05\x00a"},
+		{"lzf reference before start", header + "\xc3\x04\x05\x00a\x40\x05"},
+		{"lzf output longer than length", header + "\xc3\x05\x03\x00a\xe0\x10\x00"},
+		{"lzf truncated reference", header + "\xc3\x03\x05\x00a\xe0"},
+		{"unsupported type", "REDIS0009\xfe\x00\x0f\x01k\x00\xff"},
+		{"module aux", "REDIS0009\xf7\xff"},
+		{"huge list", "REDIS0009\xfe\x00\x01\x01k\x81\x40\x00\x00\x00\x00\x00\x00\x00\x01a"},
+	}
+
+	for _, test := range tests {
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		_, err := Parse(strings.NewReader(test.data), func(Item) error { return nil })
+		runtime.ReadMemStats(&after)
+
+		if err == nil {
+			t.Errorf("%s: no error", test.name)
+		}
+
+		if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+			t.Errorf("%s: allocated %d bytes", test.name, allocated)
+		}
+	}
+}
+
+func TestParseStopsOnCallbackError(t *testing.T) {
+	data := fixtures(t)[filepath.Join("testdata", "strings")]
+	errStop := errors.New("stop")
+	calls := 0
+	stats, err := Parse(bytes.NewReader(data), func(Item) error {
+		calls++
+		return errStop
+	})
+
+	if !errors.Is(err, errStop) || calls != 1 || stats.Strings != 0 {
+		t.Errorf("Parse = %+v, %v after %d calls", stats, err, calls)
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	for _, data := range fixtures(f) {
+		f.Add(data)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		items := 0
+		stats, err := Parse(bytes.NewReader(data), func(item Item) error {
+			items++
+			return nil
+		})
+
+		if err == nil && stats.Strings != items {
+			t.Fatalf("Strings = %d, but %d items were parsed", stats.Strings, items)
+		}
+	})
+}
+
+func FuzzLZFDecompress(f *testing.F) {
+	f.Add([]byte("\x00a\xe0\x5a\x00"), 100)
+	f.Add([]byte("\x02abc\xe0\x12\x02"), 30)
+	f.Add([]byte("\x01xy\x40\x01"), 6)
+
+	f.Fuzz(func(t *testing.T, in []byte, length int) {
+		out, err := lzfDecompress(in, length)
+		if err == nil && len(out) != length {
+			t.Fatalf("decompressed %d bytes, want %d", len(out), length)
+		}
+	})
+}
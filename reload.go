@@ -0,0 +1,180 @@
+package main
+
+import (
+	"flag"
+	"gocache/caches"
+	"gocache/configs"
+	"gocache/logs"
+	"gocache/secrets"
+	"gocache/servers"
+	"gocache/systemd"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// reloader 在运行期间重新加载配置，只会应用不需要重启就能安全修改的配置
+// 修改其他配置时只会打印提示，需要重启才能生效
+type reloader struct {
+	// config 是当前生效的配置
+	config *configs.Config
+
+	// flags 是启动服务器时使用的命令行参数
+	flags *flag.FlagSet
+
+	// cache 是服务器使用的缓存
+	cache *caches.Cache
+
+	// server 是 HTTP 服务器
+	server *servers.HTTPServer
+
+	// tcpServer 是二进制协议的 TCP 服务器，为 nil 表示没有开启
+	tcpServer *servers.TCPServer
+
+	// grpcServer 是 gRPC 服务器，为 nil 表示没有开启
+	grpcServer *servers.GRPCServer
+
+	// slowLog 是慢请求日志，为 nil 表示没有开启
+	slowLog *servers.SlowLog
+
+	// limiter 是持久化写入的限速器
+	limiter *caches.RateLimiter
+
+	// secrets 用于读取配置中引用的密钥
+	secrets secrets.Resolver
+
+	// logFile 是服务器日志文件，为 nil 表示输出到标准错误
+	logFile *logs.RotatingFile
+
+	// stopGc 用于停止当前的自动清理
+	stopGc func()
+
+	// lock 保证同一时间只有一个重新加载在进行
+	lock sync.Mutex
+}
+
+// openLog 将服务器日志输出到 config.File 指定的文件中，并按照 config.MaxSize 进行轮转，config.File 为空时输出到标准错误
+// 即使路径没有变化也会重新打开文件，这样日志文件被外部工具轮转之后可以写入新的文件
+func (r *reloader) openLog(config configs.LoggingConfig) error {
+	var file *logs.RotatingFile
+	if config.File != "" {
+		var err error
+		if file, err = logs.OpenRotatingFile(config.File, config.MaxSize, config.MaxBackups); err != nil {
+			return err
+		}
+		log.SetOutput(file)
+	} else {
+		log.SetOutput(os.Stderr)
+	}
+
+	if r.logFile != nil {
+		r.logFile.Close()
+	}
+	r.logFile = file
+	return nil
+}
+
+// Reload 重新读取配置文件和环境变量，并应用可以安全修改的配置
+// 新的配置不合法时返回错误，正在使用的配置保持不变
+func (r *reloader) Reload() error {
+	systemd.Notify("RELOADING=1")
+	defer systemd.Notify("READY=1")
+
+	config, err := configs.Reload(r.flags)
+	if err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if changed := config.RestartRequired(r.config); len(changed) > 0 {
+		logs.Warnf("config changes in %s require a restart to take effect", strings.Join(changed, ", "))
+	}
+
+	if config.TLS.CertFile != "" && r.config.TLS.CertFile != "" {
+		if err = loadCertificate(r.server, r.secrets, config.TLS); err != nil {
+			return err
+		}
+		r.config.TLS = config.TLS
+	}
+
+	if err = r.openLog(config.Logging); err != nil {
+		return err
+	}
+	r.config.Logging.File = config.Logging.File
+	r.config.Logging.MaxSize = config.Logging.MaxSize
+	r.config.Logging.MaxBackups = config.Logging.MaxBackups
+
+	// 只在配置文件中的级别变化时才修改，避免覆盖掉通过管理接口临时修改的级别
+	if config.Logging.Level != r.config.Logging.Level {
+		level, _ := logs.ParseLevel(config.Logging.Level)
+		logs.SetLevel(level)
+		r.config.Logging.Level = config.Logging.Level
+	}
+
+	r.server.SetTimeouts(timeoutsOf(config.Timeouts))
+	r.config.Timeouts = config.Timeouts
+
+	if config.GC != r.config.GC {
+		r.stopGc()
+		r.stopGc = startGc(r.cache, config.GC)
+		r.config.GC = config.GC
+	}
+
+	r.limiter.SetRate(config.Persistence.WriteRate)
+	r.config.Persistence.WriteRate = config.Persistence.WriteRate
+
+	if r.slowLog != nil && config.Logging.SlowLogThreshold > 0 {
+		r.slowLog.Configure(time.Duration(config.Logging.SlowLogThreshold), config.Logging.SlowLogSize)
+		r.config.Logging.SlowLogThreshold = config.Logging.SlowLogThreshold
+		r.config.Logging.SlowLogSize = config.Logging.SlowLogSize
+	}
+
+	apiKeys, err := resolveAPIKeys(r.secrets, config.Auth.APIKeys)
+	if err != nil {
+		return err
+	}
+	r.server.SetAPIKeys(apiKeys)
+	if r.tcpServer != nil {
+		r.tcpServer.SetAPIKeys(apiKeys)
+	}
+	if r.grpcServer != nil {
+		r.grpcServer.SetAPIKeys(apiKeys)
+	}
+
+	if err = setPolicies(r.server, r.secrets, config.Auth); err != nil {
+		return err
+	}
+	r.config.Auth = config.Auth
+	logs.Infof("config reloaded")
+	return nil
+}
+
+// startGc 按照 config 开启自动清理，返回停止清理的函数
+func startGc(cache *caches.Cache, config configs.GCConfig) (stop func()) {
+	if config.Adaptive {
+		return cache.AutoGcAdaptive(time.Duration(config.Interval), time.Duration(config.MinInterval), time.Duration(config.MaxInterval))
+	}
+	return cache.AutoGc(time.Duration(config.Interval))
+}
+
+// StopGc 停止自动清理，用于退出之前，之后再调用 Close 不会重复停止
+func (r *reloader) StopGc() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.stopGc()
+	r.stopGc = func() {}
+}
+
+// Close 停止自动清理并关闭服务器日志文件
+func (r *reloader) Close() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.stopGc()
+	if r.logFile != nil {
+		log.SetOutput(os.Stderr)
+		r.logFile.Close()
+	}
+}
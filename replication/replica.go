@@ -0,0 +1,275 @@
+package replication
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"gocache/caches"
+	"gocache/logs"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// readTimeout 是副本等待主节点数据的最长时间，主节点每秒都会发送心跳，超时说明连接已经断开
+	readTimeout = 5 * pingInterval
+
+	// minRetryDelay 和 maxRetryDelay 是重连间隔的范围，连续失败时间隔每次翻倍
+	minRetryDelay = time.Second
+	maxRetryDelay = 30 * time.Second
+)
+
+// Status 是副本的复制状态
+type Status struct {
+	// Primary 是主节点的地址
+	Primary string `json:"primary"`
+
+	// Connected 表示是否连接着主节点，Synced 表示连接之后是否已经完成全量同步
+	Connected bool `json:"connected"`
+	Synced    bool `json:"synced"`
+
+	// Promoted 表示副本是否已经被提升为主节点，提升之后不再复制
+	Promoted bool `json:"promoted"`
+
+	// LagMillis 是复制延迟，即现在和最后收到的主节点数据的发送时间之差，单位是毫秒，断开期间会一直增长
+	// 没有收到过数据时为 -1
+	LagMillis int64 `json:"lag_ms"`
+
+	// FullSyncs 是全量同步的次数，Ops 是应用的修改操作个数，Reconnects 是重连的次数
+	FullSyncs  int64 `json:"full_syncs"`
+	Ops        int64 `json:"ops"`
+	Reconnects int64 `json:"reconnects"`
+
+	// LastError 是最后一次连接断开的原因
+	LastError string `json:"last_error,omitempty"`
+}
+
+// Replica 从主节点复制数据到本地的缓存，断开之后会自动重连
+type Replica struct {
+	// Client 是连接主节点使用的客户端，为 nil 时使用 http.DefaultClient，不能设置整体的超时时间
+	Client *http.Client
+
+	// primary 是主节点的地址，比如 "http://10.0.0.1:8888"，apiKey 是访问主节点使用的 API key
+	primary string
+	apiKey  string
+	cache   *caches.Cache
+
+	// connected 和 synced 为 1 表示已经连接和已经完成全量同步，需要原子地读写
+	connected int32
+	synced    int32
+
+	// lastTime 是最后收到的主节点数据的发送时间，单位是纳秒，需要原子地读写
+	lastTime int64
+
+	// fullSyncs、ops 和 reconnects 是统计数据，需要原子地读写
+	fullSyncs  int64
+	ops        int64
+	reconnects int64
+
+	// lock 保护 lastError 和 promoted
+	lock      sync.Mutex
+	lastError string
+	promoted  bool
+
+	// worker 是复制协程的存活状态，调用 Start 之前为 nil
+	worker *caches.Worker
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewReplica 返回把 primary 的数据复制到 cache 中的副本，需要调用 Start 开始复制
+func NewReplica(cache *caches.Cache, primary string, apiKey string) *Replica {
+	return &Replica{primary: strings.TrimSuffix(primary, "/"), apiKey: apiKey, cache: cache}
+}
+
+// Primary 返回主节点的地址
+func (r *Replica) Primary() string {
+	return r.primary
+}
+
+// Start 在后台开始复制
+func (r *Replica) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	// 连接断开之后最多等待 maxRetryDelay 重连，连接着时最多 readTimeout 就会收到数据
+	r.worker = r.cache.RegisterWorker("replication", maxRetryDelay)
+	r.wg.Add(1)
+	go r.run(ctx)
+}
+
+// Stop 停止复制，已经复制的数据会保留
+func (r *Replica) Stop() {
+	if r.cancel != nil {
+		r.cancel()
+	}
+	r.wg.Wait()
+	if r.worker != nil {
+		r.worker.Stop()
+	}
+}
+
+// Promote 停止复制并把副本提升为主节点，之后 ReadOnly 返回 false，已经提升过时什么都不做
+func (r *Replica) Promote() {
+	r.lock.Lock()
+	if r.promoted {
+		r.lock.Unlock()
+		return
+	}
+	r.promoted = true
+	r.lock.Unlock()
+
+	r.Stop()
+	logs.Infof("replica promoted to primary, stopped replicating from %s", r.primary)
+}
+
+// ReadOnly 返回副本是否只读，被提升为主节点之前只读
+func (r *Replica) ReadOnly() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return !r.promoted
+}
+
+// Status 返回副本的复制状态
+func (r *Replica) Status() Status {
+	status := Status{
+		Primary:    r.primary,
+		Connected:  atomic.LoadInt32(&r.connected) == 1,
+		Synced:     atomic.LoadInt32(&r.synced) == 1,
+		LagMillis:  -1,
+		FullSyncs:  atomic.LoadInt64(&r.fullSyncs),
+		Ops:        atomic.LoadInt64(&r.ops),
+		Reconnects: atomic.LoadInt64(&r.reconnects),
+	}
+
+	if lastTime := atomic.LoadInt64(&r.lastTime); lastTime > 0 {
+		status.LagMillis = time.Since(time.Unix(0, lastTime)).Milliseconds()
+		if status.LagMillis < 0 {
+			// 两个节点的时钟不一致
+			status.LagMillis = 0
+		}
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	status.Promoted = r.promoted
+	status.LastError = r.lastError
+	return status
+}
+
+// run 连接主节点并复制数据，连接断开之后等待一段时间重连，直到 ctx 被取消
+func (r *Replica) run(ctx context.Context) {
+	defer r.wg.Done()
+	defer r.worker.Recover()
+	delay := minRetryDelay
+	for {
+		synced, err := r.replicate(ctx)
+		r.worker.Beat()
+		atomic.StoreInt32(&r.connected, 0)
+		atomic.StoreInt32(&r.synced, 0)
+		if ctx.Err() != nil {
+			return
+		}
+
+		r.lock.Lock()
+		r.lastError = err.Error()
+		r.lock.Unlock()
+
+		// 同步成功过说明主节点是正常的，马上重连
+		if synced {
+			delay = minRetryDelay
+		}
+		logs.Warnf("replication from %s stopped: %v, reconnecting in %s", r.primary, err, delay)
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return
+		}
+		r.worker.Beat()
+
+		atomic.AddInt64(&r.reconnects, 1)
+		if delay *= 2; delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+}
+
+// replicate 连接主节点，全量同步之后持续应用修改操作，直到连接断开
+// 返回的 synced 表示是否完成了全量同步，返回的错误不会是 nil
+func (r *Replica) replicate(ctx context.Context) (synced bool, err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, r.primary+StreamPath, nil)
+	if err != nil {
+		return false, err
+	}
+
+	if r.apiKey != "" {
+		request.Header.Set("X-API-Key", r.apiKey)
+	}
+
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return false, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("unexpected status %s", response.Status)
+	}
+	atomic.StoreInt32(&r.connected, 1)
+
+	// 超过 readTimeout 没有收到数据时取消请求，让阻塞的读取返回
+	timer := time.AfterFunc(readTimeout, cancel)
+	defer timer.Stop()
+
+	reader := bufio.NewReader(response.Body)
+	var entries []caches.Entry
+	for {
+		op, err := caches.ReadOp(reader)
+		if err != nil {
+			if err == io.EOF {
+				err = errors.New("primary closed the stream")
+			} else if !timer.Stop() {
+				err = errors.New("no data from primary within " + readTimeout.String())
+			}
+			return synced, err
+		}
+
+		timer.Reset(readTimeout)
+		r.worker.Beat()
+		atomic.StoreInt64(&r.lastTime, op.Time)
+		switch {
+		case op.Type == opPing:
+		case op.Type == opSynced:
+			if err = r.cache.ReplaceEntries(entries); err != nil {
+				return synced, err
+			}
+
+			logs.Infof("full sync from %s finished with %d keys", r.primary, len(entries))
+			entries, synced = nil, true
+			atomic.StoreInt32(&r.synced, 1)
+			atomic.AddInt64(&r.fullSyncs, 1)
+		case !synced:
+			// 全量同步的数据先收集起来，全部收到之后再替换，避免期间读到一半的数据
+			if op.Type == caches.OpSet {
+				entries = append(entries, caches.Entry{Key: op.Key, Value: op.Value, ExpireAt: op.ExpireAt})
+			}
+		default:
+			r.cache.ApplyOp(op)
+			atomic.AddInt64(&r.ops, 1)
+		}
+	}
+}
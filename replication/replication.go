@@ -0,0 +1,104 @@
+// Package replication 实现了异步的主从复制，副本连接到主节点之后先全量同步所有数据，再持续接收主节点的修改
+// 主节点不等待副本确认，副本的数据会比主节点稍微落后，断开之后副本会自动重连并重新全量同步
+package replication
+
+import (
+	"bufio"
+	"gocache/caches"
+	"gocache/logs"
+	"net/http"
+	"time"
+)
+
+// StreamPath 是主节点发送复制数据的接口路径
+const StreamPath = "/admin/replication/stream"
+
+const (
+	// opSynced 表示全量同步的数据已经发送完了，之后是增量的修改操作
+	opSynced byte = 0x80 + iota
+
+	// opPing 是主节点定期发送的心跳，副本用它的时间计算复制延迟，长时间收不到说明连接已经断开
+	opPing
+)
+
+const (
+	// pingInterval 是主节点发送心跳的间隔
+	pingInterval = time.Second
+
+	// streamBuffer 是主节点为每个副本缓冲的修改操作个数，副本跟不上时会被断开，重连后重新全量同步
+	streamBuffer = 65536
+)
+
+// Serve 把 cache 的数据发送给连接过来的副本，先发送 OpClear 和所有数据，然后持续发送修改操作直到副本断开
+// 发送的是 caches.WriteOp 编码的记录，用于挂载到主节点的 StreamPath 上
+func Serve(w http.ResponseWriter, r *http.Request, cache *caches.Cache) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	sub, entries := cache.Subscribe(streamBuffer)
+	defer cache.Unsubscribe(sub)
+	logs.Infof("replica %s connected, sending %d keys", r.RemoteAddr, len(entries))
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.WriteHeader(http.StatusOK)
+	writer := bufio.NewWriter(w)
+	if err := writeSync(writer, entries); err != nil || writer.Flush() != nil {
+		return
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+	for {
+		var err error
+		select {
+		case op, ok := <-sub.Ops():
+			if !ok {
+				logs.Warnf("replica %s fell behind or data was replaced, closing stream", r.RemoteAddr)
+				return
+			}
+			err = caches.WriteOp(writer, op)
+
+			// 把已经到达的操作一起发送出去，减少刷新的次数
+			for more := len(sub.Ops()); err == nil && more > 0; more-- {
+				if op, ok = <-sub.Ops(); ok {
+					err = caches.WriteOp(writer, op)
+				}
+			}
+		case now := <-ticker.C:
+			err = caches.WriteOp(writer, caches.Op{Type: opPing, Time: now.UnixNano()})
+		case <-r.Context().Done():
+			logs.Infof("replica %s disconnected", r.RemoteAddr)
+			return
+		}
+
+		if err == nil {
+			err = writer.Flush()
+		}
+
+		if err != nil {
+			logs.Infof("replica %s disconnected: %v", r.RemoteAddr, err)
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// writeSync 写入全量同步的数据
+func writeSync(writer *bufio.Writer, entries []caches.Entry) error {
+	now := time.Now().UnixNano()
+	if err := caches.WriteOp(writer, caches.Op{Type: caches.OpClear, Time: now}); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		op := caches.Op{Type: caches.OpSet, Time: now, Key: entry.Key, Value: entry.Value, ExpireAt: entry.ExpireAt}
+		if err := caches.WriteOp(writer, op); err != nil {
+			return err
+		}
+	}
+	return caches.WriteOp(writer, caches.Op{Type: opSynced, Time: now})
+}
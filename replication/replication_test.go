@@ -0,0 +1,115 @@
+package replication
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gocache/caches"
+)
+
+// waitFor 等待 cond 返回 true，5 秒之后还没有满足时使测试失败
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// hasValue 返回 cache 中 key 的 value 是否是 value
+func hasValue(cache *caches.Cache, key string, value string) bool {
+	v, ok := cache.Get(key)
+	return ok && string(v) == value
+}
+
+func TestReplication(t *testing.T) {
+	primary := caches.NewCache()
+	primary.Set("a", []byte("1"))
+	primary.Set("b", []byte("2"))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != StreamPath || r.Header.Get("X-API-Key") != "secret" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		Serve(w, r, primary)
+	}))
+	defer server.Close()
+
+	// 副本中原有的数据在全量同步之后被替换掉
+	cache := caches.NewCache()
+	cache.Set("stale", []byte("x"))
+	replica := NewReplica(cache, server.URL+"/", "secret")
+	replica.Start()
+	defer replica.Stop()
+
+	waitFor(t, "the full sync", func() bool { return replica.Status().Synced })
+	if !hasValue(cache, "a", "1") || !hasValue(cache, "b", "2") || cache.Count() != 2 {
+		t.Fatalf("replica has %d keys after the full sync, want a and b", cache.Count())
+	}
+
+	if status := replica.Status(); !status.Connected || status.FullSyncs != 1 || status.Primary != server.URL {
+		t.Fatalf("Status = %+v", status)
+	}
+
+	// 全量同步之后持续应用主节点的修改
+	primary.Set("c", []byte("3"))
+	primary.Delete("a")
+	waitFor(t, "the set and delete", func() bool {
+		_, deleted := cache.Get("a")
+		return hasValue(cache, "c", "3") && !deleted
+	})
+
+	if ops := replica.Status().Ops; ops != 2 {
+		t.Fatalf("applied %d ops, want 2", ops)
+	}
+
+	// 连接断开之后副本重连并重新全量同步，期间主节点的修改也会同步过来
+	server.CloseClientConnections()
+	primary.Set("d", []byte("4"))
+	waitFor(t, "the second full sync", func() bool { return replica.Status().FullSyncs == 2 })
+	if !hasValue(cache, "d", "4") || !hasValue(cache, "c", "3") || cache.Count() != 3 {
+		t.Fatalf("replica has %d keys after the re-sync, want b, c and d", cache.Count())
+	}
+
+	if status := replica.Status(); status.Reconnects != 1 || status.LastError == "" {
+		t.Fatalf("Status after reconnecting = %+v", status)
+	}
+
+	// 提升为主节点之后不再复制
+	if !replica.ReadOnly() {
+		t.Fatal("replica is writable before Promote")
+	}
+
+	replica.Promote()
+	if replica.ReadOnly() || !replica.Status().Promoted {
+		t.Fatal("replica is still read only after Promote")
+	}
+
+	// Promote 等待复制的协程退出之后才返回
+	primary.Set("e", []byte("5"))
+	if _, ok := cache.Get("e"); ok {
+		t.Fatal("promoted replica still applies ops from the primary")
+	}
+}
+
+func TestReplicaRejected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	replica := NewReplica(caches.NewCache(), server.URL, "wrong")
+	replica.Start()
+	defer replica.Stop()
+
+	waitFor(t, "the failed connection", func() bool { return replica.Status().LastError != "" })
+	if status := replica.Status(); status.Connected || status.Synced || status.LastError != "unexpected status 403 Forbidden" {
+		t.Fatalf("Status = %+v", status)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"time"
+
+	"gocache/configs"
+	"gocache/secrets"
+	"gocache/servers"
+)
+
+// secretTimeout 是读取一个密钥的最长时间，避免密钥管理系统不可用时启动和重新加载配置一直卡住
+const secretTimeout = 10 * time.Second
+
+// newResolver 返回解析配置中密钥引用的 Resolver，配置了 Vault 时还支持 vault: 和 transit: 引用
+func newResolver(config configs.SecretsConfig) (secrets.Resolver, error) {
+	resolver := secrets.NewResolver()
+	if config.Vault.Address == "" {
+		return resolver, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), secretTimeout)
+	defer cancel()
+
+	token, err := resolver.Value(ctx, config.Vault.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	vault := &secrets.Vault{Address: config.Vault.Address, Token: token}
+	resolver["vault"] = vault
+	resolver["transit"] = vault.Transit()
+	return resolver, nil
+}
+
+// resolveAPIKeys 读取 keys 中引用的 API key，不是引用的 key 保持不变
+func resolveAPIKeys(resolver secrets.Resolver, keys []string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), secretTimeout)
+	defer cancel()
+	return resolver.Values(ctx, keys)
+}
+
+// encryptionKey 返回读取 ref 引用的加密密钥的 KeyProvider，每次加密和解密持久化文件时都会重新读取
+func encryptionKey(resolver secrets.Resolver, ref string) func() ([]byte, error) {
+	return func() ([]byte, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), secretTimeout)
+		defer cancel()
+		return resolver.Resolve(ctx, ref)
+	}
+}
+
+// loadCertificate 读取 config 中的证书和私钥并设置到 server 中，私钥可以是密钥引用
+func loadCertificate(server *servers.HTTPServer, resolver secrets.Resolver, config configs.TLSConfig) error {
+	if !resolver.IsRef(config.KeyFile) {
+		return server.ReloadCertificate(config.CertFile, config.KeyFile)
+	}
+
+	certPEM, err := ioutil.ReadFile(config.CertFile)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), secretTimeout)
+	defer cancel()
+
+	keyPEM, err := resolver.Resolve(ctx, config.KeyFile)
+	if err != nil {
+		return err
+	}
+	return server.SetCertificate(certPEM, keyPEM)
+}
@@ -0,0 +1,116 @@
+// Package secrets 从环境变量、文件、Vault 等地方读取密钥，让 API key、TLS 私钥和加密密钥不需要明文写在配置中
+// 配置中使用 "scheme:path" 形式的引用表示密钥，比如 "env:GOCACHE_ADMIN_KEY"、"file:/run/secrets/tls.key"
+// 和 "vault:secret/data/gocache#api_key"
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Provider 是密钥的来源
+type Provider interface {
+	// Secret 返回 path 对应的密钥，path 的格式由 Provider 自己决定
+	Secret(ctx context.Context, path string) ([]byte, error)
+}
+
+// Env 从环境变量中读取密钥，path 是环境变量的名字
+type Env struct{}
+
+// Secret 返回环境变量 path 的值
+func (Env) Secret(ctx context.Context, path string) ([]byte, error) {
+	value, ok := os.LookupEnv(path)
+	if !ok {
+		return nil, fmt.Errorf("secrets: environment variable %s is not set", path)
+	}
+	return []byte(value), nil
+}
+
+// File 从文件中读取密钥，path 是文件的路径，比如 Docker 和 Kubernetes 挂载的 secret 文件
+type File struct{}
+
+// Secret 返回文件 path 的内容，末尾的换行会被去掉
+func (File) Secret(ctx context.Context, path string) ([]byte, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(strings.TrimRight(string(content), "\r\n")), nil
+}
+
+// Resolver 根据引用中的 scheme 选择 Provider 读取密钥
+type Resolver map[string]Provider
+
+// NewResolver 返回支持 env 和 file 的 Resolver，可以再注册其他的 Provider
+func NewResolver() Resolver {
+	return Resolver{
+		"env":  Env{},
+		"file": File{},
+	}
+}
+
+// IsRef 返回 value 是否是 r 能够解析的引用
+func (r Resolver) IsRef(value string) bool {
+	scheme, _, ok := strings.Cut(value, ":")
+	if !ok {
+		return false
+	}
+
+	_, ok = r[scheme]
+	return ok
+}
+
+// Resolve 读取引用 ref 指向的密钥，ref 的格式为 "scheme:path"
+func (r Resolver) Resolve(ctx context.Context, ref string) ([]byte, error) {
+	scheme, path, _ := strings.Cut(ref, ":")
+	provider, ok := r[scheme]
+	if !ok {
+		return nil, fmt.Errorf("secrets: unknown scheme %q in %q, available: %s", scheme, ref, strings.Join(r.schemes(), ", "))
+	}
+
+	secret, err := provider.Secret(ctx, path)
+	if err != nil {
+		return nil, fmt.Errorf("secrets: resolve %s failed: %w", ref, err)
+	}
+	return secret, nil
+}
+
+// Value 在 value 是引用时返回它指向的密钥，否则直接返回 value，用于既可以写明文也可以写引用的配置
+func (r Resolver) Value(ctx context.Context, value string) (string, error) {
+	if !r.IsRef(value) {
+		return value, nil
+	}
+
+	secret, err := r.Resolve(ctx, value)
+	if err != nil {
+		return "", err
+	}
+	return string(secret), nil
+}
+
+// Values 对 values 中的每个值调用 Value
+func (r Resolver) Values(ctx context.Context, values []string) ([]string, error) {
+	resolved := make([]string, 0, len(values))
+	for _, value := range values {
+		secret, err := r.Value(ctx, value)
+		if err != nil {
+			return nil, err
+		}
+		resolved = append(resolved, secret)
+	}
+	return resolved, nil
+}
+
+// schemes 返回所有支持的 scheme
+func (r Resolver) schemes() []string {
+	schemes := make([]string, 0, len(r))
+	for scheme := range r {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
@@ -0,0 +1,136 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// Vault 从 HashiCorp Vault 的 KV 引擎中读取密钥，path 的格式为 "secret/data/gocache#field"
+// 同时支持 KV v1 和 v2，没有 #field 时 path 中必须只有一个字段
+type Vault struct {
+	// Address 是 Vault 的地址，比如 "https://vault.example.com:8200"
+	Address string
+
+	// Token 是访问 Vault 使用的 token
+	Token string
+
+	// Client 是发送请求使用的客户端，为 nil 时使用 http.DefaultClient
+	Client *http.Client
+}
+
+// Secret 返回 path 指定的字段的值
+func (v *Vault) Secret(ctx context.Context, path string) ([]byte, error) {
+	path, field, _ := strings.Cut(path, "#")
+
+	var result struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := v.do(ctx, http.MethodGet, path, nil, &result); err != nil {
+		return nil, err
+	}
+
+	// KV v2 的数据在 data.data 中，还有一个 data.metadata
+	data := result.Data
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok := data["metadata"]; ok {
+			data = inner
+		}
+	}
+
+	if field == "" {
+		if len(data) != 1 {
+			return nil, fmt.Errorf("vault secret %s has %d fields, specify one with #field", path, len(data))
+		}
+
+		for name := range data {
+			field = name
+		}
+	}
+
+	value, ok := data[field].(string)
+	if !ok {
+		return nil, fmt.Errorf("vault secret %s has no string field %q", path, field)
+	}
+	return []byte(value), nil
+}
+
+// Decrypt 使用 Vault 的 transit 引擎解密 ciphertext，ciphertext 的格式为 "key:vault:v1:..."，key 是 transit 中密钥的名字
+// 可以作为 caches.KMS 使用，实现信封加密
+func (v *Vault) Decrypt(ctx context.Context, ciphertext []byte) ([]byte, error) {
+	key, encrypted, ok := strings.Cut(string(ciphertext), ":")
+	if !ok {
+		return nil, errors.New("vault transit ciphertext must be in the form key:vault:v1:...")
+	}
+
+	var result struct {
+		Data struct {
+			Plaintext string `json:"plaintext"`
+		} `json:"data"`
+	}
+
+	body := map[string]string{"ciphertext": strings.TrimSpace(encrypted)}
+	if err := v.do(ctx, http.MethodPost, "transit/decrypt/"+key, body, &result); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(result.Data.Plaintext)
+}
+
+// Transit 返回使用 transit 引擎解密的 Provider，path 的格式和 Decrypt 的 ciphertext 一样
+func (v *Vault) Transit() Provider {
+	return transit{vault: v}
+}
+
+// transit 使用 Vault 的 transit 引擎解密引用中的密文
+type transit struct {
+	vault *Vault
+}
+
+// Secret 返回解密后的密钥
+func (t transit) Secret(ctx context.Context, path string) ([]byte, error) {
+	return t.vault.Decrypt(ctx, []byte(path))
+}
+
+// do 向 Vault 发送请求，并将响应解码到 result 中
+func (v *Vault) do(ctx context.Context, method string, path string, body interface{}, result interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	url := strings.TrimSuffix(v.Address, "/") + "/v1/" + strings.TrimPrefix(path, "/")
+	request, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("X-Vault-Token", v.Token)
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	client := v.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(response.Body)
+		return fmt.Errorf("vault %s %s: %s %s", method, path, response.Status, strings.TrimSpace(string(message)))
+	}
+	return json.NewDecoder(response.Body).Decode(result)
+}
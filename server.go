@@ -0,0 +1,692 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"gocache/audit"
+	"gocache/backups"
+	"gocache/caches"
+	"gocache/cluster"
+	"gocache/configs"
+	"gocache/logs"
+	"gocache/metrics"
+	"gocache/replication"
+	"gocache/secrets"
+	"gocache/servers"
+	"gocache/systemd"
+	"gocache/watchdog"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// serverCommand 启动缓存服务器，args 是服务器的命令行参数
+func serverCommand(args []string) error {
+	cfg := configs.Default()
+	flags := flag.NewFlagSet("server", flag.ExitOnError)
+	configs.BindFlags(flags, cfg)
+	importRDB := flags.String("import-rdb", "", "启动时导入的 Redis RDB 文件，只会导入字符串类型的键值对")
+	restoreTo := flags.String("restore-to", "", "使用持久化文件和 AOF 将数据恢复到指定的时间，格式为 RFC3339，比如 \"2006-01-02T15:04:05Z\"，恢复完成后退出")
+	flags.Usage = configs.Usage(flags)
+	flags.Parse(args)
+
+	if err := configs.Resolve(flags, cfg); err != nil {
+		return err
+	}
+
+	if cfg.Process.Daemon {
+		foreground, err := daemonize()
+		if err != nil {
+			return fmt.Errorf("daemonize failed: %w", err)
+		}
+
+		if foreground {
+			return nil
+		}
+	}
+
+	level, err := logs.ParseLevel(cfg.Logging.Level)
+	if err != nil {
+		return err
+	}
+	logs.SetLevel(level)
+
+	// 运行期间收到 SIGHUP 或者调用管理接口时会重新加载配置
+	reloads := &reloader{config: cfg, flags: flags}
+	if err := reloads.openLog(cfg.Logging); err != nil {
+		return err
+	}
+
+	// API key、TLS 私钥和加密密钥可以引用环境变量、文件和 Vault 中的密钥，不需要明文写在配置中
+	resolver, err := newResolver(cfg.Secrets)
+	if err != nil {
+		return fmt.Errorf("connect to secret store failed: %w", err)
+	}
+	reloads.secrets = resolver
+
+	apiKeys, err := resolveAPIKeys(resolver, cfg.Auth.APIKeys)
+	if err != nil {
+		return err
+	}
+
+	// 通过不停机升级启动时从旧的进程继承监听，可能还有缓存数据
+	inherited, err := inherit()
+	if err != nil {
+		return fmt.Errorf("inherit from old process failed: %w", err)
+	}
+
+	// 不停机升级时旧的进程还在运行，新的进程直接覆盖进程号文件，旧的进程退出时发现进程号不是自己就不会删除
+	if cfg.Process.PIDFile != "" {
+		if err := writePIDFile(cfg.Process.PIDFile, inherited != nil); err != nil {
+			return err
+		}
+		defer removePIDFile(cfg.Process.PIDFile)
+	}
+
+	codec, err := caches.CodecByName(cfg.Persistence.Codec)
+	if err != nil {
+		return err
+	}
+
+	options := caches.DefaultOptions()
+	options.Codec = codec
+	options.LockFreeReads = cfg.Engine.LockFreeReads
+	options.PublishDelay = time.Duration(cfg.Engine.PublishDelay)
+	options.PublishBatch = cfg.Engine.PublishBatch
+	options.ReadShards = cfg.Engine.Shards
+	options.AutoReshard = cfg.Engine.AutoReshard
+	options.Segments = cfg.Engine.Segments
+	options.Checksums = cfg.Engine.Checksums
+	options.Clock, err = caches.ClockByName(cfg.Engine.Clock)
+	if err != nil {
+		return err
+	}
+	options.MaxEntries = cfg.Memory.MaxEntries
+	options.MaxBytes = cfg.Memory.MaxMemory
+	if cfg.Backend.URL != "" {
+		options.StaleGrace = time.Duration(cfg.Backend.StaleGrace)
+	}
+	// noeviction 拒绝超出限制的写入，复制和锁这些不会被拒绝的写入仍然按照 LRU 淘汰
+	if cfg.Memory.Eviction == "noeviction" {
+		options.RejectWhenFull = true
+	} else if options.EvictionPolicy, err = caches.EvictionPolicyByName(cfg.Memory.Eviction); err != nil {
+		return err
+	}
+
+	options.Compression, err = caches.CompressionByName(cfg.Memory.Compression)
+	if err != nil {
+		return err
+	}
+	options.CompressionThreshold = cfg.Memory.CompressionThreshold
+	options.ChunkSize = cfg.Memory.ChunkSize
+	options.LargeObjectThreshold = cfg.Memory.LargeObjectThreshold
+
+	options.Admission, err = caches.AdmissionPolicyByName(cfg.Memory.Admission, cfg.Memory.MaxEntries, cfg.Memory.AdmissionProbability)
+	if err != nil {
+		return err
+	}
+
+	if cfg.Persistence.EncryptionKeyEnv != "" {
+		options.KeyProvider = caches.EnvKey(cfg.Persistence.EncryptionKeyEnv)
+	}
+
+	if cfg.Persistence.EncryptionKeyFile != "" {
+		options.KeyProvider = caches.FileKey(cfg.Persistence.EncryptionKeyFile)
+	}
+
+	if cfg.Persistence.EncryptionKey != "" {
+		options.KeyProvider = caches.SecretKey(encryptionKey(resolver, cfg.Persistence.EncryptionKey))
+	}
+
+	options.LoadTTLMode, err = caches.ParseLoadTTLMode(cfg.Persistence.LoadTTL)
+	if err != nil {
+		return err
+	}
+
+	options.RateLimiter = caches.NewRateLimiter(cfg.Persistence.WriteRate)
+	options.PrefixGroups = cfg.Metrics.PrefixGroups
+
+	// 每个租户是缓存中的一个命名空间，key 的个数和占用的内存由缓存限制，请求数由服务器限制
+	tenants := make([]servers.Tenant, 0, len(cfg.Tenants))
+	for _, tenant := range cfg.Tenants {
+		options.Namespaces = append(options.Namespaces, caches.Namespace{
+			Prefix:        servers.TenantPrefix(tenant.Name),
+			MaxKeys:       tenant.MaxKeys,
+			MaxBytes:      tenant.MaxMemory,
+			MaxWriteBytes: tenant.MaxWriteBytes,
+		})
+
+		tenantKeys, err := resolveAPIKeys(resolver, tenant.APIKeys)
+		if err != nil {
+			return err
+		}
+		tenants = append(tenants, servers.Tenant{Name: tenant.Name, APIKeys: tenantKeys, MaxOps: tenant.MaxOps})
+	}
+
+	for _, namespace := range cfg.Namespaces {
+		options.Namespaces = append(options.Namespaces, caches.Namespace{
+			Name:       namespace.Name,
+			DefaultTTL: time.Duration(namespace.DefaultTTL),
+			MaxKeys:    namespace.MaxKeys,
+			MaxBytes:   namespace.MaxMemory,
+		})
+	}
+
+	if *restoreTo != "" {
+		return restore(options, *restoreTo, cfg.Persistence)
+	}
+
+	if cfg.Persistence.AOF != "" {
+		policy, err := caches.ParseAOFSync(cfg.Persistence.AOFSync)
+		if err != nil {
+			return err
+		}
+
+		aof, err := caches.OpenAOF(cfg.Persistence.AOF, options.KeyProvider, options.RateLimiter, policy)
+		if err != nil {
+			return err
+		}
+		defer aof.Close()
+		options.AOF = aof
+	}
+	cache := caches.NewCacheWithOptions(options)
+
+	// 从旧的进程继承了缓存数据时直接使用，否则启动之后在后台预热
+	if inherited != nil && inherited.snapshot != nil {
+		err := cache.Load(inherited.snapshot)
+		inherited.snapshot.Close()
+		if err != nil {
+			return fmt.Errorf("load snapshot from old process failed: %w", err)
+		}
+	}
+
+	reloads.cache = cache
+	reloads.limiter = options.RateLimiter
+	reloads.stopGc = startGc(cache, cfg.GC)
+	defer reloads.Close()
+
+	var saver *caches.AutoSaver
+	if cfg.Persistence.DumpDir != "" || cfg.Persistence.Dump != "" {
+		rules, err := caches.ParseSaveRules(cfg.Persistence.Save)
+		if err != nil {
+			return err
+		}
+
+		if cfg.Persistence.DumpDir != "" {
+			saver = caches.NewIncrementalAutoSaver(cache, cfg.Persistence.DumpDir, cfg.Persistence.MaxIncrementals, rules)
+		} else {
+			saver = caches.NewAutoSaver(cache, cfg.Persistence.Dump, rules)
+		}
+		saver.Interval = time.Duration(cfg.Persistence.SaveInterval)
+		saver.OnError = func(err error) {
+			logs.Errorf("auto save failed: %v", err)
+		}
+	}
+
+	if cfg.Metrics.StatsD.Address != "" {
+		exporter, err := metrics.NewStatsD(cache, metrics.StatsDConfig{
+			Address:  cfg.Metrics.StatsD.Address,
+			Prefix:   cfg.Metrics.StatsD.Prefix,
+			Tags:     cfg.Metrics.StatsD.Tags,
+			Interval: time.Duration(cfg.Metrics.StatsD.Interval),
+		})
+		if err != nil {
+			return err
+		}
+		exporter.OnError = func(err error) {
+			logs.Errorf("push statsd metrics failed: %v", err)
+		}
+		exporter.Start()
+		defer exporter.Stop()
+	}
+
+	if cfg.Metrics.OTLP.Endpoint != "" {
+		// 和其他 OpenTelemetry 组件一样，从 OTEL_EXPORTER_OTLP_HEADERS 中读取请求头
+		exporter := metrics.NewOTLP(cache, metrics.OTLPConfig{
+			Endpoint: cfg.Metrics.OTLP.Endpoint,
+			Headers:  parseKeyValues(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS")),
+			Interval: time.Duration(cfg.Metrics.OTLP.Interval),
+		})
+		exporter.OnError = func(err error) {
+			logs.Errorf("push otlp metrics failed: %v", err)
+		}
+		exporter.Start()
+		defer exporter.Stop()
+	}
+
+	if cfg.Memory.DumpThreshold > 0 {
+		dog := watchdog.New(cache, watchdog.Config{Threshold: cfg.Memory.DumpThreshold, Dir: cfg.Memory.DumpDir})
+		dog.OnDump = func(files []string) {
+			logs.Warnf("memory threshold exceeded, wrote %s", strings.Join(files, ", "))
+		}
+		dog.OnError = func(err error) {
+			logs.Errorf("memory watchdog failed: %v", err)
+		}
+		dog.Start()
+		defer dog.Stop()
+	}
+
+	server := servers.NewHTTPServer(cache)
+	var scheduler *backups.Scheduler
+	if cfg.Backup.Schedule != "" {
+		schedule, err := backups.ParseSchedule(cfg.Backup.Schedule)
+		if err != nil {
+			return err
+		}
+
+		var target backups.BackupTarget = backups.NewLocalTarget(cfg.Backup.Dir)
+		if cfg.Backup.S3.Bucket != "" {
+			target = backups.NewS3Target(backups.S3Config{
+				Endpoint:  cfg.Backup.S3.Endpoint,
+				Region:    cfg.Backup.S3.Region,
+				Bucket:    cfg.Backup.S3.Bucket,
+				Prefix:    cfg.Backup.S3.Prefix,
+				AccessKey: os.Getenv("AWS_ACCESS_KEY_ID"),
+				SecretKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			})
+		}
+
+		retention := backups.Retention{Daily: cfg.Backup.KeepDaily, Weekly: cfg.Backup.KeepWeekly}
+		scheduler = backups.NewScheduler(cache, target, schedule, retention)
+		scheduler.OnError = func(err error) {
+			logs.Errorf("scheduled backup failed: %v", err)
+		}
+		server.SetBackups(scheduler)
+	}
+
+	if saver != nil {
+		server.SetSaver(saver)
+	}
+
+	if cfg.Logging.SlowLogThreshold > 0 {
+		reloads.slowLog = servers.NewSlowLog(time.Duration(cfg.Logging.SlowLogThreshold), cfg.Logging.SlowLogSize)
+		server.SetSlowLog(reloads.slowLog)
+	}
+
+	if cfg.Logging.Audit != "" {
+		auditLog, err := audit.Open(cfg.Logging.Audit)
+		if err != nil {
+			return err
+		}
+		defer auditLog.Close()
+		server.SetAudit(auditLog)
+	}
+
+	server.SetAPIKeys(apiKeys)
+	server.SetLegacyStatusCodes(cfg.Listen.LegacyStatusCodes)
+	server.SetDefaultTTL(time.Duration(cfg.Memory.DefaultTTL))
+	server.SetTimeouts(timeoutsOf(cfg.Timeouts))
+	if err = setPolicies(server, resolver, cfg.Auth); err != nil {
+		return err
+	}
+	server.SetTenants(tenants)
+	if cfg.Backend.URL != "" {
+		server.SetBackend(&servers.HTTPBackend{URL: cfg.Backend.URL}, time.Duration(cfg.Backend.TTL), time.Duration(cfg.Backend.Timeout))
+	}
+
+	if cfg.Shadow.URL != "" {
+		server.SetShadow(cfg.Shadow.URL, cfg.Shadow.Percent, time.Duration(cfg.Shadow.Timeout))
+	}
+
+	if cfg.Cluster.Self != "" {
+		server.SetCluster(cluster.New(cfg.Cluster.Self, cfg.Cluster.Replicas, cfg.Cluster.Nodes...))
+	}
+
+	// 副本在预热完成之后才开始复制，避免恢复的数据覆盖掉同步过来的数据
+	var replica *replication.Replica
+	if cfg.Replication.ReplicaOf != "" {
+		apiKey := ""
+		if len(apiKeys) > 0 {
+			apiKey = apiKeys[0]
+		}
+		replica = replication.NewReplica(cache, cfg.Replication.ReplicaOf, apiKey)
+		server.SetReplica(replica)
+	}
+	reloads.server = server
+	server.SetReloader(reloads.Reload)
+
+	// HTTP 服务器可以同时监听 TCP 地址和 Unix socket，还可以另外开启二进制协议的 TCP 服务器和 gRPC 服务器，所有地址都监听成功才会开始处理请求
+	// 由 systemd 通过 socket activation 启动或者通过不停机升级启动时使用传递过来的监听，不再监听配置中的地址
+	var tlsConfig *tls.Config
+	if cfg.TLS.CertFile != "" {
+		if err = loadCertificate(server, resolver, cfg.TLS); err != nil {
+			return err
+		}
+		tlsConfig = server.TLSConfig()
+	}
+
+	serving := endpoints{http: server, tlsConfig: tlsConfig}
+	if cfg.Listen.TCP != "" {
+		tcpServer := servers.NewTCPServer(cache)
+		tcpServer.SetAPIKeys(apiKeys)
+		tcpServer.SetDefaultTTL(time.Duration(cfg.Memory.DefaultTTL))
+		if replica != nil {
+			tcpServer.SetReplica(replica)
+		}
+		reloads.tcpServer = tcpServer
+		serving.tcp, serving.tcpAddress = tcpServer, cfg.Listen.TCP
+	}
+
+	if cfg.Listen.GRPC != "" {
+		grpcServer := servers.NewGRPCServer(cache)
+		grpcServer.SetAPIKeys(apiKeys)
+		grpcServer.SetDefaultTTL(time.Duration(cfg.Memory.DefaultTTL))
+		if replica != nil {
+			grpcServer.SetReplica(replica)
+		}
+		reloads.grpcServer = grpcServer
+		serving.grpc, serving.grpcAddress = grpcServer, cfg.Listen.GRPC
+	}
+
+	activated, err := systemd.Listeners()
+	if err != nil {
+		return fmt.Errorf("use systemd sockets failed: %w", err)
+	}
+
+	if inherited != nil {
+		activated = append(activated, inherited.listeners...)
+	}
+
+	manager := servers.NewManager()
+	serving.addListeners(manager, activated)
+
+	if len(activated) == 0 && cfg.Listen.HTTP != "" {
+		manager.AddTLS("tcp", cfg.Listen.HTTP, server, tlsConfig)
+	}
+
+	if len(activated) == 0 && cfg.Listen.Unix != "" {
+		manager.Add("unix", cfg.Listen.Unix, server)
+	}
+
+	if len(activated) == 0 && cfg.Listen.TCP != "" {
+		manager.Add("tcp", cfg.Listen.TCP, serving.tcp)
+	}
+
+	if len(activated) == 0 && cfg.Listen.GRPC != "" {
+		manager.Add("tcp", cfg.Listen.GRPC, serving.grpc)
+	}
+
+	if err := manager.Start(); err != nil {
+		return err
+	}
+
+	if inherited != nil {
+		if err := inherited.Ready(); err != nil {
+			return fmt.Errorf("notify old process failed: %w", err)
+		}
+	}
+
+	// 预热完成之前 /readyz 返回 503，自动保存和定时备份也要等预热完成之后再开始，避免覆盖掉还没有恢复的数据
+	warmed := make(chan error, 1)
+	if inherited != nil && inherited.snapshot != nil {
+		warmed <- nil
+	} else {
+		server.BeginWarmup(cfg.Warmup.RefuseTraffic)
+		rdbPath := *importRDB
+		if inherited != nil {
+			// 升级时旧的进程已经导入过了
+			rdbPath = ""
+		}
+
+		go func() {
+			warmed <- warmup(cache, cfg, rdbPath, apiKeys)
+		}()
+	}
+
+	// 收到退出信号后先持久化数据再退出，避免丢失上次保存之后的修改
+	// 收到 SIGUSR2 时进行不停机升级，成功后由新的进程负责持久化
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	if upgradeSignal != nil {
+		signal.Notify(signals, upgradeSignal)
+	}
+
+	upgraded, warmedUp := false, false
+	for running := true; running; {
+		select {
+		case err := <-warmed:
+			if err != nil {
+				manager.Shutdown(context.Background())
+				return err
+			}
+
+			warmedUp = true
+			server.EndWarmup()
+			if saver != nil {
+				saver.Start()
+			}
+
+			// 重写 AOF 会用缓存当前的数据覆盖掉旧的操作，所以也要等预热完成之后再开始
+			stopRewrite := cache.AutoRewriteAOF(cfg.Persistence.AOFRewriteSize, func(err error) {
+				logs.Errorf("rewrite aof failed: %v", err)
+			})
+			defer stopRewrite()
+
+			if replica != nil {
+				replica.Start()
+				defer replica.Stop()
+			}
+
+			if scheduler != nil {
+				scheduler.Start()
+			}
+
+			if _, err := systemd.Notify("READY=1"); err != nil {
+				logs.Errorf("notify systemd failed: %v", err)
+			}
+		case err := <-manager.Errors():
+			manager.Shutdown(context.Background())
+			return err
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				if err := reloads.Reload(); err != nil {
+					logs.Errorf("reload config failed: %v", err)
+				}
+				continue
+			}
+
+			if sig == upgradeSignal {
+				if !warmedUp {
+					logs.Warnf("upgrade is not allowed before warm-up finishes")
+					continue
+				}
+
+				next, err := upgrade(manager, serving, cache, saver, options.AOF, cfg.Upgrade)
+				if err == nil {
+					upgraded, running = true, false
+					continue
+				}
+
+				if next == nil {
+					return err
+				}
+				logs.Errorf("upgrade failed: %v", err)
+				manager = next
+				continue
+			}
+
+			logs.Infof("received %s, shutting down", sig)
+			systemd.Notify("STOPPING=1")
+			running = false
+		}
+	}
+
+	// 先停止接收新的请求，等正在处理的请求完成后再持久化，这样持久化的数据包含所有已经响应的修改
+	// 升级成功时服务器已经关闭了
+	if !upgraded {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := manager.Shutdown(ctx); err != nil {
+			logs.Errorf("shutdown servers failed: %v", err)
+		}
+	}
+
+	// 清理和持久化都需要写锁，先停止清理，避免持久化等待一次很大的清理
+	reloads.StopGc()
+
+	if scheduler != nil {
+		scheduler.Stop()
+	}
+
+	if saver != nil {
+		saver.Stop()
+		// 升级成功时由新的进程负责持久化，预热没有完成时持久化会覆盖掉还没有恢复的数据
+		if upgraded || !warmedUp {
+			return nil
+		}
+
+		if err := saver.Save(); err != nil {
+			return fmt.Errorf("save failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// setPolicies 读取 config 中主体的 API key、只读的 API key 和用户的密码，并设置服务器的主体、授权策略和只读凭据
+func setPolicies(server *servers.HTTPServer, resolver secrets.Resolver, config configs.AuthConfig) error {
+	readOnlyKeys, err := resolveAPIKeys(resolver, config.ReadOnlyAPIKeys)
+	if err != nil {
+		return err
+	}
+
+	users := make([]servers.User, 0, len(config.Users))
+	for _, user := range config.Users {
+		password, err := resolveAPIKeys(resolver, []string{user.Password})
+		if err != nil {
+			return err
+		}
+		users = append(users, servers.User{Name: user.Name, Password: password[0], ReadOnly: user.ReadOnly})
+	}
+
+	subjects := make([]servers.Subject, 0, len(config.Subjects))
+	for _, subject := range config.Subjects {
+		apiKeys, err := resolveAPIKeys(resolver, subject.APIKeys)
+		if err != nil {
+			return err
+		}
+		subjects = append(subjects, servers.Subject{Name: subject.Name, APIKeys: apiKeys})
+	}
+
+	policies := make([]servers.Policy, 0, len(config.Policies))
+	for _, policy := range config.Policies {
+		policies = append(policies, servers.Policy{Subject: policy.Subject, Actions: policy.Actions, Keys: policy.Keys})
+	}
+
+	server.SetPolicies(subjects, policies)
+	server.SetReadOnlyAPIKeys(readOnlyKeys)
+	server.SetUsers(users)
+	return nil
+}
+
+// timeoutsOf 返回 config 中各个操作的请求的超时时间
+func timeoutsOf(config configs.TimeoutsConfig) servers.Timeouts {
+	return servers.Timeouts{
+		Read:   time.Duration(config.Read),
+		Write:  time.Duration(config.Write),
+		Delete: time.Duration(config.Delete),
+		Stats:  time.Duration(config.Stats),
+		Admin:  time.Duration(config.Admin),
+	}
+}
+
+// endpoints 是处理请求的服务器，用于将已经监听好的地址交给对应的服务器
+type endpoints struct {
+	// http 是 HTTP 服务器，tlsConfig 不为 nil 时它的 TCP 监听会使用 TLS
+	http      servers.Server
+	tlsConfig *tls.Config
+
+	// tcp 是二进制协议的 TCP 服务器，tcpAddress 是它监听的地址，tcp 为 nil 表示没有开启
+	tcp        servers.Server
+	tcpAddress string
+
+	// grpc 是 gRPC 服务器，grpcAddress 是它监听的地址，grpc 为 nil 表示没有开启
+	grpc        servers.Server
+	grpcAddress string
+}
+
+// addListeners 让对应的服务器在已经监听好的 listeners 上处理请求
+// 端口和 tcpAddress 相同的 TCP 监听交给二进制协议的服务器，和 grpcAddress 相同的交给 gRPC 服务器，其他的都交给 HTTP 服务器
+func (e endpoints) addListeners(manager *servers.Manager, listeners []net.Listener) {
+	for _, listener := range listeners {
+		addr, ok := listener.Addr().(*net.TCPAddr)
+		if !ok {
+			manager.AddListener(listener, e.http, nil)
+			continue
+		}
+
+		if e.tcp != nil && samePort(addr, e.tcpAddress) {
+			manager.AddListener(listener, e.tcp, nil)
+			continue
+		}
+
+		if e.grpc != nil && samePort(addr, e.grpcAddress) {
+			manager.AddListener(listener, e.grpc, nil)
+			continue
+		}
+		manager.AddListener(listener, e.http, e.tlsConfig)
+	}
+}
+
+// samePort 返回 addr 的端口是否和 address 中的端口相同
+func samePort(addr *net.TCPAddr, address string) bool {
+	_, port, err := net.SplitHostPort(address)
+	return err == nil && port == strconv.Itoa(addr.Port)
+}
+
+// parseKeyValues 解析 "k1=v1,k2=v2" 格式的字符串
+func parseKeyValues(s string) map[string]string {
+	values := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		if ok {
+			values[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	return values
+}
+
+// restore 使用持久化文件和 AOF 将数据恢复到 to 指定的时间，并将恢复后的数据持久化
+// 恢复的起点是 DumpDir 中的持久化文件链和 Dump，恢复结果会覆盖它们
+func restore(options caches.Options, to string, persistence configs.PersistenceConfig) error {
+	if persistence.AOF == "" {
+		return errors.New("restore-to requires aof")
+	}
+
+	t, err := time.Parse(time.RFC3339, to)
+	if err != nil {
+		return err
+	}
+
+	var snapshots []string
+	for _, path := range []string{persistence.DumpDir, persistence.Dump} {
+		if path == "" {
+			continue
+		}
+
+		if _, err := os.Stat(path); err == nil {
+			snapshots = append(snapshots, path)
+		}
+	}
+
+	cache := caches.NewCacheWithOptions(options)
+	if err = cache.RestoreToTime(persistence.AOF, t, snapshots...); err != nil {
+		return err
+	}
+	logs.Infof("restored %d keys to %s", cache.Count(), t.Format(time.RFC3339))
+
+	if persistence.DumpDir != "" {
+		return cache.SaveToDir(persistence.DumpDir, persistence.MaxIncrementals)
+	}
+
+	if persistence.Dump != "" {
+		return cache.SaveToFile(persistence.Dump)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package servers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"gocache/audit"
+	"gocache/logs"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// statusRecorder 记录处理器返回的状态码
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader 记录状态码并写入响应
+func (sr *statusRecorder) WriteHeader(code int) {
+	sr.status = code
+	sr.ResponseWriter.WriteHeader(code)
+}
+
+// audited 返回一个会把请求记录到审计日志中的处理器，没有设置审计日志时直接返回 handle
+// target 是操作对象在路由参数中的名字，为空表示没有操作对象
+func (hs *HTTPServer) audited(action string, target string, handle httprouter.Handle) httprouter.Handle {
+	if hs.audit == nil {
+		return handle
+	}
+
+	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		handle(recorder, r, params)
+
+		record := audit.Record{
+			Time:   time.Now(),
+			IP:     clientIP(r),
+			KeyID:  credentialID(r),
+			Action: action,
+			Status: recorder.status,
+		}
+
+		if target != "" {
+			record.Target = params.ByName(target)
+		}
+
+		// 操作已经完成了，写审计日志失败只能记录在服务器日志里
+		if err := hs.audit.Append(record); err != nil {
+			logs.Errorf("append audit record failed: %v", err)
+		}
+	}
+}
+
+// auditHandler 查询审计记录，支持 since、until、ip、key_id、action、target 和 limit 参数
+func (hs *HTTPServer) auditHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	query := r.URL.Query()
+	filter := audit.Filter{
+		IP:     query.Get("ip"),
+		KeyID:  query.Get("key_id"),
+		Action: query.Get("action"),
+		Target: query.Get("target"),
+	}
+
+	var err error
+	if s := query.Get("since"); s != "" {
+		if filter.Since, err = time.Parse(time.RFC3339, s); err != nil {
+			http.Error(w, "invalid since", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if s := query.Get("until"); s != "" {
+		if filter.Until, err = time.Parse(time.RFC3339, s); err != nil {
+			http.Error(w, "invalid until", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if filter.Limit, err = intParam(query.Get("limit"), 100); err != nil {
+		http.Error(w, "invalid limit", http.StatusBadRequest)
+		return
+	}
+
+	records, err := hs.audit.Query(filter)
+	var tampered *audit.TamperError
+	if errors.As(err, &tampered) {
+		writeJSON(w, http.StatusConflict, map[string]interface{}{
+			"error": err.Error(),
+			"seq":   tampered.Seq,
+		})
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"records": records,
+	})
+}
+
+// clientIP 返回请求的客户端地址
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// keyID 返回 API key 的标识，使用 SHA-256 摘要的前 8 个字节，避免把 key 本身写进日志
+func keyID(key string) string {
+	if key == "" {
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+// credentialID 返回请求使用的凭据的标识，使用 API key 时是 keyID，通过 HTTP Basic 认证的用户是 user: 加上用户名
+func credentialID(r *http.Request) string {
+	if key := apiKeyOf(r); key != "" {
+		return keyID(key)
+	}
+
+	if name, _, ok := r.BasicAuth(); ok {
+		return "user:" + name
+	}
+	return ""
+}
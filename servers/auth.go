@@ -0,0 +1,98 @@
+package servers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// User 是使用用户名和密码通过 HTTP Basic 认证访问的用户
+type User struct {
+	Name     string
+	Password string
+
+	// ReadOnly 为 true 时只能读取缓存和查看统计数据，否则和 SetAPIKeys 设置的 API key 一样不受限制
+	ReadOnly bool
+}
+
+// readOnlySubject 是使用只读 API key 的请求的主体
+var readOnlySubject = &Subject{Name: "read-only"}
+
+// readOnlyPolicies 是只读凭据的授权策略，只允许读取和查看统计数据
+var readOnlyPolicies = &policies{rules: []Policy{{Subject: ActionAll, Actions: []string{ActionRead, ActionStats}}}}
+
+// SetReadOnlyAPIKeys 设置只读的 API key，使用它们的请求只能读取缓存和查看统计数据，其他请求返回 403
+// 服务器运行期间也可以调用，用于重新加载配置
+func (hs *HTTPServer) SetReadOnlyAPIKeys(keys []string) {
+	hs.readOnlyAPIKeys.Store(keys)
+}
+
+// SetUsers 设置通过 HTTP Basic 认证访问的用户，只读的用户和只读的 API key 一样只能读取缓存和查看统计数据
+// 服务器运行期间也可以调用，用于重新加载配置
+func (hs *HTTPServer) SetUsers(users []User) {
+	hs.users.Store(users)
+}
+
+// apiKeyOf 返回请求使用的 API key，优先使用 X-API-Key 请求头，没有时使用 Authorization: Bearer 中的 token
+func apiKeyOf(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+
+	const prefix = "Bearer "
+	if authorization := r.Header.Get("Authorization"); len(authorization) > len(prefix) && strings.EqualFold(authorization[:len(prefix)], prefix) {
+		return strings.TrimSpace(authorization[len(prefix):])
+	}
+	return ""
+}
+
+// findUser 返回请求通过 HTTP Basic 认证的用户，没有认证或者用户名密码不对时返回 nil
+// 使用固定时间的比较，避免通过响应时间猜出密码
+func (hs *HTTPServer) findUser(r *http.Request) *User {
+	name, password, ok := r.BasicAuth()
+	if !ok {
+		return nil
+	}
+
+	users, _ := hs.users.Load().([]User)
+	var found *User
+	for i := range users {
+		nameOK := subtle.ConstantTimeCompare([]byte(name), []byte(users[i].Name))
+		passwordOK := subtle.ConstantTimeCompare([]byte(password), []byte(users[i].Password))
+		if nameOK&passwordOK == 1 {
+			found = &users[i]
+		}
+	}
+	return found
+}
+
+// readOnlyKey 返回 key 是否是只读的 API key
+func (hs *HTTPServer) readOnlyKey(key string) bool {
+	if key == "" {
+		return false
+	}
+
+	keys, _ := hs.readOnlyAPIKeys.Load().([]string)
+	ok := false
+	for _, readOnlyKey := range keys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(readOnlyKey)) == 1 {
+			ok = true
+		}
+	}
+	return ok
+}
+
+// hasCredentials 返回是否设置了只读的 API key 或者用户，设置了时没有认证的请求不再被当作管理员
+func (hs *HTTPServer) hasCredentials() bool {
+	keys, _ := hs.readOnlyAPIKeys.Load().([]string)
+	users, _ := hs.users.Load().([]User)
+	return len(keys) > 0 || len(users) > 0
+}
+
+// unauthorized 返回 401，设置了用户时带上 WWW-Authenticate 响应头，让浏览器和 curl 这样的客户端提示输入用户名和密码
+func (hs *HTTPServer) unauthorized(w http.ResponseWriter) {
+	if users, _ := hs.users.Load().([]User); len(users) > 0 {
+		w.Header().Set("WWW-Authenticate", `Basic realm="gocache", charset="UTF-8"`)
+	}
+	w.WriteHeader(http.StatusUnauthorized)
+}
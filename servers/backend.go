@@ -0,0 +1,157 @@
+package servers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultBackendTimeout 是从后端加载一个 key 的默认超时时间
+const defaultBackendTimeout = 10 * time.Second
+
+// Backend 是缓存后面的数据源，GET 没有命中时从后端加载数据并保存到缓存中
+type Backend interface {
+	// Load 加载 key 对应的数据，后端也没有这个 key 时返回 false
+	Load(ctx context.Context, key string) (value []byte, found bool, err error)
+}
+
+// HTTPBackend 是通过 HTTP 访问的后端，GET URL 加上 key 返回 200 时响应体就是数据，返回 404 表示没有这个 key
+type HTTPBackend struct {
+	// URL 是 key 前面的地址，比如 "http://origin:8080/objects/"
+	URL string
+
+	// Client 是访问后端使用的客户端，为 nil 时使用 http.DefaultClient
+	Client *http.Client
+}
+
+// Load 从后端加载 key 对应的数据
+func (hb *HTTPBackend) Load(ctx context.Context, key string) ([]byte, bool, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, hb.URL+url.PathEscape(key), nil)
+	if err != nil {
+		return nil, false, err
+	}
+
+	client := hb.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, false, err
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusOK:
+		value, err := ioutil.ReadAll(response.Body)
+		return value, err == nil, err
+	case http.StatusNotFound:
+		return nil, false, nil
+	}
+
+	message, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+	return nil, false, fmt.Errorf("backend returned %s: %s", response.Status, strings.TrimSpace(string(message)))
+}
+
+// backendLoad 是一次正在进行或者已经完成的加载
+type backendLoad struct {
+	done  chan struct{}
+	value []byte
+	found bool
+	err   error
+}
+
+// coalescer 合并同一个 key 同时进行的加载，同一时间每个 key 只会访问一次后端，其他请求等待并共享结果
+type coalescer struct {
+	backend Backend
+	ttl     time.Duration
+	timeout time.Duration
+
+	lock  sync.Mutex
+	loads map[string]*backendLoad
+
+	// fetches 是访问后端的次数，coalesced 是等待其他请求的加载而没有访问后端的次数，errors 是加载失败的次数
+	// stale 是加载失败时返回过期数据的次数
+	fetches   int64
+	coalesced int64
+	errors    int64
+	stale     int64
+}
+
+// SetBackend 设置后端，GET 没有命中时从 backend 加载数据，保存到缓存中 ttl 之后过期，ttl 为 0 表示永不过期
+// 同一个 key 同时没有命中的请求只会访问一次后端，timeout 是每次加载的超时时间，为 0 时使用 10s
+// 租户的请求不会访问后端
+func (hs *HTTPServer) SetBackend(backend Backend, ttl time.Duration, timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = defaultBackendTimeout
+	}
+	hs.backend = &coalescer{backend: backend, ttl: ttl, timeout: timeout, loads: make(map[string]*backendLoad)}
+}
+
+// load 从后端加载 key 并保存到 cache 中，已经有请求在加载这个 key 时等待它的结果，直到 ctx 结束
+// 加载使用单独的超时时间，发起加载的请求取消了也不会影响其他等待的请求
+func (co *coalescer) load(ctx context.Context, hs *HTTPServer, key string) ([]byte, bool, error) {
+	co.lock.Lock()
+	current, ok := co.loads[key]
+	if !ok {
+		current = &backendLoad{done: make(chan struct{})}
+		co.loads[key] = current
+		go co.fetch(hs, key, current)
+	} else {
+		atomic.AddInt64(&co.coalesced, 1)
+	}
+	co.lock.Unlock()
+
+	select {
+	case <-current.done:
+		return current.value, current.found, current.err
+	case <-ctx.Done():
+		return nil, false, ctx.Err()
+	}
+}
+
+// fetch 访问后端加载 key，完成之后唤醒所有等待的请求
+func (co *coalescer) fetch(hs *HTTPServer, key string, current *backendLoad) {
+	atomic.AddInt64(&co.fetches, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), co.timeout)
+	defer cancel()
+
+	current.value, current.found, current.err = co.backend.Load(ctx, key)
+	if current.err != nil {
+		atomic.AddInt64(&co.errors, 1)
+	} else if current.found {
+		hs.cache.SetWithTTL(key, current.value, co.ttl)
+	}
+
+	co.lock.Lock()
+	delete(co.loads, key)
+	co.lock.Unlock()
+	close(current.done)
+}
+
+// serveStale 记录加载失败时返回了过期 age 的数据，并在响应头中标记
+// X-Stale 是过期了多少秒，Warning 是 RFC 7234 中表示响应已经过期的警告
+func (co *coalescer) serveStale(w http.ResponseWriter, age time.Duration) {
+	atomic.AddInt64(&co.stale, 1)
+	w.Header().Set("X-Stale", strconv.FormatInt(int64(age/time.Second), 10))
+	w.Header().Set("Warning", `110 - "Response is Stale"`)
+}
+
+// stats 返回后端的统计数据
+func (co *coalescer) stats() map[string]int64 {
+	return map[string]int64{
+		"fetches":   atomic.LoadInt64(&co.fetches),
+		"coalesced": atomic.LoadInt64(&co.coalesced),
+		"errors":    atomic.LoadInt64(&co.errors),
+		"stale":     atomic.LoadInt64(&co.stale),
+	}
+}
@@ -0,0 +1,261 @@
+package servers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"gocache/caches"
+	"net/http"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	// batchPath 是批量操作的接口
+	batchPath = "/batch"
+
+	// maxBatchOps 是一次批量操作中最多的操作个数
+	maxBatchOps = 10000
+)
+
+const (
+	// 下面是批量操作中 value 的编码方式，和导出的 NDJSON 一样
+	encodingUTF8   = "utf8"
+	encodingBase64 = "base64"
+)
+
+// batchOp 是批量操作中的一个操作
+type batchOp struct {
+	// Op 是操作的类型，可以是 get、set 或者 delete
+	Op string `json:"op"`
+
+	Key string `json:"key"`
+
+	// Value 是 set 的 value，Encoding 为 base64 时需要先解码，为空时和 utf8 一样
+	Value    string `json:"value,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+
+	// TTL 是 set 的存活时间，格式和 /expire 中的一样，没有时使用默认的过期时间，见 HTTPServer.defaultTTLOf
+	TTL interface{} `json:"ttl,omitempty"`
+}
+
+// batchResult 是批量操作中一个操作的结果
+type batchResult struct {
+	Key string `json:"key"`
+
+	// Status 和单独执行这个操作时的状态码一样，比如 get 找不到 key 时为 404，超出租户的配额时为 507
+	Status int `json:"status"`
+
+	// Value 和 Encoding 是 get 读到的 value 和编码方式，value 是合法的 UTF-8 字符串时为 utf8，否则为 base64
+	Value    string `json:"value,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+
+	// Version 是 get 读到的 value 的版本号
+	Version uint64 `json:"version,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// batchHandler 在一个请求中执行多个操作，请求体是操作的 JSON 数组，比如
+// [{"op": "get", "key": "a"}, {"op": "set", "key": "b", "value": "1", "ttl": "10m"}, {"op": "delete", "key": "c"}]
+// 操作按顺序逐个执行，返回 {"results": [...]}，和请求中的操作一一对应，某个操作失败不影响其他操作
+// 有操作不合法或者没有权限时整个请求返回 400 或者 403，不会执行任何操作
+// 集群模式下其他节点负责的 key 的操作按照节点分组，同时发送给负责的节点执行，同一个 key 的操作仍然按顺序执行
+// 发送失败的操作的状态码是 502
+func (hs *HTTPServer) batchHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if err := readBody(r, buf); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+
+	var ops []batchOp
+	if err := json.Unmarshal(buf.Bytes(), &ops); err != nil {
+		http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(ops) > maxBatchOps {
+		http.Error(w, fmt.Sprintf("too many ops: %d > %d", len(ops), maxBatchOps), http.StatusBadRequest)
+		return
+	}
+
+	// 先检查所有的操作，全部合法之后再执行
+	values := make([][]byte, len(ops))
+	ttls := make([]time.Duration, len(ops))
+	for i, op := range ops {
+		if err := caches.CheckKey(op.Key); err != nil {
+			http.Error(w, fmt.Sprintf("invalid key of op %d: %v", i, err), http.StatusBadRequest)
+			return
+		}
+
+		var action string
+		switch op.Op {
+		case "get":
+			action = ActionRead
+		case "set":
+			action = ActionWrite
+			value, err := decodeValue(op.Value, op.Encoding)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid value of op %d: %v", i, err), http.StatusBadRequest)
+				return
+			}
+
+			ttl := hs.defaultTTLOf(r, op.Key)
+			if op.TTL != nil {
+				ttl, err = jsonTTL(op.TTL)
+			}
+			if err != nil || ttl < 0 {
+				http.Error(w, fmt.Sprintf("invalid ttl of op %d", i), http.StatusBadRequest)
+				return
+			}
+			values[i], ttls[i] = value, ttl
+		case "delete":
+			action = ActionDelete
+		default:
+			http.Error(w, fmt.Sprintf("invalid op %d: %q", i, op.Op), http.StatusBadRequest)
+			return
+		}
+
+		if reason := hs.batchForbidden(r, action, op.Key); reason != "" {
+			writeJSON(w, http.StatusForbidden, map[string]interface{}{
+				"error":  reason,
+				"op":     i,
+				"action": action,
+				"key":    op.Key,
+			})
+			return
+		}
+	}
+
+	keys := make([]string, len(ops))
+	for i, op := range ops {
+		keys[i] = op.Key
+	}
+
+	local, remote := hs.groupKeys(r, keys)
+	results := make([]batchResult, len(ops))
+	var wg sync.WaitGroup
+	for node, indices := range remote {
+		wg.Add(1)
+		go func(node string, indices []int) {
+			defer wg.Done()
+			hs.forwardBatch(r, node, ops, indices, results)
+		}(node, indices)
+	}
+
+	hs.runBatch(r, ops, values, ttls, local, results)
+	wg.Wait()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"results": results,
+	})
+}
+
+// forwardBatch 把 ops 中下标为 indices 的操作发送给 node 执行，结果保存到 results 中对应的位置
+func (hs *HTTPServer) forwardBatch(r *http.Request, node string, ops []batchOp, indices []int, results []batchResult) {
+	sub := make([]batchOp, len(indices))
+	for i, index := range indices {
+		sub[i] = ops[index]
+	}
+
+	var response struct {
+		Results []batchResult `json:"results"`
+	}
+
+	err := hs.cluster.post(r, node, sub, &response)
+	if err == nil && len(response.Results) != len(indices) {
+		err = fmt.Errorf("%s returned %d results for %d ops", node, len(response.Results), len(indices))
+	}
+
+	for i, index := range indices {
+		if err != nil {
+			results[index] = batchResult{Key: ops[index].Key, Status: http.StatusBadGateway, Error: err.Error()}
+			continue
+		}
+		results[index] = response.Results[i]
+	}
+}
+
+// runBatch 在本节点按顺序执行 ops 中下标为 indices 的操作，结果保存到 results 中对应的位置，操作已经检查过了
+func (hs *HTTPServer) runBatch(r *http.Request, ops []batchOp, values [][]byte, ttls []time.Duration, indices []int, results []batchResult) {
+	tenant := tenantFrom(r)
+	for _, i := range indices {
+		op := ops[i]
+		key := op.Key
+		if tenant != nil {
+			key = TenantPrefix(tenant.Name) + key
+		}
+
+		result := &results[i]
+		result.Key, result.Status = op.Key, http.StatusOK
+		switch op.Op {
+		case "get":
+			value, version, ok := hs.cache.GetWithVersion(key)
+			if !ok {
+				result.Status = http.StatusNotFound
+				continue
+			}
+
+			result.Value, result.Encoding = encodeValue(value)
+			result.Version = version
+		case "set":
+			if !hs.legacyStatusCodes {
+				result.Status = http.StatusCreated
+			}
+
+			var err error
+			if tenant == nil {
+				err = hs.cache.TrySet(key, values[i], ttls[i], caches.PriorityNormal)
+			} else {
+				err = hs.cache.SetWithQuota(key, values[i], ttls[i])
+			}
+
+			if invalidWrite(err) {
+				result.Status, result.Error = http.StatusBadRequest, err.Error()
+			} else if err != nil {
+				result.Status, result.Error = http.StatusInsufficientStorage, err.Error()
+			}
+		case "delete":
+			if !hs.legacyStatusCodes {
+				result.Status = http.StatusNoContent
+			}
+			hs.cache.Delete(key)
+		}
+	}
+}
+
+// batchForbidden 返回批量操作中对 key 执行 action 不被允许的原因，允许时返回空字符串
+// 只读的副本不能修改缓存，使用主体 API key 的请求需要被策略允许
+func (hs *HTTPServer) batchForbidden(r *http.Request, action string, key string) string {
+	if action != ActionRead && hs.replica != nil && hs.replica.ReadOnly() {
+		return "read only replica"
+	}
+
+	if auth := authorizationFrom(r); auth != nil && !auth.policies.allowed(auth.subject.Name, action, key) {
+		return "forbidden"
+	}
+	return ""
+}
+
+// encodeValue 返回 value 在 JSON 中的表示和编码方式
+func encodeValue(value []byte) (string, string) {
+	if utf8.Valid(value) {
+		return string(value), encodingUTF8
+	}
+	return base64.StdEncoding.EncodeToString(value), encodingBase64
+}
+
+// decodeValue 按照编码方式解码 JSON 中的 value，encoding 为空时和 utf8 一样
+func decodeValue(value string, encoding string) ([]byte, error) {
+	switch encoding {
+	case "", encodingUTF8:
+		return []byte(value), nil
+	case encodingBase64:
+		return base64.StdEncoding.DecodeString(value)
+	}
+	return nil, fmt.Errorf("unknown encoding %q", encoding)
+}
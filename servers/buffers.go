@@ -0,0 +1,119 @@
+package servers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"gocache/caches"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+)
+
+// maxPooledBuffer 是放回池中的缓冲区的最大容量，更大的缓冲区直接丢弃，避免偶尔的大请求一直占用内存
+const maxPooledBuffer = 1 << 20
+
+// bufferPool 缓存读取请求体和编码响应使用的缓冲区，减少每个请求的内存分配
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// getBuffer 从池中取出一个空的缓冲区，用完之后需要调用 putBuffer 放回
+func getBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+// putBuffer 将 buf 放回池中，调用之后不能再使用 buf 和它返回过的切片
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBuffer {
+		return
+	}
+
+	buf.Reset()
+	bufferPool.Put(buf)
+}
+
+// readBody 将请求体读取到 buf 中，知道请求体的长度时一次分配足够的空间，不需要像 ioutil.ReadAll 那样反复扩容
+// 请求体有 gzip 或者 snappy 的 Content-Encoding 时读取解压之后的数据，客户端可以上传压缩过的大 value
+// 不支持的 Content-Encoding 和解压失败返回 *bodyError
+func readBody(r *http.Request, buf *bytes.Buffer) error {
+	body, err := bodyReader(r)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	if body == r.Body && r.ContentLength > 0 {
+		// ReadFrom 在剩余空间不足 512 字节时会扩容，多留一些避免读到末尾时再扩容一次
+		buf.Grow(int(r.ContentLength) + bytes.MinRead)
+	}
+
+	_, err = buf.ReadFrom(body)
+	return err
+}
+
+// bodyReader 返回读取解压之后的请求体的 io.ReadCloser，没有 Content-Encoding 时返回 r.Body
+// gzip 边读取边解压，解压失败时读取返回 *bodyError，Snappy 的块格式需要整块解压，会先读取整个请求体，解压出的数据不能超过 caches.MaxDecompressedSize
+// 不支持的 Content-Encoding 和 Snappy 解压失败返回 *bodyError
+func bodyReader(r *http.Request) (io.ReadCloser, error) {
+	switch encoding := r.Header.Get("Content-Encoding"); encoding {
+	case "", "identity":
+		return r.Body, nil
+	case "gzip":
+		reader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return nil, &bodyError{status: http.StatusBadRequest, err: err}
+		}
+		return gzipBody{reader}, nil
+	case "snappy":
+		compressed, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := caches.CompressionSnappy.Decompress(compressed)
+		if err != nil {
+			return nil, &bodyError{status: http.StatusBadRequest, err: err}
+		}
+		return ioutil.NopCloser(bytes.NewReader(value)), nil
+	default:
+		return nil, &bodyError{status: http.StatusUnsupportedMediaType, err: fmt.Errorf("unsupported content encoding %q", encoding)}
+	}
+}
+
+// gzipBody 读取 gzip 压缩的请求体，读取失败时返回 400 的 *bodyError
+type gzipBody struct {
+	*gzip.Reader
+}
+
+func (gb gzipBody) Read(p []byte) (int, error) {
+	n, err := gb.Reader.Read(p)
+	if err != nil && err != io.EOF {
+		err = &bodyError{status: http.StatusBadRequest, err: err}
+	}
+	return n, err
+}
+
+// bodyError 是请求体的编码错误，status 是需要返回的状态码
+type bodyError struct {
+	status int
+	err    error
+}
+
+func (be *bodyError) Error() string {
+	return be.err.Error()
+}
+
+// writeBodyError 返回 readBody 的错误，请求体的编码错误返回对应的状态码，其他错误返回 500
+func writeBodyError(w http.ResponseWriter, err error) {
+	var bodyErr *bodyError
+	if errors.As(err, &bodyErr) {
+		http.Error(w, bodyErr.Error(), bodyErr.status)
+		return
+	}
+	w.WriteHeader(http.StatusInternalServerError)
+}
@@ -0,0 +1,273 @@
+package servers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"gocache/cluster"
+	"gocache/logs"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// forwardedHeader 标记请求是其他节点转发过来的，值是转发的节点的地址，收到这样的请求时总是在本节点处理，避免节点列表不一致时来回转发
+// 只有来自集群中其他节点的标记才有效，见 trusted，客户端带上的标记会被去掉，否则可以绕过路由把 key 写到不负责它的节点上
+const forwardedHeader = "X-Gocache-Forwarded"
+
+// peerResolveInterval 是缓存节点主机名解析结果的时间，过期之后在后台重新解析，验证转发的请求时不需要等待 DNS
+const peerResolveInterval = 30 * time.Second
+
+// peerAddrs 是节点主机名解析出的地址
+type peerAddrs struct {
+	ips        []net.IP
+	resolvedAt time.Time
+
+	// refreshing 为 1 表示正在后台重新解析
+	refreshing int32
+}
+
+// clusterRouter 把 key 不由本节点负责的请求转发给负责的节点
+type clusterRouter struct {
+	cluster *cluster.Cluster
+
+	// proxies 是每个节点的反向代理，类型是 map[string]*httputil.ReverseProxy
+	proxies sync.Map
+
+	// peers 是节点主机名解析出的地址，类型是 map[string]*peerAddrs，见 peerIPs
+	peers sync.Map
+
+	// client 是把批量操作中的 key 分组发送给负责的节点时使用的客户端
+	client http.Client
+
+	// forwarded 是转发的请求数，errors 是其中转发失败的次数
+	forwarded int64
+	errors    int64
+}
+
+// SetCluster 开启集群模式，/cache/:key 等接口中 key 不由本节点负责的请求会被转发给负责的节点
+// /batch、/expire 和 /expireat 这样包含多个 key 的请求中的 key 按照负责的节点分组，分别发送给负责的节点之后合并结果
+// 节点之间转发请求时会带上原来的 API key，所以所有节点需要使用相同的认证配置
+// 节点地址中的主机需要是节点发出请求时的来源地址，否则转发过来的请求会被当作客户端的请求再次按照 key 转发
+func (hs *HTTPServer) SetCluster(c *cluster.Cluster) {
+	hs.cluster = &clusterRouter{cluster: c}
+}
+
+// forward 在 r 中的 key 由其他节点负责时把请求转发过去并返回 true，由本节点处理时返回 false
+// routed 是 routeNamespace 改写之后的 r，使用其中的 key 选择节点，转发的是原来的 r，负责的节点同样按照命名空间检查配额和使用默认的过期时间
+func (cr *clusterRouter) forward(w http.ResponseWriter, r *http.Request, routed *http.Request) bool {
+	if !keyedPath(routed.URL.Path) || r.Header.Get(forwardedHeader) != "" {
+		return false
+	}
+
+	// 使用租户的命名空间前缀之前的 key，这样客户端不需要知道前缀也可以直接访问负责的节点
+	key := pathKey(routed.URL.Path)
+	node, local := cr.cluster.PickNode(key)
+	if local || node == "" {
+		return false
+	}
+
+	proxy, err := cr.proxy(node)
+	if err != nil {
+		http.Error(w, "invalid node "+node+": "+err.Error(), http.StatusBadGateway)
+		return true
+	}
+
+	atomic.AddInt64(&cr.forwarded, 1)
+	r.Header.Set(forwardedHeader, cr.cluster.Self())
+	proxy.ServeHTTP(w, r)
+	return true
+}
+
+// trusted 返回 r 是否是集群中的其他节点转发过来的，forwardedHeader 中的节点需要在节点列表中，并且请求的来源地址是这个节点的地址
+func (cr *clusterRouter) trusted(r *http.Request) bool {
+	sender := r.Header.Get(forwardedHeader)
+	known := false
+	for _, node := range cr.cluster.Nodes() {
+		known = known || node == sender && node != cr.cluster.Self()
+	}
+
+	if !known {
+		return false
+	}
+
+	target, err := url.Parse(sender)
+	if err != nil {
+		return false
+	}
+
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+
+	remoteIP := net.ParseIP(remote)
+	if ip := net.ParseIP(target.Hostname()); ip != nil {
+		return ip.Equal(remoteIP)
+	}
+
+	for _, ip := range cr.peerIPs(target.Hostname()) {
+		if ip.Equal(remoteIP) {
+			return true
+		}
+	}
+	return false
+}
+
+// peerIPs 返回节点主机名 host 解析出的地址，第一次使用时解析，之后使用缓存的结果
+// 结果超过 peerResolveInterval 之后仍然先返回缓存的结果，同时在后台重新解析，这样节点地址的变化最多延迟一个间隔生效
+func (cr *clusterRouter) peerIPs(host string) []net.IP {
+	if cached, ok := cr.peers.Load(host); ok {
+		addrs := cached.(*peerAddrs)
+		if time.Since(addrs.resolvedAt) > peerResolveInterval && atomic.CompareAndSwapInt32(&addrs.refreshing, 0, 1) {
+			go cr.resolvePeer(host, addrs.ips)
+		}
+		return addrs.ips
+	}
+	return cr.resolvePeer(host, nil)
+}
+
+// resolvePeer 解析节点主机名 host 并缓存结果，解析失败时保留上一次的结果 previous
+// 不使用请求的 context，客户端取消请求不会让节点在一个间隔内都不被信任
+func (cr *clusterRouter) resolvePeer(host string, previous []net.IP) []net.IP {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ips := previous
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		logs.Debugf("resolving cluster node %s failed: %v", host, err)
+	} else {
+		ips = make([]net.IP, 0, len(addrs))
+		for _, addr := range addrs {
+			ips = append(ips, addr.IP)
+		}
+	}
+
+	cr.peers.Store(host, &peerAddrs{ips: ips, resolvedAt: time.Now()})
+	return ips
+}
+
+// groupKeys 把 keys 按照负责的节点分组，返回本节点负责的 key 的下标和其他节点负责的 key 的下标
+// 没有开启集群模式或者请求是其他节点转发过来的时所有的 key 都由本节点负责，和 forward 一样使用租户的命名空间前缀之前的 key
+func (hs *HTTPServer) groupKeys(r *http.Request, keys []string) (local []int, remote map[string][]int) {
+	if hs.cluster == nil || r.Header.Get(forwardedHeader) != "" {
+		local = make([]int, len(keys))
+		for i := range local {
+			local[i] = i
+		}
+		return local, nil
+	}
+
+	remote = make(map[string][]int)
+	for i, key := range keys {
+		if node, isLocal := hs.cluster.cluster.PickNode(key); isLocal || node == "" {
+			local = append(local, i)
+		} else {
+			remote[node] = append(remote[node], i)
+		}
+	}
+	return local, remote
+}
+
+// post 把 body 编码成 JSON 作为请求体，以 r 的方法和路径发送给 node，响应的 JSON 解码到 result 中
+// 带上 r 的请求头，认证信息和原来的请求一样，node 收到之后总是在本地处理，不会再转发
+func (cr *clusterRouter) post(r *http.Request, node string, body interface{}, result interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequestWithContext(r.Context(), r.Method, strings.TrimSuffix(node, "/")+r.URL.RequestURI(), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	// 请求体已经解压过了，重新编码成 JSON 发送
+	request.Header = r.Header.Clone()
+	request.Header.Del("Content-Encoding")
+	request.Header.Del("Content-Length")
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(forwardedHeader, cr.cluster.Self())
+
+	atomic.AddInt64(&cr.forwarded, 1)
+	response, err := cr.client.Do(request)
+	if err != nil {
+		atomic.AddInt64(&cr.errors, 1)
+		logs.Warnf("forward %s %s to %s failed: %v", r.Method, r.URL.Path, node, err)
+		return fmt.Errorf("forward to %s failed", node)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		atomic.AddInt64(&cr.errors, 1)
+		message, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+		return fmt.Errorf("%s returned %s: %s", node, response.Status, strings.TrimSpace(string(message)))
+	}
+	return json.NewDecoder(response.Body).Decode(result)
+}
+
+// proxy 返回转发到 node 的反向代理
+func (cr *clusterRouter) proxy(node string) (*httputil.ReverseProxy, error) {
+	if proxy, ok := cr.proxies.Load(node); ok {
+		return proxy.(*httputil.ReverseProxy), nil
+	}
+
+	target, err := url.Parse(node)
+	if err != nil {
+		return nil, err
+	}
+
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		atomic.AddInt64(&cr.errors, 1)
+		logs.Warnf("forward %s %s to %s failed: %v", r.Method, r.URL.Path, node, err)
+		http.Error(w, "forward to "+node+" failed", http.StatusBadGateway)
+	}
+
+	actual, _ := cr.proxies.LoadOrStore(node, proxy)
+	return actual.(*httputil.ReverseProxy), nil
+}
+
+// clusterNodesHandler 返回集群中的所有节点，客户端可以用来直接把请求发送到负责 key 的节点
+func (hs *HTTPServer) clusterNodesHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"self":      hs.cluster.cluster.Self(),
+		"nodes":     hs.cluster.cluster.Nodes(),
+		"replicas":  hs.cluster.cluster.Replicas(),
+		"forwarded": atomic.LoadInt64(&hs.cluster.forwarded),
+		"errors":    atomic.LoadInt64(&hs.cluster.errors),
+	})
+}
+
+// setClusterNodesHandler 替换本节点的节点列表，请求体是 {"nodes": [...]}，增减节点时需要对每个节点调用
+func (hs *HTTPServer) setClusterNodesHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	var body struct {
+		Nodes []string `json:"nodes"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for _, node := range body.Nodes {
+		if _, err := url.Parse(node); err != nil || !strings.HasPrefix(node, "http://") && !strings.HasPrefix(node, "https://") {
+			http.Error(w, "invalid node "+node, http.StatusBadRequest)
+			return
+		}
+	}
+
+	hs.cluster.cluster.SetNodes(body.Nodes...)
+	hs.clusterNodesHandler(w, r, params)
+}
@@ -0,0 +1,164 @@
+package servers
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gocache/caches"
+	"gocache/cluster"
+)
+
+func TestForwardKeepsNamespace(t *testing.T) {
+	var nodeCaches [2]*caches.Cache
+	var servers [2]*httptest.Server
+	var handlers [2]http.Handler
+	for i := range servers {
+		i := i
+		options := caches.DefaultOptions()
+		options.Namespaces = []caches.Namespace{{Name: "ns", DefaultTTL: time.Minute, MaxKeys: 1}}
+		nodeCaches[i] = caches.NewCacheWithOptions(options)
+		servers[i] = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handlers[i].ServeHTTP(w, r)
+		}))
+		defer servers[i].Close()
+	}
+
+	var ring *cluster.Cluster
+	for i := range servers {
+		hs := NewHTTPServer(nodeCaches[i])
+		c := cluster.New(servers[i].URL, 0, servers[0].URL, servers[1].URL)
+		hs.SetCluster(c)
+		handlers[i] = hs.handler()
+		ring = c
+	}
+
+	// 找出两个由第二个节点负责的 key，请求都发送给第一个节点
+	namespace := nodeCaches[0].Namespace("ns")
+	var keys []string
+	for i := 0; len(keys) < 2; i++ {
+		key := fmt.Sprintf("k%d", i)
+		if node, _ := ring.PickNode(namespace.Key(key)); node == servers[1].URL {
+			keys = append(keys, key)
+		}
+	}
+
+	put := func(key string) int {
+		request, _ := http.NewRequest(http.MethodPut, servers[0].URL+"/cache/ns/"+key, strings.NewReader("v"))
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		return response.StatusCode
+	}
+
+	if code := put(keys[0]); code != http.StatusCreated {
+		t.Fatalf("PUT /cache/ns/%s = %d", keys[0], code)
+	}
+
+	if nodeCaches[0].Count() != 0 {
+		t.Fatal("forwarded key is stored on the first node")
+	}
+
+	if ttl, ok := nodeCaches[1].TTL(namespace.Key(keys[0])); !ok || ttl <= 0 || ttl > time.Minute {
+		t.Fatalf("TTL on owner = %v, %v, want the namespace default", ttl, ok)
+	}
+
+	if code := put(keys[1]); code != http.StatusInsufficientStorage {
+		t.Fatalf("PUT over namespace quota = %d, want 507", code)
+	}
+}
+
+func TestForwardedHeaderFromClientIgnored(t *testing.T) {
+	var nodeCaches [2]*caches.Cache
+	var servers [2]*httptest.Server
+	var handlers [2]http.Handler
+	for i := range servers {
+		i := i
+		nodeCaches[i] = caches.NewCache()
+		servers[i] = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handlers[i].ServeHTTP(w, r)
+		}))
+		defer servers[i].Close()
+	}
+
+	var ring *cluster.Cluster
+	for i := range servers {
+		hs := NewHTTPServer(nodeCaches[i])
+		ring = cluster.New(servers[i].URL, 0, servers[0].URL, servers[1].URL)
+		hs.SetCluster(ring)
+		handlers[i] = hs.handler()
+	}
+
+	// 找出两个由第二个节点负责的 key
+	var keys []string
+	for i := 0; len(keys) < 2; i++ {
+		key := fmt.Sprintf("k%d", i)
+		if node, _ := ring.PickNode(key); node == servers[1].URL {
+			keys = append(keys, key)
+		}
+	}
+
+	// 客户端伪造的标记被去掉，请求仍然转发给负责的节点，httptest.NewRequest 的来源地址是 192.0.2.1
+	for _, sender := range []string{"anything", servers[1].URL} {
+		for _, request := range []*http.Request{
+			httptest.NewRequest(http.MethodPut, "/cache/"+keys[0], strings.NewReader("v")),
+			httptest.NewRequest(http.MethodPost, batchPath, strings.NewReader(`[{"op":"set","key":"`+keys[1]+`","value":"v"}]`)),
+		} {
+			request.Header.Set(forwardedHeader, sender)
+			w := httptest.NewRecorder()
+			handlers[0].ServeHTTP(w, request)
+			if w.Code >= http.StatusBadRequest {
+				t.Fatalf("%s %s from %s = %d", request.Method, request.URL.Path, sender, w.Code)
+			}
+		}
+
+		if nodeCaches[0].Count() != 0 || nodeCaches[1].Count() != 2 {
+			t.Fatalf("sender %q: counts = %d and %d, want the keys only on the owner", sender, nodeCaches[0].Count(), nodeCaches[1].Count())
+		}
+		nodeCaches[1].Delete(keys[0])
+		nodeCaches[1].Delete(keys[1])
+	}
+
+	// 来自集群中其他节点的地址的转发在本节点处理
+	request, _ := http.NewRequest(http.MethodPut, servers[0].URL+"/cache/"+keys[0], strings.NewReader("v"))
+	request.Header.Set(forwardedHeader, servers[1].URL)
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+
+	if _, ok := nodeCaches[0].Get(keys[0]); !ok {
+		t.Fatalf("PUT forwarded by a peer = %d, key is not stored locally", response.StatusCode)
+	}
+}
+
+func TestTrustedCachesPeerAddresses(t *testing.T) {
+	cr := &clusterRouter{cluster: cluster.New("http://127.0.0.1:1", 0, "http://127.0.0.1:1", "http://localhost:2")}
+	request := func(remote string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/cache/k", nil)
+		r.RemoteAddr = remote
+		r.Header.Set(forwardedHeader, "http://localhost:2")
+		return r
+	}
+
+	if !cr.trusted(request("127.0.0.1:5000")) {
+		t.Fatal("request from localhost is not trusted")
+	}
+
+	if cr.trusted(request("10.0.0.1:5000")) {
+		t.Fatal("request from another address is trusted")
+	}
+
+	// 缓存的结果没有过期时不会再次解析，节点的地址以缓存的为准
+	cr.peers.Store("localhost", &peerAddrs{ips: []net.IP{net.ParseIP("10.0.0.1")}, resolvedAt: time.Now()})
+	if cr.trusted(request("127.0.0.1:5000")) || !cr.trusted(request("10.0.0.1:5000")) {
+		t.Fatal("trusted resolved the node again instead of using the cached addresses")
+	}
+}
@@ -0,0 +1,73 @@
+package servers
+
+import (
+	"errors"
+	"gocache/caches"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// incrHandler 原子地把 key 的 value 加上请求体中的整数，请求体为空时加 1，返回加上之后的值
+// key 不存在时从 0 开始加，过期时间和没有指定过期时间的写入一样，见 defaultTTLOf，请求体不是整数时返回 400，value 不是整数或者结果溢出时返回 409
+func (hs *HTTPServer) incrHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	hs.counterHandler(w, r, params.ByName("key"), 1)
+}
+
+// decrHandler 原子地把 key 的 value 减去请求体中的整数，其他和 incrHandler 一样
+func (hs *HTTPServer) decrHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	hs.counterHandler(w, r, params.ByName("key"), -1)
+}
+
+// counterHandler 把 key 的 value 加上 sign 乘以请求体中的整数
+func (hs *HTTPServer) counterHandler(w http.ResponseWriter, r *http.Request, key string, sign int64) {
+	start := time.Now()
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if err := readBody(r, buf); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+
+	delta := int64(1)
+	if body := strings.TrimSpace(buf.String()); body != "" {
+		var err error
+		if delta, err = strconv.ParseInt(body, 10, 64); err != nil {
+			http.Error(w, "invalid delta "+strconv.Quote(body), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if sign < 0 {
+		if delta == math.MinInt64 {
+			http.Error(w, caches.ErrOverflow.Error(), http.StatusConflict)
+			return
+		}
+		delta = -delta
+	}
+
+	increment := hs.cache.Increment
+	if quotaChecked(r) {
+		increment = hs.cache.IncrementWithQuota
+	}
+
+	value, err := increment(key, delta, hs.defaultTTLOf(r, key))
+	var quotaErr *caches.QuotaError
+	switch {
+	case errors.As(err, &quotaErr):
+		writeQuotaError(w, r, err)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	result := strconv.FormatInt(value, 10)
+	hs.observe(&hs.setLatency, "incr", r, key, len(result), start)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(result))
+}
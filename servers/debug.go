@@ -0,0 +1,71 @@
+package servers
+
+import (
+	"gocache/logs"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// logLevelHandler 返回当前的日志级别
+func (hs *HTTPServer) logLevelHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"level": logs.GetLevel().String(),
+	})
+}
+
+// setLogLevelHandler 修改日志级别，level 参数是新的级别，重启或者配置文件中的级别变化之后会被覆盖
+func (hs *HTTPServer) setLogLevelHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	level, err := logs.ParseLevel(r.URL.Query().Get("level"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	logs.SetLevel(level)
+	logs.Infof("log level changed to %s", level)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"level": level.String(),
+	})
+}
+
+// tracedKeysHandler 返回所有打开了调试日志的 key 和调试日志的关闭时间，不会自动关闭的 key 对应 null
+func (hs *HTTPServer) tracedKeysHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	keys := make(map[string]*time.Time)
+	for key, until := range logs.TracedKeys() {
+		if until.IsZero() {
+			keys[key] = nil
+			continue
+		}
+
+		until := until
+		keys[key] = &until
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": keys,
+	})
+}
+
+// traceKeyHandler 打开 key 的调试日志，之后这个 key 上的所有操作都会输出到服务器日志中
+// ttl 参数是调试日志自动关闭的时间，比如 "10m"，默认不会自动关闭
+func (hs *HTTPServer) traceKeyHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	var ttl time.Duration
+	if value := r.URL.Query().Get("ttl"); value != "" {
+		var err error
+		if ttl, err = time.ParseDuration(value); err != nil || ttl < 0 {
+			http.Error(w, "invalid ttl", http.StatusBadRequest)
+			return
+		}
+	}
+
+	logs.TraceKey(params.ByName("key"), ttl)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// untraceKeyHandler 关闭 key 的调试日志
+func (hs *HTTPServer) untraceKeyHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	logs.UntraceKey(params.ByName("key"))
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,45 @@
+package servers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// etag 返回版本号对应的强 ETag，比如 "1234"
+func etag(version uint64) string {
+	return `"` + strconv.FormatUint(version, 10) + `"`
+}
+
+// etagMatches 返回 If-Match 或者 If-None-Match 请求头中逗号分隔的 ETag 是否匹配版本号为 version 的 key
+// "*" 匹配任何存在的 key，不存在的 key 不匹配任何 ETag；使用强比较，W/ 开头的弱 ETag 不会匹配
+func etagMatches(header string, version uint64, exists bool) bool {
+	if !exists {
+		return false
+	}
+
+	tag := etag(version)
+	for _, candidate := range strings.Split(header, ",") {
+		if candidate = strings.TrimSpace(candidate); candidate == "*" || candidate == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// preconditions 返回 PUT 请求中 If-Match 和 If-None-Match 请求头的条件，两个都有时需要同时满足，都没有时返回 nil
+// If-Match 要求 key 存在并且版本号匹配，If-None-Match 要求 key 不存在或者版本号不匹配，"*" 匹配任何存在的 key
+func preconditions(r *http.Request) func(version uint64, exists bool) bool {
+	ifMatch, hasMatch := r.Header["If-Match"]
+	ifNoneMatch, hasNoneMatch := r.Header["If-None-Match"]
+	if !hasMatch && !hasNoneMatch {
+		return nil
+	}
+
+	return func(version uint64, exists bool) bool {
+		if hasMatch && !etagMatches(strings.Join(ifMatch, ","), version, exists) {
+			return false
+		}
+		return !hasNoneMatch || !etagMatches(strings.Join(ifNoneMatch, ","), version, exists)
+	}
+}
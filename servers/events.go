@@ -0,0 +1,104 @@
+package servers
+
+import (
+	"encoding/json"
+	"fmt"
+	"gocache/caches"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	// eventsBuffer 是每个事件流的缓冲区大小，客户端跟不上事件的速度导致缓冲区写满时事件流会被关闭
+	eventsBuffer = 1024
+
+	// eventsPingInterval 是事件流没有事件时发送注释的间隔，避免连接被代理当作空闲连接关闭
+	eventsPingInterval = 15 * time.Second
+)
+
+// eventsHandler 以 Server-Sent Events 的格式推送键空间事件，直到客户端断开连接
+// types 是逗号分隔的事件类型，为空时推送所有类型，pattern 和 namespace 和遍历 key 时一样用于过滤 key
+// 客户端跟不上事件的速度时会收到一个 overflow 事件，之后连接被关闭，中间的事件已经丢失，需要重新连接
+func (hs *HTTPServer) eventsHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	query := r.URL.Query()
+	types := make(map[string]bool)
+	for _, t := range strings.Split(query.Get("types"), ",") {
+		switch t {
+		case "":
+		case caches.EventSet, caches.EventDelete, caches.EventExpire, caches.EventEvict:
+			types[t] = true
+		default:
+			http.Error(w, "unknown event type "+t, http.StatusBadRequest)
+			return
+		}
+	}
+
+	prefix := ""
+	if t := tenantFrom(r); t != nil {
+		prefix = TenantPrefix(t.Name)
+	}
+
+	if name := query.Get("namespace"); name != "" {
+		if !hs.cache.HasNamespace(name) {
+			http.Error(w, "namespace not found", http.StatusNotFound)
+			return
+		}
+		prefix += hs.cache.Namespace(name).Key("")
+	}
+	pattern := query.Get("pattern")
+
+	sub := hs.cache.SubscribeEvents(eventsBuffer)
+	defer hs.cache.UnsubscribeEvents(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(eventsPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case event, ok := <-sub.Events():
+			if !ok {
+				fmt.Fprint(w, "event: overflow\ndata: {}\n\n")
+				flusher.Flush()
+				return
+			}
+
+			if len(types) > 0 && !types[event.Type] || !strings.HasPrefix(event.Key, prefix) {
+				continue
+			}
+
+			event.Key = event.Key[len(prefix):]
+			if pattern != "" && !caches.MatchGlob(pattern, event.Key) {
+				continue
+			}
+
+			data, err := json.Marshal(event)
+			if err != nil {
+				return
+			}
+
+			if _, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
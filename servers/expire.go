@@ -0,0 +1,213 @@
+package servers
+
+import (
+	"encoding/json"
+	"fmt"
+	"gocache/caches"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// expireHandler 批量修改 key 的过期时间，请求体是 key 到存活时间的 JSON 对象，比如 {"a": "10m", "b": 3600, "c": 0}
+// 存活时间可以是时间间隔字符串或者秒数，为 0 表示永不过期，返回修改了的 key 的个数，不存在或者已经过期的 key 会被忽略
+func (hs *HTTPServer) expireHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if err := readBody(r, buf); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &body); err != nil {
+		http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ttls := make(map[string]time.Duration, len(body))
+	for key, value := range body {
+		if err := caches.CheckKey(key); err != nil {
+			http.Error(w, fmt.Sprintf("invalid key %q: %v", key, err), http.StatusBadRequest)
+			return
+		}
+
+		ttl, err := jsonTTL(value)
+		if err != nil || ttl < 0 {
+			http.Error(w, fmt.Sprintf("invalid ttl of %q", key), http.StatusBadRequest)
+			return
+		}
+		ttls[key] = ttl
+	}
+
+	hs.expireMulti(w, r, body, func(local map[string]bool) int {
+		for key := range ttls {
+			if !local[key] {
+				delete(ttls, key)
+			}
+		}
+		return hs.cache.ExpireMulti(ttls)
+	})
+}
+
+// expireAtHandler 批量修改 key 的过期时间点，请求体是 key 到过期时间点的 JSON 对象，比如 {"a": "2030-01-01T00:00:00Z", "b": 1893456000}
+// 时间点可以是 RFC3339 格式的字符串或者 Unix 时间戳的秒数，已经过去的时间点会让 key 立即过期，返回修改了的 key 的个数
+func (hs *HTTPServer) expireAtHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if err := readBody(r, buf); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &body); err != nil {
+		http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	times := make(map[string]time.Time, len(body))
+	for key, value := range body {
+		if err := caches.CheckKey(key); err != nil {
+			http.Error(w, fmt.Sprintf("invalid key %q: %v", key, err), http.StatusBadRequest)
+			return
+		}
+
+		at, err := jsonTime(value)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid time of %q", key), http.StatusBadRequest)
+			return
+		}
+		times[key] = at
+	}
+
+	hs.expireMulti(w, r, body, func(local map[string]bool) int {
+		for key := range times {
+			if !local[key] {
+				delete(times, key)
+			}
+		}
+		return hs.cache.ExpireAtMulti(times)
+	})
+}
+
+// expireMulti 修改 body 中的 key 的过期时间并返回修改了的 key 的总数，本节点负责的 key 调用 apply 修改
+// 集群模式下其他节点负责的 key 按照节点分组，同时以原来的请求发送给负责的节点，有节点失败时返回 502 和修改了的 key 的个数
+func (hs *HTTPServer) expireMulti(w http.ResponseWriter, r *http.Request, body map[string]interface{}, apply func(local map[string]bool) int) {
+	keys := make([]string, 0, len(body))
+	for key := range body {
+		keys = append(keys, key)
+	}
+
+	localKeys, remote := hs.groupKeys(r, keys)
+	local := make(map[string]bool, len(localKeys))
+	for _, i := range localKeys {
+		local[keys[i]] = true
+	}
+
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	var errs []string
+	updated := 0
+	for node, indices := range remote {
+		sub := make(map[string]interface{}, len(indices))
+		for _, i := range indices {
+			sub[keys[i]] = body[keys[i]]
+		}
+
+		wg.Add(1)
+		go func(node string, sub map[string]interface{}) {
+			defer wg.Done()
+			var response struct {
+				Updated int `json:"updated"`
+			}
+			err := hs.cluster.post(r, node, sub, &response)
+
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				errs = append(errs, err.Error())
+				return
+			}
+			updated += response.Updated
+		}(node, sub)
+	}
+
+	localUpdated := apply(local)
+	wg.Wait()
+	updated += localUpdated
+	if len(errs) > 0 {
+		writeJSON(w, http.StatusBadGateway, map[string]interface{}{
+			"updated": updated,
+			"error":   strings.Join(errs, "; "),
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"updated": updated,
+	})
+}
+
+// jsonTime 解析 JSON 中的时间点，数字是 Unix 时间戳的秒数，字符串和 parseTime 的格式一样
+func jsonTime(value interface{}) (time.Time, error) {
+	switch v := value.(type) {
+	case float64:
+		return time.Unix(0, int64(v*float64(time.Second))), nil
+	case string:
+		return parseTime(v)
+	}
+	return time.Time{}, strconv.ErrSyntax
+}
+
+// jsonTTL 解析 JSON 中的存活时间，数字是秒数，字符串和 ttl 参数的格式一样
+func jsonTTL(value interface{}) (time.Duration, error) {
+	switch v := value.(type) {
+	case float64:
+		return time.Duration(v * float64(time.Second)), nil
+	case string:
+		return parseTTL(v)
+	}
+	return 0, strconv.ErrSyntax
+}
+
+// expireKeyHandler 修改 key 的存活时间，ttl 参数和 expire_at 参数和写入时的格式一样，见 ttlParam，ttl=0 表示永不过期
+// 只修改过期时间，value 和版本号都不变，返回修改之后剩余的存活时间，key 不存在或者已经过期时返回 404
+func (hs *HTTPServer) expireKeyHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	if !hasTTLParam(r) {
+		http.Error(w, "ttl or expire_at is required", http.StatusBadRequest)
+		return
+	}
+
+	ttl, err := ttlParam(r)
+	if err != nil || ttl < 0 {
+		http.Error(w, "invalid ttl", http.StatusBadRequest)
+		return
+	}
+
+	key := params.ByName("key")
+	if !hs.cache.Expire(key, ttl) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	hs.ttlHandler(w, r, params)
+}
+
+// ttlHandler 返回 key 剩余的存活时间和过期的时间点，单位是毫秒，永不过期时 ttl_ms 为 -1，expire_at_ms 为 0
+// 查看存活时间不算作一次读取，key 不存在或者已经过期时返回 404
+func (hs *HTTPServer) ttlHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	info, ok := hs.cache.Object(params.ByName("key"))
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"ttl_ms":       info.TTLMillis,
+		"expire_at_ms": info.ExpireAtMillis,
+	})
+}
@@ -0,0 +1,268 @@
+package servers
+
+import (
+	"encoding/json"
+	"fmt"
+	"gocache/logs"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// FaultRule 是一条故障注入规则，用于演练缓存变慢、出错或者断开连接时应用的表现
+// 匹配的请求中 Percent 的部分会被注入故障，先增加 Latency 的延迟，再按照 DropRate 断开连接，最后按照 ErrorRate 返回错误
+type FaultRule struct {
+	// Prefix 是 key 的前缀，为空时匹配所有读写请求，包括没有 key 的请求，比如 /batch 和 /cache
+	Prefix string `json:"prefix"`
+
+	// Actions 是匹配的操作，可以是 read、write 和 delete，为空表示所有的操作
+	Actions []string `json:"actions,omitempty"`
+
+	// Percent 是被注入故障的请求的百分比，为 0 表示所有匹配的请求
+	Percent float64 `json:"percent"`
+
+	// Latency 是增加的延迟，Jitter 是在延迟上随机增加的最大值
+	Latency time.Duration `json:"-"`
+	Jitter  time.Duration `json:"-"`
+
+	// ErrorRate 是返回错误的概率，ErrorStatus 是返回的状态码，为 0 时返回 503
+	ErrorRate   float64 `json:"error_rate"`
+	ErrorStatus int     `json:"error_status,omitempty"`
+
+	// DropRate 是不返回响应直接断开连接的概率
+	DropRate float64 `json:"drop_rate"`
+}
+
+// MarshalJSON 使用 time.Duration 的字符串格式输出延迟，比如 200ms
+func (fr FaultRule) MarshalJSON() ([]byte, error) {
+	type plain FaultRule
+	return json.Marshal(struct {
+		plain
+		Latency string `json:"latency"`
+		Jitter  string `json:"jitter"`
+	}{plain(fr), fr.Latency.String(), fr.Jitter.String()})
+}
+
+// UnmarshalJSON 解析 FaultRule 的 JSON 格式，延迟使用 time.ParseDuration 的格式
+func (fr *FaultRule) UnmarshalJSON(data []byte) error {
+	type plain FaultRule
+	var rule struct {
+		plain
+		Latency string `json:"latency"`
+		Jitter  string `json:"jitter"`
+	}
+	if err := json.Unmarshal(data, &rule); err != nil {
+		return err
+	}
+
+	*fr = FaultRule(rule.plain)
+	for _, d := range []struct {
+		name  string
+		value string
+		to    *time.Duration
+	}{{"latency", rule.Latency, &fr.Latency}, {"jitter", rule.Jitter, &fr.Jitter}} {
+		if d.value == "" {
+			continue
+		}
+
+		duration, err := time.ParseDuration(d.value)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q", d.name, d.value)
+		}
+		*d.to = duration
+	}
+	return nil
+}
+
+// check 检查规则是否合法
+func (fr *FaultRule) check() error {
+	for _, action := range fr.Actions {
+		if action != ActionRead && action != ActionWrite && action != ActionDelete {
+			return fmt.Errorf("invalid action %q", action)
+		}
+	}
+
+	switch {
+	case fr.Percent < 0 || fr.Percent > 100:
+		return fmt.Errorf("percent must be between 0 and 100, got %g", fr.Percent)
+	case fr.Latency < 0 || fr.Jitter < 0:
+		return fmt.Errorf("latency and jitter must not be negative")
+	case fr.ErrorRate < 0 || fr.ErrorRate > 1:
+		return fmt.Errorf("error_rate must be between 0 and 1, got %g", fr.ErrorRate)
+	case fr.DropRate < 0 || fr.DropRate > 1:
+		return fmt.Errorf("drop_rate must be between 0 and 1, got %g", fr.DropRate)
+	case fr.ErrorStatus != 0 && (fr.ErrorStatus < 400 || fr.ErrorStatus > 599):
+		return fmt.Errorf("error_status must be between 400 and 599, got %d", fr.ErrorStatus)
+	}
+	return nil
+}
+
+// matches 返回规则是否匹配 action 操作 key 的请求
+func (fr *FaultRule) matches(action string, key string) bool {
+	if fr.Prefix != "" && (key == "" || !strings.HasPrefix(key, fr.Prefix)) {
+		return false
+	}
+	return len(fr.Actions) == 0 || containsAction(fr.Actions, action)
+}
+
+// faultConfig 是正在生效的故障注入规则
+type faultConfig struct {
+	rules []FaultRule
+
+	// until 是规则自动失效的时间，为零值表示一直生效直到被删除
+	until time.Time
+}
+
+// faultInjector 按照管理员设置的规则给 HTTP 的读写请求注入故障，TCP 和 gRPC 接口不受影响，没有规则时不影响请求
+type faultInjector struct {
+	// config 是正在生效的规则，类型是 *faultConfig，没有设置或者为 nil 表示没有规则
+	config atomic.Value
+
+	// delayed、failed 和 dropped 是被增加了延迟、返回了错误和断开了连接的请求数，需要原子地读写
+	delayed int64
+	failed  int64
+	dropped int64
+}
+
+// load 返回正在生效的规则，没有规则或者已经失效时返回 nil
+func (fi *faultInjector) load() *faultConfig {
+	config, _ := fi.config.Load().(*faultConfig)
+	if config == nil || (!config.until.IsZero() && time.Now().After(config.until)) {
+		return nil
+	}
+	return config
+}
+
+// inject 按照第一条匹配的规则给请求注入故障，返回 false 表示已经返回了错误或者断开了连接，不需要再处理请求
+// 只有读写和删除请求会被注入故障，管理接口不受影响，保证总是可以删除规则
+func (fi *faultInjector) inject(w http.ResponseWriter, r *http.Request) bool {
+	config := fi.load()
+	if config == nil {
+		return true
+	}
+
+	action, key := requestAction(r)
+	if action != ActionRead && action != ActionWrite && action != ActionDelete {
+		return true
+	}
+
+	var rule *FaultRule
+	for i := range config.rules {
+		if config.rules[i].matches(action, key) {
+			rule = &config.rules[i]
+			break
+		}
+	}
+
+	if rule == nil || (rule.Percent > 0 && rand.Float64()*100 >= rule.Percent) {
+		return true
+	}
+
+	if delay := rule.Latency; delay > 0 || rule.Jitter > 0 {
+		if rule.Jitter > 0 {
+			delay += time.Duration(rand.Int63n(int64(rule.Jitter) + 1))
+		}
+
+		atomic.AddInt64(&fi.delayed, 1)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			timer.Stop()
+			return false
+		}
+	}
+
+	if rule.DropRate > 0 && rand.Float64() < rule.DropRate {
+		atomic.AddInt64(&fi.dropped, 1)
+		dropConnection(w)
+		return false
+	}
+
+	if rule.ErrorRate > 0 && rand.Float64() < rule.ErrorRate {
+		atomic.AddInt64(&fi.failed, 1)
+		status := rule.ErrorStatus
+		if status == 0 {
+			status = http.StatusServiceUnavailable
+		}
+		http.Error(w, "injected fault", status)
+		return false
+	}
+	return true
+}
+
+// dropConnection 不返回响应直接关闭请求的连接，不支持接管连接的 HTTP/2 请求使用 http.ErrAbortHandler 中止
+func dropConnection(w http.ResponseWriter) {
+	if hijacker, ok := w.(http.Hijacker); ok {
+		if conn, _, err := hijacker.Hijack(); err == nil {
+			conn.Close()
+			return
+		}
+	}
+	panic(http.ErrAbortHandler)
+}
+
+// faultsHandler 返回正在生效的故障注入规则和被注入故障的请求数
+func (hs *HTTPServer) faultsHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	fi := &hs.faults
+	status := map[string]interface{}{
+		"rules":   []FaultRule{},
+		"delayed": atomic.LoadInt64(&fi.delayed),
+		"failed":  atomic.LoadInt64(&fi.failed),
+		"dropped": atomic.LoadInt64(&fi.dropped),
+	}
+
+	if config := fi.load(); config != nil {
+		status["rules"] = config.rules
+		if !config.until.IsZero() {
+			status["until"] = config.until.Unix()
+		}
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// setFaultsHandler 使用请求体中的规则替换正在生效的故障注入规则，请求体是 {"rules": [...], "duration": "10m"}
+// duration 是规则自动失效的时间，避免演练结束之后忘记删除，为空表示一直生效直到通过 DELETE /admin/faults 删除
+// 规则只保存在内存中，重启之后失效
+func (hs *HTTPServer) setFaultsHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	var body struct {
+		Rules    []FaultRule `json:"rules"`
+		Duration string      `json:"duration"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for i := range body.Rules {
+		if err := body.Rules[i].check(); err != nil {
+			http.Error(w, fmt.Sprintf("invalid rule %d: %v", i, err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	config := &faultConfig{rules: body.Rules}
+	if body.Duration != "" {
+		duration, err := time.ParseDuration(body.Duration)
+		if err != nil || duration <= 0 {
+			http.Error(w, "invalid duration", http.StatusBadRequest)
+			return
+		}
+		config.until = time.Now().Add(duration)
+	}
+
+	hs.faults.config.Store(config)
+	logs.Warnf("fault injection enabled with %d rules", len(config.rules))
+	hs.faultsHandler(w, r, params)
+}
+
+// clearFaultsHandler 删除所有的故障注入规则
+func (hs *HTTPServer) clearFaultsHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	hs.faults.config.Store((*faultConfig)(nil))
+	logs.Infof("fault injection disabled")
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,33 @@
+package servers
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+)
+
+func TestFaultsInjectedOnlyAfterAuthorization(t *testing.T) {
+	hs := newPolicyServer()
+	hs.faults.config.Store(&faultConfig{rules: []FaultRule{{ErrorRate: 1, ErrorStatus: http.StatusTeapot}}})
+	handler := hs.handler()
+
+	if code := serve(handler, http.MethodPut, "/cache/a:1", "r"); code != http.StatusForbidden {
+		t.Fatalf("PUT by reader = %d, want 403", code)
+	}
+
+	if code := serve(handler, http.MethodGet, "/cache/a:1", "unknown"); code != http.StatusUnauthorized {
+		t.Fatalf("GET with unknown key = %d, want 401", code)
+	}
+
+	if failed := atomic.LoadInt64(&hs.faults.failed); failed != 0 {
+		t.Fatalf("%d rejected requests were counted as injected faults", failed)
+	}
+
+	if code := serve(handler, http.MethodGet, "/cache/a:1", "r"); code != http.StatusTeapot {
+		t.Fatalf("authorized GET = %d, want the injected 418", code)
+	}
+
+	if failed := atomic.LoadInt64(&hs.faults.failed); failed != 1 {
+		t.Errorf("failed = %d, want 1", failed)
+	}
+}
@@ -0,0 +1,167 @@
+package servers
+
+import (
+	"gocache/caches"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// maxFlushTasks 是保留的异步删除的个数，超出时丢弃最早结束的
+const maxFlushTasks = 100
+
+// flushTask 是通过 POST /flush 开始的异步删除
+type flushTask struct {
+	*caches.FlushTask
+
+	// id 是查看进度使用的编号，tenant 是开始删除的租户，不是租户时为空，租户只能看到自己开始的删除
+	id        string
+	tenant    string
+	startedAt time.Time
+}
+
+// flushTasks 记录最近的异步删除
+type flushTasks struct {
+	lock  sync.Mutex
+	next  int64
+	tasks []*flushTask
+}
+
+// add 记录新开始的删除并返回它的编号，超出 maxFlushTasks 时丢弃最早结束的删除
+func (ft *flushTasks) add(task *flushTask) string {
+	ft.lock.Lock()
+	defer ft.lock.Unlock()
+	ft.next++
+	task.id = strconv.FormatInt(ft.next, 10)
+	if len(ft.tasks) >= maxFlushTasks {
+		for i, t := range ft.tasks {
+			if t.Progress().Done {
+				ft.tasks = append(ft.tasks[:i], ft.tasks[i+1:]...)
+				break
+			}
+		}
+	}
+
+	ft.tasks = append(ft.tasks, task)
+	return task.id
+}
+
+// find 返回 tenant 开始的编号为 id 的删除，没有时返回 nil
+func (ft *flushTasks) find(id string, tenant string) *flushTask {
+	ft.lock.Lock()
+	defer ft.lock.Unlock()
+	for _, t := range ft.tasks {
+		if t.id == id && t.tenant == tenant {
+			return t
+		}
+	}
+	return nil
+}
+
+// flushHandler 在后台删除以 prefix 参数开头的 key，立即返回 202 和查看进度使用的编号，进度通过 GET /flush/:id 查看
+// namespace 参数表示只删除命名空间中的 key，租户只能删除自己命名空间中的 key，batch 参数是每批删除的 key 的个数，默认为 1000
+// 两个参数都没有时删除所有的 key，删除只在本节点进行，集群模式下需要在每个节点上分别调用
+func (hs *HTTPServer) flushHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	query := r.URL.Query()
+	batch, err := intParam(query.Get("batch"), 0)
+	if err != nil {
+		http.Error(w, "invalid batch", http.StatusBadRequest)
+		return
+	}
+
+	task := &flushTask{startedAt: time.Now()}
+	prefix := ""
+	if t := tenantFrom(r); t != nil {
+		task.tenant = t.Name
+		prefix = TenantPrefix(t.Name)
+	}
+
+	if name := query.Get("namespace"); name != "" {
+		if !hs.cache.HasNamespace(name) {
+			http.Error(w, "namespace not found", http.StatusNotFound)
+			return
+		}
+		prefix += hs.cache.Namespace(name).Key("")
+	}
+
+	task.FlushTask = hs.cache.FlushPrefixAsync(prefix+query.Get("prefix"), batch)
+	id := hs.flushes.add(task)
+	w.Header().Set("Location", "/flush/"+id)
+	writeJSON(w, http.StatusAccepted, hs.flushStatus(task))
+}
+
+// flushAllHandler 删除所有的 key 并返回删除的 key 的个数，只有管理员可以调用，删除只在本节点进行
+// 和 POST /flush 一样分批删除，不会长时间阻塞读写，但是等待删除完成之后才返回，请求被取消或者超时时中止删除，已经删除的 key 不会恢复
+// 没有配置认证时任何人都可以调用，所以总是需要带上 confirm=true 参数，避免误操作清空缓存
+func (hs *HTTPServer) flushAllHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	if r.URL.Query().Get("confirm") != "true" {
+		http.Error(w, "deleting all keys requires confirm=true", http.StatusBadRequest)
+		return
+	}
+
+	task := hs.cache.FlushPrefixAsync("", 0)
+	select {
+	case <-task.Done():
+	case <-r.Context().Done():
+		task.Cancel()
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"deleted": task.Progress().Deleted,
+	})
+}
+
+// flushStatusHandler 返回异步删除的进度，删除不存在或者不是发出请求的租户开始的时返回 404
+func (hs *HTTPServer) flushStatusHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	task := hs.findFlush(r, params.ByName("id"))
+	if task == nil {
+		http.Error(w, "flush not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, hs.flushStatus(task))
+}
+
+// cancelFlushHandler 中止异步删除，已经删除的 key 不会恢复，返回中止之后的进度
+func (hs *HTTPServer) cancelFlushHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	task := hs.findFlush(r, params.ByName("id"))
+	if task == nil {
+		http.Error(w, "flush not found", http.StatusNotFound)
+		return
+	}
+
+	task.Cancel()
+	writeJSON(w, http.StatusOK, hs.flushStatus(task))
+}
+
+// findFlush 返回发出请求的租户开始的编号为 id 的删除
+func (hs *HTTPServer) findFlush(r *http.Request, id string) *flushTask {
+	tenant := ""
+	if t := tenantFrom(r); t != nil {
+		tenant = t.Name
+	}
+	return hs.flushes.find(id, tenant)
+}
+
+// flushStatus 返回异步删除的进度，租户看到的前缀不包括租户的命名空间前缀
+func (hs *HTTPServer) flushStatus(task *flushTask) map[string]interface{} {
+	progress := task.Progress()
+	if task.tenant != "" {
+		progress.Prefix = strings.TrimPrefix(progress.Prefix, TenantPrefix(task.tenant))
+	}
+
+	return map[string]interface{}{
+		"id":            task.id,
+		"prefix":        progress.Prefix,
+		"deleted":       progress.Deleted,
+		"segments":      progress.Segments,
+		"segments_done": progress.SegmentsDone,
+		"done":          progress.Done,
+		"canceled":      progress.Canceled,
+		"started_at":    task.startedAt.Unix(),
+	}
+}
@@ -0,0 +1,33 @@
+package servers
+
+import (
+	"net/http"
+	"testing"
+
+	"gocache/caches"
+)
+
+func TestFlushAllRequiresConfirm(t *testing.T) {
+	cache := caches.NewCache()
+	cache.Set("a", []byte("1"))
+	cache.Set("b", []byte("2"))
+	handler := NewHTTPServer(cache).handler()
+
+	for _, path := range []string{"/cache", "/cache?confirm=1", "/cache?confirm=false"} {
+		if code := serve(handler, http.MethodDelete, path, ""); code != http.StatusBadRequest {
+			t.Errorf("DELETE %s = %d, want 400", path, code)
+		}
+	}
+
+	if count := cache.Count(); count != 2 {
+		t.Fatalf("Count after unconfirmed flush = %d, want 2", count)
+	}
+
+	if code := serve(handler, http.MethodDelete, "/cache?confirm=true", ""); code != http.StatusOK {
+		t.Fatalf("DELETE /cache?confirm=true = %d, want 200", code)
+	}
+
+	if count := cache.Count(); count != 0 {
+		t.Errorf("Count after flush = %d, want 0", count)
+	}
+}
@@ -0,0 +1,452 @@
+package servers
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"gocache/caches"
+	"gocache/replication"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// grpcChunkSize 是 GetStream 每个消息中 value 的字节数
+	grpcChunkSize = 64 * 1024
+
+	// grpcAPIKeyMetadata 是请求的 metadata 中 API key 的名字
+	grpcAPIKeyMetadata = "x-api-key"
+)
+
+// GRPCServer 是提供 gocache.proto 中定义的 gRPC 服务的服务器，和 HTTPServer 使用同一个缓存，不需要 JSON 编码
+// 和 TCPServer 一样不支持租户和授权策略，只能使用 SetAPIKeys 设置的 API key 认证
+type GRPCServer struct {
+	// cache 是底层存储的结构
+	cache *caches.Cache
+
+	// apiKeys 是允许访问的 API key，类型是 []string，为空时不认证
+	apiKeys atomic.Value
+
+	// replica 不为 nil 并且还没有被提升为主节点时拒绝修改缓存的请求
+	replica *replication.Replica
+
+	// defaultTTL 是 ttl_ms 为 0 时使用的过期时间，为 0 表示永不过期
+	defaultTTL time.Duration
+
+	// servers 是每次调用 Serve 创建的 gRPC 服务器，lock 保护 servers
+	servers []*grpc.Server
+	lock    sync.Mutex
+}
+
+// NewGRPCServer 返回一个关于 cache 的新 gRPC 服务器
+func NewGRPCServer(cache *caches.Cache) *GRPCServer {
+	return &GRPCServer{cache: cache}
+}
+
+// SetAPIKeys 设置允许访问的 API key，设置后每个请求都需要在 metadata 的 x-api-key 中带上 API key
+// 服务器运行期间也可以调用，用于重新加载配置
+func (gs *GRPCServer) SetAPIKeys(keys []string) {
+	gs.apiKeys.Store(keys)
+}
+
+// SetReplica 把本节点设置为 replica 的主节点的副本，提升为主节点之前修改缓存的请求返回 PERMISSION_DENIED
+func (gs *GRPCServer) SetReplica(replica *replication.Replica) {
+	gs.replica = replica
+}
+
+// SetDefaultTTL 设置 ttl_ms 为 0 时使用的过期时间，为 0 表示永不过期
+func (gs *GRPCServer) SetDefaultTTL(ttl time.Duration) {
+	gs.defaultTTL = ttl
+}
+
+// Run 在 address 上启动服务器
+func (gs *GRPCServer) Run(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	return gs.Serve(listener)
+}
+
+// RunTLS 使用 certFile 和 keyFile 指定的证书和私钥在 address 上启动使用 TLS 的服务器，客户端需要使用 TLS 凭据连接
+func (gs *GRPCServer) RunTLS(address string, certFile string, keyFile string) error {
+	listener, err := listenTLS(address, certFile, keyFile, "h2")
+	if err != nil {
+		return err
+	}
+	return gs.Serve(listener)
+}
+
+// Serve 在 listener 上处理 gRPC 请求，服务器被关闭之后返回 nil
+func (gs *GRPCServer) Serve(listener net.Listener) error {
+	server := grpc.NewServer(
+		grpc.ForceServerCodec(grpcCodec{}),
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if err := gs.authenticate(ctx); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := gs.authenticate(stream.Context()); err != nil {
+				return err
+			}
+			return handler(srv, stream)
+		}),
+	)
+	server.RegisterService(&grpcServiceDesc, gs)
+
+	gs.lock.Lock()
+	gs.servers = append(gs.servers, server)
+	gs.lock.Unlock()
+	return server.Serve(listener)
+}
+
+// Shutdown 关闭所有的 listener，并等待正在处理的请求完成，直到 ctx 结束时直接断开所有连接
+func (gs *GRPCServer) Shutdown(ctx context.Context) error {
+	gs.lock.Lock()
+	servers := gs.servers
+	gs.servers = nil
+	gs.lock.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		for _, server := range servers {
+			server.GracefulStop()
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		for _, server := range servers {
+			server.Stop()
+		}
+		return ctx.Err()
+	}
+}
+
+// authenticate 检查请求的 API key，没有设置 API key 时总是通过
+func (gs *GRPCServer) authenticate(ctx context.Context) error {
+	apiKeys, _ := gs.apiKeys.Load().([]string)
+	if len(apiKeys) == 0 {
+		return nil
+	}
+
+	key := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(grpcAPIKeyMetadata); len(values) > 0 {
+			key = values[0]
+		}
+	}
+
+	ok := false
+	for _, apiKey := range apiKeys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(apiKey)) == 1 {
+			ok = true
+		}
+	}
+
+	if !ok {
+		return status.Error(codes.Unauthenticated, "invalid api key")
+	}
+	return nil
+}
+
+// checkWritable 在本节点是只读的副本时返回错误
+func (gs *GRPCServer) checkWritable() error {
+	if gs.replica != nil && gs.replica.ReadOnly() {
+		return status.Error(codes.PermissionDenied, "read only replica")
+	}
+	return nil
+}
+
+// checkKey 在 key 是内部 key 时返回 InvalidArgument，见 caches.CheckKey
+func checkKey(key string) error {
+	if err := caches.CheckKey(key); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return nil
+}
+
+// ttlOf 把毫秒数的存活时间转换为 time.Duration，0 表示使用默认的过期时间，见 SetDefaultTTL
+func (gs *GRPCServer) ttlOf(ttlMs int64) (time.Duration, error) {
+	if ttlMs < 0 {
+		return 0, status.Error(codes.InvalidArgument, "invalid ttl_ms")
+	}
+
+	if ttlMs == 0 {
+		return gs.defaultTTL, nil
+	}
+	return time.Duration(ttlMs) * time.Millisecond, nil
+}
+
+// get 处理 Get
+func (gs *GRPCServer) get(ctx context.Context, req *grpcKeyRequest) (*grpcGetResponse, error) {
+	if err := checkKey(req.Key); err != nil {
+		return nil, err
+	}
+
+	value, version, ok := gs.cache.GetWithVersion(req.Key)
+	return &grpcGetResponse{Found: ok, Value: value, Version: version}, nil
+}
+
+// set 处理 Set
+func (gs *GRPCServer) set(ctx context.Context, req *grpcSetRequest) (*grpcEmpty, error) {
+	if err := gs.checkWritable(); err != nil {
+		return nil, err
+	}
+
+	if err := checkKey(req.Key); err != nil {
+		return nil, err
+	}
+
+	ttl, err := gs.ttlOf(req.TTLMs)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = gs.cache.TrySet(req.Key, req.Value, ttl, caches.PriorityNormal); err != nil {
+		return nil, grpcWriteError(err)
+	}
+	return &grpcEmpty{}, nil
+}
+
+// delete 处理 Delete
+func (gs *GRPCServer) delete(ctx context.Context, req *grpcKeyRequest) (*grpcEmpty, error) {
+	if err := gs.checkWritable(); err != nil {
+		return nil, err
+	}
+
+	if err := checkKey(req.Key); err != nil {
+		return nil, err
+	}
+
+	gs.cache.Delete(req.Key)
+	return &grpcEmpty{}, nil
+}
+
+// getStatus 处理 Status
+func (gs *GRPCServer) getStatus(ctx context.Context, req *grpcEmpty) (*grpcStatusResponse, error) {
+	stats := gs.cache.Stats()
+	return &grpcStatusResponse{
+		Keys:      stats.Keys,
+		Bytes:     stats.Bytes,
+		Hits:      stats.Hits,
+		Misses:    stats.Misses,
+		Sets:      stats.Sets,
+		Deletes:   stats.Deletes,
+		Expired:   stats.Expired,
+		Evictions: stats.Evictions,
+	}, nil
+}
+
+// batch 处理 Batch，和 HTTP 接口 /batch 一样先检查所有的操作，全部合法之后再按顺序执行
+func (gs *GRPCServer) batch(ctx context.Context, req *grpcBatchRequest) (*grpcBatchResponse, error) {
+	if len(req.Ops) > maxBatchOps {
+		return nil, status.Errorf(codes.InvalidArgument, "too many ops: %d > %d", len(req.Ops), maxBatchOps)
+	}
+
+	ttls := make([]time.Duration, len(req.Ops))
+	for i, op := range req.Ops {
+		if caches.IsInternalKey(op.Key) {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid key of op %d: %v", i, caches.ErrInternalKey)
+		}
+
+		switch op.Op {
+		case grpcBatchGet:
+		case grpcBatchSet, grpcBatchDelete:
+			if err := gs.checkWritable(); err != nil {
+				return nil, err
+			}
+
+			ttl, err := gs.ttlOf(op.TTLMs)
+			if err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid ttl_ms of op %d", i)
+			}
+			ttls[i] = ttl
+		default:
+			return nil, status.Errorf(codes.InvalidArgument, "invalid op %d: %d", i, op.Op)
+		}
+	}
+
+	results := make([]grpcBatchResult, len(req.Ops))
+	for i, op := range req.Ops {
+		result := &results[i]
+		result.Key, result.Status = op.Key, http.StatusOK
+		switch op.Op {
+		case grpcBatchGet:
+			value, version, ok := gs.cache.GetWithVersion(op.Key)
+			if !ok {
+				result.Status = http.StatusNotFound
+				continue
+			}
+			result.Value, result.Version = value, version
+		case grpcBatchSet:
+			if err := gs.cache.TrySet(op.Key, op.Value, ttls[i], caches.PriorityNormal); invalidWrite(err) {
+				result.Status, result.Error = http.StatusBadRequest, err.Error()
+			} else if err != nil {
+				result.Status, result.Error = http.StatusInsufficientStorage, err.Error()
+			}
+		case grpcBatchDelete:
+			gs.cache.Delete(op.Key)
+		}
+	}
+	return &grpcBatchResponse{Results: results}, nil
+}
+
+// getStream 处理 GetStream，把 value 分成多个消息发送
+func (gs *GRPCServer) getStream(req *grpcKeyRequest, stream grpc.ServerStream) error {
+	if err := checkKey(req.Key); err != nil {
+		return err
+	}
+
+	value, ok := gs.cache.Get(req.Key)
+	if !ok {
+		return status.Error(codes.NotFound, "key not found")
+	}
+
+	for len(value) > 0 {
+		n := grpcChunkSize
+		if n > len(value) {
+			n = len(value)
+		}
+
+		if err := stream.SendMsg(&grpcChunk{Data: value[:n]}); err != nil {
+			return err
+		}
+		value = value[n:]
+	}
+	return nil
+}
+
+// setStream 处理 SetStream，收到所有的消息之后再一起写入，value 最长和 TCP 服务器一样
+func (gs *GRPCServer) setStream(stream grpc.ServerStream) error {
+	if err := gs.checkWritable(); err != nil {
+		return err
+	}
+
+	var first grpcSetChunk
+	if err := stream.RecvMsg(&first); err != nil {
+		return err
+	}
+
+	if err := checkKey(first.Key); err != nil {
+		return err
+	}
+
+	ttl, err := gs.ttlOf(first.TTLMs)
+	if err != nil {
+		return err
+	}
+
+	value := first.Data
+	for {
+		var chunk grpcSetChunk
+		err := stream.RecvMsg(&chunk)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if len(value)+len(chunk.Data) > maxTCPValueSize {
+			return status.Errorf(codes.ResourceExhausted, "value too large: > %d", maxTCPValueSize)
+		}
+		value = append(value, chunk.Data...)
+	}
+
+	if err = gs.cache.TrySet(first.Key, value, ttl, caches.PriorityNormal); err != nil {
+		return grpcWriteError(err)
+	}
+	return stream.SendMsg(&grpcEmpty{})
+}
+
+// grpcWriteError 返回写入失败时的 gRPC 错误，数据不能被保存时是 InvalidArgument，缓存已满时是 ResourceExhausted
+func grpcWriteError(err error) error {
+	if invalidWrite(err) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return status.Error(codes.ResourceExhausted, err.Error())
+}
+
+// grpcMethod 返回使用 newRequest 创建请求、解码之后调用 call 的方法
+func grpcMethod(name string, newRequest func() grpcMessage, call func(gs *GRPCServer, ctx context.Context, req grpcMessage) (interface{}, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			req := newRequest()
+			if err := dec(req); err != nil {
+				return nil, err
+			}
+
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				return call(srv.(*GRPCServer), ctx, req.(grpcMessage))
+			}
+
+			if interceptor == nil {
+				return handler(ctx, req)
+			}
+
+			info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/gocache.Cache/" + name}
+			return interceptor(ctx, req, info, handler)
+		},
+	}
+}
+
+// grpcServiceDesc 是 gocache.proto 中的 Cache 服务
+var grpcServiceDesc = grpc.ServiceDesc{
+	ServiceName: "gocache.Cache",
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		grpcMethod("Get", func() grpcMessage { return &grpcKeyRequest{} }, func(gs *GRPCServer, ctx context.Context, req grpcMessage) (interface{}, error) {
+			return gs.get(ctx, req.(*grpcKeyRequest))
+		}),
+		grpcMethod("Set", func() grpcMessage { return &grpcSetRequest{} }, func(gs *GRPCServer, ctx context.Context, req grpcMessage) (interface{}, error) {
+			return gs.set(ctx, req.(*grpcSetRequest))
+		}),
+		grpcMethod("Delete", func() grpcMessage { return &grpcKeyRequest{} }, func(gs *GRPCServer, ctx context.Context, req grpcMessage) (interface{}, error) {
+			return gs.delete(ctx, req.(*grpcKeyRequest))
+		}),
+		grpcMethod("Status", func() grpcMessage { return &grpcEmpty{} }, func(gs *GRPCServer, ctx context.Context, req grpcMessage) (interface{}, error) {
+			return gs.getStatus(ctx, req.(*grpcEmpty))
+		}),
+		grpcMethod("Batch", func() grpcMessage { return &grpcBatchRequest{} }, func(gs *GRPCServer, ctx context.Context, req grpcMessage) (interface{}, error) {
+			return gs.batch(ctx, req.(*grpcBatchRequest))
+		}),
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "GetStream",
+			ServerStreams: true,
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				var req grpcKeyRequest
+				if err := stream.RecvMsg(&req); err != nil {
+					return err
+				}
+				return srv.(*GRPCServer).getStream(&req, stream)
+			},
+		},
+		{
+			StreamName:    "SetStream",
+			ClientStreams: true,
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				return srv.(*GRPCServer).setStream(stream)
+			},
+		},
+	},
+	Metadata: "gocache.proto",
+}
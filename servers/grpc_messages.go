@@ -0,0 +1,402 @@
+package servers
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// 下面是 gocache.proto 中的消息，直接使用 protowire 编码和解码，不需要生成代码
+// 没有用到的字段会被忽略，和生成的代码一样可以兼容新增的字段
+
+// grpcMessage 是可以用 grpcCodec 编码的消息
+type grpcMessage interface {
+	marshal() []byte
+	unmarshal(data []byte) error
+}
+
+// grpcCodec 使用消息自己的方法编码，名字是 proto，这样使用生成的代码的客户端也可以访问
+type grpcCodec struct{}
+
+// Marshal 编码消息
+func (grpcCodec) Marshal(v interface{}) ([]byte, error) {
+	message, ok := v.(grpcMessage)
+	if !ok {
+		return nil, fmt.Errorf("unexpected message type %T", v)
+	}
+	return message.marshal(), nil
+}
+
+// Unmarshal 解码消息
+func (grpcCodec) Unmarshal(data []byte, v interface{}) error {
+	message, ok := v.(grpcMessage)
+	if !ok {
+		return fmt.Errorf("unexpected message type %T", v)
+	}
+	return message.unmarshal(data)
+}
+
+// Name 返回编码方式的名字
+func (grpcCodec) Name() string {
+	return "proto"
+}
+
+// rangeFields 依次解码 data 中的字段，varint 类型的字段值在 varint 中，长度前缀类型的字段值在 bytes 中，其他类型的字段会被跳过
+func rangeFields(data []byte, fn func(number protowire.Number, varint uint64, bytes []byte) error) error {
+	for len(data) > 0 {
+		number, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		var varint uint64
+		var bytes []byte
+		switch typ {
+		case protowire.VarintType:
+			varint, n = protowire.ConsumeVarint(data)
+		case protowire.BytesType:
+			bytes, n = protowire.ConsumeBytes(data)
+		default:
+			n = protowire.ConsumeFieldValue(number, typ, data)
+		}
+
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		if typ == protowire.VarintType || typ == protowire.BytesType {
+			if err := fn(number, varint, bytes); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// appendString 编码字符串字段，空字符串和 proto3 一样不编码
+func appendString(data []byte, number protowire.Number, value string) []byte {
+	if value == "" {
+		return data
+	}
+	data = protowire.AppendTag(data, number, protowire.BytesType)
+	return protowire.AppendString(data, value)
+}
+
+// appendBytes 编码字节数组字段，空数组不编码
+func appendBytes(data []byte, number protowire.Number, value []byte) []byte {
+	if len(value) == 0 {
+		return data
+	}
+	data = protowire.AppendTag(data, number, protowire.BytesType)
+	return protowire.AppendBytes(data, value)
+}
+
+// appendVarint 编码整数和布尔类型的字段，0 不编码
+func appendVarint(data []byte, number protowire.Number, value uint64) []byte {
+	if value == 0 {
+		return data
+	}
+	data = protowire.AppendTag(data, number, protowire.VarintType)
+	return protowire.AppendVarint(data, value)
+}
+
+// copyBytes 返回 bytes 的拷贝，解码得到的字节数组引用着 gRPC 的缓冲区
+func copyBytes(bytes []byte) []byte {
+	return append([]byte{}, bytes...)
+}
+
+// grpcEmpty 是没有字段的消息，比如 SetResponse、DeleteResponse 和 StatusRequest
+type grpcEmpty struct{}
+
+func (*grpcEmpty) marshal() []byte {
+	return nil
+}
+
+func (*grpcEmpty) unmarshal(data []byte) error {
+	return rangeFields(data, func(protowire.Number, uint64, []byte) error { return nil })
+}
+
+// grpcKeyRequest 是只有 key 的消息，比如 GetRequest 和 DeleteRequest
+type grpcKeyRequest struct {
+	Key string
+}
+
+func (m *grpcKeyRequest) marshal() []byte {
+	return appendString(nil, 1, m.Key)
+}
+
+func (m *grpcKeyRequest) unmarshal(data []byte) error {
+	return rangeFields(data, func(number protowire.Number, varint uint64, bytes []byte) error {
+		if number == 1 {
+			m.Key = string(bytes)
+		}
+		return nil
+	})
+}
+
+// grpcGetResponse 是 GetResponse
+type grpcGetResponse struct {
+	Found   bool
+	Value   []byte
+	Version uint64
+}
+
+func (m *grpcGetResponse) marshal() []byte {
+	data := appendVarint(nil, 1, protowire.EncodeBool(m.Found))
+	data = appendBytes(data, 2, m.Value)
+	return appendVarint(data, 3, m.Version)
+}
+
+func (m *grpcGetResponse) unmarshal(data []byte) error {
+	return rangeFields(data, func(number protowire.Number, varint uint64, bytes []byte) error {
+		switch number {
+		case 1:
+			m.Found = varint != 0
+		case 2:
+			m.Value = copyBytes(bytes)
+		case 3:
+			m.Version = varint
+		}
+		return nil
+	})
+}
+
+// grpcSetRequest 是 SetRequest
+type grpcSetRequest struct {
+	Key   string
+	Value []byte
+	TTLMs int64
+}
+
+func (m *grpcSetRequest) marshal() []byte {
+	data := appendString(nil, 1, m.Key)
+	data = appendBytes(data, 2, m.Value)
+	return appendVarint(data, 3, uint64(m.TTLMs))
+}
+
+func (m *grpcSetRequest) unmarshal(data []byte) error {
+	return rangeFields(data, func(number protowire.Number, varint uint64, bytes []byte) error {
+		switch number {
+		case 1:
+			m.Key = string(bytes)
+		case 2:
+			m.Value = copyBytes(bytes)
+		case 3:
+			m.TTLMs = int64(varint)
+		}
+		return nil
+	})
+}
+
+// grpcStatusResponse 是 StatusResponse
+type grpcStatusResponse struct {
+	Keys      int64
+	Bytes     int64
+	Hits      int64
+	Misses    int64
+	Sets      int64
+	Deletes   int64
+	Expired   int64
+	Evictions int64
+}
+
+// fields 返回按照字段编号排列的字段
+func (m *grpcStatusResponse) fields() []*int64 {
+	return []*int64{&m.Keys, &m.Bytes, &m.Hits, &m.Misses, &m.Sets, &m.Deletes, &m.Expired, &m.Evictions}
+}
+
+func (m *grpcStatusResponse) marshal() []byte {
+	var data []byte
+	for i, field := range m.fields() {
+		data = appendVarint(data, protowire.Number(i+1), uint64(*field))
+	}
+	return data
+}
+
+func (m *grpcStatusResponse) unmarshal(data []byte) error {
+	fields := m.fields()
+	return rangeFields(data, func(number protowire.Number, varint uint64, bytes []byte) error {
+		if number >= 1 && int(number) <= len(fields) {
+			*fields[number-1] = int64(varint)
+		}
+		return nil
+	})
+}
+
+// 下面是 BatchOp.Op 的取值
+const (
+	grpcBatchGet    = 0
+	grpcBatchSet    = 1
+	grpcBatchDelete = 2
+)
+
+// grpcBatchOp 是 BatchOp
+type grpcBatchOp struct {
+	Op    uint64
+	Key   string
+	Value []byte
+	TTLMs int64
+}
+
+func (m *grpcBatchOp) marshal() []byte {
+	data := appendVarint(nil, 1, m.Op)
+	data = appendString(data, 2, m.Key)
+	data = appendBytes(data, 3, m.Value)
+	return appendVarint(data, 4, uint64(m.TTLMs))
+}
+
+func (m *grpcBatchOp) unmarshal(data []byte) error {
+	return rangeFields(data, func(number protowire.Number, varint uint64, bytes []byte) error {
+		switch number {
+		case 1:
+			m.Op = varint
+		case 2:
+			m.Key = string(bytes)
+		case 3:
+			m.Value = copyBytes(bytes)
+		case 4:
+			m.TTLMs = int64(varint)
+		}
+		return nil
+	})
+}
+
+// grpcBatchRequest 是 BatchRequest
+type grpcBatchRequest struct {
+	Ops []grpcBatchOp
+}
+
+func (m *grpcBatchRequest) marshal() []byte {
+	var data []byte
+	for i := range m.Ops {
+		data = protowire.AppendTag(data, 1, protowire.BytesType)
+		data = protowire.AppendBytes(data, m.Ops[i].marshal())
+	}
+	return data
+}
+
+func (m *grpcBatchRequest) unmarshal(data []byte) error {
+	return rangeFields(data, func(number protowire.Number, varint uint64, bytes []byte) error {
+		if number != 1 {
+			return nil
+		}
+
+		var op grpcBatchOp
+		if err := op.unmarshal(bytes); err != nil {
+			return err
+		}
+		m.Ops = append(m.Ops, op)
+		return nil
+	})
+}
+
+// grpcBatchResult 是 BatchResult
+type grpcBatchResult struct {
+	Key     string
+	Status  int32
+	Value   []byte
+	Version uint64
+	Error   string
+}
+
+func (m *grpcBatchResult) marshal() []byte {
+	data := appendString(nil, 1, m.Key)
+	data = appendVarint(data, 2, uint64(m.Status))
+	data = appendBytes(data, 3, m.Value)
+	data = appendVarint(data, 4, m.Version)
+	return appendString(data, 5, m.Error)
+}
+
+func (m *grpcBatchResult) unmarshal(data []byte) error {
+	return rangeFields(data, func(number protowire.Number, varint uint64, bytes []byte) error {
+		switch number {
+		case 1:
+			m.Key = string(bytes)
+		case 2:
+			m.Status = int32(varint)
+		case 3:
+			m.Value = copyBytes(bytes)
+		case 4:
+			m.Version = varint
+		case 5:
+			m.Error = string(bytes)
+		}
+		return nil
+	})
+}
+
+// grpcBatchResponse 是 BatchResponse
+type grpcBatchResponse struct {
+	Results []grpcBatchResult
+}
+
+func (m *grpcBatchResponse) marshal() []byte {
+	var data []byte
+	for i := range m.Results {
+		data = protowire.AppendTag(data, 1, protowire.BytesType)
+		data = protowire.AppendBytes(data, m.Results[i].marshal())
+	}
+	return data
+}
+
+func (m *grpcBatchResponse) unmarshal(data []byte) error {
+	return rangeFields(data, func(number protowire.Number, varint uint64, bytes []byte) error {
+		if number != 1 {
+			return nil
+		}
+
+		var result grpcBatchResult
+		if err := result.unmarshal(bytes); err != nil {
+			return err
+		}
+		m.Results = append(m.Results, result)
+		return nil
+	})
+}
+
+// grpcChunk 是 Chunk
+type grpcChunk struct {
+	Data []byte
+}
+
+func (m *grpcChunk) marshal() []byte {
+	return appendBytes(nil, 1, m.Data)
+}
+
+func (m *grpcChunk) unmarshal(data []byte) error {
+	return rangeFields(data, func(number protowire.Number, varint uint64, bytes []byte) error {
+		if number == 1 {
+			m.Data = copyBytes(bytes)
+		}
+		return nil
+	})
+}
+
+// grpcSetChunk 是 SetChunk
+type grpcSetChunk struct {
+	Key   string
+	TTLMs int64
+	Data  []byte
+}
+
+func (m *grpcSetChunk) marshal() []byte {
+	data := appendString(nil, 1, m.Key)
+	data = appendVarint(data, 2, uint64(m.TTLMs))
+	return appendBytes(data, 3, m.Data)
+}
+
+func (m *grpcSetChunk) unmarshal(data []byte) error {
+	return rangeFields(data, func(number protowire.Number, varint uint64, bytes []byte) error {
+		switch number {
+		case 1:
+			m.Key = string(bytes)
+		case 2:
+			m.TTLMs = int64(varint)
+		case 3:
+			m.Data = copyBytes(bytes)
+		}
+		return nil
+	})
+}
@@ -1,26 +1,407 @@
 package servers
 
 import (
-	"gocache/caches"
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
 	"encoding/json"
-	"github.com/julienschmidt/httprouter"
+	"errors"
+	"fmt"
+	"gocache/audit"
+	"gocache/backups"
+	"gocache/caches"
+	"gocache/metrics"
+	"gocache/rdb"
+	"gocache/replication"
+	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
 )
 
 // HTTPServer 是 HTTP 服务器结构
 type HTTPServer struct {
 	// cache 是底层存储的结构
 	cache *caches.Cache
+
+	// backups 是定时备份器，为 nil 时不提供备份相关的接口
+	backups *backups.Scheduler
+
+	// saver 是自动保存器，为 nil 时不提供持久化相关的接口
+	saver *caches.AutoSaver
+
+	// audit 是审计日志，为 nil 时不记录审计日志
+	audit *audit.Log
+
+	// getLatency、setLatency 和 deleteLatency 记录各个操作在服务器层的耗时，包括读取请求体和写入响应
+	getLatency    caches.Histogram
+	setLatency    caches.Histogram
+	deleteLatency caches.Histogram
+
+	// slowLog 是慢请求日志，为 nil 时不记录慢请求
+	slowLog *SlowLog
+
+	// apiKeys 是允许访问的 API key，类型是 []string，为空时不认证
+	apiKeys atomic.Value
+
+	// readOnlyAPIKeys 是只读的 API key，类型是 []string
+	readOnlyAPIKeys atomic.Value
+
+	// users 是通过 HTTP Basic 认证访问的用户，类型是 []User
+	users atomic.Value
+
+	// policies 是主体和授权策略，类型是 *policies，没有设置表示没有主体
+	policies atomic.Value
+
+	// certificate 是 TLS 使用的证书，类型是 *tls.Certificate
+	certificate atomic.Value
+
+	// timeouts 是各个操作的请求的超时时间，类型是 Timeouts，没有设置表示不限制
+	timeouts atomic.Value
+
+	// reload 用于重新加载配置，为 nil 时不提供重新加载配置的接口
+	reload func() error
+
+	// backend 是 GET 没有命中时加载数据的后端，为 nil 表示没有后端
+	backend *coalescer
+
+	// tenants 是所有的租户，为空表示没有开启多租户
+	tenants []*tenant
+
+	// shadow 把一部分请求复制到另一个 gocache，为 nil 表示没有开启影子流量
+	shadow *shadow
+
+	// verify 是后台进行的数据校验
+	verify verifyJob
+
+	// flushes 是最近开始的异步删除
+	flushes flushTasks
+
+	// faults 给读写请求注入延迟、错误和断开连接，通过 /admin/faults 设置规则
+	faults faultInjector
+
+	// cluster 把请求转发给负责 key 的节点，为 nil 表示没有开启集群模式
+	cluster *clusterRouter
+
+	// replica 从主节点复制数据，为 nil 表示本节点不是副本
+	replica *replication.Replica
+
+	// warmup 是预热的状态，取值为 warmupDone、warmupRunning 或 warmupRefusing
+	warmup int32
+
+	// legacyStatusCodes 为 true 时写入和删除成功都返回 200 和空的响应体，兼容旧的客户端
+	legacyStatusCodes bool
+
+	// defaultTTL 是写入时没有指定过期时间使用的过期时间，为 0 表示永不过期
+	defaultTTL time.Duration
+
+	// servers 是正在运行的 http.Server，每个监听的地址对应一个
+	servers []*http.Server
+
+	// lock 保护 servers
+	lock sync.Mutex
 }
 
+const (
+	// warmupDone 表示预热已经完成或者不需要预热
+	warmupDone int32 = iota
+
+	// warmupRunning 表示正在预热，只有 /readyz 返回 503
+	warmupRunning
+
+	// warmupRefusing 表示正在预热，读写缓存的请求也返回 503
+	warmupRefusing
+)
+
 // NewHTTPServer 返回一个关于 cache 的新 HTTP 服务器
 func NewHTTPServer(cache *caches.Cache) *HTTPServer {
 	return &HTTPServer{cache: cache}
 }
 
+// SetBackups 设置定时备份器，设置后会提供查看和恢复备份的管理接口
+func (hs *HTTPServer) SetBackups(scheduler *backups.Scheduler) {
+	hs.backups = scheduler
+}
+
+// SetSaver 设置自动保存器，设置后会提供手动触发持久化和查看持久化状态的管理接口
+func (hs *HTTPServer) SetSaver(saver *caches.AutoSaver) {
+	hs.saver = saver
+}
+
+// SetAudit 设置审计日志，设置后写操作和管理操作都会被记录，并提供查询审计日志的管理接口
+func (hs *HTTPServer) SetAudit(log *audit.Log) {
+	hs.audit = log
+}
+
+// SetSlowLog 设置慢请求日志，设置后会记录耗时超过阈值的请求，并提供查询慢请求的管理接口
+func (hs *HTTPServer) SetSlowLog(slowLog *SlowLog) {
+	hs.slowLog = slowLog
+}
+
+// SetAPIKeys 设置允许访问的 API key，设置后所有请求都需要在 X-API-Key 请求头或者 Authorization: Bearer 中带上其中一个
+// 服务器运行期间也可以调用，用于重新加载配置
+func (hs *HTTPServer) SetAPIKeys(keys []string) {
+	hs.apiKeys.Store(keys)
+}
+
+// SetLegacyStatusCodes 设置写入和删除成功时是否像旧版本一样返回 200 和空的响应体
+// 默认写入成功返回 201，删除成功返回 204，请求头 Accept 是 application/json 时都会返回带有元数据的 JSON
+func (hs *HTTPServer) SetLegacyStatusCodes(legacy bool) {
+	hs.legacyStatusCodes = legacy
+}
+
+// SetDefaultTTL 设置写入时没有指定过期时间使用的过期时间，为 0 表示永不过期，命名空间中的 key 使用命名空间默认的过期时间
+func (hs *HTTPServer) SetDefaultTTL(ttl time.Duration) {
+	hs.defaultTTL = ttl
+}
+
+// SetReloader 设置重新加载配置的函数，设置后会提供重新加载配置的管理接口
+func (hs *HTTPServer) SetReloader(reload func() error) {
+	hs.reload = reload
+}
+
+// BeginWarmup 标记服务器正在预热，预热结束之前 /readyz 返回 503，让负载均衡不要把请求发过来
+// refuseTraffic 为 true 时读写缓存的请求也返回 503
+func (hs *HTTPServer) BeginWarmup(refuseTraffic bool) {
+	if refuseTraffic {
+		atomic.StoreInt32(&hs.warmup, warmupRefusing)
+		return
+	}
+	atomic.StoreInt32(&hs.warmup, warmupRunning)
+}
+
+// EndWarmup 标记预热已经完成
+func (hs *HTTPServer) EndWarmup() {
+	atomic.StoreInt32(&hs.warmup, warmupDone)
+}
+
 func (hs *HTTPServer) Run(address string) error {
-	return http.ListenAndServe(address, hs.routerHandler())
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	return hs.Serve(listener)
+}
+
+// RunTLS 使用 certFile 和 keyFile 指定的证书和私钥在 address 上启动 HTTPS 服务器
+// 运行期间可以调用 ReloadCertificate 更换证书，不会断开已有的连接
+func (hs *HTTPServer) RunTLS(address string, certFile string, keyFile string) error {
+	if err := hs.ReloadCertificate(certFile, keyFile); err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	return hs.Serve(tls.NewListener(listener, hs.TLSConfig()))
+}
+
+// TLSConfig 返回使用服务器证书的 TLS 配置，需要先调用 ReloadCertificate 或者 SetCertificate 设置证书
+// 配置总是使用最新的证书，运行期间更换证书不会断开已有的连接
+func (hs *HTTPServer) TLSConfig() *tls.Config {
+	return &tls.Config{
+		NextProtos: []string{"h2", "http/1.1"},
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return hs.certificate.Load().(*tls.Certificate), nil
+		},
+	}
+}
+
+// Serve 在 listener 上处理 HTTP 请求，同一个服务器可以同时在多个 listener 上运行
+func (hs *HTTPServer) Serve(listener net.Listener) error {
+	// 关闭时取消所有请求的 context，让复制这样一直不结束的请求退出，不需要等到超时
+	ctx, cancel := context.WithCancel(context.Background())
+	server := &http.Server{Handler: hs.handler(), BaseContext: func(net.Listener) context.Context { return ctx }}
+	server.RegisterOnShutdown(cancel)
+	hs.lock.Lock()
+	hs.servers = append(hs.servers, server)
+	hs.lock.Unlock()
+	return server.Serve(listener)
+}
+
+// Shutdown 关闭所有的 listener，并等待正在处理的请求完成，直到 ctx 结束
+func (hs *HTTPServer) Shutdown(ctx context.Context) error {
+	hs.lock.Lock()
+	servers := hs.servers
+	hs.servers = nil
+	hs.lock.Unlock()
+
+	var firstErr error
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// ReloadCertificate 读取 certFile 和 keyFile 指定的证书和私钥，之后新建立的 TLS 连接都会使用新的证书
+func (hs *HTTPServer) ReloadCertificate(certFile string, keyFile string) error {
+	certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+
+	hs.certificate.Store(&certificate)
+	return nil
+}
+
+// SetCertificate 使用 PEM 编码的证书和私钥，私钥不在文件中时使用，比如从 Vault 中读取的私钥
+func (hs *HTTPServer) SetCertificate(certPEM []byte, keyPEM []byte) error {
+	certificate, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return err
+	}
+
+	hs.certificate.Store(&certificate)
+	return nil
+}
+
+// handler 返回处理所有请求的处理器，设置了 API key 时会先进行认证
+// 健康检查的请求一般来自负载均衡，不需要认证
+func (hs *HTTPServer) handler() http.Handler {
+	router := hs.routerHandler()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/healthz":
+			w.Write([]byte("ok"))
+			return
+		case "/readyz":
+			hs.readyHandler(w, r)
+			return
+		}
+
+		// 不是其他节点转发过来的请求带有转发标记时去掉它，这样的请求和其他请求一样按照 key 转发给负责的节点
+		if r.Header.Get(forwardedHeader) != "" && (hs.cluster == nil || !hs.cluster.trusted(r)) {
+			r.Header.Del(forwardedHeader)
+		}
+
+		apiKey := apiKeyOf(r)
+		tenant := hs.findTenant(apiKey)
+		policies := hs.loadPolicies()
+		subject := policies.findSubject(apiKey)
+		if tenant == nil && subject == nil {
+			// 只读的凭据当作只能读取的主体处理，可以读写的用户和 API key 一样不受限制
+			if user := hs.findUser(r); user != nil {
+				if user.ReadOnly {
+					policies, subject = readOnlyPolicies, &Subject{Name: user.Name}
+				}
+			} else if hs.readOnlyKey(apiKey) {
+				policies, subject = readOnlyPolicies, readOnlySubject
+			} else if !hs.authenticated(apiKey) {
+				hs.unauthorized(w)
+				return
+			}
+		}
+
+		if atomic.LoadInt32(&hs.warmup) == warmupRefusing && (strings.HasPrefix(r.URL.Path, "/cache/") || r.URL.Path == batchPath) {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "warming up", http.StatusServiceUnavailable)
+			return
+		}
+
+		// 路径中的 key 不能是内部 key，否则可以读写大对象的分片和预留，写入的 key 也不受 MaxEntries 和 MaxBytes 的限制
+		if caches.IsInternalKey(r.URL.Path) {
+			http.Error(w, caches.ErrInternalKey.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// 影子请求和转发的请求都使用命名空间改写之前的路径，影子集群和负责的节点上同样按照命名空间检查配额
+		uri := r.URL.RequestURI()
+		routed := hs.routeNamespace(r)
+		if hs.cluster != nil && hs.cluster.forward(w, r, routed) {
+			return
+		}
+		r = routed
+
+		if hs.replica != nil && hs.rejectWrite(w, r) {
+			return
+		}
+
+		// 通过租户或者主体的检查之后才注入故障和复制影子流量，没有权限的请求不会被计入故障的统计，也不会被发送到影子集群
+		admitted := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !hs.faults.inject(w, r) {
+				return
+			}
+
+			if hs.shadow != nil {
+				hs.shadow.mirror(r, uri)
+			}
+			router.ServeHTTP(w, r)
+		})
+
+		serve := func(w http.ResponseWriter, r *http.Request) {
+			if tenant != nil {
+				hs.serveTenant(w, r, tenant, admitted)
+				return
+			}
+
+			if subject != nil {
+				// 批量操作的请求体中的每个 key 都需要授权，交给 batchHandler 检查
+				if r.URL.Path == batchPath {
+					r = withAuthorization(r, policies, subject)
+				} else if !hs.authorize(w, r, policies, subject) {
+					return
+				}
+			}
+			admitted.ServeHTTP(w, r)
+		}
+
+		if timeout := hs.timeoutOf(r); timeout > 0 {
+			hs.serveWithTimeout(w, r, timeout, serve)
+			return
+		}
+		serve(w, r)
+	})
+}
+
+// readyHandler 在预热完成并且所有后台协程都正常时返回 200，否则返回 503
+// 后台协程卡住或者崩溃之后过期的数据不会被清理，修改也可能不会被持久化，不应该再接收请求
+func (hs *HTTPServer) readyHandler(w http.ResponseWriter, r *http.Request) {
+	if atomic.LoadInt32(&hs.warmup) != warmupDone {
+		http.Error(w, "warming up", http.StatusServiceUnavailable)
+		return
+	}
+
+	var unhealthy []string
+	for _, worker := range hs.cache.Workers() {
+		if !worker.Healthy() {
+			unhealthy = append(unhealthy, worker.Name+" "+worker.State)
+		}
+	}
+
+	if len(unhealthy) > 0 {
+		http.Error(w, "unhealthy workers: "+strings.Join(unhealthy, ", "), http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ok"))
+}
+
+// authenticated 返回 key 是否是允许访问的 API key，没有设置 API key 并且没有租户、主体、只读的 API key 和用户时总是返回 true
+// 使用固定时间的比较，避免通过响应时间猜出 key
+func (hs *HTTPServer) authenticated(key string) bool {
+	apiKeys, _ := hs.apiKeys.Load().([]string)
+	if len(apiKeys) == 0 {
+		policies := hs.loadPolicies()
+		return len(hs.tenants) == 0 && (policies == nil || len(policies.subjects) == 0) && !hs.hasCredentials()
+	}
+
+	ok := false
+	for _, apiKey := range apiKeys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(apiKey)) == 1 {
+			ok = true
+		}
+	}
+	return ok
 }
 
 // routerHandler 返回路由处理器给 http 包中注册用
@@ -30,50 +411,404 @@ func (hs *HTTPServer) routerHandler() http.Handler {
 	// key 都从 url 上获取，value 从请求体中获取
 	router := httprouter.New()
 	router.GET("/cache/:key", hs.getHandler)
-	router.PUT("/cache/:key", hs.setHandler)
-	router.DELETE("/cache/:key", hs.deleteHandler)
+	router.PUT("/cache/:key", hs.audited("set", "key", hs.setHandler))
+	router.DELETE("/cache/:key", hs.audited("delete", "key", hs.deleteHandler))
+	router.POST("/expire", hs.audited("expire", "", hs.expireHandler))
+	router.POST("/expireat", hs.audited("expireat", "", hs.expireAtHandler))
+	router.POST(batchPath, hs.audited("batch", "", hs.batchHandler))
+	router.PATCH("/cache/:key", hs.audited("patch", "key", hs.patchHandler))
+	router.POST("/cache/:key/incr", hs.audited("incr", "key", hs.incrHandler))
+	router.POST("/cache/:key/decr", hs.audited("decr", "key", hs.decrHandler))
+	router.GET("/cache", hs.scanHandler)
+	router.DELETE("/cache", hs.audited("flush_all", "", hs.flushAllHandler))
+	router.POST("/cache/:key/expire", hs.audited("expire_key", "key", hs.expireKeyHandler))
+	router.GET("/cache/:key/ttl", hs.ttlHandler)
+	router.GET("/cache/:key/info", hs.objectHandler)
+	router.GET("/events", hs.eventsHandler)
+	router.GET("/randomkey", hs.randomKeyHandler)
+	router.GET("/type/:key", hs.typeHandler)
+	router.GET("/object/:key", hs.objectHandler)
+	router.POST("/locks/:key", hs.audited("lock", "key", hs.lockHandler))
+	router.DELETE("/locks/:key", hs.audited("unlock", "key", hs.unlockHandler))
+	router.GET("/leases/:key", hs.getLeaseHandler)
+	router.POST("/leases/:key", hs.audited("lease_acquire", "key", hs.acquireLeaseHandler))
+	router.PUT("/leases/:key", hs.renewLeaseHandler)
+	router.DELETE("/leases/:key", hs.audited("lease_release", "key", hs.releaseLeaseHandler))
+	router.GET("/reservations/:key", hs.getReservationHandler)
+	router.POST("/reservations/:key", hs.audited("reserve", "key", hs.reserveHandler))
+	router.PUT("/reservations/:key", hs.audited("reserve_complete", "key", hs.completeHandler))
+	router.DELETE("/reservations/:key", hs.audited("reserve_cancel", "key", hs.cancelReservationHandler))
+	router.POST("/semaphores/:key", hs.acquireSemaphoreHandler)
+	router.DELETE("/semaphores/:key", hs.releaseSemaphoreHandler)
+	router.POST("/ratelimits/:key", hs.rateLimitHandler)
+	router.POST("/sessions", hs.createSessionHandler)
+	router.GET("/sessions/:id", hs.getSessionHandler)
+	router.PUT("/sessions/:id", hs.renewSessionHandler)
+	router.PATCH("/sessions/:id", hs.setSessionAttributesHandler)
+	router.DELETE("/sessions/:id", hs.deleteSessionHandler)
+	router.DELETE("/users/:user/sessions", hs.audited("session_delete_user", "user", hs.deleteUserSessionsHandler))
 	router.GET("/status", hs.statusHandler)
+	router.GET("/stats", hs.statsHandler)
+	router.GET("/metrics", hs.metricsHandler)
+	router.POST("/admin/import/rdb", hs.audited("import_rdb", "", hs.importRDBHandler))
+	router.GET("/admin/export", hs.audited("export", "", hs.exportHandler))
+	router.POST("/admin/import", hs.audited("import", "", hs.importHandler))
+	router.GET("/admin/keysizes", hs.keySizesHandler)
+	router.GET("/admin/prefixes", hs.prefixesHandler)
+	router.GET("/admin/usage", hs.usageHandler)
+	router.POST("/admin/usage/reset", hs.audited("usage_reset", "", hs.resetUsageHandler))
+	router.POST("/admin/aof/rewrite", hs.audited("aof_rewrite", "", hs.rewriteAOFHandler))
+	router.POST("/flush", hs.audited("flush", "", hs.flushHandler))
+	router.GET("/flush/:id", hs.flushStatusHandler)
+	router.DELETE("/flush/:id", hs.audited("flush_cancel", "id", hs.cancelFlushHandler))
+	router.GET("/admin/verify", hs.verifyStatusHandler)
+	router.POST("/admin/verify", hs.audited("verify", "", hs.verifyHandler))
+	router.GET("/admin/faults", hs.faultsHandler)
+	router.PUT("/admin/faults", hs.audited("faults", "", hs.setFaultsHandler))
+	router.DELETE("/admin/faults", hs.audited("faults_clear", "", hs.clearFaultsHandler))
+	router.GET("/admin/loglevel", hs.logLevelHandler)
+	router.PUT("/admin/loglevel", hs.audited("log_level", "", hs.setLogLevelHandler))
+	router.GET("/admin/debug/keys", hs.tracedKeysHandler)
+	router.PUT("/admin/debug/keys/:key", hs.audited("trace_key", "key", hs.traceKeyHandler))
+	router.DELETE("/admin/debug/keys/:key", hs.audited("untrace_key", "key", hs.untraceKeyHandler))
+
+	if hs.backups != nil {
+		router.GET("/admin/backups", hs.listBackupsHandler)
+		router.POST("/admin/backups", hs.audited("backup", "", hs.createBackupHandler))
+		router.POST("/admin/backups/:name/restore", hs.audited("restore", "name", hs.restoreBackupHandler))
+	}
+
+	if hs.saver != nil {
+		router.POST("/admin/save", hs.audited("save", "", hs.saveHandler))
+		router.POST("/admin/bgsave", hs.audited("bgsave", "", hs.bgsaveHandler))
+		router.POST("/admin/snapshot", hs.audited("snapshot", "", hs.snapshotHandler))
+		router.GET("/admin/lastsave", hs.lastSaveHandler)
+	}
+
+	if hs.audit != nil {
+		router.GET("/admin/audit", hs.auditHandler)
+	}
+
+	if len(hs.tenants) > 0 {
+		router.GET("/admin/tenants", hs.tenantsHandler)
+	}
+
+	router.GET("/admin/namespaces", hs.namespacesHandler)
+	router.DELETE("/admin/namespaces/:name", hs.audited("namespace_flush", "name", hs.flushNamespaceHandler))
+
+	if hs.reload != nil {
+		router.POST("/admin/config/reload", hs.audited("config_reload", "", hs.reloadHandler))
+	}
+
+	router.GET(replication.StreamPath, hs.replicationStreamHandler)
+	if hs.replica != nil {
+		router.GET("/admin/replication", hs.replicationHandler)
+		router.POST("/admin/replication/promote", hs.audited("promote", "", hs.promoteHandler))
+	}
+
+	if hs.cluster != nil {
+		router.GET("/cluster/nodes", hs.clusterNodesHandler)
+		router.PUT("/admin/cluster/nodes", hs.audited("cluster_nodes", "", hs.setClusterNodesHandler))
+	}
+
+	if hs.slowLog != nil {
+		router.GET("/admin/slowlog", hs.slowLogHandler)
+		router.DELETE("/admin/slowlog", hs.audited("slowlog_reset", "", hs.resetSlowLogHandler))
+	}
 	return router
 }
 
-// getHandler 获取缓存数据
+// getHandler 获取缓存数据，设置了后端时没有命中的 key 会从后端加载，同一个 key 同时没有命中的请求只会访问一次后端
+// 从后端加载失败时，如果缓存中有过期不超过 Options.StaleGrace 的数据，就返回过期的数据并带上 X-Stale 响应头
+// 有 field 或者 range 参数时只返回 value 中的一部分，见 writeTransformed
+// 命中缓存时 X-Version 响应头是 value 的版本号，可以用于条件删除，ETag 响应头是带引号的版本号，可以用于条件写入
+// If-None-Match 请求头匹配 ETag 时返回 304
+// value 逐块写入响应，分块保存的大 value 不需要拼接，支持 Range 请求头，只返回其中的一段或者几段，If-Range 可以使用 ETag
 func (hs *HTTPServer) getHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	start := time.Now()
 	key := params.ByName("key")
-	value, ok := hs.cache.Get(key)
+	var content io.ReadSeeker
+	size := 0
+	defer func() { hs.observe(&hs.getLatency, "get", r, key, size, start) }()
+	reader, version, ok := hs.cache.GetReader(key)
+	if ok {
+		w.Header().Set("X-Version", strconv.FormatUint(version, 10))
+		w.Header().Set("ETag", etag(version))
+		if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" && etagMatches(ifNoneMatch, version, true) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		content, size = reader, int(reader.Size())
+	}
+
+	if !ok && hs.backend != nil && tenantFrom(r) == nil {
+		value, loaded, err := hs.backend.load(r.Context(), hs, key)
+		if err != nil {
+			if stale, age, found := hs.cache.GetStale(key); found {
+				hs.backend.serveStale(w, age)
+				value, loaded = stale, true
+			} else {
+				http.Error(w, "load from backend failed: "+err.Error(), http.StatusBadGateway)
+				return
+			}
+		}
+
+		if loaded {
+			content, size, ok = bytes.NewReader(value), len(value), true
+		}
+	}
+
 	if !ok {
 		// 如果缓存中找不到数据，就返回 404 状态码
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 
-	w.Write(value)
+	if hasTransform(r) {
+		value, err := ioutil.ReadAll(content)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		writeTransformed(w, r, value)
+		return
+	}
+
+	// 没有名字和修改时间时 ServeContent 只处理 Range 和 ETag 相关的请求头，Content-Type 和 w.Write 一样根据内容推断
+	http.ServeContent(w, r, "", time.Time{}, content)
 }
 
-// setHandler 保存缓存数据
+// setHandler 保存缓存数据，ttl 参数或者 X-TTL 请求头是数据的存活时间，比如 10s 或者秒数 10，没有时使用默认的过期时间，见 defaultTTLOf
+// 也可以使用 expire_at 参数或者 X-Expire-At 请求头设置过期的时间点，见 ttlParam
+// priority 参数或者 X-Priority 请求头是淘汰时的优先级，可以是 low、normal 或者 high，没有时为 normal
+// 有 If-Match 或者 If-None-Match 请求头时进行条件写入，见 setIfMatch
 func (hs *HTTPServer) setHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	start := time.Now()
 	key := params.ByName("key")
+	ttl, err := ttlParam(r)
+	if err != nil || ttl < 0 {
+		http.Error(w, "invalid ttl", http.StatusBadRequest)
+		return
+	}
+
+	if !hasTTLParam(r) {
+		ttl = hs.defaultTTLOf(r, key)
+	}
+
+	priority, err := priorityParam(r)
+	if err != nil {
+		http.Error(w, "invalid priority", http.StatusBadRequest)
+		return
+	}
+
+	match := preconditions(r)
+	if match == nil && hs.streamBody(r) {
+		hs.setStream(w, r, key, ttl, priority, start)
+		return
+	}
+
 	// value 从请求体中读取，整个请求体都被当作 value
-	value, err := ioutil.ReadAll(r.Body)
+	// 缓存会拷贝一份 value，所以可以使用池中的缓冲区读取，写入之后放回
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if err := readBody(r, buf); err != nil {
+		// 如果读取请求体失败，就返回500，请求体的编码不支持或者解压失败时返回 415 或者 400
+		writeBodyError(w, err)
+		return
+	}
+	value := buf.Bytes()
+
+	if match != nil {
+		if priority != caches.PriorityNormal {
+			http.Error(w, "priority is not supported with preconditions", http.StatusBadRequest)
+			return
+		}
+		hs.setIfMatch(w, r, key, value, ttl, match)
+		hs.observe(&hs.setLatency, "set", r, key, len(value), start)
+		return
+	}
+
+	// 租户和通过命名空间访问的写入受命名空间的配额限制
+	if quotaChecked(r) {
+		err = hs.cache.SetWithPriorityAndQuota(key, value, ttl, priority)
+	} else {
+		err = hs.cache.TrySet(key, value, ttl, priority)
+	}
+
 	if err != nil {
-		// 如果读取请求体失败，就返回500
-		w.WriteHeader(http.StatusInternalServerError)
+		writeQuotaError(w, r, err)
+		return
+	}
+	hs.writeSet(w, r, key)
+	hs.observe(&hs.setLatency, "set", r, key, len(value), start)
+}
+
+// streamBody 返回是否需要边读取请求体边写入缓存，设置了 ChunkSize 或者 LargeObjectThreshold 并且请求体可能超过其中较小的一个时
+// 不需要先读取到缓冲区中，不知道长度或者压缩过的请求体都可能超过
+func (hs *HTTPServer) streamBody(r *http.Request) bool {
+	limit := hs.cache.ChunkSize()
+	if threshold := hs.cache.LargeObjectThreshold(); threshold > 0 && (limit <= 0 || threshold < limit) {
+		limit = threshold
+	}
+
+	if limit <= 0 {
+		return false
+	}
+
+	encoding := r.Header.Get("Content-Encoding")
+	return r.ContentLength < 0 || r.ContentLength > int64(limit) || (encoding != "" && encoding != "identity")
+}
+
+// setStream 从请求体中逐块读取 value 并保存，超过 ChunkSize 的 value 分块保存，超过 LargeObjectThreshold 的 value 分片保存
+// 见 caches.Cache.SetFrom
+func (hs *HTTPServer) setStream(w http.ResponseWriter, r *http.Request, key string, ttl time.Duration, priority caches.Priority, start time.Time) {
+	body, err := bodyReader(r)
+	if err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	defer body.Close()
+
+	var size int64
+	if quotaChecked(r) {
+		size, err = hs.cache.SetFromWithQuota(key, body, ttl, priority)
+	} else {
+		size, err = hs.cache.SetFrom(key, body, ttl, priority)
+	}
+
+	var quotaErr *caches.QuotaError
+	switch {
+	case errors.Is(err, caches.ErrCacheFull) || errors.As(err, &quotaErr) || invalidWrite(err):
+		writeQuotaError(w, r, err)
+		return
+	case err != nil:
+		writeBodyError(w, err)
+		return
+	}
+	hs.writeSet(w, r, key)
+	hs.observe(&hs.setLatency, "set", r, key, int(size), start)
+}
+
+// writeSet 返回写入成功的响应，JSON 格式时返回 key 写入之后的版本号、剩余的存活时间和占用的字节数
+func (hs *HTTPServer) writeSet(w http.ResponseWriter, r *http.Request, key string) {
+	if hs.legacyStatusCodes {
+		return
+	}
+
+	if !acceptsJSON(r) {
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+
+	// 写入之后到这里之间 key 可能已经被修改或者删除了，这时返回的是最新的状态
+	info, _ := hs.cache.Object(key)
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"version": info.Version,
+		"ttl_ms":  info.TTLMillis,
+		"size":    info.Size,
+	})
+}
+
+// writeDelete 返回删除成功的响应，JSON 格式时返回删除之前 key 是否存在
+func (hs *HTTPServer) writeDelete(w http.ResponseWriter, r *http.Request, existed bool) {
+	if hs.legacyStatusCodes {
+		return
+	}
+
+	if !acceptsJSON(r) {
+		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 
-	hs.cache.Set(key, value)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"deleted": existed,
+	})
+}
+
+// acceptsJSON 返回请求是否希望返回 JSON 格式的响应体
+func acceptsJSON(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+// setIfMatch 在 match 返回 true 时保存 key 和 value，成功时 ETag 响应头是新的版本号，条件不满足时返回 412
+// 比如 If-Match: "1234" 只在 key 没有被其他人修改过时写入，If-None-Match: * 只在 key 不存在时写入
+func (hs *HTTPServer) setIfMatch(w http.ResponseWriter, r *http.Request, key string, value []byte, ttl time.Duration, match func(uint64, bool) bool) {
+	setIfMatch := hs.cache.SetIfMatch
+	if quotaChecked(r) {
+		setIfMatch = hs.cache.SetIfMatchWithQuota
+	}
+
+	version, err := setIfMatch(key, value, ttl, match)
+	switch {
+	case errors.Is(err, caches.ErrConditionFailed):
+		http.Error(w, "precondition failed", http.StatusPreconditionFailed)
+	case err != nil:
+		writeQuotaError(w, r, err)
+	default:
+		w.Header().Set("X-Version", strconv.FormatUint(version, 10))
+		w.Header().Set("ETag", etag(version))
+		hs.writeSet(w, r, key)
+	}
 }
 
 // deleteHandler 用于删除缓存数据
+// 有 if_version 参数时只在 key 的版本号和参数相同时删除，有 if_value 参数时只在 value 和参数相同时删除，条件不满足时返回 412
 func (hs *HTTPServer) deleteHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	start := time.Now()
 	key := params.ByName("key")
-	hs.cache.Delete(key)
+	defer func() { hs.observe(&hs.deleteLatency, "delete", r, key, 0, start) }()
+
+	query := r.URL.Query()
+	deleted := true
+	existed := true
+	switch {
+	case query.Has("if_version"):
+		version, err := strconv.ParseUint(query.Get("if_version"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid if_version", http.StatusBadRequest)
+			return
+		}
+		deleted = hs.cache.DeleteIfVersion(key, version)
+	case query.Has("if_value"):
+		deleted = hs.cache.DeleteIfValue(key, []byte(query.Get("if_value")))
+	default:
+		// 只有 JSON 格式的响应需要知道删除之前 key 是否存在
+		if acceptsJSON(r) {
+			_, existed = hs.cache.Object(key)
+		}
+		hs.cache.Delete(key)
+	}
+
+	if !deleted {
+		http.Error(w, "precondition failed", http.StatusPreconditionFailed)
+		return
+	}
+	hs.writeDelete(w, r, existed)
 }
 
-// statusHandler 用户获取缓存键值对的个数
+// statusHandler 用户获取缓存键值对的个数、占用的字节数和命中率等统计数据
 func (hs *HTTPServer) statusHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
-	// 将个数编码成 JSON 字符串
+	stats := hs.cache.Stats()
+	hitRatio := 0.0
+	if reads := stats.Hits + stats.Misses; reads > 0 {
+		hitRatio = float64(stats.Hits) / float64(reads)
+	}
+
+	// 将统计数据编码成 JSON 字符串
 	status, err := json.Marshal(map[string]interface{}{
-		"count": hs.cache.Count(),
+		"count":       stats.Keys,
+		"bytes":       stats.Bytes,
+		"used_bytes":  stats.UsedBytes,
+		"hits":        stats.Hits,
+		"misses":      stats.Misses,
+		"hit_ratio":   hitRatio,
+		"sets":        stats.Sets,
+		"deletes":     stats.Deletes,
+		"expired":     stats.Expired,
+		"evictions":   stats.Evictions,
+		"rejected":    stats.Rejected,
+		"replication": hs.replicationStatus(),
+		"workers":     hs.cache.Workers(),
 	})
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -81,4 +816,423 @@ func (hs *HTTPServer) statusHandler(w http.ResponseWriter, r *http.Request, para
 	}
 
 	w.Write(status)
-}
\ No newline at end of file
+}
+
+// metricsHandler 以 Prometheus 文本格式返回缓存的统计数据
+func (hs *HTTPServer) metricsHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	w.Header().Set("Content-Type", metrics.PrometheusContentType)
+	metrics.WritePrometheus(w, hs.cache.Stats())
+}
+
+// statsHandler 返回缓存层和服务器层的统计数据，耗时的单位是纳秒
+func (hs *HTTPServer) statsHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	server := map[string]interface{}{
+		"latency": map[string]caches.LatencyStats{
+			"get":    hs.getLatency.Stats(),
+			"set":    hs.setLatency.Stats(),
+			"delete": hs.deleteLatency.Stats(),
+		},
+	}
+
+	if hs.backend != nil {
+		server["backend"] = hs.backend.stats()
+	}
+
+	if hs.shadow != nil {
+		server["shadow"] = hs.shadow.stats()
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"cache":  hs.cache.Stats(),
+		"server": server,
+	})
+}
+
+// keySizesHandler 抽样返回 value 大小的分布和最大的键值对
+// samples 参数是抽样的个数，默认为 10000，top 参数是返回的最大的键值对个数，默认为 20
+func (hs *HTTPServer) keySizesHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	query := r.URL.Query()
+	samples, err := intParam(query.Get("samples"), 10000)
+	if err != nil {
+		http.Error(w, "invalid samples", http.StatusBadRequest)
+		return
+	}
+
+	top, err := intParam(query.Get("top"), 20)
+	if err != nil {
+		http.Error(w, "invalid top", http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, hs.cache.SampleSizes(samples, top))
+}
+
+// randomKeyHandler 等概率地返回没有过期的 key，count 参数是返回的 key 的个数，默认为 1，缓存为空时返回空数组
+func (hs *HTTPServer) randomKeyHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	count, err := intParam(r.URL.Query().Get("count"), 1)
+	if err != nil || count == 0 {
+		http.Error(w, "invalid count", http.StatusBadRequest)
+		return
+	}
+
+	keys := hs.cache.SampleKeys(count)
+	if keys == nil {
+		keys = []string{}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": keys,
+	})
+}
+
+// scanHandler 从 cursor 参数开始遍历匹配 pattern 参数的 key，返回找到的 key 和下一次遍历使用的 cursor，cursor 为 0 表示遍历结束
+// pattern 的语法见 caches.MatchGlob，为空时匹配所有的 key，count 参数是每次返回的 key 的个数的提示，默认为 10
+// namespace 参数不为空时只遍历命名空间中的 key，租户只能遍历自己的 key，这时 pattern 和返回的 key 都不带命名空间的前缀
+func (hs *HTTPServer) scanHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	query := r.URL.Query()
+	cursor, err := strconv.ParseUint(query.Get("cursor"), 10, 64)
+	if err != nil && query.Get("cursor") != "" {
+		http.Error(w, "invalid cursor", http.StatusBadRequest)
+		return
+	}
+
+	count, err := intParam(query.Get("count"), 10)
+	if err != nil {
+		http.Error(w, "invalid count", http.StatusBadRequest)
+		return
+	}
+
+	prefix := ""
+	if t := tenantFrom(r); t != nil {
+		prefix = TenantPrefix(t.Name)
+	}
+
+	if name := query.Get("namespace"); name != "" {
+		if !hs.cache.HasNamespace(name) {
+			http.Error(w, "namespace not found", http.StatusNotFound)
+			return
+		}
+		prefix += hs.cache.Namespace(name).Key("")
+	}
+
+	// 命名空间的名字中没有 glob 的特殊字符，可以直接拼接在 pattern 前面
+	pattern := query.Get("pattern")
+	if prefix != "" {
+		if pattern == "" {
+			pattern = "*"
+		}
+		pattern = prefix + pattern
+	}
+
+	keys, next, err := hs.cache.ScanContext(r.Context(), cursor, pattern, count)
+	if err != nil {
+		// 超时的响应由 serveWithTimeout 返回，这里只会被丢弃
+		http.Error(w, err.Error(), http.StatusGatewayTimeout)
+		return
+	}
+	for i := range keys {
+		keys[i] = strings.TrimPrefix(keys[i], prefix)
+	}
+
+	if keys == nil {
+		keys = []string{}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys":   keys,
+		"cursor": next,
+	})
+}
+
+// typeHandler 返回 key 的类型，key 不存在时类型是 none
+func (hs *HTTPServer) typeHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"type": hs.cache.Type(params.ByName("key")),
+	})
+}
+
+// objectHandler 返回 key 的类型、编码、空闲时间和占用的字节数等内部信息，key 不存在时返回 404
+func (hs *HTTPServer) objectHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	info, ok := hs.cache.Object(params.ByName("key"))
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+// prefixesHandler 返回每个 key 前缀分组的使用情况
+func (hs *HTTPServer) prefixesHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"prefixes": hs.cache.PrefixStats(),
+	})
+}
+
+// importRDBHandler 将请求体中的 Redis RDB 文件里的字符串键值对导入到缓存中
+func (hs *HTTPServer) importRDBHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	stats, err := rdb.Import(hs.cache, r.Body)
+	if err != nil {
+		// 出错之前导入的数据不会回滚，所以也返回导入的结果
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error": err.Error(),
+			"stats": stats,
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// exportHandler 以 NDJSON 格式返回缓存中的所有数据
+func (hs *HTTPServer) exportHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	hs.cache.ExportNDJSON(w)
+}
+
+// importHandler 将请求体中 NDJSON 格式的数据导入到缓存中
+func (hs *HTTPServer) importHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	imported, err := hs.cache.ImportNDJSON(r.Body)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error":    err.Error(),
+			"imported": imported,
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"imported": imported,
+	})
+}
+
+// listBackupsHandler 返回所有的备份
+func (hs *HTTPServer) listBackupsHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	names, err := hs.backups.List(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"backups": names,
+	})
+}
+
+// createBackupHandler 立即进行一次备份
+func (hs *HTTPServer) createBackupHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	name, err := hs.backups.BackupNow(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"name": name,
+	})
+}
+
+// restoreBackupHandler 使用指定的备份恢复缓存数据
+func (hs *HTTPServer) restoreBackupHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	err := hs.backups.Restore(r.Context(), params.ByName("name"))
+	if err == backups.ErrNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// rewriteAOFHandler 立即使用缓存当前的数据重写 AOF，重写结束后才返回，没有开启 AOF 时返回 409
+func (hs *HTTPServer) rewriteAOFHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	err := hs.cache.RewriteAOF()
+	if errors.Is(err, caches.ErrNoAOF) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	stats := hs.cache.Stats()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"aof_size":     stats.AOFSize,
+		"aof_rewrites": stats.AOFRewrites,
+	})
+}
+
+// saveHandler 立即进行一次持久化，持久化结束后才返回
+func (hs *HTTPServer) saveHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	if err := hs.saver.Save(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"last_save": hs.cache.LastSave().Unix(),
+	})
+}
+
+// bgsaveHandler 在后台进行一次持久化，如果已经有后台持久化在进行就返回 409
+func (hs *HTTPServer) bgsaveHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	if !hs.saver.BackgroundSave() {
+		http.Error(w, "background save already in progress", http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// snapshotHandler 触发一次后台持久化，wait=true 时等待持久化结束再返回上次成功持久化的时间
+// 已经有后台持久化在进行时返回 409
+func (hs *HTTPServer) snapshotHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	if r.URL.Query().Get("wait") != "true" {
+		hs.bgsaveHandler(w, r, params)
+		return
+	}
+
+	if hs.saver.Saving() {
+		http.Error(w, "background save already in progress", http.StatusConflict)
+		return
+	}
+	hs.saveHandler(w, r, params)
+}
+
+// lastSaveHandler 返回上次成功持久化的时间和持久化的状态
+func (hs *HTTPServer) lastSaveHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	status := map[string]interface{}{
+		"last_save":          hs.cache.LastSave().Unix(),
+		"changes_since_save": hs.cache.Dirty(),
+		"bgsave_in_progress": hs.saver.Saving(),
+	}
+
+	if err := hs.saver.LastError(); err != nil {
+		status["last_save_error"] = err.Error()
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// intParam 解析非负整数参数，s 为空时返回 defaultValue
+func intParam(s string, defaultValue int) (int, error) {
+	if s == "" {
+		return defaultValue, nil
+	}
+
+	value, err := strconv.Atoi(s)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid integer %q", s)
+	}
+	return value, nil
+}
+
+// ttlParam 解析请求的存活时间，优先使用 ttl 参数，没有时使用 X-TTL 请求头，格式可以是 10s 这样的时间间隔或者秒数
+// 都没有时使用 expire_at 参数或者 X-Expire-At 请求头中的过期时间，见 parseTime，过期时间已经过去时返回错误
+// 全都没有时返回 caches.NeverExpire
+func ttlParam(r *http.Request) (time.Duration, error) {
+	value := r.URL.Query().Get("ttl")
+	if value == "" {
+		value = r.Header.Get("X-TTL")
+	}
+
+	if value != "" {
+		return parseTTL(value)
+	}
+
+	if value = r.URL.Query().Get("expire_at"); value == "" {
+		value = r.Header.Get("X-Expire-At")
+	}
+
+	if value == "" {
+		return caches.NeverExpire, nil
+	}
+
+	at, err := parseTime(value)
+	if err != nil {
+		return 0, err
+	}
+
+	ttl := time.Until(at)
+	if ttl <= 0 {
+		return 0, fmt.Errorf("expire_at %s is in the past", value)
+	}
+	return ttl, nil
+}
+
+// hasTTLParam 返回请求是否指定了存活时间或者过期时间
+func hasTTLParam(r *http.Request) bool {
+	query := r.URL.Query()
+	return query.Get("ttl") != "" || r.Header.Get("X-TTL") != "" || query.Get("expire_at") != "" || r.Header.Get("X-Expire-At") != ""
+}
+
+// defaultTTLOf 返回没有指定过期时间时写入 key 使用的过期时间
+// 通过命名空间写入或者 key 在有名字的命名空间中时是命名空间默认的过期时间，否则见 SetDefaultTTL
+func (hs *HTTPServer) defaultTTLOf(r *http.Request, key string) time.Duration {
+	if namespace := namespaceFrom(r); namespace != nil {
+		return namespace.DefaultTTL()
+	}
+
+	if ttl, ok := hs.cache.NamespaceDefaultTTL(key); ok {
+		return ttl
+	}
+	return hs.defaultTTL
+}
+
+// priorityParam 解析请求的淘汰优先级，优先使用 priority 参数，没有时使用 X-Priority 请求头，都没有时为 PriorityNormal
+func priorityParam(r *http.Request) (caches.Priority, error) {
+	value := r.URL.Query().Get("priority")
+	if value == "" {
+		value = r.Header.Get("X-Priority")
+	}
+	return caches.ParsePriority(value)
+}
+
+// parseTime 解析时间点，可以是 RFC3339 格式的时间，比如 2006-01-02T15:04:05Z，或者 Unix 时间戳的秒数
+func parseTime(value string) (time.Time, error) {
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	return time.Parse(time.RFC3339Nano, value)
+}
+
+// parseTTL 解析存活时间，可以是 10s 这样的时间间隔或者秒数 10，value 为空时返回 NeverExpire
+func parseTTL(value string) (time.Duration, error) {
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return durationParam(value, caches.NeverExpire)
+}
+
+// durationParam 解析时间间隔参数，比如 10s，s 为空时返回 defaultValue
+func durationParam(s string, defaultValue time.Duration) (time.Duration, error) {
+	if s == "" {
+		return defaultValue, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// reloadHandler 重新加载配置
+func (hs *HTTPServer) reloadHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	if err := hs.reload(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+}
+
+// writeJSON 将 v 编码成 JSON 字符串后写入响应，编码使用池中的缓冲区
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if err := json.NewEncoder(buf).Encode(v); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Encode 会在末尾加上换行，去掉之后和 json.Marshal 的结果一样
+	buf.Truncate(buf.Len() - 1)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,172 @@
+package servers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gocache/caches"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSetRejectsLargeManifest(t *testing.T) {
+	forged := "\x00gocache:large\x00{\"generation\":1,\"parts\":-1,\"size\":1}"
+	for _, threshold := range []int{0, 4} {
+		options := caches.DefaultOptions()
+		options.LargeObjectThreshold = threshold
+		handler := NewHTTPServer(caches.NewCacheWithOptions(options)).handler()
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/cache/a", strings.NewReader(forged)))
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("threshold %d: PUT = %d, want 400", threshold, w.Code)
+		}
+
+		for _, method := range []string{http.MethodGet, http.MethodDelete} {
+			w = httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(method, "/cache/a", nil))
+			if w.Code >= http.StatusInternalServerError {
+				t.Fatalf("threshold %d: %s = %d", threshold, method, w.Code)
+			}
+		}
+	}
+}
+
+func TestWriteInternalKeyRejected(t *testing.T) {
+	cache := caches.NewCache()
+	handler := NewHTTPServer(cache).handler()
+	requests := []struct {
+		method, path, body string
+	}{
+		{http.MethodPut, "/cache/x%00gocache:y", "v"},
+		{http.MethodGet, "/cache/x%00gocache:y", ""},
+		{http.MethodPost, "/locks/x%00gocache:y", ""},
+		{http.MethodPost, "/batch", `[{"op":"set","key":"x\u0000gocache:y","value":"v"}]`},
+		{http.MethodPost, "/expire", `{"x\u0000gocache:y":10}`},
+		{http.MethodPost, "/expireat", `{"x\u0000gocache:y":1893456000}`},
+	}
+
+	for _, request := range requests {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(request.method, request.path, strings.NewReader(request.body)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s %s = %d, want 400", request.method, request.path, w.Code)
+		}
+	}
+
+	ts := NewTCPServer(cache)
+	authenticated := true
+	if status, _ := ts.handle(OpSet, "x\x00gocache:y", []byte("v"), &authenticated); status != StatusError {
+		t.Errorf("TCP set = %d, want StatusError", status)
+	}
+
+	gs := NewGRPCServer(cache)
+	if _, err := gs.set(context.Background(), &grpcSetRequest{Key: "x\x00gocache:y", Value: []byte("v")}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("gRPC set = %v, want InvalidArgument", err)
+	}
+
+	if count, bytes := cache.Count(), cache.Bytes(); count != 0 || bytes != 0 {
+		t.Fatalf("Count = %d, Bytes = %d after rejected writes", count, bytes)
+	}
+}
+
+func TestWriteCannotTouchReservation(t *testing.T) {
+	cache := caches.NewCache()
+	handler := NewHTTPServer(cache).handler()
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/reservations/job?ttl=1m", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST /reservations/job = %d: %s", w.Code, w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/cache/job%00gocache:reservation", strings.NewReader("0")))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("PUT reservation key = %d, want 400", w.Code)
+	}
+
+	if reservation, ok := cache.GetReservation("job"); !ok || reservation.TTL <= 0 {
+		t.Fatalf("GetReservation = %+v, %v, want the original reservation", reservation, ok)
+	}
+}
+
+func TestDefaultTTL(t *testing.T) {
+	options := caches.DefaultOptions()
+	options.Namespaces = []caches.Namespace{{Name: "sessions", DefaultTTL: time.Minute}}
+	cache := caches.NewCacheWithOptions(options)
+	hs := NewHTTPServer(cache)
+	hs.SetDefaultTTL(time.Hour)
+	handler := hs.handler()
+	requests := []struct {
+		method, path, body string
+	}{
+		{http.MethodPut, "/cache/http", "v"},
+		{http.MethodPut, "/cache/explicit?ttl=10s", "v"},
+		{http.MethodPost, "/batch", `[{"op":"set","key":"batch","value":"v"},{"op":"set","key":"sessions:batch","value":"v"}]`},
+		{http.MethodPost, "/cache/incr/incr", ""},
+		{http.MethodPost, "/cache/sessions/incr/incr", ""},
+	}
+
+	for _, request := range requests {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(request.method, request.path, strings.NewReader(request.body)))
+		if w.Code >= http.StatusBadRequest {
+			t.Fatalf("%s %s = %d", request.method, request.path, w.Code)
+		}
+	}
+
+	ts := NewTCPServer(cache)
+	ts.SetDefaultTTL(time.Hour)
+	authenticated := true
+	if status, _ := ts.handle(OpSet, "tcp", []byte("v"), &authenticated); status != StatusOK {
+		t.Fatalf("TCP set = %d, want StatusOK", status)
+	}
+
+	gs := NewGRPCServer(cache)
+	gs.SetDefaultTTL(time.Hour)
+	if _, err := gs.set(context.Background(), &grpcSetRequest{Key: "grpc", Value: []byte("v")}); err != nil {
+		t.Fatalf("gRPC set = %v", err)
+	}
+
+	for _, key := range []string{"http", "batch", "incr", "tcp", "grpc"} {
+		if ttl, ok := cache.TTL(key); !ok || ttl <= 10*time.Second || ttl > time.Hour {
+			t.Errorf("TTL(%q) = %s, %v, want about 1h", key, ttl, ok)
+		}
+	}
+
+	for _, key := range []string{"sessions:batch", "sessions:incr"} {
+		if ttl, ok := cache.TTL(key); !ok || ttl <= 10*time.Second || ttl > time.Minute {
+			t.Errorf("TTL(%q) = %s, %v, want about 1m", key, ttl, ok)
+		}
+	}
+
+	if ttl, ok := cache.TTL("explicit"); !ok || ttl > 10*time.Second {
+		t.Errorf("TTL(\"explicit\") = %s, %v, want at most 10s", ttl, ok)
+	}
+}
+
+func TestNotModifiedObserved(t *testing.T) {
+	cache := caches.NewCache()
+	cache.Set("k", []byte("v"))
+	hs := NewHTTPServer(cache)
+	handler := hs.handler()
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/cache/k", nil))
+	request := httptest.NewRequest(http.MethodGet, "/cache/k", nil)
+	request.Header.Set("If-None-Match", w.Header().Get("ETag"))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, request)
+	if w.Code != http.StatusNotModified {
+		t.Fatalf("conditional GET = %d, want 304", w.Code)
+	}
+
+	if count := hs.getLatency.Stats().Count; count != 2 {
+		t.Fatalf("get latency count = %d, want 2", count)
+	}
+}
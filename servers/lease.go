@@ -0,0 +1,104 @@
+package servers
+
+import (
+	"gocache/caches"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// leaseParams 解析租约请求的 holder 和 ttl 参数，ttl 默认为 30s，参数不合法时返回 400
+func leaseParams(w http.ResponseWriter, r *http.Request) (holder string, ttl time.Duration, ok bool) {
+	query := r.URL.Query()
+	holder = query.Get("holder")
+	if holder == "" {
+		http.Error(w, "missing holder", http.StatusBadRequest)
+		return "", 0, false
+	}
+
+	ttl, err := durationParam(query.Get("ttl"), defaultLockTTL)
+	if err != nil || ttl <= 0 {
+		http.Error(w, "invalid ttl", http.StatusBadRequest)
+		return "", 0, false
+	}
+	return holder, ttl, true
+}
+
+// writeLease 将 key 上的租约写入响应
+func writeLease(w http.ResponseWriter, code int, key string, lease caches.Lease) {
+	body := map[string]interface{}{
+		"key":    key,
+		"holder": lease.Holder,
+		"ttl_ms": lease.TTL.Milliseconds(),
+	}
+
+	if lease.Token != 0 {
+		body["token"] = strconv.FormatUint(lease.Token, 10)
+	}
+
+	if code == http.StatusConflict {
+		body["error"] = "held by another holder"
+	}
+	writeJSON(w, code, body)
+}
+
+// acquireLeaseHandler 为 holder 参数指定的持有者获取租约，ttl 参数是租约的存活时间
+// 已经持有时相当于续约，被其他持有者持有时返回 409 和当前的持有者
+func (hs *HTTPServer) acquireLeaseHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	holder, ttl, ok := leaseParams(w, r)
+	if !ok {
+		return
+	}
+
+	key := params.ByName("key")
+	lease, ok := hs.cache.AcquireLease(key, holder, ttl)
+	if !ok {
+		writeLease(w, http.StatusConflict, key, lease)
+		return
+	}
+	writeLease(w, http.StatusOK, key, lease)
+}
+
+// renewLeaseHandler 续约，持有者需要每隔一段时间调用一次，租约已经过期或者被其他持有者获取时返回 409
+func (hs *HTTPServer) renewLeaseHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	holder, ttl, ok := leaseParams(w, r)
+	if !ok {
+		return
+	}
+
+	key := params.ByName("key")
+	lease, ok := hs.cache.RenewLease(key, holder, ttl)
+	if !ok {
+		writeLease(w, http.StatusConflict, key, lease)
+		return
+	}
+	writeLease(w, http.StatusOK, key, lease)
+}
+
+// releaseLeaseHandler 释放 holder 参数指定的持有者的租约，租约已经过期或者被其他持有者获取时返回 409
+func (hs *HTTPServer) releaseLeaseHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	holder := r.URL.Query().Get("holder")
+	if holder == "" {
+		http.Error(w, "missing holder", http.StatusBadRequest)
+		return
+	}
+
+	if !hs.cache.ReleaseLease(params.ByName("key"), holder) {
+		writeJSON(w, http.StatusConflict, map[string]interface{}{"error": "not held", "key": params.ByName("key")})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getLeaseHandler 返回 key 上当前的租约，没有租约时返回 404
+func (hs *HTTPServer) getLeaseHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	key := params.ByName("key")
+	lease, ok := hs.cache.GetLease(key)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	writeLease(w, http.StatusOK, key, lease)
+}
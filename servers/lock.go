@@ -0,0 +1,62 @@
+package servers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// defaultLockTTL 是没有指定 ttl 参数时锁的存活时间
+const defaultLockTTL = 30 * time.Second
+
+// lockHandler 获取 key 上的锁，ttl 参数是锁的存活时间，比如 10s，默认为 30s
+// 成功时返回 fencing token，锁已经被持有时返回 409，超出命名空间的配额或者缓存已满时返回 507
+func (hs *HTTPServer) lockHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	ttl, err := durationParam(r.URL.Query().Get("ttl"), defaultLockTTL)
+	if err != nil || ttl <= 0 {
+		http.Error(w, "invalid ttl", http.StatusBadRequest)
+		return
+	}
+
+	key := params.ByName("key")
+	lock := hs.cache.TryLock
+	if quotaChecked(r) {
+		lock = hs.cache.LockWithQuota
+	}
+
+	token, ok, err := lock(key, ttl)
+	if err != nil {
+		writeQuotaError(w, r, err)
+		return
+	}
+
+	if !ok {
+		writeJSON(w, http.StatusConflict, map[string]interface{}{"error": "locked", "key": key})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"key":    key,
+		"token":  strconv.FormatUint(token, 10),
+		"ttl_ms": ttl.Milliseconds(),
+	})
+}
+
+// unlockHandler 释放 key 上的锁，token 参数是获取锁时返回的 fencing token
+// 锁已经过期或者被其他持有者获取时返回 409
+func (hs *HTTPServer) unlockHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	token, err := strconv.ParseUint(r.URL.Query().Get("token"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid token", http.StatusBadRequest)
+		return
+	}
+
+	key := params.ByName("key")
+	if !hs.cache.Unlock(key, token) {
+		writeJSON(w, http.StatusConflict, map[string]interface{}{"error": "not held", "key": key})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
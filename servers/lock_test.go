@@ -0,0 +1,27 @@
+package servers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gocache/caches"
+)
+
+func TestLockCacheFull(t *testing.T) {
+	options := caches.DefaultOptions()
+	options.MaxEntries = 1
+	options.RejectWhenFull = true
+	handler := NewHTTPServer(caches.NewCacheWithOptions(options)).handler()
+
+	for _, test := range []struct {
+		key  string
+		code int
+	}{{"a", http.StatusOK}, {"a", http.StatusConflict}, {"b", http.StatusInsufficientStorage}} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/locks/"+test.key, nil))
+		if w.Code != test.code {
+			t.Errorf("POST /locks/%s = %d, want %d", test.key, w.Code, test.code)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package servers
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// listenerConfig 是一个需要监听的地址，listener 不为 nil 时表示已经监听好的地址
+type listenerConfig struct {
+	listener  net.Listener
+	network   string
+	address   string
+	server    Server
+	tlsConfig *tls.Config
+}
+
+// Manager 在同一个缓存上同时运行多个服务器，比如分别监听 TCP 地址和 Unix socket 的 HTTP 服务器
+// 所有地址都监听成功才会开始处理请求，关闭时会关闭所有的服务器
+type Manager struct {
+	// configs 是所有需要监听的地址
+	configs []listenerConfig
+
+	// listeners 是所有正在监听的地址，没有经过 TLS 包装
+	listeners []net.Listener
+
+	// servers 是已经开始运行的服务器，同一个服务器可能监听了多个地址，但只会被记录一次
+	servers []Server
+
+	// errs 用于传递服务器运行期间出现的错误
+	errs chan error
+
+	// wg 用于等待所有服务器退出
+	wg sync.WaitGroup
+}
+
+// NewManager 返回一个新的服务器管理器
+func NewManager() *Manager {
+	return &Manager{errs: make(chan error, 1)}
+}
+
+// Add 让 server 在 network 类型的 address 上监听，network 可以是 tcp 或者 unix
+func (m *Manager) Add(network string, address string, server Server) {
+	m.AddTLS(network, address, server, nil)
+}
+
+// AddTLS 让 server 在 network 类型的 address 上监听，连接会使用 tlsConfig 进行加密，tlsConfig 为 nil 时不加密
+func (m *Manager) AddTLS(network string, address string, server Server, tlsConfig *tls.Config) {
+	m.configs = append(m.configs, listenerConfig{network: network, address: address, server: server, tlsConfig: tlsConfig})
+}
+
+// AddListener 让 server 在已经监听好的 listener 上处理请求，比如 systemd 通过 socket activation 传递的监听
+// 连接会使用 tlsConfig 进行加密，tlsConfig 为 nil 时不加密
+func (m *Manager) AddListener(listener net.Listener, server Server, tlsConfig *tls.Config) {
+	m.configs = append(m.configs, listenerConfig{listener: listener, server: server, tlsConfig: tlsConfig})
+}
+
+// Start 监听所有的地址并开始处理请求，有地址监听失败时会关闭已经监听的地址并返回错误
+func (m *Manager) Start() error {
+	if len(m.configs) == 0 {
+		return errors.New("no listeners configured")
+	}
+
+	listeners := make([]net.Listener, 0, len(m.configs))
+	for i, config := range m.configs {
+		if config.listener != nil {
+			listeners = append(listeners, config.listener)
+			continue
+		}
+
+		listener, err := listen(config.network, config.address)
+		if err != nil {
+			for _, listener := range listeners {
+				listener.Close()
+			}
+
+			for _, config := range m.configs[i+1:] {
+				if config.listener != nil {
+					config.listener.Close()
+				}
+			}
+			return fmt.Errorf("listen %s %s failed: %w", config.network, config.address, err)
+		}
+
+		listeners = append(listeners, listener)
+	}
+
+	m.listeners = listeners
+	for i, listener := range listeners {
+		if config := m.configs[i]; config.tlsConfig != nil {
+			listener = tls.NewListener(listener, config.tlsConfig)
+		}
+
+		server := m.configs[i].server
+		if !m.running(server) {
+			m.servers = append(m.servers, server)
+		}
+
+		m.wg.Add(1)
+		go func(server Server, listener net.Listener) {
+			defer m.wg.Done()
+			if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				select {
+				case m.errs <- fmt.Errorf("serve %s failed: %w", listener.Addr(), err):
+				default:
+				}
+			}
+		}(server, listener)
+	}
+	return nil
+}
+
+// running 返回 server 是否已经记录在正在运行的服务器中
+func (m *Manager) running(server Server) bool {
+	for _, s := range m.servers {
+		if s == server {
+			return true
+		}
+	}
+	return false
+}
+
+// Files 返回所有正在监听的地址对应的文件，顺序和添加的顺序一致，可以传递给子进程继续监听
+// 返回的文件是复制出来的，调用 Shutdown 之后仍然可以使用，Unix socket 在 Shutdown 时也不会再被删除
+func (m *Manager) Files() ([]*os.File, error) {
+	files := make([]*os.File, 0, len(m.listeners))
+	for _, listener := range m.listeners {
+		if unixListener, ok := listener.(*net.UnixListener); ok {
+			unixListener.SetUnlinkOnClose(false)
+		}
+
+		filer, ok := listener.(interface{ File() (*os.File, error) })
+		if !ok {
+			closeFiles(files)
+			return nil, fmt.Errorf("listener %s can not be converted to a file", listener.Addr())
+		}
+
+		file, err := filer.File()
+		if err != nil {
+			closeFiles(files)
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// closeFiles 关闭 files 中所有的文件
+func closeFiles(files []*os.File) {
+	for _, file := range files {
+		file.Close()
+	}
+}
+
+// Errors 返回服务器运行期间出现的第一个错误，出现错误之后应该调用 Shutdown 关闭所有的服务器
+func (m *Manager) Errors() <-chan error {
+	return m.errs
+}
+
+// Shutdown 关闭所有的服务器，会等待正在处理的请求完成，直到 ctx 结束
+func (m *Manager) Shutdown(ctx context.Context) error {
+	var firstErr error
+	for _, server := range m.servers {
+		if err := server.Shutdown(ctx); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	m.wg.Wait()
+	return firstErr
+}
+
+// listen 监听 network 类型的 address，监听 Unix socket 时会先删除上次没有正常退出留下的文件
+// 文件还能连接上说明有其他进程正在使用，这时不会删除
+func listen(network string, address string) (net.Listener, error) {
+	if network == "unix" {
+		if info, err := os.Stat(address); err == nil && info.Mode()&os.ModeSocket != 0 {
+			if conn, err := net.Dial(network, address); err == nil {
+				conn.Close()
+				return nil, fmt.Errorf("%s is in use", address)
+			}
+			os.Remove(address)
+		}
+	}
+	return net.Listen(network, address)
+}
@@ -0,0 +1,120 @@
+package servers
+
+import (
+	"context"
+	"errors"
+	"gocache/caches"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// namespaceContextKey 是请求的 context 中保存命名空间的 key
+type namespaceContextKey struct{}
+
+// namespaceFrom 返回请求通过 /cache/:namespace/:key 访问的命名空间，不是时返回 nil
+func namespaceFrom(r *http.Request) *caches.NamespaceCache {
+	namespace, _ := r.Context().Value(namespaceContextKey{}).(*caches.NamespaceCache)
+	return namespace
+}
+
+// routeNamespace 把 /cache/:namespace/:key 改写成访问命名空间中的 key 的 /cache/:key，不是时返回原来的请求
+// 只有配置了的命名空间才会被改写，这时 /cache/:namespace/incr 表示命名空间中的 incr，而不是对名为 namespace 的 key 自增
+func (hs *HTTPServer) routeNamespace(r *http.Request) *http.Request {
+	const prefix = "/cache/"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		return r
+	}
+
+	rest := r.URL.Path[len(prefix):]
+	i := strings.Index(rest, "/")
+	if i <= 0 || i == len(rest)-1 || !hs.cache.HasNamespace(rest[:i]) {
+		return r
+	}
+
+	namespace := hs.cache.Namespace(rest[:i])
+	url := *r.URL
+	url.Path = prefix + namespace.Key(rest[i+1:])
+	url.RawPath = ""
+	r = r.WithContext(context.WithValue(r.Context(), namespaceContextKey{}, namespace))
+	r.URL = &url
+	return r
+}
+
+// quotaChecked 返回请求的写入是否需要检查命名空间的配额，租户的请求和通过命名空间访问的请求需要检查
+func quotaChecked(r *http.Request) bool {
+	return tenantFrom(r) != nil || namespaceFrom(r) != nil
+}
+
+// writeQuotaError 返回写入超出命名空间配额或者缓存已满的错误，key 或者 value 不能被保存时返回 400，都不是时返回 500
+func writeQuotaError(w http.ResponseWriter, r *http.Request, err error) {
+	if invalidWrite(err) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if errors.Is(err, caches.ErrCacheFull) {
+		writeJSON(w, http.StatusInsufficientStorage, map[string]interface{}{"error": "cache is full"})
+		return
+	}
+
+	var quotaErr *caches.QuotaError
+	if !errors.As(err, &quotaErr) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	result := map[string]interface{}{
+		"error":    quotaErr.Resource + " quota exceeded",
+		"resource": quotaErr.Resource,
+		"limit":    quotaErr.Limit,
+		"used":     quotaErr.Used,
+	}
+
+	if t := tenantFrom(r); t != nil {
+		result["tenant"] = t.Name
+	} else if namespace := namespaceFrom(r); namespace != nil {
+		result["namespace"] = namespace.Name()
+	}
+	writeJSON(w, http.StatusInsufficientStorage, result)
+}
+
+// invalidWrite 返回 err 是否表示请求中的数据不能被保存，这是客户端的错误，比如内部 key 或者以大对象的清单的开头开头的 value
+func invalidWrite(err error) bool {
+	return errors.Is(err, caches.ErrInternalKey) || errors.Is(err, caches.ErrReservedValue)
+}
+
+// namespacesHandler 返回所有命名空间的使用情况和配额
+func (hs *HTTPServer) namespacesHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	namespaces := make([]map[string]interface{}, 0)
+	for _, stats := range hs.cache.NamespaceStats() {
+		namespaces = append(namespaces, map[string]interface{}{
+			"name":           stats.Name,
+			"keys":           stats.Keys,
+			"bytes":          stats.Bytes,
+			"hits":           stats.Hits,
+			"misses":         stats.Misses,
+			"max_keys":       stats.MaxKeys,
+			"max_bytes":      stats.MaxBytes,
+			"default_ttl_ms": hs.cache.Namespace(stats.Name).DefaultTTL().Milliseconds(),
+		})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"namespaces": namespaces,
+	})
+}
+
+// flushNamespaceHandler 删除命名空间中所有的 key，返回删除的个数，命名空间不存在时返回 404
+func (hs *HTTPServer) flushNamespaceHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	name := params.ByName("name")
+	if !hs.cache.HasNamespace(name) {
+		http.Error(w, "namespace not found", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"deleted": hs.cache.Namespace(name).Flush(),
+	})
+}
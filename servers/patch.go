@@ -0,0 +1,472 @@
+package servers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gocache/caches"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	// mergePatchType 是 JSON Merge Patch（RFC 7386）的 Content-Type，也是没有指定 Content-Type 时的默认值
+	mergePatchType = "application/merge-patch+json"
+
+	// jsonPatchType 是 JSON Patch（RFC 6902）的 Content-Type，操作的位置使用 JSON Pointer（RFC 6901）表示
+	jsonPatchType = "application/json-patch+json"
+)
+
+// errNotJSON 表示缓存中的 value 不是 JSON
+var errNotJSON = errors.New("value is not json")
+
+// pointerUnescaper 还原 JSON Pointer 中转义的 / 和 ~
+var pointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+
+// patchOp 是 JSON Patch 中的一个操作
+type patchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  *string         `json:"from"`
+	Value json.RawMessage `json:"value"`
+
+	// path 和 from 是解析之后的 JSON Pointer，value 是解析之后的 Value
+	path  []string
+	from  []string
+	value interface{}
+}
+
+// patchHandler 使用请求体中的补丁修改 JSON 格式的 value，整个修改在缓存中原子地进行，不会改变 key 的过期时间
+// Content-Type 为 application/json-patch+json 时请求体是 JSON Patch，否则是 JSON Merge Patch，成功时返回修改后的 value
+// key 不存在时返回 404，补丁格式错误时返回 400，value 不是 JSON 或者补丁不能应用时返回 409
+func (hs *HTTPServer) patchHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	start := time.Now()
+	key := params.ByName("key")
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if err := readBody(r, buf); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+
+	apply, err := parsePatch(r.Header.Get("Content-Type"), buf.Bytes())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	patch := func(value []byte) ([]byte, error) {
+		doc, err := decodeJSON(value)
+		if err != nil {
+			return nil, errNotJSON
+		}
+
+		if doc, err = apply(doc); err != nil {
+			return nil, err
+		}
+		return json.Marshal(doc)
+	}
+
+	update := hs.cache.Update
+	if quotaChecked(r) {
+		update = hs.cache.UpdateWithQuota
+	}
+
+	value, ok, err := update(key, patch)
+	var quotaErr *caches.QuotaError
+	switch {
+	case !ok:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	case errors.As(err, &quotaErr):
+		writeQuotaError(w, r, err)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	hs.observe(&hs.setLatency, "patch", r, key, len(value), start)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(value)
+}
+
+// patchError 是补丁不能应用到 value 上的错误
+type patchError struct {
+	op     string
+	reason string
+}
+
+func (pe *patchError) Error() string {
+	return fmt.Sprintf("%s failed: %s", pe.op, pe.reason)
+}
+
+// parsePatch 根据 contentType 解析补丁，返回把补丁应用到文档上的函数
+func parsePatch(contentType string, body []byte) (func(doc interface{}) (interface{}, error), error) {
+	mediaType := mergePatchType
+	if contentType != "" {
+		var err error
+		if mediaType, _, err = mime.ParseMediaType(contentType); err != nil {
+			return nil, err
+		}
+	}
+
+	switch mediaType {
+	case mergePatchType, "application/json":
+		patch, err := decodeJSON(body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid merge patch: %w", err)
+		}
+
+		return func(doc interface{}) (interface{}, error) {
+			return mergePatch(doc, patch), nil
+		}, nil
+	case jsonPatchType:
+		ops, err := parseJSONPatch(body)
+		if err != nil {
+			return nil, err
+		}
+
+		return func(doc interface{}) (interface{}, error) {
+			return applyJSONPatch(doc, ops)
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported content type %q, expected %s or %s", mediaType, mergePatchType, jsonPatchType)
+}
+
+// decodeJSON 解码 JSON，数字保存为 json.Number，这样修改之后不会丢失精度
+func decodeJSON(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	if decoder.More() {
+		return nil, errors.New("unexpected data after json value")
+	}
+	return v, nil
+}
+
+// mergePatch 按照 RFC 7386 将 patch 合并到 target 中，patch 中为 null 的字段会被删除
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	fields, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	object, ok := target.(map[string]interface{})
+	if !ok {
+		object = make(map[string]interface{}, len(fields))
+	}
+
+	for name, value := range fields {
+		if value == nil {
+			delete(object, name)
+			continue
+		}
+		object[name] = mergePatch(object[name], value)
+	}
+	return object
+}
+
+// parseJSONPatch 解析 JSON Patch 中的所有操作，并检查操作需要的字段
+func parseJSONPatch(body []byte) ([]patchOp, error) {
+	var ops []patchOp
+	if err := json.Unmarshal(body, &ops); err != nil {
+		return nil, fmt.Errorf("invalid json patch: %w", err)
+	}
+
+	for i := range ops {
+		op := &ops[i]
+		var err error
+		if op.path, err = parsePointer(op.Path); err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+
+		switch op.Op {
+		case "add", "replace", "test":
+			if op.Value == nil {
+				return nil, fmt.Errorf("operation %d: %s requires value", i, op.Op)
+			}
+
+			if op.value, err = decodeJSON(op.Value); err != nil {
+				return nil, fmt.Errorf("operation %d: invalid value: %w", i, err)
+			}
+		case "move", "copy":
+			// 缺少 from 时不能当作整个文档
+			if op.From == nil {
+				return nil, fmt.Errorf("operation %d: %s requires from", i, op.Op)
+			}
+
+			if op.from, err = parsePointer(*op.From); err != nil {
+				return nil, fmt.Errorf("operation %d: invalid from: %w", i, err)
+			}
+		case "remove":
+		default:
+			return nil, fmt.Errorf("operation %d: unknown op %q", i, op.Op)
+		}
+	}
+	return ops, nil
+}
+
+// parsePointer 将 JSON Pointer 解析成每一级的名字，空字符串表示整个文档
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+
+	if pointer[0] != '/' {
+		return nil, fmt.Errorf("invalid json pointer %q", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = pointerUnescaper.Replace(token)
+	}
+	return tokens, nil
+}
+
+// applyJSONPatch 按照 RFC 6902 依次把 ops 应用到 doc 上，任何一个操作失败时返回错误，返回修改后的文档
+func applyJSONPatch(doc interface{}, ops []patchOp) (interface{}, error) {
+	var err error
+	for _, op := range ops {
+		switch op.Op {
+		case "add":
+			doc, err = addValue(doc, op.path, op.value)
+		case "remove":
+			doc, _, err = removeValue(doc, op.path)
+		case "replace":
+			if doc, _, err = removeValue(doc, op.path); err == nil {
+				doc, err = addValue(doc, op.path, op.value)
+			}
+		case "move":
+			if isPrefix(op.from, op.path) && len(op.from) < len(op.path) {
+				return nil, &patchError{op: op.Op, reason: "cannot move " + *op.From + " into itself"}
+			}
+
+			var value interface{}
+			if doc, value, err = removeValue(doc, op.from); err == nil {
+				doc, err = addValue(doc, op.path, value)
+			}
+		case "copy":
+			var value interface{}
+			if value, err = getValue(doc, op.from); err == nil {
+				doc, err = addValue(doc, op.path, copyValue(value))
+			}
+		case "test":
+			var value interface{}
+			if value, err = getValue(doc, op.path); err == nil && !equalJSON(value, op.value) {
+				err = errors.New("value at " + op.Path + " is different")
+			}
+		}
+
+		if err != nil {
+			return nil, &patchError{op: op.Op, reason: err.Error()}
+		}
+	}
+	return doc, nil
+}
+
+// getValue 返回 doc 中 path 位置的值
+func getValue(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, errors.New("member " + strconv.Quote(token) + " not found")
+			}
+			doc = value
+		case []interface{}:
+			i, err := arrayIndex(token, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, errors.New("cannot traverse " + strconv.Quote(token) + " in a scalar")
+		}
+	}
+	return doc, nil
+}
+
+// modifyParent 使用 fn 修改 doc 中 path 的父节点，fn 返回修改后的父节点，数组添加或删除元素之后需要替换掉原来的数组
+func modifyParent(doc interface{}, path []string, fn func(parent interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return fn(doc, path[0])
+	}
+
+	child, err := getValue(doc, path[:1])
+	if err != nil {
+		return nil, err
+	}
+
+	if child, err = modifyParent(child, path[1:], fn); err != nil {
+		return nil, err
+	}
+
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		node[path[0]] = child
+	case []interface{}:
+		i, _ := arrayIndex(path[0], len(node)-1)
+		node[i] = child
+	}
+	return doc, nil
+}
+
+// addValue 将 value 添加到 doc 中 path 的位置，对象的成员已经存在时替换，数组在下标的位置插入，"-" 表示追加到末尾
+func addValue(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return modifyParent(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			node[token] = value
+			return node, nil
+		case []interface{}:
+			if token == "-" {
+				return append(node, value), nil
+			}
+
+			i, err := arrayIndex(token, len(node))
+			if err != nil {
+				return nil, err
+			}
+
+			node = append(node, nil)
+			copy(node[i+1:], node[i:])
+			node[i] = value
+			return node, nil
+		}
+		return nil, errors.New("cannot add " + strconv.Quote(token) + " to a scalar")
+	})
+}
+
+// removeValue 删除 doc 中 path 位置的值，返回修改后的文档和删除的值
+func removeValue(doc interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, doc, nil
+	}
+
+	var removed interface{}
+	doc, err := modifyParent(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, errors.New("member " + strconv.Quote(token) + " not found")
+			}
+			removed = value
+			delete(node, token)
+			return node, nil
+		case []interface{}:
+			i, err := arrayIndex(token, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+			removed = node[i]
+			return append(node[:i], node[i+1:]...), nil
+		}
+		return nil, errors.New("cannot remove " + strconv.Quote(token) + " from a scalar")
+	})
+	return doc, removed, err
+}
+
+// arrayIndex 解析数组下标，下标不能有多余的前导 0，也不能超过 max
+func arrayIndex(token string, max int) (int, error) {
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || strconv.Itoa(i) != token {
+		return 0, errors.New("invalid array index " + strconv.Quote(token))
+	}
+
+	if i > max {
+		return 0, errors.New("array index " + token + " out of range")
+	}
+	return i, nil
+}
+
+// isPrefix 返回 prefix 是否是 path 的前缀
+func isPrefix(prefix []string, path []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// copyValue 深拷贝解码之后的 JSON 值，避免 copy 之后两处共享同一个对象或者数组
+func copyValue(v interface{}) interface{} {
+	switch node := v.(type) {
+	case map[string]interface{}:
+		object := make(map[string]interface{}, len(node))
+		for name, value := range node {
+			object[name] = copyValue(value)
+		}
+		return object
+	case []interface{}:
+		array := make([]interface{}, len(node))
+		for i, value := range node {
+			array[i] = copyValue(value)
+		}
+		return array
+	}
+	return v
+}
+
+// equalJSON 比较两个解码之后的 JSON 值，数字按照数值比较，所以 1 和 1.0 相等
+func equalJSON(a interface{}, b interface{}) bool {
+	switch x := a.(type) {
+	case json.Number:
+		y, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+
+		fx, errX := x.Float64()
+		fy, errY := y.Float64()
+		return errX == nil && errY == nil && fx == fy
+	case map[string]interface{}:
+		y, ok := b.(map[string]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+
+		for name, value := range x {
+			other, ok := y[name]
+			if !ok || !equalJSON(value, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+
+		for i := range x {
+			if !equalJSON(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
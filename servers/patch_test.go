@@ -0,0 +1,194 @@
+package servers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gocache/caches"
+)
+
+// applyPatch 把 contentType 类型的补丁应用到 JSON 文档 doc 上，返回修改后的文档
+func applyPatch(contentType string, doc string, patch string) (string, error) {
+	apply, err := parsePatch(contentType, []byte(patch))
+	if err != nil {
+		return "", err
+	}
+
+	value, err := decodeJSON([]byte(doc))
+	if err != nil {
+		return "", err
+	}
+
+	if value, err = apply(value); err != nil {
+		return "", err
+	}
+
+	result, err := json.Marshal(value)
+	return string(result), err
+}
+
+// canonical 返回 JSON 文档的规范形式，对象的成员按照名字排序，用于比较
+func canonical(t *testing.T, doc string) string {
+	value, err := decodeJSON([]byte(doc))
+	if err != nil {
+		t.Fatalf("invalid json %s: %v", doc, err)
+	}
+
+	result, _ := json.Marshal(value)
+	return string(result)
+}
+
+// RFC 6902 附录 A 中的例子，以及 move、copy 和数组下标的边界情况，want 为空表示补丁应该失败
+var jsonPatchTests = []struct {
+	name  string
+	doc   string
+	patch string
+	want  string
+}{
+	{"A.1 adding an object member", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`},
+	{"A.2 adding an array element", `{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`},
+	{"A.3 removing an object member", `{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`},
+	{"A.4 removing an array element", `{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`},
+	{"A.5 replacing a value", `{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`},
+	{"A.6 moving a value", `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`, `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`},
+	{"A.7 moving an array element", `{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`},
+	{"A.8 testing a value success", `{"baz":"qux","foo":["a",2,"c"]}`, `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`, `{"baz":"qux","foo":["a",2,"c"]}`},
+	{"A.9 testing a value error", `{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"bar"}]`, ``},
+	{"A.10 adding a nested member object", `{"foo":"bar"}`, `[{"op":"add","path":"/child","value":{"grandchild":{}}}]`, `{"foo":"bar","child":{"grandchild":{}}}`},
+	{"A.11 ignoring unrecognized elements", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux","xyz":123}]`, `{"foo":"bar","baz":"qux"}`},
+	{"A.12 adding to a nonexistent target", `{"foo":"bar"}`, `[{"op":"add","path":"/baz/bat","value":"qux"}]`, ``},
+	{"A.14 escape ordering", `{"/":9,"~1":10}`, `[{"op":"test","path":"/~01","value":10}]`, `{"/":9,"~1":10}`},
+	{"A.15 comparing strings and numbers", `{"/":9,"~1":10}`, `[{"op":"test","path":"/~01","value":"10"}]`, ``},
+	{"A.16 adding an array value", `{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`, `{"foo":["bar",["abc","def"]]}`},
+
+	{"add replaces the document", `{"foo":"bar"}`, `[{"op":"add","path":"","value":[1]}]`, `[1]`},
+	{"add null value", `{}`, `[{"op":"add","path":"/a","value":null}]`, `{"a":null}`},
+	{"add at end index", `[1,2]`, `[{"op":"add","path":"/2","value":3}]`, `[1,2,3]`},
+	{"add past end index", `[1,2]`, `[{"op":"add","path":"/3","value":3}]`, ``},
+	{"add with leading zero index", `[1,2]`, `[{"op":"add","path":"/01","value":3}]`, ``},
+	{"add to a scalar", `{"a":1}`, `[{"op":"add","path":"/a/b","value":3}]`, ``},
+	{"remove dash index", `[1,2]`, `[{"op":"remove","path":"/-"}]`, ``},
+	{"remove missing member", `{"a":1}`, `[{"op":"remove","path":"/b"}]`, ``},
+	{"replace missing member", `{"a":1}`, `[{"op":"replace","path":"/b","value":2}]`, ``},
+	{"replace dash index", `[1,2]`, `[{"op":"replace","path":"/-","value":3}]`, ``},
+	{"replace array element", `[1,2,3]`, `[{"op":"replace","path":"/1","value":9}]`, `[1,9,3]`},
+	{"test dash index", `[1,2]`, `[{"op":"test","path":"/-","value":2}]`, ``},
+	{"test numbers by value", `{"a":1}`, `[{"op":"test","path":"/a","value":1.0}]`, `{"a":1}`},
+	{"test whole document", `{"a":[1,{"b":2}]}`, `[{"op":"test","path":"","value":{"a":[1,{"b":2}]}}]`, `{"a":[1,{"b":2}]}`},
+	{"move to itself", `{"a":{"b":1}}`, `[{"op":"move","from":"/a","path":"/a"}]`, `{"a":{"b":1}}`},
+	{"move into a child", `{"a":{"b":1}}`, `[{"op":"move","from":"/a","path":"/a/c"}]`, ``},
+	{"move to a sibling with common prefix", `{"a":1}`, `[{"op":"move","from":"/a","path":"/ab"}]`, `{"ab":1}`},
+	{"move missing member", `{"a":1}`, `[{"op":"move","from":"/b","path":"/c"}]`, ``},
+	{"move to end of array", `{"a":[1,2],"b":3}`, `[{"op":"move","from":"/b","path":"/a/-"}]`, `{"a":[1,2,3]}`},
+	{"move from dash index", `{"a":[1,2]}`, `[{"op":"move","from":"/a/-","path":"/b"}]`, ``},
+	{"copy is deep", `{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"},{"op":"replace","path":"/c/b","value":2}]`, `{"a":{"b":1},"c":{"b":2}}`},
+	{"copy into itself", `{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/a/c"}]`, `{"a":{"b":1,"c":{"b":1}}}`},
+	{"copy array element to end", `[1,2]`, `[{"op":"copy","from":"/0","path":"/-"}]`, `[1,2,1]`},
+	{"copy missing member", `{"a":1}`, `[{"op":"copy","from":"/b","path":"/c"}]`, ``},
+	{"later failure", `{"a":1}`, `[{"op":"add","path":"/b","value":2},{"op":"test","path":"/a","value":2}]`, ``},
+}
+
+func TestJSONPatch(t *testing.T) {
+	for _, test := range jsonPatchTests {
+		got, err := applyPatch(jsonPatchType, test.doc, test.patch)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("%s: got %s, want an error", test.name, got)
+			}
+			continue
+		}
+
+		if err != nil || got != canonical(t, test.want) {
+			t.Errorf("%s: got %s, %v, want %s", test.name, got, err, test.want)
+		}
+	}
+}
+
+func TestJSONPatchInvalid(t *testing.T) {
+	for _, patch := range []string{
+		`{"op":"add","path":"/a","value":1}`,
+		`[{"op":"add","path":"/a"}]`,
+		`[{"op":"move","path":"/a"}]`,
+		`[{"op":"move","from":"a","path":"/b"}]`,
+		`[{"op":"remove","path":"a"}]`,
+		`[{"op":"unknown","path":"/a"}]`,
+	} {
+		if _, err := parsePatch(jsonPatchType, []byte(patch)); err == nil {
+			t.Errorf("parsePatch(%s) succeeded", patch)
+		}
+	}
+}
+
+// RFC 7386 附录 A 中的例子
+var mergePatchTests = []struct {
+	doc   string
+	patch string
+	want  string
+}{
+	{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+	{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+	{`{"a":"b"}`, `{"a":null}`, `{}`},
+	{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+	{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+	{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+	{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+	{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+	{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+	{`{"a":"b"}`, `["c"]`, `["c"]`},
+	{`{"a":"foo"}`, `null`, `null`},
+	{`{"a":"foo"}`, `"bar"`, `"bar"`},
+	{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+	{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+	{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+}
+
+func TestMergePatch(t *testing.T) {
+	for _, test := range mergePatchTests {
+		got, err := applyPatch(mergePatchType, test.doc, test.patch)
+		if err != nil || got != canonical(t, test.want) {
+			t.Errorf("merge %s into %s: got %s, %v, want %s", test.patch, test.doc, got, err, test.want)
+		}
+	}
+}
+
+func TestPatchFailureLeavesValueUnchanged(t *testing.T) {
+	cache := caches.NewCache()
+	original := `{"a":1,"list":[1,2,3],"nested":{"b":true}}`
+	cache.Set("k", []byte(original))
+	handler := NewHTTPServer(cache).handler()
+
+	for _, test := range []struct {
+		contentType string
+		patch       string
+		code        int
+	}{
+		// 前面的操作成功之后 test 失败，前面的修改也不能保存
+		{jsonPatchType, `[{"op":"remove","path":"/list/0"},{"op":"add","path":"/nested/c","value":1},{"op":"test","path":"/a","value":2}]`, http.StatusConflict},
+		{jsonPatchType, `[{"op":"move","from":"/nested","path":"/moved"},{"op":"remove","path":"/missing"}]`, http.StatusConflict},
+		{jsonPatchType, `[{"op":"add","path":"/list/-","value":4},{"op":"bogus","path":"/a"}]`, http.StatusBadRequest},
+		{mergePatchType, `{"a":`, http.StatusBadRequest},
+	} {
+		r := httptest.NewRequest(http.MethodPatch, "/cache/k", strings.NewReader(test.patch))
+		r.Header.Set("Content-Type", test.contentType)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != test.code {
+			t.Errorf("PATCH %s = %d, want %d", test.patch, w.Code, test.code)
+		}
+
+		if value, _ := cache.Get("k"); string(value) != original {
+			t.Fatalf("value after failed PATCH %s = %s", test.patch, value)
+		}
+	}
+
+	cache.Set("text", []byte("not json"))
+	r := httptest.NewRequest(http.MethodPatch, "/cache/text", strings.NewReader(`{"a":1}`))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if value, _ := cache.Get("text"); w.Code != http.StatusConflict || string(value) != "not json" {
+		t.Errorf("PATCH non-json value = %d, value %q", w.Code, value)
+	}
+}
@@ -0,0 +1,257 @@
+package servers
+
+import (
+	"context"
+	"crypto/subtle"
+	"gocache/caches"
+	"net/http"
+	"strings"
+)
+
+const (
+	// ActionRead 是读取缓存中的 key
+	ActionRead = "read"
+
+	// ActionWrite 是写入缓存中的 key
+	ActionWrite = "write"
+
+	// ActionDelete 是删除缓存中的 key
+	ActionDelete = "delete"
+
+	// ActionStats 是查看 /status 和 /stats
+	ActionStats = "stats"
+
+	// ActionAdmin 是访问 /admin/ 下的管理接口
+	ActionAdmin = "admin"
+
+	// ActionAll 匹配所有的操作
+	ActionAll = "*"
+)
+
+// Actions 是策略中可以使用的所有操作
+var Actions = []string{ActionRead, ActionWrite, ActionDelete, ActionStats, ActionAdmin, ActionAll}
+
+// Subject 是使用自己的 API key 访问的主体，只能执行策略允许的操作
+type Subject struct {
+	// Name 是主体的名字，策略通过名字引用主体
+	Name string
+
+	// APIKeys 是主体使用的 API key
+	APIKeys []string
+}
+
+// Policy 是一条授权规则，允许 Subject 对匹配 Keys 的 key 执行 Actions 中的操作
+type Policy struct {
+	// Subject 是规则作用的主体的名字，* 表示所有主体
+	Subject string
+
+	// Actions 是允许的操作，取值见 Actions
+	Actions []string
+
+	// Keys 是规则作用的 key 的模式，* 匹配任意个字符，比如 "a:*"
+	// 为空表示所有的 key，不涉及 key 的操作只会匹配 Keys 为空的规则
+	Keys []string
+}
+
+// policies 是运行中的授权策略
+type policies struct {
+	subjects []Subject
+	rules    []Policy
+}
+
+// authorization 是发出请求的主体和当时的授权策略
+type authorization struct {
+	policies *policies
+	subject  *Subject
+}
+
+// authorizationContextKey 是请求的 context 中保存 authorization 的 key，只有批量操作的请求会保存
+type authorizationContextKey struct{}
+
+// authorizationFrom 返回批量操作请求的主体和授权策略，不是主体的请求返回 nil
+func authorizationFrom(r *http.Request) *authorization {
+	auth, _ := r.Context().Value(authorizationContextKey{}).(*authorization)
+	return auth
+}
+
+// withAuthorization 返回在 context 中保存了主体和授权策略的请求
+func withAuthorization(r *http.Request, p *policies, subject *Subject) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), authorizationContextKey{}, &authorization{policies: p, subject: subject}))
+}
+
+// SetPolicies 设置主体和授权策略，使用主体 API key 的请求只有被某条策略允许时才会处理，否则返回 403
+// 使用 SetAPIKeys 设置的 API key 不受策略限制，设置了主体时，没有带 API key 的请求不再被当作管理员
+// 服务器运行期间也可以调用，用于重新加载配置
+func (hs *HTTPServer) SetPolicies(subjects []Subject, rules []Policy) {
+	hs.policies.Store(&policies{subjects: subjects, rules: rules})
+}
+
+// loadPolicies 返回当前的授权策略，没有设置时返回 nil
+func (hs *HTTPServer) loadPolicies() *policies {
+	p, _ := hs.policies.Load().(*policies)
+	return p
+}
+
+// findSubject 返回使用 key 的主体，没有时返回 nil
+// 使用固定时间的比较，避免通过响应时间猜出 key
+func (p *policies) findSubject(key string) *Subject {
+	if p == nil || key == "" {
+		return nil
+	}
+
+	var found *Subject
+	for i := range p.subjects {
+		for _, apiKey := range p.subjects[i].APIKeys {
+			if subtle.ConstantTimeCompare([]byte(key), []byte(apiKey)) == 1 {
+				found = &p.subjects[i]
+			}
+		}
+	}
+	return found
+}
+
+// allowed 返回 subject 是否可以对 key 执行 action，key 为空表示操作不涉及 key
+func (p *policies) allowed(subject string, action string, key string) bool {
+	for _, rule := range p.rules {
+		if rule.Subject != ActionAll && rule.Subject != subject {
+			continue
+		}
+
+		if !containsAction(rule.Actions, action) {
+			continue
+		}
+
+		if len(rule.Keys) == 0 {
+			return true
+		}
+
+		if key == "" {
+			continue
+		}
+
+		for _, pattern := range rule.Keys {
+			if matchPattern(pattern, key) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// requestAction 返回请求对应的操作和 key，不属于任何操作的请求返回空字符串
+func requestAction(r *http.Request) (action string, key string) {
+	path := r.URL.Path
+	switch {
+	case strings.HasPrefix(path, "/locks/"), strings.HasPrefix(path, "/semaphores/"), strings.HasPrefix(path, "/ratelimits/"):
+		// 获取和释放锁、信号量的许可以及取出令牌都会修改 key
+		return ActionWrite, pathKey(path)
+	case strings.HasPrefix(path, "/leases/"), strings.HasPrefix(path, "/reservations/"):
+		key = pathKey(path)
+		if r.Method == http.MethodGet {
+			return ActionRead, key
+		}
+		return ActionWrite, key
+	case path == "/sessions" || strings.HasPrefix(path, "/sessions/"):
+		// 会话的 key 是会话在缓存中的 key，创建会话时还没有 key
+		key = ""
+		if id := strings.TrimPrefix(path, "/sessions/"); id != path {
+			key = caches.SessionPrefix + id
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			return ActionRead, key
+		case http.MethodDelete:
+			return ActionDelete, key
+		default:
+			return ActionWrite, key
+		}
+	case path == batchPath:
+		// 批量操作中的每个操作在 batchHandler 中分别检查，这里只当作读取
+		return ActionRead, ""
+	case path == "/expire" || path == "/expireat":
+		// 批量修改过期时间会涉及多个 key
+		return ActionWrite, ""
+	case strings.HasPrefix(path, "/type/"), strings.HasPrefix(path, "/object/"):
+		return ActionRead, pathKey(path)
+	case path == "/cache" && r.Method == http.MethodDelete:
+		// 清空整个缓存只允许管理员
+		return ActionAdmin, ""
+	case path == "/randomkey" || path == "/cache" || path == "/events":
+		// 随机返回、遍历返回和事件中的 key 事先不知道
+		return ActionRead, ""
+	case path == "/flush" || strings.HasPrefix(path, "/flush/"):
+		// 异步删除涉及多个 key，查看进度当作读取
+		if r.Method == http.MethodGet {
+			return ActionRead, ""
+		}
+		return ActionDelete, ""
+	case strings.HasPrefix(path, "/users/"):
+		// 删除用户的所有会话会涉及多个 key
+		return ActionDelete, ""
+	case strings.HasPrefix(path, "/cache/"):
+		key = pathKey(path)
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			return ActionRead, key
+		case http.MethodDelete:
+			return ActionDelete, key
+		default:
+			return ActionWrite, key
+		}
+	case path == "/status" || path == "/stats" || path == "/metrics" || path == "/cluster/nodes":
+		return ActionStats, ""
+	case strings.HasPrefix(path, "/admin/"):
+		return ActionAdmin, ""
+	}
+	return "", ""
+}
+
+// authorize 检查主体的请求是否被策略允许，不允许时返回 403
+func (hs *HTTPServer) authorize(w http.ResponseWriter, r *http.Request, p *policies, subject *Subject) bool {
+	action, key := requestAction(r)
+	if action != "" && p.allowed(subject.Name, action, key) {
+		return true
+	}
+
+	writeJSON(w, http.StatusForbidden, map[string]interface{}{
+		"error":   "forbidden",
+		"subject": subject.Name,
+		"action":  action,
+		"key":     key,
+	})
+	return false
+}
+
+// containsAction 返回 actions 中是否包含 action 或者 ActionAll
+func containsAction(actions []string, action string) bool {
+	for _, a := range actions {
+		if a == action || a == ActionAll {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPattern 返回 key 是否匹配 pattern，pattern 中的 * 匹配任意个字符，其他字符需要完全相同
+func matchPattern(pattern string, key string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == key
+	}
+
+	if !strings.HasPrefix(key, parts[0]) {
+		return false
+	}
+	key = key[len(parts[0]):]
+
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		index := strings.Index(key, part)
+		if index < 0 {
+			return false
+		}
+		key = key[index+len(part):]
+	}
+	return len(key) >= len(last) && strings.HasSuffix(key, last)
+}
@@ -0,0 +1,62 @@
+package servers
+
+import (
+	"gocache/replication"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// SetReplica 把本节点设置为 replica 的主节点的副本，副本只提供读取，修改缓存的请求返回 403，直到被提升为主节点
+// 设置后会提供查看复制状态和提升为主节点的管理接口
+func (hs *HTTPServer) SetReplica(replica *replication.Replica) {
+	hs.replica = replica
+}
+
+// rejectWrite 在本节点是只读的副本并且 r 会修改缓存时返回 403 并返回 true
+func (hs *HTTPServer) rejectWrite(w http.ResponseWriter, r *http.Request) bool {
+	if !hs.replica.ReadOnly() {
+		return false
+	}
+
+	if action, _ := requestAction(r); action != ActionWrite && action != ActionDelete {
+		return false
+	}
+
+	writeJSON(w, http.StatusForbidden, map[string]interface{}{
+		"error":   "read only replica",
+		"primary": hs.replica.Primary(),
+	})
+	return true
+}
+
+// replicationStatus 返回本节点的复制状态，副本返回复制的进度，主节点返回连接着的副本个数
+func (hs *HTTPServer) replicationStatus() map[string]interface{} {
+	if hs.replica != nil && hs.replica.ReadOnly() {
+		return map[string]interface{}{
+			"role":    "replica",
+			"replica": hs.replica.Status(),
+		}
+	}
+
+	return map[string]interface{}{
+		"role":     "primary",
+		"replicas": hs.cache.Subscribers(),
+	}
+}
+
+// replicationStreamHandler 把本节点的数据发送给连接过来的副本，直到副本断开
+func (hs *HTTPServer) replicationStreamHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	replication.Serve(w, r, hs.cache)
+}
+
+// replicationHandler 返回副本的复制状态
+func (hs *HTTPServer) replicationHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	writeJSON(w, http.StatusOK, hs.replica.Status())
+}
+
+// promoteHandler 停止复制并把副本提升为主节点，之后可以写入，用于主节点故障时手动切换
+func (hs *HTTPServer) promoteHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	hs.replica.Promote()
+	writeJSON(w, http.StatusOK, hs.replica.Status())
+}
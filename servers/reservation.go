@@ -0,0 +1,112 @@
+package servers
+
+import (
+	"errors"
+	"gocache/caches"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// reserveHandler 预留还没有 value 的 key，ttl 参数是预留的存活时间，比如 1m，默认为 30s，成功时返回 fencing token
+// key 已经被预留时返回 409 和当前预留剩余的存活时间，key 已经有 value 时返回 409 和 "exists"，这时直接读取 key 就可以了
+func (hs *HTTPServer) reserveHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	ttl, err := durationParam(r.URL.Query().Get("ttl"), defaultLockTTL)
+	if err != nil || ttl <= 0 {
+		http.Error(w, "invalid ttl", http.StatusBadRequest)
+		return
+	}
+
+	key := params.ByName("key")
+	reservation, ok := hs.cache.Reserve(key, ttl)
+	switch {
+	case ok:
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"key":    key,
+			"token":  strconv.FormatUint(reservation.Token, 10),
+			"ttl_ms": reservation.TTL.Milliseconds(),
+		})
+	case reservation.Token == 0:
+		writeJSON(w, http.StatusConflict, map[string]interface{}{"error": "exists", "key": key})
+	default:
+		writeJSON(w, http.StatusConflict, map[string]interface{}{
+			"error":  "reserved",
+			"key":    key,
+			"ttl_ms": reservation.TTL.Milliseconds(),
+		})
+	}
+}
+
+// completeHandler 完成 token 参数对应的预留，请求体是 key 的 value，ttl 和 expire_at 参数和 PUT /cache/:key 一样是 value 的过期时间
+// 预留已经过期、被取消或者被其他生产者重新预留时返回 409，value 不会被保存
+func (hs *HTTPServer) completeHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	token, err := strconv.ParseUint(r.URL.Query().Get("token"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid token", http.StatusBadRequest)
+		return
+	}
+
+	ttl, err := ttlParam(r)
+	if err != nil || ttl < 0 {
+		http.Error(w, "invalid ttl", http.StatusBadRequest)
+		return
+	}
+
+	key := params.ByName("key")
+	if !hasTTLParam(r) {
+		ttl = hs.defaultTTLOf(r, key)
+	}
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if err := readBody(r, buf); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+
+	complete := hs.cache.Complete
+	if quotaChecked(r) {
+		complete = hs.cache.CompleteWithQuota
+	}
+
+	version, err := complete(key, token, buf.Bytes(), ttl)
+	switch {
+	case errors.Is(err, caches.ErrNotReserved):
+		writeJSON(w, http.StatusConflict, map[string]interface{}{"error": "not reserved", "key": key})
+	case err != nil:
+		writeQuotaError(w, r, err)
+	default:
+		w.Header().Set("X-Version", strconv.FormatUint(version, 10))
+		w.Header().Set("ETag", etag(version))
+		hs.writeSet(w, r, key)
+	}
+}
+
+// cancelReservationHandler 取消 token 参数对应的预留，预留已经过期或者被其他生产者重新预留时返回 409
+func (hs *HTTPServer) cancelReservationHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	token, err := strconv.ParseUint(r.URL.Query().Get("token"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid token", http.StatusBadRequest)
+		return
+	}
+
+	key := params.ByName("key")
+	if !hs.cache.CancelReservation(key, token) {
+		writeJSON(w, http.StatusConflict, map[string]interface{}{"error": "not reserved", "key": key})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getReservationHandler 返回 key 上当前的预留剩余的存活时间，没有预留时返回 404
+// 不返回 token，只有预留的生产者可以完成或者取消预留
+func (hs *HTTPServer) getReservationHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	key := params.ByName("key")
+	reservation, ok := hs.cache.GetReservation(key)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"key": key, "ttl_ms": reservation.TTL.Milliseconds()})
+}
@@ -0,0 +1,97 @@
+package servers
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// acquireSemaphoreHandler 获取 key 上计数信号量的一个许可，limit 参数是最多同时发出的许可数，ttl 参数是许可的存活时间，默认为 30s
+// 成功时返回许可的 token，许可已经发完时返回 409
+func (hs *HTTPServer) acquireSemaphoreHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	query := r.URL.Query()
+	limit, err := intParam(query.Get("limit"), 0)
+	if err != nil || limit <= 0 {
+		http.Error(w, "invalid limit", http.StatusBadRequest)
+		return
+	}
+
+	ttl, err := durationParam(query.Get("ttl"), defaultLockTTL)
+	if err != nil || ttl <= 0 {
+		http.Error(w, "invalid ttl", http.StatusBadRequest)
+		return
+	}
+
+	key := params.ByName("key")
+	token, used, ok := hs.cache.AcquireSemaphore(key, limit, ttl)
+	if !ok {
+		writeJSON(w, http.StatusConflict, map[string]interface{}{"error": "no permits", "key": key, "used": used, "limit": limit})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"key":    key,
+		"token":  strconv.FormatUint(token, 10),
+		"used":   used,
+		"limit":  limit,
+		"ttl_ms": ttl.Milliseconds(),
+	})
+}
+
+// releaseSemaphoreHandler 释放 key 上 token 参数对应的许可，许可已经过期时返回 409
+func (hs *HTTPServer) releaseSemaphoreHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	token, err := strconv.ParseUint(r.URL.Query().Get("token"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid token", http.StatusBadRequest)
+		return
+	}
+
+	key := params.ByName("key")
+	if !hs.cache.ReleaseSemaphore(key, token) {
+		writeJSON(w, http.StatusConflict, map[string]interface{}{"error": "not held", "key": key})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// rateLimitHandler 从 key 上的令牌桶中取出 n 个令牌，n 默认为 1，rate 参数是每秒补充的令牌数，burst 参数是桶的容量，默认等于 rate
+// 令牌不够时返回 429，Retry-After 是需要等待的秒数
+func (hs *HTTPServer) rateLimitHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	query := r.URL.Query()
+	rate, err := strconv.ParseFloat(query.Get("rate"), 64)
+	if err != nil || rate <= 0 || math.IsInf(rate, 0) {
+		http.Error(w, "invalid rate", http.StatusBadRequest)
+		return
+	}
+
+	burst, err := intParam(query.Get("burst"), int(math.Ceil(rate)))
+	if err != nil || burst <= 0 {
+		http.Error(w, "invalid burst", http.StatusBadRequest)
+		return
+	}
+
+	n, err := intParam(query.Get("n"), 1)
+	if err != nil || n <= 0 || n > burst {
+		http.Error(w, "invalid n", http.StatusBadRequest)
+		return
+	}
+
+	key := params.ByName("key")
+	ok, remaining, retryAfter := hs.cache.TakeTokens(key, rate, burst, n)
+	body := map[string]interface{}{
+		"key":       key,
+		"allowed":   ok,
+		"remaining": math.Floor(remaining),
+		"limit":     burst,
+	}
+
+	if !ok {
+		body["retry_after_ms"] = retryAfter.Milliseconds()
+		w.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(retryAfter.Seconds())), 10))
+		writeJSON(w, http.StatusTooManyRequests, body)
+		return
+	}
+	writeJSON(w, http.StatusOK, body)
+}
@@ -1,9 +1,33 @@
 // 用于存放服务器相关方法
 package servers
 
+import (
+	"context"
+	"crypto/tls"
+	"net"
+)
+
 // Server 是服务器结构的接口。
 // 抽象出一个接口是因为后续还会提供 TCP 服务
 type Server interface {
 	// Run 在 address 上启动服务器，并返回错误信息
 	Run(address string) error
+
+	// RunTLS 使用 certFile 和 keyFile 指定的证书和私钥在 address 上启动使用 TLS 的服务器
+	RunTLS(address string, certFile string, keyFile string) error
+
+	// Serve 在 listener 上接收连接并处理，直到 listener 被关闭或者服务器被关闭
+	Serve(listener net.Listener) error
+
+	// Shutdown 关闭服务器，会等待正在处理的请求完成，直到 ctx 结束
+	Shutdown(ctx context.Context) error
+}
+
+// listenTLS 在 address 上监听使用 certFile 和 keyFile 指定的证书和私钥的 TLS 连接，nextProtos 是 ALPN 支持的协议
+func listenTLS(address string, certFile string, keyFile string, nextProtos ...string) (net.Listener, error) {
+	certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return tls.Listen("tcp", address, &tls.Config{Certificates: []tls.Certificate{certificate}, NextProtos: nextProtos})
 }
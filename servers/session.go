@@ -0,0 +1,118 @@
+package servers
+
+import (
+	"encoding/json"
+	"gocache/caches"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// defaultSessionTTL 是没有指定 ttl 参数时会话的存活时间
+const defaultSessionTTL = 30 * time.Minute
+
+// writeSession 将会话写入响应
+func writeSession(w http.ResponseWriter, code int, session caches.Session) {
+	writeJSON(w, code, map[string]interface{}{
+		"id":         session.ID,
+		"user":       session.User,
+		"attributes": session.Attributes,
+		"ttl_ms":     session.TTL.Milliseconds(),
+		"expires_ms": session.ExpiresIn.Milliseconds(),
+	})
+}
+
+// readAttributes 读取请求体中 JSON 对象格式的会话属性，请求体为空时返回 nil
+func readAttributes(r *http.Request) (map[string]string, error) {
+	buffer := getBuffer()
+	defer putBuffer(buffer)
+	if err := readBody(r, buffer); err != nil {
+		return nil, err
+	}
+
+	if buffer.Len() == 0 {
+		return nil, nil
+	}
+
+	var attributes map[string]string
+	err := json.Unmarshal(buffer.Bytes(), &attributes)
+	return attributes, err
+}
+
+// createSessionHandler 为 user 参数指定的用户创建会话，ttl 参数是会话的存活时间，默认为 30m，请求体是 JSON 对象格式的初始属性
+func (hs *HTTPServer) createSessionHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	query := r.URL.Query()
+	ttl, err := durationParam(query.Get("ttl"), defaultSessionTTL)
+	if err != nil || ttl <= 0 {
+		http.Error(w, "invalid ttl", http.StatusBadRequest)
+		return
+	}
+
+	attributes, err := readAttributes(r)
+	if err != nil {
+		http.Error(w, "invalid attributes", http.StatusBadRequest)
+		return
+	}
+
+	session, err := hs.cache.CreateSession(query.Get("user"), attributes, ttl)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeSession(w, http.StatusCreated, session)
+}
+
+// getSessionHandler 返回会话，同时续约，renew 参数为 false 时不续约，会话不存在或者已经过期时返回 404
+func (hs *HTTPServer) getSessionHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	session, ok := hs.cache.GetSession(params.ByName("id"), r.URL.Query().Get("renew") != "false")
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	writeSession(w, http.StatusOK, session)
+}
+
+// renewSessionHandler 续约会话，会话不存在或者已经过期时返回 404
+func (hs *HTTPServer) renewSessionHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	session, ok := hs.cache.RenewSession(params.ByName("id"))
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	writeSession(w, http.StatusOK, session)
+}
+
+// setSessionAttributesHandler 修改会话的属性并续约，请求体是 JSON 对象格式的属性，值为空字符串的属性会被删除
+func (hs *HTTPServer) setSessionAttributesHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	attributes, err := readAttributes(r)
+	if err != nil {
+		http.Error(w, "invalid attributes", http.StatusBadRequest)
+		return
+	}
+
+	session, ok := hs.cache.SetSessionAttributes(params.ByName("id"), attributes)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	writeSession(w, http.StatusOK, session)
+}
+
+// deleteSessionHandler 删除会话，也就是登出，会话不存在或者已经过期时返回 404
+func (hs *HTTPServer) deleteSessionHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	if !hs.cache.DeleteSession(params.ByName("id")) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deleteUserSessionsHandler 删除用户的所有会话，返回删除的会话个数
+func (hs *HTTPServer) deleteUserSessionsHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	user := params.ByName("user")
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"user":    user,
+		"deleted": hs.cache.DeleteUserSessions(user),
+	})
+}
@@ -0,0 +1,174 @@
+package servers
+
+import (
+	"bytes"
+	"context"
+	"gocache/logs"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// shadowHeader 标记请求是复制过来的影子流量，影子集群也开启了复制时不会再复制一次
+	shadowHeader = "X-Gocache-Shadow"
+
+	// shadowQueueSize 是等待复制的请求的个数上限，影子集群跟不上时超出的请求会被丢弃
+	shadowQueueSize = 1024
+
+	// shadowWorkers 是发送影子流量的协程数
+	shadowWorkers = 4
+
+	// defaultShadowTimeout 是发送一个影子请求的默认超时时间
+	defaultShadowTimeout = 5 * time.Second
+
+	// maxShadowBodySize 是会被复制的请求体的最大字节数，复制需要把请求体读到内存中，更大或者长度未知的请求不复制
+	maxShadowBodySize = 1 << 20
+)
+
+// shadowPaths 是会被复制的接口的前缀，只复制读写缓存数据的请求，管理、统计和流式的请求不复制
+var shadowPaths = []string{"/cache/", batchPath, "/expire"}
+
+// shadow 把一部分请求异步地复制到另一个 gocache，不等待结果也不影响原来的请求
+type shadow struct {
+	url     string
+	percent float64
+	client  *http.Client
+	queue   chan *http.Request
+
+	// mirrored 是复制成功的请求数，dropped 是队列满了被丢弃的请求数，errors 是发送失败的请求数
+	// skipped 是请求体超过 maxShadowBodySize 或者长度未知而没有复制的请求数
+	mirrored int64
+	dropped  int64
+	errors   int64
+	skipped  int64
+}
+
+// SetShadow 开启影子流量，把 percent% 的读写缓存数据的请求异步复制到 url 上的 gocache，用于验证新版本或者预热替换的集群
+// 复制的请求带有原来的请求头，所以影子集群需要使用相同的认证配置，影子集群的响应会被忽略
+// timeout 是发送一个请求的超时时间，为 0 时使用 5s，影子集群跟不上时超出队列的请求会被丢弃
+func (hs *HTTPServer) SetShadow(url string, percent float64, timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = defaultShadowTimeout
+	}
+
+	s := &shadow{
+		url:     strings.TrimSuffix(url, "/"),
+		percent: percent,
+		client:  &http.Client{Timeout: timeout},
+		queue:   make(chan *http.Request, shadowQueueSize),
+	}
+
+	for i := 0; i < shadowWorkers; i++ {
+		go s.run()
+	}
+	hs.shadow = s
+}
+
+// mirror 按照比例抽样，把 r 的副本放入发送队列，uri 是副本的路径和参数，需要复制请求体时会把它读到内存中，并替换掉 r 的请求体
+// 请求体超过 maxShadowBodySize 或者长度未知时不复制，避免大的写入和流式上传被缓存在内存中
+// 请求在处理它的节点上授权之后复制，单个 key 的请求由转发到的节点复制，批量操作拆分之后转发的请求和影子请求不会再复制
+func (s *shadow) mirror(r *http.Request, uri string) {
+	forwarded := r.Header.Get(forwardedHeader) != "" && !keyedPath(r.URL.Path)
+	if forwarded || r.Header.Get(shadowHeader) != "" || !shadowed(r.URL.Path) {
+		return
+	}
+
+	if rand.Float64()*100 >= s.percent {
+		return
+	}
+
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		if r.ContentLength < 0 || r.ContentLength > maxShadowBodySize {
+			atomic.AddInt64(&s.skipped, 1)
+			return
+		}
+
+		var err error
+		if body, err = ioutil.ReadAll(io.LimitReader(r.Body, maxShadowBodySize+1)); err != nil {
+			// 读取失败时原来的请求也读不到完整的请求体，交给处理请求的代码返回错误
+			r.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(body), errorReader{err}))
+			return
+		}
+
+		// 请求体比声明的长度更长时，把读出的部分和剩下的部分拼起来交给处理请求的代码
+		if len(body) > maxShadowBodySize {
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+			atomic.AddInt64(&s.skipped, 1)
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	request, err := http.NewRequestWithContext(context.Background(), r.Method, s.url+uri, bytes.NewReader(body))
+	if err != nil {
+		atomic.AddInt64(&s.errors, 1)
+		return
+	}
+	request.Header = r.Header.Clone()
+	request.Header.Del(forwardedHeader)
+	request.Header.Set(shadowHeader, "1")
+
+	select {
+	case s.queue <- request:
+	default:
+		atomic.AddInt64(&s.dropped, 1)
+	}
+}
+
+// run 发送队列中的影子请求
+func (s *shadow) run() {
+	for request := range s.queue {
+		response, err := s.client.Do(request)
+		if err != nil {
+			atomic.AddInt64(&s.errors, 1)
+			logs.Debugf("shadow %s %s failed: %v", request.Method, request.URL.Path, err)
+			continue
+		}
+
+		io.Copy(ioutil.Discard, response.Body)
+		response.Body.Close()
+		atomic.AddInt64(&s.mirrored, 1)
+	}
+}
+
+// stats 返回影子流量的统计数据
+func (s *shadow) stats() map[string]interface{} {
+	return map[string]interface{}{
+		"url":      s.url,
+		"percent":  s.percent,
+		"mirrored": atomic.LoadInt64(&s.mirrored),
+		"dropped":  atomic.LoadInt64(&s.dropped),
+		"errors":   atomic.LoadInt64(&s.errors),
+		"skipped":  atomic.LoadInt64(&s.skipped),
+		"queued":   len(s.queue),
+	}
+}
+
+// shadowed 返回 path 上的请求是否需要复制
+func shadowed(path string) bool {
+	for _, prefix := range shadowPaths {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// errorReader 是总是返回 err 的 io.Reader
+type errorReader struct {
+	err error
+}
+
+// Read 返回 err
+func (er errorReader) Read(p []byte) (int, error) {
+	return 0, er.err
+}
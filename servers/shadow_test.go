@@ -0,0 +1,101 @@
+package servers
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gocache/caches"
+)
+
+// newPolicyServer 返回只允许 reader 读取 a:* 的服务器，reader 使用 API key r
+func newPolicyServer() *HTTPServer {
+	hs := NewHTTPServer(caches.NewCache())
+	hs.SetPolicies([]Subject{{Name: "reader", APIKeys: []string{"r"}}}, []Policy{
+		{Subject: "reader", Actions: []string{ActionRead}, Keys: []string{"a:*"}},
+	})
+	return hs
+}
+
+// serve 使用 API key 发送请求，返回响应的状态码
+func serve(handler http.Handler, method string, path string, key string) int {
+	r := httptest.NewRequest(method, path, strings.NewReader("value"))
+	r.Header.Set("X-API-Key", key)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w.Code
+}
+
+func TestShadowMirrorsOnlyAuthorized(t *testing.T) {
+	hs := newPolicyServer()
+	// 不启动发送的协程，直接检查队列中的请求
+	hs.shadow = &shadow{url: "http://shadow", percent: 100, queue: make(chan *http.Request, 10)}
+	handler := hs.handler()
+
+	if code := serve(handler, http.MethodPut, "/cache/a:1", "r"); code != http.StatusForbidden {
+		t.Fatalf("PUT by reader = %d, want 403", code)
+	}
+
+	if code := serve(handler, http.MethodGet, "/cache/b:1", "r"); code != http.StatusForbidden {
+		t.Fatalf("GET outside the policy = %d, want 403", code)
+	}
+
+	if code := serve(handler, http.MethodGet, "/cache/a:1", "unknown"); code != http.StatusUnauthorized {
+		t.Fatalf("GET with unknown key = %d, want 401", code)
+	}
+
+	if n := len(hs.shadow.queue); n != 0 {
+		t.Fatalf("%d rejected requests were mirrored", n)
+	}
+
+	serve(handler, http.MethodGet, "/cache/a:1", "r")
+	if n := len(hs.shadow.queue); n != 1 {
+		t.Fatalf("mirrored %d requests, want 1", n)
+	}
+
+	if request := <-hs.shadow.queue; request.URL.String() != "http://shadow/cache/a:1" {
+		t.Errorf("mirrored %s", request.URL)
+	}
+}
+
+func TestShadowSkipsLargeBodies(t *testing.T) {
+	cache := caches.NewCache()
+	hs := NewHTTPServer(cache)
+	hs.shadow = &shadow{url: "http://shadow", percent: 100, queue: make(chan *http.Request, 10)}
+	handler := hs.handler()
+
+	large := strings.Repeat("x", maxShadowBodySize+1)
+	for name, r := range map[string]*http.Request{
+		"large":   httptest.NewRequest(http.MethodPut, "/cache/large", strings.NewReader(large)),
+		"chunked": httptest.NewRequest(http.MethodPut, "/cache/chunked", ioutil.NopCloser(strings.NewReader("value"))),
+	} {
+		if name == "chunked" {
+			r.ContentLength = -1
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("PUT %s = %d", name, w.Code)
+		}
+	}
+
+	if n := len(hs.shadow.queue); n != 0 || hs.shadow.skipped != 2 {
+		t.Fatalf("mirrored %d requests and skipped %d, want 0 and 2", n, hs.shadow.skipped)
+	}
+
+	if value, _ := cache.Get("large"); len(value) != len(large) {
+		t.Fatalf("saved %d bytes, want %d", len(value), len(large))
+	}
+
+	if value, _ := cache.Get("chunked"); string(value) != "value" {
+		t.Fatalf("saved %q, want the whole body", value)
+	}
+
+	serve(handler, http.MethodPut, "/cache/small", "")
+	if request := <-hs.shadow.queue; request.ContentLength != int64(len("value")) {
+		t.Errorf("mirrored body of %d bytes", request.ContentLength)
+	}
+}
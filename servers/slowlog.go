@@ -0,0 +1,180 @@
+package servers
+
+import (
+	"gocache/caches"
+	"gocache/logs"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// SlowLogEntry 是一条慢请求记录
+type SlowLogEntry struct {
+	// ID 是记录的编号，从 1 开始递增，清空之后也不会重置
+	ID int64 `json:"id"`
+
+	// Time 是请求开始的时间
+	Time time.Time `json:"time"`
+
+	// Operation 是请求的操作，get、set 或者 delete
+	Operation string `json:"operation"`
+
+	// Key 是请求的 key
+	Key string `json:"key"`
+
+	// Size 是 value 的字节数
+	Size int `json:"size"`
+
+	// Latency 是请求的耗时，单位是纳秒
+	Latency time.Duration `json:"latency"`
+
+	// Client 是客户端的地址
+	Client string `json:"client"`
+}
+
+// SlowLog 使用环形缓冲区记录最近的慢请求，和 Redis 的 slowlog 一样，只保留最新的若干条
+type SlowLog struct {
+	// threshold 是慢请求的耗时阈值，耗时不小于这个值的请求才会被记录，使用原子操作读写
+	threshold int64
+
+	// entries 是环形缓冲区
+	entries []SlowLogEntry
+
+	// next 是下一条记录写入的位置
+	next int
+
+	// full 表示环形缓冲区已经写满过了
+	full bool
+
+	// id 是最后一条记录的编号
+	id int64
+
+	// lock 用于保证并发安全
+	lock *sync.Mutex
+}
+
+// NewSlowLog 返回一个记录耗时不小于 threshold 的请求的慢请求日志，最多保留 size 条
+func NewSlowLog(threshold time.Duration, size int) *SlowLog {
+	if size <= 0 {
+		size = 128
+	}
+
+	return &SlowLog{
+		threshold: int64(threshold),
+		entries:   make([]SlowLogEntry, size),
+		lock:      &sync.Mutex{},
+	}
+}
+
+// Configure 修改耗时阈值和最多保留的记录数，缩小时只保留最新的记录
+func (sl *SlowLog) Configure(threshold time.Duration, size int) {
+	if size <= 0 {
+		size = 128
+	}
+
+	entries := sl.Entries(size)
+	sl.lock.Lock()
+	defer sl.lock.Unlock()
+	atomic.StoreInt64(&sl.threshold, int64(threshold))
+	sl.entries = make([]SlowLogEntry, size)
+	sl.next = 0
+	sl.full = false
+	for i := len(entries) - 1; i >= 0; i-- {
+		sl.entries[sl.next] = entries[i]
+		sl.next = (sl.next + 1) % size
+		if sl.next == 0 {
+			sl.full = true
+		}
+	}
+}
+
+// Add 记录一个请求，耗时小于阈值时直接忽略，缓冲区满了之后会覆盖最早的记录
+func (sl *SlowLog) Add(entry SlowLogEntry) {
+	if entry.Latency < time.Duration(atomic.LoadInt64(&sl.threshold)) {
+		return
+	}
+
+	sl.lock.Lock()
+	defer sl.lock.Unlock()
+	sl.id++
+	entry.ID = sl.id
+	sl.entries[sl.next] = entry
+	sl.next = (sl.next + 1) % len(sl.entries)
+	if sl.next == 0 {
+		sl.full = true
+	}
+}
+
+// Entries 返回最新的 limit 条记录，从新到旧排列，limit 不大于 0 时返回所有记录
+func (sl *SlowLog) Entries(limit int) []SlowLogEntry {
+	sl.lock.Lock()
+	defer sl.lock.Unlock()
+
+	count := sl.next
+	if sl.full {
+		count = len(sl.entries)
+	}
+
+	if limit > 0 && limit < count {
+		count = limit
+	}
+
+	entries := make([]SlowLogEntry, count)
+	for i := range entries {
+		entries[i] = sl.entries[(sl.next-1-i+len(sl.entries))%len(sl.entries)]
+	}
+	return entries
+}
+
+// Reset 清空所有记录
+func (sl *SlowLog) Reset() {
+	sl.lock.Lock()
+	defer sl.lock.Unlock()
+	sl.next = 0
+	sl.full = false
+}
+
+// observe 记录一次请求的耗时，耗时超过阈值时还会写入慢请求日志
+// 日志级别是 debug 或者 key 打开了调试日志时还会输出到服务器日志中
+func (hs *HTTPServer) observe(histogram *caches.Histogram, operation string, r *http.Request, key string, size int, start time.Time) {
+	latency := time.Since(start)
+	histogram.Observe(latency)
+	switch {
+	case logs.Traced(key):
+		logs.Tracef(key, "%s %q %d bytes in %s from %s", operation, key, size, latency, clientIP(r))
+	case logs.Enabled(logs.LevelDebug):
+		logs.Debugf("%s %q %d bytes in %s from %s", operation, key, size, latency, clientIP(r))
+	}
+
+	if hs.slowLog != nil {
+		hs.slowLog.Add(SlowLogEntry{
+			Time:      start,
+			Operation: operation,
+			Key:       key,
+			Size:      size,
+			Latency:   latency,
+			Client:    clientIP(r),
+		})
+	}
+}
+
+// slowLogHandler 返回最新的慢请求记录，limit 参数是返回的记录数，默认为 10
+func (hs *HTTPServer) slowLogHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	limit, err := intParam(r.URL.Query().Get("limit"), 10)
+	if err != nil {
+		http.Error(w, "invalid limit", http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"entries": hs.slowLog.Entries(limit),
+	})
+}
+
+// resetSlowLogHandler 清空慢请求记录
+func (hs *HTTPServer) resetSlowLogHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	hs.slowLog.Reset()
+}
@@ -0,0 +1,371 @@
+package servers
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gocache/caches"
+	"gocache/logs"
+	"gocache/replication"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TCP 服务器的请求格式是 1 字节的操作码、4 字节的 key 长度、key、4 字节的 value 长度和 value，长度都是大端序
+// 响应格式是 1 字节的状态码、4 字节的响应体长度和响应体，同一个连接上的请求按顺序处理，可以连续发送多个请求
+const (
+	// OpGet 读取 key，成功时响应体是 value
+	OpGet byte = 1
+
+	// OpSet 保存 key 和 value，响应体为空
+	OpSet byte = 2
+
+	// OpDelete 删除 key，响应体为空
+	OpDelete byte = 3
+
+	// OpStatus 返回和 /status 相同的 JSON，key 和 value 为空
+	OpStatus byte = 4
+
+	// OpAuth 使用 key 中的 API key 认证，设置了 API key 时需要先认证才能执行其他操作
+	OpAuth byte = 5
+)
+
+const (
+	// StatusOK 表示操作成功
+	StatusOK byte = 0
+
+	// StatusNotFound 表示 key 不存在
+	StatusNotFound byte = 1
+
+	// StatusError 表示请求有错误，响应体是错误信息
+	StatusError byte = 2
+
+	// StatusUnauthorized 表示没有认证或者 API key 错误
+	StatusUnauthorized byte = 3
+)
+
+const (
+	// maxTCPKeySize 是 TCP 请求中 key 的最大长度
+	maxTCPKeySize = 64 * 1024
+
+	// maxTCPValueSize 是 TCP 请求中 value 的最大长度
+	maxTCPValueSize = 64 * 1024 * 1024
+
+	// maxUnauthenticatedSize 是没有认证的连接上请求的 key 和 value 的最大长度，只需要容纳 OpAuth 中的 API key
+	// 读取请求时先检查长度再分配内存，避免没有认证的客户端让服务器分配大块内存
+	maxUnauthenticatedSize = 1024
+)
+
+// errUnauthenticatedTooLarge 表示没有认证的连接发送了超过 maxUnauthenticatedSize 的请求，服务器返回 StatusUnauthorized 并关闭连接
+var errUnauthenticatedTooLarge = errors.New("request too large before authentication")
+
+// TCPServer 是使用长度前缀的二进制协议的 TCP 服务器，和 HTTPServer 使用同一个缓存，可以避免 HTTP 的开销
+// 每个连接由一个协程处理，不支持租户和授权策略，只能使用 SetAPIKeys 设置的 API key 认证
+type TCPServer struct {
+	// cache 是底层存储的结构
+	cache *caches.Cache
+
+	// apiKeys 是允许访问的 API key，类型是 []string，为空时不认证
+	apiKeys atomic.Value
+
+	// replica 不为 nil 并且还没有被提升为主节点时拒绝修改缓存的请求
+	replica *replication.Replica
+
+	// defaultTTL 是 OpSet 写入的 key 的过期时间，为 0 表示永不过期
+	defaultTTL time.Duration
+
+	// closing 为 1 表示服务器正在关闭
+	closing int32
+
+	// listeners 和 conns 是正在监听的地址和正在处理的连接
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+
+	// lock 保护 listeners 和 conns
+	lock sync.Mutex
+
+	// wg 用于等待所有连接处理完成
+	wg sync.WaitGroup
+}
+
+// NewTCPServer 返回一个关于 cache 的新 TCP 服务器
+func NewTCPServer(cache *caches.Cache) *TCPServer {
+	return &TCPServer{cache: cache, listeners: make(map[net.Listener]struct{}), conns: make(map[net.Conn]struct{})}
+}
+
+// SetAPIKeys 设置允许访问的 API key，设置后每个连接都需要先使用 OpAuth 认证
+// 服务器运行期间也可以调用，用于重新加载配置，已经认证的连接不受影响
+func (ts *TCPServer) SetAPIKeys(keys []string) {
+	ts.apiKeys.Store(keys)
+}
+
+// SetReplica 把本节点设置为 replica 的主节点的副本，提升为主节点之前 OpSet 和 OpDelete 返回错误
+func (ts *TCPServer) SetReplica(replica *replication.Replica) {
+	ts.replica = replica
+}
+
+// SetDefaultTTL 设置 OpSet 写入的 key 的过期时间，为 0 表示永不过期，二进制协议中没有过期时间
+func (ts *TCPServer) SetDefaultTTL(ttl time.Duration) {
+	ts.defaultTTL = ttl
+}
+
+// Run 在 address 上启动服务器
+func (ts *TCPServer) Run(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	return ts.Serve(listener)
+}
+
+// RunTLS 使用 certFile 和 keyFile 指定的证书和私钥在 address 上启动使用 TLS 的服务器
+func (ts *TCPServer) RunTLS(address string, certFile string, keyFile string) error {
+	listener, err := listenTLS(address, certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	return ts.Serve(listener)
+}
+
+// Serve 在 listener 上接收连接，每个连接启动一个协程处理，listener 被关闭之后返回 nil
+func (ts *TCPServer) Serve(listener net.Listener) error {
+	ts.lock.Lock()
+	ts.listeners[listener] = struct{}{}
+	ts.lock.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+
+		ts.lock.Lock()
+		if atomic.LoadInt32(&ts.closing) == 1 {
+			ts.lock.Unlock()
+			conn.Close()
+			return nil
+		}
+		ts.conns[conn] = struct{}{}
+		ts.wg.Add(1)
+		ts.lock.Unlock()
+		go ts.serveConn(conn)
+	}
+}
+
+// Shutdown 关闭所有的 listener，正在处理的请求完成之后关闭连接，直到 ctx 结束
+// 关闭之后还可以再调用 Serve，比如升级失败时使用原来的监听重新开始服务
+func (ts *TCPServer) Shutdown(ctx context.Context) error {
+	atomic.StoreInt32(&ts.closing, 1)
+	defer atomic.StoreInt32(&ts.closing, 0)
+	ts.lock.Lock()
+	for listener := range ts.listeners {
+		listener.Close()
+	}
+	ts.listeners = make(map[net.Listener]struct{})
+
+	// 等待请求的连接会立即读取超时，正在处理请求的连接写完响应之后退出
+	for conn := range ts.conns {
+		conn.SetReadDeadline(time.Now())
+	}
+	ts.lock.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		ts.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		ts.lock.Lock()
+		for conn := range ts.conns {
+			conn.Close()
+		}
+		ts.lock.Unlock()
+		return ctx.Err()
+	}
+}
+
+// serveConn 按顺序处理连接上的请求，直到连接关闭或者出现协议错误
+func (ts *TCPServer) serveConn(conn net.Conn) {
+	defer func() {
+		ts.lock.Lock()
+		delete(ts.conns, conn)
+		ts.lock.Unlock()
+		conn.Close()
+		ts.wg.Done()
+	}()
+
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+	authenticated := ts.authenticated("")
+	for atomic.LoadInt32(&ts.closing) == 0 {
+		op, key, value, err := readRequest(reader, authenticated)
+		if err != nil {
+			if errors.Is(err, errUnauthenticatedTooLarge) {
+				logs.Debugf("tcp connection %s closed: %v", conn.RemoteAddr(), err)
+				writeResponse(writer, StatusUnauthorized, nil)
+				writer.Flush()
+			} else if !errors.Is(err, io.EOF) && !isTimeout(err) {
+				logs.Debugf("tcp connection %s closed: %v", conn.RemoteAddr(), err)
+				writeResponse(writer, StatusError, []byte(err.Error()))
+				writer.Flush()
+			}
+			return
+		}
+
+		status, body := ts.handle(op, key, value, &authenticated)
+		if err = writeResponse(writer, status, body); err != nil {
+			return
+		}
+
+		// 客户端连续发送的请求都处理完之后再一起写出响应
+		if reader.Buffered() == 0 {
+			if err = writer.Flush(); err != nil {
+				return
+			}
+		}
+	}
+	writer.Flush()
+}
+
+// handle 执行一个请求，返回状态码和响应体
+func (ts *TCPServer) handle(op byte, key string, value []byte, authenticated *bool) (byte, []byte) {
+	if op == OpAuth {
+		*authenticated = ts.authenticated(key)
+		if !*authenticated {
+			return StatusUnauthorized, nil
+		}
+		return StatusOK, nil
+	}
+
+	if !*authenticated {
+		return StatusUnauthorized, nil
+	}
+
+	if (op == OpSet || op == OpDelete) && ts.replica != nil && ts.replica.ReadOnly() {
+		return StatusError, []byte("read only replica")
+	}
+
+	if err := caches.CheckKey(key); err != nil {
+		return StatusError, []byte(err.Error())
+	}
+
+	switch op {
+	case OpGet:
+		value, ok := ts.cache.Get(key)
+		if !ok {
+			return StatusNotFound, nil
+		}
+		return StatusOK, value
+	case OpSet:
+		if err := ts.cache.TrySet(key, value, ts.defaultTTL, caches.PriorityNormal); err != nil {
+			return StatusError, []byte(err.Error())
+		}
+		return StatusOK, nil
+	case OpDelete:
+		ts.cache.Delete(key)
+		return StatusOK, nil
+	case OpStatus:
+		status, _ := json.Marshal(map[string]interface{}{"count": ts.cache.Count()})
+		return StatusOK, status
+	}
+	return StatusError, []byte(fmt.Sprintf("unknown op %d", op))
+}
+
+// authenticated 返回 key 是否是允许访问的 API key，没有设置 API key 时总是返回 true
+func (ts *TCPServer) authenticated(key string) bool {
+	apiKeys, _ := ts.apiKeys.Load().([]string)
+	if len(apiKeys) == 0 {
+		return true
+	}
+
+	ok := false
+	for _, apiKey := range apiKeys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(apiKey)) == 1 {
+			ok = true
+		}
+	}
+	return ok
+}
+
+// readRequest 读取一个请求，key 或者 value 超过长度限制时返回错误
+// authenticated 为 false 时 key 和 value 最多 maxUnauthenticatedSize 字节，超过时不读取剩下的数据，返回 errUnauthenticatedTooLarge
+func readRequest(reader *bufio.Reader, authenticated bool) (op byte, key string, value []byte, err error) {
+	var header [5]byte
+	if _, err = io.ReadFull(reader, header[:]); err != nil {
+		return 0, "", nil, err
+	}
+
+	op = header[0]
+	keySize := binary.BigEndian.Uint32(header[1:])
+	if !authenticated && keySize > maxUnauthenticatedSize {
+		return 0, "", nil, errUnauthenticatedTooLarge
+	}
+
+	if keySize > maxTCPKeySize {
+		return 0, "", nil, fmt.Errorf("key too large: %d", keySize)
+	}
+
+	keyBytes := make([]byte, keySize)
+	if _, err = io.ReadFull(reader, keyBytes); err != nil {
+		return 0, "", nil, err
+	}
+
+	var sizeBytes [4]byte
+	if _, err = io.ReadFull(reader, sizeBytes[:]); err != nil {
+		return 0, "", nil, err
+	}
+
+	valueSize := binary.BigEndian.Uint32(sizeBytes[:])
+	if !authenticated && valueSize > maxUnauthenticatedSize {
+		return 0, "", nil, errUnauthenticatedTooLarge
+	}
+
+	if valueSize > maxTCPValueSize {
+		return 0, "", nil, fmt.Errorf("value too large: %d", valueSize)
+	}
+
+	value = make([]byte, valueSize)
+	if _, err = io.ReadFull(reader, value); err != nil {
+		return 0, "", nil, err
+	}
+	return op, string(keyBytes), value, nil
+}
+
+// writeResponse 写入一个响应
+func writeResponse(writer *bufio.Writer, status byte, body []byte) error {
+	var header [5]byte
+	header[0] = status
+	binary.BigEndian.PutUint32(header[1:], uint32(len(body)))
+	if _, err := writer.Write(header[:]); err != nil {
+		return err
+	}
+
+	_, err := writer.Write(body)
+	return err
+}
+
+// isTimeout 返回 err 是否是读写超时，服务器关闭时等待请求的连接会读取超时
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,224 @@
+package servers
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"gocache/caches"
+)
+
+// startTCPServer 在随机端口上启动 ts，返回服务器的地址和 Serve 的返回值
+func startTCPServer(t *testing.T, ts *TCPServer) (string, <-chan error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	served := make(chan error, 1)
+	go func() {
+		served <- ts.Serve(listener)
+	}()
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		ts.Shutdown(ctx)
+	})
+	return listener.Addr().String(), served
+}
+
+// tcpClient 是测试使用的 TCP 协议客户端
+type tcpClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func dialTCP(t *testing.T, address string) *tcpClient {
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return &tcpClient{conn: conn, reader: bufio.NewReader(conn)}
+}
+
+// frame 返回一个请求编码之后的数据，keySize 和 valueSize 是写在请求头中的长度，可以和实际的长度不同
+func frame(op byte, key string, keySize int, value string, valueSize int) []byte {
+	var size [4]byte
+	data := []byte{op}
+	binary.BigEndian.PutUint32(size[:], uint32(keySize))
+	data = append(append(data, size[:]...), key...)
+	binary.BigEndian.PutUint32(size[:], uint32(valueSize))
+	return append(append(data, size[:]...), value...)
+}
+
+// send 发送一个或多个请求
+func (tc *tcpClient) send(t *testing.T, frames ...[]byte) {
+	for _, data := range frames {
+		if _, err := tc.conn.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// receive 读取一个响应，返回状态码和响应体
+func (tc *tcpClient) receive(t *testing.T) (byte, string) {
+	var header [5]byte
+	if _, err := io.ReadFull(tc.reader, header[:]); err != nil {
+		t.Fatalf("reading response: %v", err)
+	}
+
+	body := make([]byte, binary.BigEndian.Uint32(header[1:]))
+	if _, err := io.ReadFull(tc.reader, body); err != nil {
+		t.Fatalf("reading response body: %v", err)
+	}
+	return header[0], string(body)
+}
+
+// do 发送一个请求并读取响应
+func (tc *tcpClient) do(t *testing.T, op byte, key string, value string) (byte, string) {
+	tc.send(t, frame(op, key, len(key), value, len(value)))
+	return tc.receive(t)
+}
+
+// closed 检查服务器关闭了连接
+func (tc *tcpClient) closed(t *testing.T) {
+	if _, err := tc.reader.ReadByte(); err != io.EOF {
+		t.Fatalf("connection is still open: %v", err)
+	}
+}
+
+func TestTCPOperations(t *testing.T) {
+	address, _ := startTCPServer(t, NewTCPServer(caches.NewCache()))
+	tc := dialTCP(t, address)
+
+	if status, _ := tc.do(t, OpGet, "k", ""); status != StatusNotFound {
+		t.Fatalf("get missing key = %d, want StatusNotFound", status)
+	}
+
+	if status, _ := tc.do(t, OpSet, "k", "value"); status != StatusOK {
+		t.Fatalf("set = %d", status)
+	}
+
+	if status, body := tc.do(t, OpGet, "k", ""); status != StatusOK || body != "value" {
+		t.Fatalf("get = %d, %q", status, body)
+	}
+
+	if status, body := tc.do(t, OpStatus, "", ""); status != StatusOK || body != `{"count":1}` {
+		t.Fatalf("status = %d, %s", status, body)
+	}
+
+	if status, _ := tc.do(t, OpDelete, "k", ""); status != StatusOK {
+		t.Fatalf("delete = %d", status)
+	}
+
+	if status, _ := tc.do(t, OpGet, "k", ""); status != StatusNotFound {
+		t.Fatalf("get deleted key = %d, want StatusNotFound", status)
+	}
+
+	if status, _ := tc.do(t, 99, "k", ""); status != StatusError {
+		t.Fatalf("unknown op = %d, want StatusError", status)
+	}
+
+	// 连续发送的请求按顺序处理，响应的顺序和请求一样
+	tc.send(t, frame(OpSet, "a", 1, "1", 1), frame(OpSet, "b", 1, "2", 1), frame(OpGet, "a", 1, "", 0), frame(OpGet, "b", 1, "", 0), frame(OpDelete, "a", 1, "", 0), frame(OpGet, "a", 1, "", 0))
+	for i, want := range []struct {
+		status byte
+		body   string
+	}{{StatusOK, ""}, {StatusOK, ""}, {StatusOK, "1"}, {StatusOK, "2"}, {StatusOK, ""}, {StatusNotFound, ""}} {
+		if status, body := tc.receive(t); status != want.status || body != want.body {
+			t.Fatalf("pipelined response %d = %d, %q, want %d, %q", i, status, body, want.status, want.body)
+		}
+	}
+}
+
+func TestTCPOversize(t *testing.T) {
+	address, _ := startTCPServer(t, NewTCPServer(caches.NewCache()))
+
+	// 超过长度限制时只发送请求头，服务器返回错误并关闭连接，不会等待剩下的数据
+	tc := dialTCP(t, address)
+	tc.send(t, frame(OpSet, "", maxTCPKeySize+1, "", 0))
+	if status, body := tc.receive(t); status != StatusError || !strings.Contains(body, "key too large") {
+		t.Fatalf("oversize key = %d, %q", status, body)
+	}
+	tc.closed(t)
+
+	tc = dialTCP(t, address)
+	tc.send(t, frame(OpSet, "k", 1, "", maxTCPValueSize+1))
+	if status, body := tc.receive(t); status != StatusError || !strings.Contains(body, "value too large") {
+		t.Fatalf("oversize value = %d, %q", status, body)
+	}
+	tc.closed(t)
+}
+
+func TestTCPAuth(t *testing.T) {
+	ts := NewTCPServer(caches.NewCache())
+	ts.SetAPIKeys([]string{"secret"})
+	address, _ := startTCPServer(t, ts)
+
+	tc := dialTCP(t, address)
+	if status, _ := tc.do(t, OpGet, "k", ""); status != StatusUnauthorized {
+		t.Fatalf("get before auth = %d, want StatusUnauthorized", status)
+	}
+
+	if status, _ := tc.do(t, OpAuth, "wrong", ""); status != StatusUnauthorized {
+		t.Fatalf("auth with a wrong key = %d, want StatusUnauthorized", status)
+	}
+
+	if status, _ := tc.do(t, OpAuth, "secret", ""); status != StatusOK {
+		t.Fatalf("auth = %d", status)
+	}
+
+	if status, _ := tc.do(t, OpSet, "k", "value"); status != StatusOK {
+		t.Fatalf("set after auth = %d", status)
+	}
+
+	// 认证之前声明了大 value 的请求在读取 value 之前就被拒绝，服务器不会为它分配内存
+	tc = dialTCP(t, address)
+	tc.send(t, frame(OpSet, "k", 1, "", maxTCPValueSize))
+	if status, _ := tc.receive(t); status != StatusUnauthorized {
+		t.Fatalf("large set before auth = %d, want StatusUnauthorized", status)
+	}
+	tc.closed(t)
+
+	tc = dialTCP(t, address)
+	tc.send(t, frame(OpAuth, "", maxUnauthenticatedSize+1, "", 0))
+	if status, _ := tc.receive(t); status != StatusUnauthorized {
+		t.Fatalf("large auth key = %d, want StatusUnauthorized", status)
+	}
+	tc.closed(t)
+}
+
+func TestTCPShutdown(t *testing.T) {
+	ts := NewTCPServer(caches.NewCache())
+	address, served := startTCPServer(t, ts)
+	tc := dialTCP(t, address)
+	if status, _ := tc.do(t, OpSet, "k", "value"); status != StatusOK {
+		t.Fatalf("set = %d", status)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := ts.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown = %v", err)
+	}
+
+	if err := <-served; err != nil {
+		t.Fatalf("Serve = %v, want nil", err)
+	}
+
+	// 空闲的连接被关闭，新的连接被拒绝
+	tc.closed(t)
+	if conn, err := net.Dial("tcp", address); err == nil {
+		conn.Close()
+		t.Fatal("dialed the server after Shutdown")
+	}
+}
@@ -0,0 +1,220 @@
+package servers
+
+import (
+	"context"
+	"crypto/subtle"
+	"gocache/caches"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Tenant 是一个租户，使用自己的 API key 访问，只能读写自己命名空间中的 key
+// key 的个数和占用的内存通过缓存的命名空间限制，需要使用 TenantPrefix 作为命名空间的前缀
+type Tenant struct {
+	// Name 是租户的名字
+	Name string
+
+	// APIKeys 是租户使用的 API key
+	APIKeys []string
+
+	// MaxOps 是每秒最多的请求数，为 0 表示不限制
+	MaxOps int64
+}
+
+// TenantPrefix 返回租户的命名空间前缀，租户访问的 key 在缓存中都带有这个前缀
+func TenantPrefix(name string) string {
+	return caches.NamespacePrefix(name)
+}
+
+// tenant 是运行中的租户，记录了当前这一秒的请求数
+type tenant struct {
+	Tenant
+
+	// second 是当前计数的秒，ops 是这一秒内的请求数
+	second int64
+	ops    int64
+
+	// lock 保护 second 和 ops
+	lock sync.Mutex
+}
+
+// allow 记录一次请求，返回这一秒内的请求数是否还在配额之内
+func (t *tenant) allow(now time.Time) bool {
+	if t.MaxOps <= 0 {
+		return true
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if second := now.Unix(); second != t.second {
+		t.second, t.ops = second, 0
+	}
+
+	t.ops++
+	return t.ops <= t.MaxOps
+}
+
+// tenantContextKey 是请求的 context 中保存租户的 key
+type tenantContextKey struct{}
+
+// tenantFrom 返回发出请求的租户，不是租户的请求返回 nil
+func tenantFrom(r *http.Request) *tenant {
+	t, _ := r.Context().Value(tenantContextKey{}).(*tenant)
+	return t
+}
+
+// keyedPrefixes 是路径的第二段是 key 的接口的前缀
+var keyedPrefixes = []string{"/cache/", "/locks/", "/leases/", "/reservations/", "/semaphores/", "/ratelimits/", "/type/", "/object/"}
+
+// keyedPath 返回 path 的第二段是否是 key
+func keyedPath(path string) bool {
+	for _, prefix := range keyedPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// keySuffixes 是 /cache/:key 下面的子路径
+var keySuffixes = []string{"/incr", "/decr", "/expire", "/ttl", "/info"}
+
+// pathKey 返回 path 的第二段中的 key，path 需要满足 keyedPath，/cache/:key/incr 这样的子路径不属于 key
+func pathKey(path string) string {
+	key := path[strings.Index(path[1:], "/")+2:]
+	if strings.HasPrefix(path, "/cache/") {
+		for _, suffix := range keySuffixes {
+			if len(key) > len(suffix) && strings.HasSuffix(key, suffix) {
+				return strings.TrimSuffix(key, suffix)
+			}
+		}
+	}
+	return key
+}
+
+// SetTenants 设置租户，设置后使用租户 API key 的请求只能访问 /cache、/cache/:key 和它的子路径、/events、/flush、/flush/:id、/locks/:key、/leases/:key、/reservations/:key、/semaphores/:key、/ratelimits/:key、/type/:key、/object/:key、/batch、/tenant/usage 和 /cluster/nodes
+// 请求中的 key 会加上租户的命名空间前缀，租户之间互相看不到对方的 key
+// 设置了租户时，没有带 API key 的请求不再被当作管理员
+func (hs *HTTPServer) SetTenants(tenants []Tenant) {
+	hs.tenants = make([]*tenant, 0, len(tenants))
+	for _, t := range tenants {
+		hs.tenants = append(hs.tenants, &tenant{Tenant: t})
+	}
+}
+
+// findTenant 返回使用 key 的租户，没有时返回 nil
+// 使用固定时间的比较，避免通过响应时间猜出 key
+func (hs *HTTPServer) findTenant(key string) *tenant {
+	if key == "" {
+		return nil
+	}
+
+	var found *tenant
+	for _, t := range hs.tenants {
+		for _, apiKey := range t.APIKeys {
+			if subtle.ConstantTimeCompare([]byte(key), []byte(apiKey)) == 1 {
+				found = t
+			}
+		}
+	}
+	return found
+}
+
+// serveTenant 处理租户的请求，读写缓存的请求会被改写成访问租户命名空间中的 key
+func (hs *HTTPServer) serveTenant(w http.ResponseWriter, r *http.Request, t *tenant, router http.Handler) {
+	if !t.allow(time.Now()) {
+		w.Header().Set("Retry-After", "1")
+		writeJSON(w, http.StatusTooManyRequests, map[string]interface{}{
+			"error":    "ops quota exceeded",
+			"tenant":   t.Name,
+			"resource": "ops",
+			"limit":    t.MaxOps,
+		})
+		return
+	}
+
+	r = r.WithContext(context.WithValue(r.Context(), tenantContextKey{}, t))
+	switch {
+	case r.URL.Path == "/tenant/usage" && r.Method == http.MethodGet:
+		hs.tenantUsageHandler(w, r, nil)
+	case r.URL.Path == "/cluster/nodes" && r.Method == http.MethodGet && hs.cluster != nil:
+		hs.clusterNodesHandler(w, r, nil)
+	case r.URL.Path == "/cache" && r.Method == http.MethodGet:
+		// 遍历时在 scanHandler 中加上租户的命名空间前缀
+		router.ServeHTTP(w, r)
+	case r.URL.Path == "/events" && r.Method == http.MethodGet:
+		// 事件流在 eventsHandler 中只推送租户的命名空间中的 key
+		router.ServeHTTP(w, r)
+	case r.URL.Path == "/flush" && r.Method == http.MethodPost,
+		strings.HasPrefix(r.URL.Path, "/flush/") && (r.Method == http.MethodGet || r.Method == http.MethodDelete):
+		// 异步删除在 flushHandler 中只删除租户的命名空间中的 key，租户只能看到自己开始的删除
+		router.ServeHTTP(w, r)
+	case r.URL.Path == batchPath && r.Method == http.MethodPost:
+		// 批量操作中的 key 在 batchHandler 中加上租户的命名空间前缀
+		router.ServeHTTP(w, r)
+	case keyedPath(r.URL.Path):
+		// 路径的第二段是 key，加上租户的命名空间前缀
+		prefix := r.URL.Path[:strings.Index(r.URL.Path[1:], "/")+2]
+		url := *r.URL
+		url.Path = prefix + TenantPrefix(t.Name) + strings.TrimPrefix(url.Path, prefix)
+		url.RawPath = ""
+		r.URL = &url
+		router.ServeHTTP(w, r)
+	default:
+		w.WriteHeader(http.StatusForbidden)
+	}
+}
+
+// tenantUsageHandler 返回发出请求的租户的使用情况和配额
+func (hs *HTTPServer) tenantUsageHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	t := tenantFrom(r)
+	result := map[string]interface{}{
+		"tenant":  t.Name,
+		"max_ops": t.MaxOps,
+	}
+
+	for _, usage := range hs.cache.NamespaceUsage() {
+		if usage.Prefix == TenantPrefix(t.Name) {
+			result["keys"] = usage.Keys
+			result["bytes"] = usage.Bytes
+			result["max_keys"] = usage.MaxKeys
+			result["max_bytes"] = usage.MaxBytes
+			result["max_write_bytes"] = usage.MaxWriteBytes
+			result["byte_seconds"] = usage.ByteSeconds
+			result["usage"] = usage.OpsUsage
+		}
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// tenantsHandler 返回所有租户的使用情况和配额
+func (hs *HTTPServer) tenantsHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	usages := make(map[string]caches.NamespaceUsage)
+	for _, usage := range hs.cache.NamespaceUsage() {
+		usages[usage.Prefix] = usage
+	}
+
+	tenants := make([]map[string]interface{}, 0, len(hs.tenants))
+	for _, t := range hs.tenants {
+		usage := usages[TenantPrefix(t.Name)]
+		tenants = append(tenants, map[string]interface{}{
+			"tenant":          t.Name,
+			"keys":            usage.Keys,
+			"bytes":           usage.Bytes,
+			"max_keys":        usage.MaxKeys,
+			"max_bytes":       usage.MaxBytes,
+			"max_write_bytes": usage.MaxWriteBytes,
+			"max_ops":         t.MaxOps,
+			"byte_seconds":    usage.ByteSeconds,
+			"usage":           usage.OpsUsage,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"tenants": tenants,
+	})
+}
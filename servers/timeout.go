@@ -0,0 +1,161 @@
+package servers
+
+import (
+	"context"
+	"gocache/logs"
+	"gocache/replication"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Timeouts 是各个操作的请求的超时时间，操作的含义和 Policy 中的 Actions 一样，为 0 表示不限制
+// 开始发送响应体之前超时的请求返回 504，之后超时的请求中止响应，处理请求时遍历 key 这样耗时很长的操作会检查请求的 context 并提前中止
+type Timeouts struct {
+	Read   time.Duration
+	Write  time.Duration
+	Delete time.Duration
+	Stats  time.Duration
+	Admin  time.Duration
+}
+
+// of 返回 action 的超时时间
+func (t Timeouts) of(action string) time.Duration {
+	switch action {
+	case ActionRead:
+		return t.Read
+	case ActionWrite:
+		return t.Write
+	case ActionDelete:
+		return t.Delete
+	case ActionStats:
+		return t.Stats
+	case ActionAdmin:
+		return t.Admin
+	}
+	return 0
+}
+
+// SetTimeouts 设置各个操作的请求的超时时间，服务器运行期间也可以调用，用于重新加载配置
+func (hs *HTTPServer) SetTimeouts(timeouts Timeouts) {
+	hs.timeouts.Store(timeouts)
+}
+
+// timeoutOf 返回请求的超时时间，流式返回的请求不限制
+func (hs *HTTPServer) timeoutOf(r *http.Request) time.Duration {
+	timeouts, _ := hs.timeouts.Load().(Timeouts)
+	switch r.URL.Path {
+	case "/events", "/admin/export", replication.StreamPath:
+		return 0
+	}
+
+	action, _ := requestAction(r)
+	return timeouts.of(action)
+}
+
+// serveWithTimeout 调用 serve 处理请求，超过 timeout 还没有开始写入响应体时返回 504
+// serve 设置的响应头和状态码会先缓存起来，第一次写入响应体时才发送，之后的写入直接发送，大的 value 可以边读取边发送
+// 已经开始发送响应之后超时的请求不能再返回 504，这时中止响应，之后 serve 的写入都会被丢弃
+func (hs *HTTPServer) serveWithTimeout(w http.ResponseWriter, r *http.Request, timeout time.Duration, serve http.HandlerFunc) {
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	tw := &timeoutWriter{w: w, ctx: ctx, header: make(http.Header)}
+	done := make(chan struct{})
+	panicked := make(chan interface{}, 1)
+	go func() {
+		defer func() {
+			if v := recover(); v != nil {
+				panicked <- v
+			}
+		}()
+		serve(tw, r)
+		close(done)
+	}()
+
+	select {
+	case v := <-panicked:
+		panic(v)
+	case <-done:
+	case <-ctx.Done():
+	}
+
+	// serve 可能在超时的同时处理完，这时也按照超时处理，没有开始写入响应体时返回 504
+	tw.lock.Lock()
+	defer tw.lock.Unlock()
+	switch ctx.Err() {
+	case nil:
+		if !tw.committed {
+			tw.commit()
+		}
+	case context.DeadlineExceeded:
+		tw.timedOut = true
+		logs.Warnf("%s %s from %s timed out after %s", r.Method, r.URL.Path, clientIP(r), timeout)
+		if !tw.committed {
+			http.Error(w, "operation timed out", http.StatusGatewayTimeout)
+		}
+	default:
+		// 客户端断开连接时不需要返回响应
+		tw.timedOut = true
+	}
+}
+
+// timeoutWriter 缓存 serveWithTimeout 中处理请求时设置的响应头和状态码，第一次写入响应体时发送给 w
+type timeoutWriter struct {
+	w      http.ResponseWriter
+	header http.Header
+
+	// ctx 是带有超时时间的请求的 context，超时之后 serveWithTimeout 还没有设置 timedOut 时也不能再写入
+	ctx context.Context
+
+	// lock 保护下面的字段和对 w 的写入，超时之后处理请求的协程可能还在写入
+	lock        sync.Mutex
+	code        int
+	wroteHeader bool
+	committed   bool
+	timedOut    bool
+}
+
+// Header 返回响应头，开始写入响应体之后的修改不会被发送
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+// Write 写入响应体，第一次写入时先发送响应头和状态码，已经超时时返回 http.ErrHandlerTimeout
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.lock.Lock()
+	defer tw.lock.Unlock()
+	if tw.timedOut || tw.ctx.Err() != nil {
+		return 0, http.ErrHandlerTimeout
+	}
+
+	if !tw.committed {
+		tw.commit()
+	}
+	return tw.w.Write(p)
+}
+
+// WriteHeader 记录状态码，只有第一次调用有效
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.lock.Lock()
+	defer tw.lock.Unlock()
+	if tw.timedOut || tw.wroteHeader || tw.ctx.Err() != nil {
+		return
+	}
+	tw.code, tw.wroteHeader = code, true
+}
+
+// commit 把缓存的响应头和状态码发送给 w，没有设置状态码时是 200，需要在持有 lock 时调用
+func (tw *timeoutWriter) commit() {
+	header := tw.w.Header()
+	for key, values := range tw.header {
+		header[key] = values
+	}
+
+	if !tw.wroteHeader {
+		tw.code, tw.wroteHeader = http.StatusOK, true
+	}
+	tw.w.WriteHeader(tw.code)
+	tw.committed = true
+}
@@ -0,0 +1,106 @@
+package servers
+
+import (
+	"bytes"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gocache/caches"
+)
+
+// countingWriter 记录每次写入响应体的字节数
+type countingWriter struct {
+	*httptest.ResponseRecorder
+	writes []int
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	cw.writes = append(cw.writes, len(p))
+	return cw.ResponseRecorder.Write(p)
+}
+
+func TestTimeoutStreamsLargeObject(t *testing.T) {
+	options := caches.DefaultOptions()
+	options.LargeObjectThreshold = 64 << 10
+	hs := NewHTTPServer(caches.NewCacheWithOptions(options))
+	hs.SetTimeouts(Timeouts{Read: time.Minute, Write: time.Minute})
+	handler := hs.handler()
+
+	value := make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(value)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/cache/large", bytes.NewReader(value)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("PUT = %d", w.Code)
+	}
+
+	// 响应体逐块发送，不会先缓存整个 value
+	cw := &countingWriter{ResponseRecorder: httptest.NewRecorder()}
+	handler.ServeHTTP(cw, httptest.NewRequest(http.MethodGet, "/cache/large", nil))
+	if cw.Code != http.StatusOK || !bytes.Equal(cw.Body.Bytes(), value) {
+		t.Fatalf("GET = %d, %d bytes, want %d bytes", cw.Code, cw.Body.Len(), len(value))
+	}
+
+	for _, n := range cw.writes {
+		if n > options.LargeObjectThreshold {
+			t.Fatalf("GET wrote %d bytes at once, want at most %d", n, options.LargeObjectThreshold)
+		}
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/cache/large", nil)
+	request.Header.Set("Range", "bytes=100000-199999")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, request)
+	if w.Code != http.StatusPartialContent || !bytes.Equal(w.Body.Bytes(), value[100000:200000]) {
+		t.Fatalf("GET with Range = %d, %d bytes", w.Code, w.Body.Len())
+	}
+}
+
+func TestServeWithTimeout(t *testing.T) {
+	hs := NewHTTPServer(caches.NewCache())
+
+	// 没有开始写入响应体时超时返回 504，之后的写入被丢弃
+	w := httptest.NewRecorder()
+	written := make(chan error, 1)
+	hs.serveWithTimeout(w, httptest.NewRequest(http.MethodGet, "/cache/k", nil), 10*time.Millisecond, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Version", "1")
+		<-r.Context().Done()
+		_, err := w.Write([]byte("late"))
+		written <- err
+	})
+
+	if w.Code != http.StatusGatewayTimeout || w.Header().Get("X-Version") != "" {
+		t.Fatalf("timed out before writing = %d, headers %v, want 504", w.Code, w.Header())
+	}
+
+	if err := <-written; err != http.ErrHandlerTimeout {
+		t.Fatalf("Write after timeout = %v, want ErrHandlerTimeout", err)
+	}
+
+	// 已经开始写入响应体时不能再返回 504，已经发送的部分保持不变
+	w = httptest.NewRecorder()
+	hs.serveWithTimeout(w, httptest.NewRequest(http.MethodGet, "/cache/k", nil), 10*time.Millisecond, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("partial"))
+		<-r.Context().Done()
+		w.Write([]byte(" late"))
+	})
+
+	if w.Code != http.StatusAccepted || w.Body.String() != "partial" {
+		t.Fatalf("timed out after writing = %d, %q, want 202 and the partial body", w.Code, w.Body.String())
+	}
+
+	// 在超时之前处理完时返回处理器设置的状态码和响应头
+	w = httptest.NewRecorder()
+	hs.serveWithTimeout(w, httptest.NewRequest(http.MethodGet, "/cache/k", nil), time.Minute, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Version", "2")
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	if w.Code != http.StatusNoContent || w.Header().Get("X-Version") != "2" {
+		t.Fatalf("finished = %d, headers %v, want 204", w.Code, w.Header())
+	}
+}
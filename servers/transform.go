@@ -0,0 +1,159 @@
+package servers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// transformError 是不能对 value 进行转换的错误，code 是返回的状态码
+type transformError struct {
+	code int
+	msg  string
+}
+
+func (te *transformError) Error() string {
+	return te.msg
+}
+
+// hasTransform 返回请求是否需要在服务端转换 value
+func hasTransform(r *http.Request) bool {
+	query := r.URL.Query()
+	return query.Get("field") != "" || query.Get("range") != ""
+}
+
+// writeTransformed 按照请求中的参数转换 value 并写入响应，只需要大 value 中的一部分时可以避免传输整个 value
+// field 参数是用 . 分隔的 JSON 路径，比如 user.name 或者 items.0.id，返回这个位置的 JSON 值
+// range 参数是字节范围，比如 0-1023、1024- 或者 -100（最后 100 个字节），在 field 之后应用，返回 206 和 Content-Range
+func writeTransformed(w http.ResponseWriter, r *http.Request, value []byte) {
+	query := r.URL.Query()
+	var err error
+	if field := query.Get("field"); field != "" {
+		if value, err = extractField(value, field); err != nil {
+			writeTransformError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+	}
+
+	if spec := query.Get("range"); spec != "" {
+		start, end, err := parseRange(spec, len(value))
+		if err != nil {
+			var te *transformError
+			if errors.As(err, &te) && te.code == http.StatusRequestedRangeNotSatisfiable {
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", len(value)))
+			}
+			writeTransformError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end-1, len(value)))
+		w.WriteHeader(http.StatusPartialContent)
+		value = value[start:end]
+	}
+	w.Write(value)
+}
+
+// writeTransformError 返回转换失败的错误
+func writeTransformError(w http.ResponseWriter, err error) {
+	var te *transformError
+	if errors.As(err, &te) {
+		http.Error(w, te.msg, te.code)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+// extractField 返回 JSON 格式的 value 中 field 路径上的值，对象使用成员名，数组使用下标
+// value 不是 JSON 时返回 409，路径不存在时返回 404
+func extractField(value []byte, field string) ([]byte, error) {
+	doc, err := decodeJSON(value)
+	if err != nil {
+		return nil, &transformError{code: http.StatusConflict, msg: errNotJSON.Error()}
+	}
+
+	for _, name := range strings.Split(field, ".") {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			child, ok := node[name]
+			if !ok {
+				return nil, &transformError{code: http.StatusNotFound, msg: "field " + field + " not found"}
+			}
+			doc = child
+		case []interface{}:
+			i, err := arrayIndex(name, len(node)-1)
+			if err != nil {
+				return nil, &transformError{code: http.StatusNotFound, msg: "field " + field + " not found"}
+			}
+			doc = node[i]
+		default:
+			return nil, &transformError{code: http.StatusNotFound, msg: "field " + field + " not found"}
+		}
+	}
+	return json.Marshal(doc)
+}
+
+// parseRange 解析 range 参数，返回 [start, end) 的范围，size 是 value 的字节数
+// 格式错误时返回 400，范围和 value 没有交集时返回 416，end 超过 size 时截断到 size
+func parseRange(spec string, size int) (int, int, error) {
+	first, last, ok := strings.Cut(spec, "-")
+	if !ok || (first == "" && last == "") {
+		return 0, 0, &transformError{code: http.StatusBadRequest, msg: "invalid range " + spec}
+	}
+
+	parse := func(s string) (int, error) {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return 0, &transformError{code: http.StatusBadRequest, msg: "invalid range " + spec}
+		}
+		return n, nil
+	}
+
+	if first == "" {
+		// -N 表示最后 N 个字节
+		n, err := parse(last)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		if n == 0 || size == 0 {
+			return 0, 0, &transformError{code: http.StatusRequestedRangeNotSatisfiable, msg: "range " + spec + " not satisfiable"}
+		}
+
+		if n > size {
+			n = size
+		}
+		return size - n, size, nil
+	}
+
+	start, err := parse(first)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	end := size
+	if last != "" {
+		if end, err = parse(last); err != nil {
+			return 0, 0, err
+		}
+
+		if end < start {
+			return 0, 0, &transformError{code: http.StatusBadRequest, msg: "invalid range " + spec}
+		}
+
+		// end 包含在范围内，先截断到 size 再加一，避免 end 为 math.MaxInt64 时溢出
+		if end >= size {
+			end = size
+		} else {
+			end++
+		}
+	}
+
+	if start >= size {
+		return 0, 0, &transformError{code: http.StatusRequestedRangeNotSatisfiable, msg: "range " + spec + " not satisfiable"}
+	}
+	return start, end, nil
+}
@@ -0,0 +1,63 @@
+package servers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gocache/caches"
+)
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		spec       string
+		size       int
+		start, end int
+		code       int
+	}{
+		{spec: "0-4", size: 10, start: 0, end: 5},
+		{spec: "2-", size: 10, start: 2, end: 10},
+		{spec: "-3", size: 10, start: 7, end: 10},
+		{spec: "-20", size: 10, start: 0, end: 10},
+		{spec: "5-5", size: 10, start: 5, end: 6},
+		{spec: "8-20", size: 10, start: 8, end: 10},
+		{spec: "9-9", size: 10, start: 9, end: 10},
+		{spec: "0-9223372036854775807", size: 10, start: 0, end: 10},
+		{spec: "9223372036854775807-9223372036854775807", size: 10, code: http.StatusRequestedRangeNotSatisfiable},
+		{spec: "0-9223372036854775808", size: 10, code: http.StatusBadRequest},
+		{spec: "10-", size: 10, code: http.StatusRequestedRangeNotSatisfiable},
+		{spec: "-0", size: 10, code: http.StatusRequestedRangeNotSatisfiable},
+		{spec: "0-0", size: 0, code: http.StatusRequestedRangeNotSatisfiable},
+		{spec: "5-4", size: 10, code: http.StatusBadRequest},
+		{spec: "-", size: 10, code: http.StatusBadRequest},
+		{spec: "4", size: 10, code: http.StatusBadRequest},
+		{spec: "a-b", size: 10, code: http.StatusBadRequest},
+		{spec: "-1-2", size: 10, code: http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		start, end, err := parseRange(test.spec, test.size)
+		if test.code != 0 {
+			var transformErr *transformError
+			if !errors.As(err, &transformErr) || transformErr.code != test.code {
+				t.Errorf("parseRange(%q, %d) error = %v, want %d", test.spec, test.size, err, test.code)
+			}
+			continue
+		}
+
+		if err != nil || start != test.start || end != test.end {
+			t.Errorf("parseRange(%q, %d) = %d, %d, %v, want %d, %d", test.spec, test.size, start, end, err, test.start, test.end)
+		}
+	}
+}
+
+func TestGetRangeMaxInt(t *testing.T) {
+	cache := caches.NewCache()
+	cache.Set("v", []byte("0123456789"))
+	w := httptest.NewRecorder()
+	NewHTTPServer(cache).handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/cache/v?range=3-9223372036854775807", nil))
+	if w.Code != http.StatusPartialContent || w.Body.String() != "3456789" {
+		t.Fatalf("GET range to MaxInt64 = %d %q", w.Code, w.Body)
+	}
+}
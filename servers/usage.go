@@ -0,0 +1,76 @@
+package servers
+
+import (
+	"encoding/csv"
+	"gocache/caches"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// usageColumns 是 CSV 格式的用量报告的列
+var usageColumns = []string{
+	"start", "end", "kind", "name", "keys", "bytes", "byte_seconds",
+	"reads", "writes", "deletes", "read_bytes", "write_bytes",
+}
+
+// usageHandler 返回当前计费周期内每个租户、命名空间和前缀分组的用量，?format=csv 时以 CSV 文件下载
+func (hs *HTTPServer) usageHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	hs.writeUsage(w, r, hs.cache.UsageReport(false))
+}
+
+// resetUsageHandler 结束当前的计费周期并返回这个周期的用量，之后的用量计入新的周期
+func (hs *HTTPServer) resetUsageHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	hs.writeUsage(w, r, hs.cache.UsageReport(true))
+}
+
+// writeUsage 按照请求中的 format 返回用量报告，可以是 json 或者 csv
+func (hs *HTTPServer) writeUsage(w http.ResponseWriter, r *http.Request, report caches.UsageReport) {
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "json":
+		writeJSON(w, http.StatusOK, report)
+	case "csv":
+		name := "usage-" + report.End.UTC().Format("20060102T150405Z") + ".csv"
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+		hs.writeUsageCSV(w, report)
+	default:
+		http.Error(w, "unknown format "+format, http.StatusBadRequest)
+	}
+}
+
+// writeUsageCSV 以 CSV 格式写入用量报告，每个命名空间和前缀分组一行
+// 租户的命名空间的 kind 是 tenant，name 是租户的名字，前缀分组的键值对个数和字节数是生成报告时的值，没有 byte_seconds
+func (hs *HTTPServer) writeUsageCSV(w http.ResponseWriter, report caches.UsageReport) {
+	tenants := make(map[string]string, len(hs.tenants))
+	for _, t := range hs.tenants {
+		tenants[TenantPrefix(t.Name)] = t.Name
+	}
+
+	start, end := report.Start.UTC().Format(time.RFC3339), report.End.UTC().Format(time.RFC3339)
+	row := func(kind string, name string, keys int64, bytes int64, byteSeconds string, ops caches.OpsUsage) []string {
+		return []string{
+			start, end, kind, name,
+			strconv.FormatInt(keys, 10), strconv.FormatInt(bytes, 10), byteSeconds,
+			strconv.FormatInt(ops.Reads, 10), strconv.FormatInt(ops.Writes, 10), strconv.FormatInt(ops.Deletes, 10),
+			strconv.FormatInt(ops.ReadBytes, 10), strconv.FormatInt(ops.WriteBytes, 10),
+		}
+	}
+
+	writer := csv.NewWriter(w)
+	writer.Write(usageColumns)
+	for _, usage := range report.Namespaces {
+		kind, name := "namespace", usage.Prefix
+		if tenant, ok := tenants[usage.Prefix]; ok {
+			kind, name = "tenant", tenant
+		}
+		writer.Write(row(kind, name, usage.Keys, usage.Bytes, strconv.FormatFloat(usage.ByteSeconds, 'f', 3, 64), usage.OpsUsage))
+	}
+
+	for _, stats := range report.Prefixes {
+		writer.Write(row("prefix", stats.Prefix, stats.Keys, stats.Bytes, "", stats.OpsUsage))
+	}
+	writer.Flush()
+}
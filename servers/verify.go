@@ -0,0 +1,101 @@
+package servers
+
+import (
+	"context"
+	"gocache/caches"
+	"gocache/logs"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// verifyJob 是后台进行的数据校验，同一时间只有一次校验在进行
+type verifyJob struct {
+	lock sync.Mutex
+
+	// running 表示是否有校验正在进行，fix 是这次校验是否修复损坏的 value
+	running bool
+	fix     bool
+
+	// startedAt 和 finishedAt 是最近一次校验开始和结束的时间，还没有校验过时为零值
+	startedAt  time.Time
+	finishedAt time.Time
+
+	// report 和 err 是最近一次完成的校验的结果
+	report caches.VerifyReport
+	err    error
+}
+
+// verifyHandler 在后台开始一次数据校验并返回 202，重新计算所有 value 的校验和，找出在内存中损坏的 value
+// 默认修复损坏的 value，配置了后端时从后端重新加载，加载不到或者没有后端时删除，dry_run=true 时只报告不修改
+// 没有开启校验和时返回 400，已经有校验在进行时返回 409，结果通过 GET /admin/verify 查看
+func (hs *HTTPServer) verifyHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	if !hs.cache.Checksums() {
+		http.Error(w, "checksums are not enabled", http.StatusBadRequest)
+		return
+	}
+
+	job := &hs.verify
+	job.lock.Lock()
+	defer job.lock.Unlock()
+	if job.running {
+		http.Error(w, "verification already in progress", http.StatusConflict)
+		return
+	}
+
+	job.running, job.fix, job.startedAt = true, r.URL.Query().Get("dry_run") != "true", time.Now()
+	go hs.runVerify(job.fix)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// runVerify 校验所有的 value 并记录结果，fix 为 true 时修复损坏的 value
+func (hs *HTTPServer) runVerify(fix bool) {
+	var repair caches.RepairFunc
+	if co := hs.backend; co != nil {
+		repair = func(ctx context.Context, key string) ([]byte, bool, error) {
+			ctx, cancel := context.WithTimeout(ctx, co.timeout)
+			defer cancel()
+			return co.backend.Load(ctx, key)
+		}
+	}
+
+	report, err := hs.cache.Verify(context.Background(), fix, repair)
+	if err != nil {
+		logs.Errorf("verify failed: %v", err)
+	} else if report.Corrupted > 0 {
+		logs.Warnf("verify found %d corrupted values, repaired %d, deleted %d", report.Corrupted, report.Repaired, report.Deleted)
+	}
+
+	job := &hs.verify
+	job.lock.Lock()
+	defer job.lock.Unlock()
+	job.running, job.finishedAt, job.report, job.err = false, time.Now(), report, err
+}
+
+// verifyStatusHandler 返回数据校验的状态和最近一次完成的校验的结果
+func (hs *HTTPServer) verifyStatusHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	job := &hs.verify
+	job.lock.Lock()
+	defer job.lock.Unlock()
+
+	status := map[string]interface{}{
+		"checksums":   hs.cache.Checksums(),
+		"in_progress": job.running,
+	}
+
+	if !job.startedAt.IsZero() {
+		status["started_at"] = job.startedAt.Unix()
+		status["fix"] = job.fix
+	}
+
+	if !job.finishedAt.IsZero() {
+		status["finished_at"] = job.finishedAt.Unix()
+		status["report"] = job.report
+		if job.err != nil {
+			status["error"] = job.err.Error()
+		}
+	}
+	writeJSON(w, http.StatusOK, status)
+}
@@ -0,0 +1,217 @@
+// Package sqlcache 使用 gocache 缓存 database/sql 的查询结果
+// 结果的 key 由语句和参数计算，查询可以声明依赖的表，修改表之后调用 Invalidate 或者使用 Exec 让依赖它的结果失效
+package sqlcache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+func init() {
+	// 驱动返回的值除了基本类型之外还可能是 time.Time
+	gob.Register(time.Time{})
+}
+
+// Store 是保存查询结果的缓存，*caches.Cache 实现了这个接口
+type Store interface {
+	// Get 返回 key 对应的数据，找不到或者已经过期时返回 false
+	Get(key string) ([]byte, bool)
+
+	// SetWithTTL 保存 key 和 value，ttl 之后过期
+	SetWithTTL(key string, value []byte, ttl time.Duration)
+
+	// Delete 删除 key
+	Delete(key string)
+}
+
+// DB 是执行查询的数据库，*sql.DB、*sql.Tx 和 *sql.Conn 都实现了这个接口
+type DB interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// defaultPrefix 是默认的 key 前缀
+const defaultPrefix = "sqlcache:"
+
+// Cache 缓存 DB 的查询结果，可以被多个协程同时使用
+type Cache struct {
+	// DB 是执行查询的数据库
+	DB DB
+
+	// Store 是保存查询结果的缓存
+	Store Store
+
+	// Prefix 是缓存中 key 的前缀，默认为 "sqlcache:"
+	Prefix string
+
+	// TTL 是查询结果的存活时间，即使没有失效，超过这个时间也会重新查询
+	TTL time.Duration
+
+	// OnInvalidate 在表失效之后调用，可以为 nil，比如用于通知其他进程或者记录日志
+	OnInvalidate func(tables []string)
+
+	// OnEncodeError 在查询结果不能编码、因此没有被缓存时调用，可以为 nil，比如驱动返回了没有使用 gob.Register 注册的类型
+	OnEncodeError func(query string, err error)
+}
+
+// Result 是缓存的查询结果
+type Result struct {
+	// Columns 是结果的列名
+	Columns []string
+
+	// Rows 是结果的每一行，值的类型是驱动返回的类型，比如 int64、float64、bool、[]byte、string、time.Time 和 nil
+	Rows [][]interface{}
+}
+
+// New 返回使用 store 缓存 db 的查询结果的缓存，结果在 ttl 之后过期
+func New(db DB, store Store, ttl time.Duration) *Cache {
+	return &Cache{DB: db, Store: store, Prefix: defaultPrefix, TTL: ttl}
+}
+
+// Query 执行查询并缓存结果，相同的语句和参数在结果过期之前直接返回缓存的结果
+func (c *Cache) Query(ctx context.Context, query string, args ...interface{}) (*Result, error) {
+	return c.QueryTables(ctx, nil, query, args...)
+}
+
+// QueryTables 执行依赖 tables 的查询并缓存结果，任何一个表失效之后结果也会失效
+// 结果不能编码时不缓存，仍然返回查询的结果，错误通过 OnEncodeError 报告
+func (c *Cache) QueryTables(ctx context.Context, tables []string, query string, args ...interface{}) (*Result, error) {
+	key := c.key(tables, query, args)
+	if data, ok := c.Store.Get(key); ok {
+		result := new(Result)
+		if err := gob.NewDecoder(bytes.NewReader(data)).Decode(result); err == nil {
+			return result, nil
+		}
+	}
+
+	result, err := c.query(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	var buffer bytes.Buffer
+	if err = gob.NewEncoder(&buffer).Encode(result); err != nil {
+		if c.OnEncodeError != nil {
+			c.OnEncodeError(query, fmt.Errorf("sqlcache: encode result failed: %w", err))
+		}
+		return result, nil
+	}
+	c.Store.SetWithTTL(key, buffer.Bytes(), c.TTL)
+	return result, nil
+}
+
+// Exec 执行修改 tables 的语句，成功之后让依赖这些表的查询结果失效
+func (c *Cache) Exec(ctx context.Context, tables []string, query string, args ...interface{}) (sql.Result, error) {
+	result, err := c.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Invalidate(tables...)
+	return result, nil
+}
+
+// Invalidate 让依赖 tables 的查询结果失效
+// 每个表有一个版本号，查询结果的 key 包含依赖的表的版本号，失效时更新版本号，旧的结果不会再被读到，过期之后自动删除
+func (c *Cache) Invalidate(tables ...string) {
+	if len(tables) == 0 {
+		return
+	}
+
+	version := strconv.FormatInt(time.Now().UnixNano(), 10)
+	for _, table := range tables {
+		c.Store.SetWithTTL(c.versionKey(table), []byte(version), 0)
+	}
+
+	if c.OnInvalidate != nil {
+		c.OnInvalidate(tables)
+	}
+}
+
+// InvalidateQuery 删除依赖 tables 的某个查询的结果
+func (c *Cache) InvalidateQuery(tables []string, query string, args ...interface{}) {
+	c.Store.Delete(c.key(tables, query, args))
+}
+
+// query 执行查询并读取所有的行
+func (c *Cache) query(ctx context.Context, query string, args []interface{}) (*Result, error) {
+	rows, err := c.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{Columns: columns}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+
+		if err = rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+
+		// 驱动返回的 []byte 在下一次 Next 之后可能会被覆盖
+		for i, value := range values {
+			if b, ok := value.([]byte); ok {
+				values[i] = append([]byte(nil), b...)
+			}
+		}
+		result.Rows = append(result.Rows, values)
+	}
+	return result, rows.Err()
+}
+
+// key 返回查询结果的 key，由依赖的表的版本号、语句和参数计算
+func (c *Cache) key(tables []string, query string, args []interface{}) string {
+	hash := sha256.New()
+	for _, table := range tables {
+		version, _ := c.Store.Get(c.versionKey(table))
+		fmt.Fprintf(hash, "%s@%s\x00", table, version)
+	}
+
+	hash.Write([]byte(query))
+	for _, arg := range args {
+		fmt.Fprintf(hash, "\x00%T:%v", arg, arg)
+	}
+	return c.prefix() + hex.EncodeToString(hash.Sum(nil))
+}
+
+// versionKey 返回表的版本号的 key
+func (c *Cache) versionKey(table string) string {
+	return c.prefix() + "version:" + table
+}
+
+// prefix 返回 key 的前缀
+func (c *Cache) prefix() string {
+	if c.Prefix == "" {
+		return defaultPrefix
+	}
+	return c.Prefix
+}
+
+// Maps 将结果的每一行转换成列名到值的 map
+func (r *Result) Maps() []map[string]interface{} {
+	maps := make([]map[string]interface{}, len(r.Rows))
+	for i, row := range r.Rows {
+		maps[i] = make(map[string]interface{}, len(r.Columns))
+		for j, column := range r.Columns {
+			maps[i][column] = row[j]
+		}
+	}
+	return maps
+}
@@ -0,0 +1,80 @@
+// Package systemd 实现了 systemd 的 socket activation 和 sd_notify 协议，不依赖 libsystemd
+package systemd
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// listenFdsStart 是 systemd 传递的第一个文件描述符
+const listenFdsStart = 3
+
+// Listeners 返回 systemd 通过 socket activation 传递的监听，不是由 systemd 启动时返回空
+// 返回之前会清除相关的环境变量，避免子进程再次使用这些文件描述符
+func Listeners() ([]net.Listener, error) {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return nil, nil
+	}
+
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	listeners := make([]net.Listener, 0, count)
+	for fd := listenFdsStart; fd < listenFdsStart+count; fd++ {
+		name := "LISTEN_FD_" + strconv.Itoa(fd)
+		if i := fd - listenFdsStart; i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+
+		// FileListener 会复制文件描述符，关闭原来的文件描述符可以避免它被子进程继承
+		file := os.NewFile(uintptr(fd), name)
+		listener, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			for _, listener := range listeners {
+				listener.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, listener)
+	}
+	return listeners, nil
+}
+
+// Notify 向 systemd 报告服务的状态，比如 "READY=1"、"RELOADING=1" 和 "STOPPING=1"
+// 不是由 systemd 启动或者服务类型不是 notify 时什么也不做，返回 false
+func Notify(state string) (bool, error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return false, nil
+	}
+
+	// @ 开头的是 abstract socket，对应的地址以 0 字节开头
+	address := &net.UnixAddr{Name: socket, Net: "unixgram"}
+	if strings.HasPrefix(socket, "@") {
+		address.Name = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, address)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	if _, err = conn.Write([]byte(state)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,69 @@
+package tiered
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Invalidator 通知其他实例删除本地缓存中被修改的 key
+type Invalidator interface {
+	// Publish 通知其他实例 key 被修改了
+	Publish(ctx context.Context, key string) error
+}
+
+// defaultInvalidatePath 是接收修改通知的默认路径
+const defaultInvalidatePath = "/_tiered/invalidate"
+
+// HTTPInvalidator 通过 HTTP 将修改通知发给其他实例，其他实例需要把 Tiered 挂载到 Path 上
+type HTTPInvalidator struct {
+	// Peers 是其他实例的地址，比如 "http://10.0.0.2:8000"，不需要包括本实例
+	Peers []string
+
+	// Path 是接收修改通知的路径，默认为 "/_tiered/invalidate"
+	Path string
+
+	// Client 是发送通知使用的客户端，为 nil 时使用 http.DefaultClient
+	Client *http.Client
+}
+
+// Publish 向所有实例发送 key 的修改通知，返回所有发送失败的错误
+func (h *HTTPInvalidator) Publish(ctx context.Context, key string) error {
+	path := h.Path
+	if path == "" {
+		path = defaultInvalidatePath
+	}
+
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	var errs []string
+	for _, peer := range h.Peers {
+		address := strings.TrimSuffix(peer, "/") + path + "?key=" + url.QueryEscape(key)
+		request, err := http.NewRequestWithContext(ctx, http.MethodPost, address, nil)
+		if err != nil {
+			return err
+		}
+
+		response, err := client.Do(request)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		response.Body.Close()
+
+		if response.StatusCode/100 != 2 {
+			errs = append(errs, fmt.Sprintf("%s returned %s", peer, response.Status))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.New("tiered: publish invalidation failed: " + strings.Join(errs, "; "))
+	}
+	return nil
+}
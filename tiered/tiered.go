@@ -0,0 +1,178 @@
+// Package tiered 将本地的小缓存和远程的 gocache 组合成两级缓存
+// 读取先查本地缓存，没有命中时读取远程缓存并保存到本地，写入同时写远程和本地缓存，并通知其他实例删除本地的旧数据
+package tiered
+
+import (
+	"context"
+	"gocache/caches"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Store 是一级缓存，*client.Client 实现了这个接口，本地的 *caches.Cache 可以使用 NewLocal 包装
+type Store interface {
+	// Get 返回 key 对应的数据，找不到或者已经过期时返回 false
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+
+	// SetWithTTL 保存 key 和 value，ttl 之后过期，ttl 为 0 表示永不过期
+	SetWithTTL(ctx context.Context, key string, value []byte, ttl time.Duration) error
+
+	// Delete 删除 key
+	Delete(ctx context.Context, key string) error
+}
+
+// Local 将本地的缓存包装成 Store
+type Local struct {
+	cache *caches.Cache
+}
+
+// NewLocal 返回使用 cache 的 Store
+func NewLocal(cache *caches.Cache) *Local {
+	return &Local{cache: cache}
+}
+
+// Get 返回 key 对应的数据
+func (l *Local) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, ok := l.cache.Get(key)
+	return value, ok, nil
+}
+
+// SetWithTTL 保存 key 和 value，ttl 之后过期
+func (l *Local) SetWithTTL(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	l.cache.SetWithTTL(key, value, ttl)
+	return nil
+}
+
+// Delete 删除 key
+func (l *Local) Delete(ctx context.Context, key string) error {
+	l.cache.Delete(key)
+	return nil
+}
+
+// Stats 是两级缓存的统计数据，都是从创建开始累计的次数
+type Stats struct {
+	// L1Hits 和 L2Hits 是在本地和远程缓存中命中的次数，Misses 是都没有命中的次数
+	L1Hits int64 `json:"l1_hits"`
+	L2Hits int64 `json:"l2_hits"`
+	Misses int64 `json:"misses"`
+
+	// Invalidations 是收到其他实例通知删除本地数据的次数
+	Invalidations int64 `json:"invalidations"`
+}
+
+// Tiered 是由本地缓存 L1 和远程缓存 L2 组成的两级缓存，可以被多个协程同时使用
+// L1 中的数据最多保存 L1TTL，即使没有收到删除通知，其他实例修改的数据最多 L1TTL 之后也能读到
+type Tiered struct {
+	// L1 是本地缓存，L2 是远程缓存
+	L1 Store
+	L2 Store
+
+	// L1TTL 是数据在本地缓存中的存活时间
+	L1TTL time.Duration
+
+	// Invalidator 用于通知其他实例删除本地缓存中被修改的数据，为 nil 时不通知
+	Invalidator Invalidator
+
+	// OnError 在通知其他实例或者写入本地缓存失败时调用，可以为 nil
+	OnError func(err error)
+
+	stats Stats
+}
+
+// New 返回由 l1 和 l2 组成的两级缓存，数据在 l1 中最多保存 l1TTL
+func New(l1 Store, l2 Store, l1TTL time.Duration) *Tiered {
+	return &Tiered{L1: l1, L2: l2, L1TTL: l1TTL}
+}
+
+// Get 返回 key 对应的数据，先查本地缓存，没有命中时查远程缓存，命中后保存到本地缓存
+func (t *Tiered) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	if value, ok, err := t.L1.Get(ctx, key); err == nil && ok {
+		atomic.AddInt64(&t.stats.L1Hits, 1)
+		return value, true, nil
+	}
+
+	value, ok, err := t.L2.Get(ctx, key)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if !ok {
+		atomic.AddInt64(&t.stats.Misses, 1)
+		return nil, false, nil
+	}
+
+	atomic.AddInt64(&t.stats.L2Hits, 1)
+	t.report(t.L1.SetWithTTL(ctx, key, value, t.L1TTL))
+	return value, true, nil
+}
+
+// SetWithTTL 将 key 和 value 写入远程缓存和本地缓存，并通知其他实例删除本地的旧数据，ttl 是数据在远程缓存中的存活时间
+func (t *Tiered) SetWithTTL(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if err := t.L2.SetWithTTL(ctx, key, value, ttl); err != nil {
+		return err
+	}
+
+	l1TTL := t.L1TTL
+	if ttl > 0 && ttl < l1TTL {
+		l1TTL = ttl
+	}
+
+	t.report(t.L1.SetWithTTL(ctx, key, value, l1TTL))
+	t.publish(ctx, key)
+	return nil
+}
+
+// Delete 从远程缓存和本地缓存中删除 key，并通知其他实例删除本地的数据
+func (t *Tiered) Delete(ctx context.Context, key string) error {
+	if err := t.L2.Delete(ctx, key); err != nil {
+		return err
+	}
+
+	t.report(t.L1.Delete(ctx, key))
+	t.publish(ctx, key)
+	return nil
+}
+
+// Invalidate 删除本地缓存中的 key，用于收到其他实例的修改通知
+func (t *Tiered) Invalidate(ctx context.Context, key string) {
+	atomic.AddInt64(&t.stats.Invalidations, 1)
+	t.report(t.L1.Delete(ctx, key))
+}
+
+// Stats 返回两级缓存的统计数据
+func (t *Tiered) Stats() Stats {
+	return Stats{
+		L1Hits:        atomic.LoadInt64(&t.stats.L1Hits),
+		L2Hits:        atomic.LoadInt64(&t.stats.L2Hits),
+		Misses:        atomic.LoadInt64(&t.stats.Misses),
+		Invalidations: atomic.LoadInt64(&t.stats.Invalidations),
+	}
+}
+
+// ServeHTTP 处理其他实例的 HTTPInvalidator 发来的修改通知，key 参数是被修改的 key
+func (t *Tiered) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	for _, key := range r.URL.Query()["key"] {
+		t.Invalidate(r.Context(), key)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// publish 通知其他实例 key 被修改了
+func (t *Tiered) publish(ctx context.Context, key string) {
+	if t.Invalidator != nil {
+		t.report(t.Invalidator.Publish(ctx, key))
+	}
+}
+
+// report 在 err 不为 nil 时调用 OnError
+func (t *Tiered) report(err error) {
+	if err != nil && t.OnError != nil {
+		t.OnError(err)
+	}
+}
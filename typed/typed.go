@@ -0,0 +1,131 @@
+// Package typed 在 gocache 的缓存上提供类型安全的读写
+// value 使用 Codec 编码成字节数组保存在 *caches.Cache 中，读取时解码成 T，调用者不需要自己编码和做类型断言
+package typed
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"gocache/caches"
+	"time"
+)
+
+// Codec 把 T 编码成保存在缓存中的字节数组
+type Codec[T any] interface {
+	Marshal(v T) ([]byte, error)
+	Unmarshal(data []byte) (T, error)
+}
+
+// JSONCodec 使用 JSON 编码，是 New 默认使用的编码方式，其他语言的客户端也可以读取
+type JSONCodec[T any] struct{}
+
+// Marshal 把 v 编码成 JSON
+func (JSONCodec[T]) Marshal(v T) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal 把 JSON 解码成 T
+func (JSONCodec[T]) Unmarshal(data []byte) (T, error) {
+	var v T
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
+// GobCodec 使用 gob 编码，比 JSON 更紧凑，但是只有 Go 程序可以读取
+// 编码的是具体的类型 T，而不是 interface{}，所以 T 本身不需要调用 gob.Register 注册
+type GobCodec[T any] struct{}
+
+// Marshal 把 v 编码成 gob
+func (GobCodec[T]) Marshal(v T) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(&v)
+	return buf.Bytes(), err
+}
+
+// Unmarshal 把 gob 解码成 T
+func (GobCodec[T]) Unmarshal(data []byte) (T, error) {
+	var v T
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&v)
+	return v, err
+}
+
+// Cache 是保存 T 类型的 value 的缓存，可以被多个协程同时使用
+// 多个 Cache 可以共用一个 *caches.Cache，这时需要使用不同的 key 前缀或者命名空间，避免读到其他类型的 value
+type Cache[T any] struct {
+	cache *caches.Cache
+	codec Codec[T]
+}
+
+// New 返回使用 JSON 编码、把 value 保存在 cache 中的 Cache
+func New[T any](cache *caches.Cache) *Cache[T] {
+	return NewWithCodec[T](cache, JSONCodec[T]{})
+}
+
+// NewWithCodec 返回使用 codec 编码、把 value 保存在 cache 中的 Cache
+func NewWithCodec[T any](cache *caches.Cache, codec Codec[T]) *Cache[T] {
+	return &Cache[T]{cache: cache, codec: codec}
+}
+
+// Get 返回 key 对应的 value，找不到、已经过期或者保存的不是 T 类型的 value 时返回 false
+func (c *Cache[T]) Get(key string) (T, bool) {
+	var zero T
+	data, ok := c.cache.Get(key)
+	if !ok {
+		return zero, false
+	}
+
+	v, err := c.codec.Unmarshal(data)
+	if err != nil {
+		return zero, false
+	}
+	return v, true
+}
+
+// Set 保存 key 和 v，ttl 之后过期，ttl 为 0 表示永不过期
+// 编码失败、key 不合法、value 太大，或者开启了 RejectWhenFull 时缓存已满都会返回错误，这时 key 没有被保存
+func (c *Cache[T]) Set(key string, v T, ttl time.Duration) error {
+	data, err := c.codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.cache.TrySet(key, data, ttl, caches.PriorityNormal)
+}
+
+// Add 只在 key 不存在或者已经过期时保存 key 和 v，ttl 之后过期，返回是否保存了
+// 编码失败或者写入被拒绝时返回错误，见 caches.Cache.TrySetNX
+func (c *Cache[T]) Add(key string, v T, ttl time.Duration) (bool, error) {
+	data, err := c.codec.Marshal(v)
+	if err != nil {
+		return false, err
+	}
+	return c.cache.TrySetNX(key, data, ttl)
+}
+
+// Update 原子地使用 fn 的返回值替换 key 的 value，过期时间保持不变，返回修改后的 value
+// key 不存在或者已经过期时不调用 fn 并返回 false，保存的 value 解码失败或者 fn 返回错误时放弃修改并返回这个错误
+// fn 在缓存中 key 的锁下调用，不能再访问同一个缓存
+func (c *Cache[T]) Update(key string, fn func(v T) (T, error)) (T, bool, error) {
+	var updated T
+	_, ok, err := c.cache.Update(key, func(data []byte) ([]byte, error) {
+		v, err := c.codec.Unmarshal(data)
+		if err != nil {
+			return nil, err
+		}
+
+		if updated, err = fn(v); err != nil {
+			return nil, err
+		}
+		return c.codec.Marshal(updated)
+	})
+
+	if !ok || err != nil {
+		var zero T
+		return zero, ok, err
+	}
+	return updated, true, nil
+}
+
+// Delete 删除 key
+func (c *Cache[T]) Delete(key string) {
+	c.cache.Delete(key)
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gocache/caches"
+	"gocache/configs"
+	"gocache/logs"
+	"gocache/servers"
+	"gocache/systemd"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+const (
+	// inheritedListenersEnv 是新的进程从旧的进程继承的监听个数，文件描述符从 3 开始
+	inheritedListenersEnv = "GOCACHE_INHERITED_LISTENERS"
+
+	// inheritedSnapshotEnv 不为空表示旧的进程会通过管道传递缓存数据
+	inheritedSnapshotEnv = "GOCACHE_INHERITED_SNAPSHOT"
+)
+
+// inheritance 是不停机升级时新的进程从旧的进程继承的状态
+type inheritance struct {
+	// listeners 是旧的进程正在使用的监听
+	listeners []net.Listener
+
+	// snapshot 用于读取旧的进程传递的缓存数据，为 nil 表示从持久化文件中恢复数据
+	snapshot *os.File
+
+	// ready 用于通知旧的进程新的进程已经准备好
+	ready *os.File
+}
+
+// inherit 返回从旧的进程继承的状态，不是通过不停机升级启动时返回 nil
+// 继承的文件描述符依次是所有的监听、通知准备好的管道和传递缓存数据的管道
+func inherit() (*inheritance, error) {
+	value, ok := os.LookupEnv(inheritedListenersEnv)
+	if !ok {
+		return nil, nil
+	}
+
+	_, withSnapshot := os.LookupEnv(inheritedSnapshotEnv)
+	os.Unsetenv(inheritedListenersEnv)
+	os.Unsetenv(inheritedSnapshotEnv)
+
+	count, err := strconv.Atoi(value)
+	if err != nil || count < 0 {
+		return nil, fmt.Errorf("invalid %s %q", inheritedListenersEnv, value)
+	}
+
+	result := &inheritance{}
+	for fd := 3; fd < 3+count; fd++ {
+		file := os.NewFile(uintptr(fd), "listener")
+		listener, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			for _, listener := range result.listeners {
+				listener.Close()
+			}
+			return nil, err
+		}
+		result.listeners = append(result.listeners, listener)
+	}
+
+	result.ready = os.NewFile(uintptr(3+count), "ready")
+	if withSnapshot {
+		result.snapshot = os.NewFile(uintptr(4+count), "snapshot")
+	}
+	return result, nil
+}
+
+// Ready 通知旧的进程新的进程已经准备好，旧的进程收到后会退出
+func (i *inheritance) Ready() error {
+	defer i.ready.Close()
+	_, err := i.ready.Write([]byte("ready"))
+	return err
+}
+
+// upgrade 启动新的进程并将监听交给它，用于替换二进制文件之后不停机升级
+// 旧的进程先停止接收新的连接并等待正在处理的请求完成，这期间新的连接会在监听队列中等待新的进程处理，不会被拒绝
+// 成功时返回 nil, nil，旧的进程应该不再持久化直接退出
+// 新的进程没有准备好时旧的进程会使用原来的监听重新开始服务，返回新的 Manager 和失败的原因
+func upgrade(manager *servers.Manager, serving endpoints, cache *caches.Cache, saver *caches.AutoSaver, aof *caches.AOF, config configs.UpgradeConfig) (*servers.Manager, error) {
+	files, err := manager.Files()
+	if err != nil {
+		return manager, err
+	}
+	defer func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.Timeout))
+	defer cancel()
+	if err = manager.Shutdown(ctx); err != nil {
+		logs.Errorf("shutdown servers failed: %v", err)
+	}
+
+	// 停止服务之后不会再有新的修改，这时的数据就是交给新的进程的数据
+	if aof != nil {
+		if err = aof.Flush(); err != nil {
+			logs.Errorf("flush aof failed: %v", err)
+		}
+	}
+
+	if !config.Snapshot && saver != nil {
+		err = saver.Save()
+	}
+
+	if err == nil {
+		err = handoff(files, cache, time.Duration(config.Timeout), config.Snapshot)
+		if err == nil {
+			return nil, nil
+		}
+	}
+
+	listeners := make([]net.Listener, 0, len(files))
+	for _, file := range files {
+		listener, err := net.FileListener(file)
+		if err != nil {
+			return nil, fmt.Errorf("restore listener failed: %w", err)
+		}
+		listeners = append(listeners, listener)
+	}
+
+	next := servers.NewManager()
+	serving.addListeners(next, listeners)
+	if err := next.Start(); err != nil {
+		return nil, err
+	}
+	return next, err
+}
+
+// handoff 启动新的进程，将 files 中的监听交给它，并等待它准备好
+// snapshot 为 true 时通过管道将缓存数据交给新的进程
+func handoff(files []*os.File, cache *caches.Cache, timeout time.Duration, snapshot bool) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	readyReader, readyWriter, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer readyReader.Close()
+
+	command := exec.Command(executable, os.Args[1:]...)
+	command.Stdout = os.Stdout
+	command.Stderr = os.Stderr
+	command.Env = append(os.Environ(), inheritedListenersEnv+"="+strconv.Itoa(len(files)))
+	command.ExtraFiles = append(append([]*os.File{}, files...), readyWriter)
+
+	var snapshotReader, snapshotWriter *os.File
+	if snapshot {
+		if snapshotReader, snapshotWriter, err = os.Pipe(); err != nil {
+			readyWriter.Close()
+			return err
+		}
+		command.Env = append(command.Env, inheritedSnapshotEnv+"=1")
+		command.ExtraFiles = append(command.ExtraFiles, snapshotReader)
+	}
+
+	err = command.Start()
+	readyWriter.Close()
+	if snapshotReader != nil {
+		snapshotReader.Close()
+	}
+
+	if err != nil {
+		if snapshotWriter != nil {
+			snapshotWriter.Close()
+		}
+		return err
+	}
+
+	saved := make(chan error, 1)
+	if snapshotWriter != nil {
+		go func() {
+			err := cache.Save(snapshotWriter)
+			snapshotWriter.Close()
+			saved <- err
+		}()
+	}
+
+	// 新的进程准备好之后会写入 ready，没有写入就关闭管道说明它已经退出
+	ready := make(chan bool, 1)
+	go func() {
+		data, _ := ioutil.ReadAll(readyReader)
+		ready <- string(data) == "ready"
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case err := <-saved:
+			if err != nil {
+				command.Process.Kill()
+				command.Wait()
+				return fmt.Errorf("send snapshot failed: %w", err)
+			}
+		case ok := <-ready:
+			if !ok {
+				command.Process.Kill()
+				command.Wait()
+				return errors.New("new process exited before it was ready")
+			}
+
+			// 由 systemd 管理时需要告诉 systemd 主进程变成了新的进程
+			systemd.Notify("MAINPID=" + strconv.Itoa(command.Process.Pid))
+			logs.Infof("handed over to new process %d", command.Process.Pid)
+			return nil
+		case <-timer.C:
+			command.Process.Kill()
+			command.Wait()
+			return fmt.Errorf("new process was not ready in %s", timeout)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// upgradeSignal 是触发不停机升级的信号
+var upgradeSignal os.Signal = syscall.SIGUSR2
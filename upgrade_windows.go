@@ -0,0 +1,6 @@
+package main
+
+import "os"
+
+// upgradeSignal 是触发不停机升级的信号，Windows 不支持不停机升级
+var upgradeSignal os.Signal
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"gocache/caches"
+	"gocache/configs"
+	"gocache/logs"
+	"gocache/rdb"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// warmup 预热缓存，依次恢复持久化文件、导入 importRDB 指定的 RDB 文件和从 Source 导入 NDJSON 数据
+// importRDB 为空表示不导入 RDB 文件，apiKeys 是访问其他节点使用的 API key
+func warmup(cache *caches.Cache, cfg *configs.Config, importRDB string, apiKeys []string) error {
+	start := time.Now()
+
+	// 文件不存在说明是第一次启动
+	// 开启了 AOF 时从持久化文件恢复之后还要重放 AOF 中之后的操作，恢复到停止前的状态
+	if cfg.Persistence.AOF != "" {
+		snapshots := make([]string, 0, 1)
+		if cfg.Persistence.DumpDir != "" {
+			snapshots = append(snapshots, cfg.Persistence.DumpDir)
+		} else if cfg.Persistence.Dump != "" {
+			snapshots = append(snapshots, cfg.Persistence.Dump)
+		}
+
+		err := cache.LoadWithAOF(cfg.Persistence.AOF, snapshots...)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("load %s failed: %w", cfg.Persistence.AOF, err)
+		}
+	} else if cfg.Persistence.DumpDir != "" {
+		err := cache.LoadFromDir(cfg.Persistence.DumpDir)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("load %s failed: %w", cfg.Persistence.DumpDir, err)
+		}
+	} else if cfg.Persistence.Dump != "" {
+		err := cache.LoadFromFile(cfg.Persistence.Dump)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("load %s failed: %w", cfg.Persistence.Dump, err)
+		}
+	}
+
+	if importRDB != "" {
+		file, err := os.Open(importRDB)
+		if err != nil {
+			return err
+		}
+
+		stats, err := rdb.Import(cache, file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("import %s failed: %w", importRDB, err)
+		}
+		logs.Infof("imported %d keys from %s, skipped %d non-string keys and %d expired keys", stats.Imported, importRDB, stats.Skipped, stats.Expired)
+	}
+
+	if cfg.Warmup.Source != "" {
+		source, err := openWarmupSource(cfg.Warmup.Source, apiKeys)
+		if err != nil {
+			return fmt.Errorf("open warm-up source %s failed: %w", cfg.Warmup.Source, err)
+		}
+
+		imported, err := cache.ImportNDJSON(source)
+		source.Close()
+		if err != nil {
+			return fmt.Errorf("import from %s failed after %d records: %w", cfg.Warmup.Source, imported, err)
+		}
+		logs.Infof("imported %d keys from %s", imported, cfg.Warmup.Source)
+	}
+
+	logs.Infof("warm-up finished in %s with %d keys", time.Since(start).Round(time.Millisecond), cache.Count())
+	return nil
+}
+
+// openWarmupSource 打开预热使用的 NDJSON 数据，source 是 http:// 或者 https:// 开头的地址时从另一个节点读取
+// 访问另一个节点时使用 apiKeys 中的第一个 key
+func openWarmupSource(source string, apiKeys []string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return os.Open(source)
+	}
+
+	request, err := http.NewRequest(http.MethodGet, source, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(apiKeys) > 0 {
+		request.Header.Set("X-API-Key", apiKeys[0])
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close()
+		return nil, fmt.Errorf("unexpected status %s", response.Status)
+	}
+	return response.Body, nil
+}
@@ -0,0 +1,21 @@
+package watchdog
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// rss 返回当前进程占用的物理内存字节数，从 /proc/self/statm 中读取
+func rss() (uint64, error) {
+	data, err := ioutil.ReadFile("/proc/self/statm")
+	if err != nil {
+		return 0, err
+	}
+
+	var size, resident uint64
+	if _, err = fmt.Sscan(string(data), &size, &resident); err != nil {
+		return 0, fmt.Errorf("watchdog: parse /proc/self/statm: %w", err)
+	}
+	return resident * uint64(os.Getpagesize()), nil
+}
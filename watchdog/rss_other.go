@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package watchdog
+
+import "runtime"
+
+// rss 返回当前进程占用的内存字节数
+// 非 Linux 系统上没有统一的读取方式，使用 Go 运行时向系统申请的内存代替
+func rss() (uint64, error) {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.Sys, nil
+}
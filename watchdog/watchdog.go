@@ -0,0 +1,171 @@
+// Package watchdog 监控进程的内存占用，超过阈值时保存现场，方便事后分析内存暴涨的原因
+package watchdog
+
+import (
+	"encoding/json"
+	"gocache/caches"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"sync"
+	"time"
+)
+
+// Config 是内存监控的配置
+type Config struct {
+	// Threshold 是触发保存现场的物理内存字节数
+	Threshold uint64
+
+	// Dir 是保存堆内存分析文件和 key 占用报告的目录
+	Dir string
+
+	// Interval 是检查内存占用的时间间隔
+	Interval time.Duration
+
+	// TopKeys 是报告中列出的占用空间最大的 key 的个数
+	TopKeys int
+}
+
+// Watchdog 定时检查进程的物理内存占用，超过阈值时写入一份堆内存分析文件和一份 key 占用报告
+// 每次超过阈值只会触发一次，内存降到阈值以下之后才会再次触发，避免持续写入文件
+type Watchdog struct {
+	// cache 是需要生成 key 占用报告的缓存
+	cache *caches.Cache
+
+	// config 是内存监控的配置
+	config Config
+
+	// fired 表示这次超过阈值之后已经触发过了
+	fired bool
+
+	// stop 用于通知后台协程退出
+	stop chan struct{}
+
+	// wg 用于等待后台协程退出
+	wg sync.WaitGroup
+
+	// OnDump 在保存现场之后被调用，参数是写入的文件，为 nil 时忽略
+	OnDump func(files []string)
+
+	// OnError 在检查或者保存失败时被调用，为 nil 时忽略错误
+	OnError func(err error)
+}
+
+// New 返回一个监控内存占用的 Watchdog，需要调用 Start 才会开始工作
+func New(cache *caches.Cache, config Config) *Watchdog {
+	if config.Interval <= 0 {
+		config.Interval = 10 * time.Second
+	}
+
+	if config.TopKeys <= 0 {
+		config.TopKeys = 100
+	}
+
+	return &Watchdog{
+		cache:  cache,
+		config: config,
+		stop:   make(chan struct{}),
+	}
+}
+
+// Start 开启后台协程，每隔 Interval 检查一次内存占用
+func (wd *Watchdog) Start() {
+	wd.wg.Add(1)
+	go func() {
+		defer wd.wg.Done()
+		ticker := time.NewTicker(wd.config.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := wd.check(); err != nil && wd.OnError != nil {
+					wd.OnError(err)
+				}
+			case <-wd.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止监控，并等待正在进行的保存结束
+func (wd *Watchdog) Stop() {
+	close(wd.stop)
+	wd.wg.Wait()
+}
+
+// check 检查一次内存占用，超过阈值并且还没有触发过时保存现场
+func (wd *Watchdog) check() error {
+	used, err := rss()
+	if err != nil {
+		return err
+	}
+
+	if used < wd.config.Threshold {
+		wd.fired = false
+		return nil
+	}
+
+	if wd.fired {
+		return nil
+	}
+	wd.fired = true
+
+	files, err := wd.Dump(used)
+	if err != nil {
+		return err
+	}
+
+	if wd.OnDump != nil {
+		wd.OnDump(files)
+	}
+	return nil
+}
+
+// report 是写入磁盘的 key 占用报告
+type report struct {
+	Time time.Time `json:"time"`
+	RSS  uint64    `json:"rss"`
+	caches.SizeReport
+}
+
+// Dump 立即将堆内存分析文件和 key 占用报告写入 Dir，返回写入的文件
+func (wd *Watchdog) Dump(used uint64) ([]string, error) {
+	if err := os.MkdirAll(wd.config.Dir, 0755); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	suffix := now.Format("20060102T150405Z")
+	heapFile := filepath.Join(wd.config.Dir, "heap-"+suffix+".pprof")
+	if err := writeFile(heapFile, func(file *os.File) error {
+		return pprof.Lookup("heap").WriteTo(file, 0)
+	}); err != nil {
+		return nil, err
+	}
+
+	keysFile := filepath.Join(wd.config.Dir, "keys-"+suffix+".json")
+	content := report{Time: now, RSS: used, SizeReport: wd.cache.SizeReport(wd.config.TopKeys)}
+	if err := writeFile(keysFile, func(file *os.File) error {
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(content)
+	}); err != nil {
+		return []string{heapFile}, err
+	}
+	return []string{heapFile, keysFile}, nil
+}
+
+// writeFile 创建 path 指定的文件，并使用 write 写入内容
+func writeFile(path string, write func(file *os.File) error) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err = write(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}